@@ -0,0 +1,107 @@
+// backup takes gzip compressed snapshots of a ledger sqlite database and
+// restores them.
+//
+//	backup -db ledger.db -dir backups -keep 14
+//
+// takes a snapshot of ledger.db with the sqlite online backup API, so it
+// is safe to run while ledger serves the database. Snapshots go in the
+// backups directory and are named ledger.YYYYMMDDhhmmss.db.gz. Only the
+// 14 newest snapshots are kept.
+//
+//	backup restore -db ledger.db backups/ledger.20240309140507.db.gz
+//
+// checks the integrity of the snapshot, brings its schema up to date,
+// and recomputes its account totals. Only then does it move ledger.db
+// aside and put the snapshot in its place. Stop ledger before restoring.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/keep94/finances/fin/findb/sqlite_backup"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	fDb   string
+	fDir  string
+	fKeep int
+)
+
+func main() {
+	flag.Parse()
+	if flag.Arg(0) == "restore" {
+		restore(flag.Args()[1:])
+		return
+	}
+	if fDb == "" || flag.NArg() != 0 {
+		fmt.Println("Need to specify db")
+		flag.Usage()
+		os.Exit(1)
+	}
+	dir := fDir
+	if dir == "" {
+		dir = filepath.Dir(fDb)
+	}
+	// Opening a missing file would create an empty database to back up.
+	if _, err := os.Stat(fDb); err != nil {
+		log.Fatal(err)
+	}
+	rawdb, err := sql.Open("sqlite3", fDb)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rawdb.Close()
+	prefix := sqlite_backup.Prefix(fDb)
+	path, err := sqlite_backup.Snapshot(rawdb, dir, prefix, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Wrote", path)
+	removed, err := sqlite_backup.Rotate(dir, prefix, fKeep)
+	for _, r := range removed {
+		fmt.Println("Removed", r)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func restore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	var db string
+	flags.StringVar(&db, "db", "", "Path to database file to replace")
+	flags.Usage = func() {
+		fmt.Fprintln(
+			flags.Output(), "Usage: backup restore -db path snapshot")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if db == "" || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	result, err := sqlite_backup.Restore(flags.Arg(0), db, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i := range result.FixedAccounts {
+		fmt.Println("Fixed", &result.FixedAccounts[i])
+	}
+	if result.OldPath != "" {
+		fmt.Println("Moved old database to", result.OldPath)
+	}
+	fmt.Println("Restored", db)
+}
+
+func init() {
+	flag.StringVar(&fDb, "db", "", "Path to database file")
+	flag.StringVar(&fDir, "dir", "", "Directory for snapshots. Defaults to the directory of the database")
+	flag.IntVar(&fKeep, "keep", 14, "Number of snapshots to keep")
+}
@@ -0,0 +1,118 @@
+// fsck checks a ledger sqlite database. It recomputes the balances and
+// counts of every account from the entries and reports the accounts whose
+// stored totals differ. It also reports entries that cannot be read,
+// entries that refer to categories or accounts that do not exist, and
+// entries whose rows in the entry_items or entry_tags indexes do not
+// match them. With -fix, it stores the recomputed account totals and
+// rebuilds the mismatched index rows in one transaction.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	csqlite "github.com/keep94/finances/fin/categories/categoriesdb/for_sqlite"
+	"github.com/keep94/finances/fin/findb/for_sqlite"
+	"github.com/keep94/finances/fin/findb/sqlite_setup"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	fDb  string
+	fFix bool
+)
+
+func main() {
+	flag.Parse()
+	if fDb == "" {
+		fmt.Println("Need to specify db")
+		flag.Usage()
+		os.Exit(1)
+	}
+	rawdb, err := sql.Open("sqlite3", fDb)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbase := sqlite3_db.New(rawdb)
+	defer dbase.Close()
+	if err = dbase.Do(sqlite_setup.CheckSchema); err != nil {
+		log.Fatalf("Cannot check %s: %v", fDb, err)
+	}
+	doer := sqlite3_db.NewDoer(dbase)
+	cache := csqlite.New(dbase)
+	store := for_sqlite.New(dbase)
+	var result *for_sqlite.CheckResult
+	fixed, fixedItems := false, false
+	err = doer.Do(func(t db.Transaction) error {
+		cds, err := cache.Get(t)
+		if err != nil {
+			return err
+		}
+		result, err = store.Check(t, cds)
+		if err != nil {
+			return err
+		}
+		if !fFix {
+			return nil
+		}
+		if result.HasBadItems() {
+			fixedItems = true
+			if err := store.FixItems(t, result.Entries); err != nil {
+				return err
+			}
+		}
+		// Totals leave out entries that cannot be read, so storing them
+		// would make things worse.
+		if len(result.Accounts) == 0 || result.HasMalformedEntries() {
+			return nil
+		}
+		fixed = true
+		return store.FixAccounts(t, result.Accounts)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i := range result.Entries {
+		fmt.Println(&result.Entries[i])
+	}
+	for i := range result.Accounts {
+		fmt.Println(&result.Accounts[i])
+	}
+	if len(result.Entries) == 0 && len(result.Accounts) == 0 {
+		fmt.Println("No problems found.")
+		return
+	}
+	if fixedItems {
+		fmt.Println("Rebuilt the entry_items and entry_tags rows of the entries above.")
+	}
+	switch {
+	case fixed:
+		fmt.Printf("Fixed the totals of %d accounts.\n", len(result.Accounts))
+	case fFix && len(result.Accounts) > 0:
+		fmt.Println("Not fixing account totals while some entries cannot be read.")
+	}
+	if !fixed && len(result.Accounts) > 0 || hasUnfixed(result) {
+		os.Exit(1)
+	}
+}
+
+// hasUnfixed returns true if result has entry problems that fsck cannot
+// fix.
+func hasUnfixed(result *for_sqlite.CheckResult) bool {
+	for i := range result.Entries {
+		if !result.Entries[i].BadItems || !fFix {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	flag.StringVar(&fDb, "db", "", "Path to database file")
+	flag.BoolVar(&fFix, "fix", false, "Store recomputed account totals")
+}
@@ -3,6 +3,7 @@ package ac
 import (
 	"encoding/json"
 	"github.com/keep94/consume2"
+	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/aggregators"
 	"github.com/keep94/finances/fin/consumers"
@@ -16,15 +17,16 @@ const (
 )
 
 type Handler struct {
-	Store findb.EntriesRunner
 	Field func(e fin.Entry) string
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(findb.EntriesRunner)
 	aca := &aggregators.AutoCompleteAggregator{Field: h.Field}
 	acc := consumers.FromEntryAggregator(aca)
 	acc = consume2.Slice(acc, 0, kMaxAutoComplete)
-	err := h.Store.Entries(nil, nil, acc)
+	err := store.Entries(nil, nil, acc)
 	if err != nil {
 		http_util.ReportError(w, "Error reading database.", err)
 		return
@@ -6,7 +6,6 @@ import (
 	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/categories"
-	"github.com/keep94/finances/fin/categories/categoriesdb"
 	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/toolbox/db"
 	"github.com/keep94/toolbox/http_util"
@@ -17,7 +16,8 @@ import (
 )
 
 const (
-	kPageParam = "pageNo"
+	kPageParam      = "pageNo"
+	kPageTokenParam = "pt"
 )
 
 var (
@@ -33,7 +33,7 @@ var (
 <body>
 {{.LeftNav}}
 <div class="main">
-<h2>{{.Account.Name}}</h2>    
+<h2>{{.Account.Name}}{{with .Account.Currency}} ({{.}}){{end}}</h2>    
 {{with $top := .}}
 <a href="{{.NewEntryLink .Account.Id}}">New Entry</a>&nbsp;
 <a href="{{.UploadLink .Account.Id}}">Import Entries</a>&nbsp;
@@ -86,10 +86,12 @@ var (
 	kListEntriesUrl = http_util.NewUrl("/fin/list")
 )
 
+type Store interface {
+	findb.EntriesByAccountIdRunner
+	findb.EntriesPageRunner
+}
+
 type Handler struct {
-	Doer     db.Doer
-	Store    findb.EntriesByAccountIdRunner
-	Cdc      categoriesdb.Getter
 	PageSize int
 	Links    bool
 	LN       *common.LeftNav
@@ -97,6 +99,9 @@ type Handler struct {
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	cdc := session.Cache
 	r.ParseForm()
 	id, _ := strconv.ParseInt(r.Form.Get("acctId"), 10, 64)
 	selecter := common.SelectAccount(id)
@@ -108,25 +113,52 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if pageNo < 0 {
 		pageNo = 0
 	}
+	token := r.Form.Get(kPageTokenParam)
 	cds := categories.CatDetailStore{}
-	pager := consume2.NewPageBuilder[fin.EntryBalance](pageNo, h.PageSize)
 	account := fin.Account{}
-	err := h.Doer.Do(func(t db.Transaction) (err error) {
-		cds, err = h.Cdc.Get(t)
+	var entryBalances []fin.EntryBalance
+	var morePages bool
+	var nextToken string
+	err := session.Doer.Do(func(t db.Transaction) (err error) {
+		cds, err = cdc.Get(t)
 		if err != nil {
 			return
 		}
-		return findb.EntriesByAccountId(t, h.Store, id, &account, pager)
+		if token != "" {
+			nextToken, err = findb.EntriesByAccountIdPage(
+				t,
+				store,
+				id,
+				&account,
+				token,
+				h.PageSize,
+				consume2.AppendTo(&entryBalances))
+			morePages = nextToken != ""
+			return
+		}
+		pager := consume2.NewPageBuilder[fin.EntryBalance](pageNo, h.PageSize)
+		if err = findb.EntriesByAccountId(t, store, id, &account, pager); err != nil {
+			return
+		}
+		entryBalances, morePages = pager.Build()
+		if morePages {
+			last := &entryBalances[len(entryBalances)-1]
+			nextToken = findb.EncodePageToken(findb.CursorOf(&last.Entry))
+		}
+		return
 	})
 	if err == findb.NoSuchId {
 		fmt.Fprintln(w, "No such account.")
 		return
 	}
+	if err == findb.BadPageToken {
+		http_util.Error(w, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http_util.ReportError(w, "Error reading database.", err)
 		return
 	}
-	entryBalances, morePages := pager.Build()
 	var listEntriesUrl *url.URL
 	if h.Links {
 		listEntriesUrl = kListEntriesUrl
@@ -135,11 +167,15 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w,
 		kTemplate,
 		&view{
-			PageBreadCrumb: http_util.PageBreadCrumb{
-				URL:         r.URL,
-				PageNoParam: kPageParam,
-				PageNo:      pageNo,
-				End:         !morePages,
+			PageTokenBreadCrumb: common.PageTokenBreadCrumb{
+				PageBreadCrumb: http_util.PageBreadCrumb{
+					URL:         r.URL,
+					PageNoParam: kPageParam,
+					PageNo:      pageNo,
+					End:         !morePages,
+				},
+				TokenParam: kPageTokenParam,
+				NextToken:  nextToken,
 			},
 			Values:      entryBalances,
 			CatLinker:   common.CatLinker{Cds: cds, ListEntries: listEntriesUrl},
@@ -150,7 +186,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type view struct {
-	http_util.PageBreadCrumb
+	common.PageTokenBreadCrumb
 	common.CatLinker
 	common.AccountLinker
 	common.EntryLinker
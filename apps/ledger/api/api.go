@@ -0,0 +1,852 @@
+// Package api serves a JSON API for ledger under /api/v1/. The API uses
+// the store, categories, and uploaders of the user session, so a user
+// sees and changes the same things through the API as through the html
+// pages.
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/apps/ledger/upload"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+)
+
+const (
+	kDefaultPageSize = 50
+	kMaxPageSize     = 500
+	kMaxBodySize     = 1024 * 1024
+)
+
+var (
+	errUnauthorized = &httpError{
+		http.StatusUnauthorized, "Login required."}
+	errEtagRequired = &httpError{
+		http.StatusPreconditionRequired, "If-Match header required."}
+	errConcurrentUpdate = &httpError{
+		http.StatusPreconditionFailed,
+		"Someone else already updated this entry. Read it and try again."}
+	errNoImport = &httpError{
+		http.StatusNotFound, "No import waiting for confirmation."}
+)
+
+// Store is what the API needs from the store of the user session.
+type Store interface {
+	upload.Store
+	findb.AccountsRunner
+	findb.EntriesPageRunner
+	findb.EntryByIdRunner
+	findb.RecurringEntriesRunner
+	findb.AddRecurringEntryRunner
+	findb.RecurringEntryByIdRunner
+	findb.UpdateRecurringEntryRunner
+	findb.RemoveRecurringEntryByIdRunner
+	findb.AllocationsByYearRunner
+	findb.AddAllocationRunner
+	findb.RemoveAllocationRunner
+}
+
+// New returns the handler for the API. Callers must mount it at
+// /api/ behind a handler that sets up the user session. clock tells
+// when imports waiting for confirmation expire.
+func New(clock date_util.Clock) http.Handler {
+	imports := &importHandlers{newPendingImports(clock)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/accounts", listAccounts)
+	mux.HandleFunc("GET /api/v1/accounts/{id}", getAccount)
+	mux.HandleFunc("GET /api/v1/categories", listCategories)
+	mux.HandleFunc("GET /api/v1/entries", listEntries)
+	mux.HandleFunc("POST /api/v1/entries", addEntry)
+	mux.HandleFunc("GET /api/v1/entries/{id}", getEntry)
+	mux.HandleFunc("PUT /api/v1/entries/{id}", updateEntry)
+	mux.HandleFunc("DELETE /api/v1/entries/{id}", deleteEntry)
+	mux.HandleFunc("GET /api/v1/recurring", listRecurringEntries)
+	mux.HandleFunc("POST /api/v1/recurring", addRecurringEntry)
+	mux.HandleFunc("GET /api/v1/recurring/{id}", getRecurringEntry)
+	mux.HandleFunc("PUT /api/v1/recurring/{id}", updateRecurringEntry)
+	mux.HandleFunc("DELETE /api/v1/recurring/{id}", deleteRecurringEntry)
+	mux.HandleFunc("GET /api/v1/allocations/{year}", listAllocations)
+	mux.HandleFunc("PUT /api/v1/allocations/{year}/{cat}", setAllocation)
+	mux.HandleFunc(
+		"DELETE /api/v1/allocations/{year}/{cat}", removeAllocation)
+	mux.HandleFunc("POST /api/v1/accounts/{id}/import", imports.start)
+	mux.HandleFunc(
+		"GET /api/v1/accounts/{id}/import/{importId}", imports.get)
+	mux.HandleFunc(
+		"POST /api/v1/accounts/{id}/import/{importId}/confirm",
+		imports.confirm)
+	mux.HandleFunc(
+		"DELETE /api/v1/accounts/{id}/import/{importId}", imports.cancel)
+	mux.HandleFunc("/api/", notFound)
+	return &contentTypeHandler{mux}
+}
+
+// Unauthorized replies to a request that has no logged in user.
+func Unauthorized(w http.ResponseWriter) {
+	writeError(w, errUnauthorized)
+}
+
+// contentTypeHandler rejects POST and PUT requests whose body is not
+// JSON, or a file for an import. html forms on other sites cannot send
+// these content types, so they cannot use the session cookie to make
+// changes.
+type contentTypeHandler struct {
+	http.Handler
+}
+
+func (h *contentTypeHandler) ServeHTTP(
+	w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" || r.Method == "PUT" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/json" &&
+			mediaType != "application/octet-stream" {
+			writeError(w, &httpError{
+				http.StatusUnsupportedMediaType,
+				"Content-Type must be application/json or application/octet-stream."})
+			return
+		}
+	}
+	h.Handler.ServeHTTP(w, r)
+}
+
+func listAccounts(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	var accounts []fin.Account
+	if err := store.Accounts(nil, consume2.AppendTo(&accounts)); err != nil {
+		writeError(w, err)
+		return
+	}
+	result := make([]*Account, len(accounts))
+	for i := range accounts {
+		result[i] = toAccount(&accounts[i])
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func getAccount(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	id, err := pathId(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var account fin.Account
+	if err := store.AccountById(nil, id, &account); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAccount(&account))
+}
+
+func listCategories(w http.ResponseWriter, r *http.Request) {
+	cds, err := common.GetUserSession(r).Cache.Get(nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	details := cds.ActiveCatDetails(true)
+	result := make([]Category, len(details))
+	for i := range details {
+		result[i] = toCategory(details[i], cds)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// listEntries lists entries from most to least recent one page at a time.
+// The account, start, end, unreviewed, name, and desc query parameters
+// select the entries. The response includes the token for the next page
+// which goes in the pageToken query parameter.
+func listEntries(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	options, err := entryListOptions(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	pageSize := kDefaultPageSize
+	if s := r.FormValue("pageSize"); s != "" {
+		pageSize, err = strconv.Atoi(s)
+		if err != nil || pageSize <= 0 || pageSize > kMaxPageSize {
+			writeError(w, badRequest("pageSize must be between 1 and 500."))
+			return
+		}
+	}
+	var entries []fin.Entry
+	next, err := store.EntriesPage(
+		nil,
+		options,
+		r.FormValue("pageToken"),
+		pageSize,
+		consume2.AppendTo(&entries))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result := struct {
+		Entries       []*Entry `json:"entries"`
+		NextPageToken string   `json:"nextPageToken,omitempty"`
+	}{Entries: make([]*Entry, len(entries)), NextPageToken: next}
+	for i := range entries {
+		result.Entries[i] = toEntry(&entries[i])
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func entryListOptions(r *http.Request) (*findb.EntryListOptions, error) {
+	var options findb.EntryListOptions
+	if s := r.FormValue("account"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, badRequest("Invalid account.")
+		}
+		options.AccountId = id
+	}
+	for _, param := range []struct {
+		name string
+		date **time.Time
+	}{{"start", &options.Start}, {"end", &options.End}} {
+		s := r.FormValue(param.name)
+		if s == "" {
+			continue
+		}
+		date, err := time.Parse(kDateFormat, s)
+		if err != nil {
+			return nil, badRequest(
+				"%s must be in yyyy-mm-dd format.", param.name)
+		}
+		*param.date = &date
+	}
+	options.Unreviewed = r.FormValue("unreviewed") == "true"
+	options.Name = r.FormValue("name")
+	options.Desc = r.FormValue("desc")
+	return &options, nil
+}
+
+func getEntry(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	id, err := pathId(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var entry fin.Entry
+	if err := store.EntryById(nil, id, &entry); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", formatEtag(entry.Etag))
+	writeJSON(w, http.StatusOK, toEntry(&entry))
+}
+
+func addEntry(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	var body Entry
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	cds, err := session.Cache.Get(nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	mutation, err := body.mutation(cds)
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+	var entry fin.Entry
+	mutation(&entry)
+	err = store.DoEntryChanges(
+		nil, &findb.EntryChanges{Adds: []*fin.Entry{&entry}})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Read the entry back to get its etag.
+	if err := store.EntryById(nil, entry.Id, &entry); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", entryLocation(entry.Id))
+	w.Header().Set("ETag", formatEtag(entry.Etag))
+	writeJSON(w, http.StatusCreated, toEntry(&entry))
+}
+
+// updateEntry replaces an entry. The If-Match header must have the etag
+// of the entry that the client last read so that clients do not
+// overwrite each other's changes.
+func updateEntry(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	id, err := pathId(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	etag, err := ifMatch(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var body Entry
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	cds, err := session.Cache.Get(nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	mutation, err := body.mutation(cds)
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+	var entry fin.Entry
+	err = session.Doer.Do(func(t db.Transaction) error {
+		err := store.DoEntryChanges(t, &findb.EntryChanges{
+			Updates: map[int64]fin.EntryUpdater{id: mutation},
+			Etags:   map[int64]uint64{id: etag}})
+		if err != nil {
+			return err
+		}
+		return store.EntryById(t, id, &entry)
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", formatEtag(entry.Etag))
+	writeJSON(w, http.StatusOK, toEntry(&entry))
+}
+
+func deleteEntry(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	id, err := pathId(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	err = store.DoEntryChanges(nil, &findb.EntryChanges{Deletes: []int64{id}})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listRecurringEntries(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	var entries []fin.RecurringEntry
+	err := store.RecurringEntries(nil, consume2.AppendTo(&entries))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result := make([]*RecurringEntry, len(entries))
+	for i := range entries {
+		result[i] = toRecurringEntry(&entries[i])
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func getRecurringEntry(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	id, err := pathId(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var entry fin.RecurringEntry
+	if err := store.RecurringEntryById(nil, id, &entry); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", formatEtag(entry.Etag))
+	writeJSON(w, http.StatusOK, toRecurringEntry(&entry))
+}
+
+func addRecurringEntry(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	var body RecurringEntry
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	cds, err := session.Cache.Get(nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	mutation, err := body.mutation(cds)
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+	var entry fin.RecurringEntry
+	mutation(&entry)
+	if err := store.AddRecurringEntry(nil, &entry); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := store.RecurringEntryById(nil, entry.Id, &entry); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", recurringLocation(entry.Id))
+	w.Header().Set("ETag", formatEtag(entry.Etag))
+	writeJSON(w, http.StatusCreated, toRecurringEntry(&entry))
+}
+
+// updateRecurringEntry works like updateEntry for recurring entries.
+func updateRecurringEntry(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	id, err := pathId(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	etag, err := ifMatch(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var body RecurringEntry
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	cds, err := session.Cache.Get(nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	mutation, err := body.mutation(cds)
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+	var entry fin.RecurringEntry
+	err = session.Doer.Do(func(t db.Transaction) error {
+		if err := store.RecurringEntryById(t, id, &entry); err != nil {
+			return err
+		}
+		if etag != entry.Etag {
+			return findb.ConcurrentUpdate
+		}
+		mutation(&entry)
+		if err := store.UpdateRecurringEntry(t, &entry); err != nil {
+			return err
+		}
+		return store.RecurringEntryById(t, id, &entry)
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", formatEtag(entry.Etag))
+	writeJSON(w, http.StatusOK, toRecurringEntry(&entry))
+}
+
+func deleteRecurringEntry(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	id, err := pathId(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := store.RemoveRecurringEntryById(nil, id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listAllocations(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	year, err := pathYear(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	allocations, err := store.AllocationsByYear(nil, int64(year))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result := make([]Allocation, 0, len(allocations))
+	for id, amount := range allocations {
+		result = append(result, Allocation{
+			Cat:    fin.Cat{Type: fin.ExpenseCat, Id: id}.String(),
+			Amount: amount})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Cat < result[j].Cat
+	})
+	writeJSON(w, http.StatusOK, result)
+}
+
+// setAllocation sets the yearly allocation of an envelope replacing any
+// allocation that is already there. Like the add envelope page, the
+// category must be an expense category other than the top level one.
+func setAllocation(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	year, cat, err := pathAllocation(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var body AllocationBody
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	if body.Amount == nil {
+		writeError(w, badRequest("Amount required."))
+		return
+	}
+	amount := *body.Amount
+	if amount < 0 {
+		writeError(w, badRequest("Amount must be non negative."))
+		return
+	}
+	err = session.Doer.Do(func(t db.Transaction) error {
+		if err := store.RemoveAllocation(t, int64(year), cat.Id); err != nil {
+			return err
+		}
+		return store.AddAllocation(t, int64(year), cat.Id, amount)
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(
+		w,
+		http.StatusOK,
+		Allocation{Cat: cat.String(), Amount: amount})
+}
+
+func removeAllocation(w http.ResponseWriter, r *http.Request) {
+	store := common.GetUserSession(r).Store.(Store)
+	year, cat, err := pathAllocation(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := store.RemoveAllocation(nil, int64(year), cat.Id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// importHandlers serve the imports of the API.
+type importHandlers struct {
+	imports *pendingImports
+}
+
+// start reads the file in the request body into a batch waiting for
+// confirmation and replies with a preview of the import. The format
+// query parameter, if present, is the extension of the file, e.g. qfx;
+// otherwise start detects the format from the file. The sd query
+// parameter, if present, becomes the import start date of the account
+// when the client confirms the import. The id in the preview identifies
+// the import until the client confirms or cancels it.
+func (h *importHandlers) start(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	acctId, err := pathId(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var account fin.Account
+	if err := store.AccountById(nil, acctId, &account); err != nil {
+		writeError(w, err)
+		return
+	}
+	sd := account.ImportSD
+	sdStr := r.FormValue("sd")
+	if sdStr != "" {
+		sd, err = time.Parse(kDateFormat, sdStr)
+		if err != nil {
+			writeError(w, badRequest("sd must be in yyyy-mm-dd format."))
+			return
+		}
+	}
+	contents, err := io.ReadAll(http.MaxBytesReader(w, r.Body, kMaxBodySize))
+	if err != nil {
+		writeError(w, badRequest("File too large."))
+		return
+	}
+	if len(contents) == 0 {
+		writeError(w, badRequest("Empty file."))
+		return
+	}
+	var format autoimport.Format
+	var ok bool
+	if ext := r.FormValue("format"); ext != "" {
+		format, ok = session.Uploaders.ByExtension("." + ext)
+	} else {
+		format, ok = session.Uploaders.Detect("", contents)
+	}
+	if !ok {
+		writeError(w, badRequest("File format not recognized."))
+		return
+	}
+	batch, err := format.Loader.Load(
+		acctId,
+		r.URL.Query().Get("bankAccount"),
+		bytes.NewReader(contents),
+		sd)
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+	batch, err = batch.SkipProcessed(nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if batch.Len() == 0 {
+		writeError(w, badRequest("No new entries to process."))
+		return
+	}
+	// Confirming the import remembers the start date.
+	var newSD *time.Time
+	if sdStr != "" {
+		newSD = &sd
+	}
+	id, err := h.imports.Add(session, acctId, batch, format.Name, newSD)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", importLocation(acctId, id))
+	writePreview(
+		w,
+		session,
+		store,
+		id,
+		&pendingImport{acctId: acctId, batch: batch, format: format.Name},
+		http.StatusCreated)
+}
+
+func (h *importHandlers) get(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	id, pending, err := h.pending(r, session)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writePreview(w, session, store, id, pending, http.StatusOK)
+}
+
+func (h *importHandlers) confirm(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	id, pending, err := h.pending(r, session)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	changeId, imported, err := upload.ImportWithSD(
+		session.Doer, store, pending.acctId, pending.batch, pending.sd)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.imports.Remove(id)
+	result := ImportResult{ChangeId: changeId}
+	if changeId != 0 {
+		// Lets a user who logged in with a password undo the import
+		// from the upload page.
+		session.SetLastImport(pending.acctId, changeId, imported)
+		session.Save(r, w)
+		result.Count = imported.Len()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *importHandlers) cancel(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	id, _, err := h.pending(r, session)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.imports.Remove(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pending returns the id of the import in the path of r along with the
+// import itself.
+func (h *importHandlers) pending(
+	r *http.Request, session *common.UserSession) (
+	id string, pending *pendingImport, err error) {
+	acctId, err := pathId(r, "id")
+	if err != nil {
+		return
+	}
+	id = r.PathValue("importId")
+	pending, err = h.imports.Get(session, acctId, id)
+	return
+}
+
+func writePreview(
+	w http.ResponseWriter,
+	session *common.UserSession,
+	store Store,
+	id string,
+	pending *pendingImport,
+	status int) {
+	account, batchEntries, err := upload.Preview(
+		session.Doer, store, pending.acctId, pending.batch)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result := toImport(account, batchEntries)
+	result.Id = id
+	result.Format = pending.format
+	writeJSON(w, status, result)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, &httpError{http.StatusNotFound, "Not found."})
+}
+
+func entryLocation(id int64) string {
+	return "/api/v1/entries/" + strconv.FormatInt(id, 10)
+}
+
+func recurringLocation(id int64) string {
+	return "/api/v1/recurring/" + strconv.FormatInt(id, 10)
+}
+
+func importLocation(acctId int64, id string) string {
+	return fmt.Sprintf("/api/v1/accounts/%d/import/%s", acctId, id)
+}
+
+func pathId(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, &httpError{http.StatusNotFound, "No such id."}
+	}
+	return id, nil
+}
+
+func pathYear(r *http.Request) (int, error) {
+	year, err := strconv.Atoi(r.PathValue("year"))
+	if err != nil || !common.Is21stCentury(year) {
+		return 0, badRequest("%v.", common.ErrInvalidYear)
+	}
+	return year, nil
+}
+
+func pathAllocation(r *http.Request) (year int, cat fin.Cat, err error) {
+	if year, err = pathYear(r); err != nil {
+		return
+	}
+	cat, err = fin.CatFromString(r.PathValue("cat"))
+	if err != nil || cat.Type != fin.ExpenseCat || cat == fin.Expense {
+		return 0, fin.Cat{}, badRequest(
+			"Please choose an expense category other than the top level one.")
+	}
+	return
+}
+
+// ifMatch returns the etag in the If-Match header.
+func ifMatch(r *http.Request) (uint64, error) {
+	s := r.Header.Get("If-Match")
+	if s == "" {
+		return 0, errEtagRequired
+	}
+	etag, ok := parseEtag(s)
+	if !ok {
+		return 0, badRequest("Invalid If-Match header.")
+	}
+	return etag, nil
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, kMaxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return badRequest("Invalid JSON: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError replies with err as a JSON object with an error field. The
+// status depends on err.
+func writeError(w http.ResponseWriter, err error) {
+	status, message := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("api: %v", err)
+	}
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+func errorStatus(err error) (status int, message string) {
+	var herr *httpError
+	switch {
+	case errors.As(err, &herr):
+		return herr.status, herr.message
+	case err == findb.NoSuchId:
+		return http.StatusNotFound, "No such id."
+	case err == findb.NoPermission:
+		return http.StatusForbidden, "Insufficient permission."
+	case err == findb.ConcurrentUpdate:
+		return errConcurrentUpdate.status, errConcurrentUpdate.message
+	case err == findb.BadPageToken:
+		return http.StatusBadRequest, "Invalid page token."
+	default:
+		return http.StatusInternalServerError, "Error reading database."
+	}
+}
+
+// httpError is an error that the API replies with using a particular
+// status.
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
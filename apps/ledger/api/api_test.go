@@ -0,0 +1,249 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/findb"
+)
+
+func TestEntryRoundTrip(t *testing.T) {
+	cpb := fin.CatPaymentBuilder{}
+	cpb.SetPaymentId(2).SetReconciled(true)
+	cpb.AddCatRec(fin.CatRec{Cat: fin.NewCat("0:7"), Amount: 1234})
+	cpb.AddCatRec(
+		fin.CatRec{Cat: fin.NewCat("2:3"), Amount: 500, Reconciled: true})
+	original := fin.Entry{
+		Id:         5,
+		Date:       time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC),
+		Name:       "Grocer",
+		Desc:       "weekly",
+		CheckNo:    "101",
+		Tags:       []string{"food"},
+		CatPayment: cpb.Build(),
+		Status:     fin.Reviewed,
+		Etag:       17,
+	}
+	jsonEntry := toEntry(&original)
+	if jsonEntry.Date != "2024-03-09" {
+		t.Errorf("Expected 2024-03-09, got %s", jsonEntry.Date)
+	}
+	if jsonEntry.NeedsReview {
+		t.Error("Expected reviewed entry")
+	}
+	mutation, err := jsonEntry.mutation(testCats())
+	if err != nil {
+		t.Fatalf("Got error converting entry: %v", err)
+	}
+	entry := fin.Entry{Id: 5, Etag: 17}
+	mutation(&entry)
+	if !reflect.DeepEqual(original, entry) {
+		t.Errorf("Expected %v, got %v", original, entry)
+	}
+}
+
+func TestEntryMutationErrors(t *testing.T) {
+	valid := Entry{
+		Date:      "2024-03-09",
+		Name:      "Grocer",
+		PaymentId: 1,
+		Splits:    []Split{{Cat: "0:7", Amount: 100}},
+	}
+	if _, err := valid.mutation(testCats()); err != nil {
+		t.Fatalf("Expected valid entry, got %v", err)
+	}
+	invalid := []func(e *Entry){
+		func(e *Entry) { e.Date = "20240309" },
+		func(e *Entry) { e.Name = " " },
+		func(e *Entry) { e.PaymentId = 0 },
+		func(e *Entry) { e.Splits = nil },
+		func(e *Entry) { e.Splits = []Split{{Cat: "food", Amount: 100}} },
+		func(e *Entry) { e.PaymentId = 9 },
+		func(e *Entry) { e.Splits = []Split{{Cat: "0:99", Amount: 100}} },
+		func(e *Entry) { e.Splits = []Split{{Cat: "2:9", Amount: 100}} },
+	}
+	for i, change := range invalid {
+		entry := valid
+		change(&entry)
+		if _, err := entry.mutation(testCats()); err == nil {
+			t.Errorf("%d: Expected an error", i)
+		}
+	}
+}
+
+func TestRecurringEntryMutation(t *testing.T) {
+	numLeft := 3
+	jsonEntry := RecurringEntry{
+		Entry: Entry{
+			Date:      "2024-03-09",
+			Name:      "Rent",
+			PaymentId: 1,
+			Splits:    []Split{{Cat: "0:7", Amount: 100}},
+		},
+		Unit:    "Weeks",
+		Count:   2,
+		NumLeft: &numLeft,
+	}
+	mutation, err := jsonEntry.mutation(testCats())
+	if err != nil {
+		t.Fatalf("Got error converting entry: %v", err)
+	}
+	var entry fin.RecurringEntry
+	mutation(&entry)
+	expected := fin.RecurringPeriod{Count: 2, Unit: fin.Weeks}
+	if entry.Period != expected || entry.NumLeft != 3 {
+		t.Errorf("Got %v %d", entry.Period, entry.NumLeft)
+	}
+	jsonEntry.Unit = ""
+	jsonEntry.Count = 0
+	jsonEntry.NumLeft = nil
+	if mutation, err = jsonEntry.mutation(testCats()); err != nil {
+		t.Fatalf("Got error converting entry: %v", err)
+	}
+	mutation(&entry)
+	expected = fin.RecurringPeriod{Count: 1, Unit: fin.Months, DayOfMonth: 9}
+	if entry.Period != expected || entry.NumLeft != -1 {
+		t.Errorf("Got %v %d", entry.Period, entry.NumLeft)
+	}
+	if got := toRecurringEntry(&entry); got.NumLeft != nil {
+		t.Errorf("Expected no limit, got %d", *got.NumLeft)
+	}
+	jsonEntry.Unit = "fortnights"
+	if _, err := jsonEntry.mutation(testCats()); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+// testCats returns accounts 1 through 3 and expense category 7.
+func testCats() categories.CatDetailStore {
+	var cdsb categories.CatDetailStoreBuilder
+	for id := int64(1); id <= 3; id++ {
+		cdsb.AddAccount(&fin.Account{
+			Id: id, Name: fmt.Sprintf("account %d", id), Active: true})
+	}
+	cdsb.AddCatDbRow(
+		fin.ExpenseCat, &categories.CatDbRow{Id: 7, Name: "food", Active: true})
+	return cdsb.Build()
+}
+
+func TestEtag(t *testing.T) {
+	etag, ok := parseEtag(formatEtag(12345))
+	if !ok || etag != 12345 {
+		t.Errorf("Expected 12345, got %d", etag)
+	}
+	if _, ok := parseEtag("12345"); ok {
+		t.Error("Expected unquoted etag to fail")
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{findb.NoSuchId, http.StatusNotFound},
+		{findb.NoPermission, http.StatusForbidden},
+		{findb.ConcurrentUpdate, http.StatusPreconditionFailed},
+		{findb.BadPageToken, http.StatusBadRequest},
+		{errEtagRequired, http.StatusPreconditionRequired},
+		{badRequest("Bad."), http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if status, _ := errorStatus(c.err); status != c.status {
+			t.Errorf("%v: Expected %d, got %d", c.err, c.status, status)
+		}
+	}
+}
+
+func TestPendingImports(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)}
+	imports := newPendingImports(clock)
+	bob := &common.UserSession{
+		User: &fin.User{Id: 1}, Book: &common.Book{Id: 0}}
+	otherBook := &common.UserSession{
+		User: &fin.User{Id: 1}, Book: &common.Book{Id: 1}}
+	alice := &common.UserSession{
+		User: &fin.User{Id: 2}, Book: &common.Book{Id: 0}}
+	id, err := imports.Add(bob, 3, nil, "OFX", nil)
+	if err != nil {
+		t.Fatalf("Got error adding import: %v", err)
+	}
+	pending, err := imports.Get(bob, 3, id)
+	if err != nil {
+		t.Fatalf("Got error getting import: %v", err)
+	}
+	if pending.acctId != 3 || pending.format != "OFX" {
+		t.Errorf("Got wrong import %v", pending)
+	}
+	if _, err := imports.Get(alice, 3, id); err != errNoImport {
+		t.Errorf("Expected errNoImport for other user, got %v", err)
+	}
+	if _, err := imports.Get(otherBook, 3, id); err != errNoImport {
+		t.Errorf("Expected errNoImport for other book, got %v", err)
+	}
+	if _, err := imports.Get(bob, 4, id); err != errNoImport {
+		t.Errorf("Expected errNoImport for other account, got %v", err)
+	}
+	clock.now = clock.now.Add(kImportTimeout)
+	if _, err := imports.Get(bob, 3, id); err != errNoImport {
+		t.Errorf("Expected errNoImport after expiring, got %v", err)
+	}
+	id, err = imports.Add(bob, 3, nil, "OFX", nil)
+	if err != nil {
+		t.Fatalf("Got error adding import: %v", err)
+	}
+	imports.Remove(id)
+	if _, err := imports.Get(bob, 3, id); err != errNoImport {
+		t.Errorf("Expected errNoImport after removing, got %v", err)
+	}
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestContentType(t *testing.T) {
+	handler := &contentTypeHandler{http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})}
+	cases := []struct {
+		method      string
+		contentType string
+		status      int
+	}{
+		{"POST", "application/json; charset=utf-8", http.StatusNoContent},
+		{"PUT", "application/octet-stream", http.StatusNoContent},
+		{"POST", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"POST", "text/plain", http.StatusUnsupportedMediaType},
+		{"PUT", "", http.StatusUnsupportedMediaType},
+		{"GET", "", http.StatusNoContent},
+		{"DELETE", "", http.StatusNoContent},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(
+			c.method, "/api/v1/entries", strings.NewReader("{}"))
+		if c.contentType != "" {
+			r.Header.Set("Content-Type", c.contentType)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Errorf(
+				"%s %q: Expected %d, got %d",
+				c.method, c.contentType, c.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/toolbox/date_util"
+)
+
+const (
+	kImportIdBytes = 16
+
+	// How long an import waits for confirmation
+	kImportTimeout = time.Hour
+)
+
+// pendingImports holds the imports waiting for confirmation. Unlike the
+// upload page, the API keeps pending imports on the server and not in
+// the session because a client using an API token gets a new session
+// with every request. pendingImports instances are safe to use with
+// multiple goroutines.
+type pendingImports struct {
+	clock   date_util.Clock
+	mutex   sync.Mutex
+	imports map[string]*pendingImport
+}
+
+// pendingImport is one import waiting for confirmation. Only the user
+// who started it may see it and only in the same book and account.
+type pendingImport struct {
+	userId  int64
+	bookId  int
+	acctId  int64
+	batch   autoimport.Batch
+	format  string
+	sd      *time.Time // nil means leave the import start date alone
+	expires time.Time
+}
+
+func newPendingImports(clock date_util.Clock) *pendingImports {
+	return &pendingImports{
+		clock: clock, imports: make(map[string]*pendingImport)}
+}
+
+// Add stores batch as an import of account acctId for the user of
+// session and returns the id of the import. sd is the import start date
+// that the account gets once the client confirms; nil means none.
+func (p *pendingImports) Add(
+	session *common.UserSession,
+	acctId int64,
+	batch autoimport.Batch,
+	format string,
+	sd *time.Time) (string, error) {
+	raw := make([]byte, kImportIdBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+	now := p.clock.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.removeExpired(now)
+	p.imports[id] = &pendingImport{
+		userId:  session.User.Id,
+		bookId:  session.Book.Id,
+		acctId:  acctId,
+		batch:   batch,
+		format:  format,
+		sd:      sd,
+		expires: now.Add(kImportTimeout)}
+	return id, nil
+}
+
+// Get returns the import with given id of account acctId. Get returns
+// errNoImport if there is no such import, if it expired, or if it
+// belongs to another user or book.
+func (p *pendingImports) Get(
+	session *common.UserSession, acctId int64, id string) (
+	*pendingImport, error) {
+	now := p.clock.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	result, ok := p.imports[id]
+	if !ok ||
+		!now.Before(result.expires) ||
+		result.userId != session.User.Id ||
+		result.bookId != session.Book.Id ||
+		result.acctId != acctId {
+		return nil, errNoImport
+	}
+	return result, nil
+}
+
+// Remove removes the import with given id.
+func (p *pendingImports) Remove(id string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.imports, id)
+}
+
+func (p *pendingImports) removeExpired(now time.Time) {
+	for id, pending := range p.imports {
+		if !now.Before(pending.expires) {
+			delete(p.imports, id)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keep94/finances/apps/ledger/upload"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+)
+
+const (
+	// kDateFormat is the format of dates in the API.
+	kDateFormat = "2006-01-02"
+)
+
+// Account is the JSON form of a fin.Account. Amounts are in cents of the
+// currency of the account.
+type Account struct {
+	Id                int64  `json:"id"`
+	Name              string `json:"name"`
+	Active            bool   `json:"active"`
+	Currency          string `json:"currency"`
+	Balance           int64  `json:"balance"`
+	ReconciledBalance int64  `json:"reconciledBalance"`
+	Count             int    `json:"count"`
+	ReconciledCount   int    `json:"reconciledCount"`
+	ImportStartDate   string `json:"importStartDate,omitempty"`
+}
+
+func toAccount(account *fin.Account) *Account {
+	result := &Account{
+		Id:                account.Id,
+		Name:              account.Name,
+		Active:            account.Active,
+		Currency:          account.Currency.OrDefault().String(),
+		Balance:           account.Balance,
+		ReconciledBalance: account.RBalance,
+		Count:             account.Count,
+		ReconciledCount:   account.RCount,
+	}
+	if !account.ImportSD.IsZero() {
+		result.ImportStartDate = account.ImportSD.Format(kDateFormat)
+	}
+	return result
+}
+
+// Category is the JSON form of a categories.CatDetail. Ids are in the
+// same form as fin.Cat.String e.g "0:4". Parent is empty for top level
+// categories and accounts.
+type Category struct {
+	Id       string `json:"id"`
+	FullName string `json:"fullName"`
+	Active   bool   `json:"active"`
+	Parent   string `json:"parent,omitempty"`
+}
+
+func toCategory(
+	detail categories.CatDetail, cds categories.CatDetailStore) Category {
+	result := Category{
+		Id:       detail.Id().String(),
+		FullName: detail.FullName(),
+		Active:   detail.Active(),
+	}
+	if cat := detail.Id(); !cat.IsTop() {
+		result.Parent = cds.ImmediateParent(cat).String()
+	}
+	return result
+}
+
+// Split is the JSON form of a fin.CatRec. Amount is in cents.
+type Split struct {
+	Cat        string `json:"cat"`
+	Amount     int64  `json:"amount"`
+	Reconciled bool   `json:"reconciled,omitempty"`
+}
+
+// Entry is the JSON form of a fin.Entry. Amounts are in cents. The etag
+// of an entry goes in the ETag header of responses about that one entry.
+type Entry struct {
+	Id           int64    `json:"id,omitempty"`
+	Date         string   `json:"date"`
+	Name         string   `json:"name"`
+	Desc         string   `json:"desc,omitempty"`
+	CheckNo      string   `json:"checkNo,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	PaymentId    int64    `json:"paymentId"`
+	Reconciled   bool     `json:"reconciled,omitempty"`
+	ExchangeRate float64  `json:"exchangeRate,omitempty"`
+	NeedsReview  bool     `json:"needsReview,omitempty"`
+	Splits       []Split  `json:"splits"`
+	Total        int64    `json:"total"`
+}
+
+func toEntry(entry *fin.Entry) *Entry {
+	result := &Entry{
+		Id:          entry.Id,
+		Date:        entry.Date.Format(kDateFormat),
+		Name:        entry.Name,
+		Desc:        entry.Desc,
+		CheckNo:     entry.CheckNo,
+		Tags:        entry.Tags,
+		PaymentId:   entry.PaymentId(),
+		Reconciled:  entry.Reconciled(),
+		NeedsReview: entry.Status != fin.Reviewed,
+		Splits:      []Split{},
+		Total:       entry.Total(),
+	}
+	if rate := entry.ExchangeRate(); rate != 1.0 {
+		result.ExchangeRate = rate
+	}
+	for _, catrec := range entry.CatRecs() {
+		result.Splits = append(result.Splits, Split{
+			Cat:        catrec.Cat.String(),
+			Amount:     catrec.Amount,
+			Reconciled: catrec.Reconciled,
+		})
+	}
+	return result
+}
+
+// mutation returns the mutation that changes an entry to match e or an
+// error if e is not valid. The payment account and the categories of e
+// must be in cds. Like the single entry page, the mutation leaves the id
+// and etag of the entry alone.
+func (e *Entry) mutation(cds categories.CatDetailStore) (
+	fin.EntryUpdater, error) {
+	date, err := time.Parse(kDateFormat, e.Date)
+	if err != nil {
+		return nil, errors.New("Date must be in yyyy-mm-dd format.")
+	}
+	if strings.TrimSpace(e.Name) == "" {
+		return nil, errors.New("Name required.")
+	}
+	if e.PaymentId == 0 {
+		return nil, errors.New("Missing payment.")
+	}
+	if !cds.Exists(fin.Cat{Type: fin.AccountCat, Id: e.PaymentId}) {
+		return nil, fmt.Errorf("Unknown payment account: %d", e.PaymentId)
+	}
+	if e.ExchangeRate < 0 {
+		return nil, fmt.Errorf("Invalid rate: %v", e.ExchangeRate)
+	}
+	if len(e.Splits) == 0 {
+		return nil, errors.New("At least one split required.")
+	}
+	cpb := fin.CatPaymentBuilder{}
+	cpb.SetPaymentId(e.PaymentId).SetReconciled(e.Reconciled)
+	cpb.SetExchangeRate(e.ExchangeRate)
+	for _, split := range e.Splits {
+		cat, err := fin.CatFromString(split.Cat)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid category: %s", split.Cat)
+		}
+		if !cds.Exists(cat) {
+			return nil, fmt.Errorf("Unknown category: %s", split.Cat)
+		}
+		cpb.AddCatRec(fin.CatRec{
+			Cat:        cat,
+			Amount:     split.Amount,
+			Reconciled: split.Reconciled,
+		})
+	}
+	cp := cpb.Build()
+	name := e.Name
+	desc := e.Desc
+	checkNo := e.CheckNo
+	tags := fin.ParseTags(strings.Join(e.Tags, ","))
+	needsReview := e.NeedsReview
+	return func(p *fin.Entry) bool {
+		p.Date = date
+		p.Name = name
+		p.Desc = desc
+		p.CheckNo = checkNo
+		p.Tags = tags
+		p.CatPayment = cp
+		if needsReview {
+			if p.Status == fin.Reviewed {
+				p.Status = fin.NotReviewed
+			}
+		} else {
+			p.Status = fin.Reviewed
+		}
+		return true
+	}, nil
+}
+
+// RecurringEntry is the JSON form of a fin.RecurringEntry. Date is the
+// date of the next entry. Unit is one of days, weeks, months, or years.
+// NumLeft is the number of entries left to generate; it is absent when
+// there is no limit.
+type RecurringEntry struct {
+	Entry
+	Count      int    `json:"count"`
+	Unit       string `json:"unit"`
+	DayOfMonth int    `json:"dayOfMonth,omitempty"`
+	NumLeft    *int   `json:"numLeft,omitempty"`
+}
+
+func toRecurringEntry(entry *fin.RecurringEntry) *RecurringEntry {
+	result := &RecurringEntry{
+		Entry:      *toEntry(&entry.Entry),
+		Count:      entry.Period.Count,
+		Unit:       entry.Period.Unit.String(),
+		DayOfMonth: entry.Period.DayOfMonth,
+	}
+	if entry.NumLeft >= 0 {
+		numLeft := entry.NumLeft
+		result.NumLeft = &numLeft
+	}
+	return result
+}
+
+// mutation works like Entry.mutation for recurring entries.
+func (e *RecurringEntry) mutation(cds categories.CatDetailStore) (
+	fin.RecurringEntryUpdater, error) {
+	entryMutation, err := e.Entry.mutation(cds)
+	if err != nil {
+		return nil, err
+	}
+	count := e.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 1 {
+		return nil, errors.New("Period must be at least 1.")
+	}
+	unit, ok := parseRecurringUnit(e.Unit)
+	if !ok {
+		return nil, errors.New("Invalid recurring unit.")
+	}
+	numLeft := -1
+	if e.NumLeft != nil {
+		numLeft = *e.NumLeft
+		if numLeft < 0 {
+			return nil, errors.New("Remaining must be positive.")
+		}
+	}
+	dayOfMonth := e.DayOfMonth
+	if dayOfMonth < 0 {
+		return nil, errors.New("Day of month must be greater than 0.")
+	}
+	if dayOfMonth > 31 {
+		return nil, errors.New("Day of month must not be greater than 31.")
+	}
+	if unit == fin.Months && dayOfMonth == 0 {
+		var temp fin.Entry
+		entryMutation(&temp)
+		dayOfMonth = temp.Date.Day()
+	}
+	return func(p *fin.RecurringEntry) bool {
+		entryMutation(&p.Entry)
+		p.CheckNo = ""
+		p.Period.Count = count
+		p.Period.Unit = unit
+		p.Period.DayOfMonth = dayOfMonth
+		p.NumLeft = numLeft
+		return true
+	}, nil
+}
+
+// parseRecurringUnit converts what fin.RecurringUnit.String returns back
+// to a fin.RecurringUnit. An empty string means months.
+func parseRecurringUnit(s string) (fin.RecurringUnit, bool) {
+	if s == "" {
+		return fin.Months, true
+	}
+	for unit := fin.Months; unit < fin.RecurringUnitCount; unit++ {
+		if unit.String() == strings.ToLower(s) {
+			return unit, true
+		}
+	}
+	return fin.RecurringUnitCount, false
+}
+
+// Allocation is the JSON form of an envelope allocation. Amount is in
+// cents per year.
+type Allocation struct {
+	Cat    string `json:"cat"`
+	Amount int64  `json:"amount"`
+}
+
+// AllocationBody is the JSON body that sets an envelope allocation.
+// Amount is in cents per year and is required.
+type AllocationBody struct {
+	Amount *int64 `json:"amount"`
+}
+
+// Import is the JSON form of an import waiting for confirmation. Id
+// identifies the import when confirming or cancelling it. Entries that
+// match an existing entry have that entry's id; new entries have no id.
+// Balance and ReconciledBalance are what the balances of the account
+// will be after confirming. Format is the name of the format of the
+// imported file e.g OFX.
+type Import struct {
+	Id                string  `json:"id"`
+	AccountId         int64   `json:"accountId"`
+	Format            string  `json:"format,omitempty"`
+	NewCount          int     `json:"newCount"`
+	ExistingCount     int     `json:"existingCount"`
+	Balance           int64   `json:"balance"`
+	ReconciledBalance int64   `json:"reconciledBalance"`
+	Entries           []Entry `json:"entries"`
+}
+
+func toImport(account *fin.Account, batchEntries []fin.Entry) *Import {
+	summary := upload.Summarize(account, batchEntries)
+	result := &Import{
+		AccountId:         account.Id,
+		NewCount:          summary.NewCount,
+		ExistingCount:     summary.ExistingCount,
+		Balance:           summary.Balance,
+		ReconciledBalance: summary.RBalance,
+		Entries:           make([]Entry, len(batchEntries)),
+	}
+	for i := range batchEntries {
+		result.Entries[i] = *toEntry(&batchEntries[i])
+	}
+	return result
+}
+
+// ImportResult is the JSON form of a confirmed import. ChangeId is 0 if
+// there was nothing left to import.
+type ImportResult struct {
+	ChangeId int64 `json:"changeId"`
+	Count    int   `json:"count"`
+}
+
+// formatEtag formats an etag for the ETag header.
+func formatEtag(etag uint64) string {
+	return fmt.Sprintf("\"%d\"", etag)
+}
+
+// parseEtag parses the value of an If-Match header.
+func parseEtag(s string) (etag uint64, ok bool) {
+	if _, err := fmt.Sscanf(
+		strings.TrimPrefix(s, "W/"), "\"%d\"", &etag); err != nil {
+		return 0, false
+	}
+	return etag, true
+}
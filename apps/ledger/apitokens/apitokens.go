@@ -0,0 +1,326 @@
+package apitokens
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/http_util"
+)
+
+const (
+	kApiTokens = "apitokens"
+)
+
+var (
+	errNameRequired = errors.New("Name required.")
+	errNoSuchToken  = errors.New("That token no longer exists.")
+	errFullScope    = errors.New(
+		"Only users who may change this book can create full tokens.")
+	errNoSuchAccount = errors.New("Please choose only accounts listed here.")
+)
+
+var (
+	kTemplateSpec = `
+<html>
+<head>
+  <title>{{.Global.Title}}</title>
+  {{if .Global.Icon}}
+    <link rel="shortcut icon" href="/images/favicon.ico" type="image/x-icon" />
+  {{end}}
+  <link rel="stylesheet" type="text/css" href="/static/theme.css" />
+</head>
+<body>
+{{.LeftNav}}
+<div class="main">
+<h2>API tokens for {{.Name}}</h2>
+{{if .Message}}
+  {{if .Success}}
+    <font color="#006600"><b>{{.Message}}</b></font>
+  {{else}}
+    <span class="error">{{.Message}}</span>
+  {{end}}
+  <br><br>
+{{end}}
+{{if .Secret}}
+  Copy this token now. It will not be shown again.<br>
+  <input type="text" size="60" readonly value="{{.Secret}}">
+  <br><br>
+{{end}}
+<table>
+  <tr>
+    <td>Name</td>
+    <td>Book</td>
+    <td>Scope</td>
+    <td>Accounts</td>
+    <td>Created</td>
+    <td>Last used</td>
+    <td></td>
+  </tr>
+{{range .Tokens}}
+  <tr class="lineitem">
+    <td>{{.Name}}</td>
+    <td>{{.Book}}</td>
+    <td>{{.Scope}}</td>
+    <td>{{.Accounts}}</td>
+    <td>{{.Created.Local.Format "01/02/2006 15:04"}}</td>
+    <td>{{if .LastUsed.IsZero}}--{{else}}{{.LastUsed.Local.Format "01/02/2006 15:04"}}{{end}}</td>
+    <td>
+      <form method="post">
+        <input type="hidden" name="xsrf" value="{{$.Xsrf}}">
+        <input type="hidden" name="id" value="{{.Id}}">
+        <input type="submit" name="revoke" value="Revoke" onclick="return confirm('Are you sure you want to revoke this token?');">
+      </form>
+    </td>
+  </tr>
+{{else}}
+  <tr><td colspan="7">No API tokens.</td></tr>
+{{end}}
+</table>
+<h3>New token for {{.BookName}}</h3>
+<form method="post">
+<input type="hidden" name="xsrf" value="{{.Xsrf}}">
+  <table>
+    <tr>
+      <td>Name: </td>
+      <td><input type="text" name="name"></td>
+    </tr>
+    <tr>
+      <td>Scope: </td>
+      <td>
+        <select name="scope">
+          <option value="read">Read only</option>
+          {{if .CanWrite}}<option value="full">Full</option>{{end}}
+        </select>
+      </td>
+    </tr>
+    <tr>
+      <td valign="top">Accounts: </td>
+      <td>
+        Leave all unchecked to allow every account.<br>
+        {{range .AccountDetails}}
+          <input type="checkbox" name="acct" value="{{.Id}}">{{.Name}}<br>
+        {{end}}
+      </td>
+    </tr>
+  </table>
+  <br>
+  <input type="submit" name="create" value="Create token">
+</form>
+</div>
+</body>
+</html>`
+)
+
+var (
+	kTemplate *template.Template
+)
+
+type Store interface {
+	findb.ApiTokensByUserIdRunner
+	findb.AddApiTokenRunner
+	findb.RemoveApiTokenRunner
+}
+
+// Handler lists the API tokens of the logged in user on GET. On POST, it
+// creates a token for the current book or revokes a token. Caution: Like
+// the chpasswd page, this page gets full access to the user data store
+// regardless of logged in user's permissions.
+type Handler struct {
+	Store  Store
+	Clock  date_util.Clock
+	LN     *common.LeftNav
+	Global *common.Global
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	session := common.GetUserSession(r)
+	cds, err := session.Cache.Get(nil)
+	if err != nil {
+		http_util.ReportError(w, "Error reading database.", err)
+		return
+	}
+	v := &view{
+		Name:           session.User.Name,
+		BookName:       session.Book.Name,
+		CanWrite:       session.Permission == fin.AllPermission,
+		AccountDetails: accountDetails(cds, session.Store)}
+	if r.Method == "POST" {
+		if !common.VerifyXsrfToken(r, kApiTokens) {
+			err = common.ErrXsrf
+		} else if http_util.HasParam(r.Form, "create") {
+			v.Secret, err = h.create(session, v, r.Form)
+			v.Message = "Token created."
+		} else if http_util.HasParam(r.Form, "revoke") {
+			err = h.revoke(session.User.Id, r.Form)
+			v.Message = "Token revoked."
+		}
+		if err != nil {
+			v.Message = err.Error()
+		} else {
+			v.Success = true
+		}
+	}
+	var tokens []fin.ApiToken
+	err = h.Store.ApiTokensByUserId(
+		nil, session.User.Id, consume2.AppendTo(&tokens))
+	if err != nil {
+		http_util.ReportError(w, "Error reading database.", err)
+		return
+	}
+	for _, token := range tokens {
+		v.Tokens = append(v.Tokens, newTokenView(token, session.Book, cds))
+	}
+	leftnav := h.LN.Generate(w, r, common.SelectApiTokens())
+	if leftnav == "" {
+		return
+	}
+	v.Xsrf = common.NewXsrfToken(r, kApiTokens)
+	v.LeftNav = leftnav
+	v.Global = h.Global
+	http_util.WriteTemplate(w, kTemplate, v)
+}
+
+// create creates a new token for the current book and returns its secret.
+func (h *Handler) create(
+	session *common.UserSession,
+	v *view,
+	form url.Values) (secret string, err error) {
+	name := strings.TrimSpace(form.Get("name"))
+	if name == "" {
+		return "", errNameRequired
+	}
+	permission := fin.ReadPermission
+	if form.Get("scope") == "full" {
+		if !v.CanWrite {
+			return "", errFullScope
+		}
+		permission = fin.AllPermission
+	}
+	var accountIds []int64
+	for _, idStr := range form["acct"] {
+		id, _ := strconv.ParseInt(idStr, 10, 64)
+		if !v.hasAccount(id) {
+			return "", errNoSuchAccount
+		}
+		accountIds = append(accountIds, id)
+	}
+	secret, hash, err := fin.NewApiTokenSecret()
+	if err != nil {
+		return "", err
+	}
+	token := fin.ApiToken{
+		UserId:     session.User.Id,
+		Name:       name,
+		Hash:       hash,
+		Permission: permission,
+		Book:       session.Book.Name,
+		AccountIds: accountIds,
+		Created:    h.Clock.Now(),
+	}
+	if err := h.Store.AddApiToken(nil, &token); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// revoke revokes a token of the user with userId.
+func (h *Handler) revoke(userId int64, form url.Values) error {
+	id, _ := strconv.ParseInt(form.Get("id"), 10, 64)
+	var tokens []fin.ApiToken
+	err := h.Store.ApiTokensByUserId(nil, userId, consume2.AppendTo(&tokens))
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if token.Id == id {
+			return h.Store.RemoveApiToken(nil, id)
+		}
+	}
+	return errNoSuchToken
+}
+
+// accountDetails returns the active accounts the user may see.
+func accountDetails(
+	cds categories.CatDetailStore,
+	store interface{}) []categories.AccountDetail {
+	result := cds.ActiveAccountDetails()
+	filter, ok := store.(common.AccountFilter)
+	if !ok {
+		return result
+	}
+	var filtered []categories.AccountDetail
+	for _, detail := range result {
+		if filter.HasAccount(detail.Id()) {
+			filtered = append(filtered, detail)
+		}
+	}
+	return filtered
+}
+
+type tokenView struct {
+	fin.ApiToken
+	Scope    string
+	Accounts string
+}
+
+func newTokenView(
+	token fin.ApiToken,
+	book *common.Book,
+	cds categories.CatDetailStore) tokenView {
+	result := tokenView{ApiToken: token, Scope: "Read only", Accounts: "All"}
+	if token.Permission == fin.AllPermission {
+		result.Scope = "Full"
+	}
+	if len(token.AccountIds) == 0 {
+		return result
+	}
+	// Account names are only known for the current book.
+	if token.Book != book.Name {
+		result.Accounts = findb.FormatIds(token.AccountIds)
+		return result
+	}
+	names := make([]string, len(token.AccountIds))
+	for i, id := range token.AccountIds {
+		names[i] = cds.AccountDetailById(id).Name()
+	}
+	result.Accounts = strings.Join(names, ", ")
+	return result
+}
+
+type view struct {
+	Name           string
+	BookName       string
+	CanWrite       bool
+	AccountDetails []categories.AccountDetail
+	Tokens         []tokenView
+	Secret         string
+	Message        string
+	Success        bool
+	Xsrf           string
+	LeftNav        template.HTML
+	Global         *common.Global
+}
+
+func (v *view) hasAccount(id int64) bool {
+	for _, detail := range v.AccountDetails {
+		if detail.Id() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	kTemplate = common.NewTemplate("apitokens", kTemplateSpec)
+}
@@ -0,0 +1,190 @@
+// Package attachment serves and stores the files attached to entries.
+package attachment
+
+import (
+	"fmt"
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/http_util"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+const (
+	kAttachment = "attachment"
+)
+
+const (
+	kMaxAttachmentSize = 10 * 1024 * 1024
+)
+
+var (
+	kAllowedContentTypes = map[string]bool{
+		"application/pdf": true,
+		"image/jpeg":      true,
+		"image/png":       true,
+	}
+)
+
+// Store methods are from fin.Store
+type Store interface {
+	findb.AddAttachmentRunner
+	findb.AttachmentByIdRunner
+	findb.AttachmentContentsRunner
+	findb.RemoveAttachmentRunner
+	findb.EntryByIdRunner
+}
+
+// Handler downloads an attachment on GET given its id. On POST, Handler
+// either uploads a new attachment to the entry given by "eid" or removes
+// the attachment given by "remove" and then redirects back to the entry.
+type Handler struct {
+	Clock date_util.Clock
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	doer := session.Doer
+	store := session.Store.(Store)
+	if r.Method == "GET" {
+		r.ParseForm()
+		id, _ := strconv.ParseInt(r.Form.Get("id"), 10, 64)
+		h.doGet(w, id, doer, store)
+		return
+	}
+	if reader, err := r.MultipartReader(); err == nil {
+		mform, err := http_util.NewMultipartForm(
+			reader, map[string]int{"contents": kMaxAttachmentSize})
+		if err != nil {
+			http_util.ReportError(w, "Error reading multipart form", err)
+			return
+		}
+		h.doUpload(w, r, mform, doer, store)
+		return
+	}
+	r.ParseForm()
+	h.doRemove(w, r, doer, store)
+}
+
+// NewXsrfToken returns the xsrf token that forms posting to Handler
+// must include.
+func NewXsrfToken(r *http.Request) string {
+	return common.NewXsrfToken(r, kAttachment)
+}
+
+func (h *Handler) doGet(
+	w http.ResponseWriter, id int64, doer db.Doer, store Store) {
+	var attachment fin.Attachment
+	var contents []byte
+	err := doer.Do(func(t db.Transaction) (err error) {
+		if err = store.AttachmentById(t, id, &attachment); err != nil {
+			return
+		}
+		contents, err = store.AttachmentContents(t, attachment.Hash)
+		return
+	})
+	if err == findb.NoSuchId {
+		fmt.Fprintln(w, "No attachment found.")
+		return
+	}
+	if err != nil {
+		http_util.ReportError(w, "Error reading database.", err)
+		return
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set(
+		"Content-Disposition",
+		mime.FormatMediaType(
+			"inline", map[string]string{"filename": attachment.Name}))
+	w.Write(contents)
+}
+
+func (h *Handler) doUpload(
+	w http.ResponseWriter,
+	r *http.Request,
+	mform *http_util.MultipartForm,
+	doer db.Doer,
+	store Store) {
+	entryId, _ := strconv.ParseInt(mform.Get("eid"), 10, 64)
+	if !common.VerifyXsrfTokenExplicit(mform.Get("xsrf"), r, kAttachment) {
+		http.Error(w, common.ErrXsrf.Error(), http.StatusBadRequest)
+		return
+	}
+	file, ok := mform.GetFile("contents")
+	if !ok || len(file.Contents) == 0 {
+		http.Error(w, "Please select a file.", http.StatusBadRequest)
+		return
+	}
+	if len(file.Contents) >= kMaxAttachmentSize {
+		http.Error(w, "File too large.", http.StatusBadRequest)
+		return
+	}
+	contentType := http.DetectContentType(file.Contents)
+	if !kAllowedContentTypes[contentType] {
+		http.Error(
+			w,
+			"Only PDF, JPEG, and PNG files may be attached.",
+			http.StatusBadRequest)
+		return
+	}
+	attachment := fin.Attachment{
+		EntryId:     entryId,
+		Name:        file.FileName,
+		ContentType: contentType,
+		Added:       h.Clock.Now()}
+	err := doer.Do(func(t db.Transaction) error {
+		var entry fin.Entry
+		if err := store.EntryById(t, entryId, &entry); err != nil {
+			return err
+		}
+		return store.AddAttachment(t, &attachment, file.Contents)
+	})
+	if err == findb.NoSuchId {
+		fmt.Fprintln(w, "No entry found.")
+		return
+	}
+	if err != nil {
+		http_util.ReportError(w, "Error adding attachment.", err)
+		return
+	}
+	http_util.Redirect(w, r, entryLink(entryId, mform.Get("prev")))
+}
+
+func (h *Handler) doRemove(
+	w http.ResponseWriter, r *http.Request, doer db.Doer, store Store) {
+	id, _ := strconv.ParseInt(r.Form.Get("remove"), 10, 64)
+	if !common.VerifyXsrfToken(r, kAttachment) {
+		http.Error(w, common.ErrXsrf.Error(), http.StatusBadRequest)
+		return
+	}
+	var attachment fin.Attachment
+	err := doer.Do(func(t db.Transaction) error {
+		if err := store.AttachmentById(t, id, &attachment); err != nil {
+			return err
+		}
+		return store.RemoveAttachment(t, id)
+	})
+	if err == findb.NoSuchId {
+		fmt.Fprintln(w, "No attachment found.")
+		return
+	}
+	if err != nil {
+		http_util.ReportError(w, "Error removing attachment.", err)
+		return
+	}
+	http_util.Redirect(
+		w, r, entryLink(attachment.EntryId, r.Form.Get("prev")))
+}
+
+func entryLink(entryId int64, prev string) string {
+	link := http_util.NewUrl(
+		"/fin/single", "id", strconv.FormatInt(entryId, 10))
+	if prev != "" {
+		link = http_util.WithParams(link, "prev", prev)
+	}
+	return link.String()
+}
@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/findb/sqlite_backup"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/http_util"
+)
+
+const (
+	kBackup = "backup"
+)
+
+var (
+	kTemplateSpec = `
+<html>
+<head>
+  <title>{{.Global.Title}}</title>
+  {{if .Global.Icon}}
+    <link rel="shortcut icon" href="/images/favicon.ico" type="image/x-icon" />
+  {{end}}
+  <link rel="stylesheet" type="text/css" href="/static/theme.css" />
+</head>
+<body>
+{{.LeftNav}}
+<div class="main">
+<h2>Backups</h2>
+{{if .Message}}
+  {{if .Success}}
+    <font color="#006600"><b>{{.Message}}</b></font>
+  {{else}}
+    <span class="error">{{.Message}}</span>
+  {{end}}
+{{end}}
+<form method="post">
+<input type="hidden" name="xsrf" value="{{.Xsrf}}">
+<input type="submit" value="Back up now">
+</form>
+<p>The newest {{.Keep}} snapshots are kept. To restore one, stop ledger and run backup restore.</p>
+<table>
+  <tr>
+    <td>Snapshot</td>
+    <td align="right">Size</td>
+  </tr>
+{{range .Snapshots}}
+  <tr class="lineitem">
+    <td>{{.Name}}</td>
+    <td align="right">{{.Size}}</td>
+  </tr>
+{{else}}
+  <tr><td colspan="2">No snapshots yet.</td></tr>
+{{end}}
+</table>
+</div>
+</body>
+</html>`
+)
+
+var (
+	kTemplate *template.Template
+)
+
+// Database is a sqlite database that Handler backs up.
+type Database struct {
+	DB *sql.DB
+
+	// Prefix of the snapshot names
+	Prefix string
+}
+
+// Handler takes snapshots of the sqlite database of the user's book while
+// ledger runs. Only users who can change the book may take snapshots.
+type Handler struct {
+	// The databases to back up by book id
+	Databases map[int]Database
+
+	// The directory for snapshots
+	Dir string
+
+	// The number of snapshots to keep
+	Keep int
+
+	Clock  date_util.Clock
+	LN     *common.LeftNav
+	Global *common.Global
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	leftnav := h.LN.Generate(w, r, common.SelectBackup())
+	if leftnav == "" {
+		return
+	}
+	session := common.GetUserSession(r)
+	database, ok := h.Databases[session.Book.Id]
+	if !ok {
+		fmt.Fprintln(w, "This book has no database to back up.")
+		return
+	}
+	v := &view{
+		Keep:    h.Keep,
+		Xsrf:    common.NewXsrfToken(r, kBackup),
+		LeftNav: leftnav,
+		Global:  h.Global}
+	if r.Method == "POST" {
+		r.ParseForm()
+		if !common.VerifyXsrfToken(r, kBackup) {
+			v.Message = common.ErrXsrf.Error()
+		} else if session.Permission != fin.AllPermission {
+			v.Message = "Insufficient permission."
+		} else {
+			v.Message, v.Success = h.snapshot(database)
+		}
+	}
+	paths, err := sqlite_backup.Snapshots(h.Dir, database.Prefix)
+	if err != nil {
+		http_util.ReportError(w, "Error reading backups", err)
+		return
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		v.Snapshots = append(v.Snapshots, snapshot{
+			Name: filepath.Base(path), Size: info.Size()})
+	}
+	http_util.WriteTemplate(w, kTemplate, v)
+}
+
+func (h *Handler) snapshot(database Database) (
+	message string, success bool) {
+	path, err := sqlite_backup.Snapshot(
+		database.DB, h.Dir, database.Prefix, h.Clock.Now())
+	if err != nil {
+		return err.Error(), false
+	}
+	removed, err := sqlite_backup.Rotate(h.Dir, database.Prefix, h.Keep)
+	if err != nil {
+		return err.Error(), false
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Wrote %s.", filepath.Base(path))
+	if len(removed) > 0 {
+		fmt.Fprintf(&sb, " Removed %d old snapshots.", len(removed))
+	}
+	return sb.String(), true
+}
+
+type snapshot struct {
+	Name string
+	Size int64
+}
+
+type view struct {
+	Snapshots []snapshot
+	Keep      int
+	Message   string
+	Success   bool
+	Xsrf      string
+	LeftNav   template.HTML
+	Global    *common.Global
+}
+
+func init() {
+	kTemplate = common.NewTemplate("backup", kTemplateSpec)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/finances/fin/categories/categoriesdb"
+	"github.com/keep94/finances/fin/fx"
+	"github.com/keep94/toolbox/db"
+	"gopkg.in/yaml.v2"
+)
+
+// book is one set of books that ledger serves.
+type book struct {
+	common.Book
+
+	// The sqlite database of the book. nil in demo mode.
+	rawDb *sql.DB
+
+	// Path to the database file. Empty in demo mode.
+	path string
+
+	doer                   db.Doer
+	catDetailCache         categoriesdb.Getter
+	storeForUser           func(userId int64) interface{}
+	uploaders              *autoimport.Registry
+	readOnlyCatDetailCache categoriesdb.Getter
+	readOnlyStore          readOnlyStore
+	readOnlyUploaders      *autoimport.Registry
+
+	// The exchange rates stored in the database of the book
+	fxStore fx.Store
+
+	// How to convert amounts to a single currency in reports. nil means
+	// no conversion.
+	fx *common.FX
+
+	// scopedStore returns the store and category cache for user limited
+	// by the access rules of user in this book and, if accountIds is
+	// non-empty, to the accounts with accountIds. scopedStore returns nil
+	// if there is nothing to limit. nil in demo mode.
+	scopedStore func(
+		user *fin.User,
+		permission fin.Permission,
+		accountIds []int64) (interface{}, categoriesdb.Getter, error)
+
+	// Permissions by user name. nil means that users have the
+	// permission they have in the users table.
+	permissions map[string]fin.Permission
+}
+
+// permission returns the permission user has to this book.
+func (b *book) permission(user *fin.User) fin.Permission {
+	if b.permissions == nil {
+		return user.Permission
+	}
+	if result, ok := b.permissions[user.Name]; ok {
+		return result
+	}
+	return fin.NonePermission
+}
+
+// setupStores sets up the stores of session for the book the user last
+// chose. If the user has not chosen a book or may no longer use it,
+// setupStores picks the first book the user may use. setupStores returns
+// false if the user may not use any book. Users with access rules in the
+// book get a store limited by those rules and cannot change categories.
+// When the user logged in with an API token, setupStores uses only the
+// book of the token and limits the user to the scope of the token.
+func setupStores(session *common.UserSession) (bool, error) {
+	chosenId, chosen := session.BookId()
+	token := session.ApiToken
+	var current *book
+	var permission fin.Permission
+	session.Books = nil
+	for _, b := range kBooks {
+		p := b.permission(session.User)
+		if p != fin.AllPermission && p != fin.ReadPermission {
+			continue
+		}
+		if token != nil && b.Name != token.Book {
+			continue
+		}
+		session.Books = append(session.Books, &b.Book)
+		if current == nil || (chosen && b.Id == chosenId) {
+			current, permission = b, p
+		}
+	}
+	if current == nil {
+		return false, nil
+	}
+	var accountIds []int64
+	if token != nil {
+		if token.Permission != fin.AllPermission {
+			permission = fin.ReadPermission
+		}
+		accountIds = token.AccountIds
+	}
+	session.Book = &current.Book
+	session.Permission = permission
+	session.Doer = current.doer
+	session.FX = current.fx
+	if permission == fin.AllPermission {
+		session.Store = current.storeForUser(session.User.Id)
+		session.Cache = current.catDetailCache
+		session.Uploaders = current.uploaders
+	} else {
+		session.Store = current.readOnlyStore
+		session.Cache = current.readOnlyCatDetailCache
+		session.Uploaders = current.readOnlyUploaders
+	}
+	if current.scopedStore == nil {
+		// Without a scoped store, we cannot limit a token to accounts.
+		return len(accountIds) == 0, nil
+	}
+	scoped, scopedCache, err := current.scopedStore(
+		session.User, permission, accountIds)
+	if err != nil {
+		return false, err
+	}
+	if scoped != nil {
+		session.Store = scoped
+		session.Cache = scopedCache
+	}
+	return true, nil
+}
+
+// limitRules returns rules limited further to the accounts with
+// accountIds. If accountIds is empty, limitRules returns rules unchanged.
+func limitRules(
+	userName string,
+	rules []fin.AccessRule,
+	accountIds []int64) []fin.AccessRule {
+	if len(accountIds) == 0 {
+		return rules
+	}
+	allowed := make(map[int64]bool)
+	for _, rule := range rules {
+		if rule.Cat.Type == fin.AccountCat {
+			allowed[rule.Cat.Id] = true
+		}
+	}
+	result := slices.DeleteFunc(
+		slices.Clone(rules),
+		func(rule fin.AccessRule) bool {
+			return rule.Cat.Type == fin.AccountCat
+		})
+	// No account has id 0, so if none of accountIds are allowed, this
+	// rule ends up allowing no accounts.
+	accountRules := []fin.AccessRule{
+		{UserName: userName, Cat: fin.Cat{Type: fin.AccountCat}}}
+	for _, id := range accountIds {
+		if len(allowed) > 0 && !allowed[id] {
+			continue
+		}
+		accountRules = append(accountRules, fin.AccessRule{
+			UserName: userName, Cat: fin.Cat{Type: fin.AccountCat, Id: id}})
+	}
+	if len(accountRules) > 1 {
+		accountRules = accountRules[1:]
+	}
+	return append(result, accountRules...)
+}
+
+// bookConfigType describes a book in the -books file.
+type bookConfigType struct {
+	Name  string            `yaml:"name"`
+	Db    string            `yaml:"db"`
+	Users map[string]string `yaml:"users"`
+}
+
+func readBooksConfig(fileName string) ([]bookConfigType, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var content bytes.Buffer
+	if _, err := content.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	var result []bookConfigType
+	if err := yaml.Unmarshal(content.Bytes(), &result); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no books")
+	}
+	for _, config := range result {
+		if config.Name == "" || config.Db == "" {
+			return nil, errors.New("name and db fields required")
+		}
+	}
+	return result, nil
+}
+
+// permissions converts the users field of a book in the -books file.
+func (c *bookConfigType) permissions() (map[string]fin.Permission, error) {
+	result := make(map[string]fin.Permission, len(c.Users))
+	for name, perm := range c.Users {
+		switch strings.ToLower(perm) {
+		case "all":
+			result[name] = fin.AllPermission
+		case "read":
+			result[name] = fin.ReadPermission
+		case "none":
+			result[name] = fin.NonePermission
+		default:
+			return nil, fmt.Errorf(
+				"permission of %s in book %s must be all, read, or none",
+				name,
+				c.Name)
+		}
+	}
+	return result, nil
+}
@@ -1,6 +1,7 @@
 package catedit
 
 import (
+	"errors"
 	"fmt"
 	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/fin"
@@ -65,10 +66,15 @@ var (
     <td>New category:</td>
     <td><input type="text" name="name" value="{{.Get "name"}}" size="40"></td>
   </tr>
+  <tr>
+    <td>Account currency:</td>
+    <td><input type="text" name="currency" value="{{.Get "currency"}}" size="3"></td>
+  </tr>
 </table>
 <br>
 <input type="submit" name="add" value="Add">
 <input type="submit" name="rename" value="Rename">
+<input type="submit" name="setCurrency" value="Set currency">
 <input type="submit" name="remove" value="Remove" onclick="return confirm('Are you sure you want to remove this category?');">
 </form>
 </div>
@@ -87,6 +93,7 @@ type Cache interface {
 	categoriesdb.AccountAdder
 	categoriesdb.AccountRenamer
 	categoriesdb.AccountRemover
+	categoriesdb.AccountCurrencySetter
 	categoriesdb.Getter
 }
 
@@ -161,6 +168,9 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			cds, err = renameCategory(cache, cat, name)
 			message = fmt.Sprintf(
 				"Category %s renamed to %s.", oldName, name)
+		} else if http_util.HasParam(r.Form, "setCurrency") {
+			cds, message, err = setCurrency(
+				cache, cds, cat, r.Form.Get("currency"))
 		} else if http_util.HasParam(r.Form, "remove") {
 			oldName := cds.DetailById(cat).FullName()
 			if cat.Type == fin.AccountCat {
@@ -212,6 +222,30 @@ func renameCategory(cache renamer, cat fin.Cat, fullName string) (
 	return
 }
 
+func setCurrency(
+	cache categoriesdb.AccountCurrencySetter,
+	cds categories.CatDetailStore,
+	cat fin.Cat,
+	currencyStr string) (
+	updatedCds categories.CatDetailStore, message string, err error) {
+	updatedCds = cds
+	if cat.Type != fin.AccountCat {
+		err = errors.New("Only accounts have a currency.")
+		return
+	}
+	currency, err := fin.ParseCurrency(currencyStr)
+	if err != nil {
+		return
+	}
+	name := cds.DetailById(cat).FullName()
+	if updatedCds, err = cache.AccountSetCurrency(
+		nil, cat.Id, currency); err != nil {
+		return
+	}
+	message = fmt.Sprintf("Currency of %s set to %s.", name, currency)
+	return
+}
+
 type view struct {
 	common.CatDisplayer
 	http_util.Values
@@ -12,6 +12,7 @@ import (
 	"github.com/keep94/finances/fin/categories/categoriesdb"
 	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/sessions"
+	"github.com/keep94/toolbox/db"
 	"github.com/keep94/toolbox/http_util"
 	"github.com/keep94/toolbox/session_util"
 	"html/template"
@@ -84,6 +85,16 @@ func VerifyXsrfTokenExplicit(
 	return userSession.VerifyXsrfToken(xsrf, action, time.Now())
 }
 
+// Book is one of the independent sets of books that ledger serves.
+// Each book has its own database.
+type Book struct {
+	// Identifies the book within ledger
+	Id int
+
+	// The name the left navigation bar shows
+	Name string
+}
+
 // UserSession represents a session where user is logged in.
 type UserSession struct {
 	session_util.UserIdSession
@@ -91,14 +102,34 @@ type UserSession struct {
 	// User is the logged in user or nil if no user logged in
 	User *fin.User
 
-	// Main store for accessing entries, accounts, and users
+	// The API token the user logged in with or nil if the user logged
+	// in with a password
+	ApiToken *fin.ApiToken
+
+	// The book the user is working in
+	Book *Book
+
+	// All the books the user may work in including Book
+	Books []*Book
+
+	// The user's permission to Book
+	Permission fin.Permission
+
+	// Runs transactions against the database of Book
+	Doer db.Doer
+
+	// Main store for accessing entries and accounts of Book
 	Store interface{}
 
 	// The category cache
 	Cache categoriesdb.Getter
 
-	// Loads QFX files
-	Uploaders map[string]autoimport.Loader
+	// Loads bank files such as QFX files
+	Uploaders *autoimport.Registry
+
+	// How to convert amounts of Book to a single currency in reports.
+	// nil means no conversion.
+	FX *FX
 }
 
 // CreateUserSession creates a UserSession instance from a gorilla session
@@ -142,6 +173,33 @@ func (s *UserSession) SetUser(userPtr interface{}) {
 	s.User = userPtr.(*fin.User)
 }
 
+// BookId returns the id of the book the user last chose. BookId returns
+// false if the user has not chosen a book.
+func (s *UserSession) BookId() (int, bool) {
+	result, ok := s.Values[kBookIdKey]
+	if !ok {
+		return 0, false
+	}
+	return result.(int), true
+}
+
+// SetBookId records that the user works in the book with given id.
+// When the book changes, SetBookId forgets the category popularities,
+// pending batches, and last imports as they belong to the old book.
+func (s *UserSession) SetBookId(id int) {
+	if oldId, ok := s.BookId(); ok && oldId == id {
+		return
+	}
+	s.Values[kBookIdKey] = id
+	for key := range s.Values {
+		switch key.(type) {
+		case sessionBatchKeyType, sessionLastImportKeyType:
+			delete(s.Values, key)
+		}
+	}
+	s.SetCatPopularity(nil)
+}
+
 // CatPopularity returns the category popularities
 func (s *UserSession) CatPopularity() fin.CatPopularity {
 	result := s.Values[kCatPopularityKey]
@@ -168,19 +226,80 @@ func (s *UserSession) Batch(acctId int64) autoimport.Batch {
 	if result == nil {
 		return nil
 	}
-	return result.(autoimport.Batch)
+	return result.(pendingBatch).batch
+}
+
+// BatchFormat returns the name of the file format of the uploaded batch
+// for a particular account ID. BatchFormat returns the empty string if
+// there is no pending batch or its format is unknown.
+func (s *UserSession) BatchFormat(acctId int64) string {
+	result := s.Values[sessionBatchKeyType(acctId)]
+	if result == nil {
+		return ""
+	}
+	return result.(pendingBatch).format
 }
 
 // SetBatch stores a batch in the session under a particular account ID.
 // Passing nil for batch indicates there is no batch for the given account ID.
 func (s *UserSession) SetBatch(acctId int64, batch autoimport.Batch) {
+	s.SetBatchWithFormat(acctId, batch, "")
+}
+
+// SetBatchWithFormat works like SetBatch and also stores the name of the
+// file format of batch.
+func (s *UserSession) SetBatchWithFormat(
+	acctId int64, batch autoimport.Batch, format string) {
 	if batch == nil {
 		delete(s.Values, sessionBatchKeyType(acctId))
 	} else {
-		s.Values[sessionBatchKeyType(acctId)] = batch
+		s.Values[sessionBatchKeyType(acctId)] = pendingBatch{
+			batch: batch, format: format}
+	}
+}
+
+// LastImport returns the most recently confirmed batch for a particular
+// account ID along with the id of the change set that imported it.
+// LastImport returns 0 and nil if there is no such batch.
+func (s *UserSession) LastImport(acctId int64) (int64, autoimport.Batch) {
+	result := s.Values[sessionLastImportKeyType(acctId)]
+	if result == nil {
+		return 0, nil
+	}
+	li := result.(lastImport)
+	return li.changeId, li.batch
+}
+
+// SetLastImport stores the most recently confirmed batch for a particular
+// account ID along with the id of the change set that imported it.
+// Passing nil for batch indicates there is no such batch.
+func (s *UserSession) SetLastImport(
+	acctId, changeId int64, batch autoimport.Batch) {
+	if batch == nil {
+		delete(s.Values, sessionLastImportKeyType(acctId))
+	} else {
+		s.Values[sessionLastImportKeyType(acctId)] = lastImport{
+			changeId: changeId, batch: batch}
 	}
 }
 
+// ImportByChangeId returns the account ID and batch that LastImport
+// reports for the change set with given id. ImportByChangeId returns 0
+// and nil if no account has such a last import.
+func (s *UserSession) ImportByChangeId(changeId int64) (
+	int64, autoimport.Batch) {
+	for key, value := range s.Values {
+		acctId, ok := key.(sessionLastImportKeyType)
+		if !ok {
+			continue
+		}
+		if li := value.(lastImport); li.changeId == changeId {
+			return int64(acctId), li.batch
+		}
+	}
+	return 0, nil
+}
+
 // AccountLinker creates URLs to account pages
 type AccountLinker struct {
 }
@@ -245,6 +364,36 @@ func (e *EntryLinker) NewEntryLink(paymentId int64) *url.URL {
 }
 
 // RecurringEntryLinker creates URLs to the edit recurring entry page.
+// PageTokenBreadCrumb links the pages of a list of entries. Going forward,
+// it passes the page token that findb returns for the next page so that
+// the next page can start where this one ended instead of skipping the
+// entries on every page before it. Going back, it passes just the page
+// number.
+type PageTokenBreadCrumb struct {
+	http_util.PageBreadCrumb
+
+	// The URL parameter holding the page token
+	TokenParam string
+
+	// The page token of the next page. Empty if the next page can only be
+	// found by page number.
+	NextToken string
+}
+
+// NextPageLink returns a URL to the next page.
+func (p *PageTokenBreadCrumb) NextPageLink() *url.URL {
+	result := http_util.WithParams(
+		p.URL, p.PageNoParam, strconv.Itoa(p.PageNo+1))
+	return withParam(result, p.TokenParam, p.NextToken)
+}
+
+// PrevPageLink returns a URL to the previous page.
+func (p *PageTokenBreadCrumb) PrevPageLink() *url.URL {
+	result := http_util.WithParams(
+		p.URL, p.PageNoParam, strconv.Itoa(p.PageNo-1))
+	return withParam(result, p.TokenParam, "")
+}
+
 type RecurringEntryLinker struct {
 	URL *url.URL
 	Sel Selecter
@@ -359,6 +508,36 @@ type Global struct {
 	Icon bool
 }
 
+// FX converts amounts in accounts of different currencies to a single
+// base currency.
+type FX struct {
+
+	// The currency to report in
+	Base fin.Currency
+
+	// The exchange rates to use
+	Rates fin.ExchangeRates
+}
+
+// Converter returns a converter to the base currency. accounts gives the
+// currency of each account. If f is nil, Converter returns nil meaning
+// do no conversion.
+func (f *FX) Converter(accounts fin.AccountCurrencies) *fin.BaseConverter {
+	if f == nil {
+		return nil
+	}
+	return &fin.BaseConverter{
+		Base: f.Base, Rates: f.Rates, Accounts: accounts}
+}
+
+// BaseCurrency returns the base currency. If f is nil, returns USD.
+func (f *FX) BaseCurrency() fin.Currency {
+	if f == nil {
+		return fin.USD
+	}
+	return f.Base.OrDefault()
+}
+
 // CatDisplayer is used to display categories.
 type CatDisplayer struct {
 	categories.CatDetailStore
@@ -399,13 +578,16 @@ func NormalizeYMDStr(dateStr string) string {
 
 // NewTemplate returns a new template instance. name is the name
 // of the template; templateStr is the template string. Returned
-// template has FormatDate and FormatUSD defined.
+// template has FormatDate, FormatUSD, FormatCurrency, and FormatTags
+// defined.
 func NewTemplate(name, templateStr string) *template.Template {
 	return template.Must(template.New(name).Funcs(
 		template.FuncMap{
-			"FormatDate":   formatDate,
-			"FormatUSD":    formatUSD,
-			"FormatUSDRaw": fin.FormatUSD}).Parse(templateStr))
+			"FormatDate":     formatDate,
+			"FormatUSD":      formatUSD,
+			"FormatUSDRaw":   fin.FormatUSD,
+			"FormatCurrency": fin.FormatCurrency,
+			"FormatTags":     fin.FormatTags}).Parse(templateStr))
 }
 
 // Is21stCentury returns true if year is in the 21st century.
@@ -424,6 +606,19 @@ func formatUSD(amt int64) template.HTML {
 	return template.HTML(fmt.Sprintf(positiveTemplate, fin.FormatUSD(amt)))
 }
 
+// withParam returns u with the value of name set to value or with name
+// removed if value is empty.
+func withParam(u *url.URL, name, value string) *url.URL {
+	if value != "" {
+		return http_util.WithParams(u, name, value)
+	}
+	v := u.Query()
+	v.Del(name)
+	result := *u
+	result.RawQuery = v.Encode()
+	return &result
+}
+
 func accountLink(id int64) *url.URL {
 	return http_util.NewUrl(
 		"/fin/account",
@@ -447,10 +642,23 @@ func formatDate(t time.Time) string {
 
 type sessionBatchKeyType int64
 
+type sessionLastImportKeyType int64
+
+type pendingBatch struct {
+	batch  autoimport.Batch
+	format string
+}
+
+type lastImport struct {
+	changeId int64
+	batch    autoimport.Batch
+}
+
 type sessionKeyType int
 
 const (
 	kCatPopularityKey sessionKeyType = iota
+	kBookIdKey
 )
 
 type catSelectModel struct {
@@ -5,6 +5,7 @@ import (
 	"github.com/keep94/finances/fin/autoimport"
 	"github.com/keep94/sessions"
 	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/http_util"
 	"testing"
 )
 
@@ -34,6 +35,66 @@ func TestSessionBatch(t *testing.T) {
 	if s.Batch(5) != batch5 {
 		t.Error("Expected batch5")
 	}
+	s.SetBatchWithFormat(7, batch7, "OFX")
+	if s.Batch(7) != batch7 || s.BatchFormat(7) != "OFX" {
+		t.Error("Expected OFX batch7")
+	}
+	if s.BatchFormat(5) != "" || s.BatchFormat(8) != "" {
+		t.Error("Expected no format")
+	}
+	s.SetBatch(7, nil)
+	if s.BatchFormat(7) != "" {
+		t.Error("Expected no format")
+	}
+}
+
+func TestSessionBookId(t *testing.T) {
+	s := CreateUserSession(&sessions.Session{Values: make(map[interface{}]interface{})})
+	if _, ok := s.BookId(); ok {
+		t.Error("Expected no book")
+	}
+	batch5 := batchForTesting{5}
+	s.SetBookId(0)
+	s.SetBatch(5, batch5)
+	s.SetLastImport(5, 3, batch5)
+	s.SetCatPopularity(fin.CatPopularity{})
+	s.SetBookId(0)
+	if s.Batch(5) != batch5 {
+		t.Error("Expected batch5 in same book")
+	}
+	s.SetBookId(1)
+	if id, ok := s.BookId(); !ok || id != 1 {
+		t.Errorf("Expected book 1, got %d", id)
+	}
+	if s.Batch(5) != nil {
+		t.Error("Expected batches of old book to be gone")
+	}
+	if _, batch := s.LastImport(5); batch != nil {
+		t.Error("Expected last imports of old book to be gone")
+	}
+	if s.CatPopularity() != nil {
+		t.Error("Expected popularities of old book to be gone")
+	}
+}
+
+func TestPageTokenBreadCrumb(t *testing.T) {
+	crumb := PageTokenBreadCrumb{
+		PageBreadCrumb: http_util.PageBreadCrumb{
+			URL:         http_util.NewUrl("/fin/list", "pageNo", "2", "pt", "abc"),
+			PageNoParam: "pageNo",
+			PageNo:      2},
+		TokenParam: "pt",
+		NextToken:  "def"}
+	if link := crumb.NextPageLink().String(); link != "/fin/list?pageNo=3&pt=def" {
+		t.Errorf("Got next page link %s", link)
+	}
+	if link := crumb.PrevPageLink().String(); link != "/fin/list?pageNo=1" {
+		t.Errorf("Got previous page link %s", link)
+	}
+	crumb.NextToken = ""
+	if link := crumb.NextPageLink().String(); link != "/fin/list?pageNo=3" {
+		t.Errorf("Got next page link %s", link)
+	}
 }
 
 type batchForTesting struct {
@@ -49,7 +110,11 @@ func (b batchForTesting) SkipProcessed(t db.Transaction) (
 	return
 }
 
-func (b batchForTesting) MarkProcessed(t db.Transaction) error {
+func (b batchForTesting) MarkProcessed(t db.Transaction, changeId int64) error {
+	return nil
+}
+
+func (b batchForTesting) MarkUnprocessed(t db.Transaction) error {
 	return nil
 }
 
@@ -4,12 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/keep94/finances/fin/categories"
-	"github.com/keep94/finances/fin/categories/categoriesdb"
 	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/http_util"
 	"html/template"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -23,6 +23,16 @@ var (
 <b>{{.UserName}}</b><br>
 {{.LastLogin}}<br>
 <br>
+{{if .OtherBooks}}
+Book: <b>{{.BookName}}</b><br>
+Switch to:
+<ul>
+  {{range .OtherBooks}}
+    <li><a href="{{.Link}}">{{.Name}}</a></li>
+  {{end}}
+</ul>
+<br>
+{{end}}
 Accounts:
 <ul>
 {{with $top := .}}
@@ -42,8 +52,14 @@ Accounts:
 <a {{if .Manage}}class="selected"{{end}} href="/fin/catedit">Manage Categories</a><br>
 <a {{if .Recurring}}class="selected"{{end}} href="/fin/recurringlist">Recurring</a><br>
 <a {{if .Export}}class="selected"{{end}} href="/fin/export">Export</a><br>
+<a {{if .Undo}}class="selected"{{end}} href="/fin/undo">Undo</a><br>
+<a {{if .Trash}}class="selected"{{end}} href="/fin/trash">Trash</a><br>
+{{if .Backup}}
+<a {{if .BackupSelected}}class="selected"{{end}} href="/fin/backup">Backups</a><br>
+{{end}}
 <br>
 <a {{if .Chpasswd}}class="selected"{{end}} href="/fin/chpasswd">Change Password</a><br>
+<a {{if .ApiTokens}}class="selected"{{end}} href="/fin/apitokens">API Tokens</a><br>
 <a href="/fin/logout">Sign out</a>
 <br><br>
 </div>`
@@ -53,6 +69,9 @@ var (
 	kLeftNavTemplate *template.Template
 )
 
+// BookXsrfAction is the xsrf action of the links that switch books.
+const BookXsrfAction = "book"
+
 // Selecter indicates the item to be selected in the left navigation bar.
 type Selecter struct {
 	cat int
@@ -91,6 +110,10 @@ const (
 	export
 	chpasswd
 	envelopes
+	undo
+	backup
+	trash
+	apiTokens
 )
 
 func SelectAccount(id int64) Selecter { return Selecter{cat: accounts, id: id} }
@@ -104,13 +127,29 @@ func SelectRecurring() Selecter       { return Selecter{cat: recurring} }
 func SelectExport() Selecter          { return Selecter{cat: export} }
 func SelectChpasswd() Selecter        { return Selecter{cat: chpasswd} }
 func SelectEnvelopes() Selecter       { return Selecter{cat: envelopes} }
+func SelectUndo() Selecter            { return Selecter{cat: undo} }
+func SelectBackup() Selecter          { return Selecter{cat: backup} }
+func SelectTrash() Selecter           { return Selecter{cat: trash} }
+func SelectApiTokens() Selecter       { return Selecter{cat: apiTokens} }
 func SelectNone() Selecter            { return Selecter{} }
 
-// LeftNav is for creating the left navigation bar.
+// LeftNav is for creating the left navigation bar. LeftNav gets the
+// categories and accounts from the category cache of the user session.
 type LeftNav struct {
-	Cdc     categoriesdb.Getter
 	Clock   date_util.Clock
 	BuildId string
+
+	// If true, the left navigation bar links to the backups page.
+	Backup bool
+}
+
+// AccountFilter is implemented by stores that let the user see only
+// some accounts. When the store of the user session implements
+// AccountFilter, the left navigation bar lists only those accounts.
+type AccountFilter interface {
+	// HasAccount returns true if the user may see the account with
+	// given id.
+	HasAccount(id int64) bool
 }
 
 // Generate generates the html for the left navigation bar including the div
@@ -125,7 +164,7 @@ func (l *LeftNav) Generate(
 	if ok {
 		lastLoginStr = lastLogin.Local().Format("Mon 01/02/2006 15:04")
 	}
-	cds, err := l.Cdc.Get(nil)
+	cds, err := session.Cache.Get(nil)
 	if err != nil {
 		http_util.ReportError(w, "Database error", err)
 		return ""
@@ -139,7 +178,9 @@ func (l *LeftNav) Generate(
 	var sb strings.Builder
 	http_util.WriteTemplate(&sb, kLeftNavTemplate, &view{
 		CatDetailStore: cds,
+		accounts:       accountFilter(session.Store),
 		BuildId:        l.BuildId,
+		Backup:         l.Backup,
 		ReportUrl: http_util.NewUrl(
 			"/fin/report",
 			"sd", oneMonthAgo.Format(date_util.YMDFormat),
@@ -151,9 +192,11 @@ func (l *LeftNav) Generate(
 		EnvelopeUrl: http_util.NewUrl(
 			"/fin/envelopes",
 			"year", strconv.Itoa(currentYear)),
-		UserName:  session.User.Name,
-		LastLogin: lastLoginStr,
-		sel:       sel})
+		BookName:   session.Book.Name,
+		OtherBooks: otherBooks(r, session),
+		UserName:   session.User.Name,
+		LastLogin:  lastLoginStr,
+		sel:        sel})
 	return template.HTML(sb.String())
 }
 
@@ -161,12 +204,32 @@ type view struct {
 	AccountLinker
 	categories.CatDetailStore
 	BuildId     string
+	Backup      bool
 	ReportUrl   *url.URL
 	TrendUrl    *url.URL
 	EnvelopeUrl *url.URL
+	BookName    string
+	OtherBooks  []bookLink
 	UserName    string
 	LastLogin   string
 	sel         Selecter
+	accounts    AccountFilter
+}
+
+func accountFilter(store interface{}) AccountFilter {
+	result, _ := store.(AccountFilter)
+	return result
+}
+
+// ActiveAccountDetails returns the active accounts the user may see.
+func (v *view) ActiveAccountDetails() []categories.AccountDetail {
+	result := v.CatDetailStore.ActiveAccountDetails()
+	if v.accounts == nil {
+		return result
+	}
+	return slices.DeleteFunc(result, func(a categories.AccountDetail) bool {
+		return !v.accounts.HasAccount(a.Id())
+	})
 }
 
 func (v *view) Account(id int64) bool { return v.sel == SelectAccount(id) }
@@ -180,6 +243,33 @@ func (v *view) Recurring() bool       { return v.sel == SelectRecurring() }
 func (v *view) Export() bool          { return v.sel == SelectExport() }
 func (v *view) Chpasswd() bool        { return v.sel == SelectChpasswd() }
 func (v *view) Envelopes() bool       { return v.sel == SelectEnvelopes() }
+func (v *view) Undo() bool            { return v.sel == SelectUndo() }
+func (v *view) BackupSelected() bool  { return v.sel == SelectBackup() }
+func (v *view) Trash() bool           { return v.sel == SelectTrash() }
+func (v *view) ApiTokens() bool       { return v.sel == SelectApiTokens() }
+
+type bookLink struct {
+	Name string
+	Link *url.URL
+}
+
+func otherBooks(r *http.Request, session *UserSession) []bookLink {
+	if len(session.Books) < 2 {
+		return nil
+	}
+	xsrf := NewXsrfToken(r, BookXsrfAction)
+	var result []bookLink
+	for _, book := range session.Books {
+		if book.Id == session.Book.Id {
+			continue
+		}
+		result = append(result, bookLink{
+			Name: book.Name,
+			Link: http_util.NewUrl(
+				"/fin/switchbook", "id", strconv.Itoa(book.Id), "xsrf", xsrf)})
+	}
+	return result
+}
 
 func init() {
 	kLeftNavTemplate = NewTemplate("leftnav", kLeftNavTemplateSpec)
@@ -110,8 +110,12 @@ func ToSingleEntryView(
 	result.Set("name", entry.Name)
 	result.Set("desc", entry.Desc)
 	result.Set("checkno", entry.CheckNo)
+	result.Set("tags", fin.FormatTags(entry.Tags))
 	result.Set("date", entry.Date.Format(date_util.YMDFormat))
 	result.Set("payment", strconv.FormatInt(entry.PaymentId(), 10))
+	if rate := entry.ExchangeRate(); rate != 1.0 {
+		result.Set("rate", strconv.FormatFloat(rate, 'g', -1, 64))
+	}
 	if entry.Reconciled() {
 		result.Set("reconciled", "on")
 	}
@@ -181,13 +185,23 @@ func EntryMutation(values url.Values) (
 	}
 	desc := values.Get("desc")
 	checkno := values.Get("checkno")
+	tags := fin.ParseTags(values.Get("tags"))
 	paymentId, _ := strconv.ParseInt(values.Get("payment"), 10, 64)
 	if paymentId == 0 {
 		err = errors.New("Missing payment.")
 		return
 	}
+	var rate float64
+	if rateStr := strings.TrimSpace(values.Get("rate")); rateStr != "" {
+		rate, err = strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate <= 0 {
+			err = errors.New(fmt.Sprintf("Invalid rate: %s", rateStr))
+			return
+		}
+	}
 	cpb := fin.CatPaymentBuilder{}
 	cpb.SetPaymentId(paymentId).SetReconciled(values.Get("reconciled") != "")
+	cpb.SetExchangeRate(rate)
 	catrec := fin.CatRec{}
 	for _, split := range entrySplits {
 		cat := fin.NewCat(values.Get(split.CatParam()))
@@ -214,6 +228,7 @@ func EntryMutation(values url.Values) (
 		p.Name = name
 		p.Desc = desc
 		p.CheckNo = checkno
+		p.Tags = tags
 		p.CatPayment = cp
 		if needReview {
 			if p.Status == fin.Reviewed {
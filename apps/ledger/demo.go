@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin"
+	qfxmemory "github.com/keep94/finances/fin/autoimport/qfx/qfxdb/for_memory"
+	cmemory "github.com/keep94/finances/fin/categories/categoriesdb/for_memory"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/finances/fin/findb/for_memory"
+	fxmemory "github.com/keep94/finances/fin/fx/for_memory"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/passwords"
+)
+
+const (
+	kDemoUserName = "demo"
+	kDemoPassword = "demo"
+)
+
+// demoEntry is a sample entry that repeats every month.
+type demoEntry struct {
+	day     int
+	name    string
+	cat     string
+	amount  int64
+	account string
+}
+
+var (
+	kDemoAccounts   = []string{"Checking", "Savings", "Visa"}
+	kDemoCategories = []string{
+		"expense:Food",
+		"expense:Food:Groceries",
+		"expense:Food:Restaurants",
+		"expense:Housing",
+		"expense:Housing:Rent",
+		"expense:Utilities",
+		"expense:Entertainment",
+		"income:Salary",
+	}
+	kDemoEntries = []demoEntry{
+		{day: 1, name: "Acme Corp", cat: "income:Salary", amount: -420000, account: "Checking"},
+		{day: 3, name: "Fresh Market", cat: "expense:Food:Groceries", amount: 8734, account: "Visa"},
+		{day: 8, name: "City Power", cat: "expense:Utilities", amount: 11250, account: "Checking"},
+		{day: 12, name: "Luigi's", cat: "expense:Food:Restaurants", amount: 5420, account: "Visa"},
+		{day: 15, name: "Acme Corp", cat: "income:Salary", amount: -420000, account: "Checking"},
+		{day: 17, name: "Fresh Market", cat: "expense:Food:Groceries", amount: 10112, account: "Visa"},
+		{day: 21, name: "Cinema 8", cat: "expense:Entertainment", amount: 3200, account: "Visa"},
+		{day: 25, name: "Transfer to savings", cat: "Savings", amount: 50000, account: "Checking"},
+	}
+)
+
+// setupDemoDb sets up an in-memory database holding a few months of
+// sample data that the demo user can log into.
+func setupDemoDb() {
+	dbase := for_memory.NewDb()
+	cache := cmemory.New(dbase)
+	store := for_memory.New(dbase).WithClock(kClock)
+	demo := &book{
+		Book:                   common.Book{Name: fBookName},
+		doer:                   for_memory.NewDoer(dbase),
+		catDetailCache:         cache,
+		readOnlyCatDetailCache: cmemory.ReadOnlyWrapper(cache),
+		readOnlyStore:          for_memory.ReadOnlyWrapper(store),
+		fxStore:                fxmemory.New(dbase),
+		storeForUser: func(userId int64) interface{} {
+			return store.WithUser(userId)
+		},
+	}
+	demo.setupUploaders(qfxmemory.New(dbase))
+	kBooks = []*book{demo}
+	kDoer = demo.doer
+	kStore = store
+	kReadOnlyStore = demo.readOnlyStore
+	kFXStore = demo.fxStore
+	err := kDoer.Do(func(t db.Transaction) error {
+		return seedDemo(t, cache, store, kClock.Now())
+	})
+	if err != nil {
+		log.Fatalf("Error seeding demo data: %v", err)
+	}
+	fmt.Printf(
+		"Demo mode: log in as %s with password %s\n",
+		kDemoUserName,
+		kDemoPassword)
+}
+
+// seedDemo adds the demo user along with sample accounts, categories,
+// and entries covering the three months before now.
+func seedDemo(
+	t db.Transaction,
+	cache *cmemory.Cache,
+	store for_memory.Store,
+	now time.Time) error {
+	user := fin.User{
+		Name:       kDemoUserName,
+		Password:   passwords.New(kDemoPassword),
+		Permission: fin.AllPermission}
+	if err := store.AddUser(t, &user); err != nil {
+		return err
+	}
+	cats := make(map[string]fin.Cat)
+	for _, name := range kDemoAccounts {
+		_, id, err := cache.AccountAdd(t, name)
+		if err != nil {
+			return err
+		}
+		cats[name] = fin.Cat{Id: id, Type: fin.AccountCat}
+	}
+	for _, name := range kDemoCategories {
+		_, cat, err := cache.Add(t, name)
+		if err != nil {
+			return err
+		}
+		cats[name] = cat
+	}
+	today := date_util.TimeToDate(now)
+	start := today.AddDate(0, -3, 0)
+	var changes findb.EntryChanges
+	for month := start; !month.After(today); month = month.AddDate(0, 1, 0) {
+		for _, e := range kDemoEntries {
+			date := date_util.YMD(month.Year(), int(month.Month()), e.day)
+			if date.Before(start) || date.After(today) {
+				continue
+			}
+			changes.Adds = append(changes.Adds, &fin.Entry{
+				Date: date,
+				Name: e.name,
+				CatPayment: fin.NewCatPayment(
+					cats[e.cat],
+					e.amount,
+					date.Before(today.AddDate(0, 0, -14)),
+					cats[e.account].Id),
+				Status: fin.Reviewed})
+		}
+	}
+	if err := store.DoEntryChanges(t, &changes); err != nil {
+		return err
+	}
+	rent := fin.RecurringEntry{
+		Entry: fin.Entry{
+			Date: date_util.YMD(today.Year(), int(today.Month()), 1).AddDate(
+				0, 1, 0),
+			Name: "Oak Street Apartments",
+			CatPayment: fin.NewCatPayment(
+				cats["expense:Housing:Rent"],
+				185000,
+				false,
+				cats["Checking"].Id)},
+		Period:  fin.RecurringPeriod{Count: 1, Unit: fin.Months, DayOfMonth: 1},
+		NumLeft: -1}
+	return store.AddRecurringEntry(t, &rent)
+}
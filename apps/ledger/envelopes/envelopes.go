@@ -131,7 +131,6 @@ type Store interface {
 }
 
 type Handler struct {
-	Doer   db.Doer
 	LN     *common.LeftNav
 	Global *common.Global
 }
@@ -146,12 +145,13 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		err = doPostAction(r, store)
 	}
 	cds, _ := cdc.Get(nil)
-	h.doGet(w, r, store, cds, err)
+	h.doGet(w, r, session.Doer, store, cds, err)
 }
 
 func (h *Handler) doGet(
 	w http.ResponseWriter,
 	r *http.Request,
+	doer db.Doer,
 	store edata.Store,
 	cds categories.CatDetailStore,
 	err error) {
@@ -160,7 +160,7 @@ func (h *Handler) doGet(
 		return
 	}
 	year, _ := strconv.Atoi(r.Form.Get("year"))
-	summary, gerr := h.getSummary(store, cds, year, r.Form.Get("sort"))
+	summary, gerr := h.getSummary(doer, store, cds, year, r.Form.Get("sort"))
 	if gerr != nil {
 		err = gerr
 	}
@@ -191,6 +191,7 @@ func (h *Handler) doGet(
 }
 
 func (h *Handler) getSummary(
+	doer db.Doer,
 	store edata.Store,
 	cds categories.CatDetailStore,
 	year int,
@@ -198,7 +199,7 @@ func (h *Handler) getSummary(
 	if !common.Is21stCentury(year) {
 		return nil, common.ErrInvalidYear
 	}
-	err = h.Doer.Do(func(t db.Transaction) (err error) {
+	err = doer.Do(func(t db.Transaction) (err error) {
 		result, err = edata.SummaryByYear(t, store, cds, int64(year))
 		return
 	})
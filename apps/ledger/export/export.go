@@ -9,7 +9,6 @@ import (
 	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/categories"
-	"github.com/keep94/finances/fin/categories/categoriesdb"
 	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/http_util"
@@ -79,8 +78,6 @@ var (
 )
 
 type Handler struct {
-	Store  findb.EntriesRunner
-	Cdc    categoriesdb.Getter
 	Clock  date_util.Clock
 	LN     *common.LeftNav
 	Global *common.Global
@@ -88,7 +85,7 @@ type Handler struct {
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
-	cds, _ := h.Cdc.Get(nil)
+	cds, _ := common.GetUserSession(r).Cache.Get(nil)
 	if r.Method == "GET" {
 		h.doGet(w, r, cds)
 	} else {
@@ -152,7 +149,8 @@ func (h *Handler) doPost(
 			ok := entry.WithPayment(acctId)
 			return entry, ok
 		})
-	err = h.Store.Entries(nil, elo, consumer)
+	store := common.GetUserSession(r).Store.(findb.EntriesRunner)
+	err = store.Entries(nil, elo, consumer)
 	if err == nil && !consumer.CanConsume() {
 		err = errors.New("File too big. Try a smaller date range")
 	}
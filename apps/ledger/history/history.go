@@ -0,0 +1,243 @@
+package history
+
+import (
+	"fmt"
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/http_util"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	kTemplateSpec = `
+<html>
+<head>
+  <title>{{.Global.Title}}</title>
+  {{if .Global.Icon}}
+    <link rel="shortcut icon" href="/images/favicon.ico" type="image/x-icon" />
+  {{end}}
+  <link rel="stylesheet" type="text/css" href="/static/theme.css" />
+</head>
+<body>
+{{.LeftNav}}
+<div class="main">
+<h2>History</h2>
+<a href="{{.EntryLink}}">Back to entry</a>
+<br><br>
+{{if .Rows}}
+<table border=1>
+  <tr>
+    <td>When</td>
+    <td>Who</td>
+    <td>What</td>
+    <td>Field</td>
+    <td>Before</td>
+    <td>After</td>
+  </tr>
+  {{range .Rows}}
+    {{$row := .}}
+    {{range $i, $change := .Changes}}
+  <tr>
+    {{if eq $i 0}}
+    <td rowspan="{{len $row.Changes}}">{{$row.When}}</td>
+    <td rowspan="{{len $row.Changes}}">{{$row.Who}}</td>
+    <td rowspan="{{len $row.Changes}}">{{$row.What}}</td>
+    {{end}}
+    <td>{{$change.Field}}</td>
+    <td>{{$change.Before}}</td>
+    <td>{{$change.After}}</td>
+  </tr>
+    {{end}}
+  {{end}}
+</table>
+{{else}}
+No history for this entry.
+{{end}}
+</div>
+</body>
+</html>`
+)
+
+var (
+	kTemplate *template.Template
+)
+
+// Store methods are from fin.Store
+type Store interface {
+	findb.EntryHistoryRunner
+	findb.UsersRunner
+}
+
+// Handler shows every recorded change to the entry given by "id".
+type Handler struct {
+	LN     *common.LeftNav
+	Global *common.Global
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	session := common.GetUserSession(r)
+	cdc := session.Cache
+	store := session.Store.(Store)
+	id, _ := strconv.ParseInt(r.Form.Get("id"), 10, 64)
+	selecter, err := common.ParseSelecter(r.Form.Get("sel"))
+	if err != nil {
+		selecter = common.SelectSearch()
+	}
+	var history []fin.EntryHistory
+	var users []fin.User
+	var cds categories.CatDetailStore
+	err = session.Doer.Do(func(t db.Transaction) (err error) {
+		cds, err = cdc.Get(t)
+		if err != nil {
+			return
+		}
+		if err = store.Users(t, consume2.AppendTo(&users)); err != nil {
+			return
+		}
+		return store.EntryHistory(t, id, consume2.AppendTo(&history))
+	})
+	if err != nil {
+		http_util.ReportError(w, "Error reading database.", err)
+		return
+	}
+	leftnav := h.LN.Generate(w, r, selecter)
+	if leftnav == "" {
+		return
+	}
+	userNames := make(map[int64]string, len(users))
+	for _, user := range users {
+		userNames[user.Id] = user.Name
+	}
+	rows := make([]*historyRow, 0, len(history))
+	// Show the most recent changes first.
+	for i := len(history) - 1; i >= 0; i-- {
+		rows = append(rows, toHistoryRow(&history[i], userNames, cds))
+	}
+	http_util.WriteTemplate(w, kTemplate, &view{
+		Rows: rows,
+		EntryLink: http_util.NewUrl(
+			"/fin/single",
+			"id", strconv.FormatInt(id, 10),
+			"prev", r.Form.Get("prev")),
+		LeftNav: leftnav,
+		Global:  h.Global})
+}
+
+type view struct {
+	Rows      []*historyRow
+	EntryLink *url.URL
+	LeftNav   template.HTML
+	Global    *common.Global
+}
+
+type historyRow struct {
+	When    string
+	Who     string
+	What    string
+	Changes []fieldChange
+}
+
+type fieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+func toHistoryRow(
+	h *fin.EntryHistory,
+	userNames map[int64]string,
+	cds categories.CatDetailStore) *historyRow {
+	result := &historyRow{
+		When: h.Time.Local().Format("01/02/2006 15:04:05"),
+		Who:  userNames[h.UserId],
+	}
+	if result.Who == "" {
+		result.Who = fmt.Sprintf("#%d", h.UserId)
+	}
+	before := entryFields(h.Before, cds)
+	after := entryFields(h.After, cds)
+	switch {
+	case h.IsAdd():
+		result.What = "Added"
+	case h.IsDelete():
+		result.What = "Deleted"
+	default:
+		result.What = "Changed"
+	}
+	for i, name := range kFieldNames {
+		if before[i] == after[i] {
+			continue
+		}
+		result.Changes = append(
+			result.Changes,
+			fieldChange{Field: name, Before: before[i], After: after[i]})
+	}
+	if len(result.Changes) == 0 {
+		result.Changes = []fieldChange{{Field: "(none)"}}
+	}
+	return result
+}
+
+var (
+	kFieldNames = []string{
+		"Date",
+		"Name",
+		"Desc",
+		"Check #",
+		"Categories",
+		"Payment",
+		"Rate",
+		"Reviewed",
+		"Tags",
+	}
+)
+
+// entryFields returns the displayed value of each field in kFieldNames.
+// If entry is nil, entryFields returns all empty strings.
+func entryFields(
+	entry *fin.Entry, cds categories.CatDetailStore) []string {
+	if entry == nil {
+		return make([]string, len(kFieldNames))
+	}
+	cats := make([]string, 0, entry.CatRecCount())
+	for _, cr := range entry.CatRecs() {
+		cat := fmt.Sprintf(
+			"%s %s", cds.DetailById(cr.Cat).FullName(), fin.FormatUSD(cr.Amount))
+		if cr.Reconciled {
+			cat += " (R)"
+		}
+		cats = append(cats, cat)
+	}
+	payment := cds.AccountDetailById(entry.PaymentId()).Name()
+	if entry.Reconciled() {
+		payment += " (R)"
+	}
+	reviewed := "No"
+	if entry.Status == fin.Reviewed {
+		reviewed = "Yes"
+	}
+	return []string{
+		entry.Date.Format("01/02/2006"),
+		entry.Name,
+		entry.Desc,
+		entry.CheckNo,
+		strings.Join(cats, "; "),
+		payment,
+		strconv.FormatFloat(entry.ExchangeRate(), 'g', -1, 64),
+		reviewed,
+		fin.FormatTags(entry.Tags),
+	}
+}
+
+func init() {
+	kTemplate = common.NewTemplate("history", kTemplateSpec)
+}
@@ -9,16 +9,24 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/keep94/consume2"
 	"github.com/keep94/context"
 	"github.com/keep94/finances/apps/ledger/ac"
 	"github.com/keep94/finances/apps/ledger/account"
 	"github.com/keep94/finances/apps/ledger/addenvelope"
+	"github.com/keep94/finances/apps/ledger/api"
+	"github.com/keep94/finances/apps/ledger/apitokens"
+	"github.com/keep94/finances/apps/ledger/attachment"
+	"github.com/keep94/finances/apps/ledger/backup"
 	"github.com/keep94/finances/apps/ledger/catedit"
 	"github.com/keep94/finances/apps/ledger/chpasswd"
 	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/apps/ledger/envelopes"
 	"github.com/keep94/finances/apps/ledger/export"
+	"github.com/keep94/finances/apps/ledger/history"
 	"github.com/keep94/finances/apps/ledger/list"
 	"github.com/keep94/finances/apps/ledger/login"
 	"github.com/keep94/finances/apps/ledger/logout"
@@ -27,19 +35,32 @@ import (
 	"github.com/keep94/finances/apps/ledger/report"
 	"github.com/keep94/finances/apps/ledger/single"
 	"github.com/keep94/finances/apps/ledger/static"
+	"github.com/keep94/finances/apps/ledger/switchbook"
 	"github.com/keep94/finances/apps/ledger/totals"
+	"github.com/keep94/finances/apps/ledger/trash"
 	"github.com/keep94/finances/apps/ledger/trends"
+	"github.com/keep94/finances/apps/ledger/undo"
 	"github.com/keep94/finances/apps/ledger/unreconciled"
 	"github.com/keep94/finances/apps/ledger/unreviewed"
 	"github.com/keep94/finances/apps/ledger/upload"
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/finances/fin/autoimport/camt"
 	"github.com/keep94/finances/fin/autoimport/csv"
+	"github.com/keep94/finances/fin/autoimport/mt940"
 	"github.com/keep94/finances/fin/autoimport/qfx"
 	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
 	qfxsqlite "github.com/keep94/finances/fin/autoimport/qfx/qfxdb/for_sqlite"
+	"github.com/keep94/finances/fin/autoimport/qif"
+	"github.com/keep94/finances/fin/categories/categoriesdb"
 	csqlite "github.com/keep94/finances/fin/categories/categoriesdb/for_sqlite"
+	"github.com/keep94/finances/fin/consumers"
+	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/finances/fin/findb/for_sqlite"
+	"github.com/keep94/finances/fin/findb/sqlite_backup"
+	"github.com/keep94/finances/fin/findb/sqlite_setup"
+	"github.com/keep94/finances/fin/fx"
+	fxsqlite "github.com/keep94/finances/fin/fx/for_sqlite"
 	"github.com/keep94/ramstore"
 	"github.com/keep94/toolbox/build"
 	"github.com/keep94/toolbox/date_util"
@@ -65,24 +86,40 @@ var (
 	fSSLKey             string
 	fPort               string
 	fDb                 string
+	fBookName           string
+	fBooks              string
 	fIcon               string
 	fTitle              string
 	fGmailConfig        string
 	fLinks              bool
 	fPopularityLookback int
 	fNoWifi             bool
+	fDemo               bool
+	fMigrate            bool
+	fBaseCurrency       string
+	fFXRates            string
+	fFXCSV              string
+	fBackupDir          string
+	fBackupKeep         int
+	fTrashDays          int
+	fCsvProfiles        string
 )
 
 var (
-	kDoer                   db.Doer
-	kCatDetailCache         *csqlite.Cache
-	kStore                  for_sqlite.Store
-	kUploaders              map[string]autoimport.Loader
-	kReadOnlyCatDetailCache csqlite.ReadOnlyCache
-	kReadOnlyStore          for_sqlite.ReadOnlyStore
-	kReadOnlyUploaders      map[string]autoimport.Loader
-	kSessionStore           = ramstore.NewRAMStore(kSessionTimeout)
-	kClock                  date_util.SystemClock
+	// The books that ledger serves
+	kBooks []*book
+
+	// These come from the database in -db which has the users.
+	kDoer          db.Doer
+	kStore         store
+	kReadOnlyStore readOnlyStore
+	kFXStore       fx.Store
+
+	kSessionStore = ramstore.NewRAMStore(kSessionTimeout)
+	kClock        date_util.SystemClock
+
+	// Describe the csv files of banks that ledger doesn't know about
+	kCsvProfiles []csv.Profile
 )
 
 var (
@@ -93,12 +130,30 @@ var (
 
 func main() {
 	flag.Parse()
-	if fDb == "" {
-		fmt.Println("Need to specify at least -db flag.")
+	if fDb == "" && !fDemo {
+		fmt.Println("Need to specify at least -db or -demo flag.")
 		flag.Usage()
 		return
 	}
-	setupDb(fDb)
+	if fMigrate {
+		if fDb == "" {
+			fmt.Println("Need to specify -db flag with -migrate.")
+			os.Exit(2)
+		}
+		migrateDb(fDb)
+		return
+	}
+	if fCsvProfiles != "" {
+		setupCsvProfiles(fCsvProfiles)
+	}
+	if fDemo {
+		setupDemoDb()
+	} else {
+		setupDb(fDb)
+		if fBooks != "" {
+			setupBooks(fBooks)
+		}
+	}
 	if fGmailConfig != "" {
 		setupGmail(fGmailConfig)
 	}
@@ -115,31 +170,42 @@ func main() {
 			hasIcon = true
 		}
 	}
-	global := &common.Global{Title: fTitle, Icon: hasIcon}
+	setupFX(fBaseCurrency, fFXRates, fFXCSV)
+	global := &common.Global{
+		Title: fTitle,
+		Icon:  hasIcon}
 	http.Handle(
 		"/auth/login",
 		&login.Handler{
-			Doer:               kDoer,
-			SessionStore:       kSessionStore,
-			Store:              kStore,
-			LO:                 kLockout,
-			Mailer:             kMailer,
-			Recipients:         kLockoutRecipients,
-			PopularityLookback: fPopularityLookback,
-			Global:             global})
+			Doer:         kDoer,
+			SessionStore: kSessionStore,
+			Store:        kStore,
+			LO:           kLockout,
+			Mailer:       kMailer,
+			Recipients:   kLockoutRecipients,
+			Global:       global})
 	version, _ := build.MainVersion()
+	backupDatabases := make(map[int]backup.Database)
+	if fBackupDir != "" {
+		for _, b := range kBooks {
+			if b.rawDb != nil {
+				backupDatabases[b.Id] = backup.Database{
+					DB: b.rawDb, Prefix: sqlite_backup.Prefix(b.path)}
+			}
+		}
+	}
 	ln := &common.LeftNav{
-		Cdc:     kReadOnlyCatDetailCache,
 		Clock:   kClock,
 		BuildId: build.BuildId(version),
+		Backup:  len(backupDatabases) > 0,
 	}
 	http.Handle(
-		"/fin/", &authHandler{mux})
+		"/fin/", &authHandler{Handler: mux})
+	http.Handle(
+		"/api/", &authHandler{Handler: api.New(kClock), api: true})
 	mux.Handle(
 		"/fin/list",
 		&list.Handler{
-			Store:    kReadOnlyStore,
-			Cdc:      kReadOnlyCatDetailCache,
 			PageSize: kPageSize,
 			Links:    fLinks,
 			LN:       ln,
@@ -147,28 +213,40 @@ func main() {
 	mux.Handle(
 		"/fin/recurringlist",
 		&recurringlist.Handler{
-			Doer:   kDoer,
-			Cdc:    kReadOnlyCatDetailCache,
 			Clock:  kClock,
 			LN:     ln,
 			Global: global})
 	mux.Handle(
 		"/fin/account",
 		&account.Handler{
-			Store:    kReadOnlyStore,
-			Cdc:      kReadOnlyCatDetailCache,
-			Doer:     kDoer,
 			PageSize: kPageSize,
 			Links:    fLinks,
 			LN:       ln,
 			Global:   global})
 	mux.Handle(
 		"/fin/single",
-		&single.Handler{Doer: kDoer, Clock: kClock, Global: global, LN: ln})
+		&single.Handler{Clock: kClock, Global: global, LN: ln})
+	mux.Handle(
+		"/fin/attachment",
+		&attachment.Handler{Clock: kClock})
+	mux.Handle(
+		"/fin/undo",
+		&undo.Handler{LN: ln, Global: global})
+	mux.Handle(
+		"/fin/trash",
+		&trash.Handler{
+			Days:   fTrashDays,
+			Clock:  kClock,
+			LN:     ln,
+			Global: global})
+	mux.Handle(
+		"/fin/history",
+		&history.Handler{
+			LN:     ln,
+			Global: global})
 	mux.Handle(
 		"/fin/recurringsingle",
-		&recurringsingle.Handler{
-			Doer: kDoer, Clock: kClock, Global: global, LN: ln})
+		&recurringsingle.Handler{Clock: kClock, Global: global, LN: ln})
 	mux.Handle("/fin/catedit", &catedit.Handler{LN: ln, Global: global})
 	mux.Handle("/fin/logout", &logout.Handler{})
 	// For now, the chpasswd handler gets full access to store
@@ -179,37 +257,41 @@ func main() {
 			Doer:   kDoer,
 			LN:     ln,
 			Global: global})
+	// Like chpasswd, the apitokens handler gets full access to store
+	mux.Handle(
+		"/fin/apitokens",
+		&apitokens.Handler{
+			Store:  kStore,
+			Clock:  kClock,
+			LN:     ln,
+			Global: global})
 	mux.Handle(
 		"/fin/report",
 		&report.Handler{
-			Cdc:    kReadOnlyCatDetailCache,
-			Store:  kReadOnlyStore,
 			LN:     ln,
 			Global: global,
 			NoWifi: fNoWifi})
 	mux.Handle(
 		"/fin/trends",
 		&trends.Handler{
-			Store:  kReadOnlyStore,
-			Cdc:    kReadOnlyCatDetailCache,
 			LN:     ln,
 			Global: global,
 			NoWifi: fNoWifi})
 	mux.Handle(
 		"/fin/totals",
-		&totals.Handler{Store: kReadOnlyStore, LN: ln, Global: global})
+		&totals.Handler{
+			Clock:  kClock,
+			LN:     ln,
+			Global: global})
 	mux.Handle(
 		"/fin/export",
 		&export.Handler{
-			Store:  kReadOnlyStore,
-			Cdc:    kReadOnlyCatDetailCache,
 			Clock:  kClock,
 			LN:     ln,
 			Global: global})
 	mux.Handle(
 		"/fin/envelopes",
 		&envelopes.Handler{
-			Doer:   kDoer,
 			LN:     ln,
 			Global: global})
 	mux.Handle(
@@ -220,30 +302,36 @@ func main() {
 	mux.Handle(
 		"/fin/unreconciled",
 		&unreconciled.Handler{
-			Doer:     kDoer,
 			PageSize: kPageSize,
 			LN:       ln,
 			Global:   global})
 	mux.Handle(
 		"/fin/unreviewed",
 		&unreviewed.Handler{
-			Doer:     kDoer,
 			PageSize: kPageSize,
 			LN:       ln,
 			Global:   global})
 	mux.Handle(
 		"/fin/upload",
-		&upload.Handler{Doer: kDoer, LN: ln, Global: global})
+		&upload.Handler{LN: ln, Global: global})
+	if ln.Backup {
+		mux.Handle(
+			"/fin/backup",
+			&backup.Handler{
+				Databases: backupDatabases,
+				Dir:       fBackupDir,
+				Keep:      fBackupKeep,
+				Clock:     kClock,
+				LN:        ln,
+				Global:    global})
+	}
 	mux.Handle(
 		"/fin/acname",
-		&ac.Handler{
-			Store: kReadOnlyStore,
-			Field: func(e fin.Entry) string { return e.Name }})
+		&ac.Handler{Field: func(e fin.Entry) string { return e.Name }})
 	mux.Handle(
 		"/fin/acdesc",
-		&ac.Handler{
-			Store: kReadOnlyStore,
-			Field: func(e fin.Entry) string { return e.Desc }})
+		&ac.Handler{Field: func(e fin.Entry) string { return e.Desc }})
+	mux.Handle("/fin/switchbook", &switchbook.Handler{})
 
 	defaultHandler := context.ClearHandler(
 		weblogs.HandlerWithOptions(
@@ -260,8 +348,27 @@ func main() {
 	}
 }
 
+// store is what ledger uses the main store for directly.
+type store interface {
+	login.Store
+	chpasswd.UserStore
+	apitokens.Store
+	findb.LoginApiTokenRunner
+}
+
+// readOnlyStore is what the read only handlers need from the store.
+type readOnlyStore interface {
+	list.Store
+	account.Store
+	findb.ActiveAccountsRunner
+	findb.UserByIdRunner
+}
+
 type authHandler struct {
-	*http.ServeMux
+	http.Handler
+	// If true, authHandler replies with 401 Unauthorized instead of
+	// redirecting to the login page.
+	api bool
 }
 
 func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -270,7 +377,31 @@ func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http_util.ReportError(w, "Error reading database.", err)
 		return
 	}
-	if session.User == nil || !setupStores(session) {
+	if h.api {
+		if secret, found := bearerToken(r); found {
+			if err := loginApiToken(session, secret); err != nil {
+				if err == findb.NoSuchId {
+					api.Unauthorized(w)
+				} else {
+					http_util.ReportError(w, "Error reading database.", err)
+				}
+				return
+			}
+		}
+	}
+	ok := false
+	if session.User != nil {
+		ok, err = setupStores(session)
+		if err != nil {
+			http_util.ReportError(w, "Error reading database.", err)
+			return
+		}
+	}
+	if !ok && h.api {
+		api.Unauthorized(w)
+		return
+	}
+	if !ok {
 		redirectString := r.URL.String()
 		// Never have login page redirect to logout page.
 		if redirectString == "/fin/logout" {
@@ -282,8 +413,41 @@ func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http_util.NewUrl("/auth/login", "prev", redirectString).String())
 		return
 	}
+	if !h.api && fPopularityLookback > 0 && session.CatPopularity() == nil {
+		builder := consumers.NewCatPopularityBuilder(fPopularityLookback)
+		session.Store.(findb.EntriesRunner).Entries(nil, nil, builder)
+		session.SetCatPopularity(builder.Build())
+		session.Save(r, w)
+	}
 	logging.SetUserName(r, session.User.Name)
-	h.ServeMux.ServeHTTP(w, r)
+	h.Handler.ServeHTTP(w, r)
+}
+
+// bearerToken returns the API token secret in the Authorization header
+// of r.
+func bearerToken(r *http.Request) (secret string, found bool) {
+	scheme, secret, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(secret), true
+}
+
+// loginApiToken logs in the user of the API token with secret for the
+// current request only. loginApiToken returns findb.NoSuchId if there is
+// no such token.
+func loginApiToken(session *common.UserSession, secret string) error {
+	var token fin.ApiToken
+	var user fin.User
+	err := kDoer.Do(func(t db.Transaction) error {
+		return findb.LoginApiToken(t, kStore, secret, kClock.Now(), &token, &user)
+	})
+	if err != nil {
+		return err
+	}
+	session.User = &user
+	session.ApiToken = &token
+	return nil
 }
 
 func rootRedirect(w http.ResponseWriter, r *http.Request) {
@@ -299,6 +463,13 @@ func init() {
 	flag.StringVar(&fSSLKey, "ssl_key", "", "SSL Key file")
 	flag.StringVar(&fPort, "http", ":8080", "Port to bind")
 	flag.StringVar(&fDb, "db", "", "Path to database file")
+	flag.StringVar(
+		&fBookName, "book", "Main", "Name of the book in -db when there is no -books file")
+	flag.StringVar(
+		&fBooks,
+		"books",
+		"",
+		"YAML file listing the books to serve with their database files and user permissions")
 	flag.StringVar(&fIcon, "icon", "", "Path to icon file")
 	flag.StringVar(&fTitle, "title", "Finances", "Application title")
 	flag.StringVar(&fGmailConfig, "gmail_config", "", "Gmail config file path")
@@ -309,49 +480,219 @@ func init() {
 		200,
 		"Number of entries to look back to find most popular categories")
 	flag.BoolVar(&fNoWifi, "nowifi", false, "Run in nowifi mode")
+	flag.BoolVar(
+		&fDemo,
+		"demo",
+		false,
+		"Run on sample data kept in memory instead of a database file")
+	flag.BoolVar(
+		&fMigrate,
+		"migrate",
+		false,
+		"Back up the database file, bring its schema up to date, and exit")
+	flag.StringVar(
+		&fBaseCurrency,
+		"base_currency",
+		"USD",
+		"Currency reports total in when -fx_rates is given")
+	flag.StringVar(
+		&fFXRates,
+		"fx_rates",
+		"",
+		"Exchange rate file mapping each currency to its value in base currency")
+	flag.StringVar(
+		&fFXCSV,
+		"fx_csv",
+		"",
+		"CSV file of dated exchange rates to add to the database")
+	flag.StringVar(
+		&fBackupDir,
+		"backup_dir",
+		"",
+		"Directory for database snapshots taken from the Backups page")
+	flag.IntVar(
+		&fBackupKeep,
+		"backup_keep",
+		14,
+		"Number of database snapshots to keep in -backup_dir")
+	flag.IntVar(
+		&fTrashDays,
+		"trash_days",
+		30,
+		"Default age in days of items the Trash page purges")
+	flag.StringVar(
+		&fCsvProfiles,
+		"csv_profiles",
+		"",
+		"YAML file describing the csv files of other banks")
 }
 
 func setupDb(filepath string) {
+	first := openBook(0, fBookName, filepath)
+	kBooks = []*book{first}
+	dbase := sqlite3_db.New(first.rawDb)
+	store := for_sqlite.New(dbase).WithClock(kClock)
+	kDoer = first.doer
+	kStore = store
+	kReadOnlyStore = for_sqlite.ReadOnlyWrapper(store)
+	kFXStore = first.fxStore
+}
+
+// setupBooks replaces the book in -db with the books in the -books file.
+// The -books file may list the database in -db as one of its books.
+// Users in the users table still need read or all permission to log in.
+func setupBooks(configPath string) {
+	configs, err := readBooksConfig(configPath)
+	if err != nil {
+		log.Fatalf("Error reading books file: %v", err)
+	}
+	first := kBooks[0]
+	kBooks = nil
+	for _, config := range configs {
+		permissions, err := config.permissions()
+		if err != nil {
+			log.Fatalf("Error reading books file: %v", err)
+		}
+		var b *book
+		if samePath(config.Db, first.path) {
+			// Share the caches of the database in -db.
+			shared := *first
+			b = &shared
+			b.Book = common.Book{Id: len(kBooks), Name: config.Name}
+		} else {
+			b = openBook(len(kBooks), config.Name, config.Db)
+		}
+		b.permissions = permissions
+		kBooks = append(kBooks, b)
+	}
+}
+
+func samePath(x, y string) bool {
+	xabs, xerr := filepath.Abs(x)
+	yabs, yerr := filepath.Abs(y)
+	return xerr == nil && yerr == nil && xabs == yabs
+}
+
+// openBook opens the sqlite database of a book.
+func openBook(id int, name, filepath string) *book {
 	rawdb, err := sql.Open("sqlite3", filepath)
 	if err != nil {
 		panic(err.Error())
 	}
 	dbase := sqlite3_db.New(rawdb)
-	qfxdata := qfxsqlite.New(dbase)
-	kDoer = sqlite3_db.NewDoer(dbase)
-	kCatDetailCache = csqlite.New(dbase)
-	kStore = for_sqlite.New(dbase)
+	err = dbase.Do(sqlite_setup.SetUpTables)
+	if err == sqlite_setup.SchemaOutOfDate {
+		log.Fatalf(
+			"Database schema of %s is out of date. Run ledger -migrate -db %s first.",
+			filepath,
+			filepath)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	cache := csqlite.New(dbase)
+	store := for_sqlite.New(dbase).WithClock(kClock)
+	result := &book{
+		Book:                   common.Book{Id: id, Name: name},
+		rawDb:                  rawdb,
+		path:                   filepath,
+		doer:                   sqlite3_db.NewDoer(dbase),
+		catDetailCache:         cache,
+		readOnlyCatDetailCache: csqlite.ReadOnlyWrapper(cache),
+		readOnlyStore:          for_sqlite.ReadOnlyWrapper(store),
+		fxStore:                fxsqlite.New(dbase),
+		storeForUser: func(userId int64) interface{} {
+			return store.WithUser(userId)
+		},
+		scopedStore: func(
+			user *fin.User,
+			permission fin.Permission,
+			accountIds []int64) (interface{}, categoriesdb.Getter, error) {
+			var rules []fin.AccessRule
+			err := store.AccessRulesByUserName(
+				nil, user.Name, consume2.AppendTo(&rules))
+			if err != nil {
+				return nil, nil, err
+			}
+			rules = limitRules(user.Name, rules, accountIds)
+			if len(rules) == 0 {
+				return nil, nil, nil
+			}
+			var scoped for_sqlite.ScopedStore
+			if permission != fin.AllPermission {
+				scoped = for_sqlite.ReadOnlyScopedWrapper(store, cache, rules)
+			} else {
+				scoped = for_sqlite.ScopedWrapper(
+					store.WithUser(user.Id), cache, rules)
+			}
+			return scoped, scoped.Cache(), nil
+		},
+	}
+	result.setupUploaders(qfxsqlite.New(dbase))
+	return result
+}
+
+// migrateDb backs up the database file at filepath and then applies any
+// pending schema migrations.
+func migrateDb(filepath string) {
+	rawdb, err := sql.Open("sqlite3", filepath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rawdb.Close()
+	backupPath, err := sqlite_setup.BackupAndMigrate(rawdb, filepath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if backupPath == "" {
+		fmt.Println("Database schema is already up to date.")
+		return
+	}
+	fmt.Printf(
+		"Migrated database to schema version %d. Backup is in %s\n",
+		sqlite_setup.LatestSchemaVersion(),
+		backupPath)
+}
+
+// setupUploaders sets up the file loaders that read and write qfxdata.
+// The category caches of the book must already be set up.
+func (b *book) setupUploaders(qfxdata qfxdb.Store) {
 	qfxLoader := qfx.QFXLoader{Store: qfxdata}
-	csvLoader := csv.CsvLoader{Store: qfxdata}
-	kUploaders = map[string]autoimport.Loader{
-		".qfx": qfxLoader,
-		".ofx": qfxLoader,
-		".csv": csvLoader}
-	kReadOnlyCatDetailCache = csqlite.ReadOnlyWrapper(kCatDetailCache)
-	kReadOnlyStore = for_sqlite.ReadOnlyWrapper(kStore)
+	csvLoader := csv.CsvLoader{Store: qfxdata, Profiles: kCsvProfiles}
+	qifLoader := qif.QIFLoader{Store: qfxdata, Cache: b.catDetailCache}
+	camtLoader := camt.CamtLoader{Store: qfxdata}
+	mt940Loader := mt940.MT940Loader{Store: qfxdata}
+	b.uploaders = newRegistry(
+		qfxLoader, csvLoader, qifLoader, camtLoader, mt940Loader)
 	readOnlyQFXLoader := qfx.QFXLoader{Store: qfxdb.ReadOnlyWrapper(qfxdata)}
-	readOnlyCsvLoader := csv.CsvLoader{Store: qfxdb.ReadOnlyWrapper(qfxdata)}
-	kReadOnlyUploaders = map[string]autoimport.Loader{
-		".qfx": readOnlyQFXLoader,
-		".ofx": readOnlyQFXLoader,
-		".csv": readOnlyCsvLoader}
+	readOnlyCsvLoader := csv.CsvLoader{
+		Store:    qfxdb.ReadOnlyWrapper(qfxdata),
+		Profiles: kCsvProfiles}
+	readOnlyQIFLoader := qif.QIFLoader{
+		Store: qfxdb.ReadOnlyWrapper(qfxdata),
+		Cache: b.readOnlyCatDetailCache}
+	readOnlyCamtLoader := camt.CamtLoader{Store: qfxdb.ReadOnlyWrapper(qfxdata)}
+	readOnlyMT940Loader := mt940.MT940Loader{
+		Store: qfxdb.ReadOnlyWrapper(qfxdata)}
+	b.readOnlyUploaders = newRegistry(
+		readOnlyQFXLoader,
+		readOnlyCsvLoader,
+		readOnlyQIFLoader,
+		readOnlyCamtLoader,
+		readOnlyMT940Loader)
 }
 
-func setupStores(session *common.UserSession) bool {
-	switch session.User.Permission {
-	case fin.AllPermission:
-		session.Store = kStore
-		session.Cache = kCatDetailCache
-		session.Uploaders = kUploaders
-		return true
-	case fin.ReadPermission:
-		session.Store = kReadOnlyStore
-		session.Cache = kReadOnlyCatDetailCache
-		session.Uploaders = kReadOnlyUploaders
-		return true
-	default:
-		return false
-	}
+// newRegistry returns the file formats that users may upload.
+func newRegistry(
+	qfxLoader, csvLoader, qifLoader, camtLoader,
+	mt940Loader autoimport.Loader) *autoimport.Registry {
+	result := &autoimport.Registry{}
+	result.Add("OFX", qfxLoader, ".qfx", ".ofx")
+	result.Add("QIF", qifLoader, ".qif")
+	result.Add("camt.053", camtLoader, ".xml")
+	result.Add("MT940", mt940Loader, ".sta", ".mt940")
+	result.Add("CSV", csvLoader, ".csv")
+	return result
 }
 
 type gmailConfigType struct {
@@ -389,6 +730,119 @@ func readGmailConfig(fileName string) (*gmailConfigType, error) {
 	return &result, nil
 }
 
+func readFXRates(fileName string) (fin.FixedRates, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var content bytes.Buffer
+	if _, err := content.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	var rates map[string]float64
+	if err := yaml.Unmarshal(content.Bytes(), &rates); err != nil {
+		return nil, err
+	}
+	result := make(fin.FixedRates, len(rates))
+	for name, rate := range rates {
+		currency, err := fin.ParseCurrency(name)
+		if err != nil {
+			return nil, err
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("rate for %s must be positive", currency)
+		}
+		result[currency] = rate
+	}
+	return result, nil
+}
+
+// setupFX sets up how each book converts amounts to baseCurrency in
+// reports. If ratesPath is non-empty, every book uses the fixed rates in
+// that file. Otherwise setupFX first adds the rates in csvPath to the
+// database in -db, if csvPath is non-empty, and then each book uses the
+// dated rates in its own database. The rates in csvPath are in
+// baseCurrency. A database remembers the currency of its rates, so
+// setupFX refuses to add rates in a different currency, and a later
+// change of baseCurrency converts through the currency of the stored
+// rates. Books without exchange rates do no conversion.
+func setupFX(baseCurrency, ratesPath, csvPath string) {
+	base, err := fin.ParseCurrency(baseCurrency)
+	if err != nil {
+		log.Fatalf("Error reading base currency: %v", err)
+	}
+	if ratesPath != "" {
+		rates, err := readFXRates(ratesPath)
+		if err != nil {
+			log.Fatalf("Error reading exchange rate file: %v", err)
+		}
+		rates[base] = 1.0
+		fixed := &common.FX{Base: base, Rates: rates}
+		for _, b := range kBooks {
+			b.fx = fixed
+		}
+		return
+	}
+	if csvPath != "" {
+		if err := importFXCSV(csvPath, base); err != nil {
+			log.Fatalf("Error importing exchange rate file: %v", err)
+		}
+	}
+	for _, b := range kBooks {
+		if b.fx, err = readFX(b.fxStore, base); err != nil {
+			log.Fatalf("Error reading exchange rates of %s: %v", b.Name, err)
+		}
+	}
+}
+
+// readFX returns how to convert amounts to base using the dated rates
+// in store. readFX returns nil if store has no rates.
+func readFX(store fx.Store, base fin.Currency) (*common.FX, error) {
+	table, err := fx.ReadTable(nil, store)
+	if err != nil {
+		return nil, err
+	}
+	if table.Empty() {
+		return nil, nil
+	}
+	if table.Reference() != base {
+		fmt.Printf(
+			"Exchange rates are in %s; converting to %s through %s.\n",
+			table.Reference(), base, table.Reference())
+	}
+	return &common.FX{Base: base, Rates: table}, nil
+}
+
+// importFXCSV adds the exchange rates in fileName, which are in base, to
+// the database.
+func importFXCSV(fileName string, base fin.Currency) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rates, err := fx.ReadCSV(f)
+	if err != nil {
+		return err
+	}
+	return kDoer.Do(func(t db.Transaction) error {
+		return fx.AddRates(t, kFXStore, base, rates)
+	})
+}
+
+func setupCsvProfiles(profilesPath string) {
+	f, err := os.Open(profilesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	kCsvProfiles, err = csv.ReadProfiles(f)
+	if err != nil {
+		log.Fatalf("Error reading csv profiles: %v", err)
+	}
+}
+
 func setupGmail(configPath string) {
 	gmailConfig, err := readGmailConfig(configPath)
 	if err != nil {
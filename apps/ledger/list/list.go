@@ -13,7 +13,6 @@ import (
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/aggregators"
 	"github.com/keep94/finances/fin/categories"
-	"github.com/keep94/finances/fin/categories/categoriesdb"
 	"github.com/keep94/finances/fin/consumers"
 	"github.com/keep94/finances/fin/envelopes"
 	"github.com/keep94/finances/fin/filters"
@@ -23,7 +22,8 @@ import (
 )
 
 const (
-	kPageParam = "pageNo"
+	kPageParam      = "pageNo"
+	kPageTokenParam = "pt"
 )
 
 var (
@@ -135,6 +135,12 @@ body {
           <div id="descContainer"></div>
         </div>
       </td>
+      <td>Tag: </td>
+      <td><input type="text" name="tag" value="{{.Get "tag"}}"></td>
+    </tr>
+    <tr>
+      <td>Text: </td>
+      <td><input type="text" name="q" value="{{.Get "q"}}"></td>
     </tr>
   </table>
 <input type="submit" value="Search">
@@ -170,7 +176,7 @@ Page: {{.DisplayPageNo}}&nbsp;
         <td>
           {{if .CheckNo}}{{.CheckNo}}{{else}}&nbsp;{{end}}
         </td>
-        <td colspan=4>{{.Desc}}</td>
+        <td colspan=4>{{.Desc}}{{with .Tags}} [{{FormatTags .}}]{{end}}</td>
       </tr>
   {{end}}
   </table>
@@ -204,12 +210,11 @@ var (
 
 type Store interface {
 	findb.EntriesRunner
+	findb.SearchEntriesRunner
 	findb.AllocationsByYearRunner
 }
 
 type Handler struct {
-	Cdc      categoriesdb.Getter
-	Store    Store
 	PageSize int
 	Links    bool
 	LN       *common.LeftNav
@@ -217,6 +222,9 @@ type Handler struct {
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	cdc := session.Cache
 	r.ParseForm()
 	selecter := common.SelectSearch()
 	leftnav := h.LN.Generate(w, r, selecter)
@@ -228,10 +236,10 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		pageNo = 0
 	}
 	envelopeYear, _ := strconv.ParseInt(r.Form.Get("eyear"), 10, 64)
-	cds, _ := h.Cdc.Get(nil)
+	cds, _ := cdc.Get(nil)
 	var creater creater
 	if envelopeYear > 0 {
-		catset, err := envelopes.CatSetByYear(nil, h.Store, envelopeYear)
+		catset, err := envelopes.CatSetByYear(nil, store, envelopeYear)
 		if err != nil {
 			http_util.ReportError(w, "Error reading envelopes.", err)
 			return
@@ -239,19 +247,66 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		creater.EnvelopeCatSet = catset
 	}
 	filter := creater.CreateFilterer(r.Form, cds)
-	elo := creater.CreateEntryListOptions(r.Form)
+	elo := creater.CreateEntryListOptions(r.Form, cds)
 
 	var totaler *aggregators.Totaler
-	pager := consume2.NewPageBuilder[fin.Entry](pageNo, h.PageSize)
 	if filter != nil && elo.Start != nil {
 		totaler = &aggregators.Totaler{}
 	}
-	err := h.Store.Entries(nil, elo, buildConsumer(pager, filter, totaler))
+	q := r.Form.Get("q")
+	token := r.Form.Get(kPageTokenParam)
+	var entries []fin.Entry
+	var morePages bool
+	var nextToken string
+	errorMessage := creater.ErrorMessage
+	var err error
+	if q == "" && token != "" {
+		var pager *findb.EntryPager
+		pager, err = findb.NewEntryPager(token, h.PageSize)
+		if err != nil {
+			http_util.Error(w, http.StatusBadRequest)
+			return
+		}
+		// The total covers every page, so only skip the earlier pages
+		// when there is no total.
+		if totaler == nil {
+			elo.After = pager.After()
+			if !creater.FilterNarrows {
+				elo.Limit = h.PageSize + 1
+			}
+		}
+		err = store.Entries(nil, elo, buildConsumer(pager, filter, totaler))
+		entries, nextToken = pager.Build()
+		morePages = nextToken != ""
+	} else {
+		pager := consume2.NewPageBuilder[fin.Entry](pageNo, h.PageSize)
+		if totaler == nil && !creater.FilterNarrows {
+			// The pager needs one entry past the page to know if there are
+			// more pages.
+			elo.Limit = (pageNo+1)*h.PageSize + 1
+		}
+		consumer := buildConsumer(pager, filter, totaler)
+		if q != "" {
+			// Matches come best first, so later pages can only be found
+			// by page number.
+			err = store.SearchEntries(nil, q, elo, consumer)
+			if err == findb.NoSearchIndex {
+				errorMessage = "Text search is not available for this database."
+				err = nil
+			}
+		} else {
+			err = store.Entries(nil, elo, consumer)
+		}
+		entries, morePages = pager.Build()
+		if q == "" && morePages {
+			nextToken = findb.EncodePageToken(
+				findb.CursorOf(&entries[len(entries)-1]))
+		}
+	}
 	if err != nil {
 		http_util.ReportError(w, "Error reading database.", err)
 		return
 	}
-	entries, morePages := pager.Build()
 	var listEntriesUrl *url.URL
 	if h.Links {
 		listEntriesUrl = r.URL
@@ -260,18 +315,21 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w,
 		kTemplate,
 		&view{
-			http_util.PageBreadCrumb{
-				URL:         r.URL,
-				PageNoParam: kPageParam,
-				PageNo:      pageNo,
-				End:         !morePages},
+			common.PageTokenBreadCrumb{
+				PageBreadCrumb: http_util.PageBreadCrumb{
+					URL:         r.URL,
+					PageNoParam: kPageParam,
+					PageNo:      pageNo,
+					End:         !morePages},
+				TokenParam: kPageTokenParam,
+				NextToken:  nextToken},
 			entries,
 			totaler,
 			http_util.Values{Values: r.Form},
 			common.CatDisplayer{CatDetailStore: cds},
 			common.CatLinker{ListEntries: listEntriesUrl, Cds: cds},
 			common.EntryLinker{URL: r.URL, Sel: selecter},
-			creater.ErrorMessage,
+			errorMessage,
 			leftnav,
 			h.Global})
 }
@@ -294,17 +352,49 @@ func buildConsumer(
 type creater struct {
 	EnvelopeCatSet fin.CatSet
 	ErrorMessage   string
+	// FilterNarrows is true if the filterer from CreateFilterer can
+	// reject entries that the options from CreateEntryListOptions select.
+	FilterNarrows bool
 }
 
+// CreateEntryListOptions returns the options for fetching the entries
+// that the filterer from CreateFilterer might accept. The filterer is
+// still needed because it also trims entries down to the matching
+// account and categories.
 func (c *creater) CreateEntryListOptions(
-	values url.Values) *findb.EntryListOptions {
+	values url.Values, cds categories.CatDetailStore) *findb.EntryListOptions {
 	sdPtr, sderr := getDateRelaxed(values, "sd")
 	edPtr, ederr := getDateRelaxed(values, "ed")
 	if sderr != nil || ederr != nil {
 		c.ErrorMessage = "Start and end date must be in yyyyMMdd format."
 		return &findb.EntryListOptions{}
 	}
-	return &findb.EntryListOptions{Start: sdPtr, End: edPtr}
+	result := &findb.EntryListOptions{
+		Start: sdPtr,
+		End:   edPtr,
+		Name:  values.Get("name"),
+		Desc:  values.Get("desc"),
+		Tag:   strings.TrimSpace(values.Get("tag"))}
+	result.AccountId, _ = strconv.ParseInt(values.Get("acctId"), 10, 64)
+	cat, caterr := fin.CatFromString(values.Get("cat"))
+	// Top level categories match categories that cds may not know about,
+	// and they barely narrow the search anyway.
+	if caterr == nil && !(cat.Id == 0 && values.Get("top") == "") {
+		result.Cats = cds.MatchingCats(c.createCatFilter(values, cds))
+		result.Cats[cat] = struct{}{}
+	}
+	if rangeStr := values.Get("range"); rangeStr != "" {
+		minTotal, maxTotal, ok := parseRange(rangeStr)
+		// The filterer compares amounts after trimming entries down to
+		// the matching account and categories.
+		if ok && result.AccountId == 0 && caterr != nil {
+			result.MinTotal = minTotal
+			result.MaxTotal = maxTotal
+		} else {
+			c.FilterNarrows = true
+		}
+	}
+	return result
 }
 
 func (c *creater) CreateFilterer(
@@ -314,13 +404,15 @@ func (c *creater) CreateFilterer(
 	amtFilter := c.createAmountFilter(values.Get("range"))
 	name := values.Get("name")
 	desc := values.Get("desc")
-	if amtFilter != nil || filt != nil || accountId != 0 || name != "" || desc != "" {
+	tag := strings.TrimSpace(values.Get("tag"))
+	if amtFilter != nil || filt != nil || accountId != 0 || name != "" || desc != "" || tag != "" {
 		return filters.CompileAdvanceSearchSpec(&filters.AdvanceSearchSpec{
 			CF:        filt,
 			AF:        amtFilter,
 			AccountId: accountId,
 			Name:      name,
-			Desc:      desc})
+			Desc:      desc,
+			Tag:       tag})
 	}
 	return nil
 }
@@ -347,7 +439,7 @@ func (c *creater) createCatFilter(
 }
 
 type view struct {
-	http_util.PageBreadCrumb
+	common.PageTokenBreadCrumb
 	Entries []fin.Entry
 	*aggregators.Totaler
 	http_util.Values
@@ -372,6 +464,24 @@ func getDateRelaxed(values url.Values, key string) (*time.Time, error) {
 }
 
 func compileRangeFilter(expr string) filters.AmountFilter {
+	minTotal, maxTotal, ok := parseRange(expr)
+	if !ok {
+		return nil
+	}
+	return func(amt int64) bool {
+		if minTotal != nil && amt < *minTotal {
+			return false
+		}
+		return maxTotal == nil || amt <= *maxTotal
+	}
+}
+
+// parseRange parses a range of amounts such as "12.34 to 56.78" into the
+// bounds on entry totals that match it. Since expenses have negative
+// totals, "12.34 to 56.78" means totals from -56.78 to -12.34. Either
+// end of the range may be omitted. A single amount matches just that
+// amount.
+func parseRange(expr string) (minTotal, maxTotal *int64, ok bool) {
 	expr = strings.ToLower(expr)
 	parts := strings.SplitN(expr, "to", 2)
 	for i := range parts {
@@ -380,44 +490,31 @@ func compileRangeFilter(expr string) filters.AmountFilter {
 	if len(parts) == 1 {
 		neededAmount, err := fin.ParseUSD(parts[0])
 		if err != nil {
-			return nil
-		}
-		return func(amt int64) bool {
-			return amt == -neededAmount
+			return nil, nil, false
 		}
+		total := -neededAmount
+		return &total, &total, true
 	}
-	if parts[0] != "" && parts[1] != "" {
-		lower, err := fin.ParseUSD(parts[0])
-		if err != nil {
-			return nil
-		}
-		upper, err := fin.ParseUSD(parts[1])
-		if err != nil {
-			return nil
-		}
-		return func(amt int64) bool {
-			return amt >= -upper && amt <= -lower
-		}
+	if parts[0] == "" && parts[1] == "" {
+		return nil, nil, false
 	}
 	if parts[0] != "" {
 		lower, err := fin.ParseUSD(parts[0])
 		if err != nil {
-			return nil
-		}
-		return func(amt int64) bool {
-			return amt <= -lower
+			return nil, nil, false
 		}
+		total := -lower
+		maxTotal = &total
 	}
 	if parts[1] != "" {
 		upper, err := fin.ParseUSD(parts[1])
 		if err != nil {
-			return nil
-		}
-		return func(amt int64) bool {
-			return amt >= -upper
+			return nil, nil, false
 		}
+		total := -upper
+		minTotal = &total
 	}
-	return nil
+	return minTotal, maxTotal, true
 }
 
 func init() {
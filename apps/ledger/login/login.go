@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/fin"
-	"github.com/keep94/finances/fin/consumers"
 	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/sessions"
 	"github.com/keep94/toolbox/db"
@@ -63,18 +62,16 @@ type Sender interface {
 
 type Store interface {
 	findb.UpdateUserByNameRunner
-	findb.EntriesRunner
 }
 
 type Handler struct {
-	Doer               db.Doer
-	SessionStore       sessions.Store
-	Store              Store
-	LO                 *lockout.Lockout
-	Mailer             Sender
-	Recipients         []string
-	PopularityLookback int
-	Global             *common.Global
+	Doer         db.Doer
+	SessionStore sessions.Store
+	Store        Store
+	LO           *lockout.Lockout
+	Mailer       Sender
+	Recipients   []string
+	Global       *common.Global
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -120,11 +117,6 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if !user.LastLogin.IsZero() {
 			session.SetLastLogin(user.LastLogin)
 		}
-		if h.PopularityLookback > 0 {
-			builder := consumers.NewCatPopularityBuilder(h.PopularityLookback)
-			h.Store.Entries(nil, nil, builder)
-			session.SetCatPopularity(builder.Build())
-		}
 		session.ID = "" // For added security, force a new session ID
 		session.Save(r, w)
 		prev := r.Form.Get("prev")
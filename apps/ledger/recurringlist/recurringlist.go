@@ -6,7 +6,6 @@ import (
 	"github.com/keep94/consume2"
 	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/fin"
-	"github.com/keep94/finances/fin/categories/categoriesdb"
 	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/db"
@@ -111,8 +110,6 @@ type Store interface {
 }
 
 type Handler struct {
-	Cdc    categoriesdb.Getter
-	Doer   db.Doer
 	Clock  date_util.Clock
 	LN     *common.LeftNav
 	Global *common.Global
@@ -130,6 +127,8 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	session := common.GetUserSession(r)
+	cdc := session.Cache
+	doer := session.Doer
 	store := session.Store.(Store)
 	var postErr error
 	var message string
@@ -138,12 +137,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if !common.VerifyXsrfToken(r, kRecurringList) {
 			postErr = common.ErrXsrf
 		} else if rid == 0 {
-			message, postErr = h.applyRecurringEntries(store, acctId)
+			message, postErr = h.applyRecurringEntries(doer, store, acctId)
 		} else if http_util.HasParam(r.Form, "skip") {
-			message, postErr = h.skipEntry(store, rid)
+			message, postErr = h.skipEntry(doer, store, rid)
 		} else if http_util.HasParam(r.Form, "apply") {
 			var newEntryId int64
-			newEntryId, postErr = h.applyEntry(store, rid)
+			newEntryId, postErr = h.applyEntry(doer, store, rid)
 			if postErr == nil {
 				newEntryUrl := http_util.NewUrl(
 					"/fin/single",
@@ -155,7 +154,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-	cds, _ := h.Cdc.Get(nil)
+	cds, _ := cdc.Get(nil)
 	var account fin.Account
 	var entries []*fin.RecurringEntry
 	var count int
@@ -169,7 +168,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return entry, ok
 			})
 	}
-	err := h.Doer.Do(func(t db.Transaction) error {
+	err := doer.Do(func(t db.Transaction) error {
 		if acctId > 0 {
 			err := store.AccountById(t, acctId, &account)
 			if err != nil {
@@ -218,10 +217,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) applyRecurringEntries(
+	doer db.Doer,
 	store findb.RecurringEntriesApplier,
 	acctId int64) (message string, err error) {
 	var count int
-	err = h.Doer.Do(func(t db.Transaction) error {
+	err = doer.Do(func(t db.Transaction) error {
 		var err error
 		count, err = findb.ApplyRecurringEntries(
 			t, store, acctId, date_util.TimeToDate(h.Clock.Now()))
@@ -234,10 +234,11 @@ func (h *Handler) applyRecurringEntries(
 }
 
 func (h *Handler) skipEntry(
+	doer db.Doer,
 	store findb.RecurringEntrySkipper,
 	rid int64) (message string, err error) {
 	var skipped bool
-	err = h.Doer.Do(func(t db.Transaction) error {
+	err = doer.Do(func(t db.Transaction) error {
 		var err error
 		skipped, err = findb.SkipRecurringEntry(t, store, rid)
 		return err
@@ -251,9 +252,10 @@ func (h *Handler) skipEntry(
 }
 
 func (h *Handler) applyEntry(
+	doer db.Doer,
 	store findb.RecurringEntryApplier,
 	rid int64) (newEntryId int64, err error) {
-	err = h.Doer.Do(func(t db.Transaction) error {
+	err = doer.Do(func(t db.Transaction) error {
 		var err error
 		newEntryId, err = findb.ApplyRecurringEntry(t, store, rid)
 		return err
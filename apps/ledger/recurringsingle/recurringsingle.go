@@ -115,6 +115,10 @@ body {
       </div>
     </td>
   </tr>
+  <tr>
+    <td align="right">Tags: </td>
+    <td><input type="text" name="tags" value="{{.Get "tags"}}"></td>
+  </tr>
   <tr>
     <td align="right">Period: </td>
     <td><input type="text" name="count" value="{{.Get "count"}}">&nbsp;
@@ -150,6 +154,10 @@ body {
       <input type="checkbox" name="reconciled" {{if .Get "reconciled"}}checked{{end}}>
     </td>
   </tr>
+  <tr>
+    <td>Rate: </td>
+    <td><input type="text" name="rate" value="{{.Get "rate"}}" size="12">&nbsp;(blank if all accounts use the same currency)</td>
+  </tr>
 </table>
 <table>
 {{with $top := .}}
@@ -218,7 +226,6 @@ type UpdateRecurringEntryRunner interface {
 }
 
 type Handler struct {
-	Doer   db.Doer
 	Clock  date_util.Clock
 	Global *common.Global
 	LN     *common.LeftNav
@@ -265,7 +272,7 @@ func (h *Handler) doPost(
 		if err == nil {
 			if isIdValid(id) {
 				tag, _ := strconv.ParseUint(r.Form.Get("etag"), 10, 64)
-				err = h.updateId(id, tag, mutation, store)
+				err = h.updateId(session.Doer, id, tag, mutation, store)
 			} else {
 				var entry fin.RecurringEntry
 				mutation(&entry)
@@ -317,6 +324,7 @@ func (h *Handler) doGet(
 	session *common.UserSession) {
 	store := session.Store.(Store)
 	cdc := session.Cache
+	doer := session.Doer
 	catPopularity := session.CatPopularity()
 	var v *view
 	leftnav := h.LN.Generate(w, r, selecter)
@@ -326,7 +334,7 @@ func (h *Handler) doGet(
 	if isIdValid(id) {
 		var entryWithEtag fin.RecurringEntry
 		var cds categories.CatDetailStore
-		err := h.Doer.Do(func(t db.Transaction) (err error) {
+		err := doer.Do(func(t db.Transaction) (err error) {
 			cds, err = cdc.Get(t)
 			if err != nil {
 				return
@@ -367,11 +375,12 @@ func (h *Handler) isDateReasonable(date time.Time) bool {
 }
 
 func (h *Handler) updateId(
+	doer db.Doer,
 	id int64,
 	tag uint64,
 	mutation fin.RecurringEntryUpdater,
 	store UpdateRecurringEntryRunner) error {
-	return h.Doer.Do(func(t db.Transaction) (err error) {
+	return doer.Do(func(t db.Transaction) (err error) {
 		var entryWithEtag fin.RecurringEntry
 		if err = store.RecurringEntryById(t, id, &entryWithEtag); err != nil {
 			return
@@ -3,10 +3,10 @@ package report
 import (
 	"errors"
 	"fmt"
+	"github.com/keep94/consume2"
 	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/categories"
-	"github.com/keep94/finances/fin/categories/categoriesdb"
 	"github.com/keep94/finances/fin/consumers"
 	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/toolbox/date_util"
@@ -16,6 +16,7 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -113,9 +114,11 @@ var (
           <td><input type="text" name="sd" value="{{.Get "sd"}}"></td>
           <td>End date: </td>
           <td><input type="text" name="ed" value="{{.Get "ed"}}"></td>
+          <td>Tag: </td>
+          <td><input type="text" name="tag" value="{{.Get "tag"}}"></td>
         </tr>
         <tr>
-          <td colspan="6">
+          <td colspan="8">
             <input type="submit" value="Generate report">
           </td>
         </tr>
@@ -128,8 +131,26 @@ var (
     {{else}}
       <h2>{{.Name}}</h2>
     {{end}}
+    {{with $.FX}}Amounts in {{.BaseCurrency}}<br>{{end}}
     {{template "Graph" .}}
   {{end}}
+{{end}}
+{{if .Tags}}
+    <h2>Tags</h2>
+    <table border=1>
+      <tr>
+        <td>Tag</td>
+        <td>Expenses</td>
+        <td>Income</td>
+      </tr>
+  {{range .Tags}}
+      <tr>
+        <td><a href="{{.Url}}">{{.Name}}</a></td>
+        <td align="right">{{FormatUSDRaw .Expense}}</td>
+        <td align="right">{{FormatUSDRaw .Income}}</td>
+      </tr>
+  {{end}}
+    </table>
 {{end}}
   </div>
   </body>
@@ -141,20 +162,21 @@ var (
 )
 
 type Handler struct {
-	Cdc    categoriesdb.Getter
-	Store  findb.EntriesRunner
 	LN     *common.LeftNav
 	Global *common.Global
 	NoWifi bool
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(findb.EntriesRunner)
+	cdc := session.Cache
 	r.ParseForm()
 	leftnav := h.LN.Generate(w, r, common.SelectReports())
 	if leftnav == "" {
 		return
 	}
-	cds, _ := h.Cdc.Get(nil)
+	cds, _ := cdc.Get(nil)
 	start, end, err := getDateRange(r)
 	if err != nil {
 		v := &view{
@@ -170,19 +192,32 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	cat, caterr := fin.CatFromString(r.Form.Get("cat"))
 	ct := make(fin.CatTotals)
-	erc := consumers.FromCatPaymentAggregator(ct)
-	elo := findb.EntryListOptions{Start: &start, End: &end}
-	err = h.Store.Entries(nil, &elo, erc)
+	tt := make(fin.TagTotals)
+	var fxErr error
+	erc := consumers.ToBaseCurrency(
+		consume2.Compose(
+			consumers.FromCatPaymentAggregator(ct),
+			consumers.FromEntryAggregator(tt)),
+		session.FX.Converter(cds),
+		&fxErr)
+	tag := strings.TrimSpace(r.Form.Get("tag"))
+	elo := findb.EntryListOptions{Start: &start, End: &end, Tag: tag}
+	err = store.Entries(nil, &elo, erc)
 	if err != nil {
 		http_util.ReportError(w, "Error reading database.", err)
 		return
 	}
+	if fxErr != nil {
+		http_util.ReportError(w, "Error converting currency.", fxErr)
+		return
+	}
 	rolledCt, children := cds.RollUp(ct)
 	builder := dataSetBuilder{
 		ListUrl: http_util.NewUrl(
 			"/fin/list",
 			"sd", r.Form.Get("sd"),
-			"ed", r.Form.Get("ed")),
+			"ed", r.Form.Get("ed"),
+			"tag", tag),
 		ReportUrl: r.URL,
 		Cds:       cds,
 		Unrolled:  ct,
@@ -209,9 +244,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Values:       http_util.Values{Values: r.Form},
 		CatDisplayer: common.CatDisplayer{CatDetailStore: cds},
 		Sets:         displaySets,
+		Tags:         tagRows(cds, tt, r.URL),
 		CatDetails:   cds.DetailsByIds(catsInDropDown),
 		LeftNav:      leftnav,
 		GraphCode:    graphCode,
+		FX:           session.FX,
 		Global:       h.Global}
 
 	http_util.WriteTemplate(w, kTemplate, v)
@@ -259,14 +296,40 @@ func (d *dataSet) RegisterGraph(graphs map[string]google_jsgraph.Graph) {
 	}
 }
 
+type tagRow struct {
+	Name    string
+	Url     *url.URL
+	Expense int64
+	Income  int64
+}
+
+func tagRows(
+	cds categories.CatDetailStore,
+	totals fin.TagTotals,
+	reportUrl *url.URL) []*tagRow {
+	tags := totals.Tags()
+	result := make([]*tagRow, len(tags))
+	for i, tag := range tags {
+		rolledUp, _ := cds.RollUp(totals[tag])
+		result[i] = &tagRow{
+			Name:    tag,
+			Url:     http_util.WithParams(reportUrl, "tag", tag),
+			Expense: rolledUp[fin.Expense],
+			Income:  -rolledUp[fin.Income]}
+	}
+	return result
+}
+
 type view struct {
 	http_util.Values
 	common.CatDisplayer
 	Sets       []*dataSet
+	Tags       []*tagRow
 	CatDetails []categories.CatDetail
 	Error      error
 	LeftNav    template.HTML
 	GraphCode  template.HTML
+	FX         *common.FX
 	Global     *common.Global
 }
 
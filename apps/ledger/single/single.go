@@ -2,6 +2,8 @@ package single
 
 import (
 	"fmt"
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/apps/ledger/attachment"
 	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/categories"
@@ -11,6 +13,7 @@ import (
 	"github.com/keep94/toolbox/http_util"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -109,6 +112,10 @@ body {
       </div>
     </td>
   </tr>
+  <tr>
+    <td align="right">Tags: </td>
+    <td><input type="text" name="tags" value="{{.Get "tags"}}"></td>
+  </tr>
   <tr>
     <td align="right">Check #: </td>
     <td><input type="text" name="checkno" value="{{.Get "checkno"}}"></td>
@@ -131,6 +138,10 @@ body {
       <input type="checkbox" name="reconciled" {{if .Get "reconciled"}}checked{{end}}>
     </td>
   </tr>
+  <tr>
+    <td>Rate: </td>
+    <td><input type="text" name="rate" value="{{.Get "rate"}}" size="12">&nbsp;(blank if all accounts use the same currency)</td>
+  </tr>
 </table>
 <table>
 {{with $top := .}}
@@ -160,6 +171,39 @@ body {
 <input type="submit" name="delete" value="Delete" onclick="return confirm('Are you sure you want to delete this entry?');">
 {{end}}
 </form>
+{{if .ExistingEntry}}
+<br>
+<a href="{{.HistoryLink}}">History</a>
+<h3>Attachments</h3>
+{{with $top := .}}
+{{if .Attachments}}
+<table>
+  {{range .Attachments}}
+  <tr>
+    <td><a href="/fin/attachment?id={{.Id}}">{{.Name}}</a></td>
+    <td>{{FormatDate .Added}}</td>
+    <td>{{.Size}} bytes</td>
+    <td>
+      <form method="post" action="/fin/attachment">
+        <input type="hidden" name="xsrf" value="{{$top.AttachmentXsrf}}">
+        <input type="hidden" name="remove" value="{{.Id}}">
+        <input type="hidden" name="prev" value="{{$top.Prev}}">
+        <input type="submit" value="Remove" onclick="return confirm('Are you sure you want to remove this attachment?');">
+      </form>
+    </td>
+  </tr>
+  {{end}}
+</table>
+{{end}}
+<form method="post" action="/fin/attachment" enctype="multipart/form-data">
+  <input type="hidden" name="xsrf" value="{{.AttachmentXsrf}}">
+  <input type="hidden" name="eid" value="{{.EntryId}}">
+  <input type="hidden" name="prev" value="{{.Prev}}">
+  <input type="file" name="contents">
+  <input type="submit" value="Attach">&nbsp;(PDF, JPEG, or PNG)
+</form>
+{{end}}
+{{end}}
 </div>
 
 <script type="text/javascript">
@@ -190,10 +234,18 @@ type Store interface {
 	findb.DoEntryChangesRunner
 	findb.EntryByIdRunner
 	findb.EntriesRunner
+	findb.AttachmentsByEntryIdRunner
+}
+
+type view struct {
+	*common.SingleEntryView
+	EntryId        int64
+	Prev           string
+	Attachments    []fin.Attachment
+	AttachmentXsrf string
 }
 
 type Handler struct {
-	Doer   db.Doer
 	Clock  date_util.Clock
 	Global *common.Global
 	LN     *common.LeftNav
@@ -267,18 +319,27 @@ func (h *Handler) doPost(
 		if leftnav == "" {
 			return
 		}
+		var attachments []fin.Attachment
+		if isIdValid(id) {
+			store.AttachmentsByEntryId(
+				nil, id, consume2.AppendTo(&attachments))
+		}
 		http_util.WriteTemplate(
 			w,
 			kTemplate,
-			common.ToSingleEntryViewFromForm(
-				isIdValid(id),
-				r.Form,
-				common.NewXsrfToken(r, kSingle),
-				cds,
-				catPopularity,
-				h.Global,
-				leftnav,
-				err))
+			newView(
+				r,
+				common.ToSingleEntryViewFromForm(
+					isIdValid(id),
+					r.Form,
+					common.NewXsrfToken(r, kSingle),
+					cds,
+					catPopularity,
+					h.Global,
+					leftnav,
+					err),
+				id,
+				attachments))
 	} else {
 		prev := r.Form.Get("prev")
 		if prev == "" {
@@ -302,15 +363,20 @@ func (h *Handler) doGet(
 		return
 	}
 	var v *common.SingleEntryView
+	var attachments []fin.Attachment
 	if isIdValid(id) {
 		var entryWithEtag fin.Entry
 		var cds categories.CatDetailStore
-		err := h.Doer.Do(func(t db.Transaction) (err error) {
+		err := session.Doer.Do(func(t db.Transaction) (err error) {
 			cds, err = cdc.Get(t)
 			if err != nil {
 				return
 			}
-			return store.EntryById(t, id, &entryWithEtag)
+			if err = store.EntryById(t, id, &entryWithEtag); err != nil {
+				return
+			}
+			return store.AttachmentsByEntryId(
+				t, id, consume2.AppendTo(&attachments))
 		})
 		if err == findb.NoSuchId {
 			fmt.Fprintln(w, "No entry found.")
@@ -339,7 +405,7 @@ func (h *Handler) doGet(
 			leftnav,
 			nil)
 	}
-	http_util.WriteTemplate(w, kTemplate, v)
+	http_util.WriteTemplate(w, kTemplate, newView(r, v, id, attachments))
 }
 
 func (h *Handler) isDateReasonable(date time.Time) bool {
@@ -348,6 +414,27 @@ func (h *Handler) isDateReasonable(date time.Time) bool {
 	return !(date.Before(oneMonthBefore) || date.After(currentDate))
 }
 
+func newView(
+	r *http.Request,
+	v *common.SingleEntryView,
+	id int64,
+	attachments []fin.Attachment) *view {
+	return &view{
+		SingleEntryView: v,
+		EntryId:         id,
+		Prev:            r.Form.Get("prev"),
+		Attachments:     attachments,
+		AttachmentXsrf:  attachment.NewXsrfToken(r)}
+}
+
+// HistoryLink returns the link to the history of this entry.
+func (v *view) HistoryLink() *url.URL {
+	return http_util.NewUrl(
+		"/fin/history",
+		"id", strconv.FormatInt(v.EntryId, 10),
+		"prev", v.Prev)
+}
+
 func isIdValid(id int64) bool {
 	return id > 0
 }
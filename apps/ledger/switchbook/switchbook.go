@@ -0,0 +1,33 @@
+package switchbook
+
+import (
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/toolbox/http_util"
+	"net/http"
+	"strconv"
+)
+
+// Handler switches the user to the book whose id is in the id parameter
+// and then shows the entries of that book. Since ids of entries and
+// accounts differ between books, Handler does not go back to the page the
+// user came from.
+type Handler struct {
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	session := common.GetUserSession(r)
+	if !common.VerifyXsrfToken(r, common.BookXsrfAction) {
+		http_util.Redirect(w, r, "/fin/list")
+		return
+	}
+	id, _ := strconv.Atoi(r.Form.Get("id"))
+	for _, book := range session.Books {
+		if book.Id == id {
+			session.SetBookId(id)
+			session.Save(r, w)
+			break
+		}
+	}
+	http_util.Redirect(w, r, "/fin/list")
+}
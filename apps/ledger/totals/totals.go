@@ -4,6 +4,7 @@ import (
 	"github.com/keep94/finances/apps/ledger/common"
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/http_util"
 	"html/template"
 	"net/http"
@@ -23,7 +24,7 @@ var (
 {{.LeftNav}}
 <div class="main">
 <h2>Totals</h2>
-Total: {{FormatUSD .Total}}<br><br>
+Total: {{FormatUSD .Total}}{{with .FX}} {{.BaseCurrency}}{{end}}<br><br>
 <table border=1>
   <tr>
     <td>Account</td>
@@ -33,7 +34,11 @@ Total: {{FormatUSD .Total}}<br><br>
   {{range .Accounts}}
     <tr>
       <td><a href="{{$top.AccountLink .Id}}">{{.Name}}</a></td>
+  {{if $top.FX}}
+      <td align="right">{{FormatCurrency .Balance .Currency}}</td>
+  {{else}}
       <td align="right">{{FormatUSD .Balance}}</td>
+  {{end}}
     </tr>
   {{end}}
 {{end}}
@@ -48,29 +53,43 @@ var (
 )
 
 type Handler struct {
-	Store  findb.ActiveAccountsRunner
+	Clock  date_util.Clock
 	LN     *common.LeftNav
 	Global *common.Global
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(findb.ActiveAccountsRunner)
 	leftnav := h.LN.Generate(w, r, common.SelectTotals())
 	if leftnav == "" {
 		return
 	}
-	accounts, err := h.Store.ActiveAccounts(nil)
+	accounts, err := store.ActiveAccounts(nil)
 	if err != nil {
 		http_util.ReportError(w, "Database error", err)
 		return
 	}
 	var total int64
+	fx := session.FX
 	for _, account := range accounts {
-		total += account.Balance
+		if fx == nil {
+			total += account.Balance
+			continue
+		}
+		rate, err := fx.Rates.Rate(
+			account.Currency, fx.BaseCurrency(), h.Clock.Now())
+		if err != nil {
+			http_util.ReportError(w, "Error converting currency.", err)
+			return
+		}
+		total += fin.ConvertAmount(account.Balance, rate)
 	}
 	http_util.WriteTemplate(w, kTemplate, &view{
 		Accounts: accounts,
 		Total:    total,
 		LeftNav:  leftnav,
+		FX:       fx,
 		Global:   h.Global,
 	})
 }
@@ -80,6 +99,7 @@ type view struct {
 	Accounts []*fin.Account
 	Total    int64
 	LeftNav  template.HTML
+	FX       *common.FX
 	Global   *common.Global
 }
 
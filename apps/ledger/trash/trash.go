@@ -0,0 +1,230 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/http_util"
+)
+
+const (
+	kTrash = "trash"
+)
+
+var (
+	errBadDays = errors.New("Days must be a non-negative number.")
+)
+
+var (
+	kTemplateSpec = `
+<html>
+<head>
+  <title>{{.Global.Title}}</title>
+  {{if .Global.Icon}}
+    <link rel="shortcut icon" href="/images/favicon.ico" type="image/x-icon" />
+  {{end}}
+  <link rel="stylesheet" type="text/css" href="/static/theme.css" />
+</head>
+<body>
+{{.LeftNav}}
+<div class="main">
+<h2>Trash</h2>
+{{if .Message}}
+  {{if .Success}}
+    <font color="#006600"><b>{{.Message}}</b></font>
+  {{else}}
+    <span class="error">{{.Message}}</span>
+  {{end}}
+  <br><br>
+{{end}}
+<form method="post">
+<input type="hidden" name="xsrf" value="{{.Xsrf}}">
+Permanently delete items in the trash more than
+<input type="text" name="days" value="{{.Days}}" size="4">
+days.
+<input type="submit" name="purge" value="Purge">
+</form>
+<h3>Entries</h3>
+<table>
+  <tr>
+    <td>Trashed</td>
+    <td>Date</td>
+    <td>Name</td>
+    <td align="right">Amount</td>
+    <td></td>
+  </tr>
+{{range .Entries}}
+  <tr class="lineitem">
+    <td>{{.Trashed.Local.Format "01/02/2006 15:04"}}</td>
+    <td>{{FormatDate .Date}}</td>
+    <td>{{.Name}}</td>
+    <td align="right">{{FormatUSD .Total}}</td>
+    <td>
+      <form method="post">
+        <input type="hidden" name="xsrf" value="{{$.Xsrf}}">
+        <input type="hidden" name="id" value="{{.Id}}">
+        <input type="submit" name="restore" value="Restore">
+      </form>
+    </td>
+  </tr>
+{{else}}
+  <tr><td colspan="5">No entries in the trash.</td></tr>
+{{end}}
+</table>
+<h3>Recurring entries</h3>
+<table>
+  <tr>
+    <td>Trashed</td>
+    <td>Next date</td>
+    <td>Name</td>
+    <td align="right">Amount</td>
+    <td></td>
+  </tr>
+{{range .RecurringEntries}}
+  <tr class="lineitem">
+    <td>{{.Trashed.Local.Format "01/02/2006 15:04"}}</td>
+    <td>{{FormatDate .Date}}</td>
+    <td>{{.Name}}</td>
+    <td align="right">{{FormatUSD .Total}}</td>
+    <td>
+      <form method="post">
+        <input type="hidden" name="xsrf" value="{{$.Xsrf}}">
+        <input type="hidden" name="rid" value="{{.Id}}">
+        <input type="submit" name="restore" value="Restore">
+      </form>
+    </td>
+  </tr>
+{{else}}
+  <tr><td colspan="5">No recurring entries in the trash.</td></tr>
+{{end}}
+</table>
+</div>
+</body>
+</html>`
+)
+
+var (
+	kTemplate *template.Template
+)
+
+// Store methods are from fin.Store
+type Store interface {
+	findb.TrashedEntriesRunner
+	findb.RestoreEntryRunner
+	findb.TrashedRecurringEntriesRunner
+	findb.RestoreRecurringEntryRunner
+	findb.PurgeTrashRunner
+}
+
+// Handler lists what is in the trash on GET. On POST, it restores an
+// entry or recurring entry from the trash or purges old items from it.
+type Handler struct {
+
+	// The default number of days items stay in the trash before a purge
+	// removes them.
+	Days int
+
+	Clock  date_util.Clock
+	LN     *common.LeftNav
+	Global *common.Global
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	session := common.GetUserSession(r)
+	store := session.Store.(Store)
+	v := &view{Days: h.Days}
+	if r.Method == "POST" {
+		var err error
+		if !common.VerifyXsrfToken(r, kTrash) {
+			err = common.ErrXsrf
+		} else if http_util.HasParam(r.Form, "purge") {
+			v.Message, err = h.purge(store, r.Form.Get("days"))
+		} else if http_util.HasParam(r.Form, "restore") {
+			v.Message, err = restore(store, r.Form)
+		}
+		switch err {
+		case nil:
+			v.Success = true
+		case findb.NoPermission:
+			v.Message = "Insufficient permission."
+		case findb.NoSuchId:
+			v.Message = "That item is no longer in the trash."
+		default:
+			v.Message = err.Error()
+		}
+	}
+	err := session.Doer.Do(func(t db.Transaction) error {
+		err := store.TrashedEntries(t, consume2.AppendTo(&v.Entries))
+		if err != nil {
+			return err
+		}
+		return store.TrashedRecurringEntries(
+			t, consume2.AppendTo(&v.RecurringEntries))
+	})
+	if err != nil {
+		http_util.ReportError(w, "Error reading database.", err)
+		return
+	}
+	leftnav := h.LN.Generate(w, r, common.SelectTrash())
+	if leftnav == "" {
+		return
+	}
+	v.Xsrf = common.NewXsrfToken(r, kTrash)
+	v.LeftNav = leftnav
+	v.Global = h.Global
+	http_util.WriteTemplate(w, kTemplate, v)
+}
+
+func (h *Handler) purge(
+	store findb.PurgeTrashRunner, daysStr string) (message string, err error) {
+	days, err := strconv.Atoi(daysStr)
+	if err != nil || days < 0 {
+		return "", errBadDays
+	}
+	count, err := store.PurgeTrash(
+		nil, h.Clock.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d items permanently deleted.", count), nil
+}
+
+func restore(store Store, form url.Values) (message string, err error) {
+	if rid, _ := strconv.ParseInt(form.Get("rid"), 10, 64); rid != 0 {
+		if err = store.RestoreRecurringEntry(nil, rid); err != nil {
+			return
+		}
+		return "Recurring entry restored.", nil
+	}
+	id, _ := strconv.ParseInt(form.Get("id"), 10, 64)
+	if err = store.RestoreEntry(nil, id); err != nil {
+		return
+	}
+	return "Entry restored.", nil
+}
+
+type view struct {
+	Entries          []fin.TrashedEntry
+	RecurringEntries []fin.TrashedRecurringEntry
+	Days             int
+	Message          string
+	Success          bool
+	Xsrf             string
+	LeftNav          template.HTML
+	Global           *common.Global
+}
+
+func init() {
+	kTemplate = common.NewTemplate("trash", kTemplateSpec)
+}
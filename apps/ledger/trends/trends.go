@@ -7,7 +7,6 @@ import (
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/aggregators"
 	"github.com/keep94/finances/fin/categories"
-	"github.com/keep94/finances/fin/categories/categoriesdb"
 	"github.com/keep94/finances/fin/consumers"
 	"github.com/keep94/finances/fin/filters"
 	"github.com/keep94/finances/fin/findb"
@@ -17,6 +16,7 @@ import (
 	"html/template"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -151,10 +151,12 @@ var (
           <td>Top level: </td>
           <td><input type="checkbox" name="top" {{if .Get "top"}}checked{{end}}></td>
           <td>Frequency: </td>
-          <td colspan="3"><select name="freq">
+          <td><select name="freq">
             <option value="M" {{if .Equals "freq" "M"}}selected{{end}}>Monthly</option>
             <option value="Y" {{if .Equals "freq" "Y"}}selected{{end}}>Yearly</option>
           </select></td>
+          <td>Tag: </td>
+          <td><input type="text" name="tag" value="{{.Get "tag"}}"></td>
         </tr>
         <tr>
           <td colspan="6">
@@ -178,21 +180,24 @@ var (
 )
 
 type Handler struct {
-	Cdc    categoriesdb.Getter
-	Store  findb.EntriesRunner
 	LN     *common.LeftNav
 	Global *common.Global
 	NoWifi bool
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := common.GetUserSession(r)
+	store := session.Store.(findb.EntriesRunner)
+	cdc := session.Cache
 	r.ParseForm()
 	leftnav := h.LN.Generate(w, r, common.SelectTrends())
 	if leftnav == "" {
 		return
 	}
-	cds, _ := h.Cdc.Get(nil)
+	cds, _ := cdc.Get(nil)
+	converter := session.FX.Converter(cds)
 	cat, caterr := fin.CatFromString(r.Form.Get("cat"))
+	tag := strings.TrimSpace(r.Form.Get("tag"))
 	start, end, err := getDateRange(r)
 	if err != nil {
 		v := &view{
@@ -208,7 +213,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if caterr == nil {
-		points, barGraph, cats, err := h.singleCat(cds, r.URL, cat, r.Form.Get("top") != "", start, end, r.Form.Get("freq") == "Y")
+		points, barGraph, cats, err := h.singleCat(store, cds, converter, r.URL, cat, tag, r.Form.Get("top") != "", start, end, r.Form.Get("freq") == "Y")
 		if err != nil {
 			http_util.ReportError(w, "Error reading database.", err)
 			return
@@ -231,7 +236,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		http_util.WriteTemplate(w, kTemplate, v)
 	} else {
-		points, barGraph, cats, err := h.allCats(cds, r.URL, start, end, r.Form.Get("freq") == "Y")
+		points, barGraph, cats, err := h.allCats(store, cds, converter, r.URL, tag, start, end, r.Form.Get("freq") == "Y")
 		if err != nil {
 			http_util.ReportError(w, "Error reading database.", err)
 			return
@@ -257,9 +262,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) singleCat(
+	store findb.EntriesRunner,
 	cds categories.CatDetailStore,
+	converter *fin.BaseConverter,
 	thisUrl *url.URL,
 	cat fin.Cat,
+	tag string,
 	topOnly bool,
 	start, end time.Time,
 	isYearly bool) (points []*dataPoint, barGraph *google_jsgraph.BarGraph, cats fin.CatSet, err error) {
@@ -271,25 +279,35 @@ func (h *Handler) singleCat(
 			consumers.FromCatPaymentAggregator(ct),
 			consumers.FromEntryAggregator(totals)),
 		filters.CompileAdvanceSearchSpec(
-			&filters.AdvanceSearchSpec{CF: cds.Filter(cat, !topOnly)}))
+			&filters.AdvanceSearchSpec{
+				CF: cds.Filter(cat, !topOnly)}))
+	var fxErr error
+	cr = consumers.ToBaseCurrency(cr, converter, &fxErr)
 	elo := findb.EntryListOptions{
 		Start: &start,
-		End:   &end}
-	err = h.Store.Entries(nil, &elo, cr)
+		End:   &end,
+		Tag:   tag}
+	err = store.Entries(nil, &elo, cr)
 	if err != nil {
 		return
 	}
+	if fxErr != nil {
+		err = fxErr
+		return
+	}
 	isIncome := cat.Type == fin.IncomeCat
 	var listUrl *url.URL
 	if topOnly {
 		listUrl = http_util.NewUrl(
 			"/fin/list",
 			"cat", cat.String(),
-			"top", "on")
+			"top", "on",
+			"tag", tag)
 	} else {
 		listUrl = http_util.NewUrl(
 			"/fin/list",
-			"cat", cat.String())
+			"cat", cat.String(),
+			"tag", tag)
 	}
 	var reportUrl *url.URL
 	if isYearly {
@@ -324,8 +342,11 @@ func (h *Handler) singleCat(
 }
 
 func (h *Handler) allCats(
+	store findb.EntriesRunner,
 	cds categories.CatDetailStore,
+	converter *fin.BaseConverter,
 	thisUrl *url.URL,
+	tag string,
 	start, end time.Time,
 	isYearly bool) (points []*multiDataPoint, barGraph *google_jsgraph.BarGraph, cats fin.CatSet, err error) {
 	// Only to see what the child categories are
@@ -344,14 +365,21 @@ func (h *Handler) allCats(
 			filters.CompileAdvanceSearchSpec(
 				&filters.AdvanceSearchSpec{
 					CF: cds.Filter(fin.Income, true)})))
+	var fxErr error
+	cr = consumers.ToBaseCurrency(cr, converter, &fxErr)
 	elo := findb.EntryListOptions{
 		Start: &start,
-		End:   &end}
-	err = h.Store.Entries(nil, &elo, cr)
+		End:   &end,
+		Tag:   tag}
+	err = store.Entries(nil, &elo, cr)
 	if err != nil {
 		return
 	}
-	listUrl := http_util.NewUrl("/fin/list")
+	if fxErr != nil {
+		err = fxErr
+		return
+	}
+	listUrl := http_util.NewUrl("/fin/list", "tag", tag)
 	var reportUrl *url.URL
 	if isYearly {
 		reportUrl = http_util.WithParams(thisUrl, "freq", "M")
@@ -0,0 +1,202 @@
+package undo
+
+import (
+	"errors"
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/apps/ledger/common"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/http_util"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+const (
+	kUndo = "undo"
+)
+
+var (
+	errChangedSince = errors.New(
+		"Entries in this change were changed since. Undo the later changes first.")
+	errCannotUndo = errors.New("This change was already undone.")
+	errNotYours   = errors.New("Only the user who made this change can undo it.")
+)
+
+var (
+	kTemplateSpec = `
+<html>
+<head>
+  <title>{{.Global.Title}}</title>
+  {{if .Global.Icon}}
+    <link rel="shortcut icon" href="/images/favicon.ico" type="image/x-icon" />
+  {{end}}
+  <link rel="stylesheet" type="text/css" href="/static/theme.css" />
+</head>
+<body>
+{{.LeftNav}}
+<div class="main">
+<h2>Undo</h2>
+{{if .Error}}
+  <span class="error">{{.Error.Error}}</span>
+  <br><br>
+{{end}}
+{{if .Changes}}
+Your last change on {{.When}}:
+<br><br>
+<table>
+  <tr>
+    <td>What</td>
+    <td>Date</td>
+    <td>Name</td>
+    <td>Amount</td>
+  </tr>
+  {{range .Changes}}
+  <tr class="lineitem">
+    <td>{{.What}}</td>
+    <td>{{FormatDate .Entry.Date}}</td>
+    <td>{{.Entry.Name}}</td>
+    <td align=right>{{FormatUSD .Entry.Total}}</td>
+  </tr>
+  {{end}}
+</table>
+<br>
+<form method="post">
+  <input type="hidden" name="xsrf" value="{{.Xsrf}}">
+  <input type="hidden" name="cid" value="{{.ChangeId}}">
+  <input type="submit" value="Undo">
+</form>
+{{else}}
+Nothing to undo.
+{{end}}
+</div>
+</body>
+</html>`
+)
+
+var (
+	kTemplate *template.Template
+)
+
+// Store methods are from fin.Store
+type Store interface {
+	findb.ChangeEntriesRunner
+	findb.LastChangeIdRunner
+	findb.UndoRunner
+}
+
+// Handler shows the last change the user made to entries on GET and
+// undoes it on POST.
+type Handler struct {
+	LN     *common.LeftNav
+	Global *common.Global
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	session := common.GetUserSession(r)
+	doer := session.Doer
+	store := session.Store.(Store)
+	var err error
+	if r.Method == "POST" {
+		if !common.VerifyXsrfToken(r, kUndo) {
+			err = common.ErrXsrf
+		} else {
+			changeId, _ := strconv.ParseInt(r.Form.Get("cid"), 10, 64)
+			err = undo(session, store, changeId)
+		}
+		switch err {
+		case nil:
+			session.Save(r, w)
+			http_util.Redirect(w, r, r.URL.Path)
+			return
+		case findb.ConcurrentUpdate:
+			err = errChangedSince
+		case findb.CannotUndo, findb.NoSuchId:
+			err = errCannotUndo
+		case findb.NoPermission:
+			err = errNotYours
+		case common.ErrXsrf:
+		default:
+			http_util.ReportError(w, "Error undoing change.", err)
+			return
+		}
+	}
+	var changeId int64
+	var history []fin.EntryHistory
+	dbErr := doer.Do(func(t db.Transaction) (err error) {
+		changeId, err = store.LastChangeId(t, session.User.Id)
+		if err == findb.NoSuchId {
+			return nil
+		}
+		if err != nil {
+			return
+		}
+		return store.ChangeEntries(t, changeId, consume2.AppendTo(&history))
+	})
+	if dbErr != nil {
+		http_util.ReportError(w, "Error reading database.", dbErr)
+		return
+	}
+	leftnav := h.LN.Generate(w, r, common.SelectUndo())
+	if leftnav == "" {
+		return
+	}
+	v := &view{
+		ChangeId: changeId,
+		Xsrf:     common.NewXsrfToken(r, kUndo),
+		Error:    err,
+		LeftNav:  leftnav,
+		Global:   h.Global}
+	for i := range history {
+		v.Changes = append(v.Changes, toChange(&history[i]))
+	}
+	if len(history) > 0 {
+		v.When = history[0].Time.Local().Format("01/02/2006 15:04:05")
+	}
+	http_util.WriteTemplate(w, kTemplate, v)
+}
+
+// undo undoes the change set with given id. If that change set is the
+// last import that session remembers, undo forgets it.
+func undo(
+	session *common.UserSession, store Store, changeId int64) error {
+	if err := store.Undo(nil, changeId); err != nil {
+		return err
+	}
+	if acctId, batch := session.ImportByChangeId(changeId); batch != nil {
+		session.SetLastImport(acctId, 0, nil)
+	}
+	return nil
+}
+
+type view struct {
+	ChangeId int64
+	When     string
+	Changes  []change
+	Xsrf     string
+	Error    error
+	LeftNav  template.HTML
+	Global   *common.Global
+}
+
+type change struct {
+	What  string
+	Entry *fin.Entry
+}
+
+func toChange(h *fin.EntryHistory) change {
+	switch {
+	case h.IsAdd():
+		return change{What: "Added", Entry: h.After}
+	case h.IsDelete():
+		return change{What: "Deleted", Entry: h.Before}
+	default:
+		return change{What: "Changed", Entry: h.After}
+	}
+}
+
+func init() {
+	kTemplate = common.NewTemplate("undo", kTemplateSpec)
+}
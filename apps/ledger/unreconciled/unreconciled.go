@@ -32,7 +32,7 @@ var (
 <body>
 {{.LeftNav}}
 <div class="main">
-<h2>{{.Account.Name}}</h2>    
+<h2>{{.Account.Name}}{{with .Account.Currency}} ({{.}}){{end}}</h2>    
 <a href="#" onclick="document.forms[0].edit_id.value=-1; document.forms[0].submit()">New Entry</a>&nbsp;
 <a href="#" onclick="document.forms[0].edit_id.value=-2; document.forms[0].submit()">Normal View</a>
 <br><br>
@@ -88,7 +88,6 @@ type Store interface {
 }
 
 type Handler struct {
-	Doer     db.Doer
 	PageSize int
 	LN       *common.LeftNav
 	Global   *common.Global
@@ -135,7 +134,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	cds := categories.CatDetailStore{}
 	lastn := consume2.NewLastN[fin.Entry](h.PageSize)
 	account := fin.Account{}
-	err := h.Doer.Do(func(t db.Transaction) (err error) {
+	err := session.Doer.Do(func(t db.Transaction) (err error) {
 		cds, _ = cache.Get(t)
 		return findb.UnreconciledEntries(t, store, acctId, &account, lastn)
 	})
@@ -115,6 +115,13 @@ body {
          <div id="descContainer_{{.Id}}" /></div>
        </td>
       </tr>
+      <tr>
+        <td>&nbsp;</td>
+        <td>Tags:</td>
+        <td colspan=4>
+          <input type="text" name="tags_{{.Id}}" value="{{FormatTags .Tags}}" size="40">
+        </td>
+      </tr>
   {{end}}
   {{end}}
   </table>
@@ -152,7 +159,6 @@ type Store interface {
 }
 
 type Handler struct {
-	Doer     db.Doer
 	PageSize int
 	LN       *common.LeftNav
 	Global   *common.Global
@@ -201,7 +207,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	entries := make([]fin.Entry, 0, h.PageSize)
 	consumer := consume2.Slice(consume2.AppendTo(&entries), 0, h.PageSize)
 	cds := categories.CatDetailStore{}
-	err := h.Doer.Do(func(t db.Transaction) error {
+	err := session.Doer.Do(func(t db.Transaction) error {
 		cds, _ = cache.Get(t)
 		return store.Entries(t, &findb.EntryListOptions{Unreviewed: true}, consumer)
 	})
@@ -258,6 +264,7 @@ func (v *view) IdsAsJsArray(entries []fin.Entry) template.JS {
 func createMutation(values url.Values, id int64, isFinal bool) fin.EntryUpdater {
 	cat, caterr := fin.CatFromString(values.Get(fmt.Sprintf("cat_%d", id)))
 	desc := values.Get(fmt.Sprintf("desc_%d", id))
+	tags := fin.ParseTags(values.Get(fmt.Sprintf("tags_%d", id)))
 	var status fin.ReviewStatus = fin.NotReviewed
 	if values.Get(fmt.Sprintf("checked_%d", id)) != "" {
 		if isFinal {
@@ -268,6 +275,7 @@ func createMutation(values url.Values, id int64, isFinal bool) fin.EntryUpdater
 	}
 	return func(p *fin.Entry) bool {
 		p.Desc = desc
+		p.Tags = tags
 		if caterr != nil || p.SetSingleCat(cat) {
 			p.Status = status
 		}
@@ -16,9 +16,7 @@ import (
 	"github.com/keep94/toolbox/http_util"
 	"html/template"
 	"net/http"
-	"path"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -26,6 +24,11 @@ const (
 	kUpload = "upload"
 )
 
+var (
+	errUndoImport = errors.New(
+		"Entries from the last import changed since. Undo them by hand.")
+)
+
 const (
 	kMaxUploadSize          = 1024 * 1024
 	kMaxDays                = 7
@@ -53,13 +56,17 @@ var (
   <input type="hidden" name="xsrf" value="{{.Xsrf}}">
   <table>
     <tr>
-      <td>QFX file: </td>
+      <td>File: </td>
       <td><input type="file" name="contents"></td>
     </tr>
     <tr>
       <td>Start Date (YYYYmmdd): </td>
       <td><input type="text" name="sd" value="{{.StartDate}}"></td>
     </tr>
+    <tr>
+      <td>Bank account id: </td>
+      <td><input type="text" name="bankacct" value="{{.BankAccountId}}"> (only if the file has several accounts)</td>
+    </tr>
   </table>
   <table>
     <tr>
@@ -68,6 +75,13 @@ var (
     </tr>
   </table>
 </form>
+{{if .LastImportCount}}
+<form method="post">
+  <input type="hidden" name="task" value="undo">
+  <input type="hidden" name="xsrf" value="{{.Xsrf}}">
+  <input type="submit" value="Undo last import ({{.LastImportCount}} entries)" onclick="return confirm('Are you sure you want to undo the last import?');">
+</form>
+{{end}}
 </div>
 </body>
 </html>`
@@ -89,6 +103,12 @@ var (
   <input type="hidden" name="task" value="confirm">
   <input type="hidden" name="xsrf" value="{{.Xsrf}}">
   <table>
+    {{if .Format}}
+    <tr>
+      <td>Format: </td>
+      <td>{{.Format}}</td>
+    </tr>
+    {{end}}
     <tr>
       <td>New entries: </td>
       <td>{{.NewCount}}</td>
@@ -130,10 +150,10 @@ type Store interface {
 	findb.DoEntryChangesRunner
 	findb.EntriesByAccountIdRunner
 	findb.UpdateAccountImportSDRunner
+	findb.UndoRunner
 }
 
 type Handler struct {
-	Doer   db.Doer
 	LN     *common.LeftNav
 	Global *common.Global
 }
@@ -145,7 +165,9 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	acctId, _ := strconv.ParseInt(r.Form.Get("acctId"), 10, 64)
 	userSession := common.GetUserSession(r)
 	batch := userSession.Batch(acctId)
-	if batch == nil {
+	if r.Method == "POST" && r.Form.Get("task") == "undo" {
+		h.undoLastImport(w, r, acctId, store)
+	} else if batch == nil {
 		h.serveUploadPage(w, r, acctId, store, session.Uploaders)
 	} else {
 		h.serveConfirmPage(w, r, acctId, batch, store)
@@ -158,30 +180,23 @@ func (h *Handler) serveConfirmPageGet(
 	acctId int64,
 	batch autoimport.Batch,
 	store Store) {
-	account := fin.Account{}
-	var unreconciled []*fin.Entry
-	err := h.Doer.Do(func(t db.Transaction) error {
-		return findb.UnreconciledEntries(
-			t,
-			store,
-			acctId,
-			&account,
-			consume2.AppendPtrsTo(&unreconciled))
-	})
+	account, batchEntries, err := Preview(
+		common.GetUserSession(r).Doer, store, acctId, batch)
 	if err != nil {
 		http_util.ReportError(
 			w, "A database error happened fetching unreconciled entries", err)
 		return
 	}
-	batchEntries := batch.Entries()
-	reconcile.Reconcile(unreconciled, kMaxDays, batchEntries)
 	leftnav := h.LN.Generate(w, r, common.SelectAccount(acctId))
 	if leftnav == "" {
 		return
 	}
 	h.showConfirmView(
 		w,
-		computeConfirmView(&account, batchEntries),
+		&confirmView{
+			Account: account,
+			Format:  common.GetUserSession(r).BatchFormat(acctId),
+			Summary: Summarize(account, batchEntries)},
 		common.NewXsrfToken(r, kUpload),
 		leftnav)
 }
@@ -198,51 +213,15 @@ func (h *Handler) serveConfirmPage(w http.ResponseWriter, r *http.Request, acctI
 			return
 		}
 		if !http_util.HasParam(r.Form, "cancel") {
-			categorizerBuilder := aggregators.NewByNameCategorizerBuilder(4, 2)
-			// If this fails, we can carry on. We just won't get autocategorization
-			store.Entries(
-				nil,
-				nil,
-				consume2.Slice(
-					consumers.FromEntryAggregator(categorizerBuilder),
-					0,
-					kAutoCategorizeLookBack),
-			)
-			categorizer := categorizerBuilder.Build()
-			err := h.Doer.Do(func(t db.Transaction) (err error) {
-				batch, err = batch.SkipProcessed(t)
-				if err != nil {
-					return
-				}
-				if batch.Len() == 0 {
-					return
-				}
-				var unreconciled []*fin.Entry
-				err = findb.UnreconciledEntries(
-					t,
-					store,
-					acctId,
-					nil,
-					consume2.AppendPtrsTo(&unreconciled))
-				if err != nil {
-					return
-				}
-				batchEntries := batch.Entries()
-				for i := range batchEntries {
-					categorizer.Categorize(&batchEntries[i])
-				}
-				reconcile.Reconcile(unreconciled, kMaxDays, batchEntries)
-				err = store.DoEntryChanges(
-					t, reconcile.GetChanges(batchEntries))
-				if err != nil {
-					return
-				}
-				return batch.MarkProcessed(t)
-			})
+			changeId, imported, err := Import(
+				common.GetUserSession(r).Doer, store, acctId, batch)
 			if err != nil {
 				http_util.ReportError(w, "A database error happened importing entries", err)
 				return
 			}
+			if changeId != 0 {
+				common.GetUserSession(r).SetLastImport(acctId, changeId, imported)
+			}
 		}
 		userSession := common.GetUserSession(r)
 		userSession.SetBatch(acctId, nil)
@@ -252,24 +231,67 @@ func (h *Handler) serveConfirmPage(w http.ResponseWriter, r *http.Request, acctI
 	}
 }
 
+// undoLastImport removes the entries that the last confirmed upload for
+// acctId added and marks its entries as not processed so that they can
+// be uploaded again.
+func (h *Handler) undoLastImport(
+	w http.ResponseWriter, r *http.Request, acctId int64, store Store) {
+	userSession := common.GetUserSession(r)
+	changeId, batch := userSession.LastImport(acctId)
+	accountLinker := common.AccountLinker{}
+	if batch == nil || !common.VerifyXsrfToken(r, kUpload) {
+		http_util.Redirect(w, r, accountLinker.AccountLink(acctId).String())
+		return
+	}
+	err := store.Undo(nil, changeId)
+	if err == findb.ConcurrentUpdate || err == findb.CannotUndo {
+		var account fin.Account
+		if err := store.AccountById(nil, acctId, &account); err != nil {
+			http_util.ReportError(w, "Error reading account from database.", err)
+			return
+		}
+		leftnav := h.LN.Generate(w, r, common.SelectAccount(acctId))
+		if leftnav == "" {
+			return
+		}
+		showView(w, h.newView(r, &account, leftnav), errUndoImport)
+		return
+	}
+	if err != nil {
+		http_util.ReportError(w, "A database error happened undoing import", err)
+		return
+	}
+	userSession.SetLastImport(acctId, 0, nil)
+	userSession.Save(r, w)
+	http_util.Redirect(w, r, accountLinker.AccountLink(acctId).String())
+}
+
 func (h *Handler) serverUploadPageGet(
 	w http.ResponseWriter, r *http.Request, account *fin.Account) {
 	leftnav := h.LN.Generate(w, r, common.SelectAccount(account.Id))
 	if leftnav == "" {
 		return
 	}
-	view := &view{
+	showView(w, h.newView(r, account, leftnav), nil)
+}
+
+func (h *Handler) newView(
+	r *http.Request, account *fin.Account, leftnav template.HTML) *view {
+	result := &view{
 		Account:   account,
 		StartDate: account.ImportSD.Format(date_util.YMDFormat),
 		Xsrf:      common.NewXsrfToken(r, kUpload),
 		LeftNav:   leftnav,
 		Global:    h.Global}
-	showView(w, view, nil)
+	if _, batch := common.GetUserSession(r).LastImport(account.Id); batch != nil {
+		result.LastImportCount = batch.Len()
+	}
+	return result
 }
 
 func (h *Handler) serveUploadPage(
 	w http.ResponseWriter, r *http.Request, acctId int64,
-	store Store, uploaders map[string]autoimport.Loader) {
+	store Store, uploaders *autoimport.Registry) {
 	account := fin.Account{}
 	err := store.AccountById(nil, acctId, &account)
 	if err != nil {
@@ -298,19 +320,20 @@ func (h *Handler) serveUploadPage(
 			return
 		}
 		sdStr := mform.Get("sd")
+		bankAccountId := mform.Get("bankacct")
 		xsrf := mform.Get("xsrf")
 		qfxFile, _ := mform.GetFile("contents")
-		loader := uploaders[fileExtension(qfxFile.FileName)]
 		leftnav := h.LN.Generate(w, r, common.SelectAccount(account.Id))
 		if leftnav == "" {
 			return
 		}
 		view := &view{
-			Account:   &account,
-			StartDate: sdStr,
-			Xsrf:      common.NewXsrfToken(r, kUpload),
-			LeftNav:   leftnav,
-			Global:    h.Global}
+			Account:       &account,
+			StartDate:     sdStr,
+			BankAccountId: bankAccountId,
+			Xsrf:          common.NewXsrfToken(r, kUpload),
+			LeftNav:       leftnav,
+			Global:        h.Global}
 		if !common.VerifyXsrfTokenExplicit(xsrf, r, kUpload) {
 			showView(w, view, common.ErrXsrf)
 			return
@@ -329,12 +352,13 @@ func (h *Handler) serveUploadPage(
 			showView(w, view, errors.New("Please select a file."))
 			return
 		}
-		if loader == nil {
-			showView(w, view, errors.New("File extension not recognized."))
+		format, ok := uploaders.Detect(qfxFile.FileName, qfxFile.Contents)
+		if !ok {
+			showView(w, view, errors.New("File format not recognized."))
 			return
 		}
-		batch, err := loader.Load(
-			acctId, "", bytes.NewBuffer(qfxFile.Contents), sd)
+		batch, err := format.Loader.Load(
+			acctId, bankAccountId, bytes.NewBuffer(qfxFile.Contents), sd)
 		if err != nil {
 			showView(w, view, err)
 			return
@@ -349,7 +373,7 @@ func (h *Handler) serveUploadPage(
 			return
 		}
 		userSession := common.GetUserSession(r)
-		userSession.SetBatch(acctId, batch)
+		userSession.SetBatchWithFormat(acctId, batch, format.Name)
 		userSession.Save(r, w)
 		http_util.Redirect(w, r, r.URL.String())
 	}
@@ -372,27 +396,45 @@ func showView(
 type view struct {
 	Account   *fin.Account
 	StartDate string
-	Xsrf      string
-	Error     error
-	LeftNav   template.HTML
-	Global    *common.Global
+	// The ACCTID of the account to import from a file with several
+	// accounts
+	BankAccountId string
+	Xsrf          string
+	Error         error
+	LeftNav       template.HTML
+	Global        *common.Global
+
+	// The number of entries in the last confirmed upload that can be
+	// undone or 0 if there is none.
+	LastImportCount int
 }
 
 type confirmView struct {
-	Account       *fin.Account
-	NewCount      int
+	Account *fin.Account
+	// The name of the format of the uploaded file e.g OFX
+	Format string
+	Summary
+	Xsrf    string
+	LeftNav template.HTML
+	Global  *common.Global
+}
+
+// Summary summarizes what confirming an import would do to an account.
+type Summary struct {
+	// The number of imported entries that would be new entries.
+	NewCount int
+	// The number of imported entries that match existing entries.
 	ExistingCount int
-	Balance       int64
-	RBalance      int64
-	Xsrf          string
-	LeftNav       template.HTML
-	Global        *common.Global
+	// The balance of the account after the import.
+	Balance int64
+	// The reconciled balance of the account after the import.
+	RBalance int64
 }
 
-func computeConfirmView(
-	account *fin.Account, batchEntries []fin.Entry) *confirmView {
-	result := &confirmView{
-		Account:  account,
+// Summarize summarizes importing batchEntries into account. batchEntries
+// come from Preview.
+func Summarize(account *fin.Account, batchEntries []fin.Entry) Summary {
+	result := Summary{
 		Balance:  account.Balance,
 		RBalance: account.RBalance}
 	for _, v := range batchEntries {
@@ -408,8 +450,103 @@ func computeConfirmView(
 	return result
 }
 
-func fileExtension(filename string) string {
-	return strings.ToLower(path.Ext(filename))
+// Preview matches the entries in batch against the unreconciled entries
+// of the account with acctId without changing anything. It returns the
+// account and the entries in batch. Entries that match an existing entry
+// have that entry's id; new entries have id 0.
+func Preview(
+	doer db.Doer, store Store, acctId int64, batch autoimport.Batch) (
+	account *fin.Account, batchEntries []fin.Entry, err error) {
+	account = &fin.Account{}
+	var unreconciled []*fin.Entry
+	err = doer.Do(func(t db.Transaction) error {
+		return findb.UnreconciledEntries(
+			t,
+			store,
+			acctId,
+			account,
+			consume2.AppendPtrsTo(&unreconciled))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	batchEntries = batch.Entries()
+	reconcile.Reconcile(unreconciled, kMaxDays, batchEntries)
+	return account, batchEntries, nil
+}
+
+// Import adds the entries in batch to the account with acctId. Entries
+// that match an unreconciled entry reconcile it; new entries get the
+// categories of the most recent entries with similar names. Import skips
+// entries that were already imported and marks the rest as processed.
+// Import returns the id of the change that it made and the entries it
+// imported. If there was nothing left to import, changeId is 0.
+func Import(
+	doer db.Doer, store Store, acctId int64, batch autoimport.Batch) (
+	changeId int64, imported autoimport.Batch, err error) {
+	return ImportWithSD(doer, store, acctId, batch, nil)
+}
+
+// ImportWithSD works like Import except that if sd is non-nil, it also
+// makes *sd the import start date of the account in the same transaction.
+func ImportWithSD(
+	doer db.Doer,
+	store Store,
+	acctId int64,
+	batch autoimport.Batch,
+	sd *time.Time) (
+	changeId int64, imported autoimport.Batch, err error) {
+	categorizerBuilder := aggregators.NewByNameCategorizerBuilder(4, 2)
+	// If this fails, we can carry on. We just won't get autocategorization
+	store.Entries(
+		nil,
+		nil,
+		consume2.Slice(
+			consumers.FromEntryAggregator(categorizerBuilder),
+			0,
+			kAutoCategorizeLookBack),
+	)
+	categorizer := categorizerBuilder.Build()
+	err = doer.Do(func(t db.Transaction) (err error) {
+		if sd != nil {
+			if err = store.UpdateAccountImportSD(t, acctId, *sd); err != nil {
+				return
+			}
+		}
+		imported, err = batch.SkipProcessed(t)
+		if err != nil {
+			return
+		}
+		if imported.Len() == 0 {
+			return
+		}
+		var unreconciled []*fin.Entry
+		err = findb.UnreconciledEntries(
+			t,
+			store,
+			acctId,
+			nil,
+			consume2.AppendPtrsTo(&unreconciled))
+		if err != nil {
+			return
+		}
+		batchEntries := imported.Entries()
+		for i := range batchEntries {
+			categorizer.Categorize(&batchEntries[i])
+		}
+		reconcile.Reconcile(unreconciled, kMaxDays, batchEntries)
+		changes := reconcile.GetChanges(batchEntries)
+		err = store.DoEntryChanges(t, changes)
+		if err != nil {
+			return
+		}
+		changeId = changes.ChangeId
+		return imported.MarkProcessed(t, changeId)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return
 }
 
 func init() {
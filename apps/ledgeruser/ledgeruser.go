@@ -9,6 +9,7 @@ import (
 
 	"github.com/keep94/consume2"
 	"github.com/keep94/finances/fin"
+	csqlite "github.com/keep94/finances/fin/categories/categoriesdb/for_sqlite"
 	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/finances/fin/findb/for_sqlite"
 	"github.com/keep94/finances/fin/findb/sqlite_setup"
@@ -22,15 +23,22 @@ const (
 	kDbFlag   = "db"
 	kNameFlag = "name"
 	kPermFlag = "perm"
+	kCatFlag  = "cat"
+	kIdFlag   = "id"
 )
 
 func main() {
 	if len(os.Args) == 1 {
 		fmt.Println("usage: ledgeruser <command> [<args>]")
-		fmt.Println("  list   list the users")
-		fmt.Println("  add    add a user")
-		fmt.Println("  remove remove user")
-		fmt.Println("  update update user")
+		fmt.Println("  list    list the users")
+		fmt.Println("  add     add a user")
+		fmt.Println("  remove  remove user")
+		fmt.Println("  update  update user")
+		fmt.Println("  rules   list the access rules of a user")
+		fmt.Println("  allow   add an access rule for a user")
+		fmt.Println("  revoke  remove an access rule")
+		fmt.Println("  tokens  list the API tokens of a user")
+		fmt.Println("  untoken revoke an API token")
 		return
 	}
 	switch os.Args[1] {
@@ -50,6 +58,26 @@ func main() {
 		if !doUpdate(os.Args[2:]) {
 			os.Exit(1)
 		}
+	case "rules":
+		if !doRules(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "allow":
+		if !doAllow(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "revoke":
+		if !doRevoke(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "tokens":
+		if !doTokens(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "untoken":
+		if !doUntoken(os.Args[2:]) {
+			os.Exit(1)
+		}
 	default:
 		fmt.Printf("%q is not a valid command.\n", os.Args[1])
 		os.Exit(2)
@@ -194,6 +222,164 @@ func doRemove(args []string) bool {
 	return true
 }
 
+func doRules(args []string) bool {
+	flags := flag.NewFlagSet("rules", flag.ExitOnError)
+	dbPath := addDbFlag(flags)
+	name := addNameFlag(flags)
+	flags.Parse(args)
+	checkDbAndName(flags, *dbPath, *name)
+	dbase := openDb(*dbPath)
+	defer dbase.Close()
+	store, _, ok := initDb(dbase)
+	if !ok {
+		return false
+	}
+	cds, err := csqlite.New(dbase).Get(nil)
+	if err != nil {
+		fmt.Printf("An error happened reading categories - %v\n", err)
+		return false
+	}
+	var rules []fin.AccessRule
+	err = store.AccessRulesByUserName(nil, *name, consume2.AppendTo(&rules))
+	if err != nil {
+		fmt.Printf("An error happened listing access rules - %v\n", err)
+		return false
+	}
+	if len(rules) == 0 {
+		fmt.Printf("%s has no access rules and may see everything.\n", *name)
+		return true
+	}
+	for _, rule := range rules {
+		fmt.Printf("%-6d %s\n", rule.Id, cds.DetailById(rule.Cat).FullName())
+	}
+	return true
+}
+
+func doAllow(args []string) bool {
+	flags := flag.NewFlagSet("allow", flag.ExitOnError)
+	dbPath := addDbFlag(flags)
+	name := addNameFlag(flags)
+	catName := flags.String(
+		kCatFlag,
+		"",
+		"Full name of account or category e.g. account:Checking or expense:Kids")
+	flags.Parse(args)
+	checkDbAndName(flags, *dbPath, *name)
+	checkStrFlag(flags, kCatFlag, *catName)
+	dbase := openDb(*dbPath)
+	defer dbase.Close()
+	store, _, ok := initDb(dbase)
+	if !ok {
+		return false
+	}
+	cds, err := csqlite.New(dbase).Get(nil)
+	if err != nil {
+		fmt.Printf("An error happened reading categories - %v\n", err)
+		return false
+	}
+	detail, ok := cds.DetailByFullName(*catName)
+	if !ok {
+		fmt.Printf("No such account or category - %s\n", *catName)
+		return false
+	}
+	rule := fin.AccessRule{UserName: *name, Cat: detail.Id()}
+	if err := store.AddAccessRule(nil, &rule); err != nil {
+		fmt.Printf("An error happened adding access rule - %v\n", err)
+		return false
+	}
+	return true
+}
+
+func doRevoke(args []string) bool {
+	flags := flag.NewFlagSet("revoke", flag.ExitOnError)
+	dbPath := addDbFlag(flags)
+	id := flags.Int64(kIdFlag, 0, "Id of access rule as shown by rules")
+	flags.Parse(args)
+	checkStrFlag(flags, kDbFlag, *dbPath)
+	if *id <= 0 {
+		fmt.Fprintf(flags.Output(), "Need to specify -%s flag.\n", kIdFlag)
+		os.Exit(2)
+	}
+	dbase := openDb(*dbPath)
+	defer dbase.Close()
+	store, _, ok := initDb(dbase)
+	if !ok {
+		return false
+	}
+	if err := store.RemoveAccessRule(nil, *id); err != nil {
+		fmt.Printf("An error happened removing access rule - %v\n", err)
+		return false
+	}
+	return true
+}
+
+func doTokens(args []string) bool {
+	flags := flag.NewFlagSet("tokens", flag.ExitOnError)
+	dbPath := addDbFlag(flags)
+	name := addNameFlag(flags)
+	flags.Parse(args)
+	checkDbAndName(flags, *dbPath, *name)
+	dbase := openDb(*dbPath)
+	defer dbase.Close()
+	store, _, ok := initDb(dbase)
+	if !ok {
+		return false
+	}
+	var user fin.User
+	if err := store.UserByName(nil, *name, &user); err != nil {
+		fmt.Printf("An error happened reading user - %v\n", err)
+		return false
+	}
+	var tokens []fin.ApiToken
+	err := store.ApiTokensByUserId(nil, user.Id, consume2.AppendTo(&tokens))
+	if err != nil {
+		fmt.Printf("An error happened listing API tokens - %v\n", err)
+		return false
+	}
+	for _, token := range tokens {
+		lastUsedStr := "--"
+		if !token.LastUsed.IsZero() {
+			lastUsedStr = token.LastUsed.Local().Format("Mon 01/02/2006 15:04")
+		}
+		accounts := "all accounts"
+		if len(token.AccountIds) > 0 {
+			accounts = "accounts " + findb.FormatIds(token.AccountIds)
+		}
+		fmt.Printf(
+			"%-6d %-20s %-20s %-12s %-6s %s\n",
+			token.Id,
+			token.Name,
+			lastUsedStr,
+			token.Book,
+			token.Permission,
+			accounts)
+	}
+	return true
+}
+
+func doUntoken(args []string) bool {
+	flags := flag.NewFlagSet("untoken", flag.ExitOnError)
+	dbPath := addDbFlag(flags)
+	id := flags.Int64(kIdFlag, 0, "Id of API token as shown by tokens")
+	flags.Parse(args)
+	checkStrFlag(flags, kDbFlag, *dbPath)
+	if *id <= 0 {
+		fmt.Fprintf(flags.Output(), "Need to specify -%s flag.\n", kIdFlag)
+		os.Exit(2)
+	}
+	dbase := openDb(*dbPath)
+	defer dbase.Close()
+	store, _, ok := initDb(dbase)
+	if !ok {
+		return false
+	}
+	if err := store.RemoveApiToken(nil, *id); err != nil {
+		fmt.Printf("An error happened removing API token - %v\n", err)
+		return false
+	}
+	return true
+}
+
 func openDb(dbPath string) *sqlite3_db.Db {
 	rawdb, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
@@ -0,0 +1,48 @@
+// migratedb backs up a ledger sqlite database and brings its schema up to
+// date. It does the same thing as ledger -migrate.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/keep94/finances/fin/findb/sqlite_setup"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	fDb string
+)
+
+func main() {
+	flag.Parse()
+	if fDb == "" {
+		fmt.Println("Need to specify db")
+		flag.Usage()
+		os.Exit(1)
+	}
+	rawdb, err := sql.Open("sqlite3", fDb)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rawdb.Close()
+	backupPath, err := sqlite_setup.BackupAndMigrate(rawdb, fDb)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if backupPath == "" {
+		fmt.Println("Database schema is already up to date.")
+		return
+	}
+	fmt.Printf(
+		"Migrated database to schema version %d. Backup is in %s\n",
+		sqlite_setup.LatestSchemaVersion(),
+		backupPath)
+}
+
+func init() {
+	flag.StringVar(&fDb, "db", "", "Path to database file")
+}
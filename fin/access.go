@@ -0,0 +1,18 @@
+package fin
+
+// AccessRule limits what a user may see and change in a database. A user
+// with no access rules in a database is limited only by their Permission.
+// A user with access rules sees only the accounts their account rules
+// name and only the entries that touch one of those accounts and whose
+// categories all fall under their category rules. If a user has no
+// account rules, any account is allowed; if a user has no category rules,
+// any category is allowed.
+type AccessRule struct {
+	Id int64
+	// The name of the user. Rules go by name rather than id because a book
+	// can get its users from another database.
+	UserName string
+	// An account or an expense or income category. A category rule also
+	// allows all the descendants of the category.
+	Cat Cat
+}
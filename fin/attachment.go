@@ -0,0 +1,38 @@
+package fin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Attachment is a file such as a receipt attached to an entry. The
+// contents of an attachment are stored separately by their hash so that
+// identical files are stored only once.
+type Attachment struct {
+	// Unique Id
+	Id int64
+	// The id of the entry
+	EntryId int64
+	// The original file name
+	Name string
+	// MIME type such as "application/pdf"
+	ContentType string
+	// The hash of the contents as returned by ContentHash.
+	Hash string
+	// The size of the contents in bytes.
+	Size int64
+	// When the attachment was added.
+	Added time.Time
+}
+
+func (a *Attachment) String() string {
+	return fmt.Sprintf("%v", *a)
+}
+
+// ContentHash returns the hash of contents that identifies them.
+func ContentHash(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
@@ -2,9 +2,14 @@
 package autoimport
 
 import (
+	"fmt"
 	"github.com/keep94/finances/fin"
+	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/db"
+	"hash/fnv"
 	"io"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -43,10 +48,91 @@ type Batch interface {
 	// transaction; nil means run in a separate transaction.
 	SkipProcessed(t db.Transaction) (Batch, error)
 
-	// MarkProcessed marks all the entries in this Batch as processed. t is the
-	// database transaction; nil means run in a separate transaction.
-	MarkProcessed(t db.Transaction) error
+	// MarkProcessed marks all the entries in this Batch as processed by the
+	// change set with changeId. Undoing that change set marks them as not
+	// processed again. t is the database transaction; nil means run in a
+	// separate transaction.
+	MarkProcessed(t db.Transaction, changeId int64) error
+
+	// MarkUnprocessed undoes MarkProcessed so that the entries in this
+	// Batch can be imported again. t is the database transaction; nil means
+	// run in a separate transaction.
+	MarkUnprocessed(t db.Transaction) error
 
 	// Len returns the number of entries in this batch.
 	Len() int
 }
+
+// ChooseAccount chooses the account to load from a file that has activity
+// for the accounts with bankAccountIds. bankAccountId is what the caller
+// passed to Load. ChooseAccount returns the element of bankAccountIds
+// matching bankAccountId ignoring case and spaces. If bankAccountId is
+// empty, bankAccountIds may contain at most one distinct account.
+func ChooseAccount(
+	bankAccountIds []string, bankAccountId string) (string, error) {
+	var distinct []string
+	for _, id := range bankAccountIds {
+		if !containsAccount(distinct, id) {
+			distinct = append(distinct, id)
+		}
+	}
+	if strings.TrimSpace(bankAccountId) == "" {
+		if len(distinct) > 1 {
+			return "", fmt.Errorf(
+				"File has activity for several accounts: %s. Please specify one.",
+				strings.Join(distinct, ", "))
+		}
+		if len(distinct) == 0 {
+			return "", nil
+		}
+		return distinct[0], nil
+	}
+	for _, id := range distinct {
+		if sameAccount(id, bankAccountId) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf(
+		"File has no activity for account %s.", strings.TrimSpace(bankAccountId))
+}
+
+// SyntheticFitId returns a fitId for entry when the bank gives it none.
+// The fitId comes from the date, name, description, and total of entry.
+// counts tracks the fitIds already handed out while loading a file; see
+// UniqueFitId.
+func SyntheticFitId(entry *fin.Entry, counts map[string]int) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s|%d", entry.Name, entry.Desc, entry.Total())
+	return UniqueFitId(
+		entry.Date.Format(date_util.YMDFormat)+":"+
+			strconv.FormatUint(h.Sum64(), 10),
+		counts)
+}
+
+// UniqueFitId returns fitId the first time counts sees it and fitId
+// with a sequence number after that. In this way, identical transactions
+// in a file get different fitIds by order of appearance, and the fitIds
+// stay the same each time the same file is loaded. counts starts empty
+// for each file.
+func UniqueFitId(fitId string, counts map[string]int) string {
+	count := counts[fitId]
+	counts[fitId]++
+	if count > 0 {
+		return fmt.Sprintf("%s:%d", fitId, count)
+	}
+	return fitId
+}
+
+func containsAccount(ids []string, id string) bool {
+	for _, i := range ids {
+		if sameAccount(i, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameAccount(x, y string) bool {
+	return strings.EqualFold(
+		strings.ReplaceAll(x, " ", ""), strings.ReplaceAll(y, " ", ""))
+}
@@ -0,0 +1,256 @@
+// Package camt provides processing of ISO 20022 camt.053 bank statements
+package camt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/finances/fin/autoimport/qfx"
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
+)
+
+const (
+	kDebit  = "DBIT"
+	kCredit = "CRDT"
+	kBooked = "BOOK"
+)
+
+var (
+	kCamtNamespace = []byte("camt.053")
+	kStatementTag  = []byte("<BkToCstmrStmt>")
+)
+
+// CamtLoader implements the autoimport.Loader interface for camt.053
+// files. CamtLoader loads only booked entries. The bank reference of
+// each entry, AcctSvcrRef, is its fitId. When a file has statements for
+// several accounts, bankAccountId, the IBAN or other id of the account,
+// selects the statement to load.
+type CamtLoader struct {
+	// Store stores which bank references have already been processed.
+	Store qfxdb.Store
+}
+
+func (c CamtLoader) Load(
+	accountId int64,
+	bankAccountId string,
+	r io.Reader,
+	startDate time.Time) (autoimport.Batch, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("Malformed camt.053 file: %v", err)
+	}
+	if doc.XMLName.Local != "Document" || len(doc.Statements) == 0 {
+		return nil, errors.New("Not a camt.053 file.")
+	}
+	ids := make([]string, len(doc.Statements))
+	for i := range doc.Statements {
+		ids[i] = doc.Statements[i].Account.id()
+	}
+	chosen, err := autoimport.ChooseAccount(ids, bankAccountId)
+	if err != nil {
+		return nil, err
+	}
+	var result []*qfx.QfxEntry
+	fitIdCounts := make(map[string]int)
+	for _, stmt := range doc.Statements {
+		if stmt.Account.id() != chosen {
+			continue
+		}
+		for i := range stmt.Entries {
+			ntry := &stmt.Entries[i]
+			if status := ntry.Status.code(); status != "" && status != kBooked {
+				continue
+			}
+			var qentry qfx.QfxEntry
+			if err := ntry.toEntry(accountId, &qentry.Entry); err != nil {
+				return nil, err
+			}
+			qentry.FitId = ntry.bankReference()
+			if qentry.FitId == "" {
+				qentry.FitId = autoimport.SyntheticFitId(&qentry.Entry, fitIdCounts)
+			}
+			if qentry.Date.Before(startDate) {
+				continue
+			}
+			if err := qentry.Check(); err != nil {
+				return nil, err
+			}
+			result = append(result, &qentry)
+		}
+	}
+	return &qfx.QfxBatch{Store: c.Store, AccountId: accountId, QfxEntries: result}, nil
+}
+
+// Sniff recognizes files with a camt.053 namespace or a bank to customer
+// statement element.
+func (c CamtLoader) Sniff(head []byte) int {
+	if bytes.Contains(head, kCamtNamespace) {
+		return autoimport.MaxScore
+	}
+	if bytes.Contains(head, kStatementTag) {
+		return autoimport.MaxScore * 9 / 10
+	}
+	return 0
+}
+
+// document is the root of a camt.053 file. Element names are matched
+// without regard to namespace so that all versions of camt.053 work.
+type document struct {
+	XMLName    xml.Name
+	Statements []statement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type statement struct {
+	Account account `xml:"Acct"`
+	Entries []entry `xml:"Ntry"`
+}
+
+type account struct {
+	IBAN  string `xml:"Id>IBAN"`
+	Other string `xml:"Id>Othr>Id"`
+}
+
+func (a *account) id() string {
+	if a.IBAN != "" {
+		return strings.TrimSpace(a.IBAN)
+	}
+	return strings.TrimSpace(a.Other)
+}
+
+// status is the status of an entry. Older versions of camt.053 have the
+// code as text; newer ones have it in a Cd element.
+type status struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+func (s *status) code() string {
+	if s.Code != "" {
+		return strings.TrimSpace(s.Code)
+	}
+	return strings.TrimSpace(s.Text)
+}
+
+type date struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+func (d *date) parse() (time.Time, error) {
+	s := strings.TrimSpace(d.Date)
+	if s == "" {
+		s = strings.TrimSpace(d.DateTime)
+	}
+	if len(s) < 10 {
+		return time.Time{}, errors.New("camt.053 entry missing booking date.")
+	}
+	result, err := time.Parse("2006-01-02", s[:10])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid date in camt.053 file: %s", s)
+	}
+	return result, nil
+}
+
+// party is a debtor or creditor. In newer versions of camt.053, the name
+// is in a Pty element.
+type party struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+func (p *party) name() string {
+	if p.Name != "" {
+		return strings.TrimSpace(p.Name)
+	}
+	return strings.TrimSpace(p.PartyName)
+}
+
+type transactionDetails struct {
+	BankReference string   `xml:"Refs>AcctSvcrRef"`
+	Debtor        party    `xml:"RltdPties>Dbtr"`
+	Creditor      party    `xml:"RltdPties>Cdtr"`
+	Remittance    []string `xml:"RmtInf>Ustrd"`
+}
+
+type entry struct {
+	Amount         string               `xml:"Amt"`
+	CreditDebit    string               `xml:"CdtDbtInd"`
+	Status         status               `xml:"Sts"`
+	BookingDate    date                 `xml:"BookgDt"`
+	BankReference  string               `xml:"AcctSvcrRef"`
+	Details        []transactionDetails `xml:"NtryDtls>TxDtls"`
+	AdditionalInfo string               `xml:"AddtlNtryInf"`
+}
+
+// bankReference returns the bank's reference for e or the empty string
+// if the bank gave none.
+func (e *entry) bankReference() string {
+	if ref := strings.TrimSpace(e.BankReference); ref != "" {
+		return ref
+	}
+	if len(e.Details) == 1 {
+		return strings.TrimSpace(e.Details[0].BankReference)
+	}
+	return ""
+}
+
+func (e *entry) toEntry(accountId int64, result *fin.Entry) error {
+	var err error
+	if result.Date, err = e.BookingDate.parse(); err != nil {
+		return err
+	}
+	amt, err := fin.ParseUSD(strings.TrimSpace(e.Amount))
+	if err != nil {
+		return fmt.Errorf("Invalid amount in camt.053 file: %s", e.Amount)
+	}
+	var credit bool
+	switch strings.TrimSpace(e.CreditDebit) {
+	case kCredit:
+		credit = true
+	case kDebit:
+		credit = false
+	default:
+		return fmt.Errorf(
+			"Invalid credit debit indicator in camt.053 file: %s",
+			e.CreditDebit)
+	}
+	// A reversal already has the credit debit indicator of the entry
+	// that undoes the original, so it needs no special handling.
+	if !credit {
+		amt = -amt
+	}
+	var remittance []string
+	var counterparty string
+	for i := range e.Details {
+		d := &e.Details[i]
+		for _, line := range d.Remittance {
+			if line = strings.TrimSpace(line); line != "" {
+				remittance = append(remittance, line)
+			}
+		}
+		if counterparty == "" {
+			if credit {
+				counterparty = d.Debtor.name()
+			} else {
+				counterparty = d.Creditor.name()
+			}
+		}
+	}
+	result.Desc = strings.Join(remittance, " ")
+	result.Name = counterparty
+	if result.Name == "" {
+		result.Name = strings.TrimSpace(e.AdditionalInfo)
+	}
+	if result.Name == "" {
+		result.Name = result.Desc
+	}
+	result.CatPayment = fin.NewCatPayment(fin.Expense, -amt, true, accountId)
+	return nil
+}
@@ -0,0 +1,331 @@
+package camt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/finances/fin/autoimport/qfx"
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+)
+
+const kSampleCamt = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08">
+  <BkToCstmrStmt>
+    <GrpHdr><MsgId>MSG1</MsgId></GrpHdr>
+    <Stmt>
+      <Id>STMT1</Id>
+      <Acct><Id><IBAN>DE89370400440532013000</IBAN></Id></Acct>
+      <Ntry>
+        <NtryRef>1</NtryRef>
+        <Amt Ccy="EUR">57.14</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><Dt>2012-11-14</Dt></BookgDt>
+        <AcctSvcrRef>REF001</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <RltdPties>
+            <Dbtr><Pty><Nm>John Doe</Nm></Pty></Dbtr>
+            <Cdtr><Pty><Nm>Whole Foods</Nm></Pty></Cdtr>
+          </RltdPties>
+          <RmtInf><Ustrd>Invoice 123</Ustrd><Ustrd>Groceries</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">2000.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><DtTm>2012-11-15T08:00:00</DtTm></BookgDt>
+        <AcctSvcrRef>REF002</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <RltdPties><Dbtr><Nm>Acme Corp</Nm></Dbtr></RltdPties>
+          <RmtInf><Ustrd>Salary</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">10.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <RvslInd>true</RvslInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><Dt>2012-11-15</Dt></BookgDt>
+        <AcctSvcrRef>REF003</AcctSvcrRef>
+        <AddtlNtryInf>Reversed card fee</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">99.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>PDNG</Cd></Sts>
+        <BookgDt><Dt>2012-11-15</Dt></BookgDt>
+        <AcctSvcrRef>REF004</AcctSvcrRef>
+        <AddtlNtryInf>Pending</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">5.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><Dt>2012-11-13</Dt></BookgDt>
+        <AcctSvcrRef>REF005</AcctSvcrRef>
+        <AddtlNtryInf>Too early</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <NtryRef>1</NtryRef>
+        <Amt Ccy="EUR">3.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><Dt>2012-11-15</Dt></BookgDt>
+        <AddtlNtryInf>Coffee</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">3.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><Dt>2012-11-15</Dt></BookgDt>
+        <AddtlNtryInf>Coffee</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>
+`
+
+const kMultiAccountCamt = `<Document>
+  <BkToCstmrStmt>
+    <Stmt>
+      <Acct><Id><IBAN>DE89370400440532013000</IBAN></Id></Acct>
+      <Ntry>
+        <Amt Ccy="EUR">12.12</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><Dt>2012-11-15</Dt></BookgDt>
+        <AcctSvcrRef>A1</AcctSvcrRef>
+        <AddtlNtryInf>Safeway</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+    <Stmt>
+      <Acct><Id><Othr><Id>12345</Id></Othr></Id></Acct>
+      <Ntry>
+        <Amt Ccy="EUR">23.04</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><Dt>2012-11-16</Dt></BookgDt>
+        <AcctSvcrRef>B1</AcctSvcrRef>
+        <AddtlNtryInf>Ava's</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>
+`
+
+func TestReadCamt(t *testing.T) {
+	loader := CamtLoader{Store: make(storeType)}
+	batch, err := loader.Load(
+		3, "", strings.NewReader(kSampleCamt), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 14),
+			Name:       "Whole Foods",
+			Desc:       "Invoice 123 Groceries",
+			CatPayment: fin.NewCatPayment(fin.Expense, 5714, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Acme Corp",
+			Desc:       "Salary",
+			CatPayment: fin.NewCatPayment(fin.Expense, -200000, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Reversed card fee",
+			CatPayment: fin.NewCatPayment(fin.Expense, 1000, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Coffee",
+			CatPayment: fin.NewCatPayment(fin.Expense, 300, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Coffee",
+			CatPayment: fin.NewCatPayment(fin.Expense, 300, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+	qentries := batch.(*qfx.QfxBatch).QfxEntries
+	for i, expected := range []string{"REF001", "REF002", "REF003"} {
+		if qentries[i].FitId != expected {
+			t.Errorf("Expected fitId %s, got %s", expected, qentries[i].FitId)
+		}
+	}
+	// NtryRef is unique only within a statement, so it is never the fitId.
+	if qentries[3].FitId == "1" {
+		t.Error("Expected synthetic fitId for entry without bank reference")
+	}
+	if qentries[3].FitId == qentries[4].FitId {
+		t.Error("Expected different fitIds for identical entries")
+	}
+}
+
+func TestFitIds(t *testing.T) {
+	loader := CamtLoader{Store: make(storeType)}
+	batch, err := loader.Load(
+		3, "", strings.NewReader(kSampleCamt), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	batch.MarkProcessed(nil, 0)
+	batch, err = loader.Load(
+		3, "", strings.NewReader(kSampleCamt), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	// Reading the same file again gives the same fitIds.
+	if batch, _ = batch.SkipProcessed(nil); batch.Len() != 0 {
+		t.Errorf("Expected no new entries, got %d", batch.Len())
+	}
+}
+
+func TestReadCamtMultipleAccounts(t *testing.T) {
+	loader := CamtLoader{Store: make(storeType)}
+	_, err := loader.Load(
+		3, "", strings.NewReader(kMultiAccountCamt), date_util.YMD(2012, 11, 14))
+	if err == nil {
+		t.Error("Expected error when not choosing an account")
+	}
+	batch, err := loader.Load(
+		3, "de89 3704 0044 0532 0130 00", strings.NewReader(kMultiAccountCamt),
+		date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Safeway",
+			CatPayment: fin.NewCatPayment(fin.Expense, 1212, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+	batch, err = loader.Load(
+		3, "12345", strings.NewReader(kMultiAccountCamt),
+		date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if batch.Len() != 1 {
+		t.Errorf("Expected 1 entry, got %d", batch.Len())
+	}
+}
+
+func TestReadCamtReversals(t *testing.T) {
+	const reversals = `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt><Stmt>
+    <Acct><Id><IBAN>DE89370400440532013000</IBAN></Id></Acct>
+    <Ntry>
+      <Amt Ccy="EUR">25.00</Amt>
+      <CdtDbtInd>DBIT</CdtDbtInd>
+      <RvslInd>true</RvslInd>
+      <Sts>BOOK</Sts>
+      <BookgDt><Dt>2012-11-15</Dt></BookgDt>
+      <AcctSvcrRef>R1</AcctSvcrRef>
+      <AddtlNtryInf>Returned deposit</AddtlNtryInf>
+    </Ntry>
+    <Ntry>
+      <Amt Ccy="EUR">40.00</Amt>
+      <CdtDbtInd>CRDT</CdtDbtInd>
+      <RvslInd>true</RvslInd>
+      <Sts>BOOK</Sts>
+      <BookgDt><Dt>2012-11-15</Dt></BookgDt>
+      <AcctSvcrRef>R2</AcctSvcrRef>
+      <AddtlNtryInf>Returned payment</AddtlNtryInf>
+    </Ntry>
+  </Stmt></BkToCstmrStmt>
+</Document>`
+	loader := CamtLoader{Store: make(storeType)}
+	batch, err := loader.Load(
+		3, "", strings.NewReader(reversals), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	// A reversed debit takes money out of the account just like any
+	// other debit.
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Returned deposit",
+			CatPayment: fin.NewCatPayment(fin.Expense, 2500, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Returned payment",
+			CatPayment: fin.NewCatPayment(fin.Expense, -4000, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+}
+
+func TestReadCamtErrors(t *testing.T) {
+	bad := []string{
+		"Not a camt file",
+		"<Other><BkToCstmrStmt><Stmt></Stmt></BkToCstmrStmt></Other>",
+		"<Document><BkToCstmrStmt><Stmt><Ntry><Amt>1.00</Amt><CdtDbtInd>XXXX</CdtDbtInd><BookgDt><Dt>2012-11-15</Dt></BookgDt><AddtlNtryInf>Bad</AddtlNtryInf></Ntry></Stmt></BkToCstmrStmt></Document>",
+		"<Document><BkToCstmrStmt><Stmt><Ntry><Amt>ten</Amt><CdtDbtInd>DBIT</CdtDbtInd><BookgDt><Dt>2012-11-15</Dt></BookgDt><AddtlNtryInf>Bad</AddtlNtryInf></Ntry></Stmt></BkToCstmrStmt></Document>",
+		"<Document><BkToCstmrStmt><Stmt><Ntry><Amt>1.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><BookgDt><Dt>2012-13-15</Dt></BookgDt><AddtlNtryInf>Bad</AddtlNtryInf></Ntry></Stmt></BkToCstmrStmt></Document>",
+		"<Document><BkToCstmrStmt><Stmt><Ntry><Amt>1.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><BookgDt><Dt>2012-11-15</Dt></BookgDt></Ntry></Stmt></BkToCstmrStmt></Document>",
+	}
+	loader := CamtLoader{Store: make(storeType)}
+	for _, contents := range bad {
+		_, err := loader.Load(
+			3, "", strings.NewReader(contents), date_util.YMD(2012, 11, 14))
+		if err == nil {
+			t.Errorf("Expected error reading %q", contents)
+		}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	loader := CamtLoader{}
+	if score := loader.Sniff([]byte(kSampleCamt)); score != autoimport.MaxScore {
+		t.Errorf("Expected %d, got %d", autoimport.MaxScore, score)
+	}
+	if score := loader.Sniff([]byte(kMultiAccountCamt)); score < 50 {
+		t.Errorf("Expected high score, got %d", score)
+	}
+	if score := loader.Sniff([]byte("<Document></Document>")); score != 0 {
+		t.Errorf("Expected 0, got %d", score)
+	}
+}
+
+var _ autoimport.Loader = CamtLoader{}
+
+type storeType map[int64]map[string]struct{}
+
+func (s storeType) Add(t db.Transaction, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
+	if s[accountId] == nil {
+		s[accountId] = make(map[string]struct{})
+	}
+	for fitId := range fitIds {
+		s[accountId][fitId] = struct{}{}
+	}
+	return nil
+}
+
+func (s storeType) Find(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) (qfxdb.FitIdSet, error) {
+	var result qfxdb.FitIdSet
+	for fitId := range fitIds {
+		if _, ok := s[accountId][fitId]; ok {
+			if result == nil {
+				result = make(qfxdb.FitIdSet)
+			}
+			result[fitId] = struct{}{}
+		}
+	}
+	return result, nil
+}
+
+func (s storeType) Remove(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+	for fitId := range fitIds {
+		delete(s[accountId], fitId)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@
 package csv
 
 import (
+	"bytes"
 	gocsv "encoding/csv"
 	"errors"
 	"fmt"
@@ -17,9 +18,16 @@ import (
 )
 
 // CsvLoader implements the autoimport.Loader interface for csv files.
+// CsvLoader understands the csv files that ledger exports along with
+// those of PayPal and Chase and any described by Profiles.
 type CsvLoader struct {
 	// Store stores which transactions have already been processed.
 	Store qfxdb.Store
+
+	// Profiles describe the csv files of other banks. The first
+	// matching profile wins. Profiles take precedence over the built in
+	// layouts.
+	Profiles []Profile
 }
 
 func (c CsvLoader) Load(
@@ -28,19 +36,28 @@ func (c CsvLoader) Load(
 	r io.Reader,
 	startDate time.Time) (autoimport.Batch, error) {
 	reader := gocsv.NewReader(r)
-	line, err := reader.Read()
+	// Rows before the header row may have any number of columns.
+	reader.FieldsPerRecord = -1
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	parser, headerIdx, err := c.findParser(lines)
 	if err != nil {
 		return nil, err
 	}
-	parser := fromHeader(line)
 	if parser == nil {
 		return nil, errors.New("Unrecognized csv header")
 	}
+	columnCount := len(lines[headerIdx])
 	var result []*qfx.QfxEntry
-	for line, err = reader.Read(); err == nil; line, err = reader.Read() {
+	for _, line := range lines[headerIdx+1:] {
+		if len(line) != columnCount {
+			return nil, fmt.Errorf(
+				"csv row has %d columns instead of %d", len(line), columnCount)
+		}
 		var qentry qfx.QfxEntry
-		var ok bool
-		ok, err = parser.ParseLine(line, accountId, &qentry.Entry)
+		ok, err := parser.ParseLine(line, accountId, &qentry.Entry)
 		if err != nil {
 			return nil, err
 		}
@@ -58,12 +75,61 @@ func (c CsvLoader) Load(
 		}
 		result = append(result, &qentry)
 	}
-	if err != io.EOF {
-		return nil, err
-	}
 	return &qfx.QfxBatch{Store: c.Store, AccountId: accountId, QfxEntries: result}, nil
 }
 
+// Sniff recognizes csv files with a known header row. Otherwise, Sniff
+// gives a low score to text whose rows have the same number of columns.
+func (c CsvLoader) Sniff(head []byte) int {
+	reader := gocsv.NewReader(bytes.NewReader(head))
+	reader.FieldsPerRecord = -1
+	var lines [][]string
+	// head may end in the middle of a row, so keep the rows before the
+	// first error.
+	for {
+		line, err := reader.Read()
+		if err != nil {
+			break
+		}
+		lines = append(lines, line)
+	}
+	if parser, _, _ := c.findParser(lines); parser != nil {
+		return autoimport.MaxScore * 9 / 10
+	}
+	if len(lines) < 2 || len(lines[0]) < 2 {
+		return 0
+	}
+	for _, line := range lines[1 : len(lines)-1] {
+		if len(line) != len(lines[0]) {
+			return 0
+		}
+	}
+	return autoimport.MaxScore / 10
+}
+
+// findParser returns the parser for the csv file with given lines along
+// with the index of the header row. findParser returns nil if no parser
+// understands the file.
+func (c CsvLoader) findParser(
+	lines [][]string) (parser csvParser, headerIdx int, err error) {
+	for i := range c.Profiles {
+		p := &c.Profiles[i]
+		if p.Skip < len(lines) && p.matches(lines[p.Skip]) {
+			parser, err := newProfileParser(p)
+			if err != nil {
+				return nil, 0, err
+			}
+			return parser, p.Skip, nil
+		}
+	}
+	if len(lines) > 0 {
+		if parser := fromHeader(lines[0]); parser != nil {
+			return parser, 0, nil
+		}
+	}
+	return nil, 0, nil
+}
+
 // csvParser is responsible for parsing csv files.
 type csvParser interface {
 
@@ -51,7 +51,7 @@ Date, Time, Time Zone, Name, Type, Status, Amount, Receipt ID, Balance,
 func TestReadBadCsvFile(t *testing.T) {
 	r := strings.NewReader("A bad file\nNo CSV things in here\n")
 	var loader autoimport.Loader
-	loader = csv.CsvLoader{make(storeType)}
+	loader = csv.CsvLoader{Store: make(storeType)}
 	_, err := loader.Load(3, "", r, date_util.YMD(2012, 11, 14))
 	if err == nil {
 		t.Error("Expected error")
@@ -60,7 +60,7 @@ func TestReadBadCsvFile(t *testing.T) {
 
 func TestReadCsvWithEntryMissingName(t *testing.T) {
 	var loader autoimport.Loader
-	loader = csv.CsvLoader{make(storeType)}
+	loader = csv.CsvLoader{Store: make(storeType)}
 	r := strings.NewReader(kMissingNameCsv)
 	_, err := loader.Load(3, "", r, date_util.YMD(2015, 9, 3))
 	if err != nil {
@@ -76,7 +76,7 @@ func TestReadCsvWithEntryMissingName(t *testing.T) {
 func TestReadPaypalCsv(t *testing.T) {
 	r := strings.NewReader(kPaypalCsv)
 	var loader autoimport.Loader
-	loader = csv.CsvLoader{make(storeType)}
+	loader = csv.CsvLoader{Store: make(storeType)}
 	batch, err := loader.Load(3, "", r, date_util.YMD(2015, 9, 3))
 	if err != nil {
 		t.Errorf("Got error %v", err)
@@ -104,7 +104,7 @@ func TestReadPaypalCsv(t *testing.T) {
 func TestReadChaseCsv(t *testing.T) {
 	r := strings.NewReader(kChaseCsv)
 	var loader autoimport.Loader
-	loader = csv.CsvLoader{make(storeType)}
+	loader = csv.CsvLoader{Store: make(storeType)}
 	batch, err := loader.Load(3, "", r, date_util.YMD(2023, 10, 12))
 	if err != nil {
 		t.Errorf("Got error %v", err)
@@ -130,7 +130,7 @@ func TestReadChaseCsv(t *testing.T) {
 func TestReadChaseCsvNoCard(t *testing.T) {
 	r := strings.NewReader(kChaseCsvNoCard)
 	var loader autoimport.Loader
-	loader = csv.CsvLoader{make(storeType)}
+	loader = csv.CsvLoader{Store: make(storeType)}
 	batch, err := loader.Load(3, "", r, date_util.YMD(2023, 10, 12))
 	if err != nil {
 		t.Errorf("Got error %v", err)
@@ -159,7 +159,7 @@ func TestReadChaseCsvFormatChanged(t *testing.T) {
 	// Chase CSV file format changes.
 	r := strings.NewReader(kChaseCsv)
 	var loader autoimport.Loader
-	loader = csv.CsvLoader{make(storeType)}
+	loader = csv.CsvLoader{Store: make(storeType)}
 	batch, err := loader.Load(3, "", r, date_util.YMD(2023, 10, 12))
 	if err != nil {
 		t.Errorf("Got error %v", err)
@@ -167,7 +167,7 @@ func TestReadChaseCsvFormatChanged(t *testing.T) {
 	}
 	assert.NotEmpty(t, batch.Entries())
 
-	batch.MarkProcessed(nil)
+	batch.MarkProcessed(nil, 0)
 
 	r = strings.NewReader(kChaseCsvNoCard)
 	newBatch, err := loader.Load(3, "", r, date_util.YMD(2023, 10, 12))
@@ -186,7 +186,7 @@ func TestReadChaseCsvFormatChanged(t *testing.T) {
 func TestReadChaseCsvNoCardNoTransactions(t *testing.T) {
 	r := strings.NewReader(kChaseCsvNoCard)
 	var loader autoimport.Loader
-	loader = csv.CsvLoader{make(storeType)}
+	loader = csv.CsvLoader{Store: make(storeType)}
 	batch, err := loader.Load(3, "", r, date_util.YMD(2023, 10, 13))
 	if err != nil {
 		t.Errorf("Got error %v", err)
@@ -195,16 +195,136 @@ func TestReadChaseCsvNoCardNoTransactions(t *testing.T) {
 	assert.Empty(t, batch.Entries())
 }
 
+const kProfiles = `
+- name: Credit union
+  skip: 2
+  header: [Posted, Check, Description, Memo, Withdrawal, Deposit]
+  date: posted
+  payee: Description
+  memo: Memo
+  checkNo: Check
+  debit: Withdrawal
+  credit: Deposit
+  dateFormat: YYYY-MM-DD
+- name: Sparkasse
+  header: [Buchungstag, Empfaenger, Betrag]
+  date: Buchungstag
+  payee: Empfaenger
+  amount: Betrag
+  dateFormat: DD.MM.YYYY
+  decimalComma: true
+- name: Card
+  header: [Date, Merchant, Charge]
+  date: Date
+  payee: Merchant
+  amount: Charge
+  negate: true
+`
+
+const kCreditUnionCsv = `Account 1234
+Statement for October
+Posted,Check,Description,Memo,Withdrawal,Deposit
+2023-10-12,1001,Landlord,October rent,"$1,500.00",
+2023-10-13,,Employer,,,"2,000.00"
+,,Ending balance,,,
+`
+
+const kSparkasseCsv = `Buchungstag,Empfaenger,Betrag
+12.10.2023,Baeckerei,"-1.234,56"
+`
+
+const kCardCsv = `Date,Merchant,Charge
+10/12/2023,Grocer,42.99
+10/13/2023,Refund,(5.00)
+`
+
+func TestReadProfileCsv(t *testing.T) {
+	profiles, err := csv.ReadProfiles(strings.NewReader(kProfiles))
+	if err != nil {
+		t.Fatalf("Got error reading profiles %v", err)
+	}
+	loader := csv.CsvLoader{Store: make(storeType), Profiles: profiles}
+	batch, err := loader.Load(
+		3, "", strings.NewReader(kCreditUnionCsv), date_util.YMD(2023, 10, 12))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2023, 10, 12),
+			CheckNo:    "1001",
+			Name:       "Landlord",
+			Desc:       "October rent",
+			CatPayment: fin.NewCatPayment(fin.Expense, 150000, true, 3)},
+		{
+			Date:       date_util.YMD(2023, 10, 13),
+			Name:       "Employer",
+			CatPayment: fin.NewCatPayment(fin.Expense, -200000, true, 3)}}
+	assert.Equal(t, expectedEntries, batch.Entries())
+
+	batch, err = loader.Load(
+		3, "", strings.NewReader(kSparkasseCsv), date_util.YMD(2023, 10, 12))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries = []fin.Entry{
+		{
+			Date:       date_util.YMD(2023, 10, 12),
+			Name:       "Baeckerei",
+			CatPayment: fin.NewCatPayment(fin.Expense, 123456, true, 3)}}
+	assert.Equal(t, expectedEntries, batch.Entries())
+
+	batch, err = loader.Load(
+		3, "", strings.NewReader(kCardCsv), date_util.YMD(2023, 10, 12))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries = []fin.Entry{
+		{
+			Date:       date_util.YMD(2023, 10, 12),
+			Name:       "Grocer",
+			CatPayment: fin.NewCatPayment(fin.Expense, 4299, true, 3)},
+		{
+			Date:       date_util.YMD(2023, 10, 13),
+			Name:       "Refund",
+			CatPayment: fin.NewCatPayment(fin.Expense, -500, true, 3)}}
+	assert.Equal(t, expectedEntries, batch.Entries())
+
+	// Built in layouts still work.
+	batch, err = loader.Load(
+		3, "", strings.NewReader(kChaseCsv), date_util.YMD(2023, 10, 12))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	assert.Len(t, batch.Entries(), 3)
+}
+
+func TestReadBadProfiles(t *testing.T) {
+	bad := []string{
+		"- header: [Date, Name, Amount]\n  date: Date\n  payee: Name\n  amount: Amount\n",
+		"- name: x\n  date: Date\n  payee: Name\n  amount: Amount\n",
+		"- name: x\n  header: [Date, Name, Amount]\n  date: When\n  payee: Name\n  amount: Amount\n",
+		"- name: x\n  header: [Date, Name, Amount]\n  date: Date\n  payee: Name\n",
+		"- name: x\n  header: [Date, Name, Debit]\n  date: Date\n  payee: Name\n  debit: Debit\n",
+		"- name: x\n  header: [Date, Name, Amount]\n  date: Date\n  payee: Name\n  amount: Amount\n  typo: 1\n",
+	}
+	for _, contents := range bad {
+		if _, err := csv.ReadProfiles(strings.NewReader(contents)); err == nil {
+			t.Errorf("Expected error reading %q", contents)
+		}
+	}
+}
+
 func TestMarkProcessed(t *testing.T) {
 	r := strings.NewReader(kPaypalCsv)
 	fitIdStore := make(storeType)
-	loader := csv.CsvLoader{fitIdStore}
+	loader := csv.CsvLoader{Store: fitIdStore}
 	batch, err := loader.Load(3, "", r, date_util.YMD(2015, 9, 3))
 	if err != nil {
 		t.Errorf("Got error %v", err)
 		return
 	}
-	batch.MarkProcessed(nil)
+	batch.MarkProcessed(nil, 0)
 	r = strings.NewReader(kPaypalCsv)
 	newBatch, err := loader.Load(3, "", r, date_util.YMD(2015, 9, 2))
 	if err != nil {
@@ -243,7 +363,7 @@ func validateId(id string) bool {
 
 type storeType map[int64]map[string]struct{}
 
-func (s storeType) Add(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+func (s storeType) Add(t db.Transaction, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
 	if s[accountId] == nil {
 		s[accountId] = make(map[string]struct{})
 	}
@@ -265,3 +385,36 @@ func (s storeType) Find(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet
 	}
 	return result, nil
 }
+
+func (s storeType) Remove(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+	for fitId := range fitIds {
+		delete(s[accountId], fitId)
+	}
+	return nil
+}
+
+func TestSniff(t *testing.T) {
+	profiles, err := csv.ReadProfiles(strings.NewReader(kProfiles))
+	if err != nil {
+		t.Fatalf("Got error reading profiles %v", err)
+	}
+	loader := csv.CsvLoader{Profiles: profiles}
+	for _, contents := range []string{
+		kChaseCsv, kPaypalCsv, kCreditUnionCsv, kSparkasseCsv} {
+		if score := loader.Sniff([]byte(contents)); score < 50 {
+			t.Errorf("Expected high score for %q, got %d", contents, score)
+		}
+	}
+	// A header row cut off by the end of head
+	if score := loader.Sniff([]byte(kPaypalCsv[:40])); score != 0 {
+		t.Errorf("Expected 0 for a partial header, got %d", score)
+	}
+	score := loader.Sniff([]byte("Date,Who,What\n1/2/2023,Me,Something\n"))
+	if score == 0 || score >= 50 {
+		t.Errorf("Expected low score for unknown csv file, got %d", score)
+	}
+	if score := loader.Sniff(
+		[]byte("A bad file\nNo CSV things in here\n")); score != 0 {
+		t.Errorf("Expected 0 for non csv file, got %d", score)
+	}
+}
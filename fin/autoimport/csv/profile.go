@@ -0,0 +1,267 @@
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/keep94/finances/fin"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	kDefaultDateFormat = "M/D/YYYY"
+)
+
+var (
+	kDateFormatReplacer = strings.NewReplacer(
+		"YYYY", "2006",
+		"YY", "06",
+		"MM", "01",
+		"M", "1",
+		"DD", "02",
+		"D", "2")
+)
+
+// Profile describes the layout of the csv files of one bank. Columns are
+// given by their names in the header row.
+type Profile struct {
+	// Name identifies the profile in error messages.
+	Name string `yaml:"name"`
+
+	// Header lists the columns of the header row. A profile matches a
+	// csv file whose header row has exactly these columns ignoring case
+	// and surrounding spaces.
+	Header []string `yaml:"header"`
+
+	// Skip is the number of rows before the header row.
+	Skip int `yaml:"skip"`
+
+	// The column of the date. Rows with an empty date are skipped.
+	Date string `yaml:"date"`
+
+	// The column of the name. Required.
+	Payee string `yaml:"payee"`
+
+	// The column of the memo, optional.
+	Memo string `yaml:"memo"`
+
+	// The column of the check number, optional.
+	CheckNo string `yaml:"checkNo"`
+
+	// The column of the amount. Either Amount or both Debit and Credit
+	// are required.
+	Amount string `yaml:"amount"`
+
+	// The column of the amount of withdrawals
+	Debit string `yaml:"debit"`
+
+	// The column of the amount of deposits
+	Credit string `yaml:"credit"`
+
+	// The format of dates using YYYY, YY, MM, M, DD, and D e.g
+	// DD.MM.YYYY. The default is M/D/YYYY.
+	DateFormat string `yaml:"dateFormat"`
+
+	// If true, positive amounts in the Amount column are withdrawals
+	// rather than deposits.
+	Negate bool `yaml:"negate"`
+
+	// If true, amounts use a comma as the decimal point and periods
+	// between thousands.
+	DecimalComma bool `yaml:"decimalComma"`
+}
+
+// ReadProfiles reads csv profiles in YAML from r. The YAML is a list of
+// profiles.
+func ReadProfiles(r io.Reader) ([]Profile, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var result []Profile
+	if err := yaml.UnmarshalStrict(content, &result); err != nil {
+		return nil, err
+	}
+	for i := range result {
+		if _, err := newProfileParser(&result[i]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// matches returns true if header is the header row of p.
+func (p *Profile) matches(header []string) bool {
+	if len(header) != len(p.Header) {
+		return false
+	}
+	for i := range header {
+		if !sameColumn(header[i], p.Header[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// profileParser parses the csv files of a Profile.
+type profileParser struct {
+	profile      *Profile
+	dateFormat   string
+	dateIdx      int
+	payeeIdx     int
+	memoIdx      int
+	checkNoIdx   int
+	amountIdx    int
+	debitIdx     int
+	creditIdx    int
+	fitIdIndexes []int
+}
+
+func newProfileParser(p *Profile) (*profileParser, error) {
+	if p.Name == "" {
+		return nil, errors.New("csv profile missing name")
+	}
+	if len(p.Header) == 0 {
+		return nil, fmt.Errorf("csv profile %s missing header", p.Name)
+	}
+	if p.Skip < 0 {
+		return nil, fmt.Errorf("csv profile %s: skip must not be negative", p.Name)
+	}
+	result := &profileParser{profile: p}
+	var err error
+	column := func(name string, required bool) int {
+		if err != nil {
+			return -1
+		}
+		if name == "" {
+			if required {
+				err = fmt.Errorf("csv profile %s missing a required column", p.Name)
+			}
+			return -1
+		}
+		for i := range p.Header {
+			if sameColumn(p.Header[i], name) {
+				return i
+			}
+		}
+		err = fmt.Errorf("csv profile %s: no column %s in header", p.Name, name)
+		return -1
+	}
+	result.dateIdx = column(p.Date, true)
+	result.payeeIdx = column(p.Payee, true)
+	result.memoIdx = column(p.Memo, false)
+	result.checkNoIdx = column(p.CheckNo, false)
+	if p.Amount != "" {
+		result.amountIdx = column(p.Amount, true)
+		result.debitIdx, result.creditIdx = -1, -1
+	} else {
+		result.amountIdx = -1
+		result.debitIdx = column(p.Debit, true)
+		result.creditIdx = column(p.Credit, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	dateFormat := p.DateFormat
+	if dateFormat == "" {
+		dateFormat = kDefaultDateFormat
+	}
+	result.dateFormat = kDateFormatReplacer.Replace(dateFormat)
+	for _, idx := range []int{
+		result.dateIdx, result.checkNoIdx, result.payeeIdx,
+		result.memoIdx, result.amountIdx, result.debitIdx,
+		result.creditIdx} {
+		if idx != -1 {
+			result.fitIdIndexes = append(result.fitIdIndexes, idx)
+		}
+	}
+	return result, nil
+}
+
+func (p *profileParser) ParseLine(
+	line []string, accountId int64, entry *fin.Entry) (ok bool, err error) {
+	dateStr := strings.TrimSpace(line[p.dateIdx])
+	if dateStr == "" {
+		return
+	}
+	entry.Date, err = time.Parse(p.dateFormat, dateStr)
+	if err != nil {
+		return
+	}
+	entry.Name = strings.TrimSpace(line[p.payeeIdx])
+	if p.memoIdx != -1 {
+		entry.Desc = strings.TrimSpace(line[p.memoIdx])
+	}
+	if p.checkNoIdx != -1 {
+		entry.CheckNo = strings.TrimSpace(line[p.checkNoIdx])
+	}
+	var amt int64
+	if p.amountIdx != -1 {
+		if amt, err = p.parseAmount(line[p.amountIdx]); err != nil {
+			return
+		}
+		if p.profile.Negate {
+			amt = -amt
+		}
+	} else {
+		var debit, credit int64
+		if debit, err = p.parseAmount(line[p.debitIdx]); err != nil {
+			return
+		}
+		if credit, err = p.parseAmount(line[p.creditIdx]); err != nil {
+			return
+		}
+		amt = abs(credit) - abs(debit)
+	}
+	entry.CatPayment = fin.NewCatPayment(fin.Expense, -amt, true, accountId)
+	ok = true
+	return
+}
+
+func (p *profileParser) FitIdColumnIndexes() []int {
+	return p.fitIdIndexes
+}
+
+// parseAmount parses an amount such as $1,234.56 or (1,234.56). An empty
+// amount is zero.
+func (p *profileParser) parseAmount(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	thousands := ","
+	if p.profile.DecimalComma {
+		thousands = "."
+	}
+	s = strings.NewReplacer("$", "", " ", "", thousands, "").Replace(s)
+	if p.profile.DecimalComma {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	result, err := fin.ParseUSD(s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid amount in csv file: %s", s)
+	}
+	if negative {
+		result = -result
+	}
+	return result, nil
+}
+
+func sameColumn(x, y string) bool {
+	return strings.EqualFold(strings.TrimSpace(x), strings.TrimSpace(y))
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
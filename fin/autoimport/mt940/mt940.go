@@ -0,0 +1,278 @@
+// Package mt940 provides processing of SWIFT MT940 bank statements
+package mt940
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/finances/fin/autoimport/qfx"
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
+	"github.com/keep94/toolbox/date_util"
+)
+
+var (
+	kFieldPattern = regexp.MustCompile(`^:([0-9]{2}[A-Z]?):`)
+
+	// Fields that every statement has
+	kReferenceFieldPattern      = regexp.MustCompile(`(?m)^:20:`)
+	kAccountFieldPattern        = regexp.MustCompile(`(?m)^:25:`)
+	kOpeningBalanceFieldPattern = regexp.MustCompile(`(?m)^:60[FM]:`)
+
+	// value date, booking date, debit/credit mark, funds code, amount,
+	// transaction type, customer reference, bank reference.
+	kStatementLinePattern = regexp.MustCompile(
+		`^([0-9]{6})([0-9]{4})?(RC|RD|C|D)([A-Z])?([0-9]+,[0-9]*)([NSF][A-Z0-9]{3})([^\n]*?)(?://([^\n]*))?(?:\n|$)`)
+
+	// The subfields of structured :86: fields e.g ?20
+	kSubfieldPattern = regexp.MustCompile(`\?([0-9]{2})`)
+
+	// The codes of SWIFT structured :86: fields e.g /NAME/
+	kCodePattern = regexp.MustCompile(`/(NAME|REMI|EREF|IBAN|BIC|ORDP|BENM|ADDR|CSID|MARF|PURP|TRCD|CDTRREFTP|CDTRREF|ULTC|ULTD)/`)
+)
+
+// MT940Loader implements the autoimport.Loader interface for MT940
+// files. The bank reference in each :61: line is the fitId of the
+// transaction. When a file has statements for several accounts,
+// bankAccountId, the account in the :25: field, selects the statements
+// to load.
+type MT940Loader struct {
+	// Store stores which bank references have already been processed.
+	Store qfxdb.Store
+}
+
+func (m MT940Loader) Load(
+	accountId int64,
+	bankAccountId string,
+	r io.Reader,
+	startDate time.Time) (autoimport.Batch, error) {
+	transactions, err := readTransactions(r)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(transactions))
+	for i := range transactions {
+		ids[i] = transactions[i].account
+	}
+	chosen, err := autoimport.ChooseAccount(ids, bankAccountId)
+	if err != nil {
+		return nil, err
+	}
+	var result []*qfx.QfxEntry
+	fitIdCounts := make(map[string]int)
+	for _, trn := range transactions {
+		if trn.account != chosen {
+			continue
+		}
+		var qentry qfx.QfxEntry
+		if err := trn.toEntry(accountId, &qentry.Entry); err != nil {
+			return nil, err
+		}
+		qentry.FitId = trn.bankReference
+		if qentry.FitId == "" {
+			qentry.FitId = autoimport.SyntheticFitId(&qentry.Entry, fitIdCounts)
+		}
+		if qentry.Date.Before(startDate) {
+			continue
+		}
+		if err := qentry.Check(); err != nil {
+			return nil, err
+		}
+		result = append(result, &qentry)
+	}
+	return &qfx.QfxBatch{Store: m.Store, AccountId: accountId, QfxEntries: result}, nil
+}
+
+// Sniff recognizes files with the :20: and :25: fields that start each
+// statement.
+func (m MT940Loader) Sniff(head []byte) int {
+	if !kReferenceFieldPattern.Match(head) || !kAccountFieldPattern.Match(head) {
+		return 0
+	}
+	if kOpeningBalanceFieldPattern.Match(head) {
+		return autoimport.MaxScore * 9 / 10
+	}
+	return autoimport.MaxScore * 6 / 10
+}
+
+// transaction is a :61: field along with the :86: field after it.
+type transaction struct {
+	// The :25: field of the statement
+	account       string
+	statementLine string
+	information   string
+	bankReference string
+}
+
+// readTransactions reads the transactions of all the statements in an
+// MT940 file.
+func readTransactions(r io.Reader) ([]*transaction, error) {
+	scanner := bufio.NewScanner(r)
+	var result []*transaction
+	var account string
+	var tag string
+	var value strings.Builder
+	foundStatement := false
+	flush := func() {
+		switch tag {
+		case "25":
+			account = strings.TrimSpace(value.String())
+		case "61":
+			result = append(result, &transaction{
+				account: account, statementLine: value.String()})
+		case "86":
+			if len(result) > 0 && result[len(result)-1].information == "" {
+				result[len(result)-1].information = value.String()
+			}
+		}
+		tag = ""
+		value.Reset()
+	}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		// Skip SWIFT envelope and the end of each message.
+		if strings.HasPrefix(line, "{") || line == "-" || line == "-}" {
+			flush()
+			continue
+		}
+		if match := kFieldPattern.FindStringSubmatch(line); match != nil {
+			flush()
+			tag = match[1]
+			if tag == "20" {
+				foundStatement = true
+			}
+			value.WriteString(line[len(match[0]):])
+			continue
+		}
+		if tag != "" {
+			value.WriteString("\n")
+			value.WriteString(line)
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !foundStatement {
+		return nil, errors.New("Not an MT940 file.")
+	}
+	return result, nil
+}
+
+func (t *transaction) toEntry(accountId int64, entry *fin.Entry) error {
+	match := kStatementLinePattern.FindStringSubmatch(t.statementLine)
+	if match == nil {
+		return fmt.Errorf("Invalid :61: line in MT940 file: %s", t.statementLine)
+	}
+	valueDate, err := time.Parse("060102", match[1])
+	if err != nil {
+		return fmt.Errorf("Invalid date in MT940 file: %s", match[1])
+	}
+	entry.Date = valueDate
+	if match[2] != "" {
+		entry.Date, err = bookingDate(valueDate, match[2])
+		if err != nil {
+			return err
+		}
+	}
+	amt, err := fin.ParseUSD(strings.Replace(match[5], ",", ".", 1))
+	if err != nil {
+		return fmt.Errorf("Invalid amount in MT940 file: %s", match[5])
+	}
+	// RC reverses a credit and RD reverses a debit.
+	if match[3] == "D" || match[3] == "RC" {
+		amt = -amt
+	}
+	t.bankReference = strings.TrimSpace(match[8])
+	entry.Name, entry.Desc = parseInformation(t.information)
+	if entry.Name == "" {
+		entry.Name = supplementaryDetails(t.statementLine)
+	}
+	if entry.Name == "" {
+		entry.Name = entry.Desc
+	}
+	entry.CatPayment = fin.NewCatPayment(fin.Expense, -amt, true, accountId)
+	return nil
+}
+
+// bookingDate returns the booking date from its month and day in mmdd.
+// The booking date is within a few days of valueDate but may fall in the
+// year before or after.
+func bookingDate(valueDate time.Time, mmdd string) (time.Time, error) {
+	month, _ := strconv.Atoi(mmdd[:2])
+	day, _ := strconv.Atoi(mmdd[2:])
+	result := date_util.YMD(valueDate.Year(), month, day)
+	if result.Month() != time.Month(month) || result.Day() != day {
+		return time.Time{}, fmt.Errorf("Invalid booking date in MT940 file: %s", mmdd)
+	}
+	if result.Sub(valueDate) > 180*24*time.Hour {
+		result = result.AddDate(-1, 0, 0)
+	} else if valueDate.Sub(result) > 180*24*time.Hour {
+		result = result.AddDate(1, 0, 0)
+	}
+	return result, nil
+}
+
+// supplementaryDetails returns the second line of a :61: field, if any.
+func supplementaryDetails(statementLine string) string {
+	_, details, _ := strings.Cut(statementLine, "\n")
+	return strings.TrimSpace(strings.ReplaceAll(details, "\n", " "))
+}
+
+// parseInformation returns the counterparty name and the remittance
+// information in a :86: field. It understands the ?nn subfields German
+// banks use and the /CODE/ fields of SWIFT. Otherwise, the first line of
+// free text is the name and the rest is the remittance information.
+func parseInformation(info string) (name, remittance string) {
+	lines := strings.Split(info, "\n")
+	info = strings.Join(lines, "")
+	if idxs := kSubfieldPattern.FindAllStringSubmatchIndex(info, -1); idxs != nil {
+		var names, remittances []string
+		for i, idx := range idxs {
+			end := len(info)
+			if i+1 < len(idxs) {
+				end = idxs[i+1][0]
+			}
+			// Long names span ?32 and ?33 and may break between words.
+			value := info[idx[1]:end]
+			code, _ := strconv.Atoi(info[idx[2]:idx[3]])
+			switch {
+			case code == 32 || code == 33:
+				names = append(names, value)
+			case code >= 20 && code <= 29, code >= 60 && code <= 63:
+				remittances = append(remittances, strings.TrimSpace(value))
+			}
+		}
+		return strings.TrimSpace(strings.Join(names, "")),
+			strings.Join(remittances, " ")
+	}
+	if idxs := kCodePattern.FindAllStringSubmatchIndex(info, -1); idxs != nil {
+		for i, idx := range idxs {
+			end := len(info)
+			if i+1 < len(idxs) {
+				end = idxs[i+1][0]
+			}
+			value := strings.TrimSpace(strings.Trim(info[idx[1]:end], "/"))
+			switch info[idx[2]:idx[3]] {
+			case "NAME":
+				if name == "" {
+					name = value
+				}
+			case "REMI":
+				remittance = value
+			}
+		}
+		return name, remittance
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines[0], strings.TrimSpace(strings.Join(lines[1:], " "))
+}
@@ -0,0 +1,231 @@
+package mt940
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/finances/fin/autoimport/qfx"
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+)
+
+const kSampleMT940 = `{1:F01BANKDEFFXXXX0000000000}{2:I940BANKDEFFXXXXN}{4:
+:20:STMT1
+:25:37040044/0532013000
+:28C:1/1
+:60F:C121113EUR1000,00
+:61:1211141114D57,14NTRFNONREF//REF001
+:86:166?00SEPA-UEBERWEISUNG?20Invoice 123?21Groceries?32Whole?33 Foods
+:61:1211151115C2000,00NTRFPAYROLL
+:86:/NAME/Acme Corp/REMI/Salary
+:61:1211151115RD10,00NCHG//REF003
+Reversed card fee
+:61:121113D5,00NMSC//REF005
+:86:Too early
+:61:121115D3,00NMSCNONREF
+:86:Coffee
+:61:121115D3,00NMSCNONREF
+:86:Coffee
+:61:121115D4,00NMSCNONREF
+:86:Bakery
+Bread and
+ rolls
+:62F:C121115EUR2932,86
+-}
+`
+
+const kMultiAccountMT940 = `:20:STMT1
+:25:37040044/0532013000
+:60F:C121113EUR1000,00
+:61:121115D12,12NMSC//A1
+:86:Safeway
+:62F:C121115EUR987,88
+-
+:20:STMT2
+:25:12345
+:60F:C121113EUR1000,00
+:61:121116D23,04NMSC//B1
+:86:Ava's
+:62F:C121116EUR976,96
+-
+`
+
+func TestReadMT940(t *testing.T) {
+	loader := MT940Loader{Store: make(storeType)}
+	batch, err := loader.Load(
+		3, "", strings.NewReader(kSampleMT940), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 14),
+			Name:       "Whole Foods",
+			Desc:       "Invoice 123 Groceries",
+			CatPayment: fin.NewCatPayment(fin.Expense, 5714, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Acme Corp",
+			Desc:       "Salary",
+			CatPayment: fin.NewCatPayment(fin.Expense, -200000, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Reversed card fee",
+			CatPayment: fin.NewCatPayment(fin.Expense, -1000, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Coffee",
+			CatPayment: fin.NewCatPayment(fin.Expense, 300, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Coffee",
+			CatPayment: fin.NewCatPayment(fin.Expense, 300, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Bakery",
+			Desc:       "Bread and rolls",
+			CatPayment: fin.NewCatPayment(fin.Expense, 400, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+	qentries := batch.(*qfx.QfxBatch).QfxEntries
+	for i, expected := range []string{"REF001", "", "REF003"} {
+		if expected != "" && qentries[i].FitId != expected {
+			t.Errorf("Expected fitId %s, got %s", expected, qentries[i].FitId)
+		}
+	}
+	// The customer reference is not unique, so it is never the fitId.
+	if qentries[1].FitId == "PAYROLL" {
+		t.Error("Expected synthetic fitId for entry without bank reference")
+	}
+	if qentries[3].FitId == qentries[4].FitId {
+		t.Error("Expected different fitIds for identical entries")
+	}
+}
+
+func TestFitIds(t *testing.T) {
+	loader := MT940Loader{Store: make(storeType)}
+	batch, err := loader.Load(
+		3, "", strings.NewReader(kSampleMT940), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	batch.MarkProcessed(nil, 0)
+	batch, err = loader.Load(
+		3, "", strings.NewReader(kSampleMT940), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	// Reading the same file again gives the same fitIds.
+	if batch, _ = batch.SkipProcessed(nil); batch.Len() != 0 {
+		t.Errorf("Expected no new entries, got %d", batch.Len())
+	}
+}
+
+func TestReadMT940MultipleAccounts(t *testing.T) {
+	loader := MT940Loader{Store: make(storeType)}
+	_, err := loader.Load(
+		3, "", strings.NewReader(kMultiAccountMT940), date_util.YMD(2012, 11, 14))
+	if err == nil {
+		t.Error("Expected error when not choosing an account")
+	}
+	batch, err := loader.Load(
+		3, "12345", strings.NewReader(kMultiAccountMT940),
+		date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 16),
+			Name:       "Ava's",
+			CatPayment: fin.NewCatPayment(fin.Expense, 2304, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+}
+
+func TestReadMT940Errors(t *testing.T) {
+	bad := []string{
+		"Not an MT940 file\n",
+		":20:STMT1\n:25:12345\n:61:garbage\n:86:Bad\n",
+		":20:STMT1\n:25:12345\n:61:121315D1,00NMSC//X\n:86:Bad date\n",
+		":20:STMT1\n:25:12345\n:61:1211151345D1,00NMSC//X\n:86:Bad booking date\n",
+		":20:STMT1\n:25:12345\n:61:121115D1,00NMSC//X\n",
+	}
+	loader := MT940Loader{Store: make(storeType)}
+	for _, contents := range bad {
+		_, err := loader.Load(
+			3, "", strings.NewReader(contents), date_util.YMD(2012, 11, 14))
+		if err == nil {
+			t.Errorf("Expected error reading %q", contents)
+		}
+	}
+}
+
+func TestBookingDate(t *testing.T) {
+	date, err := bookingDate(date_util.YMD(2012, 12, 31), "0102")
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if expected := date_util.YMD(2013, 1, 2); date != expected {
+		t.Errorf("Expected %v, got %v", expected, date)
+	}
+	date, err = bookingDate(date_util.YMD(2013, 1, 2), "1231")
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if expected := date_util.YMD(2012, 12, 31); date != expected {
+		t.Errorf("Expected %v, got %v", expected, date)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	loader := MT940Loader{}
+	for _, contents := range []string{kSampleMT940, kMultiAccountMT940} {
+		if score := loader.Sniff([]byte(contents)); score < 50 {
+			t.Errorf("Expected high score, got %d", score)
+		}
+	}
+	if score := loader.Sniff([]byte("Reference :20:STMT1 :25:12345\n")); score != 0 {
+		t.Errorf("Expected 0, got %d", score)
+	}
+}
+
+var _ autoimport.Loader = MT940Loader{}
+
+type storeType map[int64]map[string]struct{}
+
+func (s storeType) Add(t db.Transaction, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
+	if s[accountId] == nil {
+		s[accountId] = make(map[string]struct{})
+	}
+	for fitId := range fitIds {
+		s[accountId][fitId] = struct{}{}
+	}
+	return nil
+}
+
+func (s storeType) Find(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) (qfxdb.FitIdSet, error) {
+	var result qfxdb.FitIdSet
+	for fitId := range fitIds {
+		if _, ok := s[accountId][fitId]; ok {
+			if result == nil {
+				result = make(qfxdb.FitIdSet)
+			}
+			result[fitId] = struct{}{}
+		}
+	}
+	return result, nil
+}
+
+func (s storeType) Remove(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+	for fitId := range fitIds {
+		delete(s[accountId], fitId)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package qfx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/keep94/finances/fin/autoimport"
+)
+
+var (
+	kOFXTag    = []byte("<OFX>")
+	kOFXHeader = []byte("OFXHEADER")
+)
+
+// element is an element of an OFX file. Aggregates have children; other
+// elements have a value.
+type element struct {
+	name     string
+	value    string
+	children []*element
+}
+
+// child returns the first child of e with given name or nil if there
+// is none. child is safe to call on a nil element.
+func (e *element) child(name string) *element {
+	if e == nil {
+		return nil
+	}
+	for _, c := range e.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// childValue returns the value of the first child of e with given name
+// or the empty string if there is no such child.
+func (e *element) childValue(name string) string {
+	if c := e.child(name); c != nil {
+		return c.value
+	}
+	return ""
+}
+
+// childrenNamed returns the children of e with any of the given names.
+func (e *element) childrenNamed(names ...string) []*element {
+	if e == nil {
+		return nil
+	}
+	var result []*element
+	for _, c := range e.children {
+		for _, name := range names {
+			if c.name == name {
+				result = append(result, c)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// parseOFX parses the contents of an OFX file and returns the OFX
+// element. parseOFX understands both OFX 1.x files which are SGML and
+// OFX 2.x files which are XML. In SGML, elements that hold a value need
+// not have an end tag; an element ends when the next element begins or
+// when an enclosing element ends. Like most banks, parseOFX tolerates
+// files that stop before closing their outermost elements.
+func parseOFX(contents []byte) (*element, error) {
+	start := bytes.Index(contents, kOFXTag)
+	if start == -1 {
+		return nil, errors.New("Not an OFX file.")
+	}
+	contents = contents[start:]
+	root := &element{}
+	stack := []*element{root}
+	for len(contents) > 0 {
+		lt := bytes.IndexByte(contents, '<')
+		if lt == -1 {
+			lt = len(contents)
+		}
+		if text := strings.TrimSpace(string(contents[:lt])); text != "" {
+			top := stack[len(stack)-1]
+			if top == root || len(top.children) > 0 {
+				return nil, fmt.Errorf(
+					"Malformed OFX file: unexpected text %q.", truncate(text))
+			}
+			top.value = html.UnescapeString(text)
+		}
+		if lt == len(contents) {
+			break
+		}
+		contents = contents[lt:]
+		gt := bytes.IndexByte(contents, '>')
+		if gt == -1 {
+			return nil, errors.New("Malformed OFX file: unterminated tag.")
+		}
+		tag := string(contents[1:gt])
+		contents = contents[gt+1:]
+		switch {
+		case strings.HasPrefix(tag, "?"), strings.HasPrefix(tag, "!"):
+			// Processing instructions and comments
+		case strings.HasPrefix(tag, "/"):
+			name := strings.TrimSpace(tag[1:])
+			idx := len(stack) - 1
+			for idx > 0 && stack[idx].name != name {
+				idx--
+			}
+			if idx == 0 {
+				return nil, fmt.Errorf(
+					"Malformed OFX file: unexpected </%s>.", name)
+			}
+			for len(stack)-1 > idx {
+				stack = closeImplicitly(stack)
+			}
+			stack = stack[:idx]
+		default:
+			selfClosing := strings.HasSuffix(tag, "/")
+			name := strings.TrimSuffix(tag, "/")
+			if i := strings.IndexAny(name, " \t\r\n"); i != -1 {
+				name = name[:i]
+			}
+			if name == "" {
+				return nil, errors.New("Malformed OFX file: empty tag.")
+			}
+			// An element with a value ends when the next element begins.
+			if top := stack[len(stack)-1]; top.value != "" {
+				stack = stack[:len(stack)-1]
+			}
+			parent := stack[len(stack)-1]
+			e := &element{name: name}
+			parent.children = append(parent.children, e)
+			if !selfClosing {
+				stack = append(stack, e)
+			}
+		}
+	}
+	for _, e := range stack {
+		if e.name == "STMTTRN" {
+			return nil, errors.New(
+				"Malformed OFX file: file ends in the middle of a transaction.")
+		}
+	}
+	if ofx := root.child("OFX"); ofx != nil {
+		return ofx, nil
+	}
+	return nil, errors.New("Not an OFX file.")
+}
+
+// closeImplicitly pops the top element off of stack when an enclosing
+// element ends. Since only elements holding a value may omit their end
+// tag, what looked like children of the popped element belong to its
+// parent.
+func closeImplicitly(stack []*element) []*element {
+	top := stack[len(stack)-1]
+	stack = stack[:len(stack)-1]
+	if len(top.children) > 0 {
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, top.children...)
+		top.children = nil
+	}
+	return stack
+}
+
+func truncate(s string) string {
+	const maxLen = 40
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
+
+// statement is the activity of one bank or credit card account in an
+// OFX file.
+type statement struct {
+	// The ACCTID of the account
+	bankAccountId string
+
+	// The STMTTRN elements
+	transactions []*element
+}
+
+// statements returns the bank and credit card statements in the file
+// with given OFX element.
+func statements(ofx *element) ([]statement, error) {
+	var result []statement
+	msgSets := ofx.childrenNamed("BANKMSGSRSV1", "CREDITCARDMSGSRSV1")
+	for _, msgSet := range msgSets {
+		for _, trnrs := range msgSet.childrenNamed("STMTTRNRS", "CCSTMTTRNRS") {
+			rs := trnrs.child("STMTRS")
+			acctFrom := rs.child("BANKACCTFROM")
+			if rs == nil {
+				rs = trnrs.child("CCSTMTRS")
+				acctFrom = rs.child("CCACCTFROM")
+			}
+			if rs == nil {
+				status := trnrs.child("STATUS")
+				if code := status.childValue("CODE"); code != "" && code != "0" {
+					return nil, fmt.Errorf(
+						"Bank reported error %s: %s",
+						code, status.childValue("MESSAGE"))
+				}
+				continue
+			}
+			result = append(result, statement{
+				bankAccountId: strings.TrimSpace(acctFrom.childValue("ACCTID")),
+				transactions: rs.child("BANKTRANLIST").childrenNamed(
+					"STMTTRN"),
+			})
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New(
+			"OFX file has no bank or credit card statements.")
+	}
+	return result, nil
+}
+
+// transactionsFor returns the STMTTRN elements for the account with
+// given bankAccountId. If bankAccountId is empty, the statements must
+// all be for the same account.
+func transactionsFor(
+	stmts []statement, bankAccountId string) ([]*element, error) {
+	ids := make([]string, len(stmts))
+	for i := range stmts {
+		ids[i] = stmts[i].bankAccountId
+	}
+	chosen, err := autoimport.ChooseAccount(ids, bankAccountId)
+	if err != nil {
+		return nil, err
+	}
+	var result []*element
+	for _, stmt := range stmts {
+		if stmt.bankAccountId == chosen {
+			result = append(result, stmt.transactions...)
+		}
+	}
+	return result, nil
+}
@@ -1,12 +1,11 @@
-// Package qfx provides processing of QFX files
+// Package qfx provides processing of QFX and OFX files
 package qfx
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
-	"regexp"
 	"strings"
 	"time"
 
@@ -17,22 +16,10 @@ import (
 	"github.com/keep94/toolbox/db"
 )
 
-const (
-	kDtPosted     = "<DTPOSTED>"
-	kTrnAmt       = "<TRNAMT>"
-	kName         = "<NAME>"
-	kMemo         = "<MEMO>"
-	kCheckNum     = "<CHECKNUM>"
-	kStmtTrnClose = "</STMTTRN>"
-	kFitId        = "<FITID>"
-)
-
-var (
-	kQFXHeaderPattern = regexp.MustCompile(`^\s*[A-Z]+:[A-Z0-9]+\s*$`)
-	kXMLTagPattern    = regexp.MustCompile(`</?[A-Z]+>`)
-)
-
-// QFXLoader implements the autoimport.Loader interface for QFX files.
+// QFXLoader implements the autoimport.Loader interface for QFX and OFX
+// files, both OFX 1.x SGML and OFX 2.x XML. When a file has statements
+// for several accounts, bankAccountId, the ACCTID of the account in the
+// file, selects the statement to load.
 type QFXLoader struct {
 	// Store stores which fitIds, unique identifier in QFX files,
 	// have already been processed.
@@ -44,91 +31,82 @@ func (q QFXLoader) Load(
 	bankAccountId string,
 	r io.Reader,
 	startDate time.Time) (autoimport.Batch, error) {
-	scanner := bufio.NewScanner(r)
-	var line string
-	var err error
-
-	// skip over QFX headers for now
-	for scanner.Scan() {
-		line = scanner.Text()
-		if !kQFXHeaderPattern.MatchString(line) {
-			break
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ofx, err := parseOFX(contents)
+	if err != nil {
+		return nil, err
+	}
+	stmts, err := statements(ofx)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := transactionsFor(stmts, bankAccountId)
+	if err != nil {
+		return nil, err
+	}
+	var result []*QfxEntry
+	for _, trn := range transactions {
+		qe, err := toQfxEntry(accountId, trn)
+		if err != nil {
+			return nil, err
+		}
+		if qe.Date.Before(startDate) {
+			continue
+		}
+		if err := qe.Check(); err != nil {
+			return nil, err
 		}
+		result = append(result, qe)
 	}
+	return &QfxBatch{Store: q.Store, AccountId: accountId, QfxEntries: result}, nil
+}
 
-	// Load the XML body into this buffer
-	var qfxContents bytes.Buffer
-	for scanner.Scan() {
-		line = scanner.Text()
-		line = strings.TrimSpace(line)
-		qfxContents.Write([]byte(line))
+// Sniff recognizes files with an OFX header or an OFX element.
+func (q QFXLoader) Sniff(head []byte) int {
+	if bytes.Contains(head, kOFXHeader) || bytes.Contains(head, kOFXTag) {
+		return autoimport.MaxScore
 	}
+	return 0
+}
 
-	// Return any errors from reading the file.
-	if err = scanner.Err(); err != nil {
+// toQfxEntry converts a STMTTRN element to a QfxEntry.
+func toQfxEntry(accountId int64, trn *element) (*QfxEntry, error) {
+	date, err := parseQFXDate(trn.childValue("DTPOSTED"))
+	if err != nil {
 		return nil, err
 	}
-
-	// We break the XML body into a stream of tags and contents.
-	xmlContents := qfxContents.Bytes()
-	allTagIndexes := kXMLTagPattern.FindAllIndex(xmlContents, -1)
-	tagCount := len(allTagIndexes)
-
-	qe := &QfxEntry{}
-	var result []*QfxEntry
-	var readName, readMemo string
-
-	for i := 0; i < tagCount; i++ {
-		tag := string(xmlContents[allTagIndexes[i][0]:allTagIndexes[i][1]])
-		var contents string
-		if i+1 < tagCount {
-			contents = string(
-				xmlContents[allTagIndexes[i][1]:allTagIndexes[i+1][0]])
-		} else {
-			contents = string(xmlContents[allTagIndexes[i][1]:])
+	amt, err := parseQFXAmount(trn.childValue("TRNAMT"))
+	if err != nil {
+		return nil, err
+	}
+	// Some banks report debits as positive amounts.
+	switch trn.childValue("TRNTYPE") {
+	case "DEBIT":
+		if amt > 0 {
+			amt = -amt
 		}
-		if tag == kDtPosted {
-			qe.Date, err = parseQFXDate(contents)
-			if err != nil {
-				return nil, err
-			}
-		} else if tag == kName {
-			readName = strings.Replace(contents, "&amp;", "&", -1)
-		} else if tag == kMemo {
-			readMemo = strings.Replace(contents, "&amp;", "&", -1)
-		} else if tag == kCheckNum {
-			qe.CheckNo = contents
-		} else if tag == kTrnAmt {
-			var amt int64
-			amt, err = fin.ParseUSD(contents)
-			if err != nil {
-				return nil, err
-			}
-			qe.CatPayment = fin.NewCatPayment(fin.Expense, -amt, true, accountId)
-		} else if tag == kFitId {
-			qe.FitId = contents
-		} else if tag == kStmtTrnClose {
-			// No meaningful contents with this closing tag. This closing tag
-			// means that we are done with an entry.
-			if !qe.Date.Before(startDate) {
-				// Prefer name field to memo field
-				if strings.TrimSpace(readName) != "" {
-					qe.Name = readName
-				} else {
-					qe.Name = readMemo
-				}
-				err = qe.Check()
-				if err != nil {
-					return nil, err
-				}
-				result = append(result, qe)
-			}
-			qe = &QfxEntry{}
-			readName = ""
-			readMemo = ""
+	case "CREDIT":
+		if amt < 0 {
+			amt = -amt
 		}
 	}
-	return &QfxBatch{Store: q.Store, AccountId: accountId, QfxEntries: result}, nil
+	// Prefer name field to memo field
+	name := trn.childValue("NAME")
+	if strings.TrimSpace(name) == "" {
+		name = trn.child("PAYEE").childValue("NAME")
+	}
+	if strings.TrimSpace(name) == "" {
+		name = trn.childValue("MEMO")
+	}
+	qe := &QfxEntry{FitId: trn.childValue("FITID")}
+	qe.Date = date
+	qe.Name = name
+	qe.CheckNo = trn.childValue("CHECKNUM")
+	qe.CatPayment = fin.NewCatPayment(fin.Expense, -amt, true, accountId)
+	return qe, nil
 }
 
 // QfxBatch implements the autoimport.Batch interface. Although it was
@@ -177,8 +155,12 @@ func (q *QfxBatch) SkipProcessed(t db.Transaction) (autoimport.Batch, error) {
 	return &QfxBatch{Store: q.Store, AccountId: q.AccountId, QfxEntries: result[:idx]}, nil
 }
 
-func (q *QfxBatch) MarkProcessed(t db.Transaction) error {
-	return q.Store.Add(t, q.AccountId, q.toFitIdSet())
+func (q *QfxBatch) MarkProcessed(t db.Transaction, changeId int64) error {
+	return q.Store.Add(t, q.AccountId, changeId, q.toFitIdSet())
+}
+
+func (q *QfxBatch) MarkUnprocessed(t db.Transaction) error {
+	return q.Store.Remove(t, q.AccountId, q.toFitIdSet())
 }
 
 func (q *QfxBatch) toFitIdSet() qfxdb.FitIdSet {
@@ -215,5 +197,22 @@ func parseQFXDate(s string) (time.Time, error) {
 	if len(s) < 8 {
 		return time.Time{}, errors.New("Invalid date field in qfx file.")
 	}
-	return time.Parse(date_util.YMDFormat, s[:8])
+	result, err := time.Parse(date_util.YMDFormat, s[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid date field in qfx file: %s", s)
+	}
+	return result, nil
+}
+
+// parseQFXAmount parses a TRNAMT field. OFX allows a comma as the
+// decimal point.
+func parseQFXAmount(s string) (int64, error) {
+	if !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	result, err := fin.ParseUSD(s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid amount field in qfx file: %s", s)
+	}
+	return result, nil
 }
@@ -259,18 +259,245 @@ NEWFILEUID:NONE
 
 <OFX><SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>20121115120000[0:GMT]<LANGUAGE>ENG<FI><ORG>ISC<FID>10898</FI><INTU.BID>10898</SONRS></SIGNONMSGSRSV1><CREDITCARDMSGSRSV1><CCSTMTTRNRS><TRNUID>1<STATUS><CODE>0<SEVERITY>INFO<MESSAGE>Success</STATUS><CCSTMTRS><CURDEF>USD<CCACCTFROM><ACCTID>4147202080404005</CCACCTFROM><BANKTRANLIST><DTSTART>20121115120000[0:GMT]<DTEND>20121115120000[0:GMT]<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20121113120000[0:GMT]<TRNAMT>-109.01<FITID>10200<NAME>WHOLEFDS LAT 10155</STMTTRN><STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20121114120000[0:GMT]<TRNAMT>-100.75<FITID>10201<NAME>WHOLEFDS LAT 10155</STMTTRN><STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20121114120000[0:GMT]<TRNAMT>-57.14<FITID>10202<NAME>Amazon.com</STMTTRN><STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20121115120000[0:GMT]<TRNAMT>-12.12<FITID>10203<NAME>safeway</STMTTRN></BANKTRANLIST><LEDGERBAL><BALAMT>-3392.62<DTASOF>20121115120000[0:GMT]</LEDGERBAL><AVAILBAL><BALAMT>21714.00<DTASOF>20121115120000[0:GMT]</AVAILBAL></CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`
 
+const kMultiAccountQfx = `
+OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<TRNUID>1
+<STMTRS>
+<CURDEF>USD
+<BANKACCTFROM>
+<BANKID>021000021
+<ACCTID>123456
+<ACCTTYPE>CHECKING
+</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>CHECK
+<DTPOSTED>20121114
+<TRNAMT>-12.50
+<FITID>A1
+<CHECKNUM>1001
+<NAME>Tom &amp; Jerry&apos;s &lt;Deli&gt;
+<MEMO>
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20121115
+<TRNAMT>3,99
+<FITID>A2
+<PAYEE>
+<NAME>Caf&#233;
+</PAYEE>
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+<CREDITCARDMSGSRSV1>
+<CCSTMTTRNRS>
+<TRNUID>2
+<CCSTMTRS>
+<CURDEF>USD
+<CCACCTFROM>
+<ACCTID>4147
+</CCACCTFROM>
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20121115
+<TRNAMT>-50.00
+<FITID>B1
+<NAME>Card payment
+</STMTTRN>
+</BANKTRANLIST>
+</CCSTMTRS>
+</CCSTMTTRNRS>
+</CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+const kOfx2 = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <!-- Statement for one checking account -->
+  <BANKMSGSRSV1>
+    <STMTTRNRS>
+      <TRNUID>1</TRNUID>
+      <STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+      <STMTRS>
+        <CURDEF>USD</CURDEF>
+        <BANKACCTFROM>
+          <BANKID>021000021</BANKID>
+          <ACCTID>123456</ACCTID>
+          <ACCTTYPE>CHECKING</ACCTTYPE>
+        </BANKACCTFROM>
+        <BANKTRANLIST>
+          <DTSTART>20121101</DTSTART>
+          <DTEND>20121130</DTEND>
+          <STMTTRN>
+            <TRNTYPE>DIRECTDEP</TRNTYPE>
+            <DTPOSTED>20121114120000.000[-5:EST]</DTPOSTED>
+            <TRNAMT>2000.00</TRNAMT>
+            <FITID>X1</FITID>
+            <NAME>Payroll</NAME>
+          </STMTTRN>
+          <STMTTRN>
+            <TRNTYPE>POS</TRNTYPE>
+            <DTPOSTED>20121115</DTPOSTED>
+            <TRNAMT>-43.21</TRNAMT>
+            <FITID>X2</FITID>
+            <NAME/>
+            <MEMO>Grocer</MEMO>
+          </STMTTRN>
+          <STMTTRN>
+            <TRNTYPE>POS</TRNTYPE>
+            <DTPOSTED>20121113</DTPOSTED>
+            <TRNAMT>-1.00</TRNAMT>
+            <FITID>X3</FITID>
+            <NAME>Too early</NAME>
+          </STMTTRN>
+        </BANKTRANLIST>
+      </STMTRS>
+    </STMTTRNRS>
+  </BANKMSGSRSV1>
+</OFX>
+`
+
+const kBadAmountQfx = `
+<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<STMTRS>
+<BANKACCTFROM>
+<ACCTID>123456
+</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20121115
+<TRNAMT>twelve
+<FITID>A1
+<NAME>Grocer
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+
 func TestReadQFXBadFile(t *testing.T) {
 	r := strings.NewReader("A bad file\nNo QFX things in here\n")
 	var loader autoimport.Loader
 	loader = QFXLoader{make(storeType)}
+	if _, err := loader.Load(3, "", r, date_util.YMD(2012, 11, 14)); err == nil {
+		t.Error("Expected error reading a file that is not OFX")
+	}
+}
+
+func TestReadQFXMalformed(t *testing.T) {
+	malformed := []string{
+		// Unexpected end tag
+		"<OFX><BANKMSGSRSV1></STMTTRNRS></BANKMSGSRSV1></OFX>",
+		// Unterminated tag
+		"<OFX><BANKMSGSRSV1><STMTTRNRS",
+		// Text in an aggregate
+		"<OFX><BANKMSGSRSV1><STMTTRNRS></STMTTRNRS>junk</BANKMSGSRSV1></OFX>",
+		// Truncated in the middle of a transaction
+		"<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><BANKTRANLIST><STMTTRN><TRNAMT>1.00",
+		// No statements
+		"<OFX><SIGNONMSGSRSV1><SONRS></SONRS></SIGNONMSGSRSV1></OFX>",
+	}
+	loader := QFXLoader{make(storeType)}
+	for _, contents := range malformed {
+		r := strings.NewReader(contents)
+		if _, err := loader.Load(3, "", r, date_util.YMD(2012, 11, 14)); err == nil {
+			t.Errorf("Expected error reading %s", contents)
+		}
+	}
+	r := strings.NewReader(kBadAmountQfx)
+	if _, err := loader.Load(3, "", r, date_util.YMD(2012, 11, 14)); err == nil {
+		t.Error("Expected error reading bad amount")
+	}
+}
+
+func TestReadQFXMultipleAccounts(t *testing.T) {
+	loader := QFXLoader{make(storeType)}
+	r := strings.NewReader(kMultiAccountQfx)
+	if _, err := loader.Load(3, "", r, date_util.YMD(2012, 11, 14)); err == nil {
+		t.Error("Expected error when not choosing a bank account")
+	}
+	r = strings.NewReader(kMultiAccountQfx)
+	if _, err := loader.Load(3, "999", r, date_util.YMD(2012, 11, 14)); err == nil {
+		t.Error("Expected error choosing a missing bank account")
+	}
+	r = strings.NewReader(kMultiAccountQfx)
+	batch, err := loader.Load(3, "4147", r, date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Card payment",
+			CatPayment: fin.NewCatPayment(fin.Expense, -5000, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+	r = strings.NewReader(kMultiAccountQfx)
+	batch, err = loader.Load(3, "123456", r, date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries = []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 14),
+			Name:       "Tom & Jerry's <Deli>",
+			CheckNo:    "1001",
+			CatPayment: fin.NewCatPayment(fin.Expense, 1250, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Café",
+			CatPayment: fin.NewCatPayment(fin.Expense, 399, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+}
+
+func TestReadOFX2(t *testing.T) {
+	loader := QFXLoader{make(storeType)}
+	r := strings.NewReader(kOfx2)
 	batch, err := loader.Load(3, "", r, date_util.YMD(2012, 11, 14))
 	if err != nil {
-		t.Errorf("Got error %v", err)
-		return
+		t.Fatalf("Got error %v", err)
 	}
-	entries := batch.Entries()
-	if len(entries) != 0 {
-		t.Errorf("Expected to read no entries, but read %d entries.", len(entries))
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 14),
+			Name:       "Payroll",
+			CatPayment: fin.NewCatPayment(fin.Expense, -200000, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Grocer",
+			CatPayment: fin.NewCatPayment(fin.Expense, 4321, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	loader := QFXLoader{}
+	for _, contents := range []string{kSampleQfx, kOfx2, "<OFX></OFX>"} {
+		if score := loader.Sniff([]byte(contents)); score != autoimport.MaxScore {
+			t.Errorf("Expected %d, got %d", autoimport.MaxScore, score)
+		}
+	}
+	if score := loader.Sniff([]byte("<HTML></HTML>")); score != 0 {
+		t.Errorf("Expected 0, got %d", score)
 	}
 }
 
@@ -393,7 +620,7 @@ func TestSkipProcessed(t *testing.T) {
 	}
 	// Pretend a fitId that happens to match one of our entries gets processed in
 	// another account. This should not affect our batch.
-	store.Add(nil, 4, qfxdb.FitIdSet{"10201": struct{}{}})
+	store.Add(nil, 4, 0, qfxdb.FitIdSet{"10201": struct{}{}})
 
 	// SkipProcessed should return the same batch
 	newBatch, _ := batch.SkipProcessed(nil)
@@ -403,7 +630,7 @@ func TestSkipProcessed(t *testing.T) {
 
 	// Pretend one of the entries in the batch got processed in another thread.
 	// Our batch should have one fewer entries.
-	store.Add(nil, 3, qfxdb.FitIdSet{"10201": struct{}{}})
+	store.Add(nil, 3, 0, qfxdb.FitIdSet{"10201": struct{}{}})
 	newBatch, _ = batch.SkipProcessed(nil)
 	if output := len(newBatch.Entries()); output != 3 {
 		t.Errorf("Expected 3, got %v", output)
@@ -422,7 +649,7 @@ func TestMarkProcessed(t *testing.T) {
 		t.Errorf("Got error %v", err)
 		return
 	}
-	batch.MarkProcessed(nil)
+	batch.MarkProcessed(nil, 0)
 	r = strings.NewReader(kSampleQfx)
 	newBatch, err := loader.Load(3, "", r, date_util.YMD(2012, 11, 14))
 	if err != nil {
@@ -438,9 +665,25 @@ func TestMarkProcessed(t *testing.T) {
 	}
 }
 
+func TestMarkUnprocessed(t *testing.T) {
+	r := strings.NewReader(kSampleQfx)
+	loader := QFXLoader{make(storeType)}
+	batch, err := loader.Load(3, "", r, date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Errorf("Got error %v", err)
+		return
+	}
+	batch.MarkProcessed(nil, 0)
+	batch.MarkUnprocessed(nil)
+	newBatch, _ := batch.SkipProcessed(nil)
+	if output := len(newBatch.Entries()); output != batch.Len() {
+		t.Errorf("Expected %v, got %v", batch.Len(), output)
+	}
+}
+
 type storeType map[int64]map[string]struct{}
 
-func (s storeType) Add(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+func (s storeType) Add(t db.Transaction, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
 	if s[accountId] == nil {
 		s[accountId] = make(map[string]struct{})
 	}
@@ -462,3 +705,10 @@ func (s storeType) Find(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet
 	}
 	return result, nil
 }
+
+func (s storeType) Remove(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+	for fitId := range fitIds {
+		delete(s[accountId], fitId)
+	}
+	return nil
+}
@@ -18,10 +18,10 @@ func (f *Fixture) Find(t *testing.T) {
 	setOne := qfxdb.FitIdSet{"FitId1_1": struct{}{}, "FitId1_2": struct{}{}}
 	setTwo := qfxdb.FitIdSet{"FitId2_1": struct{}{}, "FitId2_2": struct{}{}}
 	err := f.Doer.Do(func(t db.Transaction) error {
-		if err := f.Store.Add(t, 1, setOne); err != nil {
+		if err := f.Store.Add(t, 1, 0, setOne); err != nil {
 			return err
 		}
-		return f.Store.Add(t, 2, setTwo)
+		return f.Store.Add(t, 2, 0, setTwo)
 	})
 	if err != nil {
 		t.Errorf("Error adding fitIds: %v", err)
@@ -49,3 +49,32 @@ func (f *Fixture) Find(t *testing.T) {
 		t.Error("Expected empty set.")
 	}
 }
+
+func (f *Fixture) Remove(t *testing.T) {
+	set := qfxdb.FitIdSet{"FitId1_1": struct{}{}, "FitId1_2": struct{}{}}
+	if err := f.Store.Add(nil, 1, 0, set); err != nil {
+		t.Fatalf("Error adding fitIds: %v", err)
+	}
+	if err := f.Store.Add(nil, 2, 0, set); err != nil {
+		t.Fatalf("Error adding fitIds: %v", err)
+	}
+	err := f.Store.Remove(nil, 1, qfxdb.FitIdSet{"FitId1_1": struct{}{}})
+	if err != nil {
+		t.Fatalf("Error removing fitIds: %v", err)
+	}
+	inSet, err := f.Store.Find(nil, 1, set)
+	if err != nil {
+		t.Fatalf("Error accessing database: %v", err)
+	}
+	expected := qfxdb.FitIdSet{"FitId1_2": struct{}{}}
+	if !reflect.DeepEqual(inSet, expected) {
+		t.Errorf("Expected %v, got %v", expected, inSet)
+	}
+	inSet, err = f.Store.Find(nil, 2, set)
+	if err != nil {
+		t.Fatalf("Error accessing database: %v", err)
+	}
+	if !reflect.DeepEqual(inSet, set) {
+		t.Errorf("Expected %v, got %v", set, inSet)
+	}
+}
@@ -0,0 +1,76 @@
+// Package for_memory provides an in-memory implementation for storing
+// processed QFX file fitIds.
+package for_memory
+
+import (
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
+	fmemory "github.com/keep94/finances/fin/findb/for_memory"
+	"github.com/keep94/toolbox/db"
+)
+
+// New creates in-memory implementation of qfxdb.Store interface
+func New(db *fmemory.Db) qfxdb.Store {
+	return memoryStore{db}
+}
+
+func add(
+	tx *fmemory.Tx, accountId, changeId int64, ids qfxdb.FitIdSet) error {
+	stored := tx.TableForUpdate(
+		fmemory.FitIdsTableName, fmemory.NewFitIds).(fmemory.FitIds)
+	for fitId := range ids {
+		stored[fmemory.AcctIdFitId{AcctId: accountId, FitId: fitId}] = changeId
+	}
+	return nil
+}
+
+func remove(tx *fmemory.Tx, accountId int64, ids qfxdb.FitIdSet) error {
+	stored := tx.TableForUpdate(
+		fmemory.FitIdsTableName, fmemory.NewFitIds).(fmemory.FitIds)
+	for fitId := range ids {
+		delete(stored, fmemory.AcctIdFitId{AcctId: accountId, FitId: fitId})
+	}
+	return nil
+}
+
+func find(
+	tx *fmemory.Tx, accountId int64, ids qfxdb.FitIdSet) qfxdb.FitIdSet {
+	stored := tx.Table(
+		fmemory.FitIdsTableName, fmemory.NewFitIds).(fmemory.FitIds)
+	var result qfxdb.FitIdSet
+	for fitId := range ids {
+		if _, ok := stored[fmemory.AcctIdFitId{AcctId: accountId, FitId: fitId}]; ok {
+			if result == nil {
+				result = make(qfxdb.FitIdSet)
+			}
+			result[fitId] = struct{}{}
+		}
+	}
+	return result
+}
+
+type memoryStore struct {
+	db fmemory.Doer
+}
+
+func (s memoryStore) Add(
+	t db.Transaction, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
+	return fmemory.ToDoer(s.db, t).Do(func(tx *fmemory.Tx) error {
+		return add(tx, accountId, changeId, fitIds)
+	})
+}
+
+func (s memoryStore) Find(
+	t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) (found qfxdb.FitIdSet, err error) {
+	err = fmemory.ToDoer(s.db, t).Do(func(tx *fmemory.Tx) error {
+		found = find(tx, accountId, fitIds)
+		return nil
+	})
+	return
+}
+
+func (s memoryStore) Remove(
+	t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+	return fmemory.ToDoer(s.db, t).Do(func(tx *fmemory.Tx) error {
+		return remove(tx, accountId, fitIds)
+	})
+}
@@ -0,0 +1,22 @@
+package for_memory
+
+import (
+	"testing"
+
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb/fixture"
+	fmemory "github.com/keep94/finances/fin/findb/for_memory"
+)
+
+func TestFind(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).Find(t)
+}
+
+func TestRemove(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).Remove(t)
+}
+
+func newFixture(db *fmemory.Db) *fixture.Fixture {
+	return &fixture.Fixture{Store: New(db), Doer: fmemory.NewDoer(db)}
+}
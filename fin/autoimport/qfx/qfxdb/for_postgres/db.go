@@ -0,0 +1,113 @@
+// Package for_postgres provides a PostgreSQL implementation for storing
+// processed QFX file fitIds.
+package for_postgres
+
+import (
+	"database/sql"
+
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+)
+
+const (
+	kSQLByAcctIdFitId     = "select acct_id from qfx_fitids where acct_id = $1 and fit_id = $2"
+	kSQLInsertAcctIdFitId = "insert into qfx_fitids (acct_id, fit_id, change_id) values ($1, $2, $3)"
+	kSQLDeleteAcctIdFitId = "delete from qfx_fitids where acct_id = $1 and fit_id = $2"
+)
+
+// New creates PostgreSQL implementation of qfxdb.Store interface
+func New(db *sqlite3_db.Db) qfxdb.Store {
+	return postgresStore{db}
+}
+
+func add(
+	tx *sql.Tx, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
+	addStmt, err := tx.Prepare(kSQLInsertAcctIdFitId)
+	if err != nil {
+		return err
+	}
+	defer addStmt.Close()
+	for fitId := range fitIds {
+		_, err := addStmt.Exec(accountId, fitId, changeId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func remove(tx *sql.Tx, accountId int64, fitIds qfxdb.FitIdSet) error {
+	deleteStmt, err := tx.Prepare(kSQLDeleteAcctIdFitId)
+	if err != nil {
+		return err
+	}
+	defer deleteStmt.Close()
+	for fitId := range fitIds {
+		_, err := deleteStmt.Exec(accountId, fitId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findByAccountIdAndFitId(
+	stmt *sql.Stmt, accountId int64, fitId string) (bool, error) {
+	dbrows, err := stmt.Query(accountId, fitId)
+	if err != nil {
+		return false, err
+	}
+	defer dbrows.Close()
+	found := dbrows.Next()
+	return found, dbrows.Err()
+}
+
+func find(tx *sql.Tx, accountId int64, fitIds qfxdb.FitIdSet) (qfxdb.FitIdSet, error) {
+	stmt, err := tx.Prepare(kSQLByAcctIdFitId)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	var result qfxdb.FitIdSet
+	for fitId := range fitIds {
+		found, err := findByAccountIdAndFitId(stmt, accountId, fitId)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			if result == nil {
+				result = make(qfxdb.FitIdSet)
+			}
+			result[fitId] = struct{}{}
+		}
+	}
+	return result, nil
+}
+
+type postgresStore struct {
+	db sqlite3_db.Doer
+}
+
+func (s postgresStore) Add(
+	t db.Transaction, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return add(tx, accountId, changeId, fitIds)
+	})
+}
+
+func (s postgresStore) Find(
+	t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) (found qfxdb.FitIdSet, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		found, err = find(tx, accountId, fitIds)
+		return
+	})
+	return
+}
+
+func (s postgresStore) Remove(
+	t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return remove(tx, accountId, fitIds)
+	})
+}
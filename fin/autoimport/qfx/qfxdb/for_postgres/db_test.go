@@ -0,0 +1,80 @@
+package for_postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb/fixture"
+	"github.com/keep94/finances/fin/findb/postgres_setup"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+)
+
+const (
+	// kDSNEnv names the environment variable holding the connection string
+	// of the PostgreSQL database to test against. Tests are skipped if it
+	// is not set.
+	kDSNEnv = "FINANCES_POSTGRES_TEST_DSN"
+
+	// kTestSchema is dropped and recreated by each test.
+	kTestSchema = "qfxdb_test"
+)
+
+func TestFind(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).Find(t)
+}
+
+func TestRemove(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).Remove(t)
+}
+
+func newFixture(db *sqlite3_db.Db) *fixture.Fixture {
+	return &fixture.Fixture{Store: New(db), Doer: sqlite3_db.NewDoer(db)}
+}
+
+func closeDb(t *testing.T, db *sqlite3_db.Db) {
+	err := db.Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec("drop schema " + kTestSchema + " cascade")
+		return err
+	})
+	if err != nil {
+		t.Errorf("Error dropping schema: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Error closing database: %v", err)
+	}
+}
+
+func openDb(t *testing.T) *sqlite3_db.Db {
+	dsn := os.Getenv(kDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", kDSNEnv)
+	}
+	if !slices.Contains(sql.Drivers(), "postgres") {
+		t.Skip("postgres driver not linked in; run tests with -tags postgres")
+	}
+	rawdb, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	// search_path is per connection, so use just one connection.
+	rawdb.SetMaxOpenConns(1)
+	_, err = rawdb.Exec(fmt.Sprintf(
+		"drop schema if exists %[1]s cascade; create schema %[1]s; set search_path to %[1]s",
+		kTestSchema))
+	if err != nil {
+		t.Fatalf("Error creating schema: %v", err)
+	}
+	db := sqlite3_db.New(rawdb)
+	err = db.Do(postgres_setup.SetUpTables)
+	if err != nil {
+		t.Fatalf("Error creating tables: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,8 @@
+//go:build postgres
+
+package for_postgres
+
+// The PostgreSQL driver is only linked into tests built with the postgres
+// tag so that the module does not depend on it otherwise. Run
+// "go get github.com/lib/pq" before building with the tag.
+import _ "github.com/lib/pq"
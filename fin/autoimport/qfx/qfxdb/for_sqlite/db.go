@@ -12,7 +12,8 @@ import (
 
 const (
 	kSQLByAcctIdFitId     = "select acct_id from qfx_fitids where acct_id = ? and fit_id = ?"
-	kSQLInsertAcctIdFitId = "insert into qfx_fitids (acct_id, fit_id) values (?, ?)"
+	kSQLInsertAcctIdFitId = "insert into qfx_fitids (acct_id, fit_id, change_id) values (?, ?, ?)"
+	kSQLDeleteAcctIdFitId = "delete from qfx_fitids where acct_id = ? and fit_id = ?"
 )
 
 // New creates sqlite implementation of qfxdb.Store interface
@@ -20,14 +21,30 @@ func New(db *sqlite3_db.Db) qfxdb.Store {
 	return sqliteStore{db}
 }
 
-func add(tx *sql.Tx, accountId int64, fitIds qfxdb.FitIdSet) error {
+func add(
+	tx *sql.Tx, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
 	addStmt, err := tx.Prepare(kSQLInsertAcctIdFitId)
 	if err != nil {
 		return err
 	}
 	defer addStmt.Close()
 	for fitId := range fitIds {
-		_, err := addStmt.Exec(accountId, fitId)
+		_, err := addStmt.Exec(accountId, fitId, changeId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func remove(tx *sql.Tx, accountId int64, fitIds qfxdb.FitIdSet) error {
+	deleteStmt, err := tx.Prepare(kSQLDeleteAcctIdFitId)
+	if err != nil {
+		return err
+	}
+	defer deleteStmt.Close()
+	for fitId := range fitIds {
+		_, err := deleteStmt.Exec(accountId, fitId)
 		if err != nil {
 			return err
 		}
@@ -73,9 +90,9 @@ type sqliteStore struct {
 }
 
 func (s sqliteStore) Add(
-	t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+	t db.Transaction, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
 	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
-		return add(tx, accountId, fitIds)
+		return add(tx, accountId, changeId, fitIds)
 	})
 }
 
@@ -87,3 +104,10 @@ func (s sqliteStore) Find(
 	})
 	return
 }
+
+func (s sqliteStore) Remove(
+	t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return remove(tx, accountId, fitIds)
+	})
+}
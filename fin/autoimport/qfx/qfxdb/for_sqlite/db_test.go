@@ -16,6 +16,12 @@ func TestFind(t *testing.T) {
 	newFixture(db).Find(t)
 }
 
+func TestRemove(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).Remove(t)
+}
+
 func newFixture(db *sqlite3_db.Db) *fixture.Fixture {
 	return &fixture.Fixture{Store: New(db), Doer: sqlite3_db.NewDoer(db)}
 }
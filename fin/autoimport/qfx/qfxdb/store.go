@@ -17,13 +17,19 @@ type FitIdSet map[string]struct{}
 // Interface Store handles storage and retrieval of fitIds from QFX files.
 type Store interface {
 	// Add adds a set of fitIds to the store for a particular account Id.
-	Add(t db.Transaction, accountId int64, fitIds FitIdSet) error
+	// changeId is the id of the change set that imported the fitIds or 0
+	// if there is none. Undoing that change set removes the fitIds.
+	Add(t db.Transaction, accountId, changeId int64, fitIds FitIdSet) error
 
 	// Find finds fitIds for a particular account Id and returns them.
 	// fitIds is the set of fitIds to look for. The returned set of fitIds will
 	// always be a subset of the fitIds parameter or nil if Find cannot find any
 	// of the fitIds.
 	Find(t db.Transaction, accountId int64, fitIds FitIdSet) (FitIdSet, error)
+
+	// Remove removes a set of fitIds from the store for a particular
+	// account Id so that they can be imported again.
+	Remove(t db.Transaction, accountId int64, fitIds FitIdSet) error
 }
 
 // NoPermissionStore implements Store by always returning NoPermission
@@ -32,6 +38,11 @@ type NoPermissionStore struct {
 }
 
 func (n NoPermissionStore) Add(
+	t db.Transaction, accountId, changeId int64, fitIds FitIdSet) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) Remove(
 	t db.Transaction, accountId int64, fitIds FitIdSet) error {
 	return NoPermission
 }
@@ -0,0 +1,416 @@
+// Package qif provides processing of QIF files
+package qif
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/finances/fin/autoimport/qfx"
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/categories/categoriesdb"
+	"github.com/keep94/toolbox/date_util"
+)
+
+// QIFLoader implements the autoimport.Loader interface for QIF files.
+// QIFLoader reads the Bank, CCard, Cash, Oth A, and Oth L sections of
+// a QIF file and skips the rest. When a file has transactions for several
+// accounts, bankAccountId, the name of the account in the !Account
+// block, selects the account to load.
+type QIFLoader struct {
+	// Store stores which transactions have already been processed.
+	Store qfxdb.Store
+
+	// Cache maps the category names in QIF files to categories by full
+	// name. If nil, imported transactions are uncategorized.
+	Cache categoriesdb.Getter
+}
+
+func (q QIFLoader) Load(
+	accountId int64,
+	bankAccountId string,
+	r io.Reader,
+	startDate time.Time) (autoimport.Batch, error) {
+	records, err := readRecords(r)
+	if err != nil {
+		return nil, err
+	}
+	records, err = recordsFor(records, bankAccountId)
+	if err != nil {
+		return nil, err
+	}
+	var cds categories.CatDetailStore
+	if q.Cache != nil {
+		if cds, err = q.Cache.Get(nil); err != nil {
+			return nil, err
+		}
+	}
+	var result []*qfx.QfxEntry
+	fitIdCounts := make(map[string]int)
+	for _, rec := range records {
+		var qentry qfx.QfxEntry
+		if err := rec.toEntry(cds, accountId, &qentry.Entry); err != nil {
+			return nil, err
+		}
+		fitId := autoimport.UniqueFitId(
+			generateFitId(qentry.Date, rec), fitIdCounts)
+		if qentry.Date.Before(startDate) {
+			continue
+		}
+		qentry.FitId = fitId
+		if err := qentry.Check(); err != nil {
+			return nil, err
+		}
+		result = append(result, &qentry)
+	}
+	return &qfx.QfxBatch{Store: q.Store, AccountId: accountId, QfxEntries: result}, nil
+}
+
+// Sniff recognizes files whose first line is a QIF header such as
+// !Type:Bank.
+func (q QIFLoader) Sniff(head []byte) int {
+	line, _, _ := strings.Cut(string(head), "\n")
+	header := strings.ToLower(strings.TrimSpace(line))
+	switch {
+	case isTransactionHeader(header), header == "!account",
+		strings.HasPrefix(header, "!option:"):
+		return autoimport.MaxScore
+	case strings.HasPrefix(header, "!type:"):
+		// A list of categories or memorized transactions
+		return autoimport.MaxScore / 2
+	}
+	return 0
+}
+
+// split is a split line of a QIF transaction.
+type split struct {
+	category string
+	amount   string
+}
+
+// record is one transaction in a QIF file.
+type record struct {
+	// The name of the account from the !Account block
+	account  string
+	date     string
+	amount   string
+	checkNo  string
+	payee    string
+	memo     string
+	category string
+	splits   []split
+
+	// The number of lines in the transaction
+	lineCount int
+}
+
+func (r *record) add(line string) error {
+	code, value := line[0], strings.TrimSpace(line[1:])
+	switch code {
+	case 'D':
+		r.date = value
+	case 'T', 'U':
+		r.amount = value
+	case 'N':
+		r.checkNo = value
+	case 'P':
+		r.payee = value
+	case 'M':
+		r.memo = value
+	case 'L':
+		r.category = value
+	case 'S':
+		r.splits = append(r.splits, split{category: value})
+	case '$':
+		if len(r.splits) == 0 {
+			return errors.New("QIF split amount without split category.")
+		}
+		r.splits[len(r.splits)-1].amount = value
+	}
+	r.lineCount++
+	return nil
+}
+
+func (r *record) toEntry(
+	cds categories.CatDetailStore, accountId int64, entry *fin.Entry) error {
+	var err error
+	if r.date == "" {
+		return errors.New("QIF transaction missing date.")
+	}
+	entry.Date, err = parseQIFDate(r.date)
+	if err != nil {
+		return err
+	}
+	entry.Name = r.payee
+	if entry.Name == "" {
+		entry.Name = r.memo
+	} else {
+		entry.Desc = r.memo
+	}
+	if isCheckNo(r.checkNo) {
+		entry.CheckNo = r.checkNo
+	}
+	cpb := fin.CatPaymentBuilder{}
+	cpb.SetPaymentId(accountId).SetReconciled(true)
+	if len(r.splits) == 0 {
+		amt, err := parseQIFAmount(r.amount)
+		if err != nil {
+			return err
+		}
+		cpb.AddCatRec(fin.CatRec{
+			Cat: catFor(cds, accountId, r.category), Amount: -amt})
+		entry.CatPayment = cpb.Build()
+		return nil
+	}
+	var total int64
+	for _, s := range r.splits {
+		amt, err := parseQIFAmount(s.amount)
+		if err != nil {
+			return err
+		}
+		total += amt
+		cpb.AddCatRec(fin.CatRec{
+			Cat: catFor(cds, accountId, s.category), Amount: -amt})
+	}
+	if r.amount != "" {
+		amt, err := parseQIFAmount(r.amount)
+		if err != nil {
+			return err
+		}
+		if amt != total {
+			return fmt.Errorf(
+				"Splits of %s on %s do not add up to its amount.",
+				entry.Name, r.date)
+		}
+	}
+	entry.CatPayment = cpb.Build()
+	return nil
+}
+
+// readRecords reads the transactions in a QIF file.
+func readRecords(r io.Reader) ([]*record, error) {
+	scanner := bufio.NewScanner(r)
+	var result []*record
+	var account string
+	inAccount := false
+	inTransactions := false
+	foundHeader := false
+	rec := &record{}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == '!' {
+			header := strings.ToLower(strings.TrimSpace(line))
+			switch {
+			case header == "!account":
+				inAccount, inTransactions = true, false
+				account = ""
+			case isTransactionHeader(header):
+				inAccount, inTransactions = false, true
+				foundHeader = true
+			case strings.HasPrefix(header, "!option:"),
+				strings.HasPrefix(header, "!clear:"):
+			default:
+				inAccount, inTransactions = false, false
+				foundHeader = true
+			}
+			continue
+		}
+		if inAccount {
+			if line[0] == 'N' {
+				account = strings.TrimSpace(line[1:])
+			}
+			if line[0] == '^' {
+				inAccount = false
+			}
+			continue
+		}
+		if !inTransactions {
+			continue
+		}
+		if line[0] == '^' {
+			if rec.lineCount > 0 {
+				rec.account = account
+				result = append(result, rec)
+			}
+			rec = &record{}
+			continue
+		}
+		if err := rec.add(line); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !foundHeader {
+		return nil, errors.New("Not a QIF file.")
+	}
+	if rec.lineCount > 0 {
+		return nil, errors.New(
+			"Malformed QIF file: last transaction missing ^.")
+	}
+	return result, nil
+}
+
+// recordsFor returns the records for the account with given
+// bankAccountId. If bankAccountId is empty, the records must all be for
+// the same account.
+func recordsFor(records []*record, bankAccountId string) ([]*record, error) {
+	accounts := make([]string, len(records))
+	for i := range records {
+		accounts[i] = records[i].account
+	}
+	chosen, err := autoimport.ChooseAccount(accounts, bankAccountId)
+	if err != nil {
+		return nil, err
+	}
+	var result []*record
+	for _, rec := range records {
+		if rec.account == chosen {
+			result = append(result, rec)
+		}
+	}
+	return result, nil
+}
+
+func isTransactionHeader(header string) bool {
+	switch strings.Join(strings.Fields(header), " ") {
+	case "!type:bank", "!type:ccard", "!type:cash", "!type:oth a",
+		"!type:oth l":
+		return true
+	}
+	return false
+}
+
+// catFor returns the category with given QIF category name. QIF names
+// transfers [account] and may end a category name with /class. catFor
+// returns fin.Expense if there is no such category.
+func catFor(
+	cds categories.CatDetailStore, accountId int64, name string) fin.Cat {
+	if idx := strings.Index(name, "/"); idx != -1 {
+		name = name[:idx]
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fin.Expense
+	}
+	if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+		detail, ok := cds.AccountDetailByName(name[1 : len(name)-1])
+		if !ok || detail.Id() == accountId {
+			return fin.Expense
+		}
+		return fin.Cat{Type: fin.AccountCat, Id: detail.Id()}
+	}
+	if detail, ok := cds.DetailByFullName("expense:" + name); ok {
+		return detail.Id()
+	}
+	if detail, ok := cds.DetailByFullName("income:" + name); ok {
+		return detail.Id()
+	}
+	return fin.Expense
+}
+
+// parseQIFDate parses dates like 11/14/2012, 11/14/12, 11/14'12 and
+// 2012-11-14. Quicken writes 11/14'12 for years after 1999.
+func parseQIFDate(s string) (time.Time, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '/' || r == '-' || r == '.' || r == '\''
+	})
+	if len(fields) != 3 {
+		return time.Time{}, fmt.Errorf("Invalid QIF date: %s", s)
+	}
+	var nums [3]int
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid QIF date: %s", s)
+		}
+		nums[i] = n
+	}
+	year, month, day := nums[2], nums[0], nums[1]
+	if len(fields[0]) == 4 {
+		year, month, day = nums[0], nums[1], nums[2]
+	} else if len(fields[2]) <= 2 {
+		if strings.Contains(s, "'") || year < 70 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	}
+	result := date_util.YMD(year, month, day)
+	if result.Month() != time.Month(month) || result.Day() != day {
+		return time.Time{}, fmt.Errorf("Invalid QIF date: %s", s)
+	}
+	return result, nil
+}
+
+func parseQIFAmount(s string) (int64, error) {
+	if s == "" {
+		return 0, errors.New("QIF transaction missing amount.")
+	}
+	result, err := fin.ParseUSD(strings.ReplaceAll(s, ",", ""))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid QIF amount: %s", s)
+	}
+	return result, nil
+}
+
+// isCheckNo returns true if the N field of a QIF transaction is a check
+// number rather than something like ATM or XFER.
+func isCheckNo(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// generateFitId returns the fitId of rec whose date is date. The fitId
+// depends only on the fields that describe the transaction, so the
+// cleared status and fields QIFLoader ignores do not change it. Amounts
+// and dates count by value rather than by how the file writes them.
+func generateFitId(date time.Time, rec *record) string {
+	dateStr := date.Format(date_util.YMDFormat)
+	values := []string{
+		dateStr,
+		normalizeAmount(rec.amount),
+		rec.checkNo,
+		rec.payee,
+		rec.memo,
+		rec.category}
+	for _, s := range rec.splits {
+		values = append(values, s.category, normalizeAmount(s.amount))
+	}
+	h := fnv.New64a()
+	for _, value := range values {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return dateStr + ":" + strconv.FormatUint(h.Sum64(), 10)
+}
+
+// normalizeAmount returns the amount in s in cents or s itself if it is
+// not an amount.
+func normalizeAmount(s string) string {
+	amt, err := parseQIFAmount(s)
+	if err != nil {
+		return s
+	}
+	return strconv.FormatInt(amt, 10)
+}
@@ -0,0 +1,351 @@
+package qif
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/autoimport"
+	"github.com/keep94/finances/fin/autoimport/qfx"
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+)
+
+const kSampleQif = `!Type:Bank
+D11/14/2012
+T-100.75
+PWHOLEFDS LAT 10155
+LFood:Groceries
+^
+D11/14'12
+T-1,057.14
+N1001
+PAmazon.com
+MBooks and food
+SFood:Groceries
+$-57.14
+EPantry
+SBooks
+$-1,000.00
+^
+D11/15/2012
+T2,000.00
+NDEP
+PPayroll
+LSalary
+^
+D11/15/2012
+T-50.00
+PTransfer
+L[Savings]
+^
+D11/13/2012
+T-5.00
+PToo early
+^
+D11/15/2012
+T-3.00
+MCoffee
+LDining/business
+^
+D11/15/2012
+T-3.00
+MCoffee
+LDining/business
+^
+`
+
+const kMultiAccountQif = `!Option:AutoSwitch
+!Account
+NChecking
+TBank
+^
+NVisa
+TCCard
+^
+!Clear:AutoSwitch
+!Account
+NChecking
+TBank
+^
+!Type:Bank
+D11/15/2012
+T-12.12
+Psafeway
+^
+!Account
+NVisa
+TCCard
+^
+!Type:CCard
+D2012-11-16
+T-23.04
+PAva's
+^
+!Type:Cat
+NFood
+E
+^
+`
+
+func TestReadQIF(t *testing.T) {
+	loader := QIFLoader{Store: make(storeType), Cache: cacheType(newCds())}
+	batch, err := loader.Load(
+		3, "", strings.NewReader(kSampleQif), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	cpb := fin.CatPaymentBuilder{}
+	cpb.SetPaymentId(3).SetReconciled(true)
+	cpb.AddCatRec(fin.CatRec{Cat: fin.NewCat("0:2"), Amount: 5714})
+	cpb.AddCatRec(fin.CatRec{Cat: fin.Expense, Amount: 100000})
+	split := cpb.Build()
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 14),
+			Name:       "WHOLEFDS LAT 10155",
+			CatPayment: fin.NewCatPayment(fin.NewCat("0:2"), 10075, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 14),
+			Name:       "Amazon.com",
+			Desc:       "Books and food",
+			CheckNo:    "1001",
+			CatPayment: split},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Payroll",
+			CatPayment: fin.NewCatPayment(fin.NewCat("1:1"), -200000, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Transfer",
+			CatPayment: fin.NewCatPayment(fin.NewCat("2:4"), 5000, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Coffee",
+			CatPayment: fin.NewCatPayment(fin.NewCat("0:3"), 300, true, 3)},
+		{
+			Date:       date_util.YMD(2012, 11, 15),
+			Name:       "Coffee",
+			CatPayment: fin.NewCatPayment(fin.NewCat("0:3"), 300, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+}
+
+func TestFitIds(t *testing.T) {
+	loader := QIFLoader{Store: make(storeType)}
+	batch, err := loader.Load(
+		3, "", strings.NewReader(kSampleQif), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	fitIds := make(map[string]bool)
+	for _, qe := range batch.(*qfx.QfxBatch).QfxEntries {
+		if fitIds[qe.FitId] {
+			t.Errorf("Duplicate fitId %s", qe.FitId)
+		}
+		fitIds[qe.FitId] = true
+	}
+	batch.MarkProcessed(nil, 0)
+	batch, err = loader.Load(
+		3, "", strings.NewReader(kSampleQif), date_util.YMD(2012, 11, 15))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	// Reading the same file again gives the same fitIds.
+	if batch, _ = batch.SkipProcessed(nil); batch.Len() != 0 {
+		t.Errorf("Expected no new entries, got %d", batch.Len())
+	}
+}
+
+func TestFitIdsIgnoreFormatting(t *testing.T) {
+	// The same transactions exported again with cleared flags, another
+	// date format, and amounts without thousands separators
+	const reexported = `!Type:Bank
+D2012-11-14
+T-100.75
+CX
+PWHOLEFDS LAT 10155
+LFood:Groceries
+^
+D11/14/2012
+T-1057.14
+C*
+N1001
+PAmazon.com
+MBooks and food
+SFood:Groceries
+$-57.14
+EPantry
+SBooks
+$-1000
+^
+`
+	loader := QIFLoader{Store: make(storeType)}
+	batch, err := loader.Load(
+		3, "", strings.NewReader(kSampleQif), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	batch.MarkProcessed(nil, 0)
+	batch, err = loader.Load(
+		3, "", strings.NewReader(reexported), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if batch.Len() != 2 {
+		t.Fatalf("Expected 2 entries, got %d", batch.Len())
+	}
+	if batch, _ = batch.SkipProcessed(nil); batch.Len() != 0 {
+		t.Errorf("Expected no new entries, got %d", batch.Len())
+	}
+}
+
+func TestReadQIFMultipleAccounts(t *testing.T) {
+	loader := QIFLoader{Store: make(storeType)}
+	_, err := loader.Load(
+		3, "", strings.NewReader(kMultiAccountQif), date_util.YMD(2012, 11, 14))
+	if err == nil {
+		t.Error("Expected error when not choosing an account")
+	}
+	_, err = loader.Load(
+		3, "Savings", strings.NewReader(kMultiAccountQif), date_util.YMD(2012, 11, 14))
+	if err == nil {
+		t.Error("Expected error choosing a missing account")
+	}
+	batch, err := loader.Load(
+		3, "Visa", strings.NewReader(kMultiAccountQif), date_util.YMD(2012, 11, 14))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedEntries := []fin.Entry{
+		{
+			Date:       date_util.YMD(2012, 11, 16),
+			Name:       "Ava's",
+			CatPayment: fin.NewCatPayment(fin.Expense, 2304, true, 3)}}
+	if entries := batch.Entries(); !reflect.DeepEqual(expectedEntries, entries) {
+		t.Errorf("Expected %v, got %v", expectedEntries, entries)
+	}
+}
+
+func TestReadQIFErrors(t *testing.T) {
+	bad := []string{
+		"Not a QIF file\n",
+		"!Type:Bank\nD11/15/2012\nT-1.00\nPNo caret\n",
+		"!Type:Bank\nD13/15/2012\nT-1.00\nPBad date\n^\n",
+		"!Type:Bank\nD11/15/2012\nTten\nPBad amount\n^\n",
+		"!Type:Bank\nD11/15/2012\nT-1.00\n^\n",
+		"!Type:Bank\nD11/15/2012\nT-3.00\nPSplit\nSFood\n$-1.00\nSBooks\n$-1.00\n^\n",
+	}
+	loader := QIFLoader{Store: make(storeType)}
+	for _, contents := range bad {
+		_, err := loader.Load(
+			3, "", strings.NewReader(contents), date_util.YMD(2012, 11, 14))
+		if err == nil {
+			t.Errorf("Expected error reading %q", contents)
+		}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	loader := QIFLoader{}
+	for _, contents := range []string{kSampleQif, kMultiAccountQif} {
+		if score := loader.Sniff([]byte(contents)); score != autoimport.MaxScore {
+			t.Errorf("Expected %d, got %d", autoimport.MaxScore, score)
+		}
+	}
+	for _, contents := range []string{
+		"Not a QIF file\n!Type:Bank\n", "", "D11/15/2012\n"} {
+		if score := loader.Sniff([]byte(contents)); score != 0 {
+			t.Errorf("Expected 0 for %q, got %d", contents, score)
+		}
+	}
+}
+
+func TestParseQIFDate(t *testing.T) {
+	cases := []struct {
+		s        string
+		expected int
+	}{
+		{"11/14/2012", 20121114},
+		{"11/14/12", 20121114},
+		{"11/14'12", 20121114},
+		{" 1/ 4'05", 20050104},
+		{"11/14/98", 19981114},
+		{"2012-11-14", 20121114},
+	}
+	for _, c := range cases {
+		date, err := parseQIFDate(c.s)
+		if err != nil {
+			t.Errorf("%s: Got error %v", c.s, err)
+			continue
+		}
+		expected := date_util.YMD(
+			c.expected/10000, c.expected/100%100, c.expected%100)
+		if date != expected {
+			t.Errorf("%s: Expected %v, got %v", c.s, expected, date)
+		}
+	}
+}
+
+func newCds() categories.CatDetailStore {
+	cdsb := categories.CatDetailStoreBuilder{}
+	cdsb.AddCatDbRow(
+		fin.ExpenseCat,
+		&categories.CatDbRow{Id: 1, Name: "Food", Active: true})
+	cdsb.AddCatDbRow(
+		fin.ExpenseCat,
+		&categories.CatDbRow{Id: 2, ParentId: 1, Name: "Groceries", Active: true})
+	cdsb.AddCatDbRow(
+		fin.ExpenseCat,
+		&categories.CatDbRow{Id: 3, Name: "Dining", Active: true})
+	cdsb.AddCatDbRow(
+		fin.IncomeCat,
+		&categories.CatDbRow{Id: 1, Name: "Salary", Active: true})
+	cdsb.AddAccount(&fin.Account{Id: 3, Name: "Checking", Active: true})
+	cdsb.AddAccount(&fin.Account{Id: 4, Name: "Savings", Active: true})
+	return cdsb.Build()
+}
+
+type cacheType categories.CatDetailStore
+
+func (c cacheType) Get(t db.Transaction) (categories.CatDetailStore, error) {
+	return categories.CatDetailStore(c), nil
+}
+
+var _ autoimport.Loader = QIFLoader{}
+
+type storeType map[int64]map[string]struct{}
+
+func (s storeType) Add(t db.Transaction, accountId, changeId int64, fitIds qfxdb.FitIdSet) error {
+	if s[accountId] == nil {
+		s[accountId] = make(map[string]struct{})
+	}
+	for fitId := range fitIds {
+		s[accountId][fitId] = struct{}{}
+	}
+	return nil
+}
+
+func (s storeType) Find(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) (qfxdb.FitIdSet, error) {
+	var result qfxdb.FitIdSet
+	for fitId := range fitIds {
+		if _, ok := s[accountId][fitId]; ok {
+			if result == nil {
+				result = make(qfxdb.FitIdSet)
+			}
+			result[fitId] = struct{}{}
+		}
+	}
+	return result, nil
+}
+
+func (s storeType) Remove(t db.Transaction, accountId int64, fitIds qfxdb.FitIdSet) error {
+	for fitId := range fitIds {
+		delete(s[accountId], fitId)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package autoimport
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	// SniffSize is the most of a file that a Sniffer sees.
+	SniffSize = 4096
+
+	// Sniff scores range from 0 to MaxScore.
+	MaxScore = 100
+
+	// A file with one of the extensions of a format gets this much added
+	// to the score of that format. The extension breaks ties and picks a
+	// format when no Sniffer recognizes the file.
+	kExtensionScore = 10
+)
+
+// Sniffer is implemented by Loaders that can recognize the files they
+// load.
+type Sniffer interface {
+
+	// Sniff returns how confident this instance is that it can load a file
+	// starting with head. head is at most SniffSize bytes. Sniff returns 0
+	// if the file is surely of another format and MaxScore if the file is
+	// surely of this instance's format.
+	Sniff(head []byte) int
+}
+
+// Format is a type of file that a Registry knows how to load.
+type Format struct {
+	// Name is what users see e.g OFX.
+	Name string
+
+	// Loader loads files of this format. If Loader also implements
+	// Sniffer, the Registry uses it to recognize files of this format.
+	Loader Loader
+
+	// Extensions lists the lowercase file extensions of this format
+	// e.g .qfx.
+	Extensions []string
+}
+
+// Registry chooses the Format of a file. The zero value is an empty
+// Registry ready to use. A Registry must not be changed once it is in use.
+type Registry struct {
+	formats []Format
+}
+
+// Add adds a format with given name, loader, and file extensions. The
+// formats added first win ties.
+func (r *Registry) Add(name string, loader Loader, extensions ...string) {
+	r.formats = append(r.formats, Format{
+		Name: name, Loader: loader, Extensions: extensions})
+}
+
+// Detect returns the format that best fits the file with given name and
+// contents. Detect looks at only the first SniffSize bytes of contents.
+// Detect returns false if no format fits.
+func (r *Registry) Detect(filename string, contents []byte) (Format, bool) {
+	head := contents
+	if len(head) > SniffSize {
+		head = head[:SniffSize]
+	}
+	ext := strings.ToLower(path.Ext(filename))
+	var result Format
+	bestScore := 0
+	for _, format := range r.formats {
+		score := 0
+		if sniffer, ok := format.Loader.(Sniffer); ok {
+			score = sniffer.Sniff(head)
+		}
+		if ext != "" && format.hasExtension(ext) {
+			score += kExtensionScore
+		}
+		if score > bestScore {
+			result, bestScore = format, score
+		}
+	}
+	return result, bestScore > 0
+}
+
+// ByExtension returns the format with given file extension e.g .qfx
+// ignoring case. ByExtension returns false if there is no such format.
+func (r *Registry) ByExtension(ext string) (Format, bool) {
+	ext = strings.ToLower(ext)
+	for _, format := range r.formats {
+		if format.hasExtension(ext) {
+			return format, true
+		}
+	}
+	return Format{}, false
+}
+
+func (f *Format) hasExtension(ext string) bool {
+	for _, e := range f.Extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
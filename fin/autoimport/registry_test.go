@@ -0,0 +1,98 @@
+package autoimport_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keep94/finances/fin/autoimport"
+)
+
+func TestDetect(t *testing.T) {
+	var registry autoimport.Registry
+	registry.Add("Text", loader{}, ".txt")
+	registry.Add("ABC", sniffingLoader{"ABC"}, ".abc")
+	registry.Add("XYZ", sniffingLoader{"XYZ"}, ".xyz", ".zz")
+	cases := []struct {
+		filename string
+		contents string
+		expected string
+	}{
+		{"a.abc", "ABC file", "ABC"},
+		{"a.txt", "ABC file", "ABC"},
+		{"a.XYZ", "ABC file", "ABC"},
+		{"a.txt", "XYZ file", "XYZ"},
+		{"", "XYZ file", "XYZ"},
+		{"a.ZZ", "Some file", "XYZ"},
+		{"a.txt", "Some file", "Text"},
+		{"a.xyz", "Has ABC and XYZ", "XYZ"},
+		{"a.txt", "Has ABC and XYZ", "ABC"},
+		{"a.abc", strings.Repeat(" ", autoimport.SniffSize) + "XYZ", "ABC"},
+	}
+	for _, c := range cases {
+		format, ok := registry.Detect(c.filename, []byte(c.contents))
+		if !ok {
+			t.Errorf("%s: Expected a format", c.filename)
+			continue
+		}
+		if format.Name != c.expected {
+			t.Errorf("%s: Expected %s, got %s", c.filename, c.expected, format.Name)
+		}
+	}
+	if _, ok := registry.Detect("a.csv", []byte("Some file")); ok {
+		t.Error("Expected no format")
+	}
+	if _, ok := registry.Detect(
+		"a.csv", []byte(strings.Repeat(" ", autoimport.SniffSize)+"ABC")); ok {
+		t.Error("Expected Detect to look at only the start of the file")
+	}
+}
+
+func TestByExtension(t *testing.T) {
+	var registry autoimport.Registry
+	registry.Add("ABC", sniffingLoader{"ABC"}, ".abc")
+	registry.Add("XYZ", sniffingLoader{"XYZ"}, ".xyz", ".zz")
+	if format, ok := registry.ByExtension(".ZZ"); !ok || format.Name != "XYZ" {
+		t.Errorf("Expected XYZ, got %v", format.Name)
+	}
+	if _, ok := registry.ByExtension(".csv"); ok {
+		t.Error("Expected no format")
+	}
+}
+
+type loader struct {
+}
+
+func (l loader) Load(
+	accountId int64,
+	bankAccountId string,
+	r io.Reader,
+	startDate time.Time) (autoimport.Batch, error) {
+	return nil, nil
+}
+
+// sniffingLoader is certain about files containing magic. It has some
+// confidence about files containing magic after other text.
+type sniffingLoader struct {
+	magic string
+}
+
+func (l sniffingLoader) Load(
+	accountId int64,
+	bankAccountId string,
+	r io.Reader,
+	startDate time.Time) (autoimport.Batch, error) {
+	return nil, nil
+}
+
+func (l sniffingLoader) Sniff(head []byte) int {
+	switch idx := bytes.Index(head, []byte(l.magic)); {
+	case idx == 0:
+		return autoimport.MaxScore
+	case idx > 0:
+		return autoimport.MaxScore / 2
+	}
+	return 0
+}
@@ -54,6 +54,11 @@ func (a AccountDetail) Active() bool {
 	return a.ptr.active
 }
 
+// Currency returns the currency of the account.
+func (a AccountDetail) Currency() fin.Currency {
+	return a.ptr.currency.OrDefault()
+}
+
 // CatDetail represents category detail.
 type CatDetail struct {
 	ptr *catDetail
@@ -109,6 +114,11 @@ type AccountUpdater interface {
 	Update(id int64, newName string) error
 }
 
+// AccountCurrencyUpdater changes the currency of an account in the database.
+type AccountCurrencyUpdater interface {
+	UpdateCurrency(id int64, currency fin.Currency) error
+}
+
 // AccountRemover removes a account in the database by marking it inactive.
 type AccountRemover interface {
 	Remove(id int64) error
@@ -139,6 +149,7 @@ type detail struct {
 	name       string
 	parentId   int64
 	origActive bool
+	currency   fin.Currency
 }
 
 // LeafNameById returns the category leaf name by category Id.
@@ -165,6 +176,13 @@ func (cds CatDetailStore) DetailById(cat fin.Cat) CatDetail {
 	return CatDetail{&d.catDetail}
 }
 
+// Exists returns true if cat is in this store. Exists returns true for
+// inactive categories and accounts.
+func (cds CatDetailStore) Exists(cat fin.Cat) bool {
+	_, ok := cds.data().catIdToDetail[cat]
+	return ok
+}
+
 // AccountDetailById returns account details by acount Id.
 func (cds CatDetailStore) AccountDetailById(id int64) AccountDetail {
 	cat := fin.Cat{Id: id, Type: fin.AccountCat}
@@ -177,6 +195,13 @@ func (cds CatDetailStore) AccountDetailById(id int64) AccountDetail {
 	return AccountDetail{d}
 }
 
+// AccountCurrency returns the currency of the account with given id.
+// AccountCurrency returns USD for unknown accounts. AccountCurrency lets
+// a CatDetailStore be used as a fin.AccountCurrencies.
+func (cds CatDetailStore) AccountCurrency(id int64) fin.Currency {
+	return cds.AccountDetailById(id).Currency()
+}
+
 // ActiveCatDetails returns all active category details sorted by full name.
 // If accounts is true also includes account categories.
 func (cds CatDetailStore) ActiveCatDetails(accounts bool) []CatDetail {
@@ -323,6 +348,55 @@ func (cds CatDetailStore) Filter(cat fin.Cat, includeChildren bool) fin.CatFilte
 	return cds.FilterForEnvelopes(cat, includeChildren, nil)
 }
 
+// MatchingCats returns all the categories, active or inactive, that f
+// matches. Categories that this store does not know about are never
+// included.
+func (cds CatDetailStore) MatchingCats(f fin.CatFilter) fin.CatSet {
+	result := make(fin.CatSet)
+	for cat := range cds.data().catIdToDetail {
+		if f(cat) {
+			result[cat] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Limit returns a store that shows only the categories and accounts that
+// allowed matches. The returned store leaves the others out of its lists
+// and lookups by name and forgets the accounts that allowed does not
+// match. Expense and income categories that allowed does not match still
+// work as parents so that the full names of the ones it matches stay
+// the same.
+func (cds CatDetailStore) Limit(allowed fin.CatFilter) CatDetailStore {
+	data := cds.data()
+	result := &catDetailStore{
+		catIdToDetail:            make(map[fin.Cat]*detail),
+		fullNameToDetail:         make(map[string]*detail),
+		fullNameToInactiveDetail: make(map[string]*detail),
+		accountNameToDetail:      make(map[string]*detail)}
+	for cat, d := range data.catIdToDetail {
+		if cat.Type != fin.AccountCat || allowed(cat) {
+			result.catIdToDetail[cat] = d
+		}
+	}
+	for name, d := range data.fullNameToDetail {
+		if allowed(d.id) {
+			result.fullNameToDetail[name] = d
+		}
+	}
+	for name, d := range data.fullNameToInactiveDetail {
+		if allowed(d.id) {
+			result.fullNameToInactiveDetail[name] = d
+		}
+	}
+	for name, d := range data.accountNameToDetail {
+		if allowed(d.id) {
+			result.accountNameToDetail[name] = d
+		}
+	}
+	return CatDetailStore{result}
+}
+
 // FilterForEnvelopes works like Filter except when includeChildren is true,
 // if the ancestor path from the category being filtered up to but not
 // including cat contains categories in envelopes then that category is
@@ -528,6 +602,29 @@ func (cds CatDetailStore) AccountRename(
 	return
 }
 
+// AccountSetCurrency changes the currency of an account in the database
+// and returns the updated store. id is the id of the account; currency is
+// the new currency; updater does the change in the database.
+// On error, returns the receiver unchanged.
+func (cds CatDetailStore) AccountSetCurrency(
+	id int64, currency fin.Currency, updater AccountCurrencyUpdater) (
+	updatedStore CatDetailStore, err error) {
+	updatedStore = cds
+	catIdToDetail := cds.data().catIdToDetail
+	catId := fin.Cat{Id: id, Type: fin.AccountCat}
+	if catIdToDetail[catId] == nil {
+		err = NoSuchCategory
+		return
+	}
+	if err = updater.UpdateCurrency(id, currency); err != nil {
+		return
+	}
+	catIdToDetail = copyRawInfo(catIdToDetail)
+	catIdToDetail[catId].currency = currency
+	updatedStore = newCatDetailStore(catIdToDetail)
+	return
+}
+
 // AccountRemove removes a account from database and returns the updated
 // store. id specifies the account to be removed; remover does the actual
 // remove in the database.
@@ -891,7 +988,8 @@ func accountToDetail(account *fin.Account) *detail {
 				Id:   account.Id,
 				Type: fin.AccountCat}},
 		name:       account.Name,
-		origActive: account.Active}
+		origActive: account.Active,
+		currency:   account.Currency}
 }
 
 func topLevelName(t fin.CatType) string {
@@ -299,6 +299,31 @@ func TestActiveAccountDetails(t *testing.T) {
 	}
 }
 
+func TestLimit(t *testing.T) {
+	cds := createCatDetailStore().Limit(func(cat fin.Cat) bool {
+		return cat == toCat("0:4") || cat == toCat("2:2")
+	})
+	expected := []CatDetail{
+		createCatDetail(toCat("0:4"), "expense:car:gas", true),
+		createCatDetail(toCat("2:2"), "account:savings", true)}
+	details := cds.ActiveCatDetails(true)
+	if !reflect.DeepEqual(details, expected) {
+		t.Errorf("Expected %v, got %v", expected, details)
+	}
+	accountDetails := cds.ActiveAccountDetails()
+	if output := len(accountDetails); output != 1 {
+		t.Fatalf("Expected 1 account, got %v", output)
+	}
+	verifyAccountDetailIs(t, accountDetails[0], 2, "savings", true)
+	verifyAccountDetail(t, cds, 1, "1", false)
+	verifyNoAccountDetailByName(t, cds, "checking")
+	verifyNoDetailByFullName(t, cds, "expense:car")
+	verifyNoInactiveDetailByFullName(t, cds, "account:inactive")
+	if !cds.IsChildOf(toCat("0:4"), toCat("0:1")) {
+		t.Error("Expected expense:car:gas to stay under expense:car")
+	}
+}
+
 func TestSortedCatRecs(t *testing.T) {
 	cds := createCatDetailStore()
 	catrecs := []fin.CatRec{
@@ -421,6 +446,37 @@ func TestFilterTopLevelNoChildren(t *testing.T) {
 	verifyFilterExcludes(t, cat_filter, toCat("0:9983"))
 }
 
+func TestMatchingCats(t *testing.T) {
+	cds := createCatDetailStore()
+	expected := fin.CatSet{
+		toCat("0:1"):  struct{}{},
+		toCat("0:4"):  struct{}{},
+		toCat("0:5"):  struct{}{},
+		toCat("0:98"): struct{}{},
+	}
+	if output := cds.MatchingCats(cds.Filter(toCat("0:1"), true)); !reflect.DeepEqual(expected, output) {
+		t.Errorf("Expected %v, got %v", expected, output)
+	}
+	expected = fin.CatSet{toCat("2:3"): struct{}{}}
+	if output := cds.MatchingCats(cds.Filter(toCat("2:3"), false)); !reflect.DeepEqual(expected, output) {
+		t.Errorf("Expected %v, got %v", expected, output)
+	}
+}
+
+func TestExists(t *testing.T) {
+	cds := createCatDetailStore()
+	for _, cat := range []string{"0:0", "1:0", "0:98", "2:1", "2:3"} {
+		if !cds.Exists(toCat(cat)) {
+			t.Errorf("Expected %s to exist", cat)
+		}
+	}
+	for _, cat := range []string{"0:9999", "2:9999", "7:1"} {
+		if cds.Exists(toCat(cat)) {
+			t.Errorf("Expected %s not to exist", cat)
+		}
+	}
+}
+
 func TestTotalsForEnvelopes(t *testing.T) {
 	cds := createCatDetailStore()
 	catTotals := fin.CatTotals{
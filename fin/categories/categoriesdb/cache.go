@@ -78,6 +78,16 @@ type AccountRenamer interface {
 		cds categories.CatDetailStore, err error)
 }
 
+type AccountCurrencySetter interface {
+	// AccountSetCurrency changes the currency of an account in the database,
+	// updates this cache, and returns the updated store. id is the account
+	// id; currency is the new currency.
+	// On error, AccountSetCurrency returns the most current version of
+	// store available.
+	AccountSetCurrency(t db.Transaction, id int64, currency fin.Currency) (
+		cds categories.CatDetailStore, err error)
+}
+
 type Purger interface {
 	// Because Remove does not physically remove categories from the database
 	// but only marks them as inactive, Purge is needed to physically remove
@@ -141,6 +151,13 @@ func (n NoPermissionCache) AccountRename(t db.Transaction, id int64, newName str
 	return
 }
 
+func (n NoPermissionCache) AccountSetCurrency(
+	t db.Transaction, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	err = NoPermission
+	return
+}
+
 func (n NoPermissionCache) Purge(t db.Transaction, cats fin.CatSet) error {
 	return NoPermission
 }
@@ -78,6 +78,11 @@ type AccountRemover interface {
 	categoriesdb.AccountRemover
 }
 
+type AccountCurrencySetter interface {
+	Invalidater
+	categoriesdb.AccountCurrencySetter
+}
+
 type Purger interface {
 	categoriesdb.Getter
 	categoriesdb.Purger
@@ -455,6 +460,29 @@ func (f *Fixture) CacheAccountRenameMalformed(
 	}
 }
 
+func (f *Fixture) CacheAccountSetCurrency(
+	t *testing.T, cache AccountCurrencySetter) {
+	f.createAccounts(t)
+	cacheGet(t, cache)
+	oldCds := f.createCatDetails(t)
+	catId := detailByFullName(t, oldCds, "account:checking").Id()
+	if currency := oldCds.AccountCurrency(catId.Id); currency != fin.USD {
+		t.Errorf("Expected USD, got %v", currency)
+	}
+	cds, err := cache.AccountSetCurrency(nil, catId.Id, "EUR")
+	if err != nil {
+		t.Fatalf("Got error updating database: %v", err)
+	}
+	if currency := cds.AccountCurrency(catId.Id); currency != "EUR" {
+		t.Errorf("Expected EUR, got %v", currency)
+	}
+	f.verifySameAsDb(t, cds)
+	verifyCached(t, cache, cds)
+	if _, err = cache.AccountSetCurrency(nil, 9998, "EUR"); err != categories.NoSuchCategory {
+		t.Errorf("Expected categories.NoSuchCategory, got %v", err)
+	}
+}
+
 func (f *Fixture) CacheAccountRemove(t *testing.T, cache AccountRemover) {
 	f.createAccounts(t)
 	cacheGet(t, cache)
@@ -0,0 +1,325 @@
+package for_memory
+
+import (
+	"sync"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/categories/categoriesdb"
+	fmemory "github.com/keep94/finances/fin/findb/for_memory"
+	"github.com/keep94/toolbox/db"
+)
+
+func New(db *fmemory.Db) *Cache {
+	return &Cache{db: db}
+}
+
+func ReadOnlyWrapper(c *Cache) ReadOnlyCache {
+	return ReadOnlyCache{cache: c}
+}
+
+type catDetailCache struct {
+	mutex sync.Mutex
+	data  categories.CatDetailStore
+	valid bool
+}
+
+func (c *catDetailCache) DbGet(db *fmemory.Db) (
+	cds categories.CatDetailStore, err error) {
+	cds, ok := c.getFromCache()
+	if ok {
+		return
+	}
+	err = db.Do(func(tx *fmemory.Tx) (err error) {
+		cds, err = c.load(tx)
+		return
+	})
+	return
+}
+
+func (c *catDetailCache) Get(tx *fmemory.Tx) (
+	cds categories.CatDetailStore, err error) {
+	cds, ok := c.getFromCache()
+	if ok {
+		return
+	}
+	return c.load(tx)
+}
+
+func (c *catDetailCache) Invalidate(tx *fmemory.Tx) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.valid = false
+	return nil
+}
+
+func (c *catDetailCache) AccountAdd(tx *fmemory.Tx, name string) (
+	cds categories.CatDetailStore, newId int64, err error) {
+	if cds, err = catDetails(tx); err != nil {
+		cds, _ = c.getFromCache()
+		return
+	}
+	cds, newId, err = cds.AccountAdd(name, accountStoreUpdater{tx})
+	c.save(cds)
+	return
+}
+
+func (c *catDetailCache) AccountRename(
+	tx *fmemory.Tx, id int64, name string) (
+	cds categories.CatDetailStore, err error) {
+	if cds, err = catDetails(tx); err != nil {
+		cds, _ = c.getFromCache()
+		return
+	}
+	cds, err = cds.AccountRename(id, name, accountStoreUpdater{tx})
+	c.save(cds)
+	return
+}
+
+func (c *catDetailCache) AccountSetCurrency(
+	tx *fmemory.Tx, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	if cds, err = catDetails(tx); err != nil {
+		cds, _ = c.getFromCache()
+		return
+	}
+	cds, err = cds.AccountSetCurrency(id, currency, accountStoreUpdater{tx})
+	c.save(cds)
+	return
+}
+
+func (c *catDetailCache) AccountRemove(
+	tx *fmemory.Tx, id int64) (
+	cds categories.CatDetailStore, err error) {
+	if cds, err = catDetails(tx); err != nil {
+		cds, _ = c.getFromCache()
+		return
+	}
+	cds, err = cds.AccountRemove(id, accountStoreUpdater{tx})
+	c.save(cds)
+	return
+}
+
+func (c *catDetailCache) Add(tx *fmemory.Tx, name string) (
+	cds categories.CatDetailStore, newId fin.Cat, err error) {
+	if cds, err = catDetails(tx); err != nil {
+		cds, _ = c.getFromCache()
+		return
+	}
+	cds, newId, err = cds.Add(name, catDetailStoreUpdater{tx})
+	c.save(cds)
+	return
+}
+
+func (c *catDetailCache) Remove(tx *fmemory.Tx, id fin.Cat) (
+	cds categories.CatDetailStore, err error) {
+	if cds, err = catDetails(tx); err != nil {
+		cds, _ = c.getFromCache()
+		return
+	}
+	cds, err = cds.Remove(id, catDetailStoreUpdater{tx})
+	c.save(cds)
+	return
+}
+
+func (c *catDetailCache) Purge(tx *fmemory.Tx, cats fin.CatSet) error {
+	t := updateTables(tx)
+	for cat := range cats {
+		if cat.Type == fin.ExpenseCat {
+			delete(t.expense, cat.Id)
+		} else if cat.Type == fin.IncomeCat {
+			delete(t.income, cat.Id)
+		} else {
+			return categories.NeedExpenseIncomeCategory
+		}
+	}
+	return c.Invalidate(tx)
+}
+
+func (c *catDetailCache) Rename(tx *fmemory.Tx, id fin.Cat, newName string) (
+	cds categories.CatDetailStore, err error) {
+	if cds, err = catDetails(tx); err != nil {
+		cds, _ = c.getFromCache()
+		return
+	}
+	cds, err = cds.Rename(id, newName, catDetailStoreUpdater{tx})
+	c.save(cds)
+	return
+}
+
+func (c *catDetailCache) save(cds categories.CatDetailStore) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.data = cds
+	c.valid = true
+}
+
+func (c *catDetailCache) load(tx *fmemory.Tx) (
+	cds categories.CatDetailStore, err error) {
+	if cds, err = catDetails(tx); err != nil {
+		return
+	}
+	c.save(cds)
+	return
+}
+
+func (c *catDetailCache) getFromCache() (cds categories.CatDetailStore, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.valid {
+		return
+	}
+	return c.data, true
+}
+
+type Cache struct {
+	db *fmemory.Db
+	c  catDetailCache
+}
+
+func (c *Cache) AccountAdd(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId int64, err error) {
+	err = fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		cds, newId, err = c.c.AccountAdd(tx, name)
+		return
+	})
+	return
+}
+
+func (c *Cache) AccountRename(t db.Transaction, id int64, name string) (
+	cds categories.CatDetailStore, err error) {
+	err = fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		cds, err = c.c.AccountRename(tx, id, name)
+		return
+	})
+	return
+}
+
+func (c *Cache) AccountSetCurrency(
+	t db.Transaction, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	err = fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		cds, err = c.c.AccountSetCurrency(tx, id, currency)
+		return
+	})
+	return
+}
+
+func (c *Cache) AccountRemove(t db.Transaction, id int64) (
+	cds categories.CatDetailStore, err error) {
+	err = fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		cds, err = c.c.AccountRemove(tx, id)
+		return
+	})
+	return
+}
+
+func (c *Cache) Add(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId fin.Cat, err error) {
+	err = fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		cds, newId, err = c.c.Add(tx, name)
+		return
+	})
+	return
+}
+
+func (c *Cache) Get(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	if t != nil {
+		err = fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) (err error) {
+			cds, err = c.c.Get(tx)
+			return
+		})
+		return
+	}
+	return c.c.DbGet(c.db)
+}
+
+func (c *Cache) Invalidate(t db.Transaction) error {
+	return fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) error {
+		return c.c.Invalidate(tx)
+	})
+}
+
+func (c *Cache) Remove(t db.Transaction, id fin.Cat) (
+	cds categories.CatDetailStore, err error) {
+	err = fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		cds, err = c.c.Remove(tx, id)
+		return
+	})
+	return
+}
+
+func (c *Cache) Purge(t db.Transaction, cats fin.CatSet) error {
+	return fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) error {
+		return c.c.Purge(tx, cats)
+	})
+}
+
+func (c *Cache) Rename(t db.Transaction, id fin.Cat, newName string) (
+	cds categories.CatDetailStore, err error) {
+	err = fmemory.ToDoer(c.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		cds, err = c.c.Rename(tx, id, newName)
+		return
+	})
+	return
+}
+
+// The writing methods of ReadOnlyCache merely return
+// categoriesdb.NoPermission error along with the contents of the cache.
+// If nothing is in the cache, they read from the database.
+type ReadOnlyCache struct {
+	categoriesdb.NoPermissionCache
+	cache *Cache
+}
+
+func (c ReadOnlyCache) Get(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	return c.cache.Get(t)
+}
+
+func (c ReadOnlyCache) AccountAdd(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId int64, err error) {
+	cds, err = c.reportNoPermission(t)
+	return
+}
+
+func (c ReadOnlyCache) AccountRename(t db.Transaction, id int64, name string) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) AccountSetCurrency(
+	t db.Transaction, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) AccountRemove(t db.Transaction, id int64) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) Add(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId fin.Cat, err error) {
+	cds, err = c.reportNoPermission(t)
+	return
+}
+
+func (c ReadOnlyCache) Remove(t db.Transaction, id fin.Cat) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) Rename(
+	t db.Transaction, id fin.Cat, newName string) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) reportNoPermission(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	cds, _ = c.cache.Get(t)
+	err = categoriesdb.NoPermission
+	return
+}
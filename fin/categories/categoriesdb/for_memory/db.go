@@ -0,0 +1,178 @@
+// Package for_memory stores types in categories package in memory.
+package for_memory
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	fmemory "github.com/keep94/finances/fin/findb/for_memory"
+)
+
+const (
+	kTableName = "categoriesdb"
+)
+
+// tables holds the expense and income categories.
+type tables struct {
+	expense       map[int64]categories.CatDbRow
+	income        map[int64]categories.CatDbRow
+	lastExpenseId int64
+	lastIncomeId  int64
+}
+
+func newTables() fmemory.Table {
+	return &tables{
+		expense: make(map[int64]categories.CatDbRow),
+		income:  make(map[int64]categories.CatDbRow),
+	}
+}
+
+func (t *tables) Clone() fmemory.Table {
+	result := *t
+	result.expense = maps.Clone(t.expense)
+	result.income = maps.Clone(t.income)
+	return &result
+}
+
+func readTables(tx *fmemory.Tx) *tables {
+	return tx.Table(kTableName, newTables).(*tables)
+}
+
+func updateTables(tx *fmemory.Tx) *tables {
+	return tx.TableForUpdate(kTableName, newTables).(*tables)
+}
+
+// CatDetails populates a CatDetailStore object from the database.
+func catDetails(tx *fmemory.Tx) (
+	cds categories.CatDetailStore, err error) {
+	cdsb := categories.CatDetailStoreBuilder{}
+	cdc := categories.CatDetailConsumer{Builder: &cdsb, Type: fin.ExpenseCat}
+	t := readTables(tx)
+	readRows(t.expense, &cdc)
+	cdc.Type = fin.IncomeCat
+	readRows(t.income, &cdc)
+	adc := categories.AccountDetailConsumer{Builder: &cdsb}
+	if err = fmemory.ConnNew(tx).Accounts(nil, &adc); err != nil {
+		return
+	}
+	cds = cdsb.Build()
+	return
+}
+
+func readRows(
+	rows map[int64]categories.CatDbRow,
+	consumer consume2.Consumer[categories.CatDbRow]) {
+	for _, id := range slices.Sorted(maps.Keys(rows)) {
+		if !consumer.CanConsume() {
+			return
+		}
+		consumer.Consume(rows[id])
+	}
+}
+
+// accountStoreUpdater updates an in-memory database on behalf of a
+// fin.CatDetailStore value.
+type accountStoreUpdater struct {
+	C *fmemory.Tx
+}
+
+func (u accountStoreUpdater) Add(name string) (newId int64, err error) {
+	account := fin.Account{
+		Name:   name,
+		Active: true,
+	}
+	if err = fmemory.ConnNew(u.C).AddAccount(nil, &account); err != nil {
+		return
+	}
+	newId = account.Id
+	return
+}
+
+func (u accountStoreUpdater) Update(id int64, newName string) error {
+	store := fmemory.ConnNew(u.C)
+	var account fin.Account
+	err := store.AccountById(nil, id, &account)
+	if err != nil {
+		return err
+	}
+	account.Name = newName
+	account.Active = true
+	return store.UpdateAccount(nil, &account)
+}
+
+func (u accountStoreUpdater) UpdateCurrency(
+	id int64, currency fin.Currency) error {
+	return fmemory.ConnNew(u.C).UpdateAccountCurrency(nil, id, currency)
+}
+
+func (u accountStoreUpdater) Remove(id int64) error {
+	store := fmemory.ConnNew(u.C)
+	var account fin.Account
+	err := store.AccountById(nil, id, &account)
+	if err != nil {
+		return err
+	}
+	account.Active = false
+	return store.UpdateAccount(nil, &account)
+}
+
+// catDetailStoreUpdater updates an in-memory database on behalf of a
+// fin.CatDetailStore value.
+type catDetailStoreUpdater struct {
+	C *fmemory.Tx
+}
+
+func (u catDetailStoreUpdater) Add(t fin.CatType, row *categories.CatDbRow) error {
+	tbls := updateTables(u.C)
+	if t == fin.ExpenseCat {
+		tbls.lastExpenseId++
+		row.Id = tbls.lastExpenseId
+		tbls.expense[row.Id] = *row
+	} else if t == fin.IncomeCat {
+		tbls.lastIncomeId++
+		row.Id = tbls.lastIncomeId
+		tbls.income[row.Id] = *row
+	} else {
+		panic("t must be either ExpenseCat or IncomeCat")
+	}
+	return nil
+}
+
+func (u catDetailStoreUpdater) Update(t fin.CatType, row *categories.CatDbRow) error {
+	rows := u.rows(t)
+	if rows == nil {
+		panic("t must be either ExpenseCat or IncomeCat")
+	}
+	if _, ok := rows[row.Id]; ok {
+		rows[row.Id] = *row
+	}
+	return nil
+}
+
+func (u catDetailStoreUpdater) Remove(t fin.CatType, id int64) error {
+	rows := u.rows(t)
+	if rows == nil {
+		return categories.NeedExpenseIncomeCategory
+	}
+	if row, ok := rows[id]; ok {
+		row.Active = false
+		rows[id] = row
+	}
+	return nil
+}
+
+// rows returns the rows for t for updating or nil if t is neither
+// fin.ExpenseCat nor fin.IncomeCat.
+func (u catDetailStoreUpdater) rows(
+	t fin.CatType) map[int64]categories.CatDbRow {
+	if t == fin.ExpenseCat {
+		return updateTables(u.C).expense
+	}
+	if t == fin.IncomeCat {
+		return updateTables(u.C).income
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package for_memory
+
+import (
+	"testing"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/categories/categoriesdb/fixture"
+	fmemory "github.com/keep94/finances/fin/findb/for_memory"
+	"github.com/keep94/toolbox/db"
+)
+
+func TestCatDetails(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CatDetails(t)
+}
+
+func TestCatDetailGoodAdd(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CatDetailGoodAdd(t)
+}
+
+func TestCatDetailsBadAdds(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CatDetailsBadAdds(t)
+}
+
+func TestCatDetailsRename(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CatDetailsRename(t)
+}
+
+func TestCatDetailsRename2(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CatDetailsRename2(t)
+}
+
+func TestCatDetailsRenameSame(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CatDetailsRenameSame(t)
+}
+
+func TestCatDetailsRenameBad(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CatDetailsRenameBad(t)
+}
+
+func TestRemoveCatDetail(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).RemoveCatDetail(t)
+}
+
+func TestRemoveCatDetail2(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).RemoveCatDetail2(t)
+}
+
+func TestRemoveCatDetailMissing(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).RemoveCatDetailMissing(t)
+}
+
+func TestRemoveCatDetailError(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).RemoveCatDetailError(t)
+}
+
+func TestCacheGet(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheGet(t, New(db))
+}
+
+func TestCatDetailInvalidate(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CatDetailInvalidate(t, New(db))
+}
+
+func TestCacheAdd(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAdd(t, New(db))
+}
+
+func TestCacheAddError(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAddError(t, New(db))
+}
+
+func TestCacheRename(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheRename(t, New(db))
+}
+
+func TestCacheRenameError(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheRenameError(t, New(db))
+}
+
+func TestCacheRemove(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheRemove(t, New(db))
+}
+
+func TestCacheRemoveError(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheRemoveError(t, New(db))
+}
+
+func TestCacheAccountAdd(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountAdd(t, New(db))
+}
+
+func TestCacheAccountAddError(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountAddError(t, New(db))
+}
+
+func TestCacheAccountAddMalformed(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountAddMalformed(t, New(db))
+}
+
+func TestCacheAccountRename(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountRename(t, New(db))
+}
+
+func TestCacheAccountRenameSame(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountRenameSame(t, New(db))
+}
+
+func TestCacheAccountRenameError(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountRenameError(t, New(db))
+}
+
+func TestCacheAccountRenameError2(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountRenameError2(t, New(db))
+}
+
+func TestCacheAccountRenameMalformed(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountRenameMalformed(t, New(db))
+}
+
+func TestCacheAccountSetCurrency(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountSetCurrency(t, New(db))
+}
+
+func TestCacheAccountRemove(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountRemove(t, New(db))
+}
+
+func TestCacheAccountRemoveError(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CacheAccountRemoveError(t, New(db))
+}
+
+func TestCachePurge(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).CachePurge(t, New(db))
+}
+
+func newFixture(db *fmemory.Db) *fixture.Fixture {
+	return &fixture.Fixture{
+		Store: fmemory.New(db),
+		Doer:  fmemory.NewDoer(db),
+		Db:    dbstubb{db}}
+}
+
+type dbstubb struct {
+	db *fmemory.Db
+}
+
+func (d dbstubb) Read(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	err = fmemory.ToDoer(d.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		cds, err = catDetails(tx)
+		return
+	})
+	return
+}
+
+func (d dbstubb) Add(
+	t db.Transaction, cds categories.CatDetailStore, name string) (
+	newStore categories.CatDetailStore, newId fin.Cat, err error) {
+	err = fmemory.ToDoer(d.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		newStore, newId, err = cds.Add(name, catDetailStoreUpdater{C: tx})
+		return
+	})
+	return
+}
+
+func (d dbstubb) Rename(
+	t db.Transaction, cds categories.CatDetailStore, id fin.Cat, name string) (
+	newStore categories.CatDetailStore, err error) {
+	err = fmemory.ToDoer(d.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		newStore, err = cds.Rename(id, name, catDetailStoreUpdater{C: tx})
+		return
+	})
+	return
+}
+
+func (d dbstubb) Remove(
+	t db.Transaction, cds categories.CatDetailStore, id fin.Cat) (
+	newStore categories.CatDetailStore, err error) {
+	err = fmemory.ToDoer(d.db, t).Do(func(tx *fmemory.Tx) (err error) {
+		newStore, err = cds.Remove(id, catDetailStoreUpdater{C: tx})
+		return
+	})
+	return
+}
@@ -0,0 +1,381 @@
+package for_postgres
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/categories/categoriesdb"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+)
+
+func New(db *sqlite3_db.Db) *Cache {
+	return &Cache{db: db}
+}
+
+func ReadOnlyWrapper(c *Cache) ReadOnlyCache {
+	return ReadOnlyCache{cache: c}
+}
+
+const (
+	kSQLCategoryVersion     = "select version from category_version"
+	kSQLBumpCategoryVersion = "update category_version set version = nextval('category_version_seq') returning version"
+)
+
+// catDetailCache caches the category tree. Because several app servers
+// may share the database, the cache stores the version of the tree that
+// it holds. Each change to the tree gives it a new version, and the cache
+// reloads the tree whenever the version in the database differs.
+// Versions come from a sequence so that a version is never reused even
+// if the transaction that took it rolls back.
+type catDetailCache struct {
+	mutex   sync.Mutex
+	data    categories.CatDetailStore
+	version int64
+	valid   bool
+}
+
+func (c *catDetailCache) DbGet(db *sqlite3_db.Db) (
+	cds categories.CatDetailStore, err error) {
+	err = db.Do(func(tx *sql.Tx) (err error) {
+		cds, err = c.Get(tx)
+		return
+	})
+	return
+}
+
+func (c *catDetailCache) Get(tx *sql.Tx) (
+	cds categories.CatDetailStore, err error) {
+	version, err := currentVersion(tx)
+	if err != nil {
+		return
+	}
+	cds, ok := c.getFromCache(version)
+	if ok {
+		return
+	}
+	if cds, err = catDetails(tx); err != nil {
+		return
+	}
+	c.save(cds, version)
+	return
+}
+
+// Invalidate gives the category tree a new version so that every app
+// server reloads it.
+func (c *catDetailCache) Invalidate(tx *sql.Tx) error {
+	c.mutex.Lock()
+	c.valid = false
+	c.mutex.Unlock()
+	_, err := bumpVersion(tx)
+	return err
+}
+
+func (c *catDetailCache) AccountAdd(tx *sql.Tx, name string) (
+	cds categories.CatDetailStore, newId int64, err error) {
+	cds, err = c.change(tx, func(cds categories.CatDetailStore) (
+		result categories.CatDetailStore, err error) {
+		result, newId, err = cds.AccountAdd(name, accountStoreUpdater{tx})
+		return
+	})
+	return
+}
+
+func (c *catDetailCache) AccountRename(
+	tx *sql.Tx, id int64, name string) (
+	cds categories.CatDetailStore, err error) {
+	return c.change(tx, func(cds categories.CatDetailStore) (
+		categories.CatDetailStore, error) {
+		return cds.AccountRename(id, name, accountStoreUpdater{tx})
+	})
+}
+
+func (c *catDetailCache) AccountSetCurrency(
+	tx *sql.Tx, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	return c.change(tx, func(cds categories.CatDetailStore) (
+		categories.CatDetailStore, error) {
+		return cds.AccountSetCurrency(id, currency, accountStoreUpdater{tx})
+	})
+}
+
+func (c *catDetailCache) AccountRemove(
+	tx *sql.Tx, id int64) (
+	cds categories.CatDetailStore, err error) {
+	return c.change(tx, func(cds categories.CatDetailStore) (
+		categories.CatDetailStore, error) {
+		return cds.AccountRemove(id, accountStoreUpdater{tx})
+	})
+}
+
+func (c *catDetailCache) Add(tx *sql.Tx, name string) (
+	cds categories.CatDetailStore, newId fin.Cat, err error) {
+	cds, err = c.change(tx, func(cds categories.CatDetailStore) (
+		result categories.CatDetailStore, err error) {
+		result, newId, err = cds.Add(name, catDetailStoreUpdater{tx})
+		return
+	})
+	return
+}
+
+func (c *catDetailCache) Remove(tx *sql.Tx, id fin.Cat) (
+	cds categories.CatDetailStore, err error) {
+	return c.change(tx, func(cds categories.CatDetailStore) (
+		categories.CatDetailStore, error) {
+		return cds.Remove(id, catDetailStoreUpdater{tx})
+	})
+}
+
+func (c *catDetailCache) Purge(tx *sql.Tx, cats fin.CatSet) error {
+	expenseStmt, err := tx.Prepare("delete from expense_categories where id = $1")
+	if err != nil {
+		return err
+	}
+	defer expenseStmt.Close()
+	incomeStmt, err := tx.Prepare("delete from income_categories where id = $1")
+	if err != nil {
+		return err
+	}
+	defer incomeStmt.Close()
+	for cat := range cats {
+		if cat.Type == fin.ExpenseCat {
+			if _, err := expenseStmt.Exec(cat.Id); err != nil {
+				return err
+			}
+		} else if cat.Type == fin.IncomeCat {
+			if _, err := incomeStmt.Exec(cat.Id); err != nil {
+				return err
+			}
+		} else {
+			return categories.NeedExpenseIncomeCategory
+		}
+	}
+	return c.Invalidate(tx)
+}
+
+func (c *catDetailCache) Rename(tx *sql.Tx, id fin.Cat, newName string) (
+	cds categories.CatDetailStore, err error) {
+	return c.change(tx, func(cds categories.CatDetailStore) (
+		categories.CatDetailStore, error) {
+		return cds.Rename(id, newName, catDetailStoreUpdater{tx})
+	})
+}
+
+// change applies f to the category tree in the database and caches the
+// result. If f succeeds, change gives the tree a new version. If change
+// cannot read the tree, it returns what is in the cache along with the
+// error.
+func (c *catDetailCache) change(
+	tx *sql.Tx,
+	f func(cds categories.CatDetailStore) (
+		categories.CatDetailStore, error)) (
+	cds categories.CatDetailStore, err error) {
+	version, err := currentVersion(tx)
+	if err == nil {
+		cds, err = catDetails(tx)
+	}
+	if err != nil {
+		cds = c.lastSaved()
+		return
+	}
+	if cds, err = f(cds); err != nil {
+		c.save(cds, version)
+		return
+	}
+	if version, err = bumpVersion(tx); err != nil {
+		return
+	}
+	c.save(cds, version)
+	return
+}
+
+func (c *catDetailCache) save(cds categories.CatDetailStore, version int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.data = cds
+	c.version = version
+	c.valid = true
+}
+
+func (c *catDetailCache) getFromCache(version int64) (
+	cds categories.CatDetailStore, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.valid || c.version != version {
+		return
+	}
+	return c.data, true
+}
+
+func (c *catDetailCache) lastSaved() (cds categories.CatDetailStore) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.valid {
+		return
+	}
+	return c.data
+}
+
+func currentVersion(tx *sql.Tx) (version int64, err error) {
+	err = tx.QueryRow(kSQLCategoryVersion).Scan(&version)
+	return
+}
+
+func bumpVersion(tx *sql.Tx) (version int64, err error) {
+	err = tx.QueryRow(kSQLBumpCategoryVersion).Scan(&version)
+	return
+}
+
+type Cache struct {
+	db *sqlite3_db.Db
+	c  catDetailCache
+}
+
+func (c *Cache) AccountAdd(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId int64, err error) {
+	err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
+		cds, newId, err = c.c.AccountAdd(tx, name)
+		return
+	})
+	return
+}
+
+func (c *Cache) AccountRename(t db.Transaction, id int64, name string) (
+	cds categories.CatDetailStore, err error) {
+	err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
+		cds, err = c.c.AccountRename(tx, id, name)
+		return
+	})
+	return
+}
+
+func (c *Cache) AccountSetCurrency(
+	t db.Transaction, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
+		cds, err = c.c.AccountSetCurrency(tx, id, currency)
+		return
+	})
+	return
+}
+
+func (c *Cache) AccountRemove(t db.Transaction, id int64) (
+	cds categories.CatDetailStore, err error) {
+	err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
+		cds, err = c.c.AccountRemove(tx, id)
+		return
+	})
+	return
+}
+
+func (c *Cache) Add(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId fin.Cat, err error) {
+	err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
+		cds, newId, err = c.c.Add(tx, name)
+		return
+	})
+	return
+}
+
+func (c *Cache) Get(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	if t != nil {
+		err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
+			cds, err = c.c.Get(tx)
+			return
+		})
+		return
+	}
+	return c.c.DbGet(c.db)
+}
+
+func (c *Cache) Invalidate(t db.Transaction) error {
+	return sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) error {
+		return c.c.Invalidate(tx)
+	})
+}
+
+func (c *Cache) Remove(t db.Transaction, id fin.Cat) (
+	cds categories.CatDetailStore, err error) {
+	err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
+		cds, err = c.c.Remove(tx, id)
+		return
+	})
+	return
+}
+
+func (c *Cache) Purge(t db.Transaction, cats fin.CatSet) error {
+	return sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) error {
+		return c.c.Purge(tx, cats)
+	})
+}
+
+func (c *Cache) Rename(t db.Transaction, id fin.Cat, newName string) (
+	cds categories.CatDetailStore, err error) {
+	err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
+		cds, err = c.c.Rename(tx, id, newName)
+		return
+	})
+	return
+}
+
+// The writing methods of ReadOnlyCache merely return
+// categoriesdb.NoPermission error along with the contents of the cache.
+// If nothing is in the cache, they read from the database.
+type ReadOnlyCache struct {
+	categoriesdb.NoPermissionCache
+	cache *Cache
+}
+
+func (c ReadOnlyCache) Get(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	return c.cache.Get(t)
+}
+
+func (c ReadOnlyCache) AccountAdd(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId int64, err error) {
+	cds, err = c.reportNoPermission(t)
+	return
+}
+
+func (c ReadOnlyCache) AccountRename(t db.Transaction, id int64, name string) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) AccountSetCurrency(
+	t db.Transaction, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) AccountRemove(t db.Transaction, id int64) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) Add(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId fin.Cat, err error) {
+	cds, err = c.reportNoPermission(t)
+	return
+}
+
+func (c ReadOnlyCache) Remove(t db.Transaction, id fin.Cat) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) Rename(
+	t db.Transaction, id fin.Cat, newName string) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ReadOnlyCache) reportNoPermission(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	cds, _ = c.cache.Get(t)
+	err = categoriesdb.NoPermission
+	return
+}
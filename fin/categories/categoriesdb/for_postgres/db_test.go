@@ -0,0 +1,324 @@
+package for_postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/categories/categoriesdb/fixture"
+	fpostgres "github.com/keep94/finances/fin/findb/for_postgres"
+	"github.com/keep94/finances/fin/findb/postgres_setup"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+)
+
+const (
+	// kDSNEnv names the environment variable holding the connection string
+	// of the PostgreSQL database to test against. Tests are skipped if it
+	// is not set.
+	kDSNEnv = "FINANCES_POSTGRES_TEST_DSN"
+
+	// kTestSchema is dropped and recreated by each test.
+	kTestSchema = "categoriesdb_test"
+)
+
+func TestCatDetails(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CatDetails(t)
+}
+
+func TestCatDetailGoodAdd(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CatDetailGoodAdd(t)
+}
+
+func TestCatDetailsBadAdds(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CatDetailsBadAdds(t)
+}
+
+func TestCatDetailsRename(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CatDetailsRename(t)
+}
+
+func TestCatDetailsRename2(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CatDetailsRename2(t)
+}
+
+func TestCatDetailsRenameSame(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CatDetailsRenameSame(t)
+}
+
+func TestCatDetailsRenameBad(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CatDetailsRenameBad(t)
+}
+
+func TestRemoveCatDetail(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).RemoveCatDetail(t)
+}
+
+func TestRemoveCatDetail2(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).RemoveCatDetail2(t)
+}
+
+func TestRemoveCatDetailMissing(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).RemoveCatDetailMissing(t)
+}
+
+func TestRemoveCatDetailError(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).RemoveCatDetailError(t)
+}
+
+func TestCacheGet(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheGet(t, New(db))
+}
+
+func TestCatDetailInvalidate(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CatDetailInvalidate(t, New(db))
+}
+
+func TestCacheAdd(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAdd(t, New(db))
+}
+
+func TestCacheAddError(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAddError(t, New(db))
+}
+
+func TestCacheRename(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheRename(t, New(db))
+}
+
+func TestCacheRenameError(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheRenameError(t, New(db))
+}
+
+func TestCacheRemove(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheRemove(t, New(db))
+}
+
+func TestCacheRemoveError(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheRemoveError(t, New(db))
+}
+
+func TestCacheAccountAdd(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountAdd(t, New(db))
+}
+
+func TestCacheAccountAddError(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountAddError(t, New(db))
+}
+
+func TestCacheAccountAddMalformed(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountAddMalformed(t, New(db))
+}
+
+func TestCacheAccountRename(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountRename(t, New(db))
+}
+
+func TestCacheAccountRenameSame(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountRenameSame(t, New(db))
+}
+
+func TestCacheAccountRenameError(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountRenameError(t, New(db))
+}
+
+func TestCacheAccountRenameError2(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountRenameError2(t, New(db))
+}
+
+func TestCacheAccountRenameMalformed(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountRenameMalformed(t, New(db))
+}
+
+func TestCacheAccountSetCurrency(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountSetCurrency(t, New(db))
+}
+
+func TestCacheAccountRemove(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountRemove(t, New(db))
+}
+
+func TestCacheAccountRemoveError(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountRemoveError(t, New(db))
+}
+
+func TestCachePurge(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CachePurge(t, New(db))
+}
+
+func TestCacheSharedDatabase(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	// Each cache stands for a different app server.
+	cache, other := New(db), New(db)
+	if _, err := cache.Get(nil); err != nil {
+		t.Fatalf("Got error reading database: %v", err)
+	}
+	if _, _, err := other.Add(nil, "expense:shared"); err != nil {
+		t.Fatalf("Got error adding category: %v", err)
+	}
+	cds, err := cache.Get(nil)
+	if err != nil {
+		t.Fatalf("Got error reading database: %v", err)
+	}
+	if _, ok := cds.DetailByFullName("expense:shared"); !ok {
+		t.Error("Cache should see categories that other servers add.")
+	}
+}
+
+func newFixture(db *sqlite3_db.Db) *fixture.Fixture {
+	return &fixture.Fixture{
+		Store: fpostgres.New(db),
+		Doer:  sqlite3_db.NewDoer(db),
+		Db:    dbstubb{db}}
+}
+
+type dbstubb struct {
+	db *sqlite3_db.Db
+}
+
+func (d dbstubb) Read(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	err = sqlite3_db.ToDoer(d.db, t).Do(func(tx *sql.Tx) (err error) {
+		cds, err = catDetails(tx)
+		return
+	})
+	return
+}
+
+func (d dbstubb) Add(
+	t db.Transaction, cds categories.CatDetailStore, name string) (
+	newStore categories.CatDetailStore, newId fin.Cat, err error) {
+	err = sqlite3_db.ToDoer(d.db, t).Do(func(tx *sql.Tx) (err error) {
+		newStore, newId, err = cds.Add(name, catDetailStoreUpdater{C: tx})
+		return
+	})
+	return
+}
+
+func (d dbstubb) Rename(
+	t db.Transaction, cds categories.CatDetailStore, id fin.Cat, name string) (
+	newStore categories.CatDetailStore, err error) {
+	err = sqlite3_db.ToDoer(d.db, t).Do(func(tx *sql.Tx) (err error) {
+		newStore, err = cds.Rename(id, name, catDetailStoreUpdater{C: tx})
+		return
+	})
+	return
+}
+
+func (d dbstubb) Remove(
+	t db.Transaction, cds categories.CatDetailStore, id fin.Cat) (
+	newStore categories.CatDetailStore, err error) {
+	err = sqlite3_db.ToDoer(d.db, t).Do(func(tx *sql.Tx) (err error) {
+		newStore, err = cds.Remove(id, catDetailStoreUpdater{C: tx})
+		return
+	})
+	return
+}
+
+func openDb(t *testing.T) *sqlite3_db.Db {
+	dsn := os.Getenv(kDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", kDSNEnv)
+	}
+	if !slices.Contains(sql.Drivers(), "postgres") {
+		t.Skip("postgres driver not linked in; run tests with -tags postgres")
+	}
+	rawdb, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	// search_path is per connection, so use just one connection.
+	rawdb.SetMaxOpenConns(1)
+	_, err = rawdb.Exec(fmt.Sprintf(
+		"drop schema if exists %[1]s cascade; create schema %[1]s; set search_path to %[1]s",
+		kTestSchema))
+	if err != nil {
+		t.Fatalf("Error creating schema: %v", err)
+	}
+	db := sqlite3_db.New(rawdb)
+	err = db.Do(postgres_setup.SetUpTables)
+	if err != nil {
+		t.Fatalf("Error creating tables: %v", err)
+	}
+	return db
+}
+
+func closeDb(t *testing.T, db *sqlite3_db.Db) {
+	err := db.Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec("drop schema " + kTestSchema + " cascade")
+		return err
+	})
+	if err != nil {
+		t.Errorf("Error dropping schema: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Error closing database: %v", err)
+	}
+}
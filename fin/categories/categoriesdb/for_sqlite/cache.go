@@ -77,6 +77,18 @@ func (c *catDetailCache) AccountRename(
 	return
 }
 
+func (c *catDetailCache) AccountSetCurrency(
+	tx *sql.Tx, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	if cds, err = catDetails(tx); err != nil {
+		cds, _ = c.getFromCache()
+		return
+	}
+	cds, err = cds.AccountSetCurrency(id, currency, accountStoreUpdater{tx})
+	c.save(cds)
+	return
+}
+
 func (c *catDetailCache) AccountRemove(
 	tx *sql.Tx, id int64) (
 	cds categories.CatDetailStore, err error) {
@@ -197,6 +209,16 @@ func (c *Cache) AccountRename(t db.Transaction, id int64, name string) (
 	return
 }
 
+func (c *Cache) AccountSetCurrency(
+	t db.Transaction, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
+		cds, err = c.c.AccountSetCurrency(tx, id, currency)
+		return
+	})
+	return
+}
+
 func (c *Cache) AccountRemove(t db.Transaction, id int64) (
 	cds categories.CatDetailStore, err error) {
 	err = sqlite3_db.ToDoer(c.db, t).Do(func(tx *sql.Tx) (err error) {
@@ -281,6 +303,12 @@ func (c ReadOnlyCache) AccountRename(t db.Transaction, id int64, name string) (
 	return c.reportNoPermission(t)
 }
 
+func (c ReadOnlyCache) AccountSetCurrency(
+	t db.Transaction, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
 func (c ReadOnlyCache) AccountRemove(t db.Transaction, id int64) (
 	cds categories.CatDetailStore, err error) {
 	return c.reportNoPermission(t)
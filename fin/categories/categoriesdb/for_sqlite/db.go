@@ -61,6 +61,11 @@ func (u accountStoreUpdater) Update(id int64, newName string) error {
 	return store.UpdateAccount(nil, &account)
 }
 
+func (u accountStoreUpdater) UpdateCurrency(
+	id int64, currency fin.Currency) error {
+	return fsqlite.ConnNew(u.C).UpdateAccountCurrency(nil, id, currency)
+}
+
 func (u accountStoreUpdater) Remove(id int64) error {
 	store := fsqlite.ConnNew(u.C)
 	var account fin.Account
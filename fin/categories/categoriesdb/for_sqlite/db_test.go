@@ -176,6 +176,12 @@ func TestCacheAccountRenameMalformed(t *testing.T) {
 	newFixture(db).CacheAccountRenameMalformed(t, New(db))
 }
 
+func TestCacheAccountSetCurrency(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newFixture(db).CacheAccountSetCurrency(t, New(db))
+}
+
 func TestCacheAccountRemove(t *testing.T) {
 	db := openDb(t)
 	defer closeDb(t, db)
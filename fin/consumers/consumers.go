@@ -31,3 +31,36 @@ func FromEntryAggregator(
 	aggregator EntryAggregator) consume2.Consumer[fin.Entry] {
 	return consume2.ConsumerFunc[fin.Entry](aggregator.Include)
 }
+
+// ToBaseCurrency returns a consumer that converts each fin.Entry to the
+// base currency of converter before sending it to consumer. If converter
+// is nil, ToBaseCurrency returns consumer unchanged. If conversion fails,
+// the returned consumer stores the error in err and stops consuming.
+func ToBaseCurrency(
+	consumer consume2.Consumer[fin.Entry],
+	converter *fin.BaseConverter,
+	err *error) consume2.Consumer[fin.Entry] {
+	if converter == nil {
+		return consumer
+	}
+	return &baseCurrencyConsumer{
+		Consumer: consumer, converter: converter, err: err}
+}
+
+type baseCurrencyConsumer struct {
+	consume2.Consumer[fin.Entry]
+	converter *fin.BaseConverter
+	err       *error
+}
+
+func (b *baseCurrencyConsumer) CanConsume() bool {
+	return *b.err == nil && b.Consumer.CanConsume()
+}
+
+func (b *baseCurrencyConsumer) Consume(entry fin.Entry) {
+	if err := b.converter.Convert(&entry); err != nil {
+		*b.err = err
+		return
+	}
+	b.Consumer.Consume(entry)
+}
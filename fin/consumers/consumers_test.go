@@ -33,10 +33,44 @@ func TestFromEntryAggregator(t *testing.T) {
 	}
 }
 
+func TestToBaseCurrency(t *testing.T) {
+	entries := []fin.Entry{
+		{CatPayment: makeTotal(400)},
+		{CatPayment: makeTotalForAccount(700, 2)},
+		{CatPayment: makeTotalForAccount(1000, 3)},
+		{CatPayment: makeTotal(100)},
+	}
+	converter := &fin.BaseConverter{
+		Base:     fin.USD,
+		Rates:    fin.FixedRates{"USD": 1.0, "EUR": 1.5},
+		Accounts: fin.AccountCurrencyMap{2: "EUR", 3: "GBP"},
+	}
+	aggregator := entryTotaler{}
+	var err error
+	consumer := ToBaseCurrency(
+		FromEntryAggregator(&aggregator), converter, &err)
+	for _, entry := range entries {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(entry)
+	}
+	if err != fin.NoExchangeRate {
+		t.Errorf("Expected NoExchangeRate, got %v", err)
+	}
+	if aggregator.total != 1450 {
+		t.Errorf("Expected 1450, got %v", aggregator.total)
+	}
+}
+
 func makeTotal(total int64) fin.CatPayment {
 	return fin.NewCatPayment(fin.NewCat("0:7"), -total, false, 0)
 }
 
+func makeTotalForAccount(total, paymentId int64) fin.CatPayment {
+	return fin.NewCatPayment(fin.NewCat("0:7"), -total, false, paymentId)
+}
+
 type entryTotaler struct {
 	total int64
 }
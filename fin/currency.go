@@ -0,0 +1,130 @@
+package fin
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// USD is the currency of accounts that do not specify one.
+	USD Currency = "USD"
+)
+
+var (
+	// NoExchangeRate is returned when no exchange rate is available.
+	NoExchangeRate = errors.New("fin: No exchange rate.")
+)
+
+// Currency is an ISO 4217 currency code such as "USD" or "EUR".
+// The zero value means USD. Amounts in every currency are stored in
+// one hundredth increments just like cents.
+type Currency string
+
+// ParseCurrency converts a string such as "eur" to a Currency.
+// The empty string maps to USD.
+func ParseCurrency(s string) (Currency, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return USD, nil
+	}
+	if len(s) != 3 {
+		return "", fmt.Errorf("fin: Invalid currency: %s", s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return "", fmt.Errorf("fin: Invalid currency: %s", s)
+		}
+	}
+	return Currency(s), nil
+}
+
+// OrDefault returns c or USD if c is the zero value.
+func (c Currency) OrDefault() Currency {
+	if c == "" {
+		return USD
+	}
+	return c
+}
+
+func (c Currency) String() string {
+	return string(c.OrDefault())
+}
+
+// AccountCurrencies returns the currency of an account by account id.
+type AccountCurrencies interface {
+	AccountCurrency(id int64) Currency
+}
+
+// AccountCurrencyMap is a simple AccountCurrencies implementation.
+// Accounts missing from the map are in USD.
+type AccountCurrencyMap map[int64]Currency
+
+func (a AccountCurrencyMap) AccountCurrency(id int64) Currency {
+	return a[id].OrDefault()
+}
+
+// ExchangeRates supplies exchange rates.
+type ExchangeRates interface {
+	// Rate returns how many units of to one unit of from buys on date.
+	// Rate returns NoExchangeRate if it has no rate for from and to.
+	Rate(from, to Currency, date time.Time) (float64, error)
+}
+
+// FixedRates are exchange rates that do not change over time. Each key is
+// a currency; each value is what one unit of that currency is worth in
+// some common reference currency.
+type FixedRates map[Currency]float64
+
+func (f FixedRates) Rate(from, to Currency, date time.Time) (
+	float64, error) {
+	from = from.OrDefault()
+	to = to.OrDefault()
+	if from == to {
+		return 1.0, nil
+	}
+	fromValue, fromOk := f[from]
+	toValue, toOk := f[to]
+	if !fromOk || !toOk || fromValue <= 0 || toValue <= 0 {
+		return 0, NoExchangeRate
+	}
+	return fromValue / toValue, nil
+}
+
+// BaseConverter converts entries to a single base currency so that
+// entries from accounts in different currencies can be totaled together.
+type BaseConverter struct {
+	// The currency to convert to.
+	Base Currency
+	// Supplies the exchange rates.
+	Rates ExchangeRates
+	// Supplies the currency of each account.
+	Accounts AccountCurrencies
+}
+
+// Convert converts entry in place so that all its amounts are in the
+// base currency. Convert uses the exchange rate in effect on the date
+// of entry.
+func (b *BaseConverter) Convert(entry *Entry) error {
+	from := b.Accounts.AccountCurrency(entry.PaymentId())
+	rate, err := b.Rates.Rate(from, b.Base, entry.Date)
+	if err != nil {
+		return err
+	}
+	entry.CatPayment.convert(rate)
+	return nil
+}
+
+// ConvertAmount converts amount using rate rounding to the nearest
+// hundredth of a unit.
+func ConvertAmount(amount int64, rate float64) int64 {
+	return int64(math.Round(float64(amount) * rate))
+}
+
+// FormatCurrency formats amount as dollars and cents followed by the
+// currency code. 347, EUR -> "3.47 EUR"
+func FormatCurrency(x int64, c Currency) string {
+	return fmt.Sprintf("%s %s", FormatUSD(x), c)
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/keep94/finances/fin"
 	"github.com/keep94/finances/fin/categories"
-	"github.com/keep94/finances/fin/consumers"
 	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/db"
@@ -189,7 +188,7 @@ func (s *Summary) TotalProgress() Progress {
 }
 
 type Store interface {
-	findb.EntriesRunner
+	findb.CatTotalsRunner
 	findb.AllocationsByYearRunner
 }
 
@@ -218,12 +217,11 @@ func SummaryByYear(
 	if t == nil {
 		panic(kNonNilTransactionRequired)
 	}
-	catTotals := make(fin.CatTotals)
-	consumer := consumers.FromCatPaymentAggregator(catTotals)
 	start := date_util.YMD(int(year), 1, 1)
 	end := date_util.YMD(int(year+1), 1, 1)
 	elo := &findb.EntryListOptions{Start: &start, End: &end}
-	if err := store.Entries(t, elo, consumer); err != nil {
+	catTotals, err := store.CatTotals(t, elo)
+	if err != nil {
 		return nil, err
 	}
 	rolledCatTotals, _ := cds.RollUp(catTotals)
@@ -251,6 +251,12 @@ func (f *fakeEntriesStore) Entries(
 	return nil
 }
 
+func (f *fakeEntriesStore) CatTotals(
+	t db.Transaction, options *findb.EntryListOptions) (
+	fin.CatTotals, error) {
+	return findb.CatTotals(t, f, options)
+}
+
 func copyOptions(options *findb.EntryListOptions) *findb.EntryListOptions {
 	if options == nil {
 		return nil
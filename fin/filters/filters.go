@@ -35,6 +35,8 @@ type AdvanceSearchSpec struct {
 	CF fin.CatFilter
 	// If present, include only entries whose total matches AF.
 	AF AmountFilter
+	// If non-empty, include only entries having this tag.
+	Tag string
 }
 
 // CompileAdvanceSearchSpec compiles a search specification.
@@ -56,6 +58,9 @@ func CompileAdvanceSearchSpec(
 	if spec.Desc != "" {
 		filters = append(filters, byDescFilterer(str_util.Normalize(spec.Desc)))
 	}
+	if spec.Tag != "" {
+		filters = append(filters, byTagFilterer(spec.Tag))
+	}
 	return consume2.ComposeFilters(filters...)
 }
 
@@ -88,3 +93,9 @@ func byDescFilterer(desc string) func(ptr *fin.Entry) bool {
 		return strings.Index(str_util.Normalize(ptr.Desc), desc) != -1
 	}
 }
+
+func byTagFilterer(tag string) func(ptr *fin.Entry) bool {
+	return func(ptr *fin.Entry) bool {
+		return ptr.HasTag(tag)
+	}
+}
@@ -47,6 +47,16 @@ func TestCompileAdvanceSearchSpec(t *testing.T) {
 			AF: func(amt int64) bool { return amt == -201 }})); output != 0 {
 		t.Errorf("Expected 0, got %v", output)
 	}
+	if output := runFilter(CompileAdvanceSearchSpec(
+		&AdvanceSearchSpec{Tag: " Kids "})); output != 2 {
+		t.Errorf("Expected 2, got %v", output)
+	}
+	if output := runFilter(CompileAdvanceSearchSpec(
+		&AdvanceSearchSpec{
+			Name: "Name",
+			Tag:  "kids"})); output != 1 {
+		t.Errorf("Expected 1, got %v", output)
+	}
 }
 
 func TestAccountFiltering(t *testing.T) {
@@ -103,13 +113,14 @@ func TestAccountFiltering(t *testing.T) {
 
 func runFilter(f func(ptr *fin.Entry) bool) int {
 	result := 0
-	if f(&fin.Entry{Name: "Name 1", Desc: "Desc 1"}) {
+	if f(&fin.Entry{Name: "Name 1", Desc: "Desc 1", Tags: []string{"kids"}}) {
 		result++
 	}
 	if f(&fin.Entry{Name: "Name 2", Desc: "Other"}) {
 		result++
 	}
-	if f(&fin.Entry{Name: "Other", Desc: "Other"}) {
+	if f(&fin.Entry{
+		Name: "Other", Desc: "Other", Tags: []string{"kids", "vacation"}}) {
 		result++
 	}
 	if f(&fin.Entry{
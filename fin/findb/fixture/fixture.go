@@ -3,14 +3,18 @@
 package fixture
 
 import (
+	"cmp"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/keep94/consume2"
 	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/autoimport/qfx/qfxdb"
 	"github.com/keep94/finances/fin/findb"
 	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/db"
@@ -61,6 +65,23 @@ type EntriesStore interface {
 	findb.EntriesRunner
 }
 
+type CatTotalsStore interface {
+	MinimalStore
+	findb.CatTotalsRunner
+}
+
+type EntriesPageStore interface {
+	MinimalStore
+	findb.EntriesPageRunner
+	findb.EntriesRunner
+	findb.AccountByIdRunner
+}
+
+type SearchEntriesStore interface {
+	MinimalStore
+	findb.SearchEntriesRunner
+}
+
 type EntriesByAccountIdStore interface {
 	MinimalStore
 	findb.EntriesByAccountIdRunner
@@ -77,6 +98,12 @@ type UpdateAccountImportSDStore interface {
 	findb.UpdateAccountImportSDRunner
 }
 
+type UpdateAccountCurrencyStore interface {
+	MinimalStore
+	findb.AccountByIdRunner
+	findb.UpdateAccountCurrencyRunner
+}
+
 type UpdateAccountStore interface {
 	MinimalStore
 	findb.AccountByIdRunner
@@ -89,6 +116,75 @@ type RemoveAccountStore interface {
 	findb.RemoveAccountRunner
 }
 
+type RecurringEntryStore interface {
+	findb.AddRecurringEntryRunner
+	findb.RecurringEntryByIdRunner
+	findb.AddAccountRunner
+}
+
+type EntryHistoryStore interface {
+	MinimalStore
+	findb.EntryByIdRunner
+	findb.EntryHistoryRunner
+}
+
+type UndoStore interface {
+	MinimalStore
+	findb.AccountByIdRunner
+	findb.EntryByIdRunner
+	findb.ChangeEntriesRunner
+	findb.LastChangeIdRunner
+	findb.UndoRunner
+}
+
+type UndoImportStore interface {
+	UndoStore
+	findb.TrashedEntriesRunner
+	findb.AddAttachmentRunner
+	findb.AttachmentContentsRunner
+}
+
+type AttachmentStore interface {
+	MinimalStore
+	findb.AddAttachmentRunner
+	findb.AttachmentByIdRunner
+	findb.AttachmentsByEntryIdRunner
+	findb.AttachmentContentsRunner
+	findb.RemoveAttachmentRunner
+}
+
+type TrashStore interface {
+	MinimalStore
+	findb.AccountByIdRunner
+	findb.EntryByIdRunner
+	findb.EntriesRunner
+	findb.TrashedEntriesRunner
+	findb.RestoreEntryRunner
+	findb.LastChangeIdRunner
+	findb.UndoRunner
+	findb.PurgeTrashRunner
+}
+
+type RecurringTrashStore interface {
+	findb.AddRecurringEntryRunner
+	findb.RecurringEntryByIdRunner
+	findb.RemoveRecurringEntryByIdRunner
+	findb.TrashedRecurringEntriesRunner
+	findb.RestoreRecurringEntryRunner
+	findb.PurgeTrashRunner
+}
+
+type TrashTimesStore interface {
+	TrashStore
+	RecurringTrashStore
+	findb.EntryHistoryRunner
+}
+
+type PurgeTrashStore interface {
+	AttachmentStore
+	findb.PurgeTrashRunner
+}
+
 type RecurringEntriesApplier interface {
 	findb.RecurringEntriesApplier
 	findb.AddRecurringEntryRunner
@@ -136,6 +232,33 @@ func (f EntryAccountFixture) AccountUpdates(t *testing.T, store AccountByIdStore
 		&fin.Account{Id: 2, Name: "savings", Active: true, Balance: 0, RBalance: 0, Count: 0, RCount: 0})
 }
 
+func (f EntryAccountFixture) AccountUpdatesExchangeRate(
+	t *testing.T, store EntryByIdWithEtagStore) {
+	f.createAccounts(t, store)
+	cpb := fin.CatPaymentBuilder{}
+	entry := fin.Entry{
+		Date: date_util.YMD(2012, 12, 9),
+		CatPayment: cpb.AddCatRec(
+			fin.CatRec{Cat: fin.NewCat("0:7"), Amount: 500}).AddCatRec(
+			fin.CatRec{Cat: fin.NewCat("2:2"), Amount: 1000}).SetPaymentId(
+			1).SetExchangeRate(0.9).Build()}
+	changes := findb.EntryChanges{Adds: []*fin.Entry{&entry}}
+	changeEntries(t, store, &changes)
+	verifyEntries(t, store, &entry)
+	verifyAccounts(
+		t,
+		store,
+		&fin.Account{Id: 1, Name: "checking", Active: true, Balance: -1500, Count: 1, ImportSD: kCheckingSD},
+		&fin.Account{Id: 2, Name: "savings", Active: true, Balance: 900, Count: 1})
+	changes = findb.EntryChanges{Deletes: []int64{entry.Id}}
+	changeEntries(t, store, &changes)
+	verifyAccounts(
+		t,
+		store,
+		&fin.Account{Id: 1, Name: "checking", Active: true, ImportSD: kCheckingSD},
+		&fin.Account{Id: 2, Name: "savings", Active: true})
+}
+
 func (f EntryAccountFixture) SaveAndLoadEntry(
 	t *testing.T, store EntryByIdStore) {
 	f.createAccounts(t, store)
@@ -145,7 +268,8 @@ func (f EntryAccountFixture) SaveAndLoadEntry(
 		Desc:       "A description",
 		CheckNo:    "1356",
 		CatPayment: fin.NewCatPayment(fin.NewCat("0:4"), 1234, false, 1),
-		Status:     fin.Reviewed}
+		Status:     fin.Reviewed,
+		Tags:       []string{"kids", "vacation-2026"}}
 	ec := findb.EntryChanges{Adds: []*fin.Entry{&entry}}
 	changeEntries(t, store, &ec)
 	verifyEntries(t, store, &entry)
@@ -306,6 +430,310 @@ func (f EntryAccountFixture) ListEntriesUnreviewed(
 	}
 }
 
+func (f EntryAccountFixture) ListEntriesAccount(
+	t *testing.T, store EntriesStore) {
+	f.createAccounts(t, store)
+	createListEntries(t, store)
+	verifyEntryIds(
+		t, fetchEntries(t, store, &findb.EntryListOptions{AccountId: 1}),
+		1, 2)
+	verifyEntryIds(
+		t, fetchEntries(t, store, &findb.EntryListOptions{AccountId: 2}),
+		3, 1, 2)
+
+	// Moving entry 3 to account 1 and deleting entry 2 changes the lists
+	cp := fin.NewCatPayment(fin.NewCat("0:7"), 400, false, 1)
+	changes := findb.EntryChanges{
+		Updates: map[int64]fin.EntryUpdater{3: changeCatPaymentFunc(&cp)},
+		Deletes: []int64{2}}
+	changeEntries(t, store, &changes)
+	verifyEntryIds(
+		t, fetchEntries(t, store, &findb.EntryListOptions{AccountId: 1}),
+		3, 1)
+	verifyEntryIds(
+		t, fetchEntries(t, store, &findb.EntryListOptions{AccountId: 2}),
+		1)
+	elo := findb.EntryListOptions{
+		AccountId: 1, Start: ymdPtr(2012, 11, 1)}
+	verifyEntryIds(t, fetchEntries(t, store, &elo), 3)
+}
+
+func (f EntryAccountFixture) ListEntriesCriteria(
+	t *testing.T, store EntriesStore) {
+	f.createAccounts(t, store)
+	createListEntries(t, store)
+	entry6 := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 1),
+		Name:       "Costco Wholesale",
+		Desc:       "Refund for TV",
+		Tags:       []string{"refund", "tv"},
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), -5000, false, 1)}
+	entry7 := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 2),
+		Name:       "Safeway",
+		Desc:       "100% juice_box",
+		Tags:       []string{"kids"},
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:8"), 700, false, 1)}
+	changeEntries(
+		t, store, &findb.EntryChanges{Adds: []*fin.Entry{&entry6, &entry7}})
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{
+			Cats: fin.CatSet{fin.NewCat("0:7"): struct{}{}}}),
+		6, 3)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{
+			Cats: fin.CatSet{
+				fin.NewCat("0:8"): struct{}{},
+				fin.NewCat("2:1"): struct{}{}}}),
+		7, 1, 2)
+	minTotal, maxTotal := int64(-700), int64(-100)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{
+			MinTotal: &minTotal, MaxTotal: &maxTotal}),
+		7, 3, 1, 2)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{MinTotal: &maxTotal}),
+		6, 1, 5, 4)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Name: "costco  WHOLE"}),
+		6)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Desc: "refund"}),
+		6)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Desc: "100% juice"}),
+		7)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Name: "Costco Retail"}))
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Limit: 3}),
+		7, 6, 3)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{
+			Name: "a", AccountId: 1, Limit: 1}),
+		7)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Tag: " TV"}),
+		6)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Tag: "kids", Limit: 1}),
+		7)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Tag: "kid"}))
+	// Changing and deleting entries changes what a tag matches.
+	changeEntries(t, store, &findb.EntryChanges{
+		Updates: map[int64]fin.EntryUpdater{
+			7: func(entry *fin.Entry) bool {
+				entry.Tags = []string{"TV"}
+				return true
+			}}})
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Tag: "tv"}),
+		7, 6)
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Tag: "kids"}))
+	changeEntries(t, store, &findb.EntryChanges{Deletes: []int64{6}})
+	verifyEntryIds(
+		t,
+		fetchEntries(t, store, &findb.EntryListOptions{Tag: "tv"}),
+		7)
+}
+
+func (f EntryAccountFixture) EntriesPage(
+	t *testing.T, store EntriesPageStore) {
+	f.createAccounts(t, store)
+	createListEntries(t, store)
+	entries, next := entriesPage(t, store, nil, "", 2)
+	verifyEntryIds(t, entries, 3, 1)
+	entries, next = entriesPage(t, store, nil, next, 2)
+	verifyEntryIds(t, entries, 5, 2)
+	entries, next = entriesPage(t, store, nil, next, 2)
+	verifyEntryIds(t, entries, 4)
+	if next != "" {
+		t.Errorf("Expected no more pages, got %q", next)
+	}
+	elo := findb.EntryListOptions{Unreviewed: true, Limit: 1}
+	entries, next = entriesPage(t, store, &elo, "", 2)
+	verifyEntryIds(t, entries, 3, 5)
+	entries, next = entriesPage(t, store, &elo, next, 2)
+	verifyEntryIds(t, entries, 4)
+	if next != "" {
+		t.Errorf("Expected no more pages, got %q", next)
+	}
+	_, err := store.EntriesPage(nil, nil, "bad", 2, consume2.Nil[fin.Entry]())
+	if err != findb.BadPageToken {
+		t.Errorf("Expected BadPageToken, got %v", err)
+	}
+}
+
+func (f EntryAccountFixture) EntriesByAccountIdPage(
+	t *testing.T, store EntriesPageStore) {
+	f.createAccounts(t, store)
+	createListEntries(t, store)
+	var entries []fin.EntryBalance
+	var account fin.Account
+	var next string
+	pageCount := 0
+	for {
+		err := f.Doer.Do(func(t db.Transaction) (err error) {
+			next, err = findb.EntriesByAccountIdPage(
+				t,
+				store,
+				2,
+				&account,
+				next,
+				2,
+				consume2.AppendTo(&entries))
+			return
+		})
+		if err != nil {
+			t.Fatalf("Got error reading database: %v", err)
+		}
+		pageCount++
+		if next == "" {
+			break
+		}
+	}
+	if pageCount != 2 {
+		t.Errorf("Expected 2 pages, got %v", pageCount)
+	}
+	var ids []int64
+	for i := range entries {
+		ids = append(ids, entries[i].Id)
+	}
+	assert.Equal(t, []int64{3, 1, 2}, ids)
+	verifyEntryBalances(t, 2, account.Balance, entries)
+
+	// A token that claims a balance must not change the balances.
+	forged := base64.RawURLEncoding.EncodeToString([]byte("20121016:1:999999"))
+	var lastPage []fin.EntryBalance
+	err := f.Doer.Do(func(t db.Transaction) (err error) {
+		_, err = findb.EntriesByAccountIdPage(
+			t, store, 2, nil, forged, 2, consume2.AppendTo(&lastPage))
+		return
+	})
+	if err != nil {
+		t.Fatalf("Got error reading database: %v", err)
+	}
+	assert.Equal(t, entries[2:], lastPage)
+}
+
+func (f EntryAccountFixture) SearchEntries(
+	t *testing.T, store SearchEntriesStore) {
+	f.createAccounts(t, store)
+	createListEntries(t, store)
+	entry6 := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 1),
+		Name:       "Costco Wholesale",
+		Desc:       "Refund for TV",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), -5000, false, 1)}
+	entry7 := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 2),
+		Name:       "Safeway",
+		Desc:       "Juice boxes",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:8"), 700, false, 1)}
+	entry8 := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 3),
+		Name:       "Costco Gas",
+		CheckNo:    "1234",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 3000, false, 2)}
+	changeEntries(
+		t,
+		store,
+		&findb.EntryChanges{Adds: []*fin.Entry{&entry6, &entry7, &entry8}})
+	err := store.SearchEntries(nil, "costco", nil, consume2.Nil[fin.Entry]())
+	if err == findb.NoSearchIndex {
+		t.Skip("Store has no full text search index.")
+	}
+	if err != nil {
+		t.Fatalf("Got error searching entries: %v", err)
+	}
+	verifyEntryIds(t, searchEntries(t, store, "costco", nil), 8, 6)
+	verifyEntryIds(t, searchEntries(t, store, "COSTCO refund", nil), 6)
+	verifyEntryIds(
+		t, searchEntries(t, store, `"costco wholesale"`, nil), 6)
+	verifyEntryIds(t, searchEntries(t, store, `"wholesale costco"`, nil))
+	verifyEntryIds(t, searchEntries(t, store, "box*", nil), 7)
+	verifyEntryIds(t, searchEntries(t, store, "box", nil))
+	verifyEntryIds(
+		t, searchEntries(t, store, "refund OR juice", nil), 7, 6)
+	verifyEntryIds(t, searchEntries(t, store, "1234", nil), 8)
+	verifyEntryIds(t, searchEntries(t, store, "  \"* ", nil))
+	verifyEntryIds(
+		t,
+		searchEntries(
+			t, store, "costco", &findb.EntryListOptions{AccountId: 1}),
+		6)
+	verifyEntryIds(
+		t,
+		searchEntries(
+			t, store, "costco", &findb.EntryListOptions{Limit: 1}),
+		8)
+	changeEntries(
+		t,
+		store,
+		&findb.EntryChanges{
+			Updates: map[int64]fin.EntryUpdater{
+				7: func(entry *fin.Entry) bool {
+					entry.Name = "Trader Joe's"
+					return true
+				},
+			},
+			Deletes: []int64{8}})
+	verifyEntryIds(t, searchEntries(t, store, "costco", nil), 6)
+	verifyEntryIds(t, searchEntries(t, store, "safeway", nil))
+	verifyEntryIds(t, searchEntries(t, store, "trader", nil), 7)
+}
+
+func (f EntryAccountFixture) CatTotals(t *testing.T, store CatTotalsStore) {
+	f.createAccounts(t, store)
+	createListEntries(t, store)
+	cpb := fin.CatPaymentBuilder{}
+	entry := fin.Entry{
+		Date: date_util.YMD(2012, 11, 20),
+		CatPayment: cpb.AddCatRec(
+			fin.CatRec{Cat: fin.NewCat("0:7"), Amount: 150}).AddCatRec(
+			fin.CatRec{Cat: fin.NewCat("1:3"), Amount: -1000}).AddCatRec(
+			fin.CatRec{Cat: fin.NewCat("2:2"), Amount: 300}).SetPaymentId(
+			1).Build()}
+	changeEntries(t, store, &findb.EntryChanges{Adds: []*fin.Entry{&entry}})
+	totals, err := store.CatTotals(nil, nil)
+	if err != nil {
+		t.Fatalf("Got error totaling categories: %v", err)
+	}
+	expected := fin.CatTotals{
+		fin.NewCat("0:7"): 550,
+		fin.NewCat("1:3"): -1000}
+	if !reflect.DeepEqual(expected, totals) {
+		t.Errorf("Expected %v, got %v", expected, totals)
+	}
+	elo := findb.EntryListOptions{
+		Start: ymdPtr(2012, 11, 1), End: ymdPtr(2012, 11, 15)}
+	totals, err = store.CatTotals(nil, &elo)
+	if err != nil {
+		t.Fatalf("Got error totaling categories: %v", err)
+	}
+	expected = fin.CatTotals{fin.NewCat("0:7"): 400}
+	if !reflect.DeepEqual(expected, totals) {
+		t.Errorf("Expected %v, got %v", expected, totals)
+	}
+}
+
 func (f EntryAccountFixture) EntriesByAccountId(
 	t *testing.T, store EntriesByAccountIdStore) {
 	f.createAccounts(t, store)
@@ -478,6 +906,19 @@ func (f EntryAccountFixture) UpdateAccountImportSD(
 	}
 }
 
+func (f EntryAccountFixture) UpdateAccountCurrency(
+	t *testing.T, store UpdateAccountCurrencyStore) {
+	f.createAccounts(t, store)
+	if output := store.UpdateAccountCurrency(nil, 2, "EUR"); output != nil {
+		t.Errorf("Got error updating database, %v", output)
+	}
+	verifyAccounts(
+		t,
+		store,
+		&fin.Account{Id: 1, Name: "checking", Active: true, ImportSD: kCheckingSD},
+		&fin.Account{Id: 2, Name: "savings", Active: true, Currency: "EUR"})
+}
+
 func (f EntryAccountFixture) UpdateAccount(
 	t *testing.T, store UpdateAccountStore) {
 	f.createAccounts(t, store)
@@ -489,7 +930,8 @@ func (f EntryAccountFixture) UpdateAccount(
 		RBalance: 75024,
 		Count:    4,
 		RCount:   3,
-		ImportSD: date_util.YMD(2014, 5, 26)}
+		ImportSD: date_util.YMD(2014, 5, 26),
+		Currency: "CAD"}
 	if output := store.UpdateAccount(nil, &account); output != nil {
 		t.Errorf("Got error updating database, %v", output)
 	}
@@ -513,6 +955,428 @@ func (f EntryAccountFixture) RemoveAccount(
 	}
 }
 
+func (f EntryAccountFixture) SaveAndLoadRecurringEntry(
+	t *testing.T, store RecurringEntryStore) {
+	f.createAccounts(t, store)
+	cp := fin.NewCatPayment(fin.NewCat("0:4"), 1234, false, 1)
+	cp.SetExchangeRate(0.9)
+	var entry fin.RecurringEntry
+	initRecurringEntry(
+		date_util.YMD(2012, 12, 9), 1, fin.Months, &cp, 3, &entry)
+	entry.Name = "Foo"
+	entry.Tags = []string{"kids"}
+	if err := store.AddRecurringEntry(nil, &entry); err != nil {
+		t.Fatalf("Error creating recurring entries: %v", err)
+	}
+	var actual fin.RecurringEntry
+	if err := store.RecurringEntryById(nil, entry.Id, &actual); err != nil {
+		t.Fatalf("Error retrieving recurring entry %d: %v", entry.Id, err)
+	}
+	entry.Etag = actual.Etag
+	if !reflect.DeepEqual(entry, actual) {
+		t.Errorf("Expected %v, got %v", entry, actual)
+	}
+}
+
+// EntryHistory expects store to attribute entry changes to userId.
+func (f EntryAccountFixture) EntryHistory(
+	t *testing.T, store EntryHistoryStore, userId int64) {
+	f.createAccounts(t, store)
+	entry := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 9),
+		Name:       "Foo",
+		Tags:       []string{"kids"},
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 1234, false, 1)}
+	other := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 10),
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 2345, false, 1)}
+	changeEntries(
+		t, store, &findb.EntryChanges{Adds: []*fin.Entry{&entry, &other}})
+	added := entry
+	added.Etag = 0
+	updated := added
+	updated.Name = "Bar"
+	updated.CatPayment = fin.NewCatPayment(fin.NewCat("0:8"), 1234, false, 1)
+	changeEntries(t, store, &findb.EntryChanges{
+		Updates: map[int64]fin.EntryUpdater{
+			entry.Id: changeTo(&updated, true),
+			other.Id: skipUpdate}})
+	changeEntries(
+		t, store, &findb.EntryChanges{Deletes: []int64{entry.Id}})
+	var history []fin.EntryHistory
+	assert := assert.New(t)
+	assert.NoError(
+		store.EntryHistory(nil, entry.Id, consume2.AppendTo(&history)))
+	if assert.Len(history, 3) {
+		for i := range history {
+			assert.Equal(entry.Id, history[i].EntryId)
+			assert.Equal(userId, history[i].UserId)
+			assert.False(history[i].Time.IsZero())
+		}
+		assert.True(history[0].Id < history[1].Id)
+		assert.True(history[1].Id < history[2].Id)
+		assert.True(history[0].IsAdd())
+		assert.Equal(&added, history[0].After)
+		assert.Equal(&added, history[1].Before)
+		assert.Equal(&updated, history[1].After)
+		assert.True(history[2].IsDelete())
+		assert.Equal(&updated, history[2].Before)
+	}
+	// Skipped updates are not recorded.
+	history = nil
+	assert.NoError(
+		store.EntryHistory(nil, other.Id, consume2.AppendTo(&history)))
+	assert.Len(history, 1)
+}
+
+// Undo expects store to attribute entry changes to userId.
+func (f EntryAccountFixture) Undo(
+	t *testing.T, store UndoStore, userId int64) {
+	f.createAccounts(t, store)
+	assert := assert.New(t)
+	_, err := store.LastChangeId(nil, userId)
+	assert.Equal(findb.NoSuchId, err)
+	first := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 9),
+		Name:       "Foo",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 1234, false, 1)}
+	second := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 10),
+		Name:       "Baz",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 2345, false, 1)}
+	adds := findb.EntryChanges{Adds: []*fin.Entry{&first, &second}}
+	changeEntries(t, store, &adds)
+	addId := lastChangeId(t, store, userId)
+	assert.Equal(addId, adds.ChangeId)
+	var history []fin.EntryHistory
+	assert.NoError(
+		store.ChangeEntries(nil, addId, consume2.AppendTo(&history)))
+	assert.Len(history, 2)
+	renamed := first
+	renamed.Name = "Bar"
+	changeEntries(t, store, &findb.EntryChanges{
+		Updates: map[int64]fin.EntryUpdater{
+			first.Id: changeNameFunc("Bar")}})
+	updateId := lastChangeId(t, store, userId)
+	changeEntries(
+		t, store, &findb.EntryChanges{Deletes: []int64{second.Id}})
+	deleteId := lastChangeId(t, store, userId)
+	verifyAccounts(
+		t,
+		store,
+		&fin.Account{Id: 1, Name: "checking", Active: true, Balance: -1234, Count: 1, ImportSD: kCheckingSD})
+
+	// Undoing the delete restores the entry and the account balance.
+	assert.NoError(store.Undo(nil, deleteId))
+	verifyEntries(t, store, &renamed, &second)
+	verifyAccounts(
+		t,
+		store,
+		&fin.Account{Id: 1, Name: "checking", Active: true, Balance: -3579, Count: 2, ImportSD: kCheckingSD})
+	assert.Equal(findb.CannotUndo, store.Undo(nil, deleteId))
+
+	// The undo itself is skipped.
+	assert.Equal(updateId, lastChangeId(t, store, userId))
+	assert.NoError(store.Undo(nil, updateId))
+	verifyEntries(t, store, &first, &second)
+
+	// Undoing the adds fails if an added entry changed since.
+	changeEntries(t, store, &findb.EntryChanges{
+		Updates: map[int64]fin.EntryUpdater{
+			second.Id: changeNameFunc("Changed")}})
+	assert.Equal(findb.ConcurrentUpdate, store.Undo(nil, addId))
+	second.Name = "Changed"
+	verifyEntries(t, store, &first, &second)
+	changeEntries(t, store, &findb.EntryChanges{
+		Updates: map[int64]fin.EntryUpdater{
+			second.Id: changeNameFunc("Baz")}})
+	assert.NoError(store.Undo(nil, addId))
+	verifyNoEntry(t, store, first.Id)
+	verifyNoEntry(t, store, second.Id)
+	verifyAccounts(
+		t,
+		store,
+		&fin.Account{Id: 1, Name: "checking", Active: true, ImportSD: kCheckingSD})
+	assert.Equal(findb.NoSuchId, store.Undo(nil, 9999))
+}
+
+// UndoOtherUser expects store to attribute entry changes to userId and
+// other to attribute them to a different user.
+func (f EntryAccountFixture) UndoOtherUser(
+	t *testing.T, store UndoStore, other UndoStore, userId int64) {
+	f.createAccounts(t, store)
+	assert := assert.New(t)
+	entry := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 9),
+		Name:       "Foo",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 1234, false, 1)}
+	changeEntries(t, store, &findb.EntryChanges{Adds: []*fin.Entry{&entry}})
+	changeId := lastChangeId(t, store, userId)
+
+	// Another user cannot undo the change.
+	assert.Equal(findb.NoPermission, other.Undo(nil, changeId))
+	verifyEntries(t, store, &entry)
+
+	assert.NoError(store.Undo(nil, changeId))
+	verifyNoEntry(t, store, entry.Id)
+}
+
+// UndoImport expects store to attribute entry changes to userId and
+// fitIds to share its database.
+func (f EntryAccountFixture) UndoImport(
+	t *testing.T, store UndoImportStore, fitIds qfxdb.Store, userId int64) {
+	f.createAccounts(t, store)
+	assert := assert.New(t)
+	entry := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 9),
+		Name:       "Foo",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 1234, false, 1)}
+	changeEntries(t, store, &findb.EntryChanges{Adds: []*fin.Entry{&entry}})
+	changeId := lastChangeId(t, store, userId)
+	assert.NoError(fitIds.Add(nil, 1, changeId, qfxdb.FitIdSet{"a": {}}))
+	assert.NoError(fitIds.Add(nil, 1, 0, qfxdb.FitIdSet{"b": {}}))
+	receipt := fin.Attachment{EntryId: entry.Id, Name: "receipt.pdf"}
+	addAttachment(t, store, &receipt, "receipt contents")
+
+	// Undoing the import lets its entries be imported again.
+	assert.NoError(store.Undo(nil, changeId))
+	found, err := fitIds.Find(nil, 1, qfxdb.FitIdSet{"a": {}, "b": {}})
+	assert.NoError(err)
+	assert.Equal(qfxdb.FitIdSet{"b": {}}, found)
+
+	// The imported entries are gone for good along with their attachments.
+	verifyNoEntry(t, store, entry.Id)
+	assert.Empty(trashedEntries(t, store))
+	_, err = store.AttachmentContents(nil, receipt.Hash)
+	assert.Equal(findb.NoSuchId, err)
+}
+
+func (f EntryAccountFixture) SaveAndLoadAttachments(
+	t *testing.T, store AttachmentStore) {
+	f.createAccounts(t, store)
+	entry := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 9),
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 1234, false, 1)}
+	changeEntries(t, store, &findb.EntryChanges{Adds: []*fin.Entry{&entry}})
+	receipt := fin.Attachment{
+		EntryId:     entry.Id,
+		Name:        "receipt.pdf",
+		ContentType: "application/pdf",
+		Added:       time.Date(2012, 12, 10, 8, 0, 0, 0, time.UTC)}
+	addAttachment(t, store, &receipt, "receipt contents")
+	// Same contents under another name share storage
+	copyOfReceipt := fin.Attachment{
+		EntryId:     entry.Id,
+		Name:        "copy.pdf",
+		ContentType: "application/pdf",
+		Added:       time.Date(2012, 12, 11, 8, 0, 0, 0, time.UTC)}
+	addAttachment(t, store, &copyOfReceipt, "receipt contents")
+	assert := assert.New(t)
+	assert.Equal(receipt.Hash, copyOfReceipt.Hash)
+	assert.Equal(int64(len("receipt contents")), receipt.Size)
+	var actual fin.Attachment
+	assert.NoError(store.AttachmentById(nil, receipt.Id, &actual))
+	assert.Equal(receipt, actual)
+	assert.Equal(
+		[]fin.Attachment{receipt, copyOfReceipt},
+		attachmentsByEntryId(t, store, entry.Id))
+	verifyAttachmentContents(t, store, receipt.Hash, "receipt contents")
+	assert.NoError(store.RemoveAttachment(nil, receipt.Id))
+	assert.Equal(
+		findb.NoSuchId, store.AttachmentById(nil, receipt.Id, &actual))
+	verifyAttachmentContents(t, store, receipt.Hash, "receipt contents")
+	assert.NoError(store.RemoveAttachment(nil, copyOfReceipt.Id))
+	_, err := store.AttachmentContents(nil, receipt.Hash)
+	assert.Equal(findb.NoSuchId, err)
+}
+
+func (f EntryAccountFixture) PurgeTrashRemovesAttachments(
+	t *testing.T, store PurgeTrashStore) {
+	f.createAccounts(t, store)
+	first := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 9),
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 1234, false, 1)}
+	second := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 10),
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 2345, false, 1)}
+	changeEntries(
+		t, store, &findb.EntryChanges{Adds: []*fin.Entry{&first, &second}})
+	firstOnly := fin.Attachment{EntryId: first.Id, Name: "a.png"}
+	addAttachment(t, store, &firstOnly, "only first")
+	firstShared := fin.Attachment{EntryId: first.Id, Name: "b.png"}
+	addAttachment(t, store, &firstShared, "shared")
+	secondShared := fin.Attachment{EntryId: second.Id, Name: "c.png"}
+	addAttachment(t, store, &secondShared, "shared")
+	changeEntries(
+		t, store, &findb.EntryChanges{Deletes: []int64{first.Id}})
+	assert := assert.New(t)
+
+	// Attachments stay while the entry is in the trash.
+	assert.Equal(
+		[]fin.Attachment{firstOnly, firstShared},
+		attachmentsByEntryId(t, store, first.Id))
+	count, err := store.PurgeTrash(nil, time.Now().Add(-time.Hour))
+	assert.NoError(err)
+	assert.Zero(count)
+	verifyAttachmentContents(t, store, firstOnly.Hash, "only first")
+
+	count, err = store.PurgeTrash(nil, time.Now().Add(time.Hour))
+	assert.NoError(err)
+	assert.Equal(1, count)
+	assert.Empty(attachmentsByEntryId(t, store, first.Id))
+	assert.Equal(
+		[]fin.Attachment{secondShared},
+		attachmentsByEntryId(t, store, second.Id))
+	_, err = store.AttachmentContents(nil, firstOnly.Hash)
+	assert.Equal(findb.NoSuchId, err)
+	verifyAttachmentContents(t, store, secondShared.Hash, "shared")
+}
+
+// Trash expects store to attribute entry changes to userId.
+func (f EntryAccountFixture) Trash(
+	t *testing.T, store TrashStore, userId int64) {
+	f.createAccounts(t, store)
+	assert := assert.New(t)
+	first := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 9),
+		Name:       "Foo",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 1234, false, 1)}
+	second := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 10),
+		Name:       "Baz",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 2345, false, 1)}
+	changeEntries(
+		t, store, &findb.EntryChanges{Adds: []*fin.Entry{&first, &second}})
+	assert.Empty(trashedEntries(t, store))
+	changeEntries(
+		t, store, &findb.EntryChanges{Deletes: []int64{first.Id}})
+	deleteId := lastChangeId(t, store, userId)
+
+	// Entries leave out trashed entries.
+	verifyNoEntry(t, store, first.Id)
+	var entries []fin.Entry
+	assert.NoError(store.Entries(nil, nil, consume2.AppendTo(&entries)))
+	verifyEntryIds(t, entries, second.Id)
+	verifyAccounts(
+		t,
+		store,
+		&fin.Account{Id: 1, Name: "checking", Active: true, Balance: -2345, Count: 1, ImportSD: kCheckingSD})
+	trashed := trashedEntries(t, store)
+	if assert.Len(trashed, 1) {
+		assert.Equal(first, trashed[0].Entry)
+		assert.False(trashed[0].Trashed.IsZero())
+	}
+
+	// Restoring brings back the entry under its original id.
+	assert.NoError(store.RestoreEntry(nil, first.Id))
+	verifyEntries(t, store, &first, &second)
+	verifyAccounts(
+		t,
+		store,
+		&fin.Account{Id: 1, Name: "checking", Active: true, Balance: -3579, Count: 2, ImportSD: kCheckingSD})
+	assert.Empty(trashedEntries(t, store))
+	assert.Equal(findb.NoSuchId, store.RestoreEntry(nil, first.Id))
+
+	// The delete cannot be undone once the entry is restored.
+	assert.Equal(findb.ConcurrentUpdate, store.Undo(nil, deleteId))
+
+	// Undoing the restore removes the entry without trashing it again.
+	assert.NoError(store.Undo(nil, lastChangeId(t, store, userId)))
+	verifyNoEntry(t, store, first.Id)
+	assert.Empty(trashedEntries(t, store))
+
+	// Undoing the delete also brings back the entry.
+	assert.NoError(store.Undo(nil, deleteId))
+	verifyEntries(t, store, &first, &second)
+	assert.Empty(trashedEntries(t, store))
+
+	changeEntries(
+		t, store, &findb.EntryChanges{Deletes: []int64{first.Id}})
+	count, err := store.PurgeTrash(nil, time.Now().Add(time.Hour))
+	assert.NoError(err)
+	assert.Equal(1, count)
+	assert.Empty(trashedEntries(t, store))
+	assert.Equal(findb.NoSuchId, store.RestoreEntry(nil, first.Id))
+	verifyAccounts(
+		t,
+		store,
+		&fin.Account{Id: 1, Name: "checking", Active: true, Balance: -2345, Count: 1, ImportSD: kCheckingSD})
+}
+
+func (f EntryAccountFixture) RecurringTrash(
+	t *testing.T, store RecurringTrashStore) {
+	assert := assert.New(t)
+	id := addRecurringEntry(t, store, date_util.YMD(2015, 6, 20), 3100, 4)
+	var expected fin.RecurringEntry
+	assert.NoError(store.RecurringEntryById(nil, id, &expected))
+	assert.NoError(store.RemoveRecurringEntryById(nil, id))
+	var actual fin.RecurringEntry
+	assert.Equal(findb.NoSuchId, store.RecurringEntryById(nil, id, &actual))
+	trashed := trashedRecurringEntries(t, store)
+	if assert.Len(trashed, 1) {
+		assert.Equal(id, trashed[0].Id)
+		assert.Equal(expected.Date, trashed[0].Date)
+		assert.Equal(4, trashed[0].NumLeft)
+		assert.False(trashed[0].Trashed.IsZero())
+	}
+
+	assert.NoError(store.RestoreRecurringEntry(nil, id))
+	assert.NoError(store.RecurringEntryById(nil, id, &actual))
+	assert.Equal(expected, actual)
+	assert.Empty(trashedRecurringEntries(t, store))
+	assert.Equal(findb.NoSuchId, store.RestoreRecurringEntry(nil, id))
+
+	assert.NoError(store.RemoveRecurringEntryById(nil, id))
+	count, err := store.PurgeTrash(nil, time.Now().Add(time.Hour))
+	assert.NoError(err)
+	assert.Equal(1, count)
+	assert.Empty(trashedRecurringEntries(t, store))
+}
+
+// FixedClock is a date_util.Clock that always returns the same time.
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// TrashTimes tests that store takes the times of entry changes and of
+// moves to the trash from its clock. The clock of store must always
+// return now.
+func (f EntryAccountFixture) TrashTimes(
+	t *testing.T, store TrashTimesStore, userId int64, now time.Time) {
+	f.createAccounts(t, store)
+	assert := assert.New(t)
+	entry := fin.Entry{
+		Date:       date_util.YMD(2012, 12, 9),
+		Name:       "Foo",
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 1234, false, 1)}
+	changeEntries(t, store, &findb.EntryChanges{Adds: []*fin.Entry{&entry}})
+	changeEntries(
+		t, store, &findb.EntryChanges{Deletes: []int64{entry.Id}})
+	trashed := trashedEntries(t, store)
+	if assert.Len(trashed, 1) {
+		assert.True(now.Equal(trashed[0].Trashed))
+	}
+	assert.NoError(store.RestoreEntry(nil, entry.Id))
+	assert.NoError(store.Undo(nil, lastChangeId(t, store, userId)))
+	var history []fin.EntryHistory
+	assert.NoError(
+		store.EntryHistory(nil, entry.Id, consume2.AppendTo(&history)))
+	if assert.Len(history, 4) {
+		for _, h := range history {
+			assert.True(now.Equal(h.Time))
+		}
+	}
+
+	id := addRecurringEntry(t, store, date_util.YMD(2015, 6, 20), 3100, 4)
+	assert.NoError(store.RemoveRecurringEntryById(nil, id))
+	trashedRecurring := trashedRecurringEntries(t, store)
+	if assert.Len(trashedRecurring, 1) {
+		assert.True(now.Equal(trashedRecurring[0].Trashed))
+	}
+}
+
 func (f EntryAccountFixture) ApplyRecurringEntries(
 	t *testing.T,
 	store RecurringEntriesApplier) {
@@ -837,6 +1701,78 @@ func (f EntryAccountFixture) verifyEntryDates(
 	}
 }
 
+func lastChangeId(
+	t *testing.T, store findb.LastChangeIdRunner, userId int64) int64 {
+	t.Helper()
+	result, err := store.LastChangeId(nil, userId)
+	if err != nil {
+		t.Fatalf("Error fetching last change id: %v", err)
+	}
+	return result
+}
+
+func addAttachment(
+	t *testing.T,
+	store findb.AddAttachmentRunner,
+	attachment *fin.Attachment,
+	contents string) {
+	t.Helper()
+	if err := store.AddAttachment(nil, attachment, []byte(contents)); err != nil {
+		t.Fatalf("Error adding attachment: %v", err)
+	}
+}
+
+func trashedEntries(
+	t *testing.T, store findb.TrashedEntriesRunner) []fin.TrashedEntry {
+	t.Helper()
+	var result []fin.TrashedEntry
+	if err := store.TrashedEntries(nil, consume2.AppendTo(&result)); err != nil {
+		t.Fatalf("Error fetching trashed entries: %v", err)
+	}
+	return result
+}
+
+func trashedRecurringEntries(
+	t *testing.T,
+	store findb.TrashedRecurringEntriesRunner) []fin.TrashedRecurringEntry {
+	t.Helper()
+	var result []fin.TrashedRecurringEntry
+	err := store.TrashedRecurringEntries(nil, consume2.AppendTo(&result))
+	if err != nil {
+		t.Fatalf("Error fetching trashed recurring entries: %v", err)
+	}
+	return result
+}
+
+func attachmentsByEntryId(
+	t *testing.T,
+	store findb.AttachmentsByEntryIdRunner,
+	entryId int64) []fin.Attachment {
+	t.Helper()
+	var result []fin.Attachment
+	err := store.AttachmentsByEntryId(
+		nil, entryId, consume2.AppendTo(&result))
+	if err != nil {
+		t.Fatalf("Error fetching attachments: %v", err)
+	}
+	return result
+}
+
+func verifyAttachmentContents(
+	t *testing.T,
+	store findb.AttachmentContentsRunner,
+	hash string,
+	expected string) {
+	t.Helper()
+	contents, err := store.AttachmentContents(nil, hash)
+	if err != nil {
+		t.Fatalf("Error fetching attachment contents: %v", err)
+	}
+	if string(contents) != expected {
+		t.Errorf("Expected %s, got %s", expected, string(contents))
+	}
+}
+
 func createListEntries(t *testing.T, store findb.DoEntryChangesRunner) {
 	cpb := fin.CatPaymentBuilder{}
 	entry1 := fin.Entry{
@@ -885,6 +1821,40 @@ func fetchEntries(
 	return entries
 }
 
+func entriesPage(
+	t *testing.T,
+	store findb.EntriesPageRunner,
+	options *findb.EntryListOptions,
+	token string,
+	pageSize int) (entries []fin.Entry, next string) {
+	t.Helper()
+	next, err := store.EntriesPage(
+		nil, options, token, pageSize, consume2.AppendTo(&entries))
+	if err != nil {
+		t.Fatalf("Got error fetching page of entries: %v", err)
+	}
+	return
+}
+
+// searchEntries returns the entries matching query sorted by id
+// from highest to lowest since stores may rank matches differently.
+func searchEntries(
+	t *testing.T,
+	store findb.SearchEntriesRunner,
+	query string,
+	options *findb.EntryListOptions) []fin.Entry {
+	t.Helper()
+	var entries []fin.Entry
+	err := store.SearchEntries(nil, query, options, consume2.AppendTo(&entries))
+	if err != nil {
+		t.Fatalf("Got error searching entries: %v", err)
+	}
+	slices.SortFunc(entries, func(a, b fin.Entry) int {
+		return cmp.Compare(b.Id, a.Id)
+	})
+	return entries
+}
+
 func changeEntries(
 	t *testing.T,
 	store findb.DoEntryChangesRunner,
@@ -1001,6 +1971,17 @@ func verifyNoEntry(t *testing.T, store findb.EntryByIdRunner, id int64) {
 	}
 }
 
+func verifyEntryIds(t *testing.T, entries []fin.Entry, ids ...int64) {
+	t.Helper()
+	var actual []int64
+	for i := range entries {
+		actual = append(actual, entries[i].Id)
+	}
+	if !reflect.DeepEqual(ids, actual) {
+		t.Errorf("Expected entry ids %v, got %v", ids, actual)
+	}
+}
+
 func verifyEntriesSorted(t *testing.T, entries []fin.Entry) {
 	length := len(entries)
 	for i := 1; i < length; i++ {
@@ -1145,6 +2126,23 @@ type RemoveUserByNameStore interface {
 	findb.RemoveUserByNameRunner
 }
 
+type AccessRulesStore interface {
+	findb.AddUserRunner
+	findb.RemoveUserByNameRunner
+	findb.AccessRulesByUserNameRunner
+	findb.AddAccessRuleRunner
+	findb.RemoveAccessRuleRunner
+}
+
+type ApiTokensStore interface {
+	findb.AddUserRunner
+	findb.RemoveUserByNameRunner
+	findb.ApiTokensByUserIdRunner
+	findb.AddApiTokenRunner
+	findb.RemoveApiTokenRunner
+	findb.LoginApiTokenRunner
+}
+
 type UpdateUserStore interface {
 	UserByIdStore
 	findb.UpdateUserRunner
@@ -1210,6 +2208,109 @@ func RemoveUserByName(t *testing.T, store RemoveUserByNameStore) {
 	}
 }
 
+func AccessRules(t *testing.T, store AccessRulesStore) {
+	createUsers(t, store)
+	rules := []fin.AccessRule{
+		{UserName: "name1", Cat: fin.NewCat("2:1")},
+		{UserName: "name2", Cat: fin.NewCat("0:7")},
+		{UserName: "name1", Cat: fin.NewCat("0:7")},
+	}
+	for i := range rules {
+		if err := store.AddAccessRule(nil, &rules[i]); err != nil {
+			t.Fatalf("Got error adding access rule: %v", err)
+		}
+	}
+	assertAccessRules(t, store, "name1", rules[0], rules[2])
+	if err := store.RemoveAccessRule(nil, rules[0].Id); err != nil {
+		t.Fatalf("Got error removing access rule: %v", err)
+	}
+	assertAccessRules(t, store, "name1", rules[2])
+	if err := store.RemoveUserByName(nil, "name2"); err != nil {
+		t.Fatalf("Got error removing user: %v", err)
+	}
+	assertAccessRules(t, store, "name2")
+	assertAccessRules(t, store, "name1", rules[2])
+}
+
+func ApiTokens(t *testing.T, doer db.Doer, store ApiTokensStore) {
+	createUsers(t, store)
+	created := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	secrets := []string{"secret1", "secret2", "secret3"}
+	tokens := []fin.ApiToken{
+		{
+			UserId:     1,
+			Name:       "script",
+			Permission: fin.ReadPermission,
+			Book:       "Main",
+			Created:    created,
+		},
+		{
+			UserId:     2,
+			Name:       "phone",
+			Permission: fin.AllPermission,
+			Book:       "Main",
+			AccountIds: []int64{3, 5},
+			Created:    created,
+		},
+		{
+			UserId:     1,
+			Name:       "backup",
+			Permission: fin.AllPermission,
+			Book:       "Other",
+			AccountIds: []int64{2},
+			Created:    created,
+		},
+	}
+	for i := range tokens {
+		tokens[i].Hash = fin.HashApiTokenSecret(secrets[i])
+		if err := store.AddApiToken(nil, &tokens[i]); err != nil {
+			t.Fatalf("Got error adding API token: %v", err)
+		}
+	}
+	assertApiTokens(t, store, 1, tokens[0], tokens[2])
+	assertApiTokens(t, store, 2, tokens[1])
+
+	used := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+	var token fin.ApiToken
+	var user fin.User
+	err := doer.Do(func(t db.Transaction) error {
+		return findb.LoginApiToken(t, store, "secret3", used, &token, &user)
+	})
+	if err != nil {
+		t.Fatalf("Got error logging in with API token: %v", err)
+	}
+	if user.Id != 1 || token.Id != tokens[2].Id {
+		t.Errorf(
+			"Expected user 1 and token %d, got %v %v", tokens[2].Id, user, token)
+	}
+	tokens[2].LastUsed = used
+	assertApiTokens(t, store, 1, tokens[0], tokens[2])
+
+	// name2 has no permission
+	err = doer.Do(func(t db.Transaction) error {
+		return findb.LoginApiToken(t, store, "secret2", used, &token, &user)
+	})
+	if err != findb.NoSuchId {
+		t.Errorf("Expected NoSuchId, got %v", err)
+	}
+	err = doer.Do(func(t db.Transaction) error {
+		return findb.LoginApiToken(t, store, "wrong", used, &token, &user)
+	})
+	if err != findb.NoSuchId {
+		t.Errorf("Expected NoSuchId, got %v", err)
+	}
+
+	if err := store.RemoveApiToken(nil, tokens[0].Id); err != nil {
+		t.Fatalf("Got error removing API token: %v", err)
+	}
+	assertApiTokens(t, store, 1, tokens[2])
+	if err := store.RemoveUserByName(nil, "name2"); err != nil {
+		t.Fatalf("Got error removing user: %v", err)
+	}
+	assertApiTokens(t, store, 2)
+	assertApiTokens(t, store, 1, tokens[2])
+}
+
 func LoginUser(t *testing.T, doer db.Doer, store LoginStore) {
 	createUsersWithFunc(t, store, newUserWithPassword)
 	aTime := time.Date(2016, 12, 13, 14, 15, 16, 0, time.UTC)
@@ -1326,6 +2427,48 @@ func createUsersWithFunc(
 	}
 }
 
+func assertAccessRules(
+	t *testing.T,
+	store findb.AccessRulesByUserNameRunner,
+	name string,
+	expected ...fin.AccessRule) {
+	t.Helper()
+	var actual []fin.AccessRule
+	err := store.AccessRulesByUserName(nil, name, consume2.AppendTo(&actual))
+	if err != nil {
+		t.Fatalf("Got error reading access rules: %v", err)
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], actual[i])
+		}
+	}
+}
+
+func assertApiTokens(
+	t *testing.T,
+	store findb.ApiTokensByUserIdRunner,
+	userId int64,
+	expected ...fin.ApiToken) {
+	t.Helper()
+	var actual []fin.ApiToken
+	err := store.ApiTokensByUserId(nil, userId, consume2.AppendTo(&actual))
+	if err != nil {
+		t.Fatalf("Got error reading API tokens: %v", err)
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(actual[i], expected[i]) {
+			t.Errorf("Expected %v, got %v", expected[i], actual[i])
+		}
+	}
+}
+
 func createUsers(t *testing.T, store findb.AddUserRunner) {
 	createUsersWithFunc(t, store, newUser)
 }
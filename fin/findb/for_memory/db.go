@@ -0,0 +1,125 @@
+// Package for_memory stores types in fin package in memory. Nothing it
+// stores outlives the process, and it needs neither cgo nor sqlite, so it
+// is for tests and demos.
+package for_memory
+
+import (
+	"sync"
+
+	"github.com/keep94/toolbox/db"
+)
+
+// Table is one table of data in a Db.
+type Table interface {
+	// Clone returns a copy of this table that can be changed without
+	// changing this table.
+	Clone() Table
+}
+
+// Db is an in-memory database. Transactions against a Db run one at a
+// time. A transaction changes copies of the tables it updates, and those
+// copies replace the originals only if the transaction succeeds.
+type Db struct {
+	mutex  sync.Mutex
+	tables map[string]Table
+}
+
+// NewDb returns a new, empty database.
+func NewDb() *Db {
+	return &Db{tables: make(map[string]Table)}
+}
+
+// Do runs action within a new transaction. If action returns an error,
+// Do rolls back the transaction and returns that same error.
+func (d *Db) Do(action func(tx *Tx) error) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	tx := &Tx{db: d, updated: make(map[string]Table)}
+	if err := action(tx); err != nil {
+		return err
+	}
+	for name, table := range tx.updated {
+		d.tables[name] = table
+	}
+	return nil
+}
+
+// Tx is a transaction against a Db.
+type Tx struct {
+	db      *Db
+	updated map[string]Table
+}
+
+// Table returns the table with given name for reading. If no such table
+// exists, Table returns newTable(). Callers must not change the returned
+// table.
+func (tx *Tx) Table(name string, newTable func() Table) Table {
+	if table, ok := tx.updated[name]; ok {
+		return table
+	}
+	if table, ok := tx.db.tables[name]; ok {
+		return table
+	}
+	return newTable()
+}
+
+// TableForUpdate returns the table with given name for reading and
+// writing. Changes to the returned table become permanent only when this
+// transaction succeeds. If no such table exists, TableForUpdate creates
+// it with newTable.
+func (tx *Tx) TableForUpdate(name string, newTable func() Table) Table {
+	if table, ok := tx.updated[name]; ok {
+		return table
+	}
+	table, ok := tx.db.tables[name]
+	if ok {
+		table = table.Clone()
+	} else {
+		table = newTable()
+	}
+	tx.updated[name] = table
+	return table
+}
+
+// Doer runs actions within a transaction.
+type Doer interface {
+	Do(action func(tx *Tx) error) error
+}
+
+// NewDoer returns a db.Doer for d. The db.Transaction values that the
+// returned Doer passes to actions are *Tx values.
+func NewDoer(d *Db) db.Doer {
+	return dbDoer{d}
+}
+
+// NewTxDoer returns a Doer that runs actions within tx.
+func NewTxDoer(tx *Tx) Doer {
+	return txDoer{tx}
+}
+
+// ToDoer returns a Doer that runs actions within t. If t is nil,
+// ToDoer returns doer. A non-nil t must be a *Tx.
+func ToDoer(doer Doer, t db.Transaction) Doer {
+	if t == nil {
+		return doer
+	}
+	return txDoer{t.(*Tx)}
+}
+
+type dbDoer struct {
+	db *Db
+}
+
+func (d dbDoer) Do(action db.Action) error {
+	return d.db.Do(func(tx *Tx) error {
+		return action(tx)
+	})
+}
+
+type txDoer struct {
+	tx *Tx
+}
+
+func (d txDoer) Do(action func(tx *Tx) error) error {
+	return action(d.tx)
+}
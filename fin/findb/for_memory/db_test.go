@@ -0,0 +1,270 @@
+package for_memory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/keep94/finances/fin/findb/fixture"
+)
+
+var (
+	changeError = errors.New("for_memory: Error while changing.")
+)
+
+func TestAccountUpdates(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).AccountUpdates(t, New(db))
+}
+
+func TestAccountUpdatesExchangeRate(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).AccountUpdatesExchangeRate(t, New(db))
+}
+
+func TestSaveAndLoadEntry(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).SaveAndLoadEntry(t, New(db))
+}
+
+func TestUpdateEntry(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).UpdateEntry(t, New(db))
+}
+
+func TestUpdateEntrySkipped(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).UpdateEntrySkipped(t, New(db))
+}
+
+func TestListEntries(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ListEntries(t, New(db))
+}
+
+func TestDeleteEntries(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).DeleteEntries(t, New(db))
+}
+
+func TestListEntriesEmptyOptions(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ListEntriesEmptyOptions(t, New(db))
+}
+
+func TestListEntriesDateRange(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ListEntriesDateRange(t, New(db))
+}
+
+func TestListEntriesDateRangeAndUnreviewed(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ListEntriesDateRangeAndUnreviewed(t, New(db))
+}
+
+func TestListEntriesJustStartDate(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ListEntriesJustStartDate(t, New(db))
+}
+
+func TestListEntriesJustEndDate(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ListEntriesJustEndDate(t, New(db))
+}
+
+func TestListEntriesUnreviewed(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ListEntriesUnreviewed(t, New(db))
+}
+
+func TestListEntriesAccount(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ListEntriesAccount(t, New(db))
+}
+
+func TestListEntriesCriteria(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ListEntriesCriteria(t, New(db))
+}
+
+func TestEntriesPage(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).EntriesPage(t, New(db))
+}
+
+func TestEntriesByAccountIdPage(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).EntriesByAccountIdPage(t, New(db))
+}
+
+func TestSearchEntries(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).SearchEntries(t, New(db))
+}
+
+func TestCatTotals(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).CatTotals(t, New(db))
+}
+
+func TestEntriesByAccountId(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).EntriesByAccountId(t, New(db))
+}
+
+func TestEntriesByAccountIdNilPtr(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).EntriesByAccountIdNilPtr(t, New(db))
+}
+
+func TestUnreconciledEntries(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).UnreconciledEntries(t, New(db))
+}
+
+func TestUnreconciledEntriesNoAccount(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).UnreconciledEntriesNoAccount(t, New(db))
+}
+
+func TestConcurrentUpdateDetection(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ConcurrentUpdateDetection(t, New(db))
+}
+
+func TestConcurrentUpdateSkipped(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ConcurrentUpdateSkipped(t, New(db))
+}
+
+func TestSaveAndLoadRecurringEntry(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).SaveAndLoadRecurringEntry(t, New(db))
+}
+
+func TestEntryHistory(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).EntryHistory(t, New(db).WithUser(3), 3)
+}
+
+func TestUndo(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).Undo(t, New(db).WithUser(3), 3)
+}
+
+func TestUndoOtherUser(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).UndoOtherUser(
+		t, New(db).WithUser(3), New(db).WithUser(4), 3)
+}
+
+func TestSaveAndLoadAttachments(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).SaveAndLoadAttachments(t, New(db))
+}
+
+func TestPurgeTrashRemovesAttachments(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).PurgeTrashRemovesAttachments(t, New(db))
+}
+
+func TestTrash(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).Trash(t, New(db).WithUser(3), 3)
+}
+
+func TestTrashTimes(t *testing.T) {
+	db := NewDb()
+	now := time.Unix(1700000000, 0)
+	newEntryAccountFixture(db).TrashTimes(
+		t, New(db).WithUser(3).WithClock(fixture.FixedClock(now)), 3, now)
+}
+
+func TestRecurringTrash(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).RecurringTrash(t, New(db))
+}
+
+func TestApplyRecurringEntries(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ApplyRecurringEntries(t, New(db))
+}
+
+func TestActiveAccounts(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).ActiveAccounts(t, New(db))
+}
+
+func TestUpdateAccountImportSD(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).UpdateAccountImportSD(t, New(db))
+}
+
+func TestUpdateAccountCurrency(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).UpdateAccountCurrency(t, New(db))
+}
+
+func TestUpdateAccount(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).UpdateAccount(t, New(db))
+}
+
+func TestRemoveAccount(t *testing.T) {
+	db := NewDb()
+	newEntryAccountFixture(db).RemoveAccount(t, New(db))
+}
+
+func TestUserById(t *testing.T) {
+	db := NewDb()
+	fixture.UserById(t, New(db))
+}
+
+func TestUserByName(t *testing.T) {
+	db := NewDb()
+	fixture.UserByName(t, New(db))
+}
+
+func TestUsers(t *testing.T) {
+	db := NewDb()
+	fixture.Users(t, New(db))
+}
+
+func TestLoginUser(t *testing.T) {
+	db := NewDb()
+	fixture.LoginUser(t, NewDoer(db), New(db))
+}
+
+func TestRemoveUserByName(t *testing.T) {
+	db := NewDb()
+	fixture.RemoveUserByName(t, New(db))
+}
+
+func TestAccessRules(t *testing.T) {
+	db := NewDb()
+	fixture.AccessRules(t, New(db))
+}
+
+func TestApiTokens(t *testing.T) {
+	db := NewDb()
+	fixture.ApiTokens(t, NewDoer(db), New(db))
+}
+
+func TestNoUserByName(t *testing.T) {
+	db := NewDb()
+	fixture.NoUserByName(t, New(db))
+}
+
+func TestUpdateUser(t *testing.T) {
+	db := NewDb()
+	fixture.UpdateUser(t, New(db))
+}
+
+func TestAllocations(t *testing.T) {
+	db := NewDb()
+	fixture.Allocations(t, New(db))
+}
+
+func newEntryAccountFixture(db *Db) fixture.EntryAccountFixture {
+	return fixture.EntryAccountFixture{Doer: NewDoer(db)}
+}
@@ -0,0 +1,47 @@
+package for_memory
+
+import (
+	"maps"
+)
+
+// FitIdsTableName is the name of the table holding processed fitIds.
+// The table is here rather than with the qfxdb store that fills it so
+// that undoing an import can remove its fitIds.
+const FitIdsTableName = "qfxdb"
+
+// AcctIdFitId identifies a processed fitId of an account.
+type AcctIdFitId struct {
+	AcctId int64
+	FitId  string
+}
+
+// FitIds holds the processed fitIds of every account. The values are the
+// ids of the change sets that imported them; 0 means no change set.
+type FitIds map[AcctIdFitId]int64
+
+func (f FitIds) Clone() Table {
+	return maps.Clone(f)
+}
+
+// NewFitIds returns a new, empty FitIds table.
+func NewFitIds() Table {
+	return make(FitIds)
+}
+
+// removeFitIds removes the fitIds that the change set with changeId
+// imported.
+func removeFitIds(tx *Tx, changeId int64) {
+	var keys []AcctIdFitId
+	for key, id := range tx.Table(FitIdsTableName, NewFitIds).(FitIds) {
+		if id == changeId {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	stored := tx.TableForUpdate(FitIdsTableName, NewFitIds).(FitIds)
+	for _, key := range keys {
+		delete(stored, key)
+	}
+}
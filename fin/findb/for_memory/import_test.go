@@ -0,0 +1,16 @@
+package for_memory_test
+
+import (
+	"testing"
+
+	qfxmemory "github.com/keep94/finances/fin/autoimport/qfx/qfxdb/for_memory"
+	"github.com/keep94/finances/fin/findb/fixture"
+	fmemory "github.com/keep94/finances/fin/findb/for_memory"
+)
+
+// This test is in its own package because qfxmemory depends on fmemory.
+func TestUndoImport(t *testing.T) {
+	db := fmemory.NewDb()
+	fixture.EntryAccountFixture{Doer: fmemory.NewDoer(db)}.UndoImport(
+		t, fmemory.New(db).WithUser(3), qfxmemory.New(db), 3)
+}
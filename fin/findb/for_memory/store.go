@@ -0,0 +1,1350 @@
+package for_memory
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+)
+
+const (
+	kTableName = "findb"
+)
+
+var (
+	// ErrDuplicateKey is returned when adding a user or an allocation that
+	// already exists.
+	ErrDuplicateKey = errors.New("for_memory: Duplicate key.")
+)
+
+func New(db *Db) Store {
+	return Store{db: db}
+}
+
+// ConnNew returns a Store that runs everything within tx.
+func ConnNew(tx *Tx) Store {
+	return Store{db: NewTxDoer(tx)}
+}
+
+func ReadOnlyWrapper(store Store) ReadOnlyStore {
+	return ReadOnlyStore{store: store}
+}
+
+type allocationKey struct {
+	year      int64
+	expenseId int64
+}
+
+// changeSet is a set of entry changes made together.
+type changeSet struct {
+	userId int64
+	undoes int64
+	undone bool
+}
+
+// tables holds everything this package stores. Stored values are never
+// changed in place, so a shallow copy of each map makes a safe copy.
+type tables struct {
+	accounts         map[int64]fin.Account
+	entries          map[int64]fin.Entry
+	recurringEntries map[int64]fin.RecurringEntry
+	users            map[int64]fin.User
+	accessRules      map[int64]fin.AccessRule
+	apiTokens        map[int64]fin.ApiToken
+	allocations      map[allocationKey]int64
+	attachments      map[int64]fin.Attachment
+	blobs            map[string][]byte
+	entryHistory     []fin.EntryHistory
+	changeSets       map[int64]changeSet
+
+	// Deleted entries and recurring entries by their original ids
+	trashedEntries          map[int64]fin.TrashedEntry
+	trashedRecurringEntries map[int64]fin.TrashedRecurringEntry
+
+	// The last id handed out for each kind of row
+	lastIds map[string]int64
+}
+
+func newTables() Table {
+	return &tables{
+		accounts:         make(map[int64]fin.Account),
+		entries:          make(map[int64]fin.Entry),
+		recurringEntries: make(map[int64]fin.RecurringEntry),
+		users:            make(map[int64]fin.User),
+		accessRules:      make(map[int64]fin.AccessRule),
+		apiTokens:        make(map[int64]fin.ApiToken),
+		allocations:      make(map[allocationKey]int64),
+		attachments:      make(map[int64]fin.Attachment),
+		blobs:            make(map[string][]byte),
+		changeSets:       make(map[int64]changeSet),
+		lastIds:          make(map[string]int64),
+
+		trashedEntries:          make(map[int64]fin.TrashedEntry),
+		trashedRecurringEntries: make(map[int64]fin.TrashedRecurringEntry),
+	}
+}
+
+func (t *tables) Clone() Table {
+	return &tables{
+		accounts:         maps.Clone(t.accounts),
+		entries:          maps.Clone(t.entries),
+		recurringEntries: maps.Clone(t.recurringEntries),
+		users:            maps.Clone(t.users),
+		accessRules:      maps.Clone(t.accessRules),
+		apiTokens:        maps.Clone(t.apiTokens),
+		allocations:      maps.Clone(t.allocations),
+		attachments:      maps.Clone(t.attachments),
+		blobs:            maps.Clone(t.blobs),
+		entryHistory:     slices.Clip(t.entryHistory),
+		changeSets:       maps.Clone(t.changeSets),
+		lastIds:          maps.Clone(t.lastIds),
+
+		trashedEntries:          maps.Clone(t.trashedEntries),
+		trashedRecurringEntries: maps.Clone(t.trashedRecurringEntries),
+	}
+}
+
+func (t *tables) nextId(kind string) int64 {
+	t.lastIds[kind]++
+	return t.lastIds[kind]
+}
+
+func readTables(tx *Tx) *tables {
+	return tx.Table(kTableName, newTables).(*tables)
+}
+
+func updateTables(tx *Tx) *tables {
+	return tx.TableForUpdate(kTableName, newTables).(*tables)
+}
+
+// storedEntry returns entry the way this package stores it.
+func storedEntry(entry *fin.Entry) fin.Entry {
+	result := *entry
+	result.Date = date_util.TimeToDate(result.Date)
+	result.Tags = fin.ParseTags(strings.Join(result.Tags, "|"))
+	result.Etag = 0
+	return result
+}
+
+// copyEntry returns a copy of entry that shares nothing with it.
+func copyEntry(entry *fin.Entry) fin.Entry {
+	result := *entry
+	result.Tags = slices.Clone(result.Tags)
+	return result
+}
+
+// entryEtag computes the etag of a stored entry.
+func entryEtag(entry *fin.Entry) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%v", *entry)
+	return h.Sum64()
+}
+
+func storedTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Time{}
+	}
+	return time.Unix(t.Unix(), 0).UTC()
+}
+
+func storedAccount(account *fin.Account) fin.Account {
+	result := *account
+	result.ImportSD = date_util.TimeToDate(result.ImportSD)
+	return result
+}
+
+func storedUser(user *fin.User) fin.User {
+	result := *user
+	result.LastLogin = storedTime(result.LastLogin)
+	return result
+}
+
+func storedRecurringEntry(entry *fin.RecurringEntry) fin.RecurringEntry {
+	result := *entry
+	result.Entry = storedEntry(&entry.Entry)
+	return result
+}
+
+func entries(
+	tx *Tx,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	var start, end *time.Time
+	var unreviewed bool
+	var limit int
+	if options != nil {
+		if options.Start != nil {
+			d := date_util.TimeToDate(*options.Start)
+			start = &d
+		}
+		if options.End != nil {
+			d := date_util.TimeToDate(*options.End)
+			end = &d
+		}
+		unreviewed = options.Unreviewed
+		limit = options.Limit
+	}
+	filter := findb.EntryFilter(options)
+	var result []fin.Entry
+	for _, entry := range readTables(tx).entries {
+		if start != nil && entry.Date.Before(*start) {
+			continue
+		}
+		if end != nil && !entry.Date.Before(*end) {
+			continue
+		}
+		if unreviewed && entry.Status == fin.Reviewed {
+			continue
+		}
+		if filter != nil && !filter(&entry) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Date.Equal(result[j].Date) {
+			return result[i].Date.After(result[j].Date)
+		}
+		return result[i].Id > result[j].Id
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	for i := range result {
+		if !consumer.CanConsume() {
+			break
+		}
+		entry := copyEntry(&result[i])
+		if unreviewed {
+			entry.Etag = entryEtag(&result[i])
+		}
+		consumer.Consume(entry)
+	}
+	return nil
+}
+
+func entryById(tx *Tx, id int64, entry *fin.Entry) error {
+	stored, ok := readTables(tx).entries[id]
+	if !ok {
+		return findb.NoSuchId
+	}
+	*entry = copyEntry(&stored)
+	entry.Etag = entryEtag(&stored)
+	return nil
+}
+
+// changeSetInfo describes a change set that doEntryChanges records.
+type changeSetInfo struct {
+	// The user making the changes
+	userId int64
+	// The id of the change set being undone or 0 if not an undo. Entries
+	// that an undo deletes skip the trash.
+	undoes int64
+	// True if the changes bring entries back from the trash.
+	restores bool
+	// When the changes happen
+	now time.Time
+}
+
+// keepsIds returns true if added entries come back under their original
+// ids. Both undos and restores bring back entries that were deleted.
+func (c changeSetInfo) keepsIds() bool {
+	return c.undoes != 0 || c.restores
+}
+
+func doEntryChanges(
+	tx *Tx, changes *findb.EntryChanges, info changeSetInfo) error {
+	t := updateTables(tx)
+	now := info.now
+	var history []fin.EntryHistory
+	var deltas fin.AccountDeltas = make(map[int64]*fin.AccountDelta)
+	var removesAttachments bool
+	for _, id := range changes.Deletes {
+		old, ok := t.entries[id]
+		if !ok {
+			continue
+		}
+		history = append(history, fin.EntryHistory{EntryId: id, Before: &old})
+		deltas.Exclude(&old.CatPayment)
+		if info.undoes != 0 {
+			// Undoing an add removes the entry for good.
+			t.removeEntryAttachments(id)
+			removesAttachments = true
+		} else {
+			// Attachments stay with the trashed entry until it is purged.
+			t.trashedEntries[id] = fin.TrashedEntry{
+				Entry: old, Trashed: storedTime(now)}
+		}
+		delete(t.entries, id)
+	}
+	if removesAttachments {
+		t.removeOrphanBlobs()
+	}
+	for id, update := range changes.Updates {
+		old, ok := t.entries[id]
+		if !ok {
+			continue
+		}
+		concurrent_update_detected := false
+		if changes.Etags != nil {
+			expected_etag, ok := changes.Etags[id]
+			if !ok {
+				panic("Etags field present, but does not contain etag for all updated entries.")
+			}
+			if expected_etag != entryEtag(&old) {
+				concurrent_update_detected = true
+			}
+		}
+		entry := copyEntry(&old)
+		entry.Etag = entryEtag(&old)
+		if !update(&entry) {
+			continue
+		}
+		if concurrent_update_detected {
+			return findb.ConcurrentUpdate
+		}
+		entry.Id = id
+		stored := storedEntry(&entry)
+		deltas.Exclude(&old.CatPayment)
+		deltas.Include(&stored.CatPayment)
+		t.entries[id] = stored
+		history = append(
+			history,
+			fin.EntryHistory{EntryId: id, Before: &old, After: &stored})
+	}
+	for _, entry := range changes.Adds {
+		if info.keepsIds() {
+			delete(t.trashedEntries, entry.Id)
+		} else {
+			entry.Id = t.nextId("entries")
+		}
+		stored := storedEntry(entry)
+		deltas.Include(&stored.CatPayment)
+		t.entries[entry.Id] = stored
+		history = append(
+			history, fin.EntryHistory{EntryId: entry.Id, After: &stored})
+	}
+	t.recordAccountDeltas(deltas)
+	changes.ChangeId = t.recordEntryHistory(history, info, now)
+	return nil
+}
+
+func restoreTrashedEntry(
+	tx *Tx, id, userId int64, now time.Time) error {
+	trashed, ok := readTables(tx).trashedEntries[id]
+	if !ok {
+		return findb.NoSuchId
+	}
+	entry := copyEntry(&trashed.Entry)
+	return doEntryChanges(
+		tx,
+		&findb.EntryChanges{Adds: []*fin.Entry{&entry}},
+		changeSetInfo{userId: userId, restores: true, now: now})
+}
+
+func (t *tables) purgeTrash(before time.Time) int {
+	var count int
+	for id, trashed := range t.trashedEntries {
+		if !trashed.Trashed.Before(before) {
+			continue
+		}
+		delete(t.trashedEntries, id)
+		t.removeEntryAttachments(id)
+		count++
+	}
+	for id, trashed := range t.trashedRecurringEntries {
+		if trashed.Trashed.Before(before) {
+			delete(t.trashedRecurringEntries, id)
+			count++
+		}
+	}
+	t.removeOrphanBlobs()
+	return count
+}
+
+func (t *tables) removeEntryAttachments(entryId int64) {
+	for id, attachment := range t.attachments {
+		if attachment.EntryId == entryId {
+			delete(t.attachments, id)
+		}
+	}
+}
+
+func (t *tables) removeOrphanBlobs() {
+	used := make(map[string]bool)
+	for _, attachment := range t.attachments {
+		used[attachment.Hash] = true
+	}
+	for hash := range t.blobs {
+		if !used[hash] {
+			delete(t.blobs, hash)
+		}
+	}
+}
+
+func (t *tables) recordAccountDeltas(deltas fin.AccountDeltas) {
+	for id, delta := range deltas {
+		account, ok := t.accounts[id]
+		if !ok {
+			continue
+		}
+		account.Balance += delta.Balance
+		account.RBalance += delta.RBalance
+		account.Count += delta.Count
+		account.RCount += delta.RCount
+		t.accounts[id] = account
+	}
+}
+
+func (t *tables) recordEntryHistory(
+	history []fin.EntryHistory, info changeSetInfo, now time.Time) int64 {
+	if len(history) == 0 {
+		return 0
+	}
+	changeId := t.nextId("change_sets")
+	t.changeSets[changeId] = changeSet{
+		userId: info.userId, undoes: info.undoes}
+	for _, h := range history {
+		h.Id = t.nextId("entry_history")
+		h.ChangeId = changeId
+		h.UserId = info.userId
+		h.Time = storedTime(now)
+		t.entryHistory = append(t.entryHistory, h)
+	}
+	return changeId
+}
+
+func entryHistory(
+	tx *Tx,
+	filter func(h *fin.EntryHistory) bool,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	history := readTables(tx).entryHistory
+	for i := range history {
+		if !consumer.CanConsume() {
+			break
+		}
+		if filter(&history[i]) {
+			consumer.Consume(copyEntryHistory(&history[i]))
+		}
+	}
+	return nil
+}
+
+func copyEntryHistory(h *fin.EntryHistory) fin.EntryHistory {
+	result := *h
+	if h.Before != nil {
+		before := copyEntry(h.Before)
+		result.Before = &before
+	}
+	if h.After != nil {
+		after := copyEntry(h.After)
+		result.After = &after
+	}
+	return result
+}
+
+func undo(tx *Tx, changeId, userId int64, now time.Time) error {
+	t := readTables(tx)
+	cs, ok := t.changeSets[changeId]
+	if !ok {
+		return findb.NoSuchId
+	}
+	if cs.userId != userId {
+		return findb.NoPermission
+	}
+	if cs.undoes != 0 || cs.undone {
+		return findb.CannotUndo
+	}
+	var history []fin.EntryHistory
+	err := entryHistory(
+		tx,
+		func(h *fin.EntryHistory) bool { return h.ChangeId == changeId },
+		consume2.AppendTo(&history))
+	if err != nil {
+		return err
+	}
+	changes := findb.EntryChanges{
+		Updates: make(map[int64]fin.EntryUpdater)}
+	for i := len(history) - 1; i >= 0; i-- {
+		h := &history[i]
+		if h.IsDelete() {
+			// Refuse to undo if the entry was restored since.
+			if _, ok := t.entries[h.EntryId]; ok {
+				return findb.ConcurrentUpdate
+			}
+		} else {
+			// Refuse to undo if the entry changed since.
+			current, ok := t.entries[h.EntryId]
+			if !ok || !reflect.DeepEqual(&current, h.After) {
+				return findb.ConcurrentUpdate
+			}
+		}
+		switch {
+		case h.IsAdd():
+			changes.Deletes = append(changes.Deletes, h.EntryId)
+		case h.IsDelete():
+			changes.Adds = append(changes.Adds, h.Before)
+		default:
+			changes.Updates[h.EntryId] = revertTo(h.Before)
+		}
+	}
+	err = doEntryChanges(
+		tx, &changes, changeSetInfo{userId: userId, undoes: changeId, now: now})
+	if err != nil {
+		return err
+	}
+	updated := updateTables(tx)
+	cs.undone = true
+	updated.changeSets[changeId] = cs
+	removeFitIds(tx, changeId)
+	return nil
+}
+
+func revertTo(before *fin.Entry) fin.EntryUpdater {
+	return func(entry *fin.Entry) bool {
+		*entry = *before
+		return true
+	}
+}
+
+func lastChangeId(tx *Tx, userId int64) (int64, error) {
+	var result int64
+	for id, cs := range readTables(tx).changeSets {
+		if cs.userId == userId && cs.undoes == 0 && !cs.undone && id > result {
+			result = id
+		}
+	}
+	if result == 0 {
+		return 0, findb.NoSuchId
+	}
+	return result, nil
+}
+
+func activeAccounts(tx *Tx) (accounts []*fin.Account, err error) {
+	for _, account := range readTables(tx).accounts {
+		if account.Active {
+			account := account
+			accounts = append(accounts, &account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Name != accounts[j].Name {
+			return accounts[i].Name < accounts[j].Name
+		}
+		return accounts[i].Id < accounts[j].Id
+	})
+	return
+}
+
+// sortedIds returns the keys of m in ascending order.
+func sortedIds[T any](m map[int64]T) []int64 {
+	return slices.Sorted(maps.Keys(m))
+}
+
+type Store struct {
+	db     Doer
+	userId int64
+	clock  date_util.Clock
+}
+
+// WithUser returns a Store like this one except that it records userId
+// as the user making the entry changes in the entry history.
+func (s Store) WithUser(userId int64) Store {
+	s.userId = userId
+	return s
+}
+
+// WithClock returns a Store like this one except that clock supplies the
+// times of entry changes and of moves to the trash. Without a clock, the
+// store uses the system time.
+func (s Store) WithClock(clock date_util.Clock) Store {
+	s.clock = clock
+	return s
+}
+
+func (s Store) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+func (s Store) AccountById(
+	t db.Transaction, acctId int64, account *fin.Account) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		stored, ok := readTables(tx).accounts[acctId]
+		if !ok {
+			return findb.NoSuchId
+		}
+		*account = stored
+		return nil
+	})
+}
+
+func (s Store) Accounts(
+	t db.Transaction, consumer consume2.Consumer[fin.Account]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		accounts := readTables(tx).accounts
+		for _, id := range sortedIds(accounts) {
+			if !consumer.CanConsume() {
+				break
+			}
+			consumer.Consume(accounts[id])
+		}
+		return nil
+	})
+}
+
+func (s Store) ActiveAccounts(t db.Transaction) (
+	accounts []*fin.Account, err error) {
+	err = ToDoer(s.db, t).Do(func(tx *Tx) (err error) {
+		accounts, err = activeAccounts(tx)
+		return
+	})
+	return
+}
+
+func (s Store) AddAccount(t db.Transaction, account *fin.Account) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		account.Id = tbls.nextId("accounts")
+		tbls.accounts[account.Id] = storedAccount(account)
+		return nil
+	})
+}
+
+func (s Store) DoEntryChanges(
+	t db.Transaction, changes *findb.EntryChanges) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		return doEntryChanges(
+			tx, changes, changeSetInfo{userId: s.userId, now: s.now()})
+	})
+}
+
+func (s Store) Entries(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		return entries(tx, options, consumer)
+	})
+}
+
+func (s Store) CatTotals(
+	t db.Transaction, options *findb.EntryListOptions) (
+	fin.CatTotals, error) {
+	return findb.CatTotals(t, s, options)
+}
+
+func (s Store) EntriesPage(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.Entry]) (string, error) {
+	return findb.EntriesPage(t, s, options, token, pageSize, consumer)
+}
+
+func (s Store) SearchEntries(
+	t db.Transaction,
+	query string,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return findb.SearchEntries(t, s, query, options, consumer)
+}
+
+func (s Store) EntryById(
+	t db.Transaction, id int64, entry *fin.Entry) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		return entryById(tx, id, entry)
+	})
+}
+
+func (s Store) UpdateAccountImportSD(
+	t db.Transaction, acctId int64, date time.Time) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		if account, ok := tbls.accounts[acctId]; ok {
+			account.ImportSD = date_util.TimeToDate(date)
+			tbls.accounts[acctId] = account
+		}
+		return nil
+	})
+}
+
+func (s Store) UpdateAccountCurrency(
+	t db.Transaction, acctId int64, currency fin.Currency) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		if account, ok := tbls.accounts[acctId]; ok {
+			account.Currency = currency
+			tbls.accounts[acctId] = account
+		}
+		return nil
+	})
+}
+
+func (s Store) UpdateAccount(
+	t db.Transaction, account *fin.Account) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		if _, ok := tbls.accounts[account.Id]; ok {
+			tbls.accounts[account.Id] = storedAccount(account)
+		}
+		return nil
+	})
+}
+
+func (s Store) RemoveAccount(
+	t db.Transaction, id int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		delete(updateTables(tx).accounts, id)
+		return nil
+	})
+}
+
+func (s Store) AddUser(t db.Transaction, user *fin.User) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		if _, ok := tbls.userIdByName(user.Name); ok {
+			return ErrDuplicateKey
+		}
+		user.Id = tbls.nextId("users")
+		tbls.users[user.Id] = storedUser(user)
+		return nil
+	})
+}
+
+func (t *tables) userIdByName(name string) (int64, bool) {
+	for id, user := range t.users {
+		if user.Name == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (s Store) RemoveUserByName(t db.Transaction, name string) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		if id, ok := tbls.userIdByName(name); ok {
+			delete(tbls.users, id)
+			maps.DeleteFunc(tbls.apiTokens, func(_ int64, token fin.ApiToken) bool {
+				return token.UserId == id
+			})
+		}
+		maps.DeleteFunc(tbls.accessRules, func(id int64, rule fin.AccessRule) bool {
+			return rule.UserName == name
+		})
+		return nil
+	})
+}
+
+func (s Store) UpdateUser(t db.Transaction, user *fin.User) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		if _, ok := tbls.users[user.Id]; !ok {
+			return nil
+		}
+		if id, ok := tbls.userIdByName(user.Name); ok && id != user.Id {
+			return ErrDuplicateKey
+		}
+		tbls.users[user.Id] = storedUser(user)
+		return nil
+	})
+}
+
+func (s Store) UserById(
+	t db.Transaction, id int64, user *fin.User) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		stored, ok := readTables(tx).users[id]
+		if !ok {
+			return findb.NoSuchId
+		}
+		*user = stored
+		return nil
+	})
+}
+
+func (s Store) UserByName(
+	t db.Transaction, name string, user *fin.User) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := readTables(tx)
+		id, ok := tbls.userIdByName(name)
+		if !ok {
+			return findb.NoSuchId
+		}
+		*user = tbls.users[id]
+		return nil
+	})
+}
+
+func (s Store) Users(
+	t db.Transaction, consumer consume2.Consumer[fin.User]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		users := slices.Collect(maps.Values(readTables(tx).users))
+		sort.Slice(users, func(i, j int) bool {
+			return users[i].Name < users[j].Name
+		})
+		for _, user := range users {
+			if !consumer.CanConsume() {
+				break
+			}
+			consumer.Consume(user)
+		}
+		return nil
+	})
+}
+
+func (s Store) AccessRulesByUserName(
+	t db.Transaction,
+	name string,
+	consumer consume2.Consumer[fin.AccessRule]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		var rules []fin.AccessRule
+		for _, rule := range readTables(tx).accessRules {
+			if rule.UserName == name {
+				rules = append(rules, rule)
+			}
+		}
+		sort.Slice(rules, func(i, j int) bool {
+			return rules[i].Id < rules[j].Id
+		})
+		for _, rule := range rules {
+			if !consumer.CanConsume() {
+				break
+			}
+			consumer.Consume(rule)
+		}
+		return nil
+	})
+}
+
+func (s Store) AddAccessRule(t db.Transaction, rule *fin.AccessRule) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		rule.Id = tbls.nextId("access_rules")
+		tbls.accessRules[rule.Id] = *rule
+		return nil
+	})
+}
+
+func (s Store) RemoveAccessRule(t db.Transaction, id int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		delete(updateTables(tx).accessRules, id)
+		return nil
+	})
+}
+
+func (s Store) ApiTokensByUserId(
+	t db.Transaction,
+	userId int64,
+	consumer consume2.Consumer[fin.ApiToken]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		var tokens []fin.ApiToken
+		for _, token := range readTables(tx).apiTokens {
+			if token.UserId == userId {
+				tokens = append(tokens, token)
+			}
+		}
+		sort.Slice(tokens, func(i, j int) bool {
+			return tokens[i].Id < tokens[j].Id
+		})
+		for _, token := range tokens {
+			if !consumer.CanConsume() {
+				break
+			}
+			token.AccountIds = slices.Clone(token.AccountIds)
+			consumer.Consume(token)
+		}
+		return nil
+	})
+}
+
+func (s Store) ApiTokenByHash(
+	t db.Transaction, hash string, token *fin.ApiToken) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		for _, stored := range readTables(tx).apiTokens {
+			if stored.Hash == hash {
+				*token = stored
+				token.AccountIds = slices.Clone(stored.AccountIds)
+				return nil
+			}
+		}
+		return findb.NoSuchId
+	})
+}
+
+func (s Store) AddApiToken(t db.Transaction, token *fin.ApiToken) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		token.Id = tbls.nextId("api_tokens")
+		stored := *token
+		stored.AccountIds = slices.Clone(token.AccountIds)
+		tbls.apiTokens[token.Id] = stored
+		return nil
+	})
+}
+
+func (s Store) UpdateApiTokenLastUsed(
+	t db.Transaction, id int64, lastUsed time.Time) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		token, ok := tbls.apiTokens[id]
+		if !ok {
+			return nil
+		}
+		token.LastUsed = lastUsed
+		tbls.apiTokens[id] = token
+		return nil
+	})
+}
+
+func (s Store) RemoveApiToken(t db.Transaction, id int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		delete(updateTables(tx).apiTokens, id)
+		return nil
+	})
+}
+
+func (s Store) AddRecurringEntry(
+	t db.Transaction, entry *fin.RecurringEntry) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		entry.Id = tbls.nextId("recurring_entries")
+		tbls.recurringEntries[entry.Id] = storedRecurringEntry(entry)
+		return nil
+	})
+}
+
+func (s Store) UpdateRecurringEntry(
+	t db.Transaction, entry *fin.RecurringEntry) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		if _, ok := tbls.recurringEntries[entry.Id]; ok {
+			tbls.recurringEntries[entry.Id] = storedRecurringEntry(entry)
+		}
+		return nil
+	})
+}
+
+func (s Store) RecurringEntryById(
+	t db.Transaction, id int64, entry *fin.RecurringEntry) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		stored, ok := readTables(tx).recurringEntries[id]
+		if !ok {
+			return findb.NoSuchId
+		}
+		*entry = stored
+		entry.Entry = copyEntry(&stored.Entry)
+		entry.Etag = entryEtag(&stored.Entry)
+		return nil
+	})
+}
+
+func (s Store) RecurringEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.RecurringEntry]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		entries := slices.Collect(
+			maps.Values(readTables(tx).recurringEntries))
+		sort.Slice(entries, func(i, j int) bool {
+			if !entries[i].Date.Equal(entries[j].Date) {
+				return entries[i].Date.Before(entries[j].Date)
+			}
+			return entries[i].Id < entries[j].Id
+		})
+		for i := range entries {
+			if !consumer.CanConsume() {
+				break
+			}
+			entries[i].Entry = copyEntry(&entries[i].Entry)
+			consumer.Consume(entries[i])
+		}
+		return nil
+	})
+}
+
+func (s Store) RemoveRecurringEntryById(t db.Transaction, id int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		entry, ok := tbls.recurringEntries[id]
+		if !ok {
+			return nil
+		}
+		tbls.trashedRecurringEntries[id] = fin.TrashedRecurringEntry{
+			RecurringEntry: entry, Trashed: storedTime(s.now())}
+		delete(tbls.recurringEntries, id)
+		return nil
+	})
+}
+
+func (s Store) TrashedEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.TrashedEntry]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		entries := slices.Collect(maps.Values(readTables(tx).trashedEntries))
+		sort.Slice(entries, func(i, j int) bool {
+			if !entries[i].Trashed.Equal(entries[j].Trashed) {
+				return entries[i].Trashed.After(entries[j].Trashed)
+			}
+			return entries[i].Id > entries[j].Id
+		})
+		for i := range entries {
+			if !consumer.CanConsume() {
+				break
+			}
+			entries[i].Entry = copyEntry(&entries[i].Entry)
+			consumer.Consume(entries[i])
+		}
+		return nil
+	})
+}
+
+// RestoreEntry attributes the restore to the user of this store.
+func (s Store) RestoreEntry(t db.Transaction, id int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		return restoreTrashedEntry(tx, id, s.userId, s.now())
+	})
+}
+
+func (s Store) TrashedRecurringEntries(
+	t db.Transaction,
+	consumer consume2.Consumer[fin.TrashedRecurringEntry]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		entries := slices.Collect(
+			maps.Values(readTables(tx).trashedRecurringEntries))
+		sort.Slice(entries, func(i, j int) bool {
+			if !entries[i].Trashed.Equal(entries[j].Trashed) {
+				return entries[i].Trashed.After(entries[j].Trashed)
+			}
+			return entries[i].Id > entries[j].Id
+		})
+		for i := range entries {
+			if !consumer.CanConsume() {
+				break
+			}
+			entries[i].Entry = copyEntry(&entries[i].Entry)
+			consumer.Consume(entries[i])
+		}
+		return nil
+	})
+}
+
+func (s Store) RestoreRecurringEntry(t db.Transaction, id int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		trashed, ok := tbls.trashedRecurringEntries[id]
+		if !ok {
+			return findb.NoSuchId
+		}
+		tbls.recurringEntries[id] = trashed.RecurringEntry
+		delete(tbls.trashedRecurringEntries, id)
+		return nil
+	})
+}
+
+func (s Store) PurgeTrash(
+	t db.Transaction, before time.Time) (count int, err error) {
+	err = ToDoer(s.db, t).Do(func(tx *Tx) error {
+		count = updateTables(tx).purgeTrash(before)
+		return nil
+	})
+	return
+}
+
+func (s Store) AllocationsByYear(t db.Transaction, year int64) (
+	result map[int64]int64, err error) {
+	err = ToDoer(s.db, t).Do(func(tx *Tx) error {
+		result = make(map[int64]int64)
+		for key, amount := range readTables(tx).allocations {
+			if key.year == year {
+				result[key.expenseId] = amount
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (s Store) RemoveAllocation(
+	t db.Transaction, year, expenseId int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		delete(
+			updateTables(tx).allocations,
+			allocationKey{year: year, expenseId: expenseId})
+		return nil
+	})
+}
+
+func (s Store) AddAllocation(
+	t db.Transaction, year, expenseId, amount int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		key := allocationKey{year: year, expenseId: expenseId}
+		if _, ok := tbls.allocations[key]; ok {
+			return ErrDuplicateKey
+		}
+		tbls.allocations[key] = amount
+		return nil
+	})
+}
+
+func (s Store) EntryHistory(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		return entryHistory(
+			tx,
+			func(h *fin.EntryHistory) bool { return h.EntryId == entryId },
+			consumer)
+	})
+}
+
+func (s Store) ChangeEntries(
+	t db.Transaction,
+	changeId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		return entryHistory(
+			tx,
+			func(h *fin.EntryHistory) bool { return h.ChangeId == changeId },
+			consumer)
+	})
+}
+
+func (s Store) LastChangeId(
+	t db.Transaction, userId int64) (result int64, err error) {
+	err = ToDoer(s.db, t).Do(func(tx *Tx) (err error) {
+		result, err = lastChangeId(tx, userId)
+		return
+	})
+	return
+}
+
+// Undo attributes the undo to the user of this store.
+func (s Store) Undo(t db.Transaction, changeId int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		return undo(tx, changeId, s.userId, s.now())
+	})
+}
+
+func (s Store) AddAttachment(
+	t db.Transaction, attachment *fin.Attachment, contents []byte) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		attachment.Hash = fin.ContentHash(contents)
+		attachment.Size = int64(len(contents))
+		if _, ok := tbls.blobs[attachment.Hash]; !ok {
+			tbls.blobs[attachment.Hash] = slices.Clone(contents)
+		}
+		attachment.Id = tbls.nextId("attachments")
+		stored := *attachment
+		stored.Added = storedTime(stored.Added)
+		tbls.attachments[attachment.Id] = stored
+		return nil
+	})
+}
+
+func (s Store) AttachmentById(
+	t db.Transaction, id int64, attachment *fin.Attachment) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		stored, ok := readTables(tx).attachments[id]
+		if !ok {
+			return findb.NoSuchId
+		}
+		*attachment = stored
+		return nil
+	})
+}
+
+func (s Store) AttachmentsByEntryId(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.Attachment]) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		var attachments []fin.Attachment
+		for _, attachment := range readTables(tx).attachments {
+			if attachment.EntryId == entryId {
+				attachments = append(attachments, attachment)
+			}
+		}
+		sort.Slice(attachments, func(i, j int) bool {
+			if !attachments[i].Added.Equal(attachments[j].Added) {
+				return attachments[i].Added.Before(attachments[j].Added)
+			}
+			return attachments[i].Id < attachments[j].Id
+		})
+		for _, attachment := range attachments {
+			if !consumer.CanConsume() {
+				break
+			}
+			consumer.Consume(attachment)
+		}
+		return nil
+	})
+}
+
+func (s Store) AttachmentContents(
+	t db.Transaction, hash string) (contents []byte, err error) {
+	err = ToDoer(s.db, t).Do(func(tx *Tx) error {
+		stored, ok := readTables(tx).blobs[hash]
+		if !ok {
+			return findb.NoSuchId
+		}
+		contents = slices.Clone(stored)
+		return nil
+	})
+	return
+}
+
+func (s Store) RemoveAttachment(t db.Transaction, id int64) error {
+	return ToDoer(s.db, t).Do(func(tx *Tx) error {
+		tbls := updateTables(tx)
+		delete(tbls.attachments, id)
+		tbls.removeOrphanBlobs()
+		return nil
+	})
+}
+
+type ReadOnlyStore struct {
+	findb.NoPermissionStore
+	store Store
+}
+
+func (s ReadOnlyStore) AccountById(
+	t db.Transaction, acctId int64, account *fin.Account) error {
+	return s.store.AccountById(t, acctId, account)
+}
+
+func (s ReadOnlyStore) Accounts(
+	t db.Transaction, consumer consume2.Consumer[fin.Account]) error {
+	return s.store.Accounts(t, consumer)
+}
+
+func (s ReadOnlyStore) ActiveAccounts(t db.Transaction) (
+	accounts []*fin.Account, err error) {
+	return s.store.ActiveAccounts(t)
+}
+
+func (s ReadOnlyStore) Entries(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return s.store.Entries(t, options, consumer)
+}
+
+func (s ReadOnlyStore) CatTotals(
+	t db.Transaction, options *findb.EntryListOptions) (
+	fin.CatTotals, error) {
+	return s.store.CatTotals(t, options)
+}
+
+func (s ReadOnlyStore) EntriesPage(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.Entry]) (string, error) {
+	return s.store.EntriesPage(t, options, token, pageSize, consumer)
+}
+
+func (s ReadOnlyStore) SearchEntries(
+	t db.Transaction,
+	query string,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return s.store.SearchEntries(t, query, options, consumer)
+}
+
+func (s ReadOnlyStore) EntryById(
+	t db.Transaction, id int64, entry *fin.Entry) error {
+	return s.store.EntryById(t, id, entry)
+}
+
+func (s ReadOnlyStore) UserById(
+	t db.Transaction, id int64, user *fin.User) error {
+	return s.store.UserById(t, id, user)
+}
+
+func (s ReadOnlyStore) UserByName(
+	t db.Transaction, name string, user *fin.User) error {
+	return s.store.UserByName(t, name, user)
+}
+
+func (s ReadOnlyStore) Users(
+	t db.Transaction, consumer consume2.Consumer[fin.User]) error {
+	return s.store.Users(t, consumer)
+}
+
+func (s ReadOnlyStore) RecurringEntryById(
+	t db.Transaction, id int64, entry *fin.RecurringEntry) error {
+	return s.store.RecurringEntryById(t, id, entry)
+}
+
+func (s ReadOnlyStore) RecurringEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.RecurringEntry]) error {
+	return s.store.RecurringEntries(t, consumer)
+}
+
+func (s ReadOnlyStore) TrashedEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.TrashedEntry]) error {
+	return s.store.TrashedEntries(t, consumer)
+}
+
+func (s ReadOnlyStore) TrashedRecurringEntries(
+	t db.Transaction,
+	consumer consume2.Consumer[fin.TrashedRecurringEntry]) error {
+	return s.store.TrashedRecurringEntries(t, consumer)
+}
+
+func (s ReadOnlyStore) AllocationsByYear(t db.Transaction, year int64) (
+	map[int64]int64, error) {
+	return s.store.AllocationsByYear(t, year)
+}
+
+func (s ReadOnlyStore) EntryHistory(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return s.store.EntryHistory(t, entryId, consumer)
+}
+
+func (s ReadOnlyStore) ChangeEntries(
+	t db.Transaction,
+	changeId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return s.store.ChangeEntries(t, changeId, consumer)
+}
+
+func (s ReadOnlyStore) LastChangeId(
+	t db.Transaction, userId int64) (int64, error) {
+	return s.store.LastChangeId(t, userId)
+}
+
+func (s ReadOnlyStore) AttachmentById(
+	t db.Transaction, id int64, attachment *fin.Attachment) error {
+	return s.store.AttachmentById(t, id, attachment)
+}
+
+func (s ReadOnlyStore) AttachmentsByEntryId(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.Attachment]) error {
+	return s.store.AttachmentsByEntryId(t, entryId, consumer)
+}
+
+func (s ReadOnlyStore) AttachmentContents(
+	t db.Transaction, hash string) ([]byte, error) {
+	return s.store.AttachmentContents(t, hash)
+}
@@ -0,0 +1,1933 @@
+// Package for_postgres stores types in fin package in a PostgreSQL database
+// so that several app servers can share one database.
+//
+// The sqlite3_db and sqlite3_rw packages work with any database/sql
+// driver, so this package uses them for transactions and reading rows.
+package for_postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	"github.com/keep94/toolbox/db/sqlite3_rw"
+	"github.com/keep94/toolbox/passwords"
+)
+
+const (
+	kSQLEntryById                    = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags from entries where id = $1`
+	kSQLLockEntryById                = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags from entries where id = $1 for update`
+	kSQLEntriesPrefix                = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags from entries`
+	kSQLEntries                      = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags from entries order by date desc, id desc`
+	kSQLEntryOrderBy                 = " order by date desc, id desc"
+	kSQLInsertEntry                  = `insert into entries (date, name, "desc", check_no, cats, payment, rate, reviewed, tags) values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+	kSQLRestoreEntry                 = `insert into entries (date, name, "desc", check_no, cats, payment, rate, reviewed, tags, id) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	kSQLUpdateEntry                  = `update entries set date = $1, name = $2, "desc" = $3, check_no = $4, cats = $5, payment = $6, rate = $7, reviewed = $8, tags = $9 where id = $10`
+	kSQLDeleteEntryById              = "delete from entries where id = $1"
+	kSQLTrashEntry                   = `insert into trashed_entries (id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, trashed) select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, $1 from entries where id = $2`
+	kSQLTrashedEntryById             = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, trashed from trashed_entries where id = $1`
+	kSQLTrashedEntries               = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, trashed from trashed_entries order by trashed desc, id desc`
+	kSQLRemoveTrashedEntry           = "delete from trashed_entries where id = $1"
+	kSQLRecurringEntryById           = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month from recurring_entries where id = $1`
+	kSQLRecurringEntries             = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month from recurring_entries order by date, id`
+	kSQLInsertRecurringEntry         = `insert into recurring_entries (date, name, "desc", check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) returning id`
+	kSQLUpdateRecurringEntry         = `update recurring_entries set date = $1, name = $2, "desc" = $3, check_no = $4, cats = $5, payment = $6, rate = $7, reviewed = $8, tags = $9, count = $10, unit = $11, num_left = $12, day_of_month = $13 where id = $14`
+	kSQLDeleteRecurringEntryById     = "delete from recurring_entries where id = $1"
+	kSQLRestoreRecurringEntry        = `insert into recurring_entries (date, name, "desc", check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, id) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+	kSQLTrashRecurringEntry          = `insert into trashed_recurring_entries (id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, trashed) select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, $1 from recurring_entries where id = $2`
+	kSQLTrashedRecurringEntryById    = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, trashed from trashed_recurring_entries where id = $1`
+	kSQLTrashedRecurringEntries      = `select id, date, name, "desc", check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, trashed from trashed_recurring_entries order by trashed desc, id desc`
+	kSQLRemoveTrashedRecurringEntry  = "delete from trashed_recurring_entries where id = $1"
+	kSQLPurgeTrashedAttachments      = "delete from attachments where entry_id in (select id from trashed_entries where trashed < $1)"
+	kSQLPurgeTrashedEntries          = "delete from trashed_entries where trashed < $1"
+	kSQLPurgeTrashedRecurringEntries = "delete from trashed_recurring_entries where trashed < $1"
+	kSQLAccountById                  = "select id, name, is_active, balance, reconciled, b_count, r_count, import_sd, currency from accounts where id = $1"
+	kSQLAccounts                     = "select id, name, is_active, balance, reconciled, b_count, r_count, import_sd, currency from accounts"
+	kSQLActiveAccounts               = "select id, name, is_active, balance, reconciled, b_count, r_count, import_sd, currency from accounts where is_active = true order by name"
+	kSQLInsertAccount                = "insert into accounts (name, is_active, balance, reconciled, b_count, r_count, import_sd, currency) values ($1, $2, $3, $4, $5, $6, $7, $8) returning id"
+	kSQLUpdateAccountImportSD        = "update accounts set import_sd = $1 where id = $2"
+	kSQLUpdateAccountCurrency        = "update accounts set currency = $1 where id = $2"
+	kSQLUpdateAccount                = "update accounts set name = $1, is_active = $2, balance = $3, reconciled = $4, b_count = $5, r_count = $6, import_sd = $7, currency = $8 where id = $9"
+	kSQLRemoveAccount                = "delete from accounts where id = $1"
+	kSQLUserById                     = "select id, name, go_password, permission, last_login from users where id = $1"
+	kSQLUsers                        = "select id, name, go_password, permission, last_login from users order by name"
+	kSQLRemoveUserByName             = "delete from users where name = $1"
+	kSQLUserByName                   = "select id, name, go_password, permission, last_login from users where name = $1"
+	kSQLInsertUser                   = "insert into users (name, go_password, permission, last_login) values ($1, $2, $3, $4) returning id"
+	kSQLUpdateUser                   = "update users set name = $1, go_password = $2, permission = $3, last_login = $4 where id = $5"
+	kSQLAccessRulesByUserName        = "select id, user_name, cat from access_rules where user_name = $1 order by id"
+	kSQLInsertAccessRule             = "insert into access_rules (user_name, cat) values ($1, $2) returning id"
+	kSQLRemoveAccessRule             = "delete from access_rules where id = $1"
+	kSQLRemoveAccessRulesByUserName  = "delete from access_rules where user_name = $1"
+	kSQLApiTokensByUserId            = "select id, user_id, name, hash, permission, book, account_ids, created, last_used from api_tokens where user_id = $1 order by id"
+	kSQLApiTokenByHash               = "select id, user_id, name, hash, permission, book, account_ids, created, last_used from api_tokens where hash = $1"
+	kSQLInsertApiToken               = "insert into api_tokens (user_id, name, hash, permission, book, account_ids, created, last_used) values ($1, $2, $3, $4, $5, $6, $7, $8) returning id"
+	kSQLUpdateApiTokenLastUsed       = "update api_tokens set last_used = $1 where id = $2"
+	kSQLRemoveApiToken               = "delete from api_tokens where id = $1"
+	kSQLRemoveApiTokensByUserName    = "delete from api_tokens where user_id in (select id from users where name = $1)"
+	kSQLAllocationsByYear            = "select expense_id, amount from allocations where year = $1"
+	kSQLAddAllocation                = "insert into allocations (year, expense_id, amount) values ($1, $2, $3)"
+	kSQLRemoveAllocation             = "delete from allocations where year = $1 and expense_id = $2"
+	kSQLAttachmentById               = "select id, entry_id, name, content_type, hash, size, added from attachments where id = $1"
+	kSQLAttachmentsByEntryId         = "select id, entry_id, name, content_type, hash, size, added from attachments where entry_id = $1 order by added, id"
+	kSQLInsertAttachment             = "insert into attachments (entry_id, name, content_type, hash, size, added) values ($1, $2, $3, $4, $5, $6) returning id"
+	kSQLRemoveAttachment             = "delete from attachments where id = $1"
+	kSQLRemoveEntryAttachments       = "delete from attachments where entry_id = $1"
+	kSQLBlobByHash                   = "select contents from blobs where hash = $1"
+	kSQLInsertBlob                   = "insert into blobs (hash, contents) values ($1, $2) on conflict (hash) do nothing"
+	kSQLRemoveOrphanBlobs            = "delete from blobs where hash not in (select hash from attachments)"
+	kSQLEntryHistory                 = "select id, entry_id, change_id, user_id, time, old_entry, new_entry from entry_history where entry_id = $1 order by id"
+	kSQLChangeEntries                = "select id, entry_id, change_id, user_id, time, old_entry, new_entry from entry_history where change_id = $1 order by id"
+	kSQLInsertEntryHistory           = "insert into entry_history (entry_id, change_id, user_id, time, old_entry, new_entry) values ($1, $2, $3, $4, $5, $6)"
+	kSQLInsertChangeSet              = "insert into change_sets (user_id, time, undoes) values ($1, $2, $3) returning id"
+	kSQLChangeSetById                = "select user_id, undoes, undone from change_sets where id = $1 for update"
+	kSQLMarkChangeSetUndone          = "update change_sets set undone = 1 where id = $1"
+	kSQLRemoveChangeFitIds           = "delete from qfx_fitids where change_id = $1"
+	kSQLInsertEntryTag               = "insert into entry_tags (entry_id, tag) values ($1, $2)"
+	kSQLRemoveEntryTags              = "delete from entry_tags where entry_id = $1"
+	kSQLLastChangeId                 = "select id from change_sets where user_id = $1 and undoes = 0 and undone = 0 order by id desc limit 1"
+)
+
+func New(db *sqlite3_db.Db) Store {
+	return Store{db: db}
+}
+
+func ConnNew(tx *sql.Tx) Store {
+	return Store{db: sqlite3_db.NewSqlite3Doer(tx)}
+}
+
+func ReadOnlyWrapper(store Store) ReadOnlyStore {
+	return ReadOnlyStore{store: store}
+}
+
+func entries(tx *sql.Tx, options *findb.EntryListOptions, consumer consume2.Consumer[fin.Entry]) error {
+	var sql string
+	if options != nil {
+		where_clauses := make([]string, 5)
+		where_clause_count := 0
+		param_count := 0
+		if options.Start != nil {
+			param_count++
+			where_clauses[where_clause_count] = fmt.Sprintf(
+				"date >= $%d", param_count)
+			where_clause_count++
+		}
+		if options.End != nil {
+			param_count++
+			where_clauses[where_clause_count] = fmt.Sprintf(
+				"date < $%d", param_count)
+			where_clause_count++
+		}
+		if options.Unreviewed {
+			where_clauses[where_clause_count] = "reviewed != 1"
+			where_clause_count++
+		}
+		if entryTag(options) != "" {
+			param_count++
+			where_clauses[where_clause_count] = fmt.Sprintf(
+				"id in (select entry_id from entry_tags where tag = $%d)",
+				param_count)
+			where_clause_count++
+		}
+		if options.After != nil {
+			where_clauses[where_clause_count] = fmt.Sprintf(
+				"(date, id) < ($%d, $%d)", param_count+1, param_count+2)
+			where_clause_count++
+		}
+		if where_clause_count > 0 {
+			sql = kSQLEntriesPrefix + " where " + strings.Join(where_clauses[:where_clause_count], " and ") + kSQLEntryOrderBy
+		} else {
+			sql = kSQLEntriesPrefix + kSQLEntryOrderBy
+		}
+	} else {
+		sql = kSQLEntriesPrefix + kSQLEntryOrderBy
+	}
+	sql_params := make([]interface{}, 0, 2)
+	if options != nil {
+		if options.Start != nil {
+			sql_params = append(
+				sql_params, sqlite3_db.DateToString(*options.Start))
+		}
+		if options.End != nil {
+			sql_params = append(
+				sql_params, sqlite3_db.DateToString(*options.End))
+		}
+		if tag := entryTag(options); tag != "" {
+			sql_params = append(sql_params, tag)
+		}
+		if options.After != nil {
+			sql_params = append(
+				sql_params,
+				sqlite3_db.DateToString(options.After.Date),
+				options.After.Id)
+		}
+	}
+	if options != nil && options.Limit > 0 {
+		consumer = consume2.Slice(consumer, 0, options.Limit)
+	}
+	if filter := findb.EntryFilter(options); filter != nil {
+		consumer = consume2.Filterp(consumer, filter)
+	}
+	dbrows, err := tx.Query(sql, sql_params...)
+	if err != nil {
+		return err
+	}
+	defer dbrows.Close()
+	if options != nil && options.Unreviewed {
+		return sqlite3_rw.ReadRowsWithEtag[fin.Entry](
+			(&rawEntry{}).init(&fin.Entry{}),
+			dbrows,
+			consumer)
+	}
+	return sqlite3_rw.ReadRows[fin.Entry](
+		(&rawEntry{}).init(&fin.Entry{}),
+		dbrows,
+		consumer)
+}
+
+// entryTag returns the Tag criterion of options as entry_tags stores it.
+func entryTag(options *findb.EntryListOptions) string {
+	return strings.ToLower(strings.TrimSpace(options.Tag))
+}
+
+// entryTags returns the rows that entry should have in entry_tags. The
+// rows hold the tags as reading the entry back would return them.
+func entryTags(entry *fin.Entry) []string {
+	return fin.ParseTags(strings.Join(entry.Tags, "|"))
+}
+
+// writeEntryTags replaces the rows for entry in entry_tags.
+func writeEntryTags(tx *sql.Tx, entry *fin.Entry) error {
+	if err := removeEntryTags(tx, entry.Id); err != nil {
+		return err
+	}
+	for _, tag := range entryTags(entry) {
+		if _, err := tx.Exec(kSQLInsertEntryTag, entry.Id, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeEntryTags(tx *sql.Tx, entryId int64) error {
+	_, err := tx.Exec(kSQLRemoveEntryTags, entryId)
+	return err
+}
+
+func entryById(tx *sql.Tx, id int64, entry *fin.Entry) error {
+	return _entryByIdWithQuery(tx, kSQLEntryById, id, entry)
+}
+
+// lockEntryById works like entryById but also locks the entry until tx
+// ends so that the caller can check the entry and change it without
+// another server changing it in between.
+func lockEntryById(tx *sql.Tx, id int64, entry *fin.Entry) error {
+	return _entryByIdWithQuery(tx, kSQLLockEntryById, id, entry)
+}
+
+func _entryByIdWithQuery(
+	tx *sql.Tx, query string, id int64, entry *fin.Entry) error {
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	return _entryById(stmt, (&rawEntry{}).init(entry), id)
+}
+
+func _entryById(stmt *sql.Stmt, r *rawEntry, id int64) error {
+	dbrows, err := stmt.Query(id)
+	if err != nil {
+		return err
+	}
+	defer dbrows.Close()
+	return sqlite3_rw.FirstOnly(r, dbrows, findb.NoSuchId)
+}
+
+// changeSetInfo describes a change set that doEntryChanges records.
+type changeSetInfo struct {
+	// The user making the changes
+	userId int64
+	// The id of the change set being undone or 0 if not an undo. Entries
+	// that an undo deletes skip the trash.
+	undoes int64
+	// True if the changes bring entries back from the trash.
+	restores bool
+	// When the changes happen
+	now time.Time
+}
+
+// keepsIds returns true if added entries come back under their original
+// ids. Both undos and restores bring back entries that were deleted.
+func (c changeSetInfo) keepsIds() bool {
+	return c.undoes != 0 || c.restores
+}
+
+func doEntryChanges(
+	tx *sql.Tx, changes *findb.EntryChanges, info changeSetInfo) error {
+	row := (&rawEntry{}).init(&fin.Entry{})
+	var err error
+	var history []rawEntryHistory
+	var deltas fin.AccountDeltas = make(map[int64]*fin.AccountDelta)
+	var getStmt, addStmt, deleteStmt, updateStmt *sql.Stmt
+	var removesAttachments bool
+	now := info.now
+	if len(changes.Updates) > 0 || len(changes.Deletes) > 0 {
+		// Lock the entries so that concurrent changes from other servers
+		// wait for this one and then see its result.
+		getStmt, err = tx.Prepare(kSQLLockEntryById)
+		if err != nil {
+			return err
+		}
+		defer getStmt.Close()
+	}
+	if len(changes.Adds) > 0 {
+		if info.keepsIds() {
+			addStmt, err = tx.Prepare(kSQLRestoreEntry)
+		} else {
+			addStmt, err = tx.Prepare(kSQLInsertEntry)
+		}
+		if err != nil {
+			return err
+		}
+		defer addStmt.Close()
+	}
+	if len(changes.Deletes) > 0 {
+		deleteStmt, err = tx.Prepare(kSQLDeleteEntryById)
+		if err != nil {
+			return err
+		}
+		defer deleteStmt.Close()
+	}
+	if len(changes.Updates) > 0 {
+		updateStmt, err = tx.Prepare(kSQLUpdateEntry)
+		if err != nil {
+			return err
+		}
+		defer updateStmt.Close()
+	}
+	for _, id := range changes.Deletes {
+		err = _entryById(getStmt, row, id)
+		if err == findb.NoSuchId {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var h rawEntryHistory
+		if err = h.setOld(row.Entry); err != nil {
+			return err
+		}
+		history = append(history, h)
+		deltas.Exclude(&row.CatPayment)
+		if info.undoes != 0 {
+			// Undoing an add removes the entry for good.
+			if _, err = tx.Exec(kSQLRemoveEntryAttachments, id); err != nil {
+				return err
+			}
+			removesAttachments = true
+		} else {
+			// Attachments stay with the trashed entry until it is purged.
+			if _, err = tx.Exec(kSQLTrashEntry, now.Unix(), id); err != nil {
+				return err
+			}
+		}
+		_, err = deleteStmt.Exec(id)
+		if err != nil {
+			return err
+		}
+		if err = removeEntryTags(tx, id); err != nil {
+			return err
+		}
+	}
+	for id, update := range changes.Updates {
+		err = _entryById(getStmt, row, id)
+		if err == findb.NoSuchId {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		concurrent_update_detected := false
+		if changes.Etags != nil {
+			expected_etag, ok := changes.Etags[id]
+			if !ok {
+				panic("Etags field present, but does not contain etag for all updated entries.")
+			}
+			if expected_etag != row.Etag {
+				concurrent_update_detected = true
+			}
+		}
+		old_cat_payment := row.CatPayment
+		var h rawEntryHistory
+		if err = h.setOld(row.Entry); err != nil {
+			return err
+		}
+		if !update(row.Entry) {
+			continue
+		}
+		if concurrent_update_detected {
+			return findb.ConcurrentUpdate
+		}
+		deltas.Exclude(&old_cat_payment)
+		deltas.Include(&row.CatPayment)
+		row.Entry.Id = id
+		var updateValues []interface{}
+		if updateValues, err = sqlite3_rw.UpdateValues(row); err != nil {
+			return err
+		}
+		_, err = updateStmt.Exec(updateValues...)
+		if err != nil {
+			return err
+		}
+		if err = writeEntryTags(tx, row.Entry); err != nil {
+			return err
+		}
+		if err = h.setNew(row.Entry); err != nil {
+			return err
+		}
+		history = append(history, h)
+	}
+	for _, entry := range changes.Adds {
+		row.init(entry)
+		deltas.Include(&entry.CatPayment)
+		if info.keepsIds() {
+			err = restoreEntry(addStmt, row)
+			if err == nil {
+				_, err = tx.Exec(kSQLRemoveTrashedEntry, entry.Id)
+			}
+		} else {
+			err = addEntry(addStmt, row)
+		}
+		if err != nil {
+			return err
+		}
+		if err = writeEntryTags(tx, entry); err != nil {
+			return err
+		}
+		var h rawEntryHistory
+		if err = h.setNew(entry); err != nil {
+			return err
+		}
+		history = append(history, h)
+	}
+	if removesAttachments {
+		if _, err = tx.Exec(kSQLRemoveOrphanBlobs); err != nil {
+			return err
+		}
+	}
+	if err = recordAccountDeltas(tx, deltas); err != nil {
+		return err
+	}
+	changes.ChangeId, err = recordEntryHistory(tx, history, info, now)
+	return err
+}
+
+func activeAccounts(tx *sql.Tx) (accounts []*fin.Account, err error) {
+	err = sqlite3_rw.ReadMultiple[fin.Account](
+		tx,
+		(&rawAccount{}).init(&fin.Account{}),
+		consume2.AppendPtrsTo(&accounts),
+		kSQLActiveAccounts)
+	return
+}
+
+func updateAccountImportSD(tx *sql.Tx, acctId int64, date time.Time) error {
+	_, err := tx.Exec(kSQLUpdateAccountImportSD, sqlite3_db.DateToString(date), acctId)
+	return err
+}
+
+func updateAccountCurrency(
+	tx *sql.Tx, acctId int64, currency fin.Currency) error {
+	_, err := tx.Exec(kSQLUpdateAccountCurrency, string(currency), acctId)
+	return err
+}
+
+func addEntry(stmt *sql.Stmt, r *rawEntry) error {
+	values, err := sqlite3_rw.InsertValues(r)
+	if err != nil {
+		return err
+	}
+	return stmt.QueryRow(values...).Scan(&r.Id)
+}
+
+func restoreEntry(stmt *sql.Stmt, r *rawEntry) error {
+	values, err := sqlite3_rw.UpdateValues(r)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(values...)
+	return err
+}
+
+func recordAccountDeltas(tx *sql.Tx, deltas fin.AccountDeltas) error {
+	for id, delta := range deltas {
+		_, err := tx.Exec("update accounts set balance = balance + $1, reconciled = reconciled + $2, b_count = b_count + $3, r_count = r_count + $4 where id = $5", delta.Balance, delta.RBalance, delta.Count, delta.RCount, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordEntryHistory(
+	tx *sql.Tx,
+	history []rawEntryHistory,
+	info changeSetInfo,
+	now time.Time) (int64, error) {
+	if len(history) == 0 {
+		return 0, nil
+	}
+	var changeId int64
+	err := tx.QueryRow(
+		kSQLInsertChangeSet, info.userId, now.Unix(), info.undoes).Scan(
+		&changeId)
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(kSQLInsertEntryHistory)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, h := range history {
+		_, err = stmt.Exec(
+			h.entryId,
+			changeId,
+			info.userId,
+			now.Unix(),
+			h.oldEntry,
+			h.newEntry)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return changeId, nil
+}
+
+func undo(tx *sql.Tx, changeId, userId int64, now time.Time) error {
+	var owner, undoes int64
+	var undone bool
+	err := tx.QueryRow(kSQLChangeSetById, changeId).Scan(
+		&owner, &undoes, &undone)
+	if err == sql.ErrNoRows {
+		return findb.NoSuchId
+	}
+	if err != nil {
+		return err
+	}
+	if owner != userId {
+		return findb.NoPermission
+	}
+	if undoes != 0 || undone {
+		return findb.CannotUndo
+	}
+	var history []fin.EntryHistory
+	err = sqlite3_rw.ReadMultiple[fin.EntryHistory](
+		tx,
+		(&rawEntryHistory{}).init(&fin.EntryHistory{}),
+		consume2.AppendTo(&history),
+		kSQLChangeEntries,
+		changeId)
+	if err != nil {
+		return err
+	}
+	changes := findb.EntryChanges{
+		Updates: make(map[int64]fin.EntryUpdater)}
+	var current fin.Entry
+	for i := len(history) - 1; i >= 0; i-- {
+		h := &history[i]
+		if h.IsDelete() {
+			// Refuse to undo if the entry was restored since.
+			err := lockEntryById(tx, h.EntryId, &current)
+			if err == nil {
+				return findb.ConcurrentUpdate
+			}
+			if err != findb.NoSuchId {
+				return err
+			}
+		} else {
+			// Refuse to undo if the entry changed since.
+			err := lockEntryById(tx, h.EntryId, &current)
+			if err == findb.NoSuchId {
+				return findb.ConcurrentUpdate
+			}
+			if err != nil {
+				return err
+			}
+			same, err := sameEntry(&current, h.After)
+			if err != nil {
+				return err
+			}
+			if !same {
+				return findb.ConcurrentUpdate
+			}
+		}
+		switch {
+		case h.IsAdd():
+			changes.Deletes = append(changes.Deletes, h.EntryId)
+		case h.IsDelete():
+			changes.Adds = append(changes.Adds, h.Before)
+		default:
+			changes.Updates[h.EntryId] = revertTo(h.Before)
+		}
+	}
+	err = doEntryChanges(
+		tx, &changes, changeSetInfo{userId: userId, undoes: changeId, now: now})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(kSQLMarkChangeSetUndone, changeId); err != nil {
+		return err
+	}
+	// Let the entries that the change set imported be imported again.
+	_, err = tx.Exec(kSQLRemoveChangeFitIds, changeId)
+	return err
+}
+
+// sameEntry returns true if x and y have the same stored values.
+func sameEntry(x, y *fin.Entry) (bool, error) {
+	encodedX, err := encodeEntry(x)
+	if err != nil {
+		return false, err
+	}
+	encodedY, err := encodeEntry(y)
+	if err != nil {
+		return false, err
+	}
+	return encodedX == encodedY, nil
+}
+
+func revertTo(before *fin.Entry) fin.EntryUpdater {
+	return func(entry *fin.Entry) bool {
+		*entry = *before
+		return true
+	}
+}
+
+func lastChangeId(tx *sql.Tx, userId int64) (int64, error) {
+	var result int64
+	err := tx.QueryRow(kSQLLastChangeId, userId).Scan(&result)
+	if err == sql.ErrNoRows {
+		return 0, findb.NoSuchId
+	}
+	return result, err
+}
+
+func restoreTrashedEntry(
+	tx *sql.Tx, id, userId int64, now time.Time) error {
+	var trashed fin.TrashedEntry
+	err := sqlite3_rw.ReadSingle(
+		tx,
+		(&rawTrashedEntry{}).init(&trashed),
+		findb.NoSuchId,
+		kSQLTrashedEntryById,
+		id)
+	if err != nil {
+		return err
+	}
+	return doEntryChanges(
+		tx,
+		&findb.EntryChanges{Adds: []*fin.Entry{&trashed.Entry}},
+		changeSetInfo{userId: userId, restores: true, now: now})
+}
+
+func trashRecurringEntry(tx *sql.Tx, id int64, now time.Time) error {
+	if _, err := tx.Exec(kSQLTrashRecurringEntry, now.Unix(), id); err != nil {
+		return err
+	}
+	_, err := tx.Exec(kSQLDeleteRecurringEntryById, id)
+	return err
+}
+
+func restoreTrashedRecurringEntry(tx *sql.Tx, id int64) error {
+	var trashed fin.TrashedRecurringEntry
+	err := sqlite3_rw.ReadSingle(
+		tx,
+		(&rawTrashedRecurringEntry{}).init(&trashed),
+		findb.NoSuchId,
+		kSQLTrashedRecurringEntryById,
+		id)
+	if err != nil {
+		return err
+	}
+	values, err := sqlite3_rw.UpdateValues(
+		(&rawRecurringEntry{}).init(&trashed.RecurringEntry))
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(kSQLRestoreRecurringEntry, values...); err != nil {
+		return err
+	}
+	_, err = tx.Exec(kSQLRemoveTrashedRecurringEntry, id)
+	return err
+}
+
+func purgeTrash(tx *sql.Tx, before time.Time) (int, error) {
+	if _, err := tx.Exec(kSQLPurgeTrashedAttachments, before.Unix()); err != nil {
+		return 0, err
+	}
+	var total int
+	for _, statement := range []string{
+		kSQLPurgeTrashedEntries, kSQLPurgeTrashedRecurringEntries} {
+		result, err := tx.Exec(statement, before.Unix())
+		if err != nil {
+			return 0, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += int(count)
+	}
+	if _, err := tx.Exec(kSQLRemoveOrphanBlobs); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+type rawEntry struct {
+	*fin.Entry
+	dateStr string
+	cat     string
+	payment string
+	rate    float64
+	status  int
+	tags    string
+}
+
+func (r *rawEntry) init(bo *fin.Entry) *rawEntry {
+	r.Entry = bo
+	return r
+}
+
+func (r *rawEntry) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.dateStr, &r.Name, &r.Desc, &r.CheckNo, &r.cat, &r.payment, &r.rate, &r.status, &r.tags}
+}
+
+func (r *rawEntry) Values() []interface{} {
+	return []interface{}{r.dateStr, r.Name, r.Desc, r.CheckNo, r.cat, r.payment, r.rate, r.status, r.tags, r.Id}
+}
+
+func (r *rawEntry) SetEtag(etag uint64) {
+	r.Etag = etag
+}
+
+func (r *rawEntry) ValueRead() fin.Entry {
+	return *r.Entry
+}
+
+func (r *rawEntry) Unmarshall() error {
+	var err error
+	if r.Entry.Date, err = sqlite3_db.StringToDate(r.dateStr); err != nil {
+		return err
+	}
+	r.Status = fin.ReviewStatus(r.status)
+	if err = r.Entry.Unmarshall(r, unmarshall); err != nil {
+		return err
+	}
+	r.SetExchangeRate(r.rate)
+	r.Tags = fin.ParseTags(r.tags)
+	return nil
+}
+
+func (r *rawEntry) Marshall() error {
+	r.dateStr = sqlite3_db.DateToString(r.Date)
+	r.status = int(r.Status)
+	r.Entry.Marshall(marshall, r)
+	r.rate = 0
+	if rate := r.ExchangeRate(); rate != 1.0 {
+		r.rate = rate
+	}
+	r.tags = strings.Join(r.Tags, "|")
+	return nil
+}
+
+// storedEntry is how entry history rows store an entry. Fields are
+// named so that adding a column to the entries table does not break
+// existing history rows.
+type storedEntry struct {
+	Id      int64   `json:"id"`
+	Date    string  `json:"date"`
+	Name    string  `json:"name"`
+	Desc    string  `json:"desc"`
+	CheckNo string  `json:"checkNo"`
+	Cat     string  `json:"cat"`
+	Payment string  `json:"payment"`
+	Rate    float64 `json:"rate,omitempty"`
+	Status  int     `json:"status,omitempty"`
+	Tags    string  `json:"tags,omitempty"`
+}
+
+func (s *storedEntry) fromRaw(r *rawEntry) *storedEntry {
+	*s = storedEntry{
+		Id:      r.Id,
+		Date:    r.dateStr,
+		Name:    r.Name,
+		Desc:    r.Desc,
+		CheckNo: r.CheckNo,
+		Cat:     r.cat,
+		Payment: r.payment,
+		Rate:    r.rate,
+		Status:  r.status,
+		Tags:    r.tags,
+	}
+	return s
+}
+
+func (s *storedEntry) toRaw(r *rawEntry) {
+	r.Id = s.Id
+	r.dateStr = s.Date
+	r.Name = s.Name
+	r.Desc = s.Desc
+	r.CheckNo = s.CheckNo
+	r.cat = s.Cat
+	r.payment = s.Payment
+	r.rate = s.Rate
+	r.status = s.Status
+	r.tags = s.Tags
+}
+
+// encodeEntry encodes entry as a JSON object of its column values in the
+// entries table.
+func encodeEntry(entry *fin.Entry) (string, error) {
+	r := (&rawEntry{}).init(entry)
+	if err := r.Marshall(); err != nil {
+		return "", err
+	}
+	encoded, err := json.Marshal((&storedEntry{}).fromRaw(r))
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// decodeEntry is the inverse of encodeEntry.
+func decodeEntry(encoded string, entry *fin.Entry) error {
+	r := (&rawEntry{}).init(entry)
+	var stored storedEntry
+	if err := json.Unmarshal([]byte(encoded), &stored); err != nil {
+		return fmt.Errorf("for_postgres: bad entry encoding %q", encoded)
+	}
+	stored.toRaw(r)
+	return r.Unmarshall()
+}
+
+type rawEntryHistory struct {
+	*fin.EntryHistory
+	entryId  int64
+	rawTime  int64
+	oldEntry string
+	newEntry string
+}
+
+func (r *rawEntryHistory) init(bo *fin.EntryHistory) *rawEntryHistory {
+	r.EntryHistory = bo
+	return r
+}
+
+// setOld records entry as it was before the change.
+func (r *rawEntryHistory) setOld(entry *fin.Entry) (err error) {
+	r.entryId = entry.Id
+	r.oldEntry, err = encodeEntry(entry)
+	return
+}
+
+// setNew records entry as it is after the change.
+func (r *rawEntryHistory) setNew(entry *fin.Entry) (err error) {
+	r.entryId = entry.Id
+	r.newEntry, err = encodeEntry(entry)
+	return
+}
+
+func (r *rawEntryHistory) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.EntryId, &r.ChangeId, &r.UserId, &r.rawTime, &r.oldEntry, &r.newEntry}
+}
+
+func (r *rawEntryHistory) ValueRead() fin.EntryHistory {
+	return *r.EntryHistory
+}
+
+func (r *rawEntryHistory) Unmarshall() error {
+	r.Time = time.Unix(r.rawTime, 0).UTC()
+	r.Before = nil
+	if r.oldEntry != "" {
+		r.Before = &fin.Entry{}
+		if err := decodeEntry(r.oldEntry, r.Before); err != nil {
+			return err
+		}
+	}
+	r.After = nil
+	if r.newEntry != "" {
+		r.After = &fin.Entry{}
+		if err := decodeEntry(r.newEntry, r.After); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rawRecurringEntry struct {
+	*fin.RecurringEntry
+	re   rawEntry
+	unit int
+}
+
+func (r *rawRecurringEntry) init(bo *fin.RecurringEntry) *rawRecurringEntry {
+	r.RecurringEntry = bo
+	r.re.init(&bo.Entry)
+	return r
+}
+
+func (r *rawRecurringEntry) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.re.dateStr, &r.Name, &r.Desc, &r.CheckNo, &r.re.cat, &r.re.payment, &r.re.rate, &r.re.status, &r.re.tags, &r.Period.Count, &r.unit, &r.NumLeft, &r.Period.DayOfMonth}
+}
+
+func (r *rawRecurringEntry) Values() []interface{} {
+	return []interface{}{r.re.dateStr, r.Name, r.Desc, r.CheckNo, r.re.cat, r.re.payment, r.re.rate, r.re.status, r.re.tags, r.Period.Count, r.unit, r.NumLeft, r.Period.DayOfMonth, r.Id}
+}
+
+func (r *rawRecurringEntry) SetEtag(etag uint64) {
+	r.Etag = etag
+}
+
+func (r *rawRecurringEntry) ValueRead() fin.RecurringEntry {
+	return *r.RecurringEntry
+}
+
+func (r *rawRecurringEntry) Unmarshall() (err error) {
+	if err = r.re.Unmarshall(); err != nil {
+		return
+	}
+	var valid bool
+	if r.Period.Unit, valid = fin.ToRecurringUnit(r.unit); !valid {
+		err = errors.New("Invalid recurring unit found in database.")
+	}
+	return
+}
+
+func (r *rawRecurringEntry) Marshall() (err error) {
+	if err = r.re.Marshall(); err != nil {
+		return
+	}
+	r.unit = r.Period.Unit.ToInt()
+	return
+}
+
+type rawTrashedEntry struct {
+	*fin.TrashedEntry
+	re      rawEntry
+	trashed int64
+}
+
+func (r *rawTrashedEntry) init(bo *fin.TrashedEntry) *rawTrashedEntry {
+	r.TrashedEntry = bo
+	r.re.init(&bo.Entry)
+	return r
+}
+
+func (r *rawTrashedEntry) Ptrs() []interface{} {
+	return append(r.re.Ptrs(), &r.trashed)
+}
+
+func (r *rawTrashedEntry) ValueRead() fin.TrashedEntry {
+	return *r.TrashedEntry
+}
+
+func (r *rawTrashedEntry) Unmarshall() error {
+	r.Trashed = time.Unix(r.trashed, 0).UTC()
+	return r.re.Unmarshall()
+}
+
+type rawTrashedRecurringEntry struct {
+	*fin.TrashedRecurringEntry
+	rr      rawRecurringEntry
+	trashed int64
+}
+
+func (r *rawTrashedRecurringEntry) init(
+	bo *fin.TrashedRecurringEntry) *rawTrashedRecurringEntry {
+	r.TrashedRecurringEntry = bo
+	r.rr.init(&bo.RecurringEntry)
+	return r
+}
+
+func (r *rawTrashedRecurringEntry) Ptrs() []interface{} {
+	return append(r.rr.Ptrs(), &r.trashed)
+}
+
+func (r *rawTrashedRecurringEntry) ValueRead() fin.TrashedRecurringEntry {
+	return *r.TrashedRecurringEntry
+}
+
+func (r *rawTrashedRecurringEntry) Unmarshall() error {
+	r.Trashed = time.Unix(r.trashed, 0).UTC()
+	return r.rr.Unmarshall()
+}
+
+type rawAccount struct {
+	*fin.Account
+	importSDStr string
+	currency    string
+}
+
+func (r *rawAccount) init(bo *fin.Account) *rawAccount {
+	r.Account = bo
+	return r
+}
+
+func (r *rawAccount) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.Name, &r.Active, &r.Balance, &r.RBalance, &r.Count, &r.RCount, &r.importSDStr, &r.currency}
+}
+
+func (r *rawAccount) Values() []interface{} {
+	return []interface{}{r.Name, r.Active, r.Balance, r.RBalance, r.Count, r.RCount, r.importSDStr, r.currency, r.Id}
+}
+
+func (r *rawAccount) ValueRead() fin.Account {
+	return *r.Account
+}
+
+func (r *rawAccount) Unmarshall() error {
+	r.Account.ImportSD, _ = sqlite3_db.StringToDate(r.importSDStr)
+	r.Account.Currency = fin.Currency(r.currency)
+	return nil
+}
+
+func (r *rawAccount) Marshall() error {
+	r.importSDStr = sqlite3_db.DateToString(r.ImportSD)
+	r.currency = string(r.Currency)
+	return nil
+}
+
+type rawUser struct {
+	*fin.User
+	rawPassword   string
+	rawPermission int
+	rawLastLogin  int64
+}
+
+func (r *rawUser) init(bo *fin.User) *rawUser {
+	r.User = bo
+	return r
+}
+
+func (r *rawUser) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.Name, &r.rawPassword, &r.rawPermission, &r.rawLastLogin}
+}
+
+func (r *rawUser) Values() []interface{} {
+	return []interface{}{r.Name, r.rawPassword, r.rawPermission, r.rawLastLogin, r.Id}
+}
+
+func (r *rawUser) ValueRead() fin.User {
+	return *r.User
+}
+
+func (r *rawUser) Unmarshall() error {
+	r.Password = passwords.Password(r.rawPassword)
+	// Defaults to fin.NonePermission if the raw permission is not recognized
+	r.Permission, _ = fin.ToPermission(r.rawPermission)
+	if r.rawLastLogin == 0 {
+		r.LastLogin = time.Time{}
+	} else {
+		r.LastLogin = time.Unix(r.rawLastLogin, 0).UTC()
+	}
+	return nil
+}
+
+func (r *rawUser) Marshall() error {
+	r.rawPassword = string(r.Password)
+	r.rawPermission = r.Permission.ToInt()
+	if r.LastLogin.IsZero() {
+		r.rawLastLogin = 0
+	} else {
+		r.rawLastLogin = r.LastLogin.Unix()
+	}
+	return nil
+}
+
+type rawAccessRule struct {
+	*fin.AccessRule
+	rawCat string
+}
+
+func (r *rawAccessRule) init(bo *fin.AccessRule) *rawAccessRule {
+	r.AccessRule = bo
+	return r
+}
+
+func (r *rawAccessRule) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.UserName, &r.rawCat}
+}
+
+func (r *rawAccessRule) Values() []interface{} {
+	return []interface{}{r.UserName, r.rawCat, r.Id}
+}
+
+func (r *rawAccessRule) ValueRead() fin.AccessRule {
+	return *r.AccessRule
+}
+
+func (r *rawAccessRule) Unmarshall() (err error) {
+	r.Cat, err = fin.CatFromString(r.rawCat)
+	return
+}
+
+func (r *rawAccessRule) Marshall() error {
+	r.rawCat = r.Cat.ToString()
+	return nil
+}
+
+type rawApiToken struct {
+	*fin.ApiToken
+	rawPermission int
+	rawAccountIds string
+	rawCreated    int64
+	rawLastUsed   int64
+}
+
+func (r *rawApiToken) init(bo *fin.ApiToken) *rawApiToken {
+	r.ApiToken = bo
+	return r
+}
+
+func (r *rawApiToken) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.UserId, &r.Name, &r.Hash, &r.rawPermission, &r.Book, &r.rawAccountIds, &r.rawCreated, &r.rawLastUsed}
+}
+
+func (r *rawApiToken) Values() []interface{} {
+	return []interface{}{r.UserId, r.Name, r.Hash, r.rawPermission, r.Book, r.rawAccountIds, r.rawCreated, r.rawLastUsed, r.Id}
+}
+
+func (r *rawApiToken) ValueRead() fin.ApiToken {
+	return *r.ApiToken
+}
+
+func (r *rawApiToken) Unmarshall() (err error) {
+	// Defaults to fin.NonePermission if the raw permission is not recognized
+	r.Permission, _ = fin.ToPermission(r.rawPermission)
+	if r.AccountIds, err = findb.ParseIds(r.rawAccountIds); err != nil {
+		return
+	}
+	r.Created = time.Unix(r.rawCreated, 0).UTC()
+	if r.rawLastUsed == 0 {
+		r.LastUsed = time.Time{}
+	} else {
+		r.LastUsed = time.Unix(r.rawLastUsed, 0).UTC()
+	}
+	return nil
+}
+
+func (r *rawApiToken) Marshall() error {
+	r.rawPermission = r.Permission.ToInt()
+	r.rawAccountIds = findb.FormatIds(r.AccountIds)
+	r.rawCreated = r.Created.Unix()
+	if r.LastUsed.IsZero() {
+		r.rawLastUsed = 0
+	} else {
+		r.rawLastUsed = r.LastUsed.Unix()
+	}
+	return nil
+}
+
+type rawAttachment struct {
+	*fin.Attachment
+	rawAdded int64
+}
+
+func (r *rawAttachment) init(bo *fin.Attachment) *rawAttachment {
+	r.Attachment = bo
+	return r
+}
+
+func (r *rawAttachment) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.EntryId, &r.Name, &r.ContentType, &r.Hash, &r.Size, &r.rawAdded}
+}
+
+func (r *rawAttachment) Values() []interface{} {
+	return []interface{}{r.EntryId, r.Name, r.ContentType, r.Hash, r.Size, r.rawAdded, r.Id}
+}
+
+func (r *rawAttachment) ValueRead() fin.Attachment {
+	return *r.Attachment
+}
+
+func (r *rawAttachment) Unmarshall() error {
+	if r.rawAdded == 0 {
+		r.Added = time.Time{}
+	} else {
+		r.Added = time.Unix(r.rawAdded, 0).UTC()
+	}
+	return nil
+}
+
+func (r *rawAttachment) Marshall() error {
+	if r.Added.IsZero() {
+		r.rawAdded = 0
+	} else {
+		r.rawAdded = r.Added.Unix()
+	}
+	return nil
+}
+
+func unmarshall(ptr interface{}, cr *[]fin.CatRec, id *int64, reconciled *bool) error {
+	p := ptr.(*rawEntry)
+	var parts []string
+	if p.cat != "" {
+		parts = strings.Split(p.cat, "|")
+	}
+	partLen := len(parts)
+	if partLen%3 != 0 {
+		return errors.New(fmt.Sprintf("for_postgres: Category string invalid: %s", p.cat))
+	}
+	if partLen != 0 {
+		(*cr) = make([]fin.CatRec, partLen/3)
+	} else {
+		(*cr) = nil
+	}
+	for i := range *cr {
+		a, err := strconv.ParseInt(parts[3*i+1], 10, 64)
+		if err != nil {
+			return err
+		}
+		r, err := strconv.ParseInt(parts[3*i+2], 10, 0)
+		if err != nil {
+			return err
+		}
+		if r > 0 {
+			(*cr)[i] = fin.CatRec{Amount: a, Reconciled: true}
+		} else {
+			(*cr)[i] = fin.CatRec{Amount: a, Reconciled: false}
+		}
+		(*cr)[i].Cat, err = fin.CatFromString(parts[3*i])
+		if err != nil {
+			return err
+		}
+	}
+	parts = strings.SplitN(p.payment, "|", 2)
+	partLen = len(parts)
+	if partLen < 2 {
+		return errors.New(fmt.Sprintf("for_postgres: Payment string invalid: %s", p.payment))
+	}
+	r, err := strconv.ParseInt(parts[1], 10, 0)
+	if err != nil {
+		return err
+	}
+	if r > 0 {
+		*reconciled = true
+	} else {
+		*reconciled = false
+	}
+	pc, err := fin.CatFromString(parts[0])
+	if err != nil {
+		return err
+	}
+	*id = pc.Id
+	return nil
+}
+
+func marshall(cr []fin.CatRec, id int64, reconciled bool, ptr interface{}) {
+	p := ptr.(*rawEntry)
+	catStrs := make([]string, 3*len(cr))
+	for i := range cr {
+		catStrs[3*i] = cr[i].Cat.ToString()
+		catStrs[3*i+1] = strconv.FormatInt(cr[i].Amount, 10)
+		if cr[i].Reconciled {
+			catStrs[3*i+2] = "1"
+		} else {
+			catStrs[3*i+2] = "0"
+		}
+	}
+	paymentStrs := make([]string, 2)
+	pc := fin.Cat{Id: id, Type: fin.AccountCat}
+	paymentStrs[0] = pc.ToString()
+	if reconciled {
+		paymentStrs[1] = "1"
+	} else {
+		paymentStrs[1] = "0"
+	}
+	p.cat = strings.Join(catStrs, "|")
+	p.payment = strings.Join(paymentStrs, "|")
+}
+
+type Store struct {
+	db     sqlite3_db.Doer
+	userId int64
+	clock  date_util.Clock
+}
+
+// WithUser returns a Store like this one except that it records userId
+// as the user making the entry changes in the entry history.
+func (s Store) WithUser(userId int64) Store {
+	s.userId = userId
+	return s
+}
+
+// WithClock returns a Store like this one except that clock supplies the
+// times of entry changes and of moves to the trash. Without a clock, the
+// store uses the system time.
+func (s Store) WithClock(clock date_util.Clock) Store {
+	s.clock = clock
+	return s
+}
+
+func (s Store) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+func (s Store) AccountById(
+	t db.Transaction, acctId int64, account *fin.Account) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadSingle(
+			tx,
+			(&rawAccount{}).init(account),
+			findb.NoSuchId,
+			kSQLAccountById,
+			acctId)
+	})
+}
+
+func (s Store) Accounts(
+	t db.Transaction, consumer consume2.Consumer[fin.Account]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.Account](
+			tx,
+			(&rawAccount{}).init(&fin.Account{}),
+			consumer,
+			kSQLAccounts)
+	})
+}
+
+func (s Store) ActiveAccounts(t db.Transaction) (
+	accounts []*fin.Account, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		accounts, err = activeAccounts(tx)
+		return
+	})
+	return
+}
+
+func (s Store) AddAccount(t db.Transaction, account *fin.Account) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return addRow(
+			tx, (&rawAccount{}).init(account), &account.Id, kSQLInsertAccount)
+	})
+}
+
+func (s Store) DoEntryChanges(
+	t db.Transaction, changes *findb.EntryChanges) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return doEntryChanges(
+			tx, changes, changeSetInfo{userId: s.userId, now: s.now()})
+	})
+}
+
+func (s Store) Entries(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return entries(tx, options, consumer)
+	})
+}
+
+func (s Store) CatTotals(
+	t db.Transaction, options *findb.EntryListOptions) (
+	fin.CatTotals, error) {
+	return findb.CatTotals(t, s, options)
+}
+
+func (s Store) EntriesPage(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.Entry]) (string, error) {
+	return findb.EntriesPage(t, s, options, token, pageSize, consumer)
+}
+
+func (s Store) SearchEntries(
+	t db.Transaction,
+	query string,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return findb.SearchEntries(t, s, query, options, consumer)
+}
+
+func (s Store) EntryById(
+	t db.Transaction, id int64, entry *fin.Entry) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return entryById(tx, id, entry)
+	})
+}
+
+func (s Store) UpdateAccountImportSD(
+	t db.Transaction, acctId int64, date time.Time) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return updateAccountImportSD(tx, acctId, date)
+	})
+}
+
+func (s Store) UpdateAccountCurrency(
+	t db.Transaction, acctId int64, currency fin.Currency) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return updateAccountCurrency(tx, acctId, currency)
+	})
+}
+
+func (s Store) UpdateAccount(
+	t db.Transaction, account *fin.Account) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.UpdateRow(
+			tx, (&rawAccount{}).init(account), kSQLUpdateAccount)
+	})
+}
+
+func (s Store) RemoveAccount(
+	t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec(kSQLRemoveAccount, id)
+		return err
+	})
+}
+
+func (s Store) AddUser(t db.Transaction, user *fin.User) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return addRow(
+			tx, (&rawUser{}).init(user), &user.Id, kSQLInsertUser)
+	})
+}
+
+func (s Store) RemoveUserByName(t db.Transaction, name string) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(kSQLRemoveAccessRulesByUserName, name); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(kSQLRemoveApiTokensByUserName, name); err != nil {
+			return err
+		}
+		_, err := tx.Exec(kSQLRemoveUserByName, name)
+		return err
+	})
+}
+
+func (s Store) UpdateUser(t db.Transaction, user *fin.User) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.UpdateRow(
+			tx, (&rawUser{}).init(user), kSQLUpdateUser)
+	})
+}
+
+func (s Store) UserById(
+	t db.Transaction, id int64, user *fin.User) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadSingle(
+			tx,
+			(&rawUser{}).init(user),
+			findb.NoSuchId,
+			kSQLUserById,
+			id)
+	})
+}
+
+func (s Store) UserByName(
+	t db.Transaction, name string, user *fin.User) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadSingle(
+			tx,
+			(&rawUser{}).init(user),
+			findb.NoSuchId,
+			kSQLUserByName,
+			name)
+	})
+}
+
+func (s Store) Users(
+	t db.Transaction, consumer consume2.Consumer[fin.User]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.User](
+			tx,
+			(&rawUser{}).init(&fin.User{}),
+			consumer,
+			kSQLUsers)
+	})
+}
+
+func (s Store) AccessRulesByUserName(
+	t db.Transaction,
+	name string,
+	consumer consume2.Consumer[fin.AccessRule]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.AccessRule](
+			tx,
+			(&rawAccessRule{}).init(&fin.AccessRule{}),
+			consumer,
+			kSQLAccessRulesByUserName,
+			name)
+	})
+}
+
+func (s Store) AddAccessRule(t db.Transaction, rule *fin.AccessRule) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return addRow(
+			tx, (&rawAccessRule{}).init(rule), &rule.Id, kSQLInsertAccessRule)
+	})
+}
+
+func (s Store) RemoveAccessRule(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec(kSQLRemoveAccessRule, id)
+		return err
+	})
+}
+
+func (s Store) ApiTokensByUserId(
+	t db.Transaction,
+	userId int64,
+	consumer consume2.Consumer[fin.ApiToken]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.ApiToken](
+			tx,
+			(&rawApiToken{}).init(&fin.ApiToken{}),
+			consumer,
+			kSQLApiTokensByUserId,
+			userId)
+	})
+}
+
+func (s Store) ApiTokenByHash(
+	t db.Transaction, hash string, token *fin.ApiToken) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadSingle(
+			tx,
+			(&rawApiToken{}).init(token),
+			findb.NoSuchId,
+			kSQLApiTokenByHash,
+			hash)
+	})
+}
+
+func (s Store) AddApiToken(t db.Transaction, token *fin.ApiToken) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return addRow(
+			tx, (&rawApiToken{}).init(token), &token.Id, kSQLInsertApiToken)
+	})
+}
+
+func (s Store) UpdateApiTokenLastUsed(
+	t db.Transaction, id int64, lastUsed time.Time) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec(kSQLUpdateApiTokenLastUsed, lastUsed.Unix(), id)
+		return err
+	})
+}
+
+func (s Store) RemoveApiToken(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec(kSQLRemoveApiToken, id)
+		return err
+	})
+}
+
+func (s Store) AddRecurringEntry(
+	t db.Transaction, entry *fin.RecurringEntry) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return addRow(
+			tx,
+			(&rawRecurringEntry{}).init(entry),
+			&entry.Id,
+			kSQLInsertRecurringEntry)
+	})
+}
+
+func (s Store) UpdateRecurringEntry(
+	t db.Transaction, entry *fin.RecurringEntry) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.UpdateRow(
+			tx, (&rawRecurringEntry{}).init(entry), kSQLUpdateRecurringEntry)
+	})
+}
+
+func (s Store) RecurringEntryById(
+	t db.Transaction, id int64, entry *fin.RecurringEntry) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadSingle(
+			tx,
+			(&rawRecurringEntry{}).init(entry),
+			findb.NoSuchId,
+			kSQLRecurringEntryById,
+			id)
+	})
+}
+
+func (s Store) RecurringEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.RecurringEntry]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.RecurringEntry](
+			tx,
+			(&rawRecurringEntry{}).init(&fin.RecurringEntry{}),
+			consumer,
+			kSQLRecurringEntries)
+	})
+}
+
+func (s Store) RemoveRecurringEntryById(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return trashRecurringEntry(tx, id, s.now())
+	})
+}
+
+func (s Store) TrashedEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.TrashedEntry]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.TrashedEntry](
+			tx,
+			(&rawTrashedEntry{}).init(&fin.TrashedEntry{}),
+			consumer,
+			kSQLTrashedEntries)
+	})
+}
+
+// RestoreEntry attributes the restore to the user of this store.
+func (s Store) RestoreEntry(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return restoreTrashedEntry(tx, id, s.userId, s.now())
+	})
+}
+
+func (s Store) TrashedRecurringEntries(
+	t db.Transaction,
+	consumer consume2.Consumer[fin.TrashedRecurringEntry]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.TrashedRecurringEntry](
+			tx,
+			(&rawTrashedRecurringEntry{}).init(&fin.TrashedRecurringEntry{}),
+			consumer,
+			kSQLTrashedRecurringEntries)
+	})
+}
+
+func (s Store) RestoreRecurringEntry(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return restoreTrashedRecurringEntry(tx, id)
+	})
+}
+
+func (s Store) PurgeTrash(
+	t db.Transaction, before time.Time) (count int, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		count, err = purgeTrash(tx, before)
+		return
+	})
+	return
+}
+
+func (s Store) AllocationsByYear(t db.Transaction, year int64) (
+	result map[int64]int64, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		result, err = allocationsByYear(tx, year)
+		return
+	})
+	return
+}
+
+func allocationsByYear(tx *sql.Tx, year int64) (map[int64]int64, error) {
+	dbrows, err := tx.Query(kSQLAllocationsByYear, year)
+	if err != nil {
+		return nil, err
+	}
+	defer dbrows.Close()
+	result := make(map[int64]int64)
+	for dbrows.Next() {
+		var expenseId, amount int64
+		if err := dbrows.Scan(&expenseId, &amount); err != nil {
+			return nil, err
+		}
+		result[expenseId] = amount
+	}
+	return result, nil
+}
+
+func (s Store) RemoveAllocation(
+	t db.Transaction, year, expenseId int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec(kSQLRemoveAllocation, year, expenseId)
+		return err
+	})
+}
+
+func (s Store) AddAllocation(
+	t db.Transaction, year, expenseId, amount int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec(kSQLAddAllocation, year, expenseId, amount)
+		return err
+	})
+}
+
+func (s Store) EntryHistory(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.EntryHistory](
+			tx,
+			(&rawEntryHistory{}).init(&fin.EntryHistory{}),
+			consumer,
+			kSQLEntryHistory,
+			entryId)
+	})
+}
+
+func (s Store) ChangeEntries(
+	t db.Transaction,
+	changeId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.EntryHistory](
+			tx,
+			(&rawEntryHistory{}).init(&fin.EntryHistory{}),
+			consumer,
+			kSQLChangeEntries,
+			changeId)
+	})
+}
+
+func (s Store) LastChangeId(
+	t db.Transaction, userId int64) (result int64, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		result, err = lastChangeId(tx, userId)
+		return
+	})
+	return
+}
+
+// Undo attributes the undo to the user of this store.
+func (s Store) Undo(t db.Transaction, changeId int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return undo(tx, changeId, s.userId, s.now())
+	})
+}
+
+func (s Store) AddAttachment(
+	t db.Transaction, attachment *fin.Attachment, contents []byte) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		attachment.Hash = fin.ContentHash(contents)
+		attachment.Size = int64(len(contents))
+		if _, err := tx.Exec(
+			kSQLInsertBlob, attachment.Hash, contents); err != nil {
+			return err
+		}
+		return addRow(
+			tx,
+			(&rawAttachment{}).init(attachment),
+			&attachment.Id,
+			kSQLInsertAttachment)
+	})
+}
+
+func (s Store) AttachmentById(
+	t db.Transaction, id int64, attachment *fin.Attachment) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadSingle(
+			tx,
+			(&rawAttachment{}).init(attachment),
+			findb.NoSuchId,
+			kSQLAttachmentById,
+			id)
+	})
+}
+
+func (s Store) AttachmentsByEntryId(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.Attachment]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.Attachment](
+			tx,
+			(&rawAttachment{}).init(&fin.Attachment{}),
+			consumer,
+			kSQLAttachmentsByEntryId,
+			entryId)
+	})
+}
+
+func (s Store) AttachmentContents(
+	t db.Transaction, hash string) (contents []byte, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		err := tx.QueryRow(kSQLBlobByHash, hash).Scan(&contents)
+		if err == sql.ErrNoRows {
+			return findb.NoSuchId
+		}
+		return err
+	})
+	return
+}
+
+func (s Store) RemoveAttachment(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(kSQLRemoveAttachment, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(kSQLRemoveOrphanBlobs)
+		return err
+	})
+}
+
+type ReadOnlyStore struct {
+	findb.NoPermissionStore
+	store Store
+}
+
+func (s ReadOnlyStore) AccountById(
+	t db.Transaction, acctId int64, account *fin.Account) error {
+	return s.store.AccountById(t, acctId, account)
+}
+
+func (s ReadOnlyStore) Accounts(
+	t db.Transaction, consumer consume2.Consumer[fin.Account]) error {
+	return s.store.Accounts(t, consumer)
+}
+
+func (s ReadOnlyStore) ActiveAccounts(t db.Transaction) (
+	accounts []*fin.Account, err error) {
+	return s.store.ActiveAccounts(t)
+}
+
+func (s ReadOnlyStore) Entries(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return s.store.Entries(t, options, consumer)
+}
+
+func (s ReadOnlyStore) CatTotals(
+	t db.Transaction, options *findb.EntryListOptions) (
+	fin.CatTotals, error) {
+	return s.store.CatTotals(t, options)
+}
+
+func (s ReadOnlyStore) EntriesPage(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.Entry]) (string, error) {
+	return s.store.EntriesPage(t, options, token, pageSize, consumer)
+}
+
+func (s ReadOnlyStore) SearchEntries(
+	t db.Transaction,
+	query string,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return s.store.SearchEntries(t, query, options, consumer)
+}
+
+func (s ReadOnlyStore) EntryById(
+	t db.Transaction, id int64, entry *fin.Entry) error {
+	return s.store.EntryById(t, id, entry)
+}
+
+func (s ReadOnlyStore) UserById(
+	t db.Transaction, id int64, user *fin.User) error {
+	return s.store.UserById(t, id, user)
+}
+
+func (s ReadOnlyStore) UserByName(
+	t db.Transaction, name string, user *fin.User) error {
+	return s.store.UserByName(t, name, user)
+}
+
+func (s ReadOnlyStore) Users(
+	t db.Transaction, consumer consume2.Consumer[fin.User]) error {
+	return s.store.Users(t, consumer)
+}
+
+func (s ReadOnlyStore) RecurringEntryById(
+	t db.Transaction, id int64, entry *fin.RecurringEntry) error {
+	return s.store.RecurringEntryById(t, id, entry)
+}
+
+func (s ReadOnlyStore) RecurringEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.RecurringEntry]) error {
+	return s.store.RecurringEntries(t, consumer)
+}
+
+func (s ReadOnlyStore) TrashedEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.TrashedEntry]) error {
+	return s.store.TrashedEntries(t, consumer)
+}
+
+func (s ReadOnlyStore) TrashedRecurringEntries(
+	t db.Transaction,
+	consumer consume2.Consumer[fin.TrashedRecurringEntry]) error {
+	return s.store.TrashedRecurringEntries(t, consumer)
+}
+
+func (s ReadOnlyStore) AllocationsByYear(t db.Transaction, year int64) (
+	map[int64]int64, error) {
+	return s.store.AllocationsByYear(t, year)
+}
+
+func (s ReadOnlyStore) EntryHistory(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return s.store.EntryHistory(t, entryId, consumer)
+}
+
+func (s ReadOnlyStore) ChangeEntries(
+	t db.Transaction,
+	changeId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return s.store.ChangeEntries(t, changeId, consumer)
+}
+
+func (s ReadOnlyStore) LastChangeId(
+	t db.Transaction, userId int64) (int64, error) {
+	return s.store.LastChangeId(t, userId)
+}
+
+func (s ReadOnlyStore) AttachmentById(
+	t db.Transaction, id int64, attachment *fin.Attachment) error {
+	return s.store.AttachmentById(t, id, attachment)
+}
+
+func (s ReadOnlyStore) AttachmentsByEntryId(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.Attachment]) error {
+	return s.store.AttachmentsByEntryId(t, entryId, consumer)
+}
+
+func (s ReadOnlyStore) AttachmentContents(
+	t db.Transaction, hash string) ([]byte, error) {
+	return s.store.AttachmentContents(t, hash)
+}
+
+// addRow inserts row into the database using sql, which must end with
+// "returning id", and stores the id of the new row in rowId.
+// sqlite3_rw.AddRow can't be used because PostgreSQL does not support
+// LastInsertId.
+func addRow(
+	tx *sql.Tx, row sqlite3_rw.RowForWriting, rowId *int64, sql string) error {
+	values, err := sqlite3_rw.InsertValues(row)
+	if err != nil {
+		return err
+	}
+	return tx.QueryRow(sql, values...).Scan(rowId)
+}
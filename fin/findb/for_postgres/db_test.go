@@ -0,0 +1,385 @@
+package for_postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	qfxpostgres "github.com/keep94/finances/fin/autoimport/qfx/qfxdb/for_postgres"
+	"github.com/keep94/finances/fin/findb/fixture"
+	"github.com/keep94/finances/fin/findb/postgres_setup"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+)
+
+const (
+	// kDSNEnv names the environment variable holding the connection string
+	// of the PostgreSQL database to test against. Tests are skipped if it
+	// is not set.
+	kDSNEnv = "FINANCES_POSTGRES_TEST_DSN"
+
+	// kTestSchema is dropped and recreated by each test.
+	kTestSchema = "findb_test"
+)
+
+var (
+	changeError = errors.New("for_postgres: Error while changing.")
+)
+
+func TestAccountUpdates(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).AccountUpdates(t, New(db))
+}
+
+func TestAccountUpdatesExchangeRate(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).AccountUpdatesExchangeRate(t, New(db))
+}
+
+func TestSaveAndLoadEntry(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).SaveAndLoadEntry(t, New(db))
+}
+
+func TestUpdateEntry(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UpdateEntry(t, New(db))
+}
+
+func TestUpdateEntrySkipped(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UpdateEntrySkipped(t, New(db))
+}
+
+func TestListEntries(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntries(t, New(db))
+}
+
+func TestDeleteEntries(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).DeleteEntries(t, New(db))
+}
+
+func TestListEntriesEmptyOptions(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesEmptyOptions(t, New(db))
+}
+
+func TestListEntriesDateRange(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesDateRange(t, New(db))
+}
+
+func TestListEntriesDateRangeAndUnreviewed(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesDateRangeAndUnreviewed(t, New(db))
+}
+
+func TestListEntriesJustStartDate(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesJustStartDate(t, New(db))
+}
+
+func TestListEntriesJustEndDate(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesJustEndDate(t, New(db))
+}
+
+func TestListEntriesUnreviewed(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesUnreviewed(t, New(db))
+}
+
+func TestListEntriesAccount(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesAccount(t, New(db))
+}
+
+func TestListEntriesCriteria(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesCriteria(t, New(db))
+}
+
+func TestEntriesPage(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).EntriesPage(t, New(db))
+}
+
+func TestEntriesByAccountIdPage(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).EntriesByAccountIdPage(t, New(db))
+}
+
+func TestSearchEntries(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).SearchEntries(t, New(db))
+}
+
+func TestCatTotals(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).CatTotals(t, New(db))
+}
+
+func TestEntriesByAccountId(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).EntriesByAccountId(t, New(db))
+}
+
+func TestEntriesByAccountIdNilPtr(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).EntriesByAccountIdNilPtr(t, New(db))
+}
+
+func TestUnreconciledEntries(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UnreconciledEntries(t, New(db))
+}
+
+func TestUnreconciledEntriesNoAccount(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UnreconciledEntriesNoAccount(t, New(db))
+}
+
+func TestConcurrentUpdateDetection(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ConcurrentUpdateDetection(t, New(db))
+}
+
+func TestConcurrentUpdateSkipped(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ConcurrentUpdateSkipped(t, New(db))
+}
+
+func TestSaveAndLoadRecurringEntry(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).SaveAndLoadRecurringEntry(t, New(db))
+}
+
+func TestEntryHistory(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).EntryHistory(t, New(db).WithUser(3), 3)
+}
+
+func TestUndo(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).Undo(t, New(db).WithUser(3), 3)
+}
+
+func TestUndoOtherUser(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UndoOtherUser(
+		t, New(db).WithUser(3), New(db).WithUser(4), 3)
+}
+
+func TestUndoImport(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UndoImport(
+		t, New(db).WithUser(3), qfxpostgres.New(db), 3)
+}
+
+func TestSaveAndLoadAttachments(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).SaveAndLoadAttachments(t, New(db))
+}
+
+func TestPurgeTrashRemovesAttachments(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).PurgeTrashRemovesAttachments(t, New(db))
+}
+
+func TestTrash(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).Trash(t, New(db).WithUser(3), 3)
+}
+
+func TestTrashTimes(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	now := time.Unix(1700000000, 0)
+	newEntryAccountFixture(db).TrashTimes(
+		t, New(db).WithUser(3).WithClock(fixture.FixedClock(now)), 3, now)
+}
+
+func TestRecurringTrash(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).RecurringTrash(t, New(db))
+}
+
+func TestApplyRecurringEntries(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ApplyRecurringEntries(t, New(db))
+}
+
+func TestActiveAccounts(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ActiveAccounts(t, New(db))
+}
+
+func TestUpdateAccountImportSD(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UpdateAccountImportSD(t, New(db))
+}
+
+func TestUpdateAccountCurrency(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UpdateAccountCurrency(t, New(db))
+}
+
+func TestUpdateAccount(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UpdateAccount(t, New(db))
+}
+
+func TestRemoveAccount(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).RemoveAccount(t, New(db))
+}
+
+func TestUserById(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.UserById(t, New(db))
+}
+
+func TestUserByName(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.UserByName(t, New(db))
+}
+
+func TestUsers(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.Users(t, New(db))
+}
+
+func TestLoginUser(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.LoginUser(t, sqlite3_db.NewDoer(db), New(db))
+}
+
+func TestRemoveUserByName(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.RemoveUserByName(t, New(db))
+}
+
+func TestAccessRules(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.AccessRules(t, New(db))
+}
+
+func TestApiTokens(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.ApiTokens(t, sqlite3_db.NewDoer(db), New(db))
+}
+
+func TestNoUserByName(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NoUserByName(t, New(db))
+}
+
+func TestUpdateUser(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.UpdateUser(t, New(db))
+}
+
+func TestAllocations(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.Allocations(t, New(db))
+}
+
+func newEntryAccountFixture(db *sqlite3_db.Db) fixture.EntryAccountFixture {
+	return fixture.EntryAccountFixture{Doer: sqlite3_db.NewDoer(db)}
+}
+
+func closeDb(t *testing.T, db *sqlite3_db.Db) {
+	err := db.Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec("drop schema " + kTestSchema + " cascade")
+		return err
+	})
+	if err != nil {
+		t.Errorf("Error dropping schema: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Error closing database: %v", err)
+	}
+}
+
+func openDb(t *testing.T) *sqlite3_db.Db {
+	dsn := os.Getenv(kDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", kDSNEnv)
+	}
+	if !slices.Contains(sql.Drivers(), "postgres") {
+		t.Skip("postgres driver not linked in; run tests with -tags postgres")
+	}
+	rawdb, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	// search_path is per connection, so use just one connection.
+	rawdb.SetMaxOpenConns(1)
+	_, err = rawdb.Exec(fmt.Sprintf(
+		"drop schema if exists %[1]s cascade; create schema %[1]s; set search_path to %[1]s",
+		kTestSchema))
+	if err != nil {
+		t.Fatalf("Error creating schema: %v", err)
+	}
+	db := sqlite3_db.New(rawdb)
+	err = db.Do(postgres_setup.SetUpTables)
+	if err != nil {
+		t.Fatalf("Error creating tables: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,335 @@
+package for_sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	"github.com/keep94/toolbox/db/sqlite3_rw"
+)
+
+const (
+	kSQLFixAccountTotals = "update accounts set balance = ?, reconciled = ?, b_count = ?, r_count = ? where id = ?"
+	kSQLAllEntryItems    = "select entry_id, cat_type, cat_id, amount, reconciled, is_payment from entry_items"
+	kSQLAllEntryTags     = "select entry_id, tag from entry_tags order by entry_id, tag"
+)
+
+// AccountProblem is an account whose stored totals do not match its
+// entries.
+type AccountProblem struct {
+	// The account as stored
+	Account fin.Account
+
+	// The totals computed from the entries of the account
+	Balance  int64
+	RBalance int64
+	Count    int
+	RCount   int
+}
+
+func (p *AccountProblem) String() string {
+	return fmt.Sprintf(
+		"account %d (%s): stored balance %d, reconciled %d, count %d, reconciled count %d; entries give %d, %d, %d, %d",
+		p.Account.Id,
+		p.Account.Name,
+		p.Account.Balance,
+		p.Account.RBalance,
+		p.Account.Count,
+		p.Account.RCount,
+		p.Balance,
+		p.RBalance,
+		p.Count,
+		p.RCount)
+}
+
+// EntryProblem is an entry that cannot be read, that refers to a
+// category or account that does not exist, or whose rows in entry_items
+// or entry_tags do not match it.
+type EntryProblem struct {
+	// The id of the entry
+	Id int64
+
+	// What is wrong with the entry
+	Message string
+
+	// True if the entry cannot be read at all
+	Malformed bool
+
+	// True if the rows in entry_items or entry_tags do not match the
+	// entry
+	BadItems bool
+}
+
+func (p *EntryProblem) String() string {
+	return fmt.Sprintf("entry %d: %s", p.Id, p.Message)
+}
+
+// CheckResult is what Check finds.
+type CheckResult struct {
+	// Accounts in ascending order by id
+	Accounts []AccountProblem
+
+	// Entries from most to least recent followed by rows in entry_items
+	// or entry_tags for entries that do not exist
+	Entries []EntryProblem
+}
+
+// HasMalformedEntries returns true if some entries cannot be read. Totals
+// that Check computes leave these entries out.
+func (c *CheckResult) HasMalformedEntries() bool {
+	for i := range c.Entries {
+		if c.Entries[i].Malformed {
+			return true
+		}
+	}
+	return false
+}
+
+// HasBadItems returns true if some entries have rows in entry_items or
+// entry_tags that do not match them.
+func (c *CheckResult) HasBadItems() bool {
+	for i := range c.Entries {
+		if c.Entries[i].BadItems {
+			return true
+		}
+	}
+	return false
+}
+
+// Check recomputes the totals of every account from the entries and
+// checks that every entry can be read, refers only to categories and
+// accounts in cds, and matches its rows in entry_items and entry_tags.
+func (s Store) Check(
+	t db.Transaction, cds categories.CatDetailStore) (
+	result *CheckResult, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		result, err = check(tx, cds)
+		return
+	})
+	return
+}
+
+// FixAccounts stores the totals computed from the entries in each account
+// in problems.
+func (s Store) FixAccounts(t db.Transaction, problems []AccountProblem) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return fixAccounts(tx, problems)
+	})
+}
+
+// FixItems rebuilds the rows in entry_items and entry_tags of each entry
+// in problems with BadItems set from the entry itself.
+func (s Store) FixItems(t db.Transaction, problems []EntryProblem) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return fixItems(tx, problems)
+	})
+}
+
+func check(tx *sql.Tx, cds categories.CatDetailStore) (
+	*CheckResult, error) {
+	result := &CheckResult{}
+	deltas := make(fin.AccountDeltas)
+	items, err := allEntryItems(tx)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := allEntryTags(tx)
+	if err != nil {
+		return nil, err
+	}
+	dbrows, err := tx.Query(kSQLEntries)
+	if err != nil {
+		return nil, err
+	}
+	defer dbrows.Close()
+	for dbrows.Next() {
+		r := (&rawEntry{}).init(&fin.Entry{})
+		if err = dbrows.Scan(r.Ptrs()...); err != nil {
+			return nil, err
+		}
+		stored, ok := items[r.Id]
+		delete(items, r.Id)
+		storedTags := tags[r.Id]
+		delete(tags, r.Id)
+		if err = r.Unmarshall(); err != nil {
+			result.Entries = append(result.Entries, EntryProblem{
+				Id: r.Id, Message: err.Error(), Malformed: true})
+			continue
+		}
+		deltas.Include(&r.CatPayment)
+		for _, cr := range r.CatRecs() {
+			if !cds.Exists(cr.Cat) {
+				result.Entries = append(result.Entries, EntryProblem{
+					Id: r.Id, Message: fmt.Sprintf("No such category %v", cr.Cat)})
+			}
+		}
+		payment := fin.Cat{Id: r.PaymentId(), Type: fin.AccountCat}
+		if !cds.Exists(payment) {
+			result.Entries = append(result.Entries, EntryProblem{
+				Id: r.Id, Message: fmt.Sprintf("No such payment account %v", payment)})
+		}
+		if !ok || !sameItems(stored, entryItems(r.Entry)) {
+			result.Entries = append(result.Entries, EntryProblem{
+				Id: r.Id, Message: "entry_items do not match entry", BadItems: true})
+		}
+		if !slices.Equal(storedTags, entryTags(r.Entry)) {
+			result.Entries = append(result.Entries, EntryProblem{
+				Id: r.Id, Message: "entry_tags do not match entry", BadItems: true})
+		}
+	}
+	if err = dbrows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range slices.Sorted(maps.Keys(items)) {
+		result.Entries = append(result.Entries, EntryProblem{
+			Id: id, Message: "entry_items has rows for missing entry", BadItems: true})
+	}
+	for _, id := range slices.Sorted(maps.Keys(tags)) {
+		if _, ok := items[id]; ok {
+			// Already reported
+			continue
+		}
+		result.Entries = append(result.Entries, EntryProblem{
+			Id: id, Message: "entry_tags has rows for missing entry", BadItems: true})
+	}
+	var accounts []fin.Account
+	err = sqlite3_rw.ReadMultiple[fin.Account](
+		tx,
+		(&rawAccount{}).init(&fin.Account{}),
+		consume2.AppendTo(&accounts),
+		kSQLAccounts+" order by id")
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		var delta fin.AccountDelta
+		if d := deltas[account.Id]; d != nil {
+			delta = *d
+		}
+		if account.Balance != delta.Balance ||
+			account.RBalance != delta.RBalance ||
+			account.Count != delta.Count ||
+			account.RCount != delta.RCount {
+			result.Accounts = append(result.Accounts, AccountProblem{
+				Account:  account,
+				Balance:  delta.Balance,
+				RBalance: delta.RBalance,
+				Count:    delta.Count,
+				RCount:   delta.RCount})
+		}
+	}
+	return result, nil
+}
+
+func fixAccounts(tx *sql.Tx, problems []AccountProblem) error {
+	for i := range problems {
+		p := &problems[i]
+		_, err := tx.Exec(
+			kSQLFixAccountTotals,
+			p.Balance,
+			p.RBalance,
+			p.Count,
+			p.RCount,
+			p.Account.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fixItems(tx *sql.Tx, problems []EntryProblem) error {
+	var entry fin.Entry
+	for i := range problems {
+		if !problems[i].BadItems {
+			continue
+		}
+		id := problems[i].Id
+		err := entryById(tx, id, &entry)
+		if err == findb.NoSuchId {
+			err = removeEntryItems(tx, id)
+			if err == nil {
+				err = removeEntryTags(tx, id)
+			}
+		} else if err == nil {
+			err = writeEntryItems(tx, &entry)
+			if err == nil {
+				err = writeEntryTags(tx, &entry)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allEntryItems returns the rows in entry_items by entry id.
+func allEntryItems(tx *sql.Tx) (map[int64][]entryItem, error) {
+	dbrows, err := tx.Query(kSQLAllEntryItems)
+	if err != nil {
+		return nil, err
+	}
+	defer dbrows.Close()
+	result := make(map[int64][]entryItem)
+	for dbrows.Next() {
+		var entryId int64
+		var item entryItem
+		err := dbrows.Scan(
+			&entryId,
+			&item.catType,
+			&item.catId,
+			&item.amount,
+			&item.reconciled,
+			&item.isPayment)
+		if err != nil {
+			return nil, err
+		}
+		result[entryId] = append(result[entryId], item)
+	}
+	return result, dbrows.Err()
+}
+
+// allEntryTags returns the sorted tags in entry_tags by entry id.
+func allEntryTags(tx *sql.Tx) (map[int64][]string, error) {
+	dbrows, err := tx.Query(kSQLAllEntryTags)
+	if err != nil {
+		return nil, err
+	}
+	defer dbrows.Close()
+	result := make(map[int64][]string)
+	for dbrows.Next() {
+		var entryId int64
+		var tag string
+		if err := dbrows.Scan(&entryId, &tag); err != nil {
+			return nil, err
+		}
+		result[entryId] = append(result[entryId], tag)
+	}
+	return result, dbrows.Err()
+}
+
+// sameItems returns true if x and y have the same rows in any order.
+func sameItems(x, y []entryItem) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	counts := make(map[entryItem]int)
+	for _, item := range x {
+		counts[item]++
+	}
+	for _, item := range y {
+		if counts[item] == 0 {
+			return false
+		}
+		counts[item]--
+	}
+	return true
+}
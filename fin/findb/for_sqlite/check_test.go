@@ -0,0 +1,160 @@
+package for_sqlite
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	assert := assert.New(t)
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := New(db)
+	cdsb := categories.CatDetailStoreBuilder{}
+	for _, name := range []string{"checking", "savings"} {
+		account := fin.Account{Name: name, Active: true}
+		if err := store.AddAccount(nil, &account); err != nil {
+			t.Fatalf("Error adding account: %v", err)
+		}
+		cdsb.AddAccount(&account)
+	}
+	cdsb.AddCatDbRow(
+		fin.ExpenseCat, &categories.CatDbRow{Id: 7, Name: "food", Active: true})
+	cds := cdsb.Build()
+	entry1 := fin.Entry{
+		Date:       date_util.YMD(2012, 10, 15),
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 300, true, 1)}
+	entry2 := fin.Entry{
+		Date:       date_util.YMD(2012, 10, 16),
+		CatPayment: fin.NewCatPayment(fin.NewCat("2:2"), 1000, false, 1)}
+	entry3 := fin.Entry{
+		Date:       date_util.YMD(2012, 10, 17),
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:8"), 50, false, 2)}
+	err := store.DoEntryChanges(nil, &findb.EntryChanges{
+		Adds: []*fin.Entry{&entry1, &entry2, &entry3}})
+	if err != nil {
+		t.Fatalf("Error adding entries: %v", err)
+	}
+	result, err := store.Check(nil, cds)
+	if err != nil {
+		t.Fatalf("Error checking: %v", err)
+	}
+	assert.Empty(result.Accounts)
+	assert.Equal(
+		[]EntryProblem{{Id: 3, Message: "No such category 0:8"}},
+		result.Entries)
+
+	err = db.Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec("update accounts set balance = 5, r_count = 3 where id = 1")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("update entries set payment = 'bad' where id = 3")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Error corrupting database: %v", err)
+	}
+	result, err = store.Check(nil, cds)
+	if err != nil {
+		t.Fatalf("Error checking: %v", err)
+	}
+	assert.True(result.HasMalformedEntries())
+	assert.Len(result.Entries, 1)
+	assert.Equal(int64(3), result.Entries[0].Id)
+	assert.Len(result.Accounts, 2)
+	assert.Equal(int64(1), result.Accounts[0].Account.Id)
+	assert.Equal(int64(-1300), result.Accounts[0].Balance)
+	assert.Equal(int64(-300), result.Accounts[0].RBalance)
+	assert.Equal(2, result.Accounts[0].Count)
+	assert.Equal(1, result.Accounts[0].RCount)
+	// The totals of account 2 leave out entry 3 which can no longer be read.
+	assert.Equal(int64(2), result.Accounts[1].Account.Id)
+	assert.Equal(int64(1000), result.Accounts[1].Balance)
+
+	if err = store.FixAccounts(nil, result.Accounts[:1]); err != nil {
+		t.Fatalf("Error fixing accounts: %v", err)
+	}
+	var account fin.Account
+	if err = store.AccountById(nil, 1, &account); err != nil {
+		t.Fatalf("Error reading account: %v", err)
+	}
+	assert.Equal(int64(-1300), account.Balance)
+	assert.Equal(1, account.RCount)
+}
+
+func TestCheckItems(t *testing.T) {
+	assert := assert.New(t)
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := New(db)
+	cdsb := categories.CatDetailStoreBuilder{}
+	account := fin.Account{Name: "checking", Active: true}
+	if err := store.AddAccount(nil, &account); err != nil {
+		t.Fatalf("Error adding account: %v", err)
+	}
+	cdsb.AddAccount(&account)
+	cdsb.AddCatDbRow(
+		fin.ExpenseCat, &categories.CatDbRow{Id: 7, Name: "food", Active: true})
+	cds := cdsb.Build()
+	entry1 := fin.Entry{
+		Date:       date_util.YMD(2012, 10, 15),
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 300, true, 1)}
+	entry2 := fin.Entry{
+		Date:       date_util.YMD(2012, 10, 16),
+		Tags:       []string{"kids"},
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 1000, false, 1)}
+	err := store.DoEntryChanges(nil, &findb.EntryChanges{
+		Adds: []*fin.Entry{&entry1, &entry2}})
+	if err != nil {
+		t.Fatalf("Error adding entries: %v", err)
+	}
+	err = db.Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec("update entry_items set amount = 400 where entry_id = 1 and is_payment = 0")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("insert into entry_items (entry_id, cat_type, cat_id, amount, reconciled, is_payment) values (99, 0, 7, 5, 0, 0)")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("delete from entry_tags where entry_id = 2")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("insert into entry_tags (entry_id, tag) values (98, 'kids')")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Error corrupting database: %v", err)
+	}
+	result, err := store.Check(nil, cds)
+	if err != nil {
+		t.Fatalf("Error checking: %v", err)
+	}
+	assert.Empty(result.Accounts)
+	assert.True(result.HasBadItems())
+	assert.Equal(
+		[]EntryProblem{
+			{Id: 2, Message: "entry_tags do not match entry", BadItems: true},
+			{Id: 1, Message: "entry_items do not match entry", BadItems: true},
+			{Id: 99, Message: "entry_items has rows for missing entry", BadItems: true},
+			{Id: 98, Message: "entry_tags has rows for missing entry", BadItems: true},
+		},
+		result.Entries)
+
+	if err = store.FixItems(nil, result.Entries); err != nil {
+		t.Fatalf("Error fixing entry items: %v", err)
+	}
+	result, err = store.Check(nil, cds)
+	if err != nil {
+		t.Fatalf("Error checking: %v", err)
+	}
+	assert.Empty(result.Entries)
+}
@@ -3,58 +3,120 @@ package for_sqlite
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/keep94/consume2"
 	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/filters"
 	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/db"
 	"github.com/keep94/toolbox/db/sqlite3_db"
 	"github.com/keep94/toolbox/db/sqlite3_rw"
 	"github.com/keep94/toolbox/passwords"
+	"github.com/keep94/toolbox/str_util"
 )
 
 const (
-	kSQLEntryById                = "select id, date, name, desc, check_no, cats, payment, reviewed from entries where id = ?"
-	kSQLEntriesPrefix            = "select id, date, name, desc, check_no, cats, payment, reviewed from entries"
-	kSQLEntries                  = "select id, date, name, desc, check_no, cats, payment, reviewed from entries order by date desc, id desc"
-	kSQLEntryOrderBy             = " order by date desc, id desc"
-	kSQLInsertEntry              = "insert into entries (date, name, desc, check_no, cats, payment, reviewed) values (?, ?, ?, ?, ?, ?, ?)"
-	kSQLUpdateEntry              = "update entries set date = ?, name = ?, desc = ?, check_no = ?, cats = ?, payment = ?, reviewed = ? where id = ?"
-	kSQLDeleteEntryById          = "delete from entries where id = ?"
-	kSQLRecurringEntryById       = "select id, date, name, desc, check_no, cats, payment, reviewed, count, unit, num_left, day_of_month from recurring_entries where id = ?"
-	kSQLRecurringEntries         = "select id, date, name, desc, check_no, cats, payment, reviewed, count, unit, num_left, day_of_month from recurring_entries order by date, id"
-	kSQLInsertRecurringEntry     = "insert into recurring_entries (date, name, desc, check_no, cats, payment, reviewed, count, unit, num_left, day_of_month) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
-	kSQLUpdateRecurringEntry     = "update recurring_entries set date = ?, name = ?, desc = ?, check_no = ?, cats = ?, payment = ?, reviewed = ?, count = ?, unit = ?, num_left = ?, day_of_month = ? where id = ?"
-	kSQLDeleteRecurringEntryById = "delete from recurring_entries where id = ?"
-	kSQLAccountById              = "select id, name, is_active, balance, reconciled, b_count, r_count, import_sd from accounts where id = ?"
-	kSQLAccounts                 = "select id, name, is_active, balance, reconciled, b_count, r_count, import_sd from accounts"
-	kSQLActiveAccounts           = "select id, name, is_active, balance, reconciled, b_count, r_count, import_sd from accounts where is_active = 1 order by name"
-	kSQLInsertAccount            = "insert into accounts (name, is_active, balance, reconciled, b_count, r_count, import_sd) values (?, ?, ?, ?, ?, ?, ?)"
-	kSQLUpdateAccountImportSD    = "update accounts set import_sd = ? where id = ?"
-	kSQLUpdateAccount            = "update accounts set name = ?, is_active = ?, balance = ?, reconciled = ?, b_count = ?, r_count = ?, import_sd = ? where id = ?"
-	kSQLRemoveAccount            = "delete from accounts where id = ?"
-	kSQLUserById                 = "select id, name, go_password, permission, last_login from users where id = ?"
-	kSQLUsers                    = "select id, name, go_password, permission, last_login from users order by name"
-	kSQLRemoveUserByName         = "delete from users where name = ?"
-	kSQLUserByName               = "select id, name, go_password, permission, last_login from users where name = ?"
-	kSQLInsertUser               = "insert into users (name, go_password, permission, last_login) values (?, ?, ?, ?)"
-	kSQLUpdateUser               = "update users set name = ?, go_password = ?, permission = ?, last_login = ? where id = ?"
-	kSQLAllocationsByYear        = "select expense_id, amount from allocations where year = ?"
-	kSQLAddAllocation            = "insert into allocations (year, expense_id, amount) values (?, ?, ?)"
-	kSQLRemoveAllocation         = "delete from allocations where year = ? and expense_id = ?"
+	kSQLEntryById                    = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags from entries where id = ?"
+	kSQLEntriesPrefix                = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags from entries"
+	kSQLEntries                      = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags from entries order by date desc, id desc"
+	kSQLEntryOrderBy                 = " order by date desc, id desc"
+	kSQLInsertEntry                  = "insert into entries (date, name, desc, check_no, cats, payment, rate, reviewed, tags) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	kSQLRestoreEntry                 = "insert into entries (date, name, desc, check_no, cats, payment, rate, reviewed, tags, id) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	kSQLUpdateEntry                  = "update entries set date = ?, name = ?, desc = ?, check_no = ?, cats = ?, payment = ?, rate = ?, reviewed = ?, tags = ? where id = ?"
+	kSQLDeleteEntryById              = "delete from entries where id = ?"
+	kSQLTrashEntry                   = "insert into trashed_entries (id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, trashed) select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, ? from entries where id = ?"
+	kSQLTrashedEntryById             = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, trashed from trashed_entries where id = ?"
+	kSQLTrashedEntries               = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, trashed from trashed_entries order by trashed desc, id desc"
+	kSQLRemoveTrashedEntry           = "delete from trashed_entries where id = ?"
+	kSQLRecurringEntryById           = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month from recurring_entries where id = ?"
+	kSQLRecurringEntries             = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month from recurring_entries order by date, id"
+	kSQLInsertRecurringEntry         = "insert into recurring_entries (date, name, desc, check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	kSQLUpdateRecurringEntry         = "update recurring_entries set date = ?, name = ?, desc = ?, check_no = ?, cats = ?, payment = ?, rate = ?, reviewed = ?, tags = ?, count = ?, unit = ?, num_left = ?, day_of_month = ? where id = ?"
+	kSQLDeleteRecurringEntryById     = "delete from recurring_entries where id = ?"
+	kSQLRestoreRecurringEntry        = "insert into recurring_entries (date, name, desc, check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, id) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	kSQLTrashRecurringEntry          = "insert into trashed_recurring_entries (id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, trashed) select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, ? from recurring_entries where id = ?"
+	kSQLTrashedRecurringEntryById    = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, trashed from trashed_recurring_entries where id = ?"
+	kSQLTrashedRecurringEntries      = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags, count, unit, num_left, day_of_month, trashed from trashed_recurring_entries order by trashed desc, id desc"
+	kSQLRemoveTrashedRecurringEntry  = "delete from trashed_recurring_entries where id = ?"
+	kSQLPurgeTrashedAttachments      = "delete from attachments where entry_id in (select id from trashed_entries where trashed < ?)"
+	kSQLPurgeTrashedEntries          = "delete from trashed_entries where trashed < ?"
+	kSQLPurgeTrashedRecurringEntries = "delete from trashed_recurring_entries where trashed < ?"
+	kSQLAccountById                  = "select id, name, is_active, balance, reconciled, b_count, r_count, import_sd, currency from accounts where id = ?"
+	kSQLAccounts                     = "select id, name, is_active, balance, reconciled, b_count, r_count, import_sd, currency from accounts"
+	kSQLActiveAccounts               = "select id, name, is_active, balance, reconciled, b_count, r_count, import_sd, currency from accounts where is_active = 1 order by name"
+	kSQLInsertAccount                = "insert into accounts (name, is_active, balance, reconciled, b_count, r_count, import_sd, currency) values (?, ?, ?, ?, ?, ?, ?, ?)"
+	kSQLUpdateAccountImportSD        = "update accounts set import_sd = ? where id = ?"
+	kSQLUpdateAccountCurrency        = "update accounts set currency = ? where id = ?"
+	kSQLUpdateAccount                = "update accounts set name = ?, is_active = ?, balance = ?, reconciled = ?, b_count = ?, r_count = ?, import_sd = ?, currency = ? where id = ?"
+	kSQLRemoveAccount                = "delete from accounts where id = ?"
+	kSQLUserById                     = "select id, name, go_password, permission, last_login from users where id = ?"
+	kSQLUsers                        = "select id, name, go_password, permission, last_login from users order by name"
+	kSQLRemoveUserByName             = "delete from users where name = ?"
+	kSQLUserByName                   = "select id, name, go_password, permission, last_login from users where name = ?"
+	kSQLInsertUser                   = "insert into users (name, go_password, permission, last_login) values (?, ?, ?, ?)"
+	kSQLUpdateUser                   = "update users set name = ?, go_password = ?, permission = ?, last_login = ? where id = ?"
+	kSQLAccessRulesByUserName        = "select id, user_name, cat from access_rules where user_name = ? order by id"
+	kSQLInsertAccessRule             = "insert into access_rules (user_name, cat) values (?, ?)"
+	kSQLRemoveAccessRule             = "delete from access_rules where id = ?"
+	kSQLRemoveAccessRulesByUserName  = "delete from access_rules where user_name = ?"
+	kSQLApiTokensByUserId            = "select id, user_id, name, hash, permission, book, account_ids, created, last_used from api_tokens where user_id = ? order by id"
+	kSQLApiTokenByHash               = "select id, user_id, name, hash, permission, book, account_ids, created, last_used from api_tokens where hash = ?"
+	kSQLInsertApiToken               = "insert into api_tokens (user_id, name, hash, permission, book, account_ids, created, last_used) values (?, ?, ?, ?, ?, ?, ?, ?)"
+	kSQLUpdateApiTokenLastUsed       = "update api_tokens set last_used = ? where id = ?"
+	kSQLRemoveApiToken               = "delete from api_tokens where id = ?"
+	kSQLRemoveApiTokensByUserName    = "delete from api_tokens where user_id in (select id from users where name = ?)"
+	kSQLAllocationsByYear            = "select expense_id, amount from allocations where year = ?"
+	kSQLAddAllocation                = "insert into allocations (year, expense_id, amount) values (?, ?, ?)"
+	kSQLRemoveAllocation             = "delete from allocations where year = ? and expense_id = ?"
+	kSQLAttachmentById               = "select id, entry_id, name, content_type, hash, size, added from attachments where id = ?"
+	kSQLAttachmentsByEntryId         = "select id, entry_id, name, content_type, hash, size, added from attachments where entry_id = ? order by added, id"
+	kSQLInsertAttachment             = "insert into attachments (entry_id, name, content_type, hash, size, added) values (?, ?, ?, ?, ?, ?)"
+	kSQLRemoveAttachment             = "delete from attachments where id = ?"
+	kSQLRemoveEntryAttachments       = "delete from attachments where entry_id = ?"
+	kSQLBlobByHash                   = "select contents from blobs where hash = ?"
+	kSQLEntryIdsByAttachmentHash     = "select distinct entry_id from attachments where hash = ?"
+	kSQLInsertBlob                   = "insert or ignore into blobs (hash, contents) values (?, ?)"
+	kSQLRemoveOrphanBlobs            = "delete from blobs where hash not in (select hash from attachments)"
+	kSQLEntryHistory                 = "select id, entry_id, change_id, user_id, time, old_entry, new_entry from entry_history where entry_id = ? order by id"
+	kSQLChangeEntries                = "select id, entry_id, change_id, user_id, time, old_entry, new_entry from entry_history where change_id = ? order by id"
+	kSQLInsertEntryHistory           = "insert into entry_history (entry_id, change_id, user_id, time, old_entry, new_entry) values (?, ?, ?, ?, ?, ?)"
+	kSQLInsertChangeSet              = "insert into change_sets (user_id, time, undoes) values (?, ?, ?)"
+	kSQLChangeSetById                = "select user_id, undoes, undone from change_sets where id = ?"
+	kSQLMarkChangeSetUndone          = "update change_sets set undone = 1 where id = ?"
+	kSQLRemoveChangeFitIds           = "delete from qfx_fitids where change_id = ?"
+	kSQLLastChangeId                 = "select id from change_sets where user_id = ? and undoes = 0 and undone = 0 order by id desc limit 1"
+	kSQLInsertEntryItem              = "insert into entry_items (entry_id, cat_type, cat_id, amount, reconciled, is_payment) values (?, ?, ?, ?, ?, ?)"
+	kSQLRemoveEntryItems             = "delete from entry_items where entry_id = ?"
+	kSQLInsertEntryTag               = "insert into entry_tags (entry_id, tag) values (?, ?)"
+	kSQLRemoveEntryTags              = "delete from entry_tags where entry_id = ?"
+	kSQLCatTotalsPrefix              = "select cat_type, cat_id, sum(amount) from entry_items where is_payment = 0 and cat_type != ?"
+	kSQLCatTotalsGroupBy             = " group by cat_type, cat_id"
+	kSQLHasSearchIndex               = "select count(*) from sqlite_master where type = 'table' and name = 'entries_fts'"
+	kSQLSearchEntriesPrefix          = "select id, date, name, desc, check_no, cats, payment, rate, reviewed, tags from entries join (select rowid as fts_id, rank as fts_rank from entries_fts where entries_fts match ?) on id = fts_id"
+	kSQLSearchEntriesOrderBy         = " order by fts_rank, date desc, id desc"
+	kSQLInsertSearchEntry            = `insert into entries_fts (rowid, name, "desc", check_no) values (?, ?, ?, ?)`
+	kSQLRemoveSearchEntry            = "delete from entries_fts where rowid = ?"
+)
+
+var (
+	kLikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
 )
 
 func New(db *sqlite3_db.Db) Store {
-	return Store{db}
+	return Store{db: db}
 }
 
 func ConnNew(tx *sql.Tx) Store {
-	return Store{sqlite3_db.NewSqlite3Doer(tx)}
+	return Store{db: sqlite3_db.NewSqlite3Doer(tx)}
 }
 
 func ReadOnlyWrapper(store Store) ReadOnlyStore {
@@ -62,40 +124,62 @@ func ReadOnlyWrapper(store Store) ReadOnlyStore {
 }
 
 func entries(tx *sql.Tx, options *findb.EntryListOptions, consumer consume2.Consumer[fin.Entry]) error {
-	var sql string
-	if options != nil {
-		where_clauses := make([]string, 3)
-		where_clause_count := 0
-		if options.Start != nil {
-			where_clauses[where_clause_count] = "date >= ?"
-			where_clause_count++
-		}
-		if options.End != nil {
-			where_clauses[where_clause_count] = "date < ?"
-			where_clause_count++
-		}
-		if options.Unreviewed {
-			where_clauses[where_clause_count] = "reviewed != 1"
-			where_clause_count++
-		}
-		if where_clause_count > 0 {
-			sql = kSQLEntriesPrefix + " where " + strings.Join(where_clauses[:where_clause_count], " and ") + kSQLEntryOrderBy
-		} else {
-			sql = kSQLEntriesPrefix + kSQLEntryOrderBy
-		}
-	} else {
-		sql = kSQLEntriesPrefix + kSQLEntryOrderBy
+	return readEntries(
+		tx, kSQLEntriesPrefix, nil, kSQLEntryOrderBy, options, consumer)
+}
+
+func searchEntries(
+	tx *sql.Tx,
+	query string,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	ok, err := hasSearchIndex(tx)
+	if err != nil {
+		return err
 	}
-	sql_params := make([]interface{}, 0, 2)
-	if options != nil {
-		if options.Start != nil {
-			sql_params = append(
-				sql_params, sqlite3_db.DateToString(*options.Start))
-		}
-		if options.End != nil {
-			sql_params = append(
-				sql_params, sqlite3_db.DateToString(*options.End))
-		}
+	if !ok {
+		return findb.NoSearchIndex
+	}
+	match := ftsQuery(findb.ParseSearchQuery(query))
+	if match == "" {
+		return nil
+	}
+	return readEntries(
+		tx,
+		kSQLSearchEntriesPrefix,
+		[]interface{}{match},
+		kSQLSearchEntriesOrderBy,
+		options,
+		consumer)
+}
+
+// readEntries reads the entries that options selects from the query
+// made up of prefix, which has params, followed by the where clause for
+// options and then orderBy.
+func readEntries(
+	tx *sql.Tx,
+	prefix string,
+	params []interface{},
+	orderBy string,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	sql := prefix
+	where, where_params := entriesWhereClause(options)
+	if where != "" {
+		sql += " where " + where
+	}
+	sql += orderBy
+	sql_params := append(params, where_params...)
+	if options != nil && options.Limit > 0 {
+		consumer = consume2.Slice(consumer, 0, options.Limit)
+	}
+	// The where clause only narrows down name and description matches,
+	// so finish checking those here before applying any limit.
+	if filter := nameDescFilter(options); filter != nil {
+		consumer = consume2.Filterp(consumer, filter)
+	} else if options != nil && options.Limit > 0 {
+		sql += " limit ?"
+		sql_params = append(sql_params, options.Limit)
 	}
 	dbrows, err := tx.Query(sql, sql_params...)
 	if err != nil {
@@ -114,6 +198,313 @@ func entries(tx *sql.Tx, options *findb.EntryListOptions, consumer consume2.Cons
 		consumer)
 }
 
+// ftsQuery converts query to an FTS5 query. Each term becomes an FTS5
+// string so that nothing the user types can be read as FTS5 syntax.
+func ftsQuery(query findb.SearchQuery) string {
+	clauses := make([]string, len(query))
+	for i, clause := range query {
+		terms := make([]string, len(clause))
+		for j, term := range clause {
+			terms[j] = `"` + strings.Join(term.Words, " ") + `"`
+			if term.Prefix {
+				terms[j] += "*"
+			}
+		}
+		clauses[i] = strings.Join(terms, " OR ")
+		if len(terms) > 1 {
+			clauses[i] = "(" + clauses[i] + ")"
+		}
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+// hasSearchIndex returns true if the database has the full text index.
+// Databases set up with a sqlite that lacks FTS5 do not.
+func hasSearchIndex(tx *sql.Tx) (bool, error) {
+	var count int
+	err := tx.QueryRow(kSQLHasSearchIndex).Scan(&count)
+	return count > 0, err
+}
+
+// indexEntry adds entry to the full text index replacing what was there.
+func indexEntry(tx *sql.Tx, entry *fin.Entry) error {
+	if err := unindexEntry(tx, entry.Id); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		kSQLInsertSearchEntry, entry.Id, entry.Name, entry.Desc, entry.CheckNo)
+	return err
+}
+
+func unindexEntry(tx *sql.Tx, id int64) error {
+	_, err := tx.Exec(kSQLRemoveSearchEntry, id)
+	return err
+}
+
+// entriesWhereClause returns the conditions on the entries table that
+// select what options asks for along with their parameters. If options
+// selects all entries, entriesWhereClause returns the empty string.
+func entriesWhereClause(options *findb.EntryListOptions) (
+	string, []interface{}) {
+	if options == nil {
+		return "", nil
+	}
+	var where_clauses []string
+	var sql_params []interface{}
+	if options.Start != nil {
+		where_clauses = append(where_clauses, "date >= ?")
+		sql_params = append(
+			sql_params, sqlite3_db.DateToString(*options.Start))
+	}
+	if options.End != nil {
+		where_clauses = append(where_clauses, "date < ?")
+		sql_params = append(
+			sql_params, sqlite3_db.DateToString(*options.End))
+	}
+	if options.Unreviewed {
+		where_clauses = append(where_clauses, "reviewed != 1")
+	}
+	if options.AccountId != 0 {
+		clause := "id in (select entry_id from entry_items where cat_type = ? and cat_id = ?)"
+		if options.Unreconciled {
+			clause = "id in (select entry_id from entry_items where cat_type = ? and cat_id = ? and reconciled = 0)"
+		}
+		where_clauses = append(where_clauses, clause)
+		sql_params = append(sql_params, fin.AccountCat, options.AccountId)
+	}
+	if options.After != nil {
+		// Matches the order of entries_date_id_idx.
+		where_clauses = append(where_clauses, "(date, id) < (?, ?)")
+		sql_params = append(
+			sql_params,
+			sqlite3_db.DateToString(options.After.Date),
+			options.After.Id)
+	}
+	if len(options.Cats) > 0 {
+		clause, params := catsClause(options.Cats)
+		where_clauses = append(
+			where_clauses,
+			"id in (select entry_id from entry_items where is_payment = 0 and ("+clause+"))")
+		sql_params = append(sql_params, params...)
+	}
+	if tag := strings.ToLower(strings.TrimSpace(options.Tag)); tag != "" {
+		where_clauses = append(
+			where_clauses,
+			"id in (select entry_id from entry_tags where tag = ?)")
+		sql_params = append(sql_params, tag)
+	}
+	if options.MinTotal != nil {
+		where_clauses = append(
+			where_clauses,
+			"id in (select entry_id from entry_items where is_payment = 1 and amount >= ?)")
+		sql_params = append(sql_params, *options.MinTotal)
+	}
+	if options.MaxTotal != nil {
+		where_clauses = append(
+			where_clauses,
+			"id in (select entry_id from entry_items where is_payment = 1 and amount <= ?)")
+		sql_params = append(sql_params, *options.MaxTotal)
+	}
+	for _, column := range []struct {
+		name  string
+		value string
+	}{{"name", options.Name}, {`"desc"`, options.Desc}} {
+		if column.value == "" {
+			continue
+		}
+		if clause, params := likeWords(column.name, column.value); clause != "" {
+			where_clauses = append(where_clauses, clause)
+			sql_params = append(sql_params, params...)
+		}
+	}
+	return strings.Join(where_clauses, " and "), sql_params
+}
+
+// nameDescFilter returns the filter for the Name and Desc criteria of
+// options or nil if there are none.
+func nameDescFilter(options *findb.EntryListOptions) func(ptr *fin.Entry) bool {
+	if options == nil || (options.Name == "" && options.Desc == "") {
+		return nil
+	}
+	return filters.CompileAdvanceSearchSpec(
+		&filters.AdvanceSearchSpec{Name: options.Name, Desc: options.Desc})
+}
+
+// likeWords returns a condition that column contains every word in the
+// normalized form of s. The condition may match more than the
+// normalized comparison does but never less.
+func likeWords(column, s string) (string, []interface{}) {
+	var clauses []string
+	var params []interface{}
+	for _, word := range strings.Fields(str_util.Normalize(s)) {
+		// like ignores case only for ASCII letters.
+		if !isASCII(word) {
+			continue
+		}
+		clauses = append(clauses, column+` like ? escape '\'`)
+		params = append(params, "%"+kLikeEscaper.Replace(word)+"%")
+	}
+	return strings.Join(clauses, " and "), params
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func catTotals(tx *sql.Tx, options *findb.EntryListOptions) (
+	fin.CatTotals, error) {
+	sql := kSQLCatTotalsPrefix
+	sql_params := []interface{}{fin.AccountCat}
+	where, where_params := entriesWhereClause(options)
+	if where != "" {
+		sql += " and entry_id in (select id from entries where " + where + ")"
+		sql_params = append(sql_params, where_params...)
+	}
+	sql += kSQLCatTotalsGroupBy
+	dbrows, err := tx.Query(sql, sql_params...)
+	if err != nil {
+		return nil, err
+	}
+	defer dbrows.Close()
+	result := make(fin.CatTotals)
+	for dbrows.Next() {
+		var cat fin.Cat
+		var total int64
+		if err := dbrows.Scan(&cat.Type, &cat.Id, &total); err != nil {
+			return nil, err
+		}
+		result[cat] = total
+	}
+	return result, dbrows.Err()
+}
+
+// catsClause returns a condition on entry_items that matches the
+// categories in cats.
+func catsClause(cats fin.CatSet) (string, []interface{}) {
+	idsByType := make(map[fin.CatType][]int64)
+	for cat := range cats {
+		idsByType[cat.Type] = append(idsByType[cat.Type], cat.Id)
+	}
+	var clauses []string
+	var params []interface{}
+	for _, catType := range slices.Sorted(maps.Keys(idsByType)) {
+		ids := idsByType[catType]
+		slices.Sort(ids)
+		clauses = append(
+			clauses,
+			"(cat_type = ? and cat_id in (?"+strings.Repeat(", ?", len(ids)-1)+"))")
+		params = append(params, catType)
+		for _, id := range ids {
+			params = append(params, id)
+		}
+	}
+	return strings.Join(clauses, " or "), params
+}
+
+// entryItem is a row in entry_items.
+//
+// The cats and payment columns of entries remain the record of each
+// entry. They keep the order of the CatRecs and are what every read
+// of an entry decodes. entry_items is an index derived from them so that
+// queries by category or account need not decode every entry. Every
+// write to entries rewrites the rows of the entry in entry_items in the
+// same transaction, and fsck checks that the two agree.
+type entryItem struct {
+	catType    fin.CatType
+	catId      int64
+	amount     int64
+	reconciled bool
+	isPayment  bool
+}
+
+// entryItems returns the rows that entry should have in entry_items.
+func entryItems(entry *fin.Entry) []entryItem {
+	var result []entryItem
+	for _, cr := range entry.CatRecs() {
+		result = append(result, entryItem{
+			catType:    cr.Cat.Type,
+			catId:      cr.Cat.Id,
+			amount:     cr.Amount,
+			reconciled: cr.Reconciled})
+	}
+	return append(result, entryItem{
+		catType:    fin.AccountCat,
+		catId:      entry.PaymentId(),
+		amount:     entry.Total(),
+		reconciled: entry.Reconciled(),
+		isPayment:  true})
+}
+
+// writeEntryItems replaces the rows for entry in entry_items.
+func writeEntryItems(tx *sql.Tx, entry *fin.Entry) error {
+	if err := removeEntryItems(tx, entry.Id); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(kSQLInsertEntryItem)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, item := range entryItems(entry) {
+		_, err = stmt.Exec(
+			entry.Id,
+			item.catType,
+			item.catId,
+			item.amount,
+			item.reconciled,
+			item.isPayment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeEntryItems(tx *sql.Tx, entryId int64) error {
+	_, err := tx.Exec(kSQLRemoveEntryItems, entryId)
+	return err
+}
+
+// entryTags returns the rows that entry should have in entry_tags. Like
+// entry_items, entry_tags is an index derived from the tags column of
+// entries so that queries by tag need not decode every entry. The rows
+// hold the tags as reading the entry back would return them.
+func entryTags(entry *fin.Entry) []string {
+	return fin.ParseTags(strings.Join(entry.Tags, "|"))
+}
+
+// writeEntryTags replaces the rows for entry in entry_tags.
+func writeEntryTags(tx *sql.Tx, entry *fin.Entry) error {
+	if err := removeEntryTags(tx, entry.Id); err != nil {
+		return err
+	}
+	tags := entryTags(entry)
+	if len(tags) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(kSQLInsertEntryTag)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, tag := range tags {
+		if _, err = stmt.Exec(entry.Id, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeEntryTags(tx *sql.Tx, entryId int64) error {
+	_, err := tx.Exec(kSQLRemoveEntryTags, entryId)
+	return err
+}
+
 func entryById(tx *sql.Tx, id int64, entry *fin.Entry) error {
 	stmt, err := tx.Prepare(kSQLEntryById)
 	if err != nil {
@@ -132,11 +523,37 @@ func _entryById(stmt *sql.Stmt, r *rawEntry, id int64) error {
 	return sqlite3_rw.FirstOnly(r, dbrows, findb.NoSuchId)
 }
 
-func doEntryChanges(tx *sql.Tx, changes *findb.EntryChanges) error {
+// changeSetInfo describes a change set that doEntryChanges records.
+type changeSetInfo struct {
+	// The user making the changes
+	userId int64
+	// The id of the change set being undone or 0 if not an undo. Entries
+	// that an undo deletes skip the trash.
+	undoes int64
+	// True if the changes bring entries back from the trash.
+	restores bool
+	// When the changes happen
+	now time.Time
+}
+
+// keepsIds returns true if added entries come back under their original
+// ids. Both undos and restores bring back entries that were deleted.
+func (c changeSetInfo) keepsIds() bool {
+	return c.undoes != 0 || c.restores
+}
+
+func doEntryChanges(
+	tx *sql.Tx, changes *findb.EntryChanges, info changeSetInfo) error {
 	row := (&rawEntry{}).init(&fin.Entry{})
-	var err error
+	var history []rawEntryHistory
 	var deltas fin.AccountDeltas = make(map[int64]*fin.AccountDelta)
 	var getStmt, addStmt, deleteStmt, updateStmt *sql.Stmt
+	var removesAttachments bool
+	now := info.now
+	indexed, err := hasSearchIndex(tx)
+	if err != nil {
+		return err
+	}
 	if len(changes.Updates) > 0 || len(changes.Deletes) > 0 {
 		getStmt, err = tx.Prepare(kSQLEntryById)
 		if err != nil {
@@ -145,7 +562,11 @@ func doEntryChanges(tx *sql.Tx, changes *findb.EntryChanges) error {
 		defer getStmt.Close()
 	}
 	if len(changes.Adds) > 0 {
-		addStmt, err = tx.Prepare(kSQLInsertEntry)
+		if info.keepsIds() {
+			addStmt, err = tx.Prepare(kSQLRestoreEntry)
+		} else {
+			addStmt, err = tx.Prepare(kSQLInsertEntry)
+		}
 		if err != nil {
 			return err
 		}
@@ -173,11 +594,39 @@ func doEntryChanges(tx *sql.Tx, changes *findb.EntryChanges) error {
 		if err != nil {
 			return err
 		}
+		var h rawEntryHistory
+		if err = h.setOld(row.Entry); err != nil {
+			return err
+		}
+		history = append(history, h)
 		deltas.Exclude(&row.CatPayment)
+		if info.undoes != 0 {
+			// Undoing an add removes the entry for good.
+			if _, err = tx.Exec(kSQLRemoveEntryAttachments, id); err != nil {
+				return err
+			}
+			removesAttachments = true
+		} else {
+			// Attachments stay with the trashed entry until it is purged.
+			if _, err = tx.Exec(kSQLTrashEntry, now.Unix(), id); err != nil {
+				return err
+			}
+		}
 		_, err = deleteStmt.Exec(id)
 		if err != nil {
 			return err
 		}
+		if err = removeEntryItems(tx, id); err != nil {
+			return err
+		}
+		if err = removeEntryTags(tx, id); err != nil {
+			return err
+		}
+		if indexed {
+			if err = unindexEntry(tx, id); err != nil {
+				return err
+			}
+		}
 	}
 	for id, update := range changes.Updates {
 		err = _entryById(getStmt, row, id)
@@ -198,6 +647,10 @@ func doEntryChanges(tx *sql.Tx, changes *findb.EntryChanges) error {
 			}
 		}
 		old_cat_payment := row.CatPayment
+		var h rawEntryHistory
+		if err = h.setOld(row.Entry); err != nil {
+			return err
+		}
 		if !update(row.Entry) {
 			continue
 		}
@@ -215,16 +668,63 @@ func doEntryChanges(tx *sql.Tx, changes *findb.EntryChanges) error {
 		if err != nil {
 			return err
 		}
+		if err = writeEntryItems(tx, row.Entry); err != nil {
+			return err
+		}
+		if err = writeEntryTags(tx, row.Entry); err != nil {
+			return err
+		}
+		if indexed {
+			if err = indexEntry(tx, row.Entry); err != nil {
+				return err
+			}
+		}
+		if err = h.setNew(row.Entry); err != nil {
+			return err
+		}
+		history = append(history, h)
 	}
 	for _, entry := range changes.Adds {
 		row.init(entry)
 		deltas.Include(&entry.CatPayment)
-		err = addEntry(addStmt, row)
+		if info.keepsIds() {
+			err = restoreEntry(addStmt, row)
+			if err == nil {
+				_, err = tx.Exec(kSQLRemoveTrashedEntry, entry.Id)
+			}
+		} else {
+			err = addEntry(addStmt, row)
+		}
 		if err != nil {
 			return err
 		}
+		if err = writeEntryItems(tx, entry); err != nil {
+			return err
+		}
+		if err = writeEntryTags(tx, entry); err != nil {
+			return err
+		}
+		if indexed {
+			if err = indexEntry(tx, entry); err != nil {
+				return err
+			}
+		}
+		var h rawEntryHistory
+		if err = h.setNew(entry); err != nil {
+			return err
+		}
+		history = append(history, h)
 	}
-	return recordAccountDeltas(tx, deltas)
+	if removesAttachments {
+		if _, err = tx.Exec(kSQLRemoveOrphanBlobs); err != nil {
+			return err
+		}
+	}
+	if err = recordAccountDeltas(tx, deltas); err != nil {
+		return err
+	}
+	changes.ChangeId, err = recordEntryHistory(tx, history, info, now)
+	return err
 }
 
 func activeAccounts(tx *sql.Tx) (accounts []*fin.Account, err error) {
@@ -241,6 +741,12 @@ func updateAccountImportSD(tx *sql.Tx, acctId int64, date time.Time) error {
 	return err
 }
 
+func updateAccountCurrency(
+	tx *sql.Tx, acctId int64, currency fin.Currency) error {
+	_, err := tx.Exec(kSQLUpdateAccountCurrency, string(currency), acctId)
+	return err
+}
+
 func addEntry(stmt *sql.Stmt, r *rawEntry) error {
 	values, err := sqlite3_rw.InsertValues(r)
 	if err != nil {
@@ -254,6 +760,15 @@ func addEntry(stmt *sql.Stmt, r *rawEntry) error {
 	return err
 }
 
+func restoreEntry(stmt *sql.Stmt, r *rawEntry) error {
+	values, err := sqlite3_rw.UpdateValues(r)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(values...)
+	return err
+}
+
 func recordAccountDeltas(tx *sql.Tx, deltas fin.AccountDeltas) error {
 	for id, delta := range deltas {
 		_, err := tx.Exec("update accounts set balance = balance + ?, reconciled = reconciled + ?, b_count = b_count + ?, r_count = r_count + ? where id = ?", delta.Balance, delta.RBalance, delta.Count, delta.RCount, id)
@@ -264,12 +779,232 @@ func recordAccountDeltas(tx *sql.Tx, deltas fin.AccountDeltas) error {
 	return nil
 }
 
+func recordEntryHistory(
+	tx *sql.Tx,
+	history []rawEntryHistory,
+	info changeSetInfo,
+	now time.Time) (int64, error) {
+	if len(history) == 0 {
+		return 0, nil
+	}
+	result, err := tx.Exec(
+		kSQLInsertChangeSet, info.userId, now.Unix(), info.undoes)
+	if err != nil {
+		return 0, err
+	}
+	changeId, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(kSQLInsertEntryHistory)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, h := range history {
+		_, err = stmt.Exec(
+			h.entryId,
+			changeId,
+			info.userId,
+			now.Unix(),
+			h.oldEntry,
+			h.newEntry)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return changeId, nil
+}
+
+func undo(tx *sql.Tx, changeId, userId int64, now time.Time) error {
+	var owner, undoes int64
+	var undone bool
+	err := tx.QueryRow(kSQLChangeSetById, changeId).Scan(
+		&owner, &undoes, &undone)
+	if err == sql.ErrNoRows {
+		return findb.NoSuchId
+	}
+	if err != nil {
+		return err
+	}
+	if owner != userId {
+		return findb.NoPermission
+	}
+	if undoes != 0 || undone {
+		return findb.CannotUndo
+	}
+	var history []fin.EntryHistory
+	err = sqlite3_rw.ReadMultiple[fin.EntryHistory](
+		tx,
+		(&rawEntryHistory{}).init(&fin.EntryHistory{}),
+		consume2.AppendTo(&history),
+		kSQLChangeEntries,
+		changeId)
+	if err != nil {
+		return err
+	}
+	changes := findb.EntryChanges{
+		Updates: make(map[int64]fin.EntryUpdater)}
+	var current fin.Entry
+	for i := len(history) - 1; i >= 0; i-- {
+		h := &history[i]
+		if h.IsDelete() {
+			// Refuse to undo if the entry was restored since.
+			err := entryById(tx, h.EntryId, &current)
+			if err == nil {
+				return findb.ConcurrentUpdate
+			}
+			if err != findb.NoSuchId {
+				return err
+			}
+		} else {
+			// Refuse to undo if the entry changed since.
+			err := entryById(tx, h.EntryId, &current)
+			if err == findb.NoSuchId {
+				return findb.ConcurrentUpdate
+			}
+			if err != nil {
+				return err
+			}
+			same, err := sameEntry(&current, h.After)
+			if err != nil {
+				return err
+			}
+			if !same {
+				return findb.ConcurrentUpdate
+			}
+		}
+		switch {
+		case h.IsAdd():
+			changes.Deletes = append(changes.Deletes, h.EntryId)
+		case h.IsDelete():
+			changes.Adds = append(changes.Adds, h.Before)
+		default:
+			changes.Updates[h.EntryId] = revertTo(h.Before)
+		}
+	}
+	err = doEntryChanges(
+		tx, &changes, changeSetInfo{userId: userId, undoes: changeId, now: now})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(kSQLMarkChangeSetUndone, changeId); err != nil {
+		return err
+	}
+	// Let the entries that the change set imported be imported again.
+	_, err = tx.Exec(kSQLRemoveChangeFitIds, changeId)
+	return err
+}
+
+// sameEntry returns true if x and y have the same stored values.
+func sameEntry(x, y *fin.Entry) (bool, error) {
+	encodedX, err := encodeEntry(x)
+	if err != nil {
+		return false, err
+	}
+	encodedY, err := encodeEntry(y)
+	if err != nil {
+		return false, err
+	}
+	return encodedX == encodedY, nil
+}
+
+func revertTo(before *fin.Entry) fin.EntryUpdater {
+	return func(entry *fin.Entry) bool {
+		*entry = *before
+		return true
+	}
+}
+
+func lastChangeId(tx *sql.Tx, userId int64) (int64, error) {
+	var result int64
+	err := tx.QueryRow(kSQLLastChangeId, userId).Scan(&result)
+	if err == sql.ErrNoRows {
+		return 0, findb.NoSuchId
+	}
+	return result, err
+}
+
+func restoreTrashedEntry(
+	tx *sql.Tx, id, userId int64, now time.Time) error {
+	var trashed fin.TrashedEntry
+	err := sqlite3_rw.ReadSingle(
+		tx,
+		(&rawTrashedEntry{}).init(&trashed),
+		findb.NoSuchId,
+		kSQLTrashedEntryById,
+		id)
+	if err != nil {
+		return err
+	}
+	return doEntryChanges(
+		tx,
+		&findb.EntryChanges{Adds: []*fin.Entry{&trashed.Entry}},
+		changeSetInfo{userId: userId, restores: true, now: now})
+}
+
+func trashRecurringEntry(tx *sql.Tx, id int64, now time.Time) error {
+	if _, err := tx.Exec(kSQLTrashRecurringEntry, now.Unix(), id); err != nil {
+		return err
+	}
+	_, err := tx.Exec(kSQLDeleteRecurringEntryById, id)
+	return err
+}
+
+func restoreTrashedRecurringEntry(tx *sql.Tx, id int64) error {
+	var trashed fin.TrashedRecurringEntry
+	err := sqlite3_rw.ReadSingle(
+		tx,
+		(&rawTrashedRecurringEntry{}).init(&trashed),
+		findb.NoSuchId,
+		kSQLTrashedRecurringEntryById,
+		id)
+	if err != nil {
+		return err
+	}
+	values, err := sqlite3_rw.UpdateValues(
+		(&rawRecurringEntry{}).init(&trashed.RecurringEntry))
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(kSQLRestoreRecurringEntry, values...); err != nil {
+		return err
+	}
+	_, err = tx.Exec(kSQLRemoveTrashedRecurringEntry, id)
+	return err
+}
+
+func purgeTrash(tx *sql.Tx, before time.Time) (int, error) {
+	if _, err := tx.Exec(kSQLPurgeTrashedAttachments, before.Unix()); err != nil {
+		return 0, err
+	}
+	var total int
+	for _, statement := range []string{
+		kSQLPurgeTrashedEntries, kSQLPurgeTrashedRecurringEntries} {
+		result, err := tx.Exec(statement, before.Unix())
+		if err != nil {
+			return 0, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += int(count)
+	}
+	if _, err := tx.Exec(kSQLRemoveOrphanBlobs); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
 type rawEntry struct {
 	*fin.Entry
 	dateStr string
 	cat     string
 	payment string
+	rate    float64
 	status  int
+	tags    string
 }
 
 func (r *rawEntry) init(bo *fin.Entry) *rawEntry {
@@ -278,11 +1013,11 @@ func (r *rawEntry) init(bo *fin.Entry) *rawEntry {
 }
 
 func (r *rawEntry) Ptrs() []interface{} {
-	return []interface{}{&r.Id, &r.dateStr, &r.Name, &r.Desc, &r.CheckNo, &r.cat, &r.payment, &r.status}
+	return []interface{}{&r.Id, &r.dateStr, &r.Name, &r.Desc, &r.CheckNo, &r.cat, &r.payment, &r.rate, &r.status, &r.tags}
 }
 
 func (r *rawEntry) Values() []interface{} {
-	return []interface{}{r.dateStr, r.Name, r.Desc, r.CheckNo, r.cat, r.payment, r.status, r.Id}
+	return []interface{}{r.dateStr, r.Name, r.Desc, r.CheckNo, r.cat, r.payment, r.rate, r.status, r.tags, r.Id}
 }
 
 func (r *rawEntry) SetEtag(etag uint64) {
@@ -299,13 +1034,147 @@ func (r *rawEntry) Unmarshall() error {
 		return err
 	}
 	r.Status = fin.ReviewStatus(r.status)
-	return r.Entry.Unmarshall(r, unmarshall)
+	if err = r.Entry.Unmarshall(r, unmarshall); err != nil {
+		return err
+	}
+	r.SetExchangeRate(r.rate)
+	r.Tags = fin.ParseTags(r.tags)
+	return nil
 }
 
 func (r *rawEntry) Marshall() error {
 	r.dateStr = sqlite3_db.DateToString(r.Date)
 	r.status = int(r.Status)
 	r.Entry.Marshall(marshall, r)
+	r.rate = 0
+	if rate := r.ExchangeRate(); rate != 1.0 {
+		r.rate = rate
+	}
+	r.tags = strings.Join(r.Tags, "|")
+	return nil
+}
+
+// storedEntry is how entry history rows store an entry. Fields are
+// named so that adding a column to the entries table does not break
+// existing history rows.
+type storedEntry struct {
+	Id      int64   `json:"id"`
+	Date    string  `json:"date"`
+	Name    string  `json:"name"`
+	Desc    string  `json:"desc"`
+	CheckNo string  `json:"checkNo"`
+	Cat     string  `json:"cat"`
+	Payment string  `json:"payment"`
+	Rate    float64 `json:"rate,omitempty"`
+	Status  int     `json:"status,omitempty"`
+	Tags    string  `json:"tags,omitempty"`
+}
+
+func (s *storedEntry) fromRaw(r *rawEntry) *storedEntry {
+	*s = storedEntry{
+		Id:      r.Id,
+		Date:    r.dateStr,
+		Name:    r.Name,
+		Desc:    r.Desc,
+		CheckNo: r.CheckNo,
+		Cat:     r.cat,
+		Payment: r.payment,
+		Rate:    r.rate,
+		Status:  r.status,
+		Tags:    r.tags,
+	}
+	return s
+}
+
+func (s *storedEntry) toRaw(r *rawEntry) {
+	r.Id = s.Id
+	r.dateStr = s.Date
+	r.Name = s.Name
+	r.Desc = s.Desc
+	r.CheckNo = s.CheckNo
+	r.cat = s.Cat
+	r.payment = s.Payment
+	r.rate = s.Rate
+	r.status = s.Status
+	r.tags = s.Tags
+}
+
+// encodeEntry encodes entry as a JSON object of its column values in the
+// entries table.
+func encodeEntry(entry *fin.Entry) (string, error) {
+	r := (&rawEntry{}).init(entry)
+	if err := r.Marshall(); err != nil {
+		return "", err
+	}
+	encoded, err := json.Marshal((&storedEntry{}).fromRaw(r))
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// decodeEntry is the inverse of encodeEntry.
+func decodeEntry(encoded string, entry *fin.Entry) error {
+	r := (&rawEntry{}).init(entry)
+	var stored storedEntry
+	if err := json.Unmarshal([]byte(encoded), &stored); err != nil {
+		return fmt.Errorf("for_sqlite: bad entry encoding %q", encoded)
+	}
+	stored.toRaw(r)
+	return r.Unmarshall()
+}
+
+type rawEntryHistory struct {
+	*fin.EntryHistory
+	entryId  int64
+	rawTime  int64
+	oldEntry string
+	newEntry string
+}
+
+func (r *rawEntryHistory) init(bo *fin.EntryHistory) *rawEntryHistory {
+	r.EntryHistory = bo
+	return r
+}
+
+// setOld records entry as it was before the change.
+func (r *rawEntryHistory) setOld(entry *fin.Entry) (err error) {
+	r.entryId = entry.Id
+	r.oldEntry, err = encodeEntry(entry)
+	return
+}
+
+// setNew records entry as it is after the change.
+func (r *rawEntryHistory) setNew(entry *fin.Entry) (err error) {
+	r.entryId = entry.Id
+	r.newEntry, err = encodeEntry(entry)
+	return
+}
+
+func (r *rawEntryHistory) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.EntryId, &r.ChangeId, &r.UserId, &r.rawTime, &r.oldEntry, &r.newEntry}
+}
+
+func (r *rawEntryHistory) ValueRead() fin.EntryHistory {
+	return *r.EntryHistory
+}
+
+func (r *rawEntryHistory) Unmarshall() error {
+	r.Time = time.Unix(r.rawTime, 0).UTC()
+	r.Before = nil
+	if r.oldEntry != "" {
+		r.Before = &fin.Entry{}
+		if err := decodeEntry(r.oldEntry, r.Before); err != nil {
+			return err
+		}
+	}
+	r.After = nil
+	if r.newEntry != "" {
+		r.After = &fin.Entry{}
+		if err := decodeEntry(r.newEntry, r.After); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -322,11 +1191,11 @@ func (r *rawRecurringEntry) init(bo *fin.RecurringEntry) *rawRecurringEntry {
 }
 
 func (r *rawRecurringEntry) Ptrs() []interface{} {
-	return []interface{}{&r.Id, &r.re.dateStr, &r.Name, &r.Desc, &r.CheckNo, &r.re.cat, &r.re.payment, &r.re.status, &r.Period.Count, &r.unit, &r.NumLeft, &r.Period.DayOfMonth}
+	return []interface{}{&r.Id, &r.re.dateStr, &r.Name, &r.Desc, &r.CheckNo, &r.re.cat, &r.re.payment, &r.re.rate, &r.re.status, &r.re.tags, &r.Period.Count, &r.unit, &r.NumLeft, &r.Period.DayOfMonth}
 }
 
 func (r *rawRecurringEntry) Values() []interface{} {
-	return []interface{}{r.re.dateStr, r.Name, r.Desc, r.CheckNo, r.re.cat, r.re.payment, r.re.status, r.Period.Count, r.unit, r.NumLeft, r.Period.DayOfMonth, r.Id}
+	return []interface{}{r.re.dateStr, r.Name, r.Desc, r.CheckNo, r.re.cat, r.re.payment, r.re.rate, r.re.status, r.re.tags, r.Period.Count, r.unit, r.NumLeft, r.Period.DayOfMonth, r.Id}
 }
 
 func (r *rawRecurringEntry) SetEtag(etag uint64) {
@@ -356,81 +1225,259 @@ func (r *rawRecurringEntry) Marshall() (err error) {
 	return
 }
 
+type rawTrashedEntry struct {
+	*fin.TrashedEntry
+	re      rawEntry
+	trashed int64
+}
+
+func (r *rawTrashedEntry) init(bo *fin.TrashedEntry) *rawTrashedEntry {
+	r.TrashedEntry = bo
+	r.re.init(&bo.Entry)
+	return r
+}
+
+func (r *rawTrashedEntry) Ptrs() []interface{} {
+	return append(r.re.Ptrs(), &r.trashed)
+}
+
+func (r *rawTrashedEntry) ValueRead() fin.TrashedEntry {
+	return *r.TrashedEntry
+}
+
+func (r *rawTrashedEntry) Unmarshall() error {
+	r.Trashed = time.Unix(r.trashed, 0).UTC()
+	return r.re.Unmarshall()
+}
+
+type rawTrashedRecurringEntry struct {
+	*fin.TrashedRecurringEntry
+	rr      rawRecurringEntry
+	trashed int64
+}
+
+func (r *rawTrashedRecurringEntry) init(
+	bo *fin.TrashedRecurringEntry) *rawTrashedRecurringEntry {
+	r.TrashedRecurringEntry = bo
+	r.rr.init(&bo.RecurringEntry)
+	return r
+}
+
+func (r *rawTrashedRecurringEntry) Ptrs() []interface{} {
+	return append(r.rr.Ptrs(), &r.trashed)
+}
+
+func (r *rawTrashedRecurringEntry) ValueRead() fin.TrashedRecurringEntry {
+	return *r.TrashedRecurringEntry
+}
+
+func (r *rawTrashedRecurringEntry) Unmarshall() error {
+	r.Trashed = time.Unix(r.trashed, 0).UTC()
+	return r.rr.Unmarshall()
+}
+
 type rawAccount struct {
 	*fin.Account
 	importSDStr string
+	currency    string
+}
+
+func (r *rawAccount) init(bo *fin.Account) *rawAccount {
+	r.Account = bo
+	return r
+}
+
+func (r *rawAccount) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.Name, &r.Active, &r.Balance, &r.RBalance, &r.Count, &r.RCount, &r.importSDStr, &r.currency}
+}
+
+func (r *rawAccount) Values() []interface{} {
+	return []interface{}{r.Name, r.Active, r.Balance, r.RBalance, r.Count, r.RCount, r.importSDStr, r.currency, r.Id}
+}
+
+func (r *rawAccount) ValueRead() fin.Account {
+	return *r.Account
+}
+
+func (r *rawAccount) Unmarshall() error {
+	r.Account.ImportSD, _ = sqlite3_db.StringToDate(r.importSDStr)
+	r.Account.Currency = fin.Currency(r.currency)
+	return nil
+}
+
+func (r *rawAccount) Marshall() error {
+	r.importSDStr = sqlite3_db.DateToString(r.ImportSD)
+	r.currency = string(r.Currency)
+	return nil
+}
+
+type rawUser struct {
+	*fin.User
+	rawPassword   string
+	rawPermission int
+	rawLastLogin  int64
+}
+
+func (r *rawUser) init(bo *fin.User) *rawUser {
+	r.User = bo
+	return r
+}
+
+func (r *rawUser) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.Name, &r.rawPassword, &r.rawPermission, &r.rawLastLogin}
+}
+
+func (r *rawUser) Values() []interface{} {
+	return []interface{}{r.Name, r.rawPassword, r.rawPermission, r.rawLastLogin, r.Id}
+}
+
+func (r *rawUser) ValueRead() fin.User {
+	return *r.User
+}
+
+func (r *rawUser) Unmarshall() error {
+	r.Password = passwords.Password(r.rawPassword)
+	// Defaults to fin.NonePermission if the raw permission is not recognized
+	r.Permission, _ = fin.ToPermission(r.rawPermission)
+	if r.rawLastLogin == 0 {
+		r.LastLogin = time.Time{}
+	} else {
+		r.LastLogin = time.Unix(r.rawLastLogin, 0).UTC()
+	}
+	return nil
+}
+
+func (r *rawUser) Marshall() error {
+	r.rawPassword = string(r.Password)
+	r.rawPermission = r.Permission.ToInt()
+	if r.LastLogin.IsZero() {
+		r.rawLastLogin = 0
+	} else {
+		r.rawLastLogin = r.LastLogin.Unix()
+	}
+	return nil
+}
+
+type rawAccessRule struct {
+	*fin.AccessRule
+	rawCat string
+}
+
+func (r *rawAccessRule) init(bo *fin.AccessRule) *rawAccessRule {
+	r.AccessRule = bo
+	return r
+}
+
+func (r *rawAccessRule) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.UserName, &r.rawCat}
+}
+
+func (r *rawAccessRule) Values() []interface{} {
+	return []interface{}{r.UserName, r.rawCat, r.Id}
+}
+
+func (r *rawAccessRule) ValueRead() fin.AccessRule {
+	return *r.AccessRule
+}
+
+func (r *rawAccessRule) Unmarshall() (err error) {
+	r.Cat, err = fin.CatFromString(r.rawCat)
+	return
+}
+
+func (r *rawAccessRule) Marshall() error {
+	r.rawCat = r.Cat.ToString()
+	return nil
 }
 
-func (r *rawAccount) init(bo *fin.Account) *rawAccount {
-	r.Account = bo
+type rawApiToken struct {
+	*fin.ApiToken
+	rawPermission int
+	rawAccountIds string
+	rawCreated    int64
+	rawLastUsed   int64
+}
+
+func (r *rawApiToken) init(bo *fin.ApiToken) *rawApiToken {
+	r.ApiToken = bo
 	return r
 }
 
-func (r *rawAccount) Ptrs() []interface{} {
-	return []interface{}{&r.Id, &r.Name, &r.Active, &r.Balance, &r.RBalance, &r.Count, &r.RCount, &r.importSDStr}
+func (r *rawApiToken) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.UserId, &r.Name, &r.Hash, &r.rawPermission, &r.Book, &r.rawAccountIds, &r.rawCreated, &r.rawLastUsed}
 }
 
-func (r *rawAccount) Values() []interface{} {
-	return []interface{}{r.Name, r.Active, r.Balance, r.RBalance, r.Count, r.RCount, r.importSDStr, r.Id}
+func (r *rawApiToken) Values() []interface{} {
+	return []interface{}{r.UserId, r.Name, r.Hash, r.rawPermission, r.Book, r.rawAccountIds, r.rawCreated, r.rawLastUsed, r.Id}
 }
 
-func (r *rawAccount) ValueRead() fin.Account {
-	return *r.Account
+func (r *rawApiToken) ValueRead() fin.ApiToken {
+	return *r.ApiToken
 }
 
-func (r *rawAccount) Unmarshall() error {
-	r.Account.ImportSD, _ = sqlite3_db.StringToDate(r.importSDStr)
+func (r *rawApiToken) Unmarshall() (err error) {
+	// Defaults to fin.NonePermission if the raw permission is not recognized
+	r.Permission, _ = fin.ToPermission(r.rawPermission)
+	if r.AccountIds, err = findb.ParseIds(r.rawAccountIds); err != nil {
+		return
+	}
+	r.Created = time.Unix(r.rawCreated, 0).UTC()
+	if r.rawLastUsed == 0 {
+		r.LastUsed = time.Time{}
+	} else {
+		r.LastUsed = time.Unix(r.rawLastUsed, 0).UTC()
+	}
 	return nil
 }
 
-func (r *rawAccount) Marshall() error {
-	r.importSDStr = sqlite3_db.DateToString(r.ImportSD)
+func (r *rawApiToken) Marshall() error {
+	r.rawPermission = r.Permission.ToInt()
+	r.rawAccountIds = findb.FormatIds(r.AccountIds)
+	r.rawCreated = r.Created.Unix()
+	if r.LastUsed.IsZero() {
+		r.rawLastUsed = 0
+	} else {
+		r.rawLastUsed = r.LastUsed.Unix()
+	}
 	return nil
 }
 
-type rawUser struct {
-	*fin.User
-	rawPassword   string
-	rawPermission int
-	rawLastLogin  int64
+type rawAttachment struct {
+	*fin.Attachment
+	rawAdded int64
 }
 
-func (r *rawUser) init(bo *fin.User) *rawUser {
-	r.User = bo
+func (r *rawAttachment) init(bo *fin.Attachment) *rawAttachment {
+	r.Attachment = bo
 	return r
 }
 
-func (r *rawUser) Ptrs() []interface{} {
-	return []interface{}{&r.Id, &r.Name, &r.rawPassword, &r.rawPermission, &r.rawLastLogin}
+func (r *rawAttachment) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.EntryId, &r.Name, &r.ContentType, &r.Hash, &r.Size, &r.rawAdded}
 }
 
-func (r *rawUser) Values() []interface{} {
-	return []interface{}{r.Name, r.rawPassword, r.rawPermission, r.rawLastLogin, r.Id}
+func (r *rawAttachment) Values() []interface{} {
+	return []interface{}{r.EntryId, r.Name, r.ContentType, r.Hash, r.Size, r.rawAdded, r.Id}
 }
 
-func (r *rawUser) ValueRead() fin.User {
-	return *r.User
+func (r *rawAttachment) ValueRead() fin.Attachment {
+	return *r.Attachment
 }
 
-func (r *rawUser) Unmarshall() error {
-	r.Password = passwords.Password(r.rawPassword)
-	// Defaults to fin.NonePermission if the raw permission is not recognized
-	r.Permission, _ = fin.ToPermission(r.rawPermission)
-	if r.rawLastLogin == 0 {
-		r.LastLogin = time.Time{}
+func (r *rawAttachment) Unmarshall() error {
+	if r.rawAdded == 0 {
+		r.Added = time.Time{}
 	} else {
-		r.LastLogin = time.Unix(r.rawLastLogin, 0).UTC()
+		r.Added = time.Unix(r.rawAdded, 0).UTC()
 	}
 	return nil
 }
 
-func (r *rawUser) Marshall() error {
-	r.rawPassword = string(r.Password)
-	r.rawPermission = r.Permission.ToInt()
-	if r.LastLogin.IsZero() {
-		r.rawLastLogin = 0
+func (r *rawAttachment) Marshall() error {
+	if r.Added.IsZero() {
+		r.rawAdded = 0
 	} else {
-		r.rawLastLogin = r.LastLogin.Unix()
+		r.rawAdded = r.Added.Unix()
 	}
 	return nil
 }
@@ -516,7 +1563,31 @@ func marshall(cr []fin.CatRec, id int64, reconciled bool, ptr interface{}) {
 }
 
 type Store struct {
-	db sqlite3_db.Doer
+	db     sqlite3_db.Doer
+	userId int64
+	clock  date_util.Clock
+}
+
+// WithUser returns a Store like this one except that it records userId
+// as the user making the entry changes in the entry history.
+func (s Store) WithUser(userId int64) Store {
+	s.userId = userId
+	return s
+}
+
+// WithClock returns a Store like this one except that clock supplies the
+// times of entry changes and of moves to the trash. Without a clock, the
+// store uses the system time.
+func (s Store) WithClock(clock date_util.Clock) Store {
+	s.clock = clock
+	return s
+}
+
+func (s Store) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
 }
 
 func (s Store) AccountById(
@@ -561,7 +1632,8 @@ func (s Store) AddAccount(t db.Transaction, account *fin.Account) error {
 func (s Store) DoEntryChanges(
 	t db.Transaction, changes *findb.EntryChanges) error {
 	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
-		return doEntryChanges(tx, changes)
+		return doEntryChanges(
+			tx, changes, changeSetInfo{userId: s.userId, now: s.now()})
 	})
 }
 
@@ -574,6 +1646,35 @@ func (s Store) Entries(
 	})
 }
 
+func (s Store) CatTotals(
+	t db.Transaction, options *findb.EntryListOptions) (
+	totals fin.CatTotals, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		totals, err = catTotals(tx, options)
+		return
+	})
+	return
+}
+
+func (s Store) EntriesPage(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.Entry]) (string, error) {
+	return findb.EntriesPage(t, s, options, token, pageSize, consumer)
+}
+
+func (s Store) SearchEntries(
+	t db.Transaction,
+	query string,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return searchEntries(tx, query, options, consumer)
+	})
+}
+
 func (s Store) EntryById(
 	t db.Transaction, id int64, entry *fin.Entry) error {
 	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
@@ -588,6 +1689,13 @@ func (s Store) UpdateAccountImportSD(
 	})
 }
 
+func (s Store) UpdateAccountCurrency(
+	t db.Transaction, acctId int64, currency fin.Currency) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return updateAccountCurrency(tx, acctId, currency)
+	})
+}
+
 func (s Store) UpdateAccount(
 	t db.Transaction, account *fin.Account) error {
 	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
@@ -613,6 +1721,12 @@ func (s Store) AddUser(t db.Transaction, user *fin.User) error {
 
 func (s Store) RemoveUserByName(t db.Transaction, name string) error {
 	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(kSQLRemoveAccessRulesByUserName, name); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(kSQLRemoveApiTokensByUserName, name); err != nil {
+			return err
+		}
 		_, err := tx.Exec(kSQLRemoveUserByName, name)
 		return err
 	})
@@ -660,6 +1774,82 @@ func (s Store) Users(
 	})
 }
 
+func (s Store) AccessRulesByUserName(
+	t db.Transaction,
+	name string,
+	consumer consume2.Consumer[fin.AccessRule]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.AccessRule](
+			tx,
+			(&rawAccessRule{}).init(&fin.AccessRule{}),
+			consumer,
+			kSQLAccessRulesByUserName,
+			name)
+	})
+}
+
+func (s Store) AddAccessRule(t db.Transaction, rule *fin.AccessRule) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.AddRow(
+			tx, (&rawAccessRule{}).init(rule), &rule.Id, kSQLInsertAccessRule)
+	})
+}
+
+func (s Store) RemoveAccessRule(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec(kSQLRemoveAccessRule, id)
+		return err
+	})
+}
+
+func (s Store) ApiTokensByUserId(
+	t db.Transaction,
+	userId int64,
+	consumer consume2.Consumer[fin.ApiToken]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.ApiToken](
+			tx,
+			(&rawApiToken{}).init(&fin.ApiToken{}),
+			consumer,
+			kSQLApiTokensByUserId,
+			userId)
+	})
+}
+
+func (s Store) ApiTokenByHash(
+	t db.Transaction, hash string, token *fin.ApiToken) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadSingle(
+			tx,
+			(&rawApiToken{}).init(token),
+			findb.NoSuchId,
+			kSQLApiTokenByHash,
+			hash)
+	})
+}
+
+func (s Store) AddApiToken(t db.Transaction, token *fin.ApiToken) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.AddRow(
+			tx, (&rawApiToken{}).init(token), &token.Id, kSQLInsertApiToken)
+	})
+}
+
+func (s Store) UpdateApiTokenLastUsed(
+	t db.Transaction, id int64, lastUsed time.Time) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec(kSQLUpdateApiTokenLastUsed, lastUsed.Unix(), id)
+		return err
+	})
+}
+
+func (s Store) RemoveApiToken(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec(kSQLRemoveApiToken, id)
+		return err
+	})
+}
+
 func (s Store) AddRecurringEntry(
 	t db.Transaction, entry *fin.RecurringEntry) error {
 	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
@@ -704,11 +1894,55 @@ func (s Store) RecurringEntries(
 
 func (s Store) RemoveRecurringEntryById(t db.Transaction, id int64) error {
 	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
-		_, err := tx.Exec(kSQLDeleteRecurringEntryById, id)
-		return err
+		return trashRecurringEntry(tx, id, s.now())
 	})
 }
 
+func (s Store) TrashedEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.TrashedEntry]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.TrashedEntry](
+			tx,
+			(&rawTrashedEntry{}).init(&fin.TrashedEntry{}),
+			consumer,
+			kSQLTrashedEntries)
+	})
+}
+
+// RestoreEntry attributes the restore to the user of this store.
+func (s Store) RestoreEntry(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return restoreTrashedEntry(tx, id, s.userId, s.now())
+	})
+}
+
+func (s Store) TrashedRecurringEntries(
+	t db.Transaction,
+	consumer consume2.Consumer[fin.TrashedRecurringEntry]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.TrashedRecurringEntry](
+			tx,
+			(&rawTrashedRecurringEntry{}).init(&fin.TrashedRecurringEntry{}),
+			consumer,
+			kSQLTrashedRecurringEntries)
+	})
+}
+
+func (s Store) RestoreRecurringEntry(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return restoreTrashedRecurringEntry(tx, id)
+	})
+}
+
+func (s Store) PurgeTrash(
+	t db.Transaction, before time.Time) (count int, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		count, err = purgeTrash(tx, before)
+		return
+	})
+	return
+}
+
 func (s Store) AllocationsByYear(t db.Transaction, year int64) (
 	result map[int64]int64, err error) {
 	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
@@ -751,6 +1985,134 @@ func (s Store) AddAllocation(
 	})
 }
 
+func (s Store) EntryHistory(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.EntryHistory](
+			tx,
+			(&rawEntryHistory{}).init(&fin.EntryHistory{}),
+			consumer,
+			kSQLEntryHistory,
+			entryId)
+	})
+}
+
+func (s Store) ChangeEntries(
+	t db.Transaction,
+	changeId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.EntryHistory](
+			tx,
+			(&rawEntryHistory{}).init(&fin.EntryHistory{}),
+			consumer,
+			kSQLChangeEntries,
+			changeId)
+	})
+}
+
+func (s Store) LastChangeId(
+	t db.Transaction, userId int64) (result int64, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		result, err = lastChangeId(tx, userId)
+		return
+	})
+	return
+}
+
+// Undo attributes the undo to the user of this store.
+func (s Store) Undo(t db.Transaction, changeId int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return undo(tx, changeId, s.userId, s.now())
+	})
+}
+
+func (s Store) AddAttachment(
+	t db.Transaction, attachment *fin.Attachment, contents []byte) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		attachment.Hash = fin.ContentHash(contents)
+		attachment.Size = int64(len(contents))
+		if _, err := tx.Exec(
+			kSQLInsertBlob, attachment.Hash, contents); err != nil {
+			return err
+		}
+		return sqlite3_rw.AddRow(
+			tx,
+			(&rawAttachment{}).init(attachment),
+			&attachment.Id,
+			kSQLInsertAttachment)
+	})
+}
+
+func (s Store) AttachmentById(
+	t db.Transaction, id int64, attachment *fin.Attachment) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadSingle(
+			tx,
+			(&rawAttachment{}).init(attachment),
+			findb.NoSuchId,
+			kSQLAttachmentById,
+			id)
+	})
+}
+
+func (s Store) AttachmentsByEntryId(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.Attachment]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[fin.Attachment](
+			tx,
+			(&rawAttachment{}).init(&fin.Attachment{}),
+			consumer,
+			kSQLAttachmentsByEntryId,
+			entryId)
+	})
+}
+
+func (s Store) AttachmentContents(
+	t db.Transaction, hash string) (contents []byte, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		err := tx.QueryRow(kSQLBlobByHash, hash).Scan(&contents)
+		if err == sql.ErrNoRows {
+			return findb.NoSuchId
+		}
+		return err
+	})
+	return
+}
+
+// entryIdsByAttachmentHash returns the ids of the entries that have an
+// attachment with given hash.
+func entryIdsByAttachmentHash(tx *sql.Tx, hash string) ([]int64, error) {
+	dbrows, err := tx.Query(kSQLEntryIdsByAttachmentHash, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer dbrows.Close()
+	var result []int64
+	for dbrows.Next() {
+		var id int64
+		if err := dbrows.Scan(&id); err != nil {
+			return nil, err
+		}
+		result = append(result, id)
+	}
+	return result, dbrows.Err()
+}
+
+func (s Store) RemoveAttachment(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(kSQLRemoveAttachment, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(kSQLRemoveOrphanBlobs)
+		return err
+	})
+}
+
 type ReadOnlyStore struct {
 	findb.NoPermissionStore
 	store Store
@@ -778,6 +2140,29 @@ func (s ReadOnlyStore) Entries(
 	return s.store.Entries(t, options, consumer)
 }
 
+func (s ReadOnlyStore) CatTotals(
+	t db.Transaction, options *findb.EntryListOptions) (
+	fin.CatTotals, error) {
+	return s.store.CatTotals(t, options)
+}
+
+func (s ReadOnlyStore) EntriesPage(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.Entry]) (string, error) {
+	return s.store.EntriesPage(t, options, token, pageSize, consumer)
+}
+
+func (s ReadOnlyStore) SearchEntries(
+	t db.Transaction,
+	query string,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return s.store.SearchEntries(t, query, options, consumer)
+}
+
 func (s ReadOnlyStore) EntryById(
 	t db.Transaction, id int64, entry *fin.Entry) error {
 	return s.store.EntryById(t, id, entry)
@@ -808,7 +2193,54 @@ func (s ReadOnlyStore) RecurringEntries(
 	return s.store.RecurringEntries(t, consumer)
 }
 
+func (s ReadOnlyStore) TrashedEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.TrashedEntry]) error {
+	return s.store.TrashedEntries(t, consumer)
+}
+
+func (s ReadOnlyStore) TrashedRecurringEntries(
+	t db.Transaction,
+	consumer consume2.Consumer[fin.TrashedRecurringEntry]) error {
+	return s.store.TrashedRecurringEntries(t, consumer)
+}
+
 func (s ReadOnlyStore) AllocationsByYear(t db.Transaction, year int64) (
 	map[int64]int64, error) {
 	return s.store.AllocationsByYear(t, year)
 }
+
+func (s ReadOnlyStore) EntryHistory(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return s.store.EntryHistory(t, entryId, consumer)
+}
+
+func (s ReadOnlyStore) ChangeEntries(
+	t db.Transaction,
+	changeId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return s.store.ChangeEntries(t, changeId, consumer)
+}
+
+func (s ReadOnlyStore) LastChangeId(
+	t db.Transaction, userId int64) (int64, error) {
+	return s.store.LastChangeId(t, userId)
+}
+
+func (s ReadOnlyStore) AttachmentById(
+	t db.Transaction, id int64, attachment *fin.Attachment) error {
+	return s.store.AttachmentById(t, id, attachment)
+}
+
+func (s ReadOnlyStore) AttachmentsByEntryId(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.Attachment]) error {
+	return s.store.AttachmentsByEntryId(t, entryId, consumer)
+}
+
+func (s ReadOnlyStore) AttachmentContents(
+	t db.Transaction, hash string) ([]byte, error) {
+	return s.store.AttachmentContents(t, hash)
+}
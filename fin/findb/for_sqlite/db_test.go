@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"testing"
+	"time"
 
+	qfxsqlite "github.com/keep94/finances/fin/autoimport/qfx/qfxdb/for_sqlite"
 	"github.com/keep94/finances/fin/findb/fixture"
 	"github.com/keep94/finances/fin/findb/sqlite_setup"
 	"github.com/keep94/toolbox/db/sqlite3_db"
@@ -21,6 +23,12 @@ func TestAccountUpdates(t *testing.T) {
 	newEntryAccountFixture(db).AccountUpdates(t, New(db))
 }
 
+func TestAccountUpdatesExchangeRate(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).AccountUpdatesExchangeRate(t, New(db))
+}
+
 func TestSaveAndLoadEntry(t *testing.T) {
 	db := openDb(t)
 	defer closeDb(t, db)
@@ -87,6 +95,42 @@ func TestListEntriesUnreviewed(t *testing.T) {
 	newEntryAccountFixture(db).ListEntriesUnreviewed(t, New(db))
 }
 
+func TestListEntriesAccount(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesAccount(t, New(db))
+}
+
+func TestListEntriesCriteria(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).ListEntriesCriteria(t, New(db))
+}
+
+func TestEntriesPage(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).EntriesPage(t, New(db))
+}
+
+func TestEntriesByAccountIdPage(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).EntriesByAccountIdPage(t, New(db))
+}
+
+func TestSearchEntries(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).SearchEntries(t, New(db))
+}
+
+func TestCatTotals(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).CatTotals(t, New(db))
+}
+
 func TestEntriesByAccountId(t *testing.T) {
 	db := openDb(t)
 	defer closeDb(t, db)
@@ -123,6 +167,70 @@ func TestConcurrentUpdateSkipped(t *testing.T) {
 	newEntryAccountFixture(db).ConcurrentUpdateSkipped(t, New(db))
 }
 
+func TestSaveAndLoadRecurringEntry(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).SaveAndLoadRecurringEntry(t, New(db))
+}
+
+func TestEntryHistory(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).EntryHistory(t, New(db).WithUser(3), 3)
+}
+
+func TestUndo(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).Undo(t, New(db).WithUser(3), 3)
+}
+
+func TestUndoOtherUser(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UndoOtherUser(
+		t, New(db).WithUser(3), New(db).WithUser(4), 3)
+}
+
+func TestUndoImport(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UndoImport(
+		t, New(db).WithUser(3), qfxsqlite.New(db), 3)
+}
+
+func TestSaveAndLoadAttachments(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).SaveAndLoadAttachments(t, New(db))
+}
+
+func TestPurgeTrashRemovesAttachments(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).PurgeTrashRemovesAttachments(t, New(db))
+}
+
+func TestTrash(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).Trash(t, New(db).WithUser(3), 3)
+}
+
+func TestTrashTimes(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	now := time.Unix(1700000000, 0)
+	newEntryAccountFixture(db).TrashTimes(
+		t, New(db).WithUser(3).WithClock(fixture.FixedClock(now)), 3, now)
+}
+
+func TestRecurringTrash(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).RecurringTrash(t, New(db))
+}
+
 func TestApplyRecurringEntries(t *testing.T) {
 	db := openDb(t)
 	defer closeDb(t, db)
@@ -141,6 +249,12 @@ func TestUpdateAccountImportSD(t *testing.T) {
 	newEntryAccountFixture(db).UpdateAccountImportSD(t, New(db))
 }
 
+func TestUpdateAccountCurrency(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	newEntryAccountFixture(db).UpdateAccountCurrency(t, New(db))
+}
+
 func TestUpdateAccount(t *testing.T) {
 	db := openDb(t)
 	defer closeDb(t, db)
@@ -183,6 +297,18 @@ func TestRemoveUserByName(t *testing.T) {
 	fixture.RemoveUserByName(t, New(db))
 }
 
+func TestAccessRules(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.AccessRules(t, New(db))
+}
+
+func TestApiTokens(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.ApiTokens(t, sqlite3_db.NewDoer(db), New(db))
+}
+
 func TestNoUserByName(t *testing.T) {
 	db := openDb(t)
 	defer closeDb(t, db)
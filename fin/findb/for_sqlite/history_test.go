@@ -0,0 +1,29 @@
+package for_sqlite
+
+import (
+	"testing"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeEntry(t *testing.T) {
+	assert := assert.New(t)
+	entry := fin.Entry{
+		Id:         7,
+		Date:       date_util.YMD(2024, 3, 15),
+		Name:       "Grocery",
+		Desc:       "Weekly",
+		CheckNo:    "1001",
+		CatPayment: fin.NewCatPayment(fin.Expense, 2500, true, 1),
+		Status:     fin.Reviewed,
+		Tags:       []string{"food"},
+	}
+	encoded, err := encodeEntry(&entry)
+	assert.NoError(err)
+	assert.Contains(encoded, `"name":"Grocery"`)
+	var decoded fin.Entry
+	assert.NoError(decodeEntry(encoded, &decoded))
+	assert.Equal(entry, decoded)
+}
@@ -0,0 +1,735 @@
+package for_sqlite
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/categories/categoriesdb"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	"github.com/keep94/toolbox/db/sqlite3_rw"
+)
+
+// ScopedWrapper returns a store that limits store to what rules allow.
+// See fin.AccessRule. cdc supplies the categories that category rules
+// refer to. The returned store filters out the accounts, entries, and
+// recurring entries that rules do not allow and returns
+// findb.NoPermission when asked for one of them by id. An entry that
+// touches one allowed account shows up even if it also touches accounts
+// that rules do not allow, but the returned store hides the ids of those
+// other accounts. Changing an entry or recurring entry requires rules to
+// allow every account and category it has both before and after the
+// change; otherwise the returned store returns findb.NoPermission. The
+// returned store does not allow changes to accounts, users, envelope
+// allocations, or access rules, and it does not allow purging the trash.
+func ScopedWrapper(
+	store Store,
+	cdc categoriesdb.Getter,
+	rules []fin.AccessRule) ScopedStore {
+	return ScopedStore{store: store, cdc: cdc, rules: rules}
+}
+
+// ReadOnlyScopedWrapper works like ScopedWrapper except that the returned
+// store allows no changes at all.
+func ReadOnlyScopedWrapper(
+	store Store,
+	cdc categoriesdb.Getter,
+	rules []fin.AccessRule) ScopedStore {
+	return ScopedStore{store: store, cdc: cdc, rules: rules, readOnly: true}
+}
+
+type ScopedStore struct {
+	findb.NoPermissionStore
+	store    Store
+	cdc      categoriesdb.Getter
+	rules    []fin.AccessRule
+	readOnly bool
+}
+
+// HasAccount returns true if this store allows the account with given id.
+func (s ScopedStore) HasAccount(id int64) bool {
+	return newScope(s.rules, categories.CatDetailStore{}).hasAccount(id)
+}
+
+func (s ScopedStore) AccountById(
+	t db.Transaction, acctId int64, account *fin.Account) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		if !sc.hasAccount(acctId) {
+			return findb.NoPermission
+		}
+		return s.store.AccountById(tx, acctId, account)
+	})
+}
+
+func (s ScopedStore) Accounts(
+	t db.Transaction, consumer consume2.Consumer[fin.Account]) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		return s.store.Accounts(
+			tx,
+			consume2.Filterp(consumer, func(account *fin.Account) bool {
+				return sc.hasAccount(account.Id)
+			}))
+	})
+}
+
+func (s ScopedStore) ActiveAccounts(t db.Transaction) (
+	accounts []*fin.Account, err error) {
+	err = s.do(t, func(tx *sql.Tx, sc *scope) (err error) {
+		accounts, err = s.store.ActiveAccounts(tx)
+		accounts = slices.DeleteFunc(accounts, func(account *fin.Account) bool {
+			return !sc.hasAccount(account.Id)
+		})
+		return
+	})
+	return
+}
+
+func (s ScopedStore) UpdateAccountImportSD(
+	t db.Transaction, acctId int64, date time.Time) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		if !sc.hasAccount(acctId) {
+			return findb.NoPermission
+		}
+		return s.store.UpdateAccountImportSD(tx, acctId, date)
+	})
+}
+
+func (s ScopedStore) DoEntryChanges(
+	t db.Transaction, changes *findb.EntryChanges) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		for _, entry := range changes.Adds {
+			if !sc.canChange(entry) {
+				return findb.NoPermission
+			}
+		}
+		for _, id := range changes.Deletes {
+			if err := s.checkEntryChange(tx, sc, id); err != nil {
+				return err
+			}
+		}
+		// An update must start and end with an entry in scope. Since
+		// updates run inside the store, remember any violation and fail
+		// afterwards so that the transaction rolls back.
+		inScope := true
+		scoped := *changes
+		scoped.Updates = make(map[int64]fin.EntryUpdater, len(changes.Updates))
+		for id, update := range changes.Updates {
+			scoped.Updates[id] = func(entry *fin.Entry) bool {
+				if !sc.canChange(entry) {
+					inScope = false
+					return false
+				}
+				if !update(entry) {
+					return false
+				}
+				if !sc.canChange(entry) {
+					inScope = false
+					return false
+				}
+				return true
+			}
+		}
+		if err := s.store.DoEntryChanges(tx, &scoped); err != nil {
+			return err
+		}
+		if !inScope {
+			return findb.NoPermission
+		}
+		changes.ChangeId = scoped.ChangeId
+		return nil
+	})
+}
+
+func (s ScopedStore) Entries(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		options, consumer := sc.filterEntries(options, consumer)
+		return s.store.Entries(tx, options, consumer)
+	})
+}
+
+func (s ScopedStore) CatTotals(
+	t db.Transaction, options *findb.EntryListOptions) (
+	fin.CatTotals, error) {
+	return findb.CatTotals(t, s, options)
+}
+
+func (s ScopedStore) EntriesPage(
+	t db.Transaction,
+	options *findb.EntryListOptions,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.Entry]) (string, error) {
+	return findb.EntriesPage(t, s, options, token, pageSize, consumer)
+}
+
+func (s ScopedStore) SearchEntries(
+	t db.Transaction,
+	query string,
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		options, consumer := sc.filterEntries(options, consumer)
+		return s.store.SearchEntries(tx, query, options, consumer)
+	})
+}
+
+func (s ScopedStore) EntryById(
+	t db.Transaction, id int64, entry *fin.Entry) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		if err := s.store.EntryById(tx, id, entry); err != nil {
+			return err
+		}
+		if !sc.hasEntry(entry) {
+			return findb.NoPermission
+		}
+		sc.hideAccounts(entry)
+		return nil
+	})
+}
+
+func (s ScopedStore) UserById(
+	t db.Transaction, id int64, user *fin.User) error {
+	return s.store.UserById(t, id, user)
+}
+
+func (s ScopedStore) UserByName(
+	t db.Transaction, name string, user *fin.User) error {
+	return s.store.UserByName(t, name, user)
+}
+
+func (s ScopedStore) Users(
+	t db.Transaction, consumer consume2.Consumer[fin.User]) error {
+	return s.store.Users(t, consumer)
+}
+
+func (s ScopedStore) AddRecurringEntry(
+	t db.Transaction, entry *fin.RecurringEntry) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		if !sc.canChange(&entry.Entry) {
+			return findb.NoPermission
+		}
+		return s.store.AddRecurringEntry(tx, entry)
+	})
+}
+
+func (s ScopedStore) UpdateRecurringEntry(
+	t db.Transaction, entry *fin.RecurringEntry) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		if err := s.checkRecurringEntry(tx, sc, entry.Id); err != nil {
+			return err
+		}
+		if !sc.canChange(&entry.Entry) {
+			return findb.NoPermission
+		}
+		return s.store.UpdateRecurringEntry(tx, entry)
+	})
+}
+
+func (s ScopedStore) RecurringEntryById(
+	t db.Transaction, id int64, entry *fin.RecurringEntry) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		if err := s.store.RecurringEntryById(tx, id, entry); err != nil {
+			return err
+		}
+		if !sc.hasEntry(&entry.Entry) {
+			return findb.NoPermission
+		}
+		sc.hideAccounts(&entry.Entry)
+		return nil
+	})
+}
+
+func (s ScopedStore) RecurringEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.RecurringEntry]) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		return s.store.RecurringEntries(
+			tx,
+			consume2.Filterp(consumer, func(entry *fin.RecurringEntry) bool {
+				return sc.allowEntry(&entry.Entry)
+			}))
+	})
+}
+
+func (s ScopedStore) RemoveRecurringEntryById(
+	t db.Transaction, id int64) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		if err := s.checkRecurringEntry(tx, sc, id); err != nil {
+			return err
+		}
+		return s.store.RemoveRecurringEntryById(tx, id)
+	})
+}
+
+func (s ScopedStore) TrashedEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.TrashedEntry]) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		return s.store.TrashedEntries(
+			tx,
+			consume2.Filterp(consumer, func(entry *fin.TrashedEntry) bool {
+				return sc.allowEntry(&entry.Entry)
+			}))
+	})
+}
+
+func (s ScopedStore) RestoreEntry(t db.Transaction, id int64) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		var trashed fin.TrashedEntry
+		err := sqlite3_rw.ReadSingle(
+			tx,
+			(&rawTrashedEntry{}).init(&trashed),
+			findb.NoSuchId,
+			kSQLTrashedEntryById,
+			id)
+		if err != nil {
+			return err
+		}
+		if !sc.canChange(&trashed.Entry) {
+			return findb.NoPermission
+		}
+		return s.store.RestoreEntry(tx, id)
+	})
+}
+
+func (s ScopedStore) TrashedRecurringEntries(
+	t db.Transaction,
+	consumer consume2.Consumer[fin.TrashedRecurringEntry]) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		return s.store.TrashedRecurringEntries(
+			tx,
+			consume2.Filterp(
+				consumer, func(entry *fin.TrashedRecurringEntry) bool {
+					return sc.allowEntry(&entry.Entry)
+				}))
+	})
+}
+
+func (s ScopedStore) RestoreRecurringEntry(t db.Transaction, id int64) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		var trashed fin.TrashedRecurringEntry
+		err := sqlite3_rw.ReadSingle(
+			tx,
+			(&rawTrashedRecurringEntry{}).init(&trashed),
+			findb.NoSuchId,
+			kSQLTrashedRecurringEntryById,
+			id)
+		if err != nil {
+			return err
+		}
+		if !sc.canChange(&trashed.Entry) {
+			return findb.NoPermission
+		}
+		return s.store.RestoreRecurringEntry(tx, id)
+	})
+}
+
+func (s ScopedStore) AllocationsByYear(t db.Transaction, year int64) (
+	allocations map[int64]int64, err error) {
+	err = s.do(t, func(tx *sql.Tx, sc *scope) (err error) {
+		allocations, err = s.store.AllocationsByYear(tx, year)
+		for expenseId := range allocations {
+			if !sc.hasCat(fin.Cat{Type: fin.ExpenseCat, Id: expenseId}) {
+				delete(allocations, expenseId)
+			}
+		}
+		return
+	})
+	return
+}
+
+func (s ScopedStore) EntryHistory(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		return s.store.EntryHistory(
+			tx, entryId, consume2.Filterp(consumer, sc.allowHistory))
+	})
+}
+
+func (s ScopedStore) ChangeEntries(
+	t db.Transaction,
+	changeId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		return s.store.ChangeEntries(
+			tx, changeId, consume2.Filterp(consumer, sc.allowHistory))
+	})
+}
+
+func (s ScopedStore) LastChangeId(
+	t db.Transaction, userId int64) (int64, error) {
+	return s.store.LastChangeId(t, userId)
+}
+
+func (s ScopedStore) Undo(t db.Transaction, changeId int64) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		var history []fin.EntryHistory
+		err := s.store.ChangeEntries(tx, changeId, consume2.AppendTo(&history))
+		if err != nil {
+			return err
+		}
+		for i := range history {
+			if !sc.canChangeHistory(&history[i]) {
+				return findb.NoPermission
+			}
+		}
+		return s.store.Undo(tx, changeId)
+	})
+}
+
+func (s ScopedStore) AddAttachment(
+	t db.Transaction, attachment *fin.Attachment, contents []byte) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		if err := s.checkEntry(tx, sc, attachment.EntryId); err != nil {
+			return err
+		}
+		return s.store.AddAttachment(tx, attachment, contents)
+	})
+}
+
+func (s ScopedStore) AttachmentById(
+	t db.Transaction, id int64, attachment *fin.Attachment) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		if err := s.store.AttachmentById(tx, id, attachment); err != nil {
+			return err
+		}
+		return s.checkEntry(tx, sc, attachment.EntryId)
+	})
+}
+
+func (s ScopedStore) AttachmentsByEntryId(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.Attachment]) error {
+	return s.do(t, func(tx *sql.Tx, sc *scope) error {
+		if err := s.checkEntry(tx, sc, entryId); err != nil {
+			return err
+		}
+		return s.store.AttachmentsByEntryId(tx, entryId, consumer)
+	})
+}
+
+// AttachmentContents returns findb.NoPermission unless an attachment with
+// hash belongs to an entry that this store allows.
+func (s ScopedStore) AttachmentContents(
+	t db.Transaction, hash string) (contents []byte, err error) {
+	err = s.do(t, func(tx *sql.Tx, sc *scope) error {
+		entryIds, err := entryIdsByAttachmentHash(tx, hash)
+		if err != nil {
+			return err
+		}
+		if len(entryIds) == 0 {
+			return findb.NoSuchId
+		}
+		for _, id := range entryIds {
+			err := s.checkEntry(tx, sc, id)
+			if err == nil {
+				contents, err = s.store.AttachmentContents(tx, hash)
+				return err
+			}
+			// Attachments of trashed entries have no entry to check.
+			if err != findb.NoPermission && err != findb.NoSuchId {
+				return err
+			}
+		}
+		return findb.NoPermission
+	})
+	return
+}
+
+func (s ScopedStore) RemoveAttachment(t db.Transaction, id int64) error {
+	return s.change(t, func(tx *sql.Tx, sc *scope) error {
+		var attachment fin.Attachment
+		if err := s.AttachmentById(tx, id, &attachment); err != nil {
+			return err
+		}
+		return s.store.RemoveAttachment(tx, id)
+	})
+}
+
+// Cache returns the categories and accounts that this store allows. The
+// returned cache does not allow changes.
+func (s ScopedStore) Cache() ScopedCache {
+	return ScopedCache{store: s}
+}
+
+// ScopedCache limits the categories and accounts of a cache to what a
+// ScopedStore allows. The writing methods of ScopedCache merely return
+// categoriesdb.NoPermission along with the allowed categories.
+type ScopedCache struct {
+	categoriesdb.NoPermissionCache
+	store ScopedStore
+}
+
+func (c ScopedCache) Get(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	err = c.store.do(t, func(tx *sql.Tx, sc *scope) error {
+		cds = sc.cds.Limit(sc.hasCat)
+		return nil
+	})
+	return
+}
+
+func (c ScopedCache) AccountAdd(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId int64, err error) {
+	cds, err = c.reportNoPermission(t)
+	return
+}
+
+func (c ScopedCache) AccountRename(t db.Transaction, id int64, name string) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ScopedCache) AccountSetCurrency(
+	t db.Transaction, id int64, currency fin.Currency) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ScopedCache) AccountRemove(t db.Transaction, id int64) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ScopedCache) Add(t db.Transaction, name string) (
+	cds categories.CatDetailStore, newId fin.Cat, err error) {
+	cds, err = c.reportNoPermission(t)
+	return
+}
+
+func (c ScopedCache) Remove(t db.Transaction, id fin.Cat) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ScopedCache) Rename(
+	t db.Transaction, id fin.Cat, newName string) (
+	cds categories.CatDetailStore, err error) {
+	return c.reportNoPermission(t)
+}
+
+func (c ScopedCache) reportNoPermission(t db.Transaction) (
+	cds categories.CatDetailStore, err error) {
+	cds, _ = c.Get(t)
+	err = categoriesdb.NoPermission
+	return
+}
+
+// do runs f within a transaction along with the scope of this store.
+func (s ScopedStore) do(
+	t db.Transaction, f func(tx *sql.Tx, sc *scope) error) error {
+	return sqlite3_db.ToDoer(s.store.db, t).Do(func(tx *sql.Tx) error {
+		cds, err := s.cdc.Get(tx)
+		if err != nil {
+			return err
+		}
+		return f(tx, newScope(s.rules, cds))
+	})
+}
+
+// change works like do for methods that change the database.
+func (s ScopedStore) change(
+	t db.Transaction, f func(tx *sql.Tx, sc *scope) error) error {
+	if s.readOnly {
+		return findb.NoPermission
+	}
+	return s.do(t, f)
+}
+
+func (s ScopedStore) checkEntry(tx *sql.Tx, sc *scope, id int64) error {
+	var entry fin.Entry
+	if err := s.store.EntryById(tx, id, &entry); err != nil {
+		return err
+	}
+	if !sc.hasEntry(&entry) {
+		return findb.NoPermission
+	}
+	return nil
+}
+
+// checkEntryChange works like checkEntry for changes to the entry.
+func (s ScopedStore) checkEntryChange(tx *sql.Tx, sc *scope, id int64) error {
+	var entry fin.Entry
+	if err := s.store.EntryById(tx, id, &entry); err != nil {
+		return err
+	}
+	if !sc.canChange(&entry) {
+		return findb.NoPermission
+	}
+	return nil
+}
+
+func (s ScopedStore) checkRecurringEntry(
+	tx *sql.Tx, sc *scope, id int64) error {
+	var entry fin.RecurringEntry
+	if err := s.store.RecurringEntryById(tx, id, &entry); err != nil {
+		return err
+	}
+	if !sc.canChange(&entry.Entry) {
+		return findb.NoPermission
+	}
+	return nil
+}
+
+// scope tells what a set of access rules allows.
+type scope struct {
+	// nil means any account
+	accounts map[int64]bool
+	// nil means any category
+	cats []fin.Cat
+	cds  categories.CatDetailStore
+}
+
+func newScope(rules []fin.AccessRule, cds categories.CatDetailStore) *scope {
+	result := &scope{cds: cds}
+	for _, rule := range rules {
+		if rule.Cat.Type == fin.AccountCat {
+			if result.accounts == nil {
+				result.accounts = make(map[int64]bool)
+			}
+			result.accounts[rule.Cat.Id] = true
+		} else {
+			result.cats = append(result.cats, rule.Cat)
+		}
+	}
+	return result
+}
+
+func (s *scope) hasAccount(id int64) bool {
+	return s.accounts == nil || s.accounts[id]
+}
+
+// hasCat returns true if cat is an allowed account or falls under an
+// allowed category.
+func (s *scope) hasCat(cat fin.Cat) bool {
+	if cat.Type == fin.AccountCat {
+		return s.hasAccount(cat.Id)
+	}
+	if s.cats == nil {
+		return true
+	}
+	for _, allowed := range s.cats {
+		if s.cds.IsChildOf(cat, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasEntry returns true if entry touches an allowed account and all its
+// expense and income categories are allowed.
+func (s *scope) hasEntry(entry *fin.Entry) bool {
+	touchesAccount := s.hasAccount(entry.PaymentId())
+	for _, catrec := range entry.CatRecs() {
+		if catrec.Cat.Type == fin.AccountCat {
+			touchesAccount = touchesAccount || s.hasAccount(catrec.Cat.Id)
+		} else if !s.hasCat(catrec.Cat) {
+			return false
+		}
+	}
+	return touchesAccount
+}
+
+// canChange returns true if every account and category of entry is
+// allowed.
+func (s *scope) canChange(entry *fin.Entry) bool {
+	if !s.hasAccount(entry.PaymentId()) {
+		return false
+	}
+	for _, catrec := range entry.CatRecs() {
+		if !s.hasCat(catrec.Cat) {
+			return false
+		}
+	}
+	return true
+}
+
+// hideAccounts changes an allowed entry so that it shows no account that
+// is not allowed. If the payment account is not allowed, an allowed
+// account of entry becomes the payment account. hideAccounts replaces
+// the other accounts that are not allowed with account 0.
+func (s *scope) hideAccounts(entry *fin.Entry) {
+	if s.canChange(entry) {
+		return
+	}
+	if !s.hasAccount(entry.PaymentId()) {
+		for _, catrec := range entry.CatRecs() {
+			if catrec.Cat.Type == fin.AccountCat && s.hasAccount(catrec.Cat.Id) {
+				entry.WithPayment(catrec.Cat.Id)
+				break
+			}
+		}
+	}
+	var cpb fin.CatPaymentBuilder
+	cpb.Set(&entry.CatPayment).ClearCatRecs()
+	for _, catrec := range entry.CatRecs() {
+		if catrec.Cat.Type == fin.AccountCat && !s.hasAccount(catrec.Cat.Id) {
+			catrec.Cat.Id = 0
+		}
+		cpb.AddCatRec(catrec)
+	}
+	entry.CatPayment = cpb.Build()
+}
+
+// allowEntry returns true if entry is allowed. It hides the accounts of
+// entry that are not allowed.
+func (s *scope) allowEntry(entry *fin.Entry) bool {
+	if !s.hasEntry(entry) {
+		return false
+	}
+	s.hideAccounts(entry)
+	return true
+}
+
+// allowHistory returns true if both the before and after entries of a
+// change are allowed. It hides the accounts of those entries that are
+// not allowed.
+func (s *scope) allowHistory(history *fin.EntryHistory) bool {
+	if history.Before != nil && !s.hasEntry(history.Before) {
+		return false
+	}
+	if history.After != nil && !s.hasEntry(history.After) {
+		return false
+	}
+	if history.Before != nil {
+		s.hideAccounts(history.Before)
+	}
+	if history.After != nil {
+		s.hideAccounts(history.After)
+	}
+	return true
+}
+
+// canChangeHistory returns true if every account and category of both
+// the before and after entries of a change are allowed.
+func (s *scope) canChangeHistory(history *fin.EntryHistory) bool {
+	if history.Before != nil && !s.canChange(history.Before) {
+		return false
+	}
+	return history.After == nil || s.canChange(history.After)
+}
+
+// filterEntries returns the options and consumer to use so that only
+// allowed entries reach consumer. Since limits apply before filtering,
+// filterEntries moves any limit in options to the returned consumer.
+func (s *scope) filterEntries(
+	options *findb.EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) (
+	*findb.EntryListOptions, consume2.Consumer[fin.Entry]) {
+	if options != nil && options.Limit > 0 {
+		consumer = consume2.Slice(consumer, 0, options.Limit)
+		unlimited := *options
+		unlimited.Limit = 0
+		options = &unlimited
+	}
+	return options, consume2.Filterp(consumer, s.allowEntry)
+}
@@ -0,0 +1,338 @@
+package for_sqlite
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/categories"
+	"github.com/keep94/finances/fin/categories/categoriesdb"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+)
+
+const (
+	kChecking  = 1
+	kTeenDebit = 2
+)
+
+var (
+	kKids = fin.NewCat("0:1")
+	kToys = fin.NewCat("0:2")
+	kFood = fin.NewCat("0:3")
+)
+
+func TestScopedEntries(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := newScopedStore(t, db, ScopedWrapper)
+	var entries []fin.Entry
+	if err := store.Entries(nil, nil, consume2.AppendTo(&entries)); err != nil {
+		t.Fatalf("Got error reading entries: %v", err)
+	}
+	assertEntryNames(t, entries, "allowance", "toys")
+
+	entries = nil
+	err := store.Entries(
+		nil,
+		&findb.EntryListOptions{Limit: 1},
+		consume2.AppendTo(&entries))
+	if err != nil {
+		t.Fatalf("Got error reading entries: %v", err)
+	}
+	assertEntryNames(t, entries, "allowance")
+
+	var entry fin.Entry
+	if err := store.EntryById(nil, 2, &entry); err != findb.NoPermission {
+		t.Errorf("Expected NoPermission, got %v", err)
+	}
+	if err := store.EntryById(nil, 1, &entry); err != nil {
+		t.Errorf("Got error reading entry: %v", err)
+	}
+}
+
+func TestScopedAccounts(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := newScopedStore(t, db, ScopedWrapper)
+	var account fin.Account
+	err := store.AccountById(nil, kChecking, &account)
+	if err != findb.NoPermission {
+		t.Errorf("Expected NoPermission, got %v", err)
+	}
+	if err := store.AccountById(nil, kTeenDebit, &account); err != nil {
+		t.Errorf("Got error reading account: %v", err)
+	}
+	accounts, err := store.ActiveAccounts(nil)
+	if err != nil {
+		t.Fatalf("Got error reading accounts: %v", err)
+	}
+	if len(accounts) != 1 || accounts[0].Id != kTeenDebit {
+		t.Errorf("Expected only the teen debit account, got %v", accounts)
+	}
+}
+
+func TestScopedDoEntryChanges(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := newScopedStore(t, db, ScopedWrapper)
+	err := store.DoEntryChanges(nil, &findb.EntryChanges{
+		Adds: []*fin.Entry{newScopedEntry(5, "food", kFood, kTeenDebit)}})
+	if err != findb.NoPermission {
+		t.Errorf("Expected NoPermission adding, got %v", err)
+	}
+	err = store.DoEntryChanges(nil, &findb.EntryChanges{Deletes: []int64{2}})
+	if err != findb.NoPermission {
+		t.Errorf("Expected NoPermission deleting, got %v", err)
+	}
+	err = store.DoEntryChanges(nil, &findb.EntryChanges{
+		Updates: map[int64]fin.EntryUpdater{
+			1: func(entry *fin.Entry) bool {
+				entry.Name = "food"
+				entry.CatPayment = fin.NewCatPayment(
+					kFood, 500, false, kTeenDebit)
+				return true
+			}}})
+	if err != findb.NoPermission {
+		t.Errorf("Expected NoPermission updating, got %v", err)
+	}
+	var entry fin.Entry
+	if err := store.EntryById(nil, 1, &entry); err != nil {
+		t.Fatalf("Got error reading entry: %v", err)
+	}
+	if entry.Name != "toys" {
+		t.Errorf("Expected update to roll back, got %v", entry.Name)
+	}
+	err = store.DoEntryChanges(nil, &findb.EntryChanges{
+		Updates: map[int64]fin.EntryUpdater{
+			1: func(entry *fin.Entry) bool {
+				entry.Name = "more toys"
+				return true
+			}}})
+	if err != nil {
+		t.Errorf("Got error updating: %v", err)
+	}
+}
+
+func TestScopedHidesAccounts(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := newScopedStore(t, db, ScopedWrapper)
+	var entry fin.Entry
+	if err := store.EntryById(nil, 4, &entry); err != nil {
+		t.Fatalf("Got error reading entry: %v", err)
+	}
+	assertNoChecking(t, &entry)
+	if entry.PaymentId() != kTeenDebit {
+		t.Errorf("Expected teen debit payment, got %v", entry.PaymentId())
+	}
+	if entry.Total() != 500 {
+		t.Errorf("Expected 500 total, got %v", entry.Total())
+	}
+	var entries []fin.Entry
+	if err := store.Entries(nil, nil, consume2.AppendTo(&entries)); err != nil {
+		t.Fatalf("Got error reading entries: %v", err)
+	}
+	for i := range entries {
+		assertNoChecking(t, &entries[i])
+	}
+	var history []fin.EntryHistory
+	err := store.EntryHistory(nil, 4, consume2.AppendTo(&history))
+	if err != nil {
+		t.Fatalf("Got error reading history: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("Expected 1 history record, got %d", len(history))
+	}
+	assertNoChecking(t, history[0].After)
+}
+
+func TestScopedChangesNeedAllAccounts(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := newScopedStore(t, db, ScopedWrapper)
+	transfer := fin.Cat{Type: fin.AccountCat, Id: kChecking}
+	err := store.DoEntryChanges(nil, &findb.EntryChanges{
+		Adds: []*fin.Entry{newScopedEntry(5, "repay", transfer, kTeenDebit)}})
+	if err != findb.NoPermission {
+		t.Errorf("Expected NoPermission adding, got %v", err)
+	}
+	err = store.DoEntryChanges(nil, &findb.EntryChanges{
+		Updates: map[int64]fin.EntryUpdater{
+			4: func(entry *fin.Entry) bool {
+				entry.Name = "more allowance"
+				return true
+			}}})
+	if err != findb.NoPermission {
+		t.Errorf("Expected NoPermission updating, got %v", err)
+	}
+	err = store.DoEntryChanges(nil, &findb.EntryChanges{Deletes: []int64{4}})
+	if err != findb.NoPermission {
+		t.Errorf("Expected NoPermission deleting, got %v", err)
+	}
+	recurring := fin.RecurringEntry{
+		Entry:  *newScopedEntry(5, "repay", transfer, kTeenDebit),
+		Period: fin.RecurringPeriod{Count: 1, Unit: fin.Months}}
+	if err := store.AddRecurringEntry(nil, &recurring); err != findb.NoPermission {
+		t.Errorf("Expected NoPermission adding recurring entry, got %v", err)
+	}
+}
+
+func TestReadOnlyScoped(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := newScopedStore(t, db, ReadOnlyScopedWrapper)
+	err := store.DoEntryChanges(nil, &findb.EntryChanges{
+		Adds: []*fin.Entry{newScopedEntry(5, "toys", kToys, kTeenDebit)}})
+	if err != findb.NoPermission {
+		t.Errorf("Expected NoPermission, got %v", err)
+	}
+	var entry fin.Entry
+	if err := store.EntryById(nil, 1, &entry); err != nil {
+		t.Errorf("Got error reading entry: %v", err)
+	}
+}
+
+func TestScopedAttachmentContents(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	scoped := newScopedStore(t, db, ScopedWrapper)
+	store := New(db)
+	// Entry 2 is a parent toys entry in checking.
+	hidden := fin.Attachment{EntryId: 2, Name: "hidden.png"}
+	if err := store.AddAttachment(nil, &hidden, []byte("hidden")); err != nil {
+		t.Fatalf("Got error adding attachment: %v", err)
+	}
+	allowed := fin.Attachment{EntryId: 1, Name: "allowed.png"}
+	if err := store.AddAttachment(nil, &allowed, []byte("allowed")); err != nil {
+		t.Fatalf("Got error adding attachment: %v", err)
+	}
+	if _, err := scoped.AttachmentContents(nil, hidden.Hash); err != findb.NoPermission {
+		t.Errorf("Expected NoPermission, got %v", err)
+	}
+	contents, err := scoped.AttachmentContents(nil, allowed.Hash)
+	if err != nil || string(contents) != "allowed" {
+		t.Errorf("Expected allowed contents, got %q %v", contents, err)
+	}
+	if _, err := scoped.AttachmentContents(nil, "nosuchhash"); err != findb.NoSuchId {
+		t.Errorf("Expected NoSuchId, got %v", err)
+	}
+}
+
+func TestScopedCache(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	cache := newScopedStore(t, db, ScopedWrapper).Cache()
+	cds, err := cache.Get(nil)
+	if err != nil {
+		t.Fatalf("Got error reading categories: %v", err)
+	}
+	var names []string
+	for _, detail := range cds.ActiveCatDetails(true) {
+		names = append(names, detail.FullName())
+	}
+	expected := []string{"expense:kids", "expense:kids:toys", "account:teen debit"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+	accounts := cds.ActiveAccountDetails()
+	if len(accounts) != 1 || accounts[0].Id() != kTeenDebit {
+		t.Errorf("Expected only the teen debit account, got %v", accounts)
+	}
+	if _, _, err := cache.Add(nil, "expense:kids:books"); err != categoriesdb.NoPermission {
+		t.Errorf("Expected NoPermission, got %v", err)
+	}
+}
+
+// newScopedStore adds a checking account, a teen debit account, and four
+// entries to db. Then it returns a store limited to the teen debit
+// account and the kids category.
+func newScopedStore(
+	t *testing.T,
+	dbase *sqlite3_db.Db,
+	wrapper func(
+		Store, categoriesdb.Getter, []fin.AccessRule) ScopedStore,
+) ScopedStore {
+	store := New(dbase)
+	var cdsb categories.CatDetailStoreBuilder
+	for _, name := range []string{"checking", "teen debit"} {
+		account := fin.Account{Name: name, Active: true}
+		if err := store.AddAccount(nil, &account); err != nil {
+			t.Fatalf("Got error adding account: %v", err)
+		}
+		cdsb.AddAccount(&account)
+	}
+	cdsb.AddCatDbRow(
+		fin.ExpenseCat,
+		&categories.CatDbRow{Id: kKids.Id, Name: "kids", Active: true})
+	cdsb.AddCatDbRow(
+		fin.ExpenseCat,
+		&categories.CatDbRow{
+			Id: kToys.Id, ParentId: kKids.Id, Name: "toys", Active: true})
+	cdsb.AddCatDbRow(
+		fin.ExpenseCat,
+		&categories.CatDbRow{Id: kFood.Id, Name: "food", Active: true})
+	err := store.DoEntryChanges(nil, &findb.EntryChanges{
+		Adds: []*fin.Entry{
+			newScopedEntry(1, "toys", kToys, kTeenDebit),
+			newScopedEntry(2, "parent toys", kToys, kChecking),
+			newScopedEntry(3, "food", kFood, kTeenDebit),
+			newScopedEntry(
+				4,
+				"allowance",
+				fin.Cat{Type: fin.AccountCat, Id: kTeenDebit},
+				kChecking),
+		}})
+	if err != nil {
+		t.Fatalf("Got error adding entries: %v", err)
+	}
+	rules := []fin.AccessRule{
+		{UserName: "teen", Cat: fin.Cat{Type: fin.AccountCat, Id: kTeenDebit}},
+		{UserName: "teen", Cat: kKids},
+	}
+	return wrapper(store, cdsGetter{cdsb.Build()}, rules)
+}
+
+func newScopedEntry(
+	day int, name string, cat fin.Cat, paymentId int64) *fin.Entry {
+	return &fin.Entry{
+		Date:       time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC),
+		Name:       name,
+		CatPayment: fin.NewCatPayment(cat, 500, false, paymentId),
+	}
+}
+
+func assertEntryNames(t *testing.T, entries []fin.Entry, names ...string) {
+	t.Helper()
+	if len(entries) != len(names) {
+		t.Fatalf("Expected %d entries, got %d", len(names), len(entries))
+	}
+	for i := range names {
+		if entries[i].Name != names[i] {
+			t.Errorf("Expected %s, got %s", names[i], entries[i].Name)
+		}
+	}
+}
+
+func assertNoChecking(t *testing.T, entry *fin.Entry) {
+	t.Helper()
+	if entry.PaymentId() == kChecking {
+		t.Errorf("Expected checking account hidden, got payment %v", entry.PaymentId())
+	}
+	for _, catrec := range entry.CatRecs() {
+		if catrec.Cat == (fin.Cat{Type: fin.AccountCat, Id: kChecking}) {
+			t.Errorf("Expected checking account hidden, got %v", catrec.Cat)
+		}
+	}
+}
+
+type cdsGetter struct {
+	cds categories.CatDetailStore
+}
+
+func (g cdsGetter) Get(t db.Transaction) (categories.CatDetailStore, error) {
+	return g.cds, nil
+}
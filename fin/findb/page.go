@@ -0,0 +1,264 @@
+package findb
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/filters"
+	"github.com/keep94/toolbox/db"
+)
+
+var (
+	BadPageToken = errors.New("findb: Bad page token.")
+)
+
+const (
+	kPageTokenDateFormat = "20060102"
+)
+
+// EntryCursor marks a position in the list of entries ordered from most
+// to least recent. Entries are ordered by date and then by id.
+type EntryCursor struct {
+	Date time.Time
+	Id   int64
+}
+
+// CursorOf returns the cursor at entry.
+func CursorOf(entry *fin.Entry) EntryCursor {
+	return EntryCursor{Date: entry.Date, Id: entry.Id}
+}
+
+// Precedes returns true if entry comes after this cursor in the list of
+// entries ordered from most to least recent.
+func (c *EntryCursor) Precedes(entry *fin.Entry) bool {
+	if entry.Date.Equal(c.Date) {
+		return entry.Id < c.Id
+	}
+	return entry.Date.Before(c.Date)
+}
+
+// EncodePageToken returns the opaque token for the page of entries that
+// starts right after cursor. The token holds only the position so
+// clients cannot use it to change what the server reports.
+func EncodePageToken(cursor EntryCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(
+		"%s:%d", cursor.Date.Format(kPageTokenDateFormat), cursor.Id)))
+}
+
+// DecodePageToken decodes a token from EncodePageToken. It returns
+// BadPageToken if token is not valid.
+func DecodePageToken(token string) (cursor EntryCursor, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return EntryCursor{}, BadPageToken
+	}
+	var dateStr string
+	if _, err = fmt.Sscanf(
+		string(raw), "%8s:%d", &dateStr, &cursor.Id); err != nil {
+		return EntryCursor{}, BadPageToken
+	}
+	cursor.Date, err = time.Parse(kPageTokenDateFormat, dateStr)
+	if err != nil {
+		return EntryCursor{}, BadPageToken
+	}
+	return
+}
+
+type EntriesPageRunner interface {
+	// EntriesPage gets one page of the entries that options selects from
+	// most to least recent. options may be nil; options.After and
+	// options.Limit are ignored. token is the empty string for the first
+	// page or the token that EntriesPage returned for the previous page.
+	// pageSize is the maximum number of entries on the page. EntriesPage
+	// returns the token for the next page or the empty string if there
+	// are no more pages. EntriesPage returns BadPageToken if token is not
+	// valid.
+	EntriesPage(
+		t db.Transaction,
+		options *EntryListOptions,
+		token string,
+		pageSize int,
+		consumer consume2.Consumer[fin.Entry]) (next string, err error)
+}
+
+// EntriesPage implements EntriesPageRunner on top of store. store must
+// honor the After and Limit fields of EntryListOptions.
+func EntriesPage(
+	t db.Transaction,
+	store EntriesRunner,
+	options *EntryListOptions,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.Entry]) (next string, err error) {
+	pager, err := NewEntryPager(token, pageSize)
+	if err != nil {
+		return "", err
+	}
+	var paged EntryListOptions
+	if options != nil {
+		paged = *options
+	}
+	paged.After = pager.After()
+	paged.Limit = pageSize + 1
+	if err = store.Entries(t, &paged, pager); err != nil {
+		return "", err
+	}
+	entries, next := pager.Build()
+	for i := range entries {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(entries[i])
+	}
+	return next, nil
+}
+
+// EntryPager builds one page of entries listed from most to least
+// recent. EntryPager ignores entries that come before the page's token so
+// it works even when the store cannot skip them.
+type EntryPager struct {
+	after    *EntryCursor
+	pageSize int
+	entries  []fin.Entry
+}
+
+// NewEntryPager returns an EntryPager for the page that token
+// identifies. token is the empty string for the first page. pageSize
+// must be positive.
+func NewEntryPager(token string, pageSize int) (*EntryPager, error) {
+	if pageSize <= 0 {
+		panic("pageSize must be positive")
+	}
+	result := &EntryPager{pageSize: pageSize}
+	if token != "" {
+		cursor, err := DecodePageToken(token)
+		if err != nil {
+			return nil, err
+		}
+		result.after = &cursor
+	}
+	return result, nil
+}
+
+// After returns the position that the page starts after or nil for the
+// first page. Callers may store it in EntryListOptions.After.
+func (p *EntryPager) After() *EntryCursor {
+	return p.after
+}
+
+func (p *EntryPager) CanConsume() bool {
+	return len(p.entries) <= p.pageSize
+}
+
+func (p *EntryPager) Consume(entry fin.Entry) {
+	if p.after != nil && !p.after.Precedes(&entry) {
+		return
+	}
+	if p.CanConsume() {
+		p.entries = append(p.entries, entry)
+	}
+}
+
+// Build returns the entries on the page and the token for the next
+// page. The token is the empty string if there are no more pages.
+func (p *EntryPager) Build() (entries []fin.Entry, next string) {
+	if len(p.entries) <= p.pageSize {
+		return p.entries, ""
+	}
+	entries = p.entries[:p.pageSize]
+	return entries, EncodePageToken(CursorOf(&entries[p.pageSize-1]))
+}
+
+type EntriesByAccountIdPageRunner interface {
+	EntriesPageRunner
+	EntriesRunner
+	AccountByIdRunner
+}
+
+// EntriesByAccountIdPage gets one page of entries by account id from
+// most to least recent. token and pageSize work the same way as in
+// EntriesPageRunner. account, which can be nil, is where Account object
+// is stored; consumer consumes the fin.EntryBalance values. The balance
+// at the start of a later page comes from the current account balance
+// and the entries before that page, never from token. t must be
+// non-nil.
+func EntriesByAccountIdPage(
+	t db.Transaction,
+	store EntriesByAccountIdPageRunner,
+	acctId int64,
+	account *fin.Account,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.EntryBalance]) (next string, err error) {
+	if t == nil {
+		panic(kNonNilTransactionRequired)
+	}
+	if account == nil {
+		account = &fin.Account{}
+	}
+	if err = store.AccountById(t, acctId, account); err != nil {
+		return "", err
+	}
+	balance := account.Balance
+	if token != "" {
+		cursor, err := DecodePageToken(token)
+		if err != nil {
+			return "", err
+		}
+		balance, err = balanceAfter(t, store, acctId, balance, cursor)
+		if err != nil {
+			return "", err
+		}
+	}
+	var entries []fin.Entry
+	next, err = store.EntriesPage(
+		t,
+		&EntryListOptions{AccountId: acctId},
+		token,
+		pageSize,
+		consume2.AppendTo(&entries))
+	if err != nil {
+		return "", err
+	}
+	withBalance := filters.WithBalance(balance)
+	for _, entry := range entries {
+		if !entry.WithPayment(acctId) {
+			continue
+		}
+		eb := withBalance(entry)
+		if consumer.CanConsume() {
+			consumer.Consume(eb)
+		}
+	}
+	return next, nil
+}
+
+// balanceAfter returns what the balance of account acctId was just
+// before the entries that come after cursor. balance is the current
+// balance of the account. balanceAfter backs out each entry of the
+// account from the most recent one through the one at cursor.
+func balanceAfter(
+	t db.Transaction,
+	store EntriesRunner,
+	acctId int64,
+	balance int64,
+	cursor EntryCursor) (int64, error) {
+	start := cursor.Date
+	err := store.Entries(
+		t,
+		&EntryListOptions{AccountId: acctId, Start: &start},
+		consume2.Call(func(entry fin.Entry) {
+			if cursor.Precedes(&entry) || !entry.WithPayment(acctId) {
+				return
+			}
+			balance -= entry.Total()
+		}))
+	if err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
@@ -0,0 +1,144 @@
+// Package postgres_setup sets up a PostgreSQL database for personal finance.
+package postgres_setup
+
+import (
+	"database/sql"
+)
+
+// SetUpTables creates all needed tables in database.
+func SetUpTables(tx *sql.Tx) error {
+	_, err := tx.Exec("create table if not exists accounts (id BIGSERIAL PRIMARY KEY, name TEXT, is_active BOOLEAN, balance BIGINT, reconciled BIGINT, b_count BIGINT, r_count BIGINT, import_sd TEXT, currency TEXT NOT NULL DEFAULT '')")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`create table if not exists entries (id BIGSERIAL PRIMARY KEY, date TEXT, name TEXT, cats TEXT, payment TEXT, "desc" TEXT, check_no TEXT, reviewed INTEGER, rate DOUBLE PRECISION NOT NULL DEFAULT 0, tags TEXT NOT NULL DEFAULT '')`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists entries_date_id_idx on entries (date, id)")
+	if err != nil {
+		return err
+	}
+	// The tags of each entry so that queries by tag need not decode
+	// every entry
+	_, err = tx.Exec("create table if not exists entry_tags (entry_id BIGINT NOT NULL, tag TEXT NOT NULL, PRIMARY KEY (entry_id, tag))")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists entry_tags_tag_idx on entry_tags (tag, entry_id)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`create table if not exists recurring_entries (id BIGSERIAL PRIMARY KEY, date TEXT, name TEXT, cats TEXT, payment TEXT, "desc" TEXT, check_no TEXT, reviewed INTEGER, count INTEGER, unit INTEGER, num_left INTEGER, day_of_month INTEGER, rate DOUBLE PRECISION NOT NULL DEFAULT 0, tags TEXT NOT NULL DEFAULT '')`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists expense_categories (id BIGSERIAL PRIMARY KEY, name TEXT, is_active BOOLEAN, parent_id BIGINT)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists income_categories (id BIGSERIAL PRIMARY KEY, name TEXT, is_active BOOLEAN, parent_id BIGINT)")
+	if err != nil {
+		return err
+	}
+	// App servers cache the categories and reload them when this version
+	// changes.
+	_, err = tx.Exec("create sequence if not exists category_version_seq")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists category_version (version BIGINT NOT NULL)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("insert into category_version (version) select 0 where not exists (select 1 from category_version)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists users (id BIGSERIAL PRIMARY KEY, name TEXT, go_password TEXT, permission INTEGER, last_login BIGINT)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create unique index if not exists users_name_idx on users (name)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists qfx_fitids (acct_id BIGINT, fit_id TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create unique index if not exists qfx_fitids_acct_id_fit_id_idx on qfx_fitids (acct_id, fit_id)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("alter table qfx_fitids add column if not exists change_id BIGINT NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists qfx_fitids_change_id_idx on qfx_fitids (change_id)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists allocations (expense_id BIGINT, year INTEGER, amount BIGINT, PRIMARY KEY (expense_id, year))")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists attachments (id BIGSERIAL PRIMARY KEY, entry_id BIGINT, name TEXT, content_type TEXT, hash TEXT, size BIGINT, added BIGINT)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists attachments_entry_id_idx on attachments (entry_id)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists blobs (hash TEXT PRIMARY KEY, contents BYTEA)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists entry_history (id BIGSERIAL PRIMARY KEY, entry_id BIGINT, user_id BIGINT, time BIGINT, old_entry TEXT, new_entry TEXT, change_id BIGINT NOT NULL DEFAULT 0)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists entry_history_entry_id_idx on entry_history (entry_id)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists entry_history_change_id_idx on entry_history (change_id)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists change_sets (id BIGSERIAL PRIMARY KEY, user_id BIGINT, time BIGINT, undoes BIGINT NOT NULL DEFAULT 0, undone INTEGER NOT NULL DEFAULT 0)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`create table if not exists trashed_entries (id BIGINT PRIMARY KEY, date TEXT, name TEXT, cats TEXT, payment TEXT, "desc" TEXT, check_no TEXT, reviewed INTEGER, rate DOUBLE PRECISION NOT NULL DEFAULT 0, tags TEXT NOT NULL DEFAULT '', trashed BIGINT NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists trashed_entries_trashed_idx on trashed_entries (trashed)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`create table if not exists trashed_recurring_entries (id BIGINT PRIMARY KEY, date TEXT, name TEXT, cats TEXT, payment TEXT, "desc" TEXT, check_no TEXT, reviewed INTEGER, count INTEGER, unit INTEGER, num_left INTEGER, day_of_month INTEGER, rate DOUBLE PRECISION NOT NULL DEFAULT 0, tags TEXT NOT NULL DEFAULT '', trashed BIGINT NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists access_rules (id BIGSERIAL PRIMARY KEY, user_name TEXT NOT NULL, cat TEXT NOT NULL)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists access_rules_user_name_idx on access_rules (user_name)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create table if not exists api_tokens (id BIGSERIAL PRIMARY KEY, user_id BIGINT NOT NULL, name TEXT NOT NULL, hash TEXT NOT NULL, permission INTEGER NOT NULL, book TEXT NOT NULL, account_ids TEXT NOT NULL, created BIGINT NOT NULL, last_used BIGINT NOT NULL)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create unique index if not exists api_tokens_hash_idx on api_tokens (hash)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists api_tokens_user_id_idx on api_tokens (user_id)")
+	return err
+}
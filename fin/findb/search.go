@@ -0,0 +1,179 @@
+package findb
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/toolbox/db"
+)
+
+type SearchEntriesRunner interface {
+	// SearchEntries gets the entries whose name, description, or check
+	// number match query from best to worst match. Stores that cannot
+	// rank matches list them from most to least recent. query is parsed
+	// with ParseSearchQuery. options may be nil; if not, SearchEntries
+	// lists only the matching entries that options selects.
+	SearchEntries(
+		t db.Transaction,
+		query string,
+		options *EntryListOptions,
+		consumer consume2.Consumer[fin.Entry]) error
+}
+
+// SearchEntries gets the entries in store that match query from most to
+// least recent. Stores without a full text index use SearchEntries to
+// implement SearchEntriesRunner.
+func SearchEntries(
+	t db.Transaction,
+	store EntriesRunner,
+	query string,
+	options *EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	parsed := ParseSearchQuery(query)
+	if len(parsed) == 0 {
+		return nil
+	}
+	var limited EntryListOptions
+	if options != nil {
+		limited = *options
+	}
+	if limited.Limit > 0 {
+		consumer = consume2.Slice(consumer, 0, limited.Limit)
+		limited.Limit = 0
+	}
+	consumer = consume2.Filterp(consumer, func(ptr *fin.Entry) bool {
+		return parsed.Matches(ptr.Name, ptr.Desc, ptr.CheckNo)
+	})
+	return store.Entries(t, &limited, consumer)
+}
+
+// SearchTerm is a single word, a phrase, or a prefix in a search query.
+type SearchTerm struct {
+	// The lower case words of the term. A phrase has more than one word.
+	Words []string
+	// If true, the last word matches any word that starts with it.
+	Prefix bool
+}
+
+// SearchQuery is a parsed search query. Text matches a SearchQuery if it
+// matches every clause. Text matches a clause if it matches any term
+// in the clause.
+type SearchQuery [][]SearchTerm
+
+// ParseSearchQuery parses a search query. Words in the query separated
+// by spaces must all match. Double quotes enclose a phrase. OR between
+// two words or phrases means that either may match. A * at the end of a
+// word or phrase makes its last word match any word starting with it.
+// Matching ignores case and punctuation.
+func ParseSearchQuery(query string) SearchQuery {
+	var result SearchQuery
+	joinNext := false
+	for query != "" {
+		var token string
+		var prefix, phrase bool
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+		if query == "" {
+			break
+		}
+		if query[0] == '"' {
+			end := strings.IndexByte(query[1:], '"')
+			if end == -1 {
+				token, query = query[1:], ""
+			} else {
+				token, query = query[1:end+1], query[end+2:]
+			}
+			phrase = true
+			if strings.HasPrefix(query, "*") {
+				prefix = true
+				query = query[1:]
+			}
+		} else {
+			end := strings.IndexFunc(query, func(r rune) bool {
+				return unicode.IsSpace(r) || r == '"'
+			})
+			if end == -1 {
+				end = len(query)
+			}
+			token, query = query[:end], query[end:]
+			if token == "OR" {
+				joinNext = len(result) > 0
+				continue
+			}
+			prefix = strings.HasSuffix(token, "*")
+		}
+		words := searchWords(token)
+		if len(words) == 0 {
+			if !phrase {
+				joinNext = false
+			}
+			continue
+		}
+		term := SearchTerm{Words: words, Prefix: prefix}
+		if joinNext {
+			last := len(result) - 1
+			result[last] = append(result[last], term)
+		} else {
+			result = append(result, []SearchTerm{term})
+		}
+		joinNext = false
+	}
+	return result
+}
+
+// Matches returns true if texts together match this query. Each phrase
+// has to match within a single text.
+func (q SearchQuery) Matches(texts ...string) bool {
+	words := make([][]string, len(texts))
+	for i := range texts {
+		words[i] = searchWords(texts[i])
+	}
+	for _, clause := range q {
+		if !clauseMatches(clause, words) {
+			return false
+		}
+	}
+	return true
+}
+
+func clauseMatches(clause []SearchTerm, words [][]string) bool {
+	for _, term := range clause {
+		for _, textWords := range words {
+			if term.matches(textWords) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t SearchTerm) matches(words []string) bool {
+	for start := 0; start+len(t.Words) <= len(words); start++ {
+		if t.matchesAt(words[start:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t SearchTerm) matchesAt(words []string) bool {
+	last := len(t.Words) - 1
+	for i := 0; i < last; i++ {
+		if words[i] != t.Words[i] {
+			return false
+		}
+	}
+	if t.Prefix {
+		return strings.HasPrefix(words[last], t.Words[last])
+	}
+	return words[last] == t.Words[last]
+}
+
+// searchWords splits s into lower case words made up of letters and
+// digits.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
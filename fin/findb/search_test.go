@@ -0,0 +1,38 @@
+package findb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(
+		SearchQuery{
+			{{Words: []string{"costco"}}},
+			{{Words: []string{"gas", "station"}, Prefix: true}},
+			{
+				{Words: []string{"refund"}},
+				{Words: []string{"juice"}, Prefix: true},
+			},
+		},
+		ParseSearchQuery(`Costco "gas  STATION"* refund OR juice*`))
+	assert.Equal(
+		SearchQuery{{{Words: []string{"it", "s"}}}},
+		ParseSearchQuery(`"it's`))
+	assert.Empty(ParseSearchQuery(` "" * OR -- `))
+	assert.Equal(
+		SearchQuery{{{Words: []string{"or"}}}, {{Words: []string{"x"}}}},
+		ParseSearchQuery("OR or x"))
+}
+
+func TestSearchQueryMatches(t *testing.T) {
+	assert := assert.New(t)
+	query := ParseSearchQuery(`"costco gas" OR safeway fuel*`)
+	assert.True(query.Matches("Costco Gas #123", "Fuel up"))
+	assert.True(query.Matches("Safeway", "fueling"))
+	assert.False(query.Matches("Costco", "Gas fuel"))
+	assert.False(query.Matches("Safeway", "gas"))
+	assert.True(ParseSearchQuery("").Matches("anything"))
+}
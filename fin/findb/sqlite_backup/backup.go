@@ -0,0 +1,347 @@
+// Package sqlite_backup takes compressed snapshots of a live ledger
+// sqlite database and restores them.
+package sqlite_backup
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	csqlite "github.com/keep94/finances/fin/categories/categoriesdb/for_sqlite"
+	"github.com/keep94/finances/fin/findb/for_sqlite"
+	"github.com/keep94/finances/fin/findb/sqlite_setup"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	kTimeFormat = "20060102150405"
+	kSuffix     = ".db.gz"
+)
+
+var (
+	MalformedEntries = errors.New(
+		"sqlite_backup: Snapshot has entries that cannot be read.")
+)
+
+// Snapshot writes a gzip compressed copy of the live database rawdb to a
+// new file in dir and returns the path of that file. The file is named
+// prefix.YYYYMMDDhhmmss.db.gz after now. Snapshot uses the sqlite online
+// backup API, so the copy is consistent even while other connections keep
+// using rawdb.
+func Snapshot(rawdb *sql.DB, dir, prefix string, now time.Time) (
+	snapshotPath string, err error) {
+	snapshotPath = filepath.Join(
+		dir, fmt.Sprintf("%s.%s%s", prefix, now.Format(kTimeFormat), kSuffix))
+	if _, err = os.Stat(snapshotPath); err == nil {
+		return "", fmt.Errorf(
+			"sqlite_backup: Snapshot %s already exists.", snapshotPath)
+	}
+	tempDb, err := os.CreateTemp(dir, "."+prefix+".*.db")
+	if err != nil {
+		return "", err
+	}
+	tempDb.Close()
+	defer os.Remove(tempDb.Name())
+	if err = copyDb(rawdb, tempDb.Name()); err != nil {
+		return "", err
+	}
+	if err = compress(tempDb.Name(), snapshotPath); err != nil {
+		return "", err
+	}
+	return snapshotPath, nil
+}
+
+// Prefix returns the prefix to use in the names of the snapshots of the
+// database file at dbPath. For "/var/ledger.db" it returns "ledger".
+func Prefix(dbPath string) string {
+	base := filepath.Base(dbPath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Snapshots returns the paths of the snapshots in dir with given prefix
+// from newest to oldest.
+func Snapshots(dir, prefix string) ([]string, error) {
+	matches, err := filepath.Glob(
+		filepath.Join(dir, escapeGlob(prefix)+".*"+kSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, match := range matches {
+		if _, ok := snapshotTime(match, prefix); ok {
+			result = append(result, match)
+		}
+	}
+	// The timestamps in the names sort the same way as the times.
+	slices.Sort(result)
+	slices.Reverse(result)
+	return result, nil
+}
+
+// Rotate removes all but the newest keep snapshots in dir with given
+// prefix. It returns the paths of the snapshots it removed.
+func Rotate(dir, prefix string, keep int) (removed []string, err error) {
+	snapshots, err := Snapshots(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	for _, snapshot := range snapshots[min(keep, len(snapshots)):] {
+		if err = os.Remove(snapshot); err != nil {
+			return removed, err
+		}
+		removed = append(removed, snapshot)
+	}
+	return removed, nil
+}
+
+// RestoreResult is what Restore did.
+type RestoreResult struct {
+	// Where Restore moved the database that the snapshot replaced. Empty
+	// if there was no database.
+	OldPath string
+
+	// Accounts whose totals Restore recomputed
+	FixedAccounts []for_sqlite.AccountProblem
+}
+
+// Restore replaces the database file at dbPath with the snapshot at
+// snapshotPath. Restore first unpacks the snapshot next to dbPath, runs
+// the sqlite integrity check on it, brings its schema up to date, and
+// recomputes account totals from its entries. Only then does Restore
+// move the database at dbPath aside to a file named after now and put
+// the unpacked snapshot in its place. Nothing else may have the database
+// at dbPath open while Restore runs.
+func Restore(snapshotPath, dbPath string, now time.Time) (
+	*RestoreResult, error) {
+	tempDb, err := os.CreateTemp(
+		filepath.Dir(dbPath), "."+filepath.Base(dbPath)+".*.restore")
+	if err != nil {
+		return nil, err
+	}
+	tempDb.Close()
+	defer os.Remove(tempDb.Name())
+	if err = decompress(snapshotPath, tempDb.Name()); err != nil {
+		return nil, err
+	}
+	fixed, err := prepare(tempDb.Name())
+	if err != nil {
+		return nil, err
+	}
+	result := &RestoreResult{FixedAccounts: fixed}
+	if _, err = os.Stat(dbPath); err == nil {
+		result.OldPath = fmt.Sprintf(
+			"%s.%s.bak", dbPath, now.Format(kTimeFormat))
+		if err = os.Rename(dbPath, result.OldPath); err != nil {
+			return nil, err
+		}
+		// A journal left next to dbPath belongs to the old database.
+		for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+			err = os.Rename(dbPath+suffix, result.OldPath+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err = os.Rename(tempDb.Name(), dbPath); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// prepare checks the unpacked snapshot at path and gets it ready to
+// replace the live database.
+func prepare(path string) ([]for_sqlite.AccountProblem, error) {
+	rawdb, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	dbase := sqlite3_db.New(rawdb)
+	defer dbase.Close()
+	if err = integrityCheck(rawdb); err != nil {
+		return nil, err
+	}
+	if err = dbase.Do(sqlite_setup.Migrate); err != nil {
+		return nil, err
+	}
+	cache := csqlite.New(dbase)
+	store := for_sqlite.New(dbase)
+	var fixed []for_sqlite.AccountProblem
+	err = sqlite3_db.NewDoer(dbase).Do(func(t db.Transaction) error {
+		cds, err := cache.Get(t)
+		if err != nil {
+			return err
+		}
+		result, err := store.Check(t, cds)
+		if err != nil {
+			return err
+		}
+		if result.HasMalformedEntries() {
+			return MalformedEntries
+		}
+		fixed = result.Accounts
+		return store.FixAccounts(t, fixed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fixed, nil
+}
+
+func integrityCheck(rawdb *sql.DB) error {
+	rows, err := rawdb.Query("pragma integrity_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var messages []string
+	for rows.Next() {
+		var message string
+		if err = rows.Scan(&message); err != nil {
+			return err
+		}
+		messages = append(messages, message)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(messages) != 1 || messages[0] != "ok" {
+		return fmt.Errorf(
+			"sqlite_backup: Integrity check failed: %s",
+			strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// copyDb copies the database rawdb to the empty database file at path
+// with the sqlite online backup API.
+func copyDb(rawdb *sql.DB, path string) error {
+	destDb, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer destDb.Close()
+	ctx := context.Background()
+	srcConn, err := rawdb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	destConn, err := destDb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			backup, err := destDriverConn.(*sqlite3.SQLiteConn).Backup(
+				"main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err = backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// compress writes a gzip compressed copy of the file at src to a new file
+// at dest. dest appears only once it is complete.
+func compress(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeAtomically(dest, func(out io.Writer) error {
+		zw := gzip.NewWriter(out)
+		zw.Name = filepath.Base(strings.TrimSuffix(dest, ".gz"))
+		if _, err := io.Copy(zw, in); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+}
+
+// decompress writes the contents of the gzip compressed file at src to
+// dest.
+func decompress(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, zr); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func writeAtomically(path string, write func(w io.Writer) error) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if err = write(temp); err != nil {
+		temp.Close()
+		return err
+	}
+	if err = temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// snapshotTime returns the time in the name of the snapshot at path.
+func snapshotTime(path, prefix string) (time.Time, bool) {
+	name := filepath.Base(path)
+	if !strings.HasPrefix(name, prefix+".") || !strings.HasSuffix(name, kSuffix) {
+		return time.Time{}, false
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix+"."), kSuffix)
+	result, err := time.Parse(kTimeFormat, stamp)
+	return result, err == nil
+}
+
+func escapeGlob(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,165 @@
+package sqlite_backup
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/findb"
+	"github.com/keep94/finances/fin/findb/for_sqlite"
+	"github.com/keep94/finances/fin/findb/sqlite_setup"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	"github.com/stretchr/testify/assert"
+)
+
+var kNow = time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+
+func TestSnapshotAndRotate(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	rawdb := createDb(t, filepath.Join(dir, "ledger.db"))
+	defer rawdb.Close()
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path, err := Snapshot(rawdb, dir, "ledger", kNow.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("Error taking snapshot: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	assert.Equal(filepath.Join(dir, "ledger.20240309140507.db.gz"), paths[0])
+	_, err := Snapshot(rawdb, dir, "ledger", kNow)
+	assert.Error(err)
+
+	// Files that are not snapshots stay put.
+	other := filepath.Join(dir, "ledger.latest.db.gz")
+	if err = os.WriteFile(other, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := Snapshots(dir, "ledger")
+	assert.NoError(err)
+	assert.Equal([]string{paths[2], paths[1], paths[0]}, snapshots)
+
+	removed, err := Rotate(dir, "ledger", 2)
+	assert.NoError(err)
+	assert.Equal([]string{paths[0]}, removed)
+	snapshots, err = Snapshots(dir, "ledger")
+	assert.NoError(err)
+	assert.Equal([]string{paths[2], paths[1]}, snapshots)
+	assert.FileExists(other)
+}
+
+func TestRestore(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "ledger.db")
+	rawdb := createDb(t, dbPath)
+	// Corrupt the totals of account 1 so that Restore has to fix them.
+	if _, err := rawdb.Exec("update accounts set balance = 5 where id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	snapshotPath, err := Snapshot(rawdb, dir, "ledger", kNow)
+	if err != nil {
+		t.Fatalf("Error taking snapshot: %v", err)
+	}
+	// A change made after the snapshot which Restore should undo.
+	if _, err = rawdb.Exec("delete from entries"); err != nil {
+		t.Fatal(err)
+	}
+	rawdb.Close()
+
+	result, err := Restore(snapshotPath, dbPath, kNow.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Error restoring: %v", err)
+	}
+	assert.Equal(dbPath+".20240309150507.bak", result.OldPath)
+	assert.FileExists(result.OldPath)
+	if assert.Len(result.FixedAccounts, 1) {
+		assert.Equal(int64(1), result.FixedAccounts[0].Account.Id)
+		assert.Equal(int64(-300), result.FixedAccounts[0].Balance)
+	}
+
+	rawdb, dbase := openDb(t, dbPath)
+	defer rawdb.Close()
+	store := for_sqlite.New(dbase)
+	var entry fin.Entry
+	assert.NoError(store.EntryById(nil, 1, &entry))
+	var account fin.Account
+	assert.NoError(store.AccountById(nil, 1, &account))
+	assert.Equal(int64(-300), account.Balance)
+}
+
+func TestRestoreMalformed(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "ledger.db")
+	rawdb := createDb(t, dbPath)
+	if _, err := rawdb.Exec("update entries set payment = 'bad'"); err != nil {
+		t.Fatal(err)
+	}
+	snapshotPath, err := Snapshot(rawdb, dir, "ledger", kNow)
+	if err != nil {
+		t.Fatalf("Error taking snapshot: %v", err)
+	}
+	rawdb.Close()
+	_, err = Restore(snapshotPath, dbPath, kNow)
+	assert.Equal(t, MalformedEntries, err)
+	// The database stays where it was.
+	rawdb, _ = openDb(t, dbPath)
+	defer rawdb.Close()
+	var count int
+	err = rawdb.QueryRow(
+		"select count(*) from entries where payment = 'bad'").Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestRestoreNotGzip(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "ledger.20240309140507.db.gz")
+	if err := os.WriteFile(snapshotPath, []byte("not a snapshot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Restore(snapshotPath, filepath.Join(dir, "ledger.db"), kNow)
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(dir, "ledger.db"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// createDb creates a ledger database at path with one entry.
+func createDb(t *testing.T, path string) *sql.DB {
+	rawdb, dbase := openDb(t, path)
+	if err := dbase.Do(sqlite_setup.SetUpTables); err != nil {
+		t.Fatalf("Error creating tables: %v", err)
+	}
+	store := for_sqlite.New(dbase)
+	account := fin.Account{Name: "checking", Active: true}
+	if err := store.AddAccount(nil, &account); err != nil {
+		t.Fatalf("Error adding account: %v", err)
+	}
+	entry := fin.Entry{
+		Date:       date_util.YMD(2012, 10, 15),
+		CatPayment: fin.NewCatPayment(fin.NewCat("0:7"), 300, true, 1)}
+	err := store.DoEntryChanges(nil, &findb.EntryChanges{
+		Adds: []*fin.Entry{&entry}})
+	if err != nil {
+		t.Fatalf("Error adding entry: %v", err)
+	}
+	return rawdb
+}
+
+func openDb(t *testing.T, path string) (*sql.DB, *sqlite3_db.Db) {
+	rawdb, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	return rawdb, sqlite3_db.New(rawdb)
+}
+
+func TestPrefix(t *testing.T) {
+	assert.Equal(t, "ledger", Prefix("/var/db/ledger.db"))
+	assert.Equal(t, "ledger", Prefix("ledger"))
+}
@@ -1,52 +1,544 @@
 // Package sqlite_setup sets up a sqlite database for personal finance.
+//
+// The schema evolves through an ordered list of migrations. The
+// schema_version table records how many of them a database has had.
 package sqlite_setup
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keep94/finances/fin"
+)
+
+var (
+	// SchemaOutOfDate means that the database needs migrations that have
+	// not been applied.
+	SchemaOutOfDate = errors.New(
+		"sqlite_setup: Database schema is out of date; migrate it first.")
+
+	// SchemaTooNew means that the database has had migrations that this
+	// version of the code does not know about.
+	SchemaTooNew = errors.New(
+		"sqlite_setup: Database schema is newer than this program.")
+
+	// NoFTS5 means that the database has a full text search index that
+	// this program cannot update because its sqlite lacks FTS5. Every
+	// change to an entry would fail.
+	NoFTS5 = errors.New(
+		"sqlite_setup: Database has a full text search index, but this program was built without FTS5. Rebuild it with -tags sqlite_fts5.")
 )
 
-// SetUpTables creates all needed tables in database.
+// migration is one step in bringing the schema up to date. Migrations
+// must be idempotent because databases created before schema_version
+// existed already have some of their changes.
+type migration func(tx *sql.Tx) error
+
+// kMigrations lists the migrations in the order they must run. Applying
+// kMigrations[i] brings the schema to version i+1. Never change or
+// reorder released migrations; add new ones to the end.
+var kMigrations = []migration{
+	createTables,
+	addCurrencies,
+	addFXRates,
+	addTags,
+	addAttachments,
+	addEntryHistory,
+	addChangeSets,
+	addEntryItems,
+	addEntrySearch,
+	addTrash,
+	addAccessRules,
+	addApiTokens,
+	addImportChangeIds,
+	addEntryTags,
+}
+
+// LatestSchemaVersion returns the schema version that this code expects.
+func LatestSchemaVersion() int {
+	return len(kMigrations)
+}
+
+// SetUpTables creates all needed tables in a new database. For an
+// existing database, SetUpTables returns the same error as CheckSchema so
+// that callers never migrate a database without backing it up first. The
+// only change SetUpTables makes to an existing database is adding the
+// full text search index when it is missing and sqlite supports FTS5.
 func SetUpTables(tx *sql.Tx) error {
-	_, err := tx.Exec("create table if not exists accounts (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, is_active INTEGER, balance INTEGER, reconciled INTEGER, b_count INTEGER, r_count INTEGER, import_sd TEXT)")
+	var count int
+	err := tx.QueryRow(
+		"select count(*) from sqlite_master where type = 'table' and name not like 'sqlite_%'").Scan(&count)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("create table if not exists entries (id INTEGER PRIMARY KEY AUTOINCREMENT, date TEXT, name TEXT, cats TEXT, payment TEXT, desc TEXT, check_no TEXT, reviewed INTEGER)")
+	if count == 0 {
+		return Migrate(tx)
+	}
+	if err = CheckSchema(tx); err != nil {
+		return err
+	}
+	// A database migrated by a build without FTS5 lacks the full text
+	// index. Add it now if this build has FTS5.
+	err = tx.QueryRow(
+		"select count(*) from sqlite_master where type = 'table' and name = 'entries_fts'").Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	return addEntrySearch(tx)
+}
+
+// SchemaVersion returns the schema version of the database. SchemaVersion
+// returns 0 for a database that predates schema_version.
+func SchemaVersion(tx *sql.Tx) (int, error) {
+	var count int
+	err := tx.QueryRow(
+		"select count(*) from sqlite_master where type = 'table' and name = 'schema_version'").Scan(&count)
+	if err != nil || count == 0 {
+		return 0, err
+	}
+	var version int
+	err = tx.QueryRow("select version from schema_version").Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// CheckSchema returns SchemaOutOfDate if the database needs migrating,
+// SchemaTooNew if the database is from a newer version of this code, or
+// NoFTS5 if this code cannot update the full text index of the database.
+func CheckSchema(tx *sql.Tx) error {
+	version, err := SchemaVersion(tx)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("create index if not exists entries_date_id_idx on entries (date, id)")
+	if version < LatestSchemaVersion() {
+		return SchemaOutOfDate
+	}
+	if version > LatestSchemaVersion() {
+		return SchemaTooNew
+	}
+	return checkSearchIndex(tx)
+}
+
+// checkSearchIndex returns NoFTS5 if the database has the full text index
+// but sqlite cannot read it.
+func checkSearchIndex(tx *sql.Tx) error {
+	var count int
+	err := tx.QueryRow(
+		"select count(*) from sqlite_master where type = 'table' and name = 'entries_fts'").Scan(&count)
+	if err != nil || count == 0 {
+		return err
+	}
+	rows, err := tx.Query("select rowid from entries_fts limit 0")
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		return NoFTS5
+	}
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("create table if not exists recurring_entries (id INTEGER PRIMARY KEY AUTOINCREMENT, date TEXT, name TEXT, cats TEXT, payment TEXT, desc TEXT, check_no TEXT, reviewed INTEGER, count INTEGER, unit INTEGER, num_left INTEGER, day_of_month INTEGER)")
+	return rows.Close()
+}
+
+// Migrate applies the pending migrations in order. If tx is rolled back,
+// none of them take effect. Migrate returns SchemaTooNew if the database
+// is from a newer version of this code.
+func Migrate(tx *sql.Tx) error {
+	version, err := SchemaVersion(tx)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("create table if not exists expense_categories (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, is_active INTEGER, parent_id INTEGER)")
+	if version > LatestSchemaVersion() {
+		return SchemaTooNew
+	}
+	if version == LatestSchemaVersion() {
+		return nil
+	}
+	for _, m := range kMigrations[version:] {
+		if err := m(tx); err != nil {
+			return err
+		}
+	}
+	return setSchemaVersion(tx, LatestSchemaVersion())
+}
+
+// BackupAndMigrate brings the sqlite database in the file at path up to
+// date. rawdb is the open database. If the database needs migrating,
+// BackupAndMigrate first copies it to a new file next to path and returns
+// the name of that file. It then applies all the pending migrations in
+// one transaction. If the database is already up to date,
+// BackupAndMigrate does nothing and returns the empty string.
+func BackupAndMigrate(rawdb *sql.DB, path string) (
+	backupPath string, err error) {
+	tx, err := rawdb.Begin()
+	if err != nil {
+		return "", err
+	}
+	err = CheckSchema(tx)
+	tx.Rollback()
+	if err != SchemaOutOfDate {
+		return "", err
+	}
+	backupPath = fmt.Sprintf(
+		"%s.%s.bak", path, time.Now().Format("20060102150405"))
+	if err = Backup(rawdb, backupPath); err != nil {
+		return "", err
+	}
+	tx, err = rawdb.Begin()
 	if err != nil {
+		return "", err
+	}
+	if err = Migrate(tx); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// Backup writes a consistent copy of the database to a new file at
+// backupPath. Backup fails if backupPath already exists.
+func Backup(rawdb *sql.DB, backupPath string) error {
+	_, err := rawdb.Exec("vacuum into ?", backupPath)
+	return err
+}
+
+func setSchemaVersion(tx *sql.Tx, version int) error {
+	_, err := tx.Exec(
+		"create table if not exists schema_version (version INTEGER NOT NULL)")
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("delete from schema_version"); err != nil {
 		return err
 	}
-	_, err = tx.Exec("create table if not exists income_categories (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, is_active INTEGER, parent_id INTEGER)")
+	_, err = tx.Exec(
+		"insert into schema_version (version) values (?)", version)
+	return err
+}
+
+// createTables creates the original tables.
+func createTables(tx *sql.Tx) error {
+	return execAll(
+		tx,
+		"create table if not exists accounts (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, is_active INTEGER, balance INTEGER, reconciled INTEGER, b_count INTEGER, r_count INTEGER, import_sd TEXT)",
+		"create table if not exists entries (id INTEGER PRIMARY KEY AUTOINCREMENT, date TEXT, name TEXT, cats TEXT, payment TEXT, desc TEXT, check_no TEXT, reviewed INTEGER)",
+		"create index if not exists entries_date_id_idx on entries (date, id)",
+		"create table if not exists recurring_entries (id INTEGER PRIMARY KEY AUTOINCREMENT, date TEXT, name TEXT, cats TEXT, payment TEXT, desc TEXT, check_no TEXT, reviewed INTEGER, count INTEGER, unit INTEGER, num_left INTEGER, day_of_month INTEGER)",
+		"create table if not exists expense_categories (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, is_active INTEGER, parent_id INTEGER)",
+		"create table if not exists income_categories (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, is_active INTEGER, parent_id INTEGER)",
+		"create table if not exists users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, go_password TEXT, permission INTEGER, last_login INTEGER)",
+		"create unique index if not exists users_name_idx on users (name)",
+		"create table if not exists qfx_fitids (acct_id INTEGER, fit_id TEXT)",
+		"create unique index if not exists qfx_fitids_acct_id_fit_id_idx on qfx_fitids (acct_id, fit_id)",
+		"create table if not exists allocations (expense_id INTEGER, year INTEGER, amount INTEGER, PRIMARY KEY (expense_id, year))")
+}
+
+// addCurrencies adds account currencies and entry exchange rates.
+func addCurrencies(tx *sql.Tx) error {
+	err := addColumnIfMissing(
+		tx, "accounts", "currency", "TEXT NOT NULL DEFAULT ''")
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("create table if not exists users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, go_password TEXT, permission INTEGER, last_login INTEGER)")
+	err = addColumnIfMissing(tx, "entries", "rate", "REAL NOT NULL DEFAULT 0")
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("create unique index if not exists users_name_idx on users (name)")
+	return addColumnIfMissing(
+		tx, "recurring_entries", "rate", "REAL NOT NULL DEFAULT 0")
+}
+
+// addFXRates adds dated exchange rates and the currency they are
+// quoted in.
+func addFXRates(tx *sql.Tx) error {
+	return execAll(
+		tx,
+		"create table if not exists fx_rates (currency TEXT, date TEXT, rate REAL, PRIMARY KEY (currency, date))",
+		"create table if not exists fx_reference (currency TEXT NOT NULL)")
+}
+
+// addTags adds entry tags.
+func addTags(tx *sql.Tx) error {
+	err := addColumnIfMissing(tx, "entries", "tags", "TEXT NOT NULL DEFAULT ''")
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("create table if not exists qfx_fitids (acct_id INTEGER, fit_id TEXT)")
+	return addColumnIfMissing(
+		tx, "recurring_entries", "tags", "TEXT NOT NULL DEFAULT ''")
+}
+
+// addAttachments adds entry attachments.
+func addAttachments(tx *sql.Tx) error {
+	return execAll(
+		tx,
+		"create table if not exists attachments (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, name TEXT, content_type TEXT, hash TEXT, size INTEGER, added INTEGER)",
+		"create index if not exists attachments_entry_id_idx on attachments (entry_id)",
+		"create table if not exists blobs (hash TEXT PRIMARY KEY, contents BLOB)")
+}
+
+// addEntryHistory adds the history of entry changes.
+func addEntryHistory(tx *sql.Tx) error {
+	return execAll(
+		tx,
+		"create table if not exists entry_history (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, user_id INTEGER, time INTEGER, old_entry TEXT, new_entry TEXT)",
+		"create index if not exists entry_history_entry_id_idx on entry_history (entry_id)")
+}
+
+// addChangeSets groups entry history into change sets that can be undone.
+func addChangeSets(tx *sql.Tx) error {
+	err := addColumnIfMissing(
+		tx, "entry_history", "change_id", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	return execAll(
+		tx,
+		"create index if not exists entry_history_change_id_idx on entry_history (change_id)",
+		"create table if not exists change_sets (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, time INTEGER, undoes INTEGER NOT NULL DEFAULT 0, undone INTEGER NOT NULL DEFAULT 0)")
+}
+
+// addEntryItems adds entry_items which has one row for each CatRec and
+// one row for the payment of each entry so that queries by category or
+// account need not read every entry.
+func addEntryItems(tx *sql.Tx) error {
+	err := execAll(
+		tx,
+		"create table if not exists entry_items (entry_id INTEGER NOT NULL, cat_type INTEGER NOT NULL, cat_id INTEGER NOT NULL, amount INTEGER NOT NULL, reconciled INTEGER NOT NULL, is_payment INTEGER NOT NULL)",
+		"create index if not exists entry_items_entry_id_idx on entry_items (entry_id)",
+		"create index if not exists entry_items_cat_idx on entry_items (cat_type, cat_id, entry_id)",
+		"delete from entry_items")
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("create unique index if not exists qfx_fitids_acct_id_fit_id_idx on qfx_fitids (acct_id, fit_id)")
+	rows, err := tx.Query("select id, cats, payment from entries")
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("create table if not exists allocations (expense_id INTEGER, year INTEGER, amount INTEGER, PRIMARY KEY (expense_id, year))")
+	type encodedEntry struct {
+		id      int64
+		cats    string
+		payment string
+	}
+	var entries []encodedEntry
+	for rows.Next() {
+		var e encodedEntry
+		if err := rows.Scan(&e.id, &e.cats, &e.payment); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+	stmt, err := tx.Prepare("insert into entry_items (entry_id, cat_type, cat_id, amount, reconciled, is_payment) values (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range entries {
+		var parts []string
+		if e.cats != "" {
+			parts = strings.Split(e.cats, "|")
+		}
+		if len(parts)%3 != 0 {
+			return fmt.Errorf(
+				"sqlite_setup: Entry %d has invalid categories: %s",
+				e.id, e.cats)
+		}
+		var total int64
+		for i := 0; i < len(parts); i += 3 {
+			cat, err := fin.CatFromString(parts[i])
+			if err != nil {
+				return err
+			}
+			amount, err := strconv.ParseInt(parts[i+1], 10, 64)
+			if err != nil {
+				return err
+			}
+			_, err = stmt.Exec(
+				e.id, cat.Type, cat.Id, amount, parts[i+2] == "1", false)
+			if err != nil {
+				return err
+			}
+			total -= amount
+		}
+		payment := strings.SplitN(e.payment, "|", 2)
+		if len(payment) < 2 {
+			return fmt.Errorf(
+				"sqlite_setup: Entry %d has invalid payment: %s",
+				e.id, e.payment)
+		}
+		cat, err := fin.CatFromString(payment[0])
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec(
+			e.id, fin.AccountCat, cat.Id, total, payment[1] == "1", true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addEntrySearch adds a full text index of entry names, descriptions, and
+// check numbers. The row id of each row in entries_fts is the entry id.
+// If sqlite was built without FTS5, addEntrySearch does nothing, and
+// searches report that there is no index.
+func addEntrySearch(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`create virtual table if not exists entries_fts using fts5(name, "desc", check_no)`)
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return execAll(
+		tx,
+		"delete from entries_fts",
+		`insert into entries_fts (rowid, name, "desc", check_no) select id, name, "desc", check_no from entries`)
+}
+
+// addTrash adds tables for deleted entries and recurring entries that can
+// still be restored. Trashed rows keep their original ids.
+func addTrash(tx *sql.Tx) error {
+	return execAll(
+		tx,
+		"create table if not exists trashed_entries (id INTEGER PRIMARY KEY, date TEXT, name TEXT, desc TEXT, check_no TEXT, cats TEXT, payment TEXT, rate REAL NOT NULL DEFAULT 0, reviewed INTEGER, tags TEXT NOT NULL DEFAULT '', trashed INTEGER NOT NULL)",
+		"create index if not exists trashed_entries_trashed_idx on trashed_entries (trashed)",
+		"create table if not exists trashed_recurring_entries (id INTEGER PRIMARY KEY, date TEXT, name TEXT, desc TEXT, check_no TEXT, cats TEXT, payment TEXT, rate REAL NOT NULL DEFAULT 0, reviewed INTEGER, tags TEXT NOT NULL DEFAULT '', count INTEGER, unit INTEGER, num_left INTEGER, day_of_month INTEGER, trashed INTEGER NOT NULL)")
+}
+
+// addAccessRules adds a table for the rules that limit users to certain
+// accounts and categories.
+func addAccessRules(tx *sql.Tx) error {
+	return execAll(
+		tx,
+		"create table if not exists access_rules (id INTEGER PRIMARY KEY AUTOINCREMENT, user_name TEXT NOT NULL, cat TEXT NOT NULL)",
+		"create index if not exists access_rules_user_name_idx on access_rules (user_name)")
+}
+
+// addApiTokens adds a table for the tokens that scripts use in place of
+// a password.
+func addApiTokens(tx *sql.Tx) error {
+	return execAll(
+		tx,
+		"create table if not exists api_tokens (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, name TEXT NOT NULL, hash TEXT NOT NULL, permission INTEGER NOT NULL, book TEXT NOT NULL, account_ids TEXT NOT NULL, created INTEGER NOT NULL, last_used INTEGER NOT NULL)",
+		"create unique index if not exists api_tokens_hash_idx on api_tokens (hash)",
+		"create index if not exists api_tokens_user_id_idx on api_tokens (user_id)")
+}
+
+// addImportChangeIds records which change set imported each fitId so
+// that undoing an import lets its entries be imported again.
+func addImportChangeIds(tx *sql.Tx) error {
+	err := addColumnIfMissing(
+		tx, "qfx_fitids", "change_id", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	return execAll(
+		tx,
+		"create index if not exists qfx_fitids_change_id_idx on qfx_fitids (change_id)")
+}
+
+// addEntryTags adds a table of the tags of each entry so that queries by
+// tag need not decode every entry.
+func addEntryTags(tx *sql.Tx) error {
+	err := execAll(
+		tx,
+		"create table if not exists entry_tags (entry_id INTEGER NOT NULL, tag TEXT NOT NULL, PRIMARY KEY (entry_id, tag))",
+		"create index if not exists entry_tags_tag_idx on entry_tags (tag, entry_id)",
+		"delete from entry_tags")
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query("select id, tags from entries where tags != ''")
+	if err != nil {
+		return err
+	}
+	type encodedEntry struct {
+		id   int64
+		tags string
+	}
+	var entries []encodedEntry
+	for rows.Next() {
+		var e encodedEntry
+		if err := rows.Scan(&e.id, &e.tags); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+	stmt, err := tx.Prepare("insert into entry_tags (entry_id, tag) values (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range entries {
+		for _, tag := range fin.ParseTags(e.tags) {
+			if _, err := stmt.Exec(e.id, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func execAll(tx *sql.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds column to table if table does not already have
+// it. This lets databases created by older versions pick up new columns.
+func addColumnIfMissing(tx *sql.Tx, table, column, decl string) error {
+	rows, err := tx.Query("pragma table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	found := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(
+			&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if name == column {
+			found = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+	if found {
+		return nil
+	}
+	_, err = tx.Exec(
+		"alter table " + table + " add column " + column + " " + decl)
 	return err
 }
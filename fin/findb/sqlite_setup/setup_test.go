@@ -0,0 +1,206 @@
+package sqlite_setup
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// kOriginalTables is the schema that databases had before schema_version.
+var kOriginalTables = []string{
+	"create table accounts (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, is_active INTEGER, balance INTEGER, reconciled INTEGER, b_count INTEGER, r_count INTEGER, import_sd TEXT)",
+	"create table entries (id INTEGER PRIMARY KEY AUTOINCREMENT, date TEXT, name TEXT, cats TEXT, payment TEXT, desc TEXT, check_no TEXT, reviewed INTEGER)",
+	"create table recurring_entries (id INTEGER PRIMARY KEY AUTOINCREMENT, date TEXT, name TEXT, cats TEXT, payment TEXT, desc TEXT, check_no TEXT, reviewed INTEGER, count INTEGER, unit INTEGER, num_left INTEGER, day_of_month INTEGER)",
+	"insert into entries (date, name, cats, payment) values ('20240105', 'Safeway', '0:7|1234|0|2:2|500|1', '2:1|0')",
+}
+
+func TestSetUpTablesNewDb(t *testing.T) {
+	db := openDb(t, ":memory:")
+	defer db.Close()
+	doTx(t, db, SetUpTables)
+	assertVersion(t, db, LatestSchemaVersion())
+	doTx(t, db, CheckSchema)
+	// Migrating an up to date database does nothing.
+	doTx(t, db, Migrate)
+	doTx(t, db, SetUpTables)
+	assertVersion(t, db, LatestSchemaVersion())
+}
+
+func TestSetUpTablesOldDb(t *testing.T) {
+	db := openDb(t, ":memory:")
+	defer db.Close()
+	createOriginalTables(t, db)
+	if err := do(db, SetUpTables); err != SchemaOutOfDate {
+		t.Errorf("Expected SchemaOutOfDate, got %v", err)
+	}
+	assertVersion(t, db, 0)
+}
+
+func TestMigrateTwice(t *testing.T) {
+	db := openDb(t, ":memory:")
+	defer db.Close()
+	createOriginalTables(t, db)
+	doTx(t, db, Migrate)
+	// Running every migration again must not fail.
+	doTx(t, db, func(tx *sql.Tx) error {
+		for _, m := range kMigrations {
+			if err := m(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assertVersion(t, db, LatestSchemaVersion())
+}
+
+func TestSchemaTooNew(t *testing.T) {
+	db := openDb(t, ":memory:")
+	defer db.Close()
+	doTx(t, db, SetUpTables)
+	doTx(t, db, func(tx *sql.Tx) error {
+		return setSchemaVersion(tx, LatestSchemaVersion()+1)
+	})
+	if err := do(db, CheckSchema); err != SchemaTooNew {
+		t.Errorf("Expected SchemaTooNew, got %v", err)
+	}
+	if err := do(db, Migrate); err != SchemaTooNew {
+		t.Errorf("Expected SchemaTooNew, got %v", err)
+	}
+}
+
+func TestBackupAndMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.db")
+	db := openDb(t, path)
+	defer db.Close()
+	createOriginalTables(t, db)
+	backupPath, err := BackupAndMigrate(db, path)
+	if err != nil {
+		t.Fatalf("Error migrating: %v", err)
+	}
+	if backupPath == "" {
+		t.Fatal("Expected a backup")
+	}
+	assertVersion(t, db, LatestSchemaVersion())
+	var name, tags string
+	err = db.QueryRow("select name, tags from entries").Scan(&name, &tags)
+	if err != nil {
+		t.Fatalf("Error reading migrated entry: %v", err)
+	}
+	if name != "Safeway" || tags != "" {
+		t.Errorf("Expected Safeway with no tags, got %s %q", name, tags)
+	}
+
+	var count, total int64
+	err = db.QueryRow(
+		"select count(*), sum(amount) from entry_items where cat_type = 2").Scan(&count, &total)
+	if err != nil {
+		t.Fatalf("Error reading entry items: %v", err)
+	}
+	// The payment row for account 1 and the CatRec row for account 2
+	if count != 2 || total != -1234 {
+		t.Errorf("Expected 2 account items totaling -1234, got %d %d", count, total)
+	}
+	err = db.QueryRow("select count(*) from entry_tags").Scan(&count)
+	if err != nil {
+		t.Fatalf("Error reading entry tags: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no entry tags, got %d", count)
+	}
+
+	// The backup has the original schema.
+	if _, err := os.Stat(backupPath); err != nil {
+		t.Fatalf("Backup missing: %v", err)
+	}
+	backup := openDb(t, backupPath)
+	defer backup.Close()
+	assertVersion(t, backup, 0)
+
+	// Nothing to do the second time.
+	backupPath, err = BackupAndMigrate(db, path)
+	if err != nil {
+		t.Fatalf("Error migrating: %v", err)
+	}
+	if backupPath != "" {
+		t.Errorf("Expected no backup, got %s", backupPath)
+	}
+}
+
+func TestNoFTS5(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.db")
+	db := openDb(t, path)
+	doTx(t, db, SetUpTables)
+	_, err := db.Exec("create virtual table fts5_probe using fts5(x)")
+	if err == nil {
+		t.Skip("sqlite has FTS5")
+	}
+	// Pretend that a build with FTS5 added the full text index.
+	_, err = db.Exec("pragma writable_schema = 1")
+	if err == nil {
+		_, err = db.Exec(`insert into sqlite_master (type, name, tbl_name, rootpage, sql) values ('table', 'entries_fts', 'entries_fts', 0, 'CREATE VIRTUAL TABLE entries_fts USING fts5(name, "desc", check_no)')`)
+	}
+	if err != nil {
+		t.Fatalf("Error adding index: %v", err)
+	}
+	db.Close()
+	db = openDb(t, path)
+	defer db.Close()
+	if err := do(db, SetUpTables); err != NoFTS5 {
+		t.Errorf("Expected NoFTS5, got %v", err)
+	}
+}
+
+func createOriginalTables(t *testing.T, db *sql.DB) {
+	for _, statement := range kOriginalTables {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Error creating original tables: %v", err)
+		}
+	}
+}
+
+func assertVersion(t *testing.T, db *sql.DB, expected int) {
+	t.Helper()
+	var version int
+	err := do(db, func(tx *sql.Tx) (err error) {
+		version, err = SchemaVersion(tx)
+		return
+	})
+	if err != nil {
+		t.Fatalf("Error reading schema version: %v", err)
+	}
+	if version != expected {
+		t.Errorf("Expected schema version %d, got %d", expected, version)
+	}
+}
+
+func doTx(t *testing.T, db *sql.DB, f func(tx *sql.Tx) error) {
+	t.Helper()
+	if err := do(db, f); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func do(db *sql.DB, f func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func openDb(t *testing.T, path string) *sql.DB {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	// Every connection to :memory: is a different database.
+	db.SetMaxOpenConns(1)
+	return db
+}
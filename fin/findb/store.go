@@ -3,6 +3,8 @@ package findb
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/keep94/consume2"
@@ -20,6 +22,8 @@ var (
 	NoSuchId         = errors.New("findb: No Such Id.")
 	WrongPassword    = errors.New("findb: Wrong password.")
 	NoPermission     = errors.New("findb: Insufficient permission.")
+	CannotUndo       = errors.New("findb: Change cannot be undone.")
+	NoSearchIndex    = errors.New("findb: No full text search index.")
 )
 
 type AccountByIdRunner interface {
@@ -48,6 +52,12 @@ type UpdateAccountImportSDRunner interface {
 		t db.Transaction, accountId int64, date time.Time) error
 }
 
+type UpdateAccountCurrencyRunner interface {
+	// UpdateAccountCurrency updates the currency of an account.
+	UpdateAccountCurrency(
+		t db.Transaction, accountId int64, currency fin.Currency) error
+}
+
 type UpdateAccountRunner interface {
 	// UpdateAccount updates an account.
 	UpdateAccount(
@@ -74,6 +84,34 @@ type EntriesRunner interface {
 		consumer consume2.Consumer[fin.Entry]) error
 }
 
+type CatTotalsRunner interface {
+	// CatTotals returns the total of each expense and income category
+	// over the entries that options selects. options may be nil.
+	CatTotals(t db.Transaction, options *EntryListOptions) (
+		fin.CatTotals, error)
+}
+
+// CatTotals totals each expense and income category over the entries
+// that options selects by reading those entries from store. Stores that
+// cannot total categories on their own use CatTotals to implement
+// CatTotalsRunner.
+func CatTotals(
+	t db.Transaction,
+	store EntriesRunner,
+	options *EntryListOptions) (fin.CatTotals, error) {
+	result := make(fin.CatTotals)
+	err := store.Entries(
+		t,
+		options,
+		consume2.Call(func(entry fin.Entry) {
+			result.Include(entry.CatPayment)
+		}))
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 type EntriesByAccountIdRunner interface {
 	EntriesRunner
 	AccountByIdRunner
@@ -106,7 +144,10 @@ func UnreconciledEntries(
 			ok := entry.WithPayment(acctId) && !entry.Reconciled()
 			return entry, ok
 		})
-	return store.Entries(t, nil, consumer)
+	return store.Entries(
+		t,
+		&EntryListOptions{AccountId: acctId, Unreconciled: true},
+		consumer)
 }
 
 // EntriesByAccountId gets entries by account id from most to least recent.
@@ -137,7 +178,8 @@ func EntriesByAccountId(
 			ok := entry.WithPayment(acctId)
 			return entry, ok
 		})
-	return store.Entries(t, nil, entryConsumer)
+	return store.Entries(
+		t, &EntryListOptions{AccountId: acctId}, entryConsumer)
 }
 
 type EntryByIdRunner interface {
@@ -145,6 +187,76 @@ type EntryByIdRunner interface {
 	EntryById(t db.Transaction, id int64, entry *fin.Entry) error
 }
 
+type EntryHistoryRunner interface {
+	// EntryHistory fetches every recorded change to an entry oldest first.
+	EntryHistory(
+		t db.Transaction,
+		entryId int64,
+		consumer consume2.Consumer[fin.EntryHistory]) error
+}
+
+type ChangeEntriesRunner interface {
+	// ChangeEntries fetches the entry history records of the change set
+	// with given id in the order they were recorded.
+	ChangeEntries(
+		t db.Transaction,
+		changeId int64,
+		consumer consume2.Consumer[fin.EntryHistory]) error
+}
+
+type LastChangeIdRunner interface {
+	// LastChangeId returns the id of the most recent change set by given
+	// user that can still be undone. LastChangeId returns NoSuchId if there
+	// is no such change set.
+	LastChangeId(t db.Transaction, userId int64) (int64, error)
+}
+
+type UndoRunner interface {
+	// Undo reverses the change set with given id. Entries that the change
+	// set deleted come back out of the trash with their original ids;
+	// entries that it added are removed for good along with their
+	// attachments and do not go to the trash. Undo records its own change
+	// set which cannot be undone. Undo returns NoPermission if the change
+	// set belongs to a different user and CannotUndo if the change set
+	// was already undone or is itself an undo. If an entry in the change
+	// set changed since or a deleted entry was already restored, Undo
+	// returns ConcurrentUpdate and changes nothing.
+	Undo(t db.Transaction, changeId int64) error
+}
+
+type AddAttachmentRunner interface {
+	// AddAttachment adds an attachment to an entry. AddAttachment sets the
+	// Id, Hash, and Size fields of attachment from contents. Contents
+	// are stored only once no matter how many attachments share them.
+	AddAttachment(
+		t db.Transaction, attachment *fin.Attachment, contents []byte) error
+}
+
+type AttachmentByIdRunner interface {
+	// AttachmentById fetches an attachment by id.
+	AttachmentById(t db.Transaction, id int64, attachment *fin.Attachment) error
+}
+
+type AttachmentsByEntryIdRunner interface {
+	// AttachmentsByEntryId fetches the attachments of an entry sorted by
+	// when they were added.
+	AttachmentsByEntryId(
+		t db.Transaction,
+		entryId int64,
+		consumer consume2.Consumer[fin.Attachment]) error
+}
+
+type AttachmentContentsRunner interface {
+	// AttachmentContents fetches the contents having given hash.
+	AttachmentContents(t db.Transaction, hash string) ([]byte, error)
+}
+
+type RemoveAttachmentRunner interface {
+	// RemoveAttachment removes an attachment by id. RemoveAttachment also
+	// removes contents that no attachment uses any more.
+	RemoveAttachment(t db.Transaction, id int64) error
+}
+
 type AddRecurringEntryRunner interface {
 	// AddRecurringEntry adds a new recurring entry.
 	AddRecurringEntry(t db.Transaction, entry *fin.RecurringEntry) error
@@ -170,10 +282,48 @@ type RecurringEntriesRunner interface {
 }
 
 type RemoveRecurringEntryByIdRunner interface {
-	// RemoveRecurringEntryById removes a recurring entry by id.
+	// RemoveRecurringEntryById moves a recurring entry to the trash.
 	RemoveRecurringEntryById(t db.Transaction, id int64) error
 }
 
+type TrashedEntriesRunner interface {
+	// TrashedEntries fetches the entries in the trash, most recently
+	// trashed first.
+	TrashedEntries(
+		t db.Transaction, consumer consume2.Consumer[fin.TrashedEntry]) error
+}
+
+type RestoreEntryRunner interface {
+	// RestoreEntry moves an entry out of the trash under its original id
+	// and adds it back to the account totals. RestoreEntry records a change
+	// set which undoes the same way as an add. RestoreEntry returns
+	// NoSuchId if the entry is not in the trash.
+	RestoreEntry(t db.Transaction, id int64) error
+}
+
+type TrashedRecurringEntriesRunner interface {
+	// TrashedRecurringEntries fetches the recurring entries in the trash,
+	// most recently trashed first.
+	TrashedRecurringEntries(
+		t db.Transaction,
+		consumer consume2.Consumer[fin.TrashedRecurringEntry]) error
+}
+
+type RestoreRecurringEntryRunner interface {
+	// RestoreRecurringEntry moves a recurring entry out of the trash under
+	// its original id. RestoreRecurringEntry returns NoSuchId if the
+	// recurring entry is not in the trash.
+	RestoreRecurringEntry(t db.Transaction, id int64) error
+}
+
+type PurgeTrashRunner interface {
+	// PurgeTrash permanently removes the entries and recurring entries
+	// that went to the trash before given time along with the attachments
+	// of those entries. PurgeTrash returns how many entries and recurring
+	// entries it removed.
+	PurgeTrash(t db.Transaction, before time.Time) (int, error)
+}
+
 type AddUserRunner interface {
 	// AddUser adds a new user.
 	AddUser(t db.Transaction, user *fin.User) error
@@ -200,10 +350,59 @@ type UsersRunner interface {
 }
 
 type RemoveUserByNameRunner interface {
-	// RemoveUserByName removes a user by name.
+	// RemoveUserByName removes a user by name along with the access rules
+	// and API tokens of that user.
 	RemoveUserByName(t db.Transaction, name string) error
 }
 
+type AccessRulesByUserNameRunner interface {
+	// AccessRulesByUserName gets the access rules of a user sorted by id.
+	AccessRulesByUserName(
+		t db.Transaction,
+		name string,
+		consumer consume2.Consumer[fin.AccessRule]) error
+}
+
+type AddAccessRuleRunner interface {
+	// AddAccessRule adds a new access rule.
+	AddAccessRule(t db.Transaction, rule *fin.AccessRule) error
+}
+
+type RemoveAccessRuleRunner interface {
+	// RemoveAccessRule removes an access rule by id.
+	RemoveAccessRule(t db.Transaction, id int64) error
+}
+
+type ApiTokensByUserIdRunner interface {
+	// ApiTokensByUserId gets the API tokens of a user sorted by id.
+	ApiTokensByUserId(
+		t db.Transaction,
+		userId int64,
+		consumer consume2.Consumer[fin.ApiToken]) error
+}
+
+type ApiTokenByHashRunner interface {
+	// ApiTokenByHash gets the API token with given hash. If there is no
+	// such token, ApiTokenByHash returns NoSuchId.
+	ApiTokenByHash(t db.Transaction, hash string, token *fin.ApiToken) error
+}
+
+type AddApiTokenRunner interface {
+	// AddApiToken adds a new API token.
+	AddApiToken(t db.Transaction, token *fin.ApiToken) error
+}
+
+type UpdateApiTokenLastUsedRunner interface {
+	// UpdateApiTokenLastUsed records when an API token was last used.
+	UpdateApiTokenLastUsed(
+		t db.Transaction, id int64, lastUsed time.Time) error
+}
+
+type RemoveApiTokenRunner interface {
+	// RemoveApiToken removes an API token by id.
+	RemoveApiToken(t db.Transaction, id int64) error
+}
+
 type AllocationsByYearRunner interface {
 	// AllocationsByYear returns the envelope allocations by year. In the
 	// returned map, the keys are the expenseIds, and the values are the
@@ -227,7 +426,7 @@ type EntryChanges struct {
 	Adds []*fin.Entry
 	// The key is the entry id; the value does the update in-place.
 	Updates map[int64]fin.EntryUpdater
-	// Deletes is the ids of the entries to delete.
+	// Deletes is the ids of the entries to move to the trash.
 	Deletes []int64
 	// Etags contains the etags of the entries being updated.
 	// It is used to detect concurrent updates.
@@ -235,6 +434,9 @@ type EntryChanges struct {
 	// This field is optional, but if present it must contain the etag of
 	// each entry being updated.
 	Etags map[int64]uint64
+	// ChangeId is set by DoEntryChanges to the id of the change set it
+	// recorded. It stays 0 if DoEntryChanges changed nothing.
+	ChangeId int64
 }
 
 // EntryListOptions represents options to list entries.
@@ -245,6 +447,89 @@ type EntryListOptions struct {
 	End *time.Time
 	// If true, show only unreviewed entries
 	Unreviewed bool
+	// If non-zero, show only entries with this account as the payment
+	// or as one of the categories.
+	AccountId int64
+	// If true, show only entries not yet reconciled against AccountId.
+	// Ignored if AccountId is zero.
+	Unreconciled bool
+	// If non-empty, show only entries with a category in this set.
+	Cats fin.CatSet
+	// If set, show only entries whose total is at least this amount.
+	MinTotal *int64
+	// If set, show only entries whose total is at most this amount.
+	MaxTotal *int64
+	// If non-empty, show only entries whose name contains this string.
+	// Matching ignores case and whitespace the same way that
+	// filters.AdvanceSearchSpec does.
+	Name string
+	// If non-empty, show only entries whose description contains this
+	// string. Matching works the same way as for Name.
+	Desc string
+	// If non-empty, show only entries with this tag. Matching ignores
+	// case.
+	Tag string
+	// If set, show only entries that come after this position.
+	After *EntryCursor
+	// If positive, show at most this many entries.
+	Limit int
+}
+
+// EntryFilter returns a function that reports whether an entry meets the
+// AccountId, Unreconciled, Cats, MinTotal, MaxTotal, Name, Desc, Tag, and
+// After criteria in options.
+// The returned function does not change the entry it is given.
+// EntryFilter returns nil if options has none of these criteria. Stores
+// that cannot apply these criteria in their queries use EntryFilter.
+func EntryFilter(options *EntryListOptions) func(ptr *fin.Entry) bool {
+	if options == nil {
+		return nil
+	}
+	var result []func(ptr *fin.Entry) bool
+	if options.After != nil {
+		result = append(result, options.After.Precedes)
+	}
+	if options.AccountId != 0 && options.Unreconciled {
+		acctId := options.AccountId
+		result = append(result, func(ptr *fin.Entry) bool {
+			entry := *ptr
+			return entry.WithPayment(acctId) && !entry.Reconciled()
+		})
+	}
+	if options.MinTotal != nil || options.MaxTotal != nil {
+		minTotal, maxTotal := options.MinTotal, options.MaxTotal
+		result = append(result, func(ptr *fin.Entry) bool {
+			total := ptr.Total()
+			if minTotal != nil && total < *minTotal {
+				return false
+			}
+			return maxTotal == nil || total <= *maxTotal
+		})
+	}
+	spec := filters.AdvanceSearchSpec{
+		AccountId: options.AccountId,
+		Name:      options.Name,
+		Desc:      options.Desc,
+		Tag:       strings.TrimSpace(options.Tag)}
+	if len(options.Cats) > 0 {
+		cats := options.Cats
+		spec.CF = func(cat fin.Cat) bool {
+			_, ok := cats[cat]
+			return ok
+		}
+	}
+	if spec.AccountId != 0 || spec.CF != nil || spec.Name != "" || spec.Desc != "" || spec.Tag != "" {
+		filter := filters.CompileAdvanceSearchSpec(&spec)
+		result = append(result, func(ptr *fin.Entry) bool {
+			// The compiled filter can change the entry it is given.
+			entry := *ptr
+			return filter(&entry)
+		})
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return consume2.ComposeFilters(result...)
 }
 
 // NoPermissionStore always returns NoPermissionError
@@ -276,6 +561,60 @@ func (n NoPermissionStore) UpdateAccountImportSD(
 	return NoPermission
 }
 
+func (n NoPermissionStore) UpdateAccountCurrency(
+	t db.Transaction, accountId int64, currency fin.Currency) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) EntryHistory(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) ChangeEntries(
+	t db.Transaction,
+	changeId int64,
+	consumer consume2.Consumer[fin.EntryHistory]) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) LastChangeId(
+	t db.Transaction, userId int64) (int64, error) {
+	return 0, NoPermission
+}
+
+func (n NoPermissionStore) Undo(t db.Transaction, changeId int64) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) AddAttachment(
+	t db.Transaction, attachment *fin.Attachment, contents []byte) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) AttachmentById(
+	t db.Transaction, id int64, attachment *fin.Attachment) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) AttachmentsByEntryId(
+	t db.Transaction,
+	entryId int64,
+	consumer consume2.Consumer[fin.Attachment]) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) AttachmentContents(
+	t db.Transaction, hash string) ([]byte, error) {
+	return nil, NoPermission
+}
+
+func (n NoPermissionStore) RemoveAttachment(t db.Transaction, id int64) error {
+	return NoPermission
+}
+
 func (n NoPermissionStore) UpdateAccount(
 	t db.Transaction, account *fin.Account) error {
 	return NoPermission
@@ -296,6 +635,28 @@ func (n NoPermissionStore) Entries(t db.Transaction, options *EntryListOptions,
 	return NoPermission
 }
 
+func (n NoPermissionStore) CatTotals(
+	t db.Transaction, options *EntryListOptions) (fin.CatTotals, error) {
+	return nil, NoPermission
+}
+
+func (n NoPermissionStore) EntriesPage(
+	t db.Transaction,
+	options *EntryListOptions,
+	token string,
+	pageSize int,
+	consumer consume2.Consumer[fin.Entry]) (string, error) {
+	return "", NoPermission
+}
+
+func (n NoPermissionStore) SearchEntries(
+	t db.Transaction,
+	query string,
+	options *EntryListOptions,
+	consumer consume2.Consumer[fin.Entry]) error {
+	return NoPermission
+}
+
 func (n NoPermissionStore) EntryById(
 	t db.Transaction, id int64, entry *fin.Entry) error {
 	return NoPermission
@@ -327,6 +688,31 @@ func (n NoPermissionStore) RemoveRecurringEntryById(
 	return NoPermission
 }
 
+func (n NoPermissionStore) TrashedEntries(
+	t db.Transaction, consumer consume2.Consumer[fin.TrashedEntry]) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) RestoreEntry(t db.Transaction, id int64) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) TrashedRecurringEntries(
+	t db.Transaction,
+	consumer consume2.Consumer[fin.TrashedRecurringEntry]) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) RestoreRecurringEntry(
+	t db.Transaction, id int64) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) PurgeTrash(
+	t db.Transaction, before time.Time) (int, error) {
+	return 0, NoPermission
+}
+
 func (n NoPermissionStore) AddUser(t db.Transaction, user *fin.User) error {
 	return NoPermission
 }
@@ -352,6 +738,48 @@ func (n NoPermissionStore) RemoveUserByName(t db.Transaction, name string) error
 	return NoPermission
 }
 
+func (n NoPermissionStore) AccessRulesByUserName(
+	t db.Transaction,
+	name string,
+	consumer consume2.Consumer[fin.AccessRule]) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) AddAccessRule(
+	t db.Transaction, rule *fin.AccessRule) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) RemoveAccessRule(t db.Transaction, id int64) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) ApiTokensByUserId(
+	t db.Transaction,
+	userId int64,
+	consumer consume2.Consumer[fin.ApiToken]) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) ApiTokenByHash(
+	t db.Transaction, hash string, token *fin.ApiToken) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) AddApiToken(
+	t db.Transaction, token *fin.ApiToken) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) UpdateApiTokenLastUsed(
+	t db.Transaction, id int64, lastUsed time.Time) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) RemoveApiToken(t db.Transaction, id int64) error {
+	return NoPermission
+}
+
 func (n NoPermissionStore) AllocationsByYear(t db.Transaction, year int64) (
 	map[int64]int64, error) {
 	return nil, NoPermission
@@ -528,6 +956,68 @@ func LoginUser(
 	return nil
 }
 
+type LoginApiTokenRunner interface {
+	ApiTokenByHashRunner
+	UpdateApiTokenLastUsedRunner
+	UserByIdRunner
+}
+
+// LoginApiToken logs in the user of the API token with given secret. On
+// success, LoginApiToken stores the token at token and its user at user
+// and records currentTime as when the token was last used. If there is
+// no such token or its user may no longer log in, LoginApiToken returns
+// NoSuchId.
+func LoginApiToken(
+	t db.Transaction,
+	store LoginApiTokenRunner,
+	secret string,
+	currentTime time.Time,
+	token *fin.ApiToken,
+	user *fin.User) error {
+	if t == nil {
+		panic(kNonNilTransactionRequired)
+	}
+	err := store.ApiTokenByHash(t, fin.HashApiTokenSecret(secret), token)
+	if err != nil {
+		return err
+	}
+	if err := store.UserById(t, token.UserId, user); err != nil {
+		return err
+	}
+	if user.Permission == fin.NonePermission {
+		return NoSuchId
+	}
+	token.LastUsed = currentTime
+	return store.UpdateApiTokenLastUsed(t, token.Id, currentTime)
+}
+
+// FormatIds formats ids as a comma separated list for storing in a
+// database column.
+func FormatIds(ids []int64) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(strs, ",")
+}
+
+// ParseIds is the inverse of FormatIds.
+func ParseIds(s string) ([]int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	strs := strings.Split(s, ",")
+	result := make([]int64, len(strs))
+	for i, str := range strs {
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = id
+	}
+	return result, nil
+}
+
 func applyRecurringEntriesDryRun(
 	t db.Transaction,
 	store RecurringEntriesRunner,
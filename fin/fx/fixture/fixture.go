@@ -0,0 +1,163 @@
+// Package fixture provides test suites to test implementations of the
+// fx.Store interface.
+package fixture
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/fx"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+)
+
+type Fixture struct {
+	Store fx.Store
+	Doer  db.Doer
+}
+
+func (f *Fixture) RateOnDate(t *testing.T) {
+	f.addRates(t)
+	var rate fx.Rate
+	err := f.Store.RateOnDate(nil, "EUR", date_util.YMD(2024, 2, 15), &rate)
+	if err != nil {
+		t.Fatalf("Error reading database: %v", err)
+	}
+	expected := fx.Rate{
+		Currency: "EUR", Date: date_util.YMD(2024, 2, 1), Value: 1.08}
+	if rate != expected {
+		t.Errorf("Expected %v, got %v", expected, rate)
+	}
+	err = f.Store.RateOnDate(nil, "EUR", date_util.YMD(2024, 3, 1), &rate)
+	if err != nil {
+		t.Fatalf("Error reading database: %v", err)
+	}
+	expected = fx.Rate{
+		Currency: "EUR", Date: date_util.YMD(2024, 3, 1), Value: 1.09}
+	if rate != expected {
+		t.Errorf("Expected %v, got %v", expected, rate)
+	}
+	err = f.Store.RateOnDate(nil, "EUR", date_util.YMD(2023, 12, 31), &rate)
+	if err != fx.NoSuchRate {
+		t.Errorf("Expected NoSuchRate, got %v", err)
+	}
+	err = f.Store.RateOnDate(nil, "GBP", date_util.YMD(2024, 2, 15), &rate)
+	if err != fx.NoSuchRate {
+		t.Errorf("Expected NoSuchRate, got %v", err)
+	}
+}
+
+func (f *Fixture) ReplaceRate(t *testing.T) {
+	f.addRates(t)
+	replacement := []fx.Rate{
+		{Currency: "EUR", Date: date_util.YMD(2024, 2, 1), Value: 1.07}}
+	if err := f.Store.Add(nil, replacement); err != nil {
+		t.Fatalf("Error adding rates: %v", err)
+	}
+	var rate fx.Rate
+	err := f.Store.RateOnDate(nil, "EUR", date_util.YMD(2024, 2, 1), &rate)
+	if err != nil {
+		t.Fatalf("Error reading database: %v", err)
+	}
+	if rate != replacement[0] {
+		t.Errorf("Expected %v, got %v", replacement[0], rate)
+	}
+}
+
+func (f *Fixture) ReadTable(t *testing.T) {
+	f.addRates(t)
+	table, err := fx.ReadTable(nil, f.Store)
+	if err != nil {
+		t.Fatalf("Error reading database: %v", err)
+	}
+	rate, err := table.Rate("EUR", "CAD", date_util.YMD(2024, 2, 15))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	eur, cad := 1.08, 0.74
+	if expected := eur / cad; rate != expected {
+		t.Errorf("Expected %v, got %v", expected, rate)
+	}
+	rate, err = table.Rate("EUR", fin.USD, date_util.YMD(2024, 3, 5))
+	if err != nil || rate != 1.09 {
+		t.Errorf("Expected 1.09, got %v %v", rate, err)
+	}
+	_, err = table.Rate("EUR", "CAD", date_util.YMD(2024, 1, 5))
+	if err != fin.NoExchangeRate {
+		t.Errorf("Expected NoExchangeRate, got %v", err)
+	}
+}
+
+func (f *Fixture) Reference(t *testing.T) {
+	reference, err := f.Store.Reference(nil)
+	if err != nil {
+		t.Fatalf("Error reading database: %v", err)
+	}
+	if reference != "" {
+		t.Errorf("Expected no reference currency, got %v", reference)
+	}
+	rates := []fx.Rate{
+		{Currency: "USD", Date: date_util.YMD(2024, 2, 1), Value: 0.9},
+		{Currency: "CAD", Date: date_util.YMD(2024, 2, 1), Value: 0.7},
+	}
+	err = f.Doer.Do(func(t db.Transaction) error {
+		return fx.AddRates(t, f.Store, "EUR", rates)
+	})
+	if err != nil {
+		t.Fatalf("Error adding rates: %v", err)
+	}
+	err = f.Doer.Do(func(t db.Transaction) error {
+		return fx.AddRates(t, f.Store, fin.USD, rates)
+	})
+	if err == nil {
+		t.Error("Expected error adding rates in another reference currency")
+	}
+	table, err := fx.ReadTable(nil, f.Store)
+	if err != nil {
+		t.Fatalf("Error reading database: %v", err)
+	}
+	if table.Reference() != "EUR" {
+		t.Errorf("Expected EUR, got %v", table.Reference())
+	}
+	// Converting to USD goes through EUR.
+	rate, err := table.Rate("CAD", fin.USD, date_util.YMD(2024, 2, 15))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cad, usd := 0.7, 0.9
+	if expected := cad / usd; rate != expected {
+		t.Errorf("Expected %v, got %v", expected, rate)
+	}
+	rate, err = table.Rate("EUR", fin.USD, date_util.YMD(2024, 2, 15))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := 1 / usd; rate != expected {
+		t.Errorf("Expected %v, got %v", expected, rate)
+	}
+}
+
+func (f *Fixture) addRates(t *testing.T) {
+	rates := []fx.Rate{
+		{Currency: "EUR", Date: date_util.YMD(2024, 3, 1), Value: 1.09},
+		{Currency: "EUR", Date: date_util.YMD(2024, 1, 2), Value: 1.1},
+		{Currency: "EUR", Date: date_util.YMD(2024, 2, 1), Value: 1.08},
+		{Currency: "CAD", Date: date_util.YMD(2024, 2, 1), Value: 0.74},
+	}
+	err := f.Doer.Do(func(t db.Transaction) error {
+		return fx.AddRates(t, f.Store, fin.USD, rates)
+	})
+	if err != nil {
+		t.Fatalf("Error adding rates: %v", err)
+	}
+	var actual []fx.Rate
+	if err := f.Store.Rates(nil, consume2.AppendTo(&actual)); err != nil {
+		t.Fatalf("Error reading database: %v", err)
+	}
+	expected := []fx.Rate{rates[3], rates[1], rates[2], rates[0]}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
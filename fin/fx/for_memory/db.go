@@ -0,0 +1,160 @@
+// Package for_memory stores dated exchange rates in memory.
+package for_memory
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	fmemory "github.com/keep94/finances/fin/findb/for_memory"
+	"github.com/keep94/finances/fin/fx"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+)
+
+const (
+	kTableName          = "fx"
+	kReferenceTableName = "fx_reference"
+)
+
+type currencyDate struct {
+	currency fin.Currency
+	date     time.Time
+}
+
+// rateTable holds the rates keyed by currency and date.
+type rateTable map[currencyDate]fx.Rate
+
+func (r rateTable) Clone() fmemory.Table {
+	return maps.Clone(r)
+}
+
+func newRateTable() fmemory.Table {
+	return make(rateTable)
+}
+
+// sorted returns the rates sorted by currency then date.
+func (r rateTable) sorted() []fx.Rate {
+	result := slices.Collect(maps.Values(r))
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Currency != result[j].Currency {
+			return result[i].Currency < result[j].Currency
+		}
+		return result[i].Date.Before(result[j].Date)
+	})
+	return result
+}
+
+// referenceTable holds the reference currency.
+type referenceTable struct {
+	currency fin.Currency
+}
+
+func (r *referenceTable) Clone() fmemory.Table {
+	result := *r
+	return &result
+}
+
+func newReferenceTable() fmemory.Table {
+	return &referenceTable{}
+}
+
+// New creates in-memory implementation of fx.Store interface
+func New(db *fmemory.Db) fx.Store {
+	return memoryStore{db}
+}
+
+func add(tx *fmemory.Tx, rates []fx.Rate) error {
+	stored := tx.TableForUpdate(kTableName, newRateTable).(rateTable)
+	for _, rate := range rates {
+		rate.Date = date_util.TimeToDate(rate.Date)
+		stored[currencyDate{currency: rate.Currency, date: rate.Date}] = rate
+	}
+	return nil
+}
+
+func rateOnDate(
+	tx *fmemory.Tx, currency fin.Currency, date time.Time, rate *fx.Rate) error {
+	date = date_util.TimeToDate(date)
+	found := false
+	for _, r := range tx.Table(kTableName, newRateTable).(rateTable) {
+		if r.Currency != currency || r.Date.After(date) {
+			continue
+		}
+		if !found || r.Date.After(rate.Date) {
+			*rate = r
+			found = true
+		}
+	}
+	if !found {
+		return fx.NoSuchRate
+	}
+	return nil
+}
+
+func rates(tx *fmemory.Tx, consumer consume2.Consumer[fx.Rate]) error {
+	for _, rate := range tx.Table(kTableName, newRateTable).(rateTable).sorted() {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(rate)
+	}
+	return nil
+}
+
+func reference(tx *fmemory.Tx) fin.Currency {
+	return tx.Table(kReferenceTableName, newReferenceTable).(*referenceTable).currency
+}
+
+func setReference(tx *fmemory.Tx, reference fin.Currency) {
+	tx.TableForUpdate(
+		kReferenceTableName, newReferenceTable).(*referenceTable).currency =
+		reference.OrDefault()
+}
+
+type memoryStore struct {
+	db fmemory.Doer
+}
+
+func (s memoryStore) Add(t db.Transaction, rates []fx.Rate) error {
+	return fmemory.ToDoer(s.db, t).Do(func(tx *fmemory.Tx) error {
+		return add(tx, rates)
+	})
+}
+
+func (s memoryStore) RateOnDate(
+	t db.Transaction,
+	currency fin.Currency,
+	date time.Time,
+	rate *fx.Rate) error {
+	return fmemory.ToDoer(s.db, t).Do(func(tx *fmemory.Tx) error {
+		return rateOnDate(tx, currency, date, rate)
+	})
+}
+
+func (s memoryStore) Rates(
+	t db.Transaction, consumer consume2.Consumer[fx.Rate]) error {
+	return fmemory.ToDoer(s.db, t).Do(func(tx *fmemory.Tx) error {
+		return rates(tx, consumer)
+	})
+}
+
+func (s memoryStore) Reference(t db.Transaction) (
+	result fin.Currency, err error) {
+	err = fmemory.ToDoer(s.db, t).Do(func(tx *fmemory.Tx) error {
+		result = reference(tx)
+		return nil
+	})
+	return
+}
+
+func (s memoryStore) SetReference(
+	t db.Transaction, reference fin.Currency) error {
+	return fmemory.ToDoer(s.db, t).Do(func(tx *fmemory.Tx) error {
+		setReference(tx, reference)
+		return nil
+	})
+}
@@ -0,0 +1,32 @@
+package for_memory
+
+import (
+	"testing"
+
+	fmemory "github.com/keep94/finances/fin/findb/for_memory"
+	"github.com/keep94/finances/fin/fx/fixture"
+)
+
+func TestRateOnDate(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).RateOnDate(t)
+}
+
+func TestReplaceRate(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).ReplaceRate(t)
+}
+
+func TestReadTable(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).ReadTable(t)
+}
+
+func TestReference(t *testing.T) {
+	db := fmemory.NewDb()
+	newFixture(db).Reference(t)
+}
+
+func newFixture(db *fmemory.Db) *fixture.Fixture {
+	return &fixture.Fixture{Store: New(db), Doer: fmemory.NewDoer(db)}
+}
@@ -0,0 +1,158 @@
+// Package for_sqlite stores dated exchange rates in a sqlite database.
+package for_sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/finances/fin/fx"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	"github.com/keep94/toolbox/db/sqlite3_rw"
+)
+
+const (
+	kSQLAddRate         = "insert or replace into fx_rates (currency, date, rate) values (?, ?, ?)"
+	kSQLRateOnDate      = "select currency, date, rate from fx_rates where currency = ? and date <= ? order by date desc limit 1"
+	kSQLRates           = "select currency, date, rate from fx_rates order by currency, date"
+	kSQLReference       = "select currency from fx_reference"
+	kSQLDeleteReference = "delete from fx_reference"
+	kSQLAddReference    = "insert into fx_reference (currency) values (?)"
+)
+
+// New creates sqlite implementation of fx.Store interface
+func New(db *sqlite3_db.Db) fx.Store {
+	return sqliteStore{db}
+}
+
+func add(tx *sql.Tx, rates []fx.Rate) error {
+	stmt, err := tx.Prepare(kSQLAddRate)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	row := &rawRate{}
+	for i := range rates {
+		row.init(&rates[i])
+		if err := row.Marshall(); err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(row.Values()...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rateOnDate(
+	tx *sql.Tx, currency fin.Currency, date time.Time, rate *fx.Rate) error {
+	return sqlite3_rw.ReadSingle[fx.Rate](
+		tx,
+		(&rawRate{}).init(rate),
+		fx.NoSuchRate,
+		kSQLRateOnDate,
+		currency.String(),
+		sqlite3_db.DateToString(date))
+}
+
+func rates(tx *sql.Tx, consumer consume2.Consumer[fx.Rate]) error {
+	return sqlite3_rw.ReadMultiple[fx.Rate](
+		tx, (&rawRate{}).init(&fx.Rate{}), consumer, kSQLRates)
+}
+
+func reference(tx *sql.Tx) (fin.Currency, error) {
+	var result string
+	err := tx.QueryRow(kSQLReference).Scan(&result)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return fin.Currency(result), err
+}
+
+func setReference(tx *sql.Tx, reference fin.Currency) error {
+	if _, err := tx.Exec(kSQLDeleteReference); err != nil {
+		return err
+	}
+	_, err := tx.Exec(kSQLAddReference, reference.String())
+	return err
+}
+
+type rawRate struct {
+	*fx.Rate
+	currency string
+	dateStr  string
+}
+
+func (r *rawRate) init(bo *fx.Rate) *rawRate {
+	r.Rate = bo
+	return r
+}
+
+func (r *rawRate) Ptrs() []interface{} {
+	return []interface{}{&r.currency, &r.dateStr, &r.Value}
+}
+
+func (r *rawRate) Values() []interface{} {
+	return []interface{}{r.currency, r.dateStr, r.Value}
+}
+
+func (r *rawRate) ValueRead() fx.Rate {
+	return *r.Rate
+}
+
+func (r *rawRate) Unmarshall() (err error) {
+	r.Currency = fin.Currency(r.currency)
+	r.Date, err = sqlite3_db.StringToDate(r.dateStr)
+	return
+}
+
+func (r *rawRate) Marshall() error {
+	r.currency = r.Currency.String()
+	r.dateStr = sqlite3_db.DateToString(r.Date)
+	return nil
+}
+
+type sqliteStore struct {
+	db sqlite3_db.Doer
+}
+
+func (s sqliteStore) Add(t db.Transaction, rates []fx.Rate) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return add(tx, rates)
+	})
+}
+
+func (s sqliteStore) RateOnDate(
+	t db.Transaction,
+	currency fin.Currency,
+	date time.Time,
+	rate *fx.Rate) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return rateOnDate(tx, currency, date, rate)
+	})
+}
+
+func (s sqliteStore) Rates(
+	t db.Transaction, consumer consume2.Consumer[fx.Rate]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return rates(tx, consumer)
+	})
+}
+
+func (s sqliteStore) Reference(t db.Transaction) (
+	result fin.Currency, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) (err error) {
+		result, err = reference(tx)
+		return
+	})
+	return
+}
+
+func (s sqliteStore) SetReference(
+	t db.Transaction, reference fin.Currency) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return setReference(tx, reference)
+	})
+}
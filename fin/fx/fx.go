@@ -0,0 +1,284 @@
+// Package fx stores dated exchange rates and converts between currencies
+// using the rate in effect on a given date.
+package fx
+
+import (
+	gocsv "encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+)
+
+var (
+	NoPermission = errors.New("fx: Insufficient permission.")
+	NoSuchRate   = errors.New("fx: No such rate.")
+	NoReference  = errors.New("fx: Rates have no reference currency.")
+)
+
+// Rate is the value of a currency on a particular date. A Rate stays in
+// effect until the next Rate for the same currency.
+type Rate struct {
+	// The currency
+	Currency fin.Currency
+	// The date the rate takes effect
+	Date time.Time
+	// What one unit of Currency is worth in the reference currency.
+	Value float64
+}
+
+// Store stores dated exchange rates.
+type Store interface {
+	// Add adds rates to the store. Add replaces any existing rate
+	// having the same currency and date.
+	Add(t db.Transaction, rates []Rate) error
+
+	// RateOnDate fetches the rate of currency in effect on date.
+	// RateOnDate returns NoSuchRate if currency has no rate on or
+	// before date.
+	RateOnDate(
+		t db.Transaction,
+		currency fin.Currency,
+		date time.Time,
+		rate *Rate) error
+
+	// Rates fetches all rates sorted by currency and then by date.
+	Rates(t db.Transaction, consumer consume2.Consumer[Rate]) error
+
+	// Reference fetches the reference currency, the currency in which
+	// the Value of each stored rate is expressed. Reference returns the
+	// empty currency if none has been recorded.
+	Reference(t db.Transaction) (fin.Currency, error)
+
+	// SetReference records the reference currency.
+	SetReference(t db.Transaction, reference fin.Currency) error
+}
+
+// NoPermissionStore implements Store by always returning NoPermission
+// error.
+type NoPermissionStore struct {
+}
+
+func (n NoPermissionStore) Add(t db.Transaction, rates []Rate) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) RateOnDate(
+	t db.Transaction,
+	currency fin.Currency,
+	date time.Time,
+	rate *Rate) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) Rates(
+	t db.Transaction, consumer consume2.Consumer[Rate]) error {
+	return NoPermission
+}
+
+func (n NoPermissionStore) Reference(t db.Transaction) (fin.Currency, error) {
+	return "", NoPermission
+}
+
+func (n NoPermissionStore) SetReference(
+	t db.Transaction, reference fin.Currency) error {
+	return NoPermission
+}
+
+type ReadOnlyStore struct {
+	NoPermissionStore
+	store Store
+}
+
+func ReadOnlyWrapper(s Store) ReadOnlyStore {
+	return ReadOnlyStore{store: s}
+}
+
+func (s ReadOnlyStore) RateOnDate(
+	t db.Transaction,
+	currency fin.Currency,
+	date time.Time,
+	rate *Rate) error {
+	return s.store.RateOnDate(t, currency, date, rate)
+}
+
+func (s ReadOnlyStore) Rates(
+	t db.Transaction, consumer consume2.Consumer[Rate]) error {
+	return s.store.Rates(t, consumer)
+}
+
+func (s ReadOnlyStore) Reference(t db.Transaction) (fin.Currency, error) {
+	return s.store.Reference(t)
+}
+
+// AddRates adds rates whose values are expressed in reference to store.
+// If store has no reference currency yet, AddRates records reference.
+// AddRates returns an error without adding anything if the rates in
+// store are in a different reference currency. t must be non-nil.
+func AddRates(
+	t db.Transaction, store Store, reference fin.Currency, rates []Rate) error {
+	reference = reference.OrDefault()
+	current, err := store.Reference(t)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		if err := store.SetReference(t, reference); err != nil {
+			return err
+		}
+	} else if current != reference {
+		return fmt.Errorf(
+			"fx: Stored rates are in %s, not %s.", current, reference)
+	}
+	return store.Add(t, rates)
+}
+
+// Table holds dated exchange rates in memory. Table implements
+// fin.ExchangeRates so that report code converts each entry using the
+// rate in effect on the date of that entry rather than today's rate.
+// Table instances are immutable and safe to use with multiple goroutines.
+type Table struct {
+	reference  fin.Currency
+	byCurrency map[fin.Currency][]Rate
+}
+
+// NewTable returns a new Table. reference is the currency in which the
+// Value field of each Rate is expressed. One unit of reference is always
+// worth 1.0.
+func NewTable(reference fin.Currency, rates []Rate) *Table {
+	byCurrency := make(map[fin.Currency][]Rate)
+	for _, rate := range rates {
+		currency := rate.Currency.OrDefault()
+		byCurrency[currency] = append(byCurrency[currency], rate)
+	}
+	for _, currencyRates := range byCurrency {
+		sort.SliceStable(currencyRates, func(i, j int) bool {
+			return currencyRates[i].Date.Before(currencyRates[j].Date)
+		})
+	}
+	return &Table{reference: reference.OrDefault(), byCurrency: byCurrency}
+}
+
+// ReadTable reads all the rates in store into a new Table whose
+// reference currency is the reference currency of store. ReadTable
+// returns NoReference if store has rates but no reference currency.
+func ReadTable(t db.Transaction, store Store) (*Table, error) {
+	var rates []Rate
+	if err := store.Rates(t, consume2.AppendTo(&rates)); err != nil {
+		return nil, err
+	}
+	reference, err := store.Reference(t)
+	if err != nil {
+		return nil, err
+	}
+	if reference == "" && len(rates) > 0 {
+		return nil, NoReference
+	}
+	return NewTable(reference, rates), nil
+}
+
+// Reference returns the reference currency of this table.
+func (t *Table) Reference() fin.Currency {
+	return t.reference
+}
+
+// Empty returns true if this table has no rates.
+func (t *Table) Empty() bool {
+	return len(t.byCurrency) == 0
+}
+
+// RateOnDate returns what one unit of currency is worth in the reference
+// currency on date. RateOnDate returns false if currency has no rate on
+// or before date.
+func (t *Table) RateOnDate(
+	currency fin.Currency, date time.Time) (float64, bool) {
+	currency = currency.OrDefault()
+	if currency == t.reference {
+		return 1.0, true
+	}
+	currencyRates := t.byCurrency[currency]
+	idx := sort.Search(len(currencyRates), func(i int) bool {
+		return currencyRates[i].Date.After(date)
+	})
+	if idx == 0 {
+		return 0, false
+	}
+	return currencyRates[idx-1].Value, true
+}
+
+// Rate returns how many units of to one unit of from buys on date.
+func (t *Table) Rate(from, to fin.Currency, date time.Time) (
+	float64, error) {
+	if from.OrDefault() == to.OrDefault() {
+		return 1.0, nil
+	}
+	fromValue, fromOk := t.RateOnDate(from, date)
+	toValue, toOk := t.RateOnDate(to, date)
+	if !fromOk || !toOk || fromValue <= 0 || toValue <= 0 {
+		return 0, fin.NoExchangeRate
+	}
+	return fromValue / toValue, nil
+}
+
+// ReadCSV reads rates from a csv file. Each line of the file has a date,
+// a currency, and a value in that order. The date is either yyyy-mm-dd
+// or yyyymmdd. ReadCSV skips an optional header line that starts with
+// "date".
+func ReadCSV(r io.Reader) ([]Rate, error) {
+	reader := gocsv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	var result []Rate
+	lineNo := 0
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		lineNo++
+		if lineNo == 1 && strings.EqualFold(strings.TrimSpace(line[0]), "date") {
+			continue
+		}
+		rate, err := parseCSVLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("fx: line %d: %v", lineNo, err)
+		}
+		result = append(result, rate)
+	}
+}
+
+func parseCSVLine(line []string) (rate Rate, err error) {
+	rate.Date, err = parseDate(strings.TrimSpace(line[0]))
+	if err != nil {
+		return
+	}
+	if rate.Currency, err = fin.ParseCurrency(line[1]); err != nil {
+		return
+	}
+	rate.Value, err = strconv.ParseFloat(strings.TrimSpace(line[2]), 64)
+	if err != nil {
+		return
+	}
+	if rate.Value <= 0 {
+		err = errors.New("rate must be positive")
+	}
+	return
+}
+
+func parseDate(s string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", s); err == nil {
+		return date, nil
+	}
+	return time.Parse(date_util.YMDFormat, s)
+}
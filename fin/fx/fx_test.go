@@ -0,0 +1,68 @@
+package fx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/keep94/finances/fin"
+	"github.com/keep94/toolbox/date_util"
+)
+
+func TestTable(t *testing.T) {
+	table := NewTable("EUR", []Rate{
+		{Currency: "USD", Date: date_util.YMD(2024, 2, 1), Value: 0.92},
+		{Currency: "USD", Date: date_util.YMD(2024, 1, 1), Value: 0.9},
+	})
+	if table.Reference() != "EUR" {
+		t.Errorf("Expected EUR, got %v", table.Reference())
+	}
+	if value, ok := table.RateOnDate("", date_util.YMD(2024, 1, 31)); !ok || value != 0.9 {
+		t.Errorf("Expected 0.9, got %v %v", value, ok)
+	}
+	if value, ok := table.RateOnDate("EUR", date_util.YMD(1999, 1, 1)); !ok || value != 1.0 {
+		t.Errorf("Expected 1.0, got %v %v", value, ok)
+	}
+	if _, ok := table.RateOnDate("USD", date_util.YMD(2023, 12, 31)); ok {
+		t.Error("Expected no rate before first date.")
+	}
+	rate, err := table.Rate("EUR", "USD", date_util.YMD(2024, 2, 1))
+	if err != nil || rate != 1.0/0.92 {
+		t.Errorf("Expected %v, got %v %v", 1.0/0.92, rate, err)
+	}
+	if _, err = table.Rate("GBP", "USD", date_util.YMD(2024, 2, 1)); err != fin.NoExchangeRate {
+		t.Errorf("Expected NoExchangeRate, got %v", err)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	content := `date,currency,rate
+2024-01-02,eur,1.1
+20240201, CAD, 0.74
+`
+	rates, err := ReadCSV(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := []Rate{
+		{Currency: "EUR", Date: date_util.YMD(2024, 1, 2), Value: 1.1},
+		{Currency: "CAD", Date: date_util.YMD(2024, 2, 1), Value: 0.74},
+	}
+	if !reflect.DeepEqual(expected, rates) {
+		t.Errorf("Expected %v, got %v", expected, rates)
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	badContents := []string{
+		"2024-01-02,EUR\n",
+		"2024-13-02,EUR,1.1\n",
+		"2024-01-02,EURO,1.1\n",
+		"2024-01-02,EUR,-1.1\n",
+	}
+	for _, content := range badContents {
+		if _, err := ReadCSV(strings.NewReader(content)); err == nil {
+			t.Errorf("Expected error for %q", content)
+		}
+	}
+}
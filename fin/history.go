@@ -0,0 +1,33 @@
+package fin
+
+import (
+	"time"
+)
+
+// EntryHistory records one add, update, or delete of an entry.
+type EntryHistory struct {
+	// Unique Id. Later changes have larger ids.
+	Id int64
+	// The id of the changed entry
+	EntryId int64
+	// The id of the change set. Changes made together share a change set.
+	ChangeId int64
+	// The id of the user who made the change. 0 if unknown.
+	UserId int64
+	// When the change happened
+	Time time.Time
+	// The entry before the change. nil if the change added the entry.
+	Before *Entry
+	// The entry after the change. nil if the change deleted the entry.
+	After *Entry
+}
+
+// IsAdd returns true if this change added the entry.
+func (h *EntryHistory) IsAdd() bool {
+	return h.Before == nil
+}
+
+// IsDelete returns true if this change deleted the entry.
+func (h *EntryHistory) IsDelete() bool {
+	return h.After == nil
+}
@@ -141,10 +141,16 @@ type CatFilter func(c Cat) bool
 // CatRecs. The zero value of CatPayment has no CatRecs, a payment ID of
 // zero, and is not reconciled. CatPayment works like a value type with the
 // assignment operator, but to test for equality use reflect.DeepEqual.
+//
+// All amounts in a CatPayment are in the currency of the payment account.
+// When the CatRecs include accounts in a different currency, the exchange
+// rate says how many units of their currency one unit of the payment
+// account currency buys.
 type CatPayment struct {
-	cr []CatRec
-	id int64
-	r  bool
+	cr   []CatRec
+	id   int64
+	r    bool
+	rate float64
 }
 
 // NewCatPayment returns a new CatPayment having payment of paymentId and
@@ -198,6 +204,24 @@ func (c *CatPayment) Reconciled() bool {
 	return c.r
 }
 
+// ExchangeRate returns the exchange rate used to convert amounts to the
+// currency of the accounts in the CatRecs. ExchangeRate returns 1.0 if no
+// exchange rate was set.
+func (c *CatPayment) ExchangeRate() float64 {
+	if c.rate == 0 {
+		return 1.0
+	}
+	return c.rate
+}
+
+// SetExchangeRate sets the exchange rate. 0 or 1.0 means no exchange rate.
+func (c *CatPayment) SetExchangeRate(rate float64) {
+	if rate == 1.0 {
+		rate = 0
+	}
+	c.rate = rate
+}
+
 // Marks as reconciled. id is a payment Id. Returns true on success or
 // false if id does not match payment ID or any of the CatRecs.
 func (c *CatPayment) Reconcile(id int64) bool {
@@ -241,11 +265,14 @@ func (c *CatPayment) WithPayment(id int64) bool {
 		if c.cr[i].Cat == pc {
 			ncr := make([]CatRec, 1)
 			ncr[0].Cat = Cat{Id: c.id, Type: AccountCat}
-			ncr[0].Amount = -c.cr[i].Amount
+			ncr[0].Amount = -ConvertAmount(c.cr[i].Amount, c.ExchangeRate())
 			ncr[0].Reconciled = c.r
 			c.id = c.cr[i].Cat.Id
 			c.r = c.cr[i].Reconciled
 			c.cr = ncr
+			if c.rate != 0 {
+				c.rate = 1.0 / c.rate
+			}
 			return true
 		}
 	}
@@ -286,15 +313,32 @@ func (c *CatPayment) SetSingleCat(cat Cat) bool {
 	if cat.Type == AccountCat && cat.Id == c.id {
 		return false
 	}
+	rate := c.rate
 	*c = NewCatPayment(cat, -c.Total(), c.r, c.id)
+	c.rate = rate
 	return true
 }
 
+func (c *CatPayment) convert(rate float64) {
+	ncr := make([]CatRec, len(c.cr))
+	for i := range c.cr {
+		ncr[i] = c.cr[i]
+		ncr[i].Amount = ConvertAmount(c.cr[i].Amount, rate)
+	}
+	c.cr = ncr
+	if c.rate != 0 {
+		c.SetExchangeRate(c.rate / rate)
+	} else {
+		c.SetExchangeRate(1.0 / rate)
+	}
+}
+
 // CatPaymentBuilder builds the specifications for a CatPayment value.
 type CatPaymentBuilder struct {
-	m  map[Cat]CatRec
-	pc Cat
-	r  bool
+	m    map[Cat]CatRec
+	pc   Cat
+	r    bool
+	rate float64
 }
 
 // Set sets this CatPaymentBuilder to cp so that calling Build on it will
@@ -307,6 +351,7 @@ func (c *CatPaymentBuilder) Set(cp *CatPayment) *CatPaymentBuilder {
 	}
 	c.SetPaymentId(cp.PaymentId())
 	c.SetReconciled(cp.Reconciled())
+	c.SetExchangeRate(cp.ExchangeRate())
 	return c
 }
 
@@ -327,7 +372,9 @@ func (c *CatPaymentBuilder) Build() CatPayment {
 		catRecs = c.newCatRecSlice()
 	}
 	c.m = nil
-	return CatPayment{cr: catRecs, id: c.pc.Id, r: c.r}
+	result := CatPayment{cr: catRecs, id: c.pc.Id, r: c.r}
+	result.SetExchangeRate(c.rate)
+	return result
 }
 
 // AddCatRec Adds a CatRec. It merges CatRecs having the same category.
@@ -357,11 +404,19 @@ func (c *CatPaymentBuilder) SetReconciled(x bool) *CatPaymentBuilder {
 	return c
 }
 
+// SetExchangeRate sets the exchange rate. 0 or 1.0 means no exchange rate.
+func (c *CatPaymentBuilder) SetExchangeRate(x float64) *CatPaymentBuilder {
+	c.initialize()
+	c.rate = x
+	return c
+}
+
 func (c *CatPaymentBuilder) initialize() {
 	if c.m == nil {
 		c.m = make(map[Cat]CatRec)
 		c.pc = Cat{Type: AccountCat}
 		c.r = false
+		c.rate = 0
 	}
 }
 
@@ -402,7 +457,9 @@ type Entry struct {
 	CheckNo string
 	CatPayment
 	Status ReviewStatus
-	Etag   uint64
+	// Free-form tags sorted and normalized as returned by ParseTags.
+	Tags []string
+	Etag uint64
 }
 
 func (e *Entry) String() string {
@@ -435,13 +492,16 @@ type Account struct {
 	RCount int
 	// Auto import should ignore transactions before this date.
 	ImportSD time.Time
+	// The currency of the account. Balance and RBalance are in this currency.
+	Currency Currency
 }
 
 func (a *Account) String() string {
 	return fmt.Sprintf("%v", *a)
 }
 
-// AccountDelta represents changes in a single account.
+// AccountDelta represents changes in a single account. Amounts are in the
+// currency of the account.
 type AccountDelta struct {
 	// Balance is change in overall balance in cents.
 	Balance int64
@@ -486,10 +546,15 @@ func (a AccountDeltas) Exclude(catPayment *CatPayment) {
 
 func (a AccountDeltas) add(catPayment *CatPayment, multiplier int) {
 	var total int64
+	rate := catPayment.ExchangeRate()
 	for i := range catPayment.cr {
 		catrec := &catPayment.cr[i]
 		if catrec.Cat.Type == AccountCat {
-			a._add(catrec.Cat.Id, catrec.Amount, catrec.Reconciled, multiplier)
+			a._add(
+				catrec.Cat.Id,
+				ConvertAmount(catrec.Amount, rate),
+				catrec.Reconciled,
+				multiplier)
 		}
 		total -= catrec.Amount
 	}
@@ -508,7 +573,9 @@ func (a AccountDeltas) _add(id int64, amount int64, reconciled bool, multiplier
 	}
 }
 
-// CatTotals represents category totals
+// CatTotals represents category totals. CatTotals does no currency
+// conversion, so callers totaling entries from accounts in different
+// currencies should first convert them with a BaseConverter.
 type CatTotals map[Cat]int64
 
 func (c CatTotals) Include(catPayment CatPayment) {
@@ -3,6 +3,7 @@ package fin
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -276,6 +277,145 @@ func TestAccountDeltas(t *testing.T) {
 	}
 }
 
+func TestAccountDeltasExchangeRate(t *testing.T) {
+	var d AccountDeltas = make(map[int64]*AccountDelta)
+	cpb := CatPaymentBuilder{}
+	cp := cpb.AddCatRec(
+		CatRec{NewCat("2:2"), 1000, false}).AddCatRec(
+		CatRec{NewCat("0:7"), 500, false}).SetPaymentId(
+		1).SetExchangeRate(0.9).Build()
+	d.Include(&cp)
+	var expected AccountDeltas = map[int64]*AccountDelta{
+		1: {-1500, 0, 1, 0}, 2: {900, 0, 1, 0}}
+	if !reflect.DeepEqual(expected, d) {
+		t.Errorf("Expected %v, got %v", expected, d)
+	}
+	d.Exclude(&cp)
+	expected = map[int64]*AccountDelta{}
+	if !reflect.DeepEqual(expected, d) {
+		t.Errorf("Expected %v, got %v", expected, d)
+	}
+}
+
+func TestWithPaymentExchangeRate(t *testing.T) {
+	cp := NewCatPayment(NewCat("2:2"), 1000, false, 1)
+	cp.SetExchangeRate(0.9)
+	if !cp.WithPayment(2) {
+		t.Fatal("Expected WithPayment to succeed.")
+	}
+	expected := NewCatPayment(NewCat("2:1"), -900, false, 2)
+	expected.SetExchangeRate(1.0 / 0.9)
+	if !reflect.DeepEqual(expected, cp) {
+		t.Errorf("Expected %v, got %v", expected, cp)
+	}
+}
+
+func TestCatPaymentBuilderExchangeRate(t *testing.T) {
+	cpb := CatPaymentBuilder{}
+	cp := cpb.AddCatRec(
+		CatRec{Cat: NewCat("2:2"), Amount: 1000}).SetPaymentId(
+		1).SetExchangeRate(1.0).Build()
+	if cp.ExchangeRate() != 1.0 {
+		t.Errorf("Expected 1.0, got %v", cp.ExchangeRate())
+	}
+	if !reflect.DeepEqual(NewCatPayment(NewCat("2:2"), 1000, false, 1), cp) {
+		t.Error("Expected rate of 1.0 to equal no rate.")
+	}
+	cp.SetExchangeRate(1.25)
+	cp2 := cpb.Set(&cp).Build()
+	if !reflect.DeepEqual(cp, cp2) {
+		t.Errorf("Expected %v, got %v", cp, cp2)
+	}
+}
+
+func TestFixedRates(t *testing.T) {
+	rates := FixedRates{"USD": 1.0, "EUR": 1.1, "JPY": 0.0067}
+	var zero time.Time
+	rate, err := rates.Rate("EUR", "", zero)
+	if err != nil || rate != 1.1 {
+		t.Errorf("Expected 1.1, got %v %v", rate, err)
+	}
+	rate, err = rates.Rate("GBP", "GBP", zero)
+	if err != nil || rate != 1.0 {
+		t.Errorf("Expected 1.0, got %v %v", rate, err)
+	}
+	if _, err = rates.Rate("GBP", "USD", zero); err != NoExchangeRate {
+		t.Errorf("Expected NoExchangeRate, got %v", err)
+	}
+}
+
+func TestBaseConverter(t *testing.T) {
+	converter := &BaseConverter{
+		Base:     USD,
+		Rates:    FixedRates{"USD": 1.0, "EUR": 1.1},
+		Accounts: AccountCurrencyMap{1: "EUR"},
+	}
+	entry := Entry{CatPayment: NewCatPayment(NewCat("0:7"), 1000, false, 1)}
+	if err := converter.Convert(&entry); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if total := entry.Total(); total != -1100 {
+		t.Errorf("Expected -1100, got %v", total)
+	}
+}
+
+func TestParseCurrency(t *testing.T) {
+	c, err := ParseCurrency(" eur ")
+	if err != nil || c != "EUR" {
+		t.Errorf("Expected EUR, got %v %v", c, err)
+	}
+	c, err = ParseCurrency("")
+	if err != nil || c != USD {
+		t.Errorf("Expected USD, got %v %v", c, err)
+	}
+	if _, err = ParseCurrency("EURO"); err == nil {
+		t.Error("Expected error")
+	}
+	if s := FormatCurrency(347, "EUR"); s != "3.47 EUR" {
+		t.Errorf("Expected 3.47 EUR, got %v", s)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags := ParseTags(" Vacation-2026,kids  reimbursable, KIDS")
+	expected := []string{"kids", "reimbursable", "vacation-2026"}
+	if !reflect.DeepEqual(expected, tags) {
+		t.Errorf("Expected %v, got %v", expected, tags)
+	}
+	if s := FormatTags(tags); s != "kids, reimbursable, vacation-2026" {
+		t.Errorf("Got %v", s)
+	}
+	if tags := ParseTags(" , "); tags != nil {
+		t.Errorf("Expected nil, got %v", tags)
+	}
+	entry := Entry{Tags: expected}
+	if !entry.HasTag("Kids") || entry.HasTag("kid") {
+		t.Error("HasTag returned wrong result")
+	}
+}
+
+func TestTagTotals(t *testing.T) {
+	totals := make(TagTotals)
+	totals.Include(Entry{
+		CatPayment: NewCatPayment(NewCat("0:7"), 500, false, 1),
+		Tags:       []string{"kids", "vacation"}})
+	totals.Include(Entry{
+		CatPayment: NewCatPayment(NewCat("0:8"), 300, false, 1),
+		Tags:       []string{"kids"}})
+	totals.Include(Entry{
+		CatPayment: NewCatPayment(NewCat("0:8"), 100, false, 1)})
+	expected := TagTotals{
+		"kids":     {NewCat("0:7"): 500, NewCat("0:8"): 300},
+		"vacation": {NewCat("0:7"): 500},
+	}
+	if !reflect.DeepEqual(expected, totals) {
+		t.Errorf("Expected %v, got %v", expected, totals)
+	}
+	if tags := totals.Tags(); !reflect.DeepEqual([]string{"kids", "vacation"}, tags) {
+		t.Errorf("Got %v", tags)
+	}
+}
+
 func TestZeroCatPaymentsEqual(t *testing.T) {
 	zero := CatPayment{}
 	cpb := CatPaymentBuilder{}
@@ -0,0 +1,69 @@
+package fin
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ParseTags parses tags separated by commas or whitespace such as
+// "Vacation-2026, kids". ParseTags converts tags to lower case, removes
+// duplicates, and returns them sorted. ParseTags returns nil if s
+// contains no tags.
+func ParseTags(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '|' || unicode.IsSpace(r)
+	})
+	if len(fields) == 0 {
+		return nil
+	}
+	tagSet := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		tagSet[strings.ToLower(field)] = struct{}{}
+	}
+	result := make([]string, 0, len(tagSet))
+	for tag := range tagSet {
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// FormatTags is the inverse of ParseTags.
+func FormatTags(tags []string) string {
+	return strings.Join(tags, ", ")
+}
+
+// HasTag returns true if this entry has given tag. tag is compared
+// ignoring case.
+func (e *Entry) HasTag(tag string) bool {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	idx := sort.SearchStrings(e.Tags, tag)
+	return idx < len(e.Tags) && e.Tags[idx] == tag
+}
+
+// TagTotals totals CatPayment values by tag. An entry with several tags
+// counts toward each of them.
+type TagTotals map[string]CatTotals
+
+// Include adds entry to these totals.
+func (t TagTotals) Include(entry Entry) {
+	for _, tag := range entry.Tags {
+		totals, ok := t[tag]
+		if !ok {
+			totals = make(CatTotals)
+			t[tag] = totals
+		}
+		totals.Include(entry.CatPayment)
+	}
+}
+
+// Tags returns the tags in these totals sorted.
+func (t TagTotals) Tags() []string {
+	result := make([]string, 0, len(t))
+	for tag := range t {
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
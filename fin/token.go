@@ -0,0 +1,59 @@
+package fin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const (
+	// ApiTokenPrefix begins the secret of every API token so that the
+	// secrets are easy to recognize.
+	ApiTokenPrefix = "fin_"
+
+	kApiTokenBytes = 32
+)
+
+// ApiToken lets a non-interactive client use ledger as a user. Only the
+// hash of the secret of a token is stored; the secret itself is shown
+// once when the token is created.
+type ApiToken struct {
+	Id     int64
+	UserId int64
+	// What the user calls the token
+	Name string
+	// HashApiTokenSecret of the secret
+	Hash string
+	// ReadPermission or AllPermission. A token never has more
+	// permission than its user.
+	Permission Permission
+	// The name of the book the token works in.
+	Book string
+	// If non-empty, the token may see only these accounts of Book.
+	AccountIds []int64
+	Created    time.Time
+	// When the token was last used. Zero means never.
+	LastUsed time.Time
+}
+
+// NewApiTokenSecret returns a new random secret for an API token along
+// with its hash.
+func NewApiTokenSecret() (secret, hash string, err error) {
+	raw := make([]byte, kApiTokenBytes)
+	if _, err = rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret = ApiTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return secret, HashApiTokenSecret(secret), nil
+}
+
+// HashApiTokenSecret returns the hash of the secret of an API token.
+// Secrets are long and random, so a fast hash is enough and lets ledger
+// find a token by the hash of its secret.
+func HashApiTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(secret)))
+	return hex.EncodeToString(sum[:])
+}
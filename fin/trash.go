@@ -0,0 +1,21 @@
+package fin
+
+import (
+	"time"
+)
+
+// TrashedEntry is a deleted entry that can still be restored. The entry
+// keeps its original Id.
+type TrashedEntry struct {
+	Entry
+	// When the entry went to the trash
+	Trashed time.Time
+}
+
+// TrashedRecurringEntry is a deleted recurring entry that can still be
+// restored. The recurring entry keeps its original Id.
+type TrashedRecurringEntry struct {
+	RecurringEntry
+	// When the recurring entry went to the trash
+	Trashed time.Time
+}
@@ -9,6 +9,7 @@ require (
 	github.com/keep94/sessions v0.1.0
 	github.com/keep94/toolbox v0.12.0
 	github.com/keep94/weblogs v1.0.1
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/stretchr/testify v1.10.0
 	gopkg.in/yaml.v2 v2.3.0